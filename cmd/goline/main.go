@@ -10,28 +10,144 @@ import (
 	"github.com/kazz187/goline/cmd/goline/subcmd"
 )
 
+// version is the version of Goline
+const version = "0.1.0"
+
 var (
 	// Create a new application
 	app = kingpin.New("goline", "CUI-based AI agent inspired by Cline")
 
 	// Set application details
-	_ = app.Version("0.1.0")
+	_ = app.Version(version)
 	_ = app.Author("kazz187")
 	_ = app.UsageWriter(os.Stdout)
 	_ = app.HelpFlag.Short('h')
 
+	// Global flags
+	a11y    = app.Flag("a11y", "Use a linear, plain-text interface suitable for screen readers").Bool()
+	noTUI   = app.Flag("no-tui", "Use a line-based REPL instead of the TUI, the default when stdout is not a terminal").Bool()
+	profile = app.Flag("profile", "Profile to use for this run, overriding the active profile and the repository provider and model").Envar("GOLINE_PROFILE").HintAction(subcmd.CompleteProfiles).String()
+
 	// REPL commands
-	startCmd = app.Command("start", "Start a new Goline task")
-	_        = startCmd.Help("Start a new Goline task with an AI agent. This will open a TUI interface where you can interact with the AI agent.")
+	startCmd      = app.Command("start", "Start a new Goline task")
+	_             = startCmd.Help("Start a new Goline task with an AI agent. This will open a TUI interface where you can interact with the AI agent. Content piped to stdin, e.g. cat build.log | goline start \"why did this fail?\", is attached to the first message as context.")
+	startPrompt   = startCmd.Arg("prompt", "First message of the task").String()
+	startIssue    = startCmd.Flag("from-issue", "Work on an issue, given by its URL or as owner/repo#123: its title, description and comments are added to the first message").PlaceHolder("URL|OWNER/REPO#N").String()
+	startModel    = startCmd.Flag("model", "Model of the task, of another provider if prefixed with it, e.g. anthropic/claude-3-5-haiku-20241022. The model command of the REPL switches it mid-task").PlaceHolder("[PROVIDER/]MODEL").String()
+	startTemplate = startCmd.Flag("template", "Task template of .goline/templates or ~/.goline/templates, e.g. refactor: its prompt, with the prompt argument, is the first message, and its model and mentioned files are used").PlaceHolder("NAME").HintAction(subcmd.CompleteTemplates).String()
+	startReadOnly = startCmd.Flag("read-only", "Explore the codebase without modifying it: the AI agents of the tasks cannot edit files or run plugins, and only run safe read commands, as with goline run --read-only").Bool()
+
+	resumeCmd             = app.Command("resume", "Resume a paused task")
+	_                     = resumeCmd.Help("Resume a previously paused task. This will reopen the TUI interface for the specified task. A task is only resumed from the workspace it belongs to, the repository it was started in, unless --ignore-workspace is given.")
+	taskID                = resumeCmd.Arg("taskID", "ID of the task to resume").HintAction(subcmd.CompleteTaskIDs).String()
+	_                     = taskID
+	resumeIgnoreWorkspace = resumeCmd.Flag("ignore-workspace", "Resume the task even if the current directory is not in the workspace it belongs to").Bool()
+
+	branchCmd        = app.Command("branch", "Branch a new task from a checkpoint")
+	_                = branchCmd.Help("Fork a new task at a checkpoint to explore an alternative solution: the workspace is restored to the checkpoint and the conversation of the new task stops where the checkpoint was saved, while the original task keeps its history and checkpoints. The new task then opens in the TUI.")
+	branchCheckpoint = branchCmd.Arg("checkpointID", "Full or abbreviated ID of the checkpoint to branch at").Required().String()
+	branchTask       = branchCmd.Flag("task", "Task of the checkpoint, found from the checkpoints recorded in the task histories if omitted").PlaceHolder("TASK_ID").HintAction(subcmd.CompleteTaskIDs).String()
+	branchYes        = branchCmd.Flag("yes", "Overwrite the workspace with the checkpoint without asking").Short('y').Bool()
+
+	runCmd      = app.Command("run", "Run a task without the interactive interface")
+	_           = runCmd.Help("Run a task non-interactively for CI and scripting: the prompt is read from the argument or stdin, content piped to stdin alongside a prompt argument is attached as context (e.g. cat build.log | goline run \"why did this fail?\"), the output is streamed to stdout, and edits and checkpoints are written as usual. Tool uses that are not auto-approved by the profile or --approve are denied. With --duration the task runs autonomously for a time box, posting progress summaries every --summary-interval, and is paused for review at the limit. Exits with 0 when the task is completed, 2 when it stopped early because the AI needed input or a limit was reached, 130 when interrupted and 1 on errors.")
+	runPrompt   = runCmd.Arg("prompt", "Task to run, read from stdin if omitted or -").String()
+	runApprove  = runCmd.Flag("approve", "Action to run without asking, in addition to the profile's auto-approvals (repeatable)").Enums("read", "edit", "execute")
+	runMaxTurns = runCmd.Flag("max-turns", "Maximum number of AI responses before the task is stopped").Default("50").Int()
+	runDuration = runCmd.Flag("duration", "Pause the task for review once it has run this long, e.g. 30m (default: autonomy.duration of the config, no limit if unset)").Duration()
+	runSummary  = runCmd.Flag("summary-interval", "Post a progress summary to the task history this often, e.g. 10m (default: autonomy.summary_interval of the config)").Duration()
+	runTraceLLM = runCmd.Flag("trace-llm", "Record the requests sent to the provider and their raw responses, with the API keys redacted, in the task directory (see goline trace show)").Bool()
+	runModel    = runCmd.Flag("model", "Model of the task, of another provider if prefixed with it, e.g. anthropic/claude-3-5-haiku-20241022").PlaceHolder("[PROVIDER/]MODEL").String()
+	runReadOnly = runCmd.Flag("read-only", "Explore the codebase without modifying it: write_to_file, replace_in_file and the plugins are disabled, and only safe read commands such as ls, cat, grep or git log run, with those of command_policy.read_only in the global config").Bool()
+	runTemplate = runCmd.Flag("template", "Task template of .goline/templates or ~/.goline/templates, e.g. refactor: its prompt, with the prompt argument, is the task, run with its model, tools, auto-approvals and mentioned files").PlaceHolder("NAME").HintAction(subcmd.CompleteTemplates).String()
 
-	resumeCmd = app.Command("resume", "Resume a paused task")
-	_         = resumeCmd.Help("Resume a previously paused task. This will reopen the TUI interface for the specified task.")
-	taskID    = resumeCmd.Arg("taskID", "ID of the task to resume").String()
-	_         = taskID
+	watchCmd      = app.Command("watch", "Re-run a read-only prompt when files change")
+	_             = watchCmd.Help("Watch the workspace and re-run a read-only prompt whenever files change, streaming a concise result. Combine it with --cmd to summarize the output of a command, e.g. goline watch --cmd \"go test ./...\" \"summarize test failures\".")
+	watchPrompt   = watchCmd.Arg("prompt", "Instruction to run on every change").Required().String()
+	watchCommand  = watchCmd.Flag("cmd", "Shell command to run on every change, its output is sent with the prompt").String()
+	watchDebounce = watchCmd.Flag("debounce", "How long the workspace must be quiet before the prompt is re-run").Default("1s").Duration()
+
+	reviewCmd          = app.Command("review", "Review a git diff without editing files")
+	_                  = reviewCmd.Help("Ask the AI agent to critique the changes in the working tree, the staged changes, or a branch or pull request ref. Findings are printed with file, line, severity and suggestion, or as JSON with --json for CI usage.")
+	reviewInstructions = reviewCmd.Arg("instructions", "Optional review instructions, mentions such as @/path/to/file are expanded").String()
+	reviewStaged       = reviewCmd.Flag("staged", "Review the staged changes").Bool()
+	reviewRef          = reviewCmd.Flag("ref", "Review a branch or pull request ref (e.g. origin/feature or pull/123/head) against HEAD").String()
+	reviewJSON         = reviewCmd.Flag("json", "Print the findings as JSON").Bool()
+	reviewFailOn       = reviewCmd.Flag("fail-on", "Exit with an error if there are findings with this severity or higher").Enum("error", "warning", "info")
+
+	indexCmd    = app.Command("index", "Build the semantic index of the workspace")
+	_           = indexCmd.Help("Build or update the semantic index of the files in the current directory, stored in ~/.goline/index. Files are split into chunks of lines whose embeddings are computed locally by default, or with the OpenAI-compatible embeddings API of index.provider and index.model in the config. Files ignored by .golineignore are left out. Once a workspace is indexed, its tasks update the index when they start and can use the semantic_search tool to find code by description. With --watch the index is kept up to date as files change.")
+	indexWatch  = indexCmd.Flag("watch", "Keep the index up to date as files change, until interrupted").Bool()
+	indexSearch = indexCmd.Flag("search", "Print the chunks most similar to a query after updating the index").String()
 
 	// Oneshot commands
-	tasksCmd = app.Command("tasks", "List all tasks")
-	_        = tasksCmd.Help("List all tasks, including active, paused, and completed tasks. Shows task ID, prompt, and status.")
+	tasksCmd     = app.Command("tasks", "Manage tasks")
+	tasksListCmd = tasksCmd.Command("list", "List the tasks of the current workspace").Default()
+	_            = tasksListCmd.Help("List the tasks of the repository of the current directory, including active, paused, and completed tasks, the most recently updated first. Shows task ID, status, last update and prompt. With --all, the tasks of every workspace are listed with their workspace. With storage.backend set to sqlite in the config, the tasks are listed from the index in ~/.goline/tasks.db, which stays fast with hundreds of tasks.")
+	tasksListAll = tasksListCmd.Flag("all", "List the tasks of every workspace").Bool()
+
+	tasksVerifyCmd    = tasksCmd.Command("verify", "Check a task's stored data for corruption")
+	_                 = tasksVerifyCmd.Help("Verify the checksums of a task's metadata and history, and report what is damaged. With --repair, damaged history segments are rewritten with the events that can still be read.")
+	tasksVerifyTaskID = tasksVerifyCmd.Arg("taskID", "ID of the task to verify").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	tasksVerifyRepair = tasksVerifyCmd.Flag("repair", "Rewrite damaged history segments with the readable events, keeping a .corrupt backup").Bool()
+
+	searchCmd   = app.Command("search", "Search the transcripts of the tasks")
+	_           = searchCmd.Help("Search the conversations of all tasks for events containing every word of a query, e.g. goline search \"flaky login test\", and print the matching tasks with the text around the match. With storage.backend set to sqlite in the config, the transcripts are indexed in ~/.goline/tasks.db for fast full-text search, the words matching the words starting with them.")
+	searchQuery = searchCmd.Arg("query", "Words to search for").Required().String()
+	searchLimit = searchCmd.Flag("limit", "Maximum number of matches shown").Default("20").Int()
+
+	storageCmd   = app.Command("storage", "Show the disk space used by the tasks")
+	_            = storageCmd.Help("Show the disk space used by each task in ~/.goline/tasks, split into checkpoints (shadow repositories and snapshots), transcripts (task metadata and history) and other files, with the totals. When storage.quota in the config (e.g. 20GB) is exceeded, the least recently used tasks to delete to get under it are suggested, and a notice is printed after other commands. With --prune the suggested tasks are deleted, except those in use.")
+	storagePrune = storageCmd.Flag("prune", "Delete the tasks suggested to get under the storage quota").Bool()
+
+	auditCmd    = app.Command("audit", "Show what a task sent to the providers")
+	_           = auditCmd.Help("Show the outbound audit log of a task: the number and total size of the requests sent to the providers, the files whose content was given to the AI with how many times and how many bytes, and the requests blocked by the outbound policy. The policy is configured under outbound in the config: max_request_size and max_task_size (e.g. 500KB and 20MB) refuse the larger requests, and deny_paths are gitignore patterns of files never read, which .golineignore files cannot re-include.")
+	auditTaskID = auditCmd.Arg("taskID", "ID of the task").HintAction(subcmd.CompleteTaskIDs).Required().String()
+
+	toolsCmd  = app.Command("tools", "List the tools the agent can use")
+	_         = toolsCmd.Help("List the tools the agent can use with their parameters, descriptions and whether each parameter is required. Use --json for a machine-readable schema that editor integrations can use to render forms and validate tool calls. Plugin tools, executables in .goline/tools, ~/.goline/tools or the directories of plugins.dirs in the config that describe themselves with --describe, are listed after the built-in tools.")
+	toolsJSON = toolsCmd.Flag("json", "Print the tool schemas as JSON").Bool()
+
+	serveCmd         = app.Command("serve", "Serve the Goline gRPC API")
+	_                = serveCmd.Help("Serve the Goline API over gRPC, gRPC-Web and Connect for external frontends. HTTP/2 is served without TLS, so bind it to a local address.")
+	serveAddr        = serveCmd.Flag("addr", "Address to listen on").Default("127.0.0.1:50051").String()
+	serveMetricsAddr = serveCmd.Flag("metrics-addr", "Address to serve Prometheus metrics on (e.g. 127.0.0.1:9090), disabled if empty").Envar("GOLINE_METRICS_ADDR").String()
+
+	tasksCompareCmd   = tasksCmd.Command("compare", "Compare the changes of two tasks")
+	_                 = tasksCompareCmd.Help("Compare the final checkpoints of two tasks against their common starting point, e.g. to compare the results of two prompts or models for the same job. Files are listed side by side with how each task changed them and whether the results agree.")
+	tasksCompareA     = tasksCompareCmd.Arg("idA", "ID of the first task").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	tasksCompareB     = tasksCompareCmd.Arg("idB", "ID of the second task").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	tasksCompareDiffs = tasksCompareCmd.Flag("diff", "Print a unified diff from the first task's files to the second task's files").Bool()
+
+	traceCmd         = app.Command("trace", "Inspect the provider requests of tasks")
+	traceShowCmd     = traceCmd.Command("show", "Show the provider requests recorded with run --trace-llm")
+	_                = traceShowCmd.Help("List the requests sent to the provider by a task run with --trace-llm, or show one request with its full payload and its raw response, e.g. the SSE stream, to diagnose prompt bugs and provider quirks.")
+	traceShowTaskID  = traceShowCmd.Arg("taskID", "ID of the task").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	traceShowRequest = traceShowCmd.Arg("request", "Number of the request to show, all the requests are listed if omitted").Int()
+
+	exportCmd    = app.Command("export", "Export a task transcript")
+	_            = exportCmd.Help("Render the persisted conversation of a task, with its tool calls, diffs and cost summary, into a shareable document for code reviews or postmortems.")
+	exportTaskID = exportCmd.Arg("taskID", "ID of the task to export").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	exportFormat = exportCmd.Flag("format", "Format of the document").Default("md").Enum("md", "html", "json")
+	exportOutput = exportCmd.Flag("output", "File to write the document to, stdout by default").Short('o').String()
+
+	prCmd          = app.Command("pr", "Manage pull requests")
+	prCreateCmd    = prCmd.Command("create", "Open a pull request with the changes of a task")
+	_              = prCreateCmd.Help("Push the commits of a task to a branch and open a pull request on GitHub, or a merge request on GitLab, described from the task transcript. The files edited by the task must be committed. Configure the access token with goline config forge set, or set GITHUB_TOKEN or GITLAB_TOKEN.")
+	prCreateTaskID = prCreateCmd.Arg("taskID", "ID of the task whose changes are proposed").HintAction(subcmd.CompleteTaskIDs).Required().String()
+	prCreateRemote = prCreateCmd.Flag("remote", "Remote to push the branch to").Default("origin").String()
+	prCreateBase   = prCreateCmd.Flag("base", "Branch to merge the changes into, the default branch of the remote if omitted").String()
+	prCreateBranch = prCreateCmd.Flag("branch", "Branch to push the changes to, goline/<taskID> if omitted").String()
+	prCreateDraft  = prCreateCmd.Flag("draft", "Open the pull request as a draft").Bool()
+
+	selfUpdateCmd     = app.Command("self-update", "Update goline to the latest release")
+	_                 = selfUpdateCmd.Help("Download the latest GitHub release for this platform, verify it against the signed checksums and replace the running binary. Binaries installed with Homebrew or Scoop are left to the package manager. A notice is printed after other commands when a new version is available, disable it with updates.disable_notice in the config or GOLINE_NO_UPDATE_NOTICE.")
+	selfUpdateChannel = selfUpdateCmd.Flag("channel", "Release channel, the configured one (stable by default) if omitted").Enum("stable", "prerelease")
+	selfUpdateCheck   = selfUpdateCmd.Flag("check", "Only report whether a new version is available").Bool()
+
+	completionCmd   = app.Command("completion", "Print a shell completion script")
+	_               = completionCmd.Help("Print the completion script of a shell, covering the subcommands, their flags and the values of the arguments: task IDs from the task store, and the configured provider and profile names. Load it with source <(goline completion bash) in ~/.bashrc or source <(goline completion zsh) in ~/.zshrc, or save it with goline completion fish > ~/.config/fish/completions/goline.fish.")
+	completionShell = completionCmd.Arg("shell", "Shell to complete").Required().HintOptions("bash", "zsh", "fish").Enum("bash", "zsh", "fish")
 
 	attachCmd  = app.Command("attach", "Attach to a terminal")
 	_          = attachCmd.Help("Attach to a terminal that was started by a task. This allows you to interact with the terminal directly.")
@@ -58,32 +174,195 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Select the profile for this run
+	subcmd.UseProfile(*profile)
+
+	// Export traces when configured
+	shutdownTracing = subcmd.StartTracing(version)
+
+	// Look for a new version while interactive commands run
+	printUpdateNotice := func() {}
+	if cmd != "self-update" && cmd != "run" && cmd != "serve" && cmd != "completion" {
+		printUpdateNotice = subcmd.StartUpdateNotice(version)
+	}
+	printStorageNotice := func() {}
+	if cmd != "storage" && cmd != "serve" && cmd != "completion" {
+		printStorageNotice = subcmd.StartStorageNotice()
+	}
+
 	// Execute the appropriate command
 	switch {
 	case cmd == "start":
-		if err := subcmd.Start(); err != nil {
+		opts := startOptions()
+		opts.Prompt = *startPrompt
+		opts.FromIssue = *startIssue
+		opts.Model = *startModel
+		opts.Template = *startTemplate
+		opts.ReadOnly = *startReadOnly
+		if err := subcmd.Start(opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 	case cmd == "resume":
-		if err := subcmd.Resume(*taskID); err != nil {
+		opts := startOptions()
+		opts.IgnoreWorkspace = *resumeIgnoreWorkspace
+		if err := subcmd.Resume(*taskID, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "branch":
+		if err := subcmd.Branch(*branchCheckpoint, *branchTask, *branchYes, startOptions()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "run":
+		opts := subcmd.RunOptions{
+			Prompt:          *runPrompt,
+			Approve:         *runApprove,
+			MaxTurns:        *runMaxTurns,
+			Duration:        *runDuration,
+			SummaryInterval: *runSummary,
+			TraceLLM:        *runTraceLLM,
+			Model:           *runModel,
+			Template:        *runTemplate,
+			ReadOnly:        *runReadOnly,
+		}
+		if err := subcmd.Run(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(subcmd.ExitCode(err))
+		}
+	case cmd == "watch":
+		opts := subcmd.WatchOptions{
+			Prompt:   *watchPrompt,
+			Command:  *watchCommand,
+			Debounce: *watchDebounce,
+		}
+		if err := subcmd.Watch(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "review":
+		opts := subcmd.ReviewOptions{
+			Instructions: *reviewInstructions,
+			Staged:       *reviewStaged,
+			Ref:          *reviewRef,
+			JSON:         *reviewJSON,
+			FailOn:       *reviewFailOn,
+		}
+		if err := subcmd.Review(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "index":
+		if err := subcmd.Index(subcmd.IndexOptions{Watch: *indexWatch, Search: *indexSearch}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "tasks list":
+		if err := subcmd.ListTasks(*tasksListAll); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "tasks verify":
+		if err := subcmd.VerifyTask(*tasksVerifyTaskID, *tasksVerifyRepair); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "search":
+		if err := subcmd.Search(subcmd.SearchOptions{Query: *searchQuery, Limit: *searchLimit}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "storage":
+		if err := subcmd.Storage(subcmd.StorageOptions{Prune: *storagePrune}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "audit":
+		if err := subcmd.Audit(*auditTaskID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "tools":
+		if err := subcmd.Tools(*toolsJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "serve":
+		if err := subcmd.Serve(*serveAddr, *serveMetricsAddr); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
-	case cmd == "tasks":
-		if err := subcmd.ListTasks(); err != nil {
+	case cmd == "tasks compare":
+		if err := subcmd.CompareTasks(*tasksCompareA, *tasksCompareB, *tasksCompareDiffs); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+	case cmd == "trace show":
+		if err := subcmd.ShowTrace(subcmd.TraceOptions{TaskID: *traceShowTaskID, Request: *traceShowRequest}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "export":
+		if err := subcmd.Export(*exportTaskID, *exportFormat, *exportOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "pr create":
+		if err := subcmd.CreatePullRequest(subcmd.PullRequestOptions{
+			TaskID: *prCreateTaskID,
+			Remote: *prCreateRemote,
+			Base:   *prCreateBase,
+			Branch: *prCreateBranch,
+			Draft:  *prCreateDraft,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "self-update":
+		if err := subcmd.SelfUpdate(subcmd.SelfUpdateOptions{
+			Version: version,
+			Channel: *selfUpdateChannel,
+			Check:   *selfUpdateCheck,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	case cmd == "completion":
+		if err := subcmd.Completion(*completionShell); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
 		}
 	case cmd == "attach":
 		if err := subcmd.Attach(*terminalID); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 	case strings.HasPrefix(cmd, "config"):
 		if err := subcmd.HandleConfigCommand(cmd); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 	}
+
+	printUpdateNotice()
+	printStorageNotice()
+	shutdownTracing()
+}
+
+// shutdownTracing flushes the pending traces
+var shutdownTracing = func() {}
+
+// exit flushes the pending traces and exits with the code
+func exit(code int) {
+	shutdownTracing()
+	os.Exit(code)
+}
+
+// startOptions builds the options shared by the REPL commands from the parsed flags
+func startOptions() subcmd.StartOptions {
+	return subcmd.StartOptions{
+		Accessible: *a11y,
+		NoTUI:      *noTUI,
+	}
 }
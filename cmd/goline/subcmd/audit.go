@@ -0,0 +1,95 @@
+package subcmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/audit"
+)
+
+// Audit prints the outbound audit log of a task: the requests sent to the providers, the
+// files whose content was given to the AI and the requests refused by the outbound policy
+func Audit(taskID string) error {
+	entries, err := audit.Load(taskID)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("Task %s sent nothing to the providers.\n", taskID)
+		return nil
+	}
+	printAudit(os.Stdout, entries)
+	return nil
+}
+
+// fileAudit sums the entries of a file
+type fileAudit struct {
+	path  string
+	times int
+	bytes int64
+}
+
+// printAudit prints the totals of the requests, the files by size and the blocked requests
+func printAudit(w io.Writer, entries []audit.Entry) {
+	var requests int
+	var sent int64
+	models := make(map[string]bool)
+	files := make(map[string]*fileAudit)
+	var blocked []audit.Entry
+	for _, entry := range entries {
+		switch entry.Kind {
+		case audit.KindRequest:
+			requests++
+			sent += entry.Bytes
+			models[entry.Provider+"/"+entry.Model] = true
+		case audit.KindFile:
+			f, ok := files[entry.Path]
+			if !ok {
+				f = &fileAudit{path: entry.Path}
+				files[entry.Path] = f
+			}
+			f.times++
+			f.bytes += entry.Bytes
+		case audit.KindBlocked:
+			blocked = append(blocked, entry)
+		}
+	}
+
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "%d request(s), %s sent to %v\n", requests, formatSize(sent), names)
+
+	if len(files) > 0 {
+		sorted := make([]*fileAudit, 0, len(files))
+		for _, f := range files {
+			sorted = append(sorted, f)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].bytes != sorted[j].bytes {
+				return sorted[i].bytes > sorted[j].bytes
+			}
+			return sorted[i].path < sorted[j].path
+		})
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tTIMES\tSENT")
+		for _, f := range sorted {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", f.path, f.times, formatSize(f.bytes))
+		}
+		tw.Flush()
+	}
+
+	if len(blocked) > 0 {
+		fmt.Fprintf(w, "\n%d request(s) blocked by the outbound policy:\n", len(blocked))
+		for _, entry := range blocked {
+			fmt.Fprintf(w, "  %s  %s\n", entry.Time.Local().Format(time.DateTime), entry.Reason)
+		}
+	}
+}
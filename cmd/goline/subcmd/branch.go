@@ -0,0 +1,171 @@
+package subcmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// Branch forks a new task at a checkpoint of a task: the workspace is restored to the
+// checkpoint and the conversation of the new task stops where the checkpoint was saved, while
+// the original task keeps its history and checkpoints. The task of the checkpoint is found from
+// the recorded checkpoints when fromTaskID is empty. The restore is confirmed unless yes is set.
+func Branch(checkpointID, fromTaskID string, yes bool, opts StartOptions) (err error) {
+	if fromTaskID == "" {
+		if fromTaskID, err = findCheckpointTask(checkpointID); err != nil {
+			return err
+		}
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	source, err := taskstore.NewStore(fromTaskID)
+	if err != nil {
+		return err
+	}
+	sourceTask, err := source.LoadTask()
+	if err != nil {
+		return fmt.Errorf("failed to load task %s: %w", fromTaskID, err)
+	}
+	events, _, err := source.LoadEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load the history of task %s: %w", fromTaskID, err)
+	}
+
+	if !yes && !confirm(os.Stdin, os.Stdout, fmt.Sprintf("Branching at checkpoint %s overwrites your current workspace with it. Continue? (y/n): ", checkpointID)) {
+		fmt.Println("Branch cancelled")
+		return nil
+	}
+
+	// The new task starts with the checkpoints of the original task, and is removed if it
+	// cannot be branched
+	taskID, err := taskstore.NewTaskID()
+	if err != nil {
+		return err
+	}
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return err
+	}
+	branched := false
+	defer func() {
+		if !branched {
+			if removeErr := store.Remove(); removeErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove the branched task: %v\n", removeErr)
+			}
+		}
+	}()
+	if err := checkpoint.CopyCheckpoints(fromTaskID, taskID); err != nil {
+		return err
+	}
+
+	lock, err := lockTask(taskID)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	store.SetLock(lock)
+
+	manager, err := checkpoint.NewManager(taskID, workingDir)
+	if err != nil {
+		return err
+	}
+	manager.SetLock(lock)
+	if err := manager.Initialize(); err != nil {
+		return err
+	}
+	info, err := manager.Checkpoint(checkpointID)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s of task %s: %w", checkpointID, fromTaskID, err)
+	}
+	if err := manager.RestoreCheckpoint(info.ID); err != nil {
+		return fmt.Errorf("failed to restore checkpoint %s: %w", info.ID, err)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	task := &pb.Task{
+		Id:                       taskID,
+		State:                    pb.TaskState_TASK_STATE_PAUSED,
+		Provider:                 sourceTask.GetProvider(),
+		Model:                    sourceTask.GetModel(),
+		InitialPrompt:            sourceTask.GetInitialPrompt(),
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		WorkingDirectory:         workingDir,
+		BranchedFromTaskId:       fromTaskID,
+		BranchedFromCheckpointId: info.ID,
+	}
+	detectWorkspace(workingDir).Record(task)
+	if err := store.SaveTask(task); err != nil {
+		return err
+	}
+	for _, event := range taskstore.EventsBefore(events, info.ID, info.Timestamp) {
+		if err := store.AppendEvent(event); err != nil {
+			return fmt.Errorf("failed to copy the history of task %s: %w", fromTaskID, err)
+		}
+	}
+	recorder := taskstore.NewRecorder(store)
+	if err := recorder.RecordCheckpoint(&pb.CheckpointEvent{
+		OperationType: pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_RESTORE,
+		CheckpointId:  info.ID,
+		Name:          info.Name,
+		Description:   fmt.Sprintf("Branched from task %s", fromTaskID),
+	}); err != nil {
+		return err
+	}
+	branched = true
+
+	fmt.Printf("Branched task %s from task %s at checkpoint %s (%s)\n", taskID, fromTaskID, shortCheckpointID(info.ID), info.Name)
+	return startREPL(taskID, opts, lock)
+}
+
+// findCheckpointTask finds the task whose history records the saving of a checkpoint, given by
+// its full or abbreviated ID, looking at the latest tasks first
+func findCheckpointTask(checkpointID string) (string, error) {
+	dir, err := tasksDir()
+	if err != nil {
+		return "", err
+	}
+	ids, err := taskstore.ListTaskIDs(dir)
+	if err != nil {
+		return "", err
+	}
+	slices.Reverse(ids)
+	for _, id := range ids {
+		history, _, err := taskstore.NewStoreInDir(dir, id).LoadHistory()
+		if err != nil {
+			continue
+		}
+		for _, saved := range history.GetCheckpointIds() {
+			if strings.HasPrefix(saved, checkpointID) {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no task records checkpoint %s, give the task of the checkpoint with --task", checkpointID)
+}
+
+// confirm asks a yes or no question, no answer meaning no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprint(out, question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+// shortCheckpointID abbreviates a checkpoint ID for display
+func shortCheckpointID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
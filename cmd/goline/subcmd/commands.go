@@ -1,35 +1,323 @@
 package subcmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/bootstrap"
+	"github.com/kazz187/goline/internal/core/mentions"
+	"github.com/kazz187/goline/internal/core/slashcommands"
+	"github.com/kazz187/goline/internal/core/stdin"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/metrics"
+	"github.com/kazz187/goline/internal/notify"
 	"github.com/kazz187/goline/internal/tui"
 )
 
-// Start starts a new Goline task
-func Start() error {
+// StartOptions holds the options for commands that open the REPL
+type StartOptions struct {
+	// Accessible forces the linear, plain-text accessible REPL
+	Accessible bool
+	// NoTUI forces the line-based REPL, used anyway when the TUI cannot be drawn
+	NoTUI bool
+	// Prompt is the first message of a new task
+	Prompt string
+	// FromIssue is the URL or owner/repo#123 reference of an issue the new task works on
+	FromIssue string
+	// Model is the model of a new task, of another provider if prefixed with it, the
+	// configured one if empty
+	Model string
+	// Template is the task template of a new task, bundling its first message, model and context
+	Template string
+	// IgnoreWorkspace resumes a task in another workspace than the one it belongs to
+	IgnoreWorkspace bool
+	// ReadOnly restricts the agents of the tasks to reading the workspace, see RunOptions.ReadOnly
+	ReadOnly bool
+}
+
+// Start starts a new Goline task.
+// The first message is built from the task template if any, and the issue to work on and content
+// piped to stdin are attached to it as context.
+func Start(opts StartOptions) error {
+	if opts.Template != "" {
+		template, err := loadTemplate(opts.Template)
+		if err != nil {
+			return err
+		}
+		// The REPL does not run the agent, the files of the mentions are only kept from the
+		// providers by the outbound policy until its tasks have an audit log
+		manager, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if opts.Prompt, err = templateMessage(template, opts.Prompt, mentions.Options{DeniedPaths: manager.GetOutbound().DenyPaths}); err != nil {
+			return err
+		}
+		if opts.Model == "" {
+			opts.Model = template.Model
+		}
+		if len(template.Tools) > 0 || template.AutoApprove != (config.AutoApprove{}) {
+			slog.Warn("The tools and auto-approvals of a task template only apply to goline run --template", "template", template.Name)
+		}
+	}
+	if opts.FromIssue != "" {
+		prompt, err := issuePrompt(context.Background(), opts.FromIssue, opts.Prompt)
+		if err != nil {
+			return err
+		}
+		opts.Prompt = prompt
+	}
+
+	piped, err := readPiped(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if piped != nil {
+		opts.Prompt = stdin.Attach(opts.Prompt, piped)
+	}
+
+	taskID, err := taskstore.NewTaskID()
+	if err != nil {
+		return fmt.Errorf("failed to generate task ID: %w", err)
+	}
 	fmt.Println("Starting a new Goline task...")
 
-	// Start the TUI with the REPL
-	return tui.StartREPLWithTUI()
+	// Lock the new task like resumed ones, so that another process cannot open it meanwhile
+	lock, err := lockTask(taskID)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// Start the REPL
+	return startREPL(taskID, opts, lock)
 }
 
 // Resume resumes a paused task
-func Resume(taskID string) error {
+func Resume(taskID string, opts StartOptions) error {
 	fmt.Printf("Resuming task %s...\n", taskID)
 
 	// TODO: Load task data from storage
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	// The edits and checkpoints of the task belong to its own workspace
+	if err := checkWorkspace(taskID, workingDir, opts.IgnoreWorkspace); err != nil {
+		return err
+	}
+
+	// Lock the task, or open it read-only if another process holds it
+	lock, err := lockTask(taskID)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// Recover edits that were interrupted while being applied
+	if err := recoverApply(taskID, workingDir, lock, os.Stdin, os.Stdout); err != nil {
+		return fmt.Errorf("failed to recover interrupted apply: %w", err)
+	}
 
-	// Start the TUI with the REPL
-	return tui.StartREPLWithTUI()
+	// Start the REPL
+	return startREPL(taskID, opts, lock)
 }
 
-// ListTasks lists all tasks
-func ListTasks() error {
-	fmt.Println("Listing all tasks...")
-	// TODO: Implement task listing logic
-	return errors.New("not implemented yet")
+// lockTask locks the task directory.
+// When another live process holds the task, possibly on another host sharing the task
+// directory, the task is opened read-only instead of risking corruption.
+func lockTask(taskID string) (*tasklock.Lock, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	taskDir := filepath.Join(homeDir, ".goline", "tasks", taskID)
+
+	lock, err := tasklock.Acquire(taskDir)
+	if err != nil {
+		var held *tasklock.HeldError
+		if !errors.As(err, &held) {
+			return nil, fmt.Errorf("failed to lock task: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v, opening it read-only\n", err)
+		return tasklock.ReadOnly(taskDir, held.Holder), nil
+	}
+	return lock, nil
+}
+
+// startREPL starts either the grid TUI or the accessible REPL on a task, whose checkpoints and
+// edits are written under its lock
+func startREPL(taskID string, opts StartOptions, lock *tasklock.Lock) error {
+	metrics.TaskStarted()
+	defer metrics.TaskFinished()
+
+	replOpts := tui.REPLOptions{TaskID: taskID, InitialMessage: opts.Prompt, Lock: lock}
+	manager, err := loadConfig()
+	if err != nil {
+		slog.Warn("Failed to load configuration", "error", err)
+	} else {
+		if opts.Model != "" {
+			if err := useModel(manager, opts.Model); err != nil {
+				return err
+			}
+		}
+		// Only new tasks have a first message, the workspace context is added to it
+		if opts.Prompt != "" {
+			if workingDir, err := os.Getwd(); err == nil {
+				replOpts.InitialMessage = bootstrap.Attach(opts.Prompt, workspaceContext(context.Background(), manager, workingDir))
+			}
+		}
+		replOpts.Provider = manager.GetEffectiveProvider()
+		replOpts.Model = manager.GetEffectiveModelName()
+		replOpts.ResolveModel = func(current tui.ModelChoice, spec string) (tui.ModelChoice, error) {
+			return resolveModelChoice(manager, current.Provider, spec)
+		}
+		replOpts.ResponseLanguage = manager.GetResponseLanguage()
+		replOpts.Committer = newCommitter(manager)
+		replOpts.Reviewer = newReviewer(manager, taskID)
+		appearance := manager.GetTUI()
+		replOpts.Theme = appearance.Theme
+		replOpts.ThemeFile = appearance.ThemeFile
+		replOpts.Layout = tui.Layout{
+			HistoryHeight: appearance.Layout.HistoryHeight,
+			TasksWidth:    appearance.Layout.TasksWidth,
+			FileTreeWidth: appearance.Layout.FileTreeWidth,
+		}
+		replOpts.SlashCommands = slashCommands(manager)
+		replOpts.Notifier = notify.New(manager.GetNotifications())
+
+		readOnly, err := readOnlyPolicy(manager, opts.ReadOnly)
+		if err != nil {
+			return err
+		}
+		runner, err := newREPLRunner(manager, taskID, lock, readOnly)
+		if err != nil {
+			return err
+		}
+		replOpts.ReadOnly = readOnly != nil
+		defer runner.Close()
+		replOpts.Runner = runner.Run
+		replOpts.Retrier = runner.Retry
+	}
+
+	if opts.Accessible || (manager != nil && manager.IsAccessibilityEnabled()) {
+		in, err := commandInput()
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		return tui.StartAccessibleREPL(in, replOpts)
+	}
+
+	if opts.NoTUI || !tui.CanDrawTUI(os.Stdout) {
+		return startPlainREPL(replOpts)
+	}
+
+	// Start the TUI with the REPL, it reads the keyboard from the terminal even when stdin is piped
+	err = tui.StartREPLWithTUI(replOpts)
+	if errors.Is(err, tui.ErrNoTerminal) {
+		slog.Warn("Falling back to the line-based REPL", "error", err)
+		return startPlainREPL(replOpts)
+	}
+	return err
+}
+
+// slashCommands returns the slash commands defined in the configuration, sorted by name
+func slashCommands(manager *config.Manager) []slashcommands.Command {
+	configured := manager.GetSlashCommands()
+	commands := make([]slashcommands.Command, 0, len(configured))
+	for name, command := range configured {
+		if err := slashcommands.ValidateName(name); err != nil {
+			slog.Warn("Skipping slash command of the configuration", "error", err)
+			continue
+		}
+		commands = append(commands, slashcommands.Command{Name: name, Description: command.Description, Template: command.Prompt})
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// startPlainREPL starts the line-based REPL, for terminals the TUI cannot be drawn on. Without
+// a terminal to read commands from, e.g. in CI with piped stdin, it only runs the first message.
+func startPlainREPL(replOpts tui.REPLOptions) error {
+	in, err := commandInput()
+	if err != nil {
+		if replOpts.InitialMessage == "" {
+			return err
+		}
+		slog.Warn("Running the first message only", "error", err)
+		in = io.NopCloser(strings.NewReader(""))
+	}
+	defer in.Close()
+	return tui.StartPlainREPL(in, replOpts)
+}
+
+// commandInput returns the input of the line-based REPLs: stdin, or the terminal when stdin
+// was piped and has been consumed as context
+func commandInput() (io.ReadCloser, error) {
+	if !stdin.Piped(os.Stdin) {
+		return io.NopCloser(os.Stdin), nil
+	}
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	tty, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the terminal to read commands, stdin was piped: %w", err)
+	}
+	return tty, nil
+}
+
+// VerifyTask checks the stored data of a task for corruption and optionally repairs it
+func VerifyTask(taskID string, repair bool) error {
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return err
+	}
+
+	if !repair {
+		report, err := store.Verify()
+		if err != nil {
+			return err
+		}
+		if report.Files == 0 {
+			return fmt.Errorf("no stored data found for task %s", taskID)
+		}
+		fmt.Print(report)
+		if !report.OK() {
+			return errors.New("task data is damaged, run with --repair to recover the readable history")
+		}
+		return nil
+	}
+
+	// Repairing writes to the task, so it must not be in use
+	lock, err := lockTask(taskID)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	store.SetLock(lock)
+
+	report, err := store.Repair()
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	if !report.OK() {
+		fmt.Println("Damaged history segments were rewritten, the originals are kept with a .corrupt suffix")
+	}
+	return nil
 }
 
 // Attach attaches to a terminal
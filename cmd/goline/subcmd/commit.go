@@ -0,0 +1,129 @@
+package subcmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/gitcommit"
+	"github.com/kazz187/goline/internal/core/regions"
+	"github.com/kazz187/goline/internal/core/stdin"
+)
+
+// newCommitter creates the committer of the REPL's commit command, nil if no provider can
+// write the commit messages
+func newCommitter(manager *config.Manager) *gitcommit.Committer {
+	p, err := newProvider(manager)
+	if err != nil {
+		slog.Warn("Commits are not available", "error", err)
+		return nil
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		slog.Warn("Commits are not available", "error", err)
+		return nil
+	}
+	return gitcommit.NewCommitter(p, workingDir)
+}
+
+// commitTask stages the files edited by a task and commits them with a message written by the
+// AI once the user approves it. The files are left staged when nobody can approve the message.
+func commitTask(ctx context.Context, committer *gitcommit.Committer, taskID string, in *os.File, out io.Writer) error {
+	paths, err := gitcommit.TaskPaths(taskID)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(out, "No files were edited by the task, nothing to commit")
+		return nil
+	}
+	if err := committer.Stage(paths); err != nil {
+		return err
+	}
+
+	message, _, err := committer.GenerateMessage(ctx)
+	if errors.Is(err, gitcommit.ErrNothingToCommit) {
+		fmt.Fprintln(out, "The files edited by the task have no changes to commit")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if stdin.Piped(in) {
+		fmt.Fprintf(out, "\nThe changes of the task are staged, commit them with this message:\n\n%s\n", message)
+		return nil
+	}
+	return approveCommit(committer, message.String(), in, out)
+}
+
+// approveCommit shows the commit message and commits the staged changes with it, after the
+// user edited it if they wanted to
+func approveCommit(committer *gitcommit.Committer, message string, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "\nCommit message:\n\n%s\n\nCommit the changes of the task with this message (y), edit it (e), or leave them staged (n)? [y/e/n] ", message)
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Fprintln(out)
+			return nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y":
+			hash, err := committer.Commit(message)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Committed %s\n", hash)
+			return nil
+		case "e":
+			edited, err := editMessage(message)
+			if err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+				continue
+			}
+			message = edited
+		case "n":
+			fmt.Fprintln(out, "The changes of the task are left staged")
+			return nil
+		}
+	}
+}
+
+// editMessage opens the commit message in the user's editor and returns it as saved
+func editMessage(message string) (string, error) {
+	dir, err := os.MkdirTemp("", "goline-commit-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(path, []byte(message+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write the commit message: %w", err)
+	}
+	cmd := regions.EditorCommand(path, 1)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to open editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the commit message: %w", err)
+	}
+	if strings.TrimSpace(string(edited)) == "" {
+		return "", errors.New("the commit message is empty")
+	}
+	return strings.TrimSpace(string(edited)), nil
+}
@@ -0,0 +1,105 @@
+package subcmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+)
+
+// CompareTasks compares the final checkpoints of two tasks against a common base.
+// With showDiff, the differences between the final files of both tasks are printed as a unified diff.
+func CompareTasks(taskA, taskB string, showDiff bool) error {
+	managerA, err := openCheckpoints(taskA)
+	if err != nil {
+		return err
+	}
+	managerB, err := openCheckpoints(taskB)
+	if err != nil {
+		return err
+	}
+
+	comparison, err := checkpoint.Compare(managerA, managerB)
+	if err != nil {
+		return err
+	}
+	fmt.Print(comparison.Format(taskA, taskB))
+
+	if showDiff {
+		diffs := comparison.Differences()
+		if len(diffs) == 0 {
+			return nil
+		}
+		patch, err := checkpoint.FormatPatch(diffs)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n--- a/ is %s, b/ is %s\n%s", taskA, taskB, patch)
+	}
+	return nil
+}
+
+// openCheckpoints opens the checkpoints of a task read-only, so comparing never modifies a task
+func openCheckpoints(taskID string) (*checkpoint.Manager, error) {
+	workingDir, err := taskWorkspace(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	manager, err := checkpoint.NewManager(taskID, workingDir)
+	if err != nil {
+		return nil, err
+	}
+	manager.SetLock(tasklock.ReadOnly(filepath.Join(homeDir, ".goline", "tasks", taskID), tasklock.Info{}))
+	if err := manager.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to open checkpoints of task %s: %w", taskID, err)
+	}
+	return manager, nil
+}
+
+// taskWorkspace returns the working directory of a task.
+// It is read from the task metadata, or else from the workspaces the task has checkpoints for,
+// preferring the current directory.
+func taskWorkspace(taskID string) (string, error) {
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return "", err
+	}
+	if task, err := store.LoadTask(); err == nil && task.WorkingDirectory != "" {
+		return task.WorkingDirectory, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	manager, err := checkpoint.NewManager(taskID, cwd)
+	if err != nil {
+		return "", err
+	}
+	workspaces, err := manager.Workspaces()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(workspaces) == 0:
+		return "", fmt.Errorf("task %s has no checkpoints", taskID)
+	case slices.Contains(workspaces, cwd):
+		return cwd, nil
+	case len(workspaces) == 1:
+		return workspaces[0], nil
+	default:
+		return "", fmt.Errorf("task %s has checkpoints for several workspaces, run the command in one of them: %s", taskID, strings.Join(workspaces, ", "))
+	}
+}
@@ -0,0 +1,94 @@
+package subcmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// Completion scripts of the shells. They ask goline for the candidates with the hidden
+// --completion-bash flag of kingpin, which lists the subcommands, the flags, the values of
+// enum flags and the dynamic values of the arguments with a hint action, such as task IDs.
+const (
+	bashCompletion = `# goline completion for bash, add to ~/.bashrc:
+#   source <(goline completion bash)
+_goline_completion() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local candidates
+    candidates=$("${COMP_WORDS[0]}" --completion-bash "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null)
+    COMPREPLY=($(compgen -W "${candidates}" -- "${cur}"))
+}
+complete -F _goline_completion -o default goline
+`
+
+	zshCompletion = `#compdef goline
+# goline completion for zsh, add to ~/.zshrc:
+#   source <(goline completion zsh)
+_goline() {
+    local -a candidates
+    candidates=(${(f)"$(${words[1]} --completion-bash "${(@)words[2,$CURRENT]}" 2>/dev/null)"})
+    compadd -a candidates
+    if [[ $compstate[nmatches] -eq 0 && $words[$CURRENT] != -* ]]; then
+        _files
+    fi
+}
+compdef _goline goline
+`
+
+	fishCompletion = `# goline completion for fish, save to ~/.config/fish/completions/goline.fish:
+#   goline completion fish > ~/.config/fish/completions/goline.fish
+function __goline_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    $tokens[1] --completion-bash $tokens[2..-1] 2>/dev/null
+end
+complete -c goline -f -a '(__goline_complete)'
+`
+)
+
+// Completion prints the completion script of a shell: bash, zsh or fish
+func Completion(shell string) error {
+	scripts := map[string]string{
+		"bash": bashCompletion,
+		"zsh":  zshCompletion,
+		"fish": fishCompletion,
+	}
+	script, ok := scripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// CompleteTaskIDs lists the IDs of the stored tasks, to complete the task arguments
+func CompleteTaskIDs() []string {
+	dir, err := tasksDir()
+	if err != nil {
+		return nil
+	}
+	ids, _ := taskstore.ListTaskIDs(dir)
+	return ids
+}
+
+// CompleteProviders lists the configured providers and the built-in ones, to complete the
+// provider arguments
+func CompleteProviders() []string {
+	names := provider.Names()
+	if manager, err := loadConfig(); err == nil {
+		names = append(names, slices.Collect(maps.Keys(manager.GetGlobalConfig().Providers))...)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// CompleteProfiles lists the configured profiles, to complete the profile arguments
+func CompleteProfiles() []string {
+	manager, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(manager.GetGlobalConfig().Profiles))
+}
@@ -1,22 +1,42 @@
 package subcmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/credentials"
+	"github.com/kazz187/goline/internal/forge"
+	"github.com/kazz187/goline/internal/provider"
 )
 
 // Command variables for config commands
 var (
 	// Provider command variables
-	providerGetName     *string
-	providerSetName     *string
-	providerSetAPIKey   *string
-	providerSetEndpoint *string
-	providerSetModel    *string
-	providerRemoveName  *string
+	providerGetName           *string
+	providerSetName           *string
+	providerSetAPIKey         *string
+	providerSetKeyStore       *string
+	providerSetEndpoint       *string
+	providerSetModel          *string
+	providerSetTimeouts       config.Timeouts
+	providerSetRateLimit      config.RateLimit
+	providerSetStream         *string
+	providerSetThinking       *string
+	providerSetThinkingBudget *int
+	providerSetType           *string
+	providerSetModelSpec      config.ModelSpec
+	providerSetCapabilities   *string
+	providerSetTemperature    *float64
+	providerSetTemperatureSet bool
+	providerSetTopP           *float64
+	providerSetTopPSet        bool
+	providerSetMaxOutput      *int
+	providerRemoveName        *string
 
 	// Default provider command variables
 	defaultProviderSetName *string
@@ -26,8 +46,67 @@ var (
 
 	// Repository model command variables
 	repoModelSetName *string
+
+	// Accessibility command variables
+	accessibilitySetValue *string
+
+	// Response language command variables
+	responseLanguageSetValue *string
+	responseLanguageSetRepo  *bool
+
+	// Profile command variables
+	profileGetName           *string
+	profileCreateName        *string
+	profileCreateProvider    *string
+	profileCreateModel       *string
+	profileCreateBudget      *float64
+	profileCreateBudgetSet   bool
+	profileCreateAutoApprove *[]string
+	profileSwitchName        *string
+	profileSwitchNone        *bool
+	profileRemoveName        *string
+
+	// Forge command variables
+	forgeSetHost       *string
+	forgeSetType       *string
+	forgeSetAPIURL     *string
+	forgeSetToken      *string
+	forgeSetTokenStore *string
+	forgeRemoveHost    *string
+)
+
+// Actions that can be auto-approved by a profile
+const (
+	autoApproveRead    = "read"
+	autoApproveEdit    = "edit"
+	autoApproveExecute = "execute"
 )
 
+// selectedProfile is the profile selected with the --profile flag
+var selectedProfile string
+
+// UseProfile selects the profile used by commands for this run
+func UseProfile(name string) {
+	selectedProfile = name
+}
+
+// loadConfig creates a config manager, loads the configuration and applies the selected profile
+func loadConfig() (*config.Manager, error) {
+	manager, err := config.NewManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config manager: %w", err)
+	}
+	if err := manager.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if selectedProfile != "" {
+		if err := manager.UseProfile(selectedProfile); err != nil {
+			return nil, err
+		}
+	}
+	return manager, nil
+}
+
 // RegisterConfigCommands registers the config commands with the application
 func RegisterConfigCommands(app *kingpin.Application) {
 	// Config command
@@ -40,30 +119,50 @@ func RegisterConfigCommands(app *kingpin.Application) {
 	_ = providerCmd.Command("list", "List all configured providers")
 
 	providerGetCmd := providerCmd.Command("get", "Get a provider configuration")
-	providerGetName = providerGetCmd.Arg("name", "Provider name").Required().String()
+	providerGetName = providerGetCmd.Arg("name", "Provider name").HintAction(CompleteProviders).Required().String()
 
 	providerSetCmd := providerCmd.Command("set", "Set a provider configuration")
-	providerSetName = providerSetCmd.Arg("name", "Provider name").Required().String()
+	providerSetName = providerSetCmd.Arg("name", "Provider name").HintAction(CompleteProviders).Required().String()
 	providerSetAPIKey = providerSetCmd.Flag("api-key", "API key for the provider").String()
+	providerSetKeyStore = providerSetCmd.Flag("api-key-store", "Where to store the API key: auto (OS keychain, falling back to an encrypted file), keychain, file, or plaintext (in the config file)").Default(credentials.BackendAuto).Enum(credentials.BackendAuto, credentials.BackendKeychain, credentials.BackendFile, config.PlaintextAPIKeyStore)
 	providerSetEndpoint = providerSetCmd.Flag("endpoint", "API endpoint for the provider").String()
 	providerSetModel = providerSetCmd.Flag("model", "Default model name for the provider").String()
+	providerSetCmd.Flag("connect-timeout", "Maximum time to establish a connection (e.g. 30s)").DurationVar(&providerSetTimeouts.Connect)
+	providerSetCmd.Flag("read-timeout", "Maximum time to wait for the first byte and between streamed chunks (e.g. 5m)").DurationVar(&providerSetTimeouts.Read)
+	providerSetCmd.Flag("total-timeout", "Maximum duration of a whole request, a streamed response being only bounded by the read timeout once it started (e.g. 30m)").DurationVar(&providerSetTimeouts.Total)
+	providerSetCmd.Flag("idle-timeout", "Maximum time an idle connection is kept open for the next requests (e.g. 90s)").DurationVar(&providerSetTimeouts.Idle)
+	providerSetCmd.Flag("keep-alive", "Interval of the TCP keep-alive probes of the connections (e.g. 30s)").DurationVar(&providerSetTimeouts.KeepAlive)
+	providerSetCmd.Flag("requests-per-minute", "Maximum number of requests sent to the provider in any minute by the tasks of a goline process").IntVar(&providerSetRateLimit.RequestsPerMinute)
+	providerSetCmd.Flag("tokens-per-minute", "Maximum number of tokens used in any minute by the tasks of a goline process").IntVar(&providerSetRateLimit.TokensPerMinute)
+	providerSetCmd.Flag("max-concurrent", "Maximum number of requests streaming at the same time").IntVar(&providerSetRateLimit.MaxConcurrent)
+	providerSetStream = providerSetCmd.Flag("stream-format", "Wire format of streamed responses for OpenAI-compatible gateways: sse, jsonl or ndjson").Enum(provider.StreamFormats()...)
+	providerSetThinking = providerSetCmd.Flag("thinking", "Extended thinking of the models that support it: on or off").Enum("on", "off")
+	providerSetThinkingBudget = providerSetCmd.Flag("thinking-budget", "Maximum number of tokens the model thinks with, at least 1024").Int()
+	providerSetType = providerSetCmd.Flag("type", "Implementation of the provider when its name is not one, e.g. openai-compatible for LM Studio, vLLM, Together or Groq").String()
+	providerSetCmd.Flag("context-window", "Number of tokens the model can process, for providers whose models are not built in").IntVar(&providerSetModelSpec.ContextWindow)
+	providerSetCmd.Flag("input-cost-per-1k", "Price of 1000 input tokens, for providers whose models are not built in").Float64Var(&providerSetModelSpec.InputCostPer1K)
+	providerSetCmd.Flag("output-cost-per-1k", "Price of 1000 output tokens, for providers whose models are not built in").Float64Var(&providerSetModelSpec.OutputCostPer1K)
+	providerSetCapabilities = providerSetCmd.Flag("capabilities", "Comma-separated features of the model, for providers whose models are not built in: tools, vision, reasoning, or none").String()
+	providerSetTemperature = providerSetCmd.Flag("temperature", "Randomness of the responses, from 0 for deterministic ones to 2").IsSetByUser(&providerSetTemperatureSet).Float64()
+	providerSetTopP = providerSetCmd.Flag("top-p", "Probability mass of the tokens the responses are sampled from, from 0 to 1").IsSetByUser(&providerSetTopPSet).Float64()
+	providerSetMaxOutput = providerSetCmd.Flag("max-output-tokens", "Maximum number of tokens of a response, below the output limit of the model").Int()
 
 	providerRemoveCmd := providerCmd.Command("remove", "Remove a provider configuration")
-	providerRemoveName = providerRemoveCmd.Arg("name", "Provider name").Required().String()
+	providerRemoveName = providerRemoveCmd.Arg("name", "Provider name").HintAction(CompleteProviders).Required().String()
 
 	// Default provider subcommands
 	defaultProviderCmd := configCmd.Command("default-provider", "Manage default provider")
 	_ = defaultProviderCmd.Command("get", "Get the default provider")
 
 	defaultProviderSetCmd := defaultProviderCmd.Command("set", "Set the default provider")
-	defaultProviderSetName = defaultProviderSetCmd.Arg("name", "Provider name").Required().String()
+	defaultProviderSetName = defaultProviderSetCmd.Arg("name", "Provider name").HintAction(CompleteProviders).Required().String()
 
 	// Repository provider subcommands
 	repoProviderCmd := configCmd.Command("repo-provider", "Manage repository provider")
 	_ = repoProviderCmd.Command("get", "Get the repository provider")
 
 	repoProviderSetCmd := repoProviderCmd.Command("set", "Set the repository provider")
-	repoProviderSetName = repoProviderSetCmd.Arg("name", "Provider name").Required().String()
+	repoProviderSetName = repoProviderSetCmd.Arg("name", "Provider name").HintAction(CompleteProviders).Required().String()
 
 	// Repository model subcommands
 	repoModelCmd := configCmd.Command("repo-model", "Manage repository model")
@@ -71,6 +170,60 @@ func RegisterConfigCommands(app *kingpin.Application) {
 
 	repoModelSetCmd := repoModelCmd.Command("set", "Set the repository model")
 	repoModelSetName = repoModelSetCmd.Arg("name", "Model name").Required().String()
+
+	// Accessibility subcommands
+	accessibilityCmd := configCmd.Command("accessibility", "Manage accessibility mode")
+	_ = accessibilityCmd.Command("get", "Get whether accessibility mode is enabled")
+
+	accessibilitySetCmd := accessibilityCmd.Command("set", "Enable or disable accessibility mode")
+	accessibilitySetValue = accessibilitySetCmd.Arg("value", "on or off").Required().Enum("on", "off")
+
+	// Response language subcommands
+	responseLanguageCmd := configCmd.Command("response-language", "Manage the language the AI writes its explanations in")
+	_ = responseLanguageCmd.Command("get", "Get the response language")
+
+	responseLanguageSetCmd := responseLanguageCmd.Command("set", "Set the response language")
+	responseLanguageSetValue = responseLanguageSetCmd.Arg("language", "Language code or name, e.g. ja, en or Japanese, or default to answer in the language of the user").Required().String()
+	responseLanguageSetRepo = responseLanguageSetCmd.Flag("repo", "Set it for this repository instead of globally").Bool()
+
+	// Profile subcommands
+	profileCmd := configCmd.Command("profile", "Manage profiles")
+	profileCmd.Help("Manage named profiles bundling a provider, model, budget and auto-approve settings. Select a profile for one run with goline --profile <name>, or switch the active profile.")
+
+	_ = profileCmd.Command("list", "List all profiles")
+
+	profileGetCmd := profileCmd.Command("get", "Get a profile")
+	profileGetName = profileGetCmd.Arg("name", "Profile name").HintAction(CompleteProfiles).Required().String()
+
+	profileCreateCmd := profileCmd.Command("create", "Create or update a profile")
+	profileCreateName = profileCreateCmd.Arg("name", "Profile name").Required().String()
+	profileCreateProvider = profileCreateCmd.Flag("provider", "Provider to use").HintAction(CompleteProviders).String()
+	profileCreateModel = profileCreateCmd.Flag("model", "Model to use").String()
+	profileCreateBudget = profileCreateCmd.Flag("budget", "Maximum cost of a task in USD, 0 for no limit").IsSetByUser(&profileCreateBudgetSet).Float64()
+	profileCreateAutoApprove = profileCreateCmd.Flag("auto-approve", "Action to run without asking: read, edit or execute (repeatable)").Enums(autoApproveRead, autoApproveEdit, autoApproveExecute)
+
+	profileSwitchCmd := profileCmd.Command("switch", "Switch the active profile")
+	profileSwitchName = profileSwitchCmd.Arg("name", "Profile name").HintAction(CompleteProfiles).String()
+	profileSwitchNone = profileSwitchCmd.Flag("none", "Deactivate profiles").Bool()
+
+	profileRemoveCmd := profileCmd.Command("remove", "Remove a profile")
+	profileRemoveName = profileRemoveCmd.Arg("name", "Profile name").HintAction(CompleteProfiles).Required().String()
+
+	// Forge subcommands
+	forgeCmd := configCmd.Command("forge", "Manage the code hosts pull requests are opened on")
+	forgeCmd.Help("Manage the GitHub and GitLab hosts goline pr create opens pull requests on, and their access tokens. Without a configured token, the GITHUB_TOKEN or GITLAB_TOKEN environment variable is used.")
+
+	_ = forgeCmd.Command("list", "List all configured forges")
+
+	forgeSetCmd := forgeCmd.Command("set", "Set the configuration of a forge")
+	forgeSetHost = forgeSetCmd.Arg("host", "Host name of the forge, e.g. github.com").Required().String()
+	forgeSetType = forgeSetCmd.Flag("type", "API of the forge, guessed from the host name if omitted").Enum(forge.Types()...)
+	forgeSetAPIURL = forgeSetCmd.Flag("api-url", "API endpoint, e.g. https://github.example.com/api/v3, derived from the host if omitted").String()
+	forgeSetToken = forgeSetCmd.Flag("token", "Access token allowed to push branches and open pull requests").String()
+	forgeSetTokenStore = forgeSetCmd.Flag("token-store", "Where to store the token: auto (OS keychain, falling back to an encrypted file), keychain, file, or plaintext (in the config file)").Default(credentials.BackendAuto).Enum(credentials.BackendAuto, credentials.BackendKeychain, credentials.BackendFile, config.PlaintextAPIKeyStore)
+
+	forgeRemoveCmd := forgeCmd.Command("remove", "Remove the configuration of a forge")
+	forgeRemoveHost = forgeRemoveCmd.Arg("host", "Host name of the forge").Required().String()
 }
 
 // HandleConfigCommand handles the config command
@@ -81,7 +234,8 @@ func HandleConfigCommand(cmd string) error {
 		return fmt.Errorf("failed to create config manager: %w", err)
 	}
 
-	// Load existing configuration
+	// Load existing configuration.
+	// The selected profile is not applied, so a profile that no longer exists can be fixed.
 	if err := manager.Load(); err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
@@ -93,7 +247,7 @@ func HandleConfigCommand(cmd string) error {
 	case "config provider get":
 		return handleProviderGet(manager, *providerGetName)
 	case "config provider set":
-		return handleProviderSet(manager, *providerSetName, *providerSetAPIKey, *providerSetEndpoint, *providerSetModel)
+		return handleProviderSet(manager, *providerSetName, *providerSetAPIKey, *providerSetKeyStore, *providerSetEndpoint, *providerSetModel, providerSetTimeouts, providerSetRateLimit, *providerSetStream, *providerSetThinking, *providerSetThinkingBudget, *providerSetType, providerSetModelSpec, *providerSetCapabilities, providerSetGeneration())
 	case "config provider remove":
 		return handleProviderRemove(manager, *providerRemoveName)
 	case "config default-provider get":
@@ -108,6 +262,30 @@ func HandleConfigCommand(cmd string) error {
 		return handleRepoModelGet(manager)
 	case "config repo-model set":
 		return handleRepoModelSet(manager, *repoModelSetName)
+	case "config accessibility get":
+		return handleAccessibilityGet(manager)
+	case "config accessibility set":
+		return handleAccessibilitySet(manager, *accessibilitySetValue == "on")
+	case "config response-language get":
+		return handleResponseLanguageGet(manager)
+	case "config response-language set":
+		return handleResponseLanguageSet(manager, *responseLanguageSetValue, *responseLanguageSetRepo)
+	case "config profile list":
+		return handleProfileList(manager)
+	case "config profile get":
+		return handleProfileGet(manager, *profileGetName)
+	case "config profile create":
+		return handleProfileCreate(manager, *profileCreateName, *profileCreateProvider, *profileCreateModel, budgetFlag(), *profileCreateAutoApprove)
+	case "config profile switch":
+		return handleProfileSwitch(manager, *profileSwitchName, *profileSwitchNone)
+	case "config profile remove":
+		return handleProfileRemove(manager, *profileRemoveName)
+	case "config forge list":
+		return handleForgeList(manager)
+	case "config forge set":
+		return handleForgeSet(manager, *forgeSetHost, *forgeSetType, *forgeSetAPIURL, *forgeSetToken, *forgeSetTokenStore)
+	case "config forge remove":
+		return handleForgeRemove(manager, *forgeRemoveHost)
 	default:
 		return fmt.Errorf("unknown config command: %s", cmd)
 	}
@@ -124,13 +302,24 @@ func handleProviderList(manager *config.Manager) error {
 	fmt.Println("Configured providers:")
 	for name, provider := range globalConfig.Providers {
 		fmt.Printf("  %s:\n", name)
-		fmt.Printf("    API Key: %s\n", maskAPIKey(provider.APIKey))
+		fmt.Printf("    API Key: %s\n", describeAPIKey(provider))
 		if provider.Endpoint != "" {
 			fmt.Printf("    Endpoint: %s\n", provider.Endpoint)
 		}
+		if provider.Type != "" {
+			fmt.Printf("    Type: %s\n", provider.Type)
+		}
 		if provider.ModelName != "" {
 			fmt.Printf("    Model: %s\n", provider.ModelName)
 		}
+		printModelSpec("    ", provider.Model)
+		printTimeouts("    ", provider.Timeouts)
+		printRateLimit("    ", provider.RateLimit)
+		printThinking("    ", provider.Thinking)
+		printGeneration("    ", provider.Generation)
+		if provider.StreamFormat != "" {
+			fmt.Printf("    Stream format: %s\n", provider.StreamFormat)
+		}
 	}
 
 	defaultProvider := manager.GetDefaultProvider()
@@ -149,6 +338,15 @@ func maskAPIKey(apiKey string) string {
 	return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
 }
 
+// describeAPIKey describes the API key of a provider for display.
+// Keys kept in a credential store are not read, as that may prompt the user.
+func describeAPIKey(provider config.Provider) string {
+	if provider.APIKeyStore != "" {
+		return fmt.Sprintf("(stored in %s)", provider.APIKeyStore)
+	}
+	return maskAPIKey(provider.APIKey)
+}
+
 // handleProviderGet gets a provider configuration
 func handleProviderGet(manager *config.Manager, name string) error {
 	provider, ok := manager.GetProvider(name)
@@ -157,19 +355,141 @@ func handleProviderGet(manager *config.Manager, name string) error {
 	}
 
 	fmt.Printf("Provider: %s\n", name)
-	fmt.Printf("  API Key: %s\n", maskAPIKey(provider.APIKey))
+	fmt.Printf("  API Key: %s\n", describeAPIKey(provider))
 	if provider.Endpoint != "" {
 		fmt.Printf("  Endpoint: %s\n", provider.Endpoint)
 	}
+	if provider.Type != "" {
+		fmt.Printf("  Type: %s\n", provider.Type)
+	}
 	if provider.ModelName != "" {
 		fmt.Printf("  Model: %s\n", provider.ModelName)
 	}
+	printModelSpec("  ", provider.Model)
+	printTimeouts("  ", provider.Timeouts)
+	printRateLimit("  ", provider.RateLimit)
+	printThinking("  ", provider.Thinking)
+	printGeneration("  ", provider.Generation)
+	if provider.StreamFormat != "" {
+		fmt.Printf("  Stream format: %s\n", provider.StreamFormat)
+	}
 
 	return nil
 }
 
+// printTimeouts prints the configured timeouts of a provider
+func printTimeouts(indent string, timeouts config.Timeouts) {
+	if timeouts.Connect > 0 {
+		fmt.Printf("%sConnect timeout: %s\n", indent, timeouts.Connect)
+	}
+	if timeouts.Read > 0 {
+		fmt.Printf("%sRead timeout: %s\n", indent, timeouts.Read)
+	}
+	if timeouts.Total > 0 {
+		fmt.Printf("%sTotal timeout: %s\n", indent, timeouts.Total)
+	}
+	if timeouts.Idle > 0 {
+		fmt.Printf("%sIdle timeout: %s\n", indent, timeouts.Idle)
+	}
+	if timeouts.KeepAlive > 0 {
+		fmt.Printf("%sKeep-alive: %s\n", indent, timeouts.KeepAlive)
+	}
+}
+
+// printRateLimit prints the configured rate limits of a provider
+func printRateLimit(indent string, limit config.RateLimit) {
+	if limit.RequestsPerMinute > 0 {
+		fmt.Printf("%sRequests per minute: %d\n", indent, limit.RequestsPerMinute)
+	}
+	if limit.TokensPerMinute > 0 {
+		fmt.Printf("%sTokens per minute: %d\n", indent, limit.TokensPerMinute)
+	}
+	if limit.MaxConcurrent > 0 {
+		fmt.Printf("%sMax concurrent requests: %d\n", indent, limit.MaxConcurrent)
+	}
+}
+
+// printThinking prints the configured extended thinking settings of a provider
+func printThinking(indent string, thinking config.Thinking) {
+	if thinking.Disabled {
+		fmt.Printf("%sThinking: off\n", indent)
+	}
+	if thinking.BudgetTokens > 0 {
+		fmt.Printf("%sThinking budget: %d tokens\n", indent, thinking.BudgetTokens)
+	}
+}
+
+// printGeneration prints the configured sampling settings of a provider
+func printGeneration(indent string, generation config.Generation) {
+	if generation.Temperature != nil {
+		fmt.Printf("%sTemperature: %g\n", indent, *generation.Temperature)
+	}
+	if generation.TopP != nil {
+		fmt.Printf("%sTop P: %g\n", indent, *generation.TopP)
+	}
+	if generation.MaxOutputTokens > 0 {
+		fmt.Printf("%sMax output tokens: %d\n", indent, generation.MaxOutputTokens)
+	}
+}
+
+// providerSetGeneration returns the sampling settings given to the provider set command, unset
+// for the flags that were not given
+func providerSetGeneration() config.Generation {
+	generation := config.Generation{MaxOutputTokens: *providerSetMaxOutput}
+	if providerSetTemperatureSet {
+		generation.Temperature = providerSetTemperature
+	}
+	if providerSetTopPSet {
+		generation.TopP = providerSetTopP
+	}
+	return generation
+}
+
+// setCapabilities replaces the capabilities of a model by a comma-separated list of them, or none
+func setCapabilities(model *config.ModelSpec, capabilities string) error {
+	model.SupportsTools, model.SupportsVision, model.SupportsReasoning = false, false, false
+	if capabilities == "none" {
+		return nil
+	}
+	for _, capability := range strings.Split(capabilities, ",") {
+		switch strings.TrimSpace(capability) {
+		case "tools":
+			model.SupportsTools = true
+		case "vision":
+			model.SupportsVision = true
+		case "reasoning":
+			model.SupportsReasoning = true
+		default:
+			return fmt.Errorf("unknown capability %q, expected tools, vision, reasoning or none", capability)
+		}
+	}
+	return nil
+}
+
+// printModelSpec prints the configured description of the model of a provider
+func printModelSpec(indent string, model config.ModelSpec) {
+	if model.ContextWindow > 0 {
+		fmt.Printf("%sContext window: %d tokens\n", indent, model.ContextWindow)
+	}
+	if model.InputCostPer1K > 0 || model.OutputCostPer1K > 0 {
+		fmt.Printf("%sCost per 1K tokens: %g input, %g output\n", indent, model.InputCostPer1K, model.OutputCostPer1K)
+	}
+	var capabilities []string
+	for _, capability := range []struct {
+		name      string
+		supported bool
+	}{{"tools", model.SupportsTools}, {"vision", model.SupportsVision}, {"reasoning", model.SupportsReasoning}} {
+		if capability.supported {
+			capabilities = append(capabilities, capability.name)
+		}
+	}
+	if len(capabilities) > 0 {
+		fmt.Printf("%sCapabilities: %s\n", indent, strings.Join(capabilities, ", "))
+	}
+}
+
 // handleProviderSet sets a provider configuration
-func handleProviderSet(manager *config.Manager, name, apiKey, endpoint, modelName string) error {
+func handleProviderSet(manager *config.Manager, name, apiKey, keyStore, endpoint, modelName string, timeouts config.Timeouts, rateLimit config.RateLimit, streamFormat, thinking string, thinkingBudget int, providerType string, model config.ModelSpec, capabilities string, generation config.Generation) error {
 	// Get existing provider if it exists
 	provider, ok := manager.GetProvider(name)
 	if !ok {
@@ -177,8 +497,22 @@ func handleProviderSet(manager *config.Manager, name, apiKey, endpoint, modelNam
 	}
 
 	// Update provider with new values
-	if apiKey != "" {
-		provider.APIKey = apiKey
+	if providerType != "" {
+		provider.Type = providerType
+	}
+	if model.ContextWindow > 0 {
+		provider.Model.ContextWindow = model.ContextWindow
+	}
+	if model.InputCostPer1K > 0 {
+		provider.Model.InputCostPer1K = model.InputCostPer1K
+	}
+	if model.OutputCostPer1K > 0 {
+		provider.Model.OutputCostPer1K = model.OutputCostPer1K
+	}
+	if capabilities != "" {
+		if err := setCapabilities(&provider.Model, capabilities); err != nil {
+			return err
+		}
 	}
 	if endpoint != "" {
 		provider.Endpoint = endpoint
@@ -186,10 +520,65 @@ func handleProviderSet(manager *config.Manager, name, apiKey, endpoint, modelNam
 	if modelName != "" {
 		provider.ModelName = modelName
 	}
+	if timeouts.Connect > 0 {
+		provider.Timeouts.Connect = timeouts.Connect
+	}
+	if timeouts.Read > 0 {
+		provider.Timeouts.Read = timeouts.Read
+	}
+	if timeouts.Total > 0 {
+		provider.Timeouts.Total = timeouts.Total
+	}
+	if timeouts.Idle > 0 {
+		provider.Timeouts.Idle = timeouts.Idle
+	}
+	if timeouts.KeepAlive > 0 {
+		provider.Timeouts.KeepAlive = timeouts.KeepAlive
+	}
+	if rateLimit.RequestsPerMinute > 0 {
+		provider.RateLimit.RequestsPerMinute = rateLimit.RequestsPerMinute
+	}
+	if rateLimit.TokensPerMinute > 0 {
+		provider.RateLimit.TokensPerMinute = rateLimit.TokensPerMinute
+	}
+	if rateLimit.MaxConcurrent > 0 {
+		provider.RateLimit.MaxConcurrent = rateLimit.MaxConcurrent
+	}
+	if streamFormat != "" {
+		provider.StreamFormat = streamFormat
+	}
+	if thinking != "" {
+		provider.Thinking.Disabled = thinking == "off"
+	}
+	if thinkingBudget > 0 {
+		provider.Thinking.BudgetTokens = thinkingBudget
+	}
+	if generation.Temperature != nil {
+		if *generation.Temperature < 0 || *generation.Temperature > 2 {
+			return fmt.Errorf("temperature must be between 0 and 2, got %g", *generation.Temperature)
+		}
+		provider.Generation.Temperature = generation.Temperature
+	}
+	if generation.TopP != nil {
+		if *generation.TopP < 0 || *generation.TopP > 1 {
+			return fmt.Errorf("top_p must be between 0 and 1, got %g", *generation.TopP)
+		}
+		provider.Generation.TopP = generation.TopP
+	}
+	if generation.MaxOutputTokens > 0 {
+		provider.Generation.MaxOutputTokens = generation.MaxOutputTokens
+	}
 
 	// Set the provider
 	manager.SetProvider(name, provider)
 
+	// Store the API key
+	if apiKey != "" {
+		if err := manager.SetProviderAPIKey(name, apiKey, keyStore); err != nil {
+			return err
+		}
+	}
+
 	// Save the configuration
 	if err := manager.SaveGlobalConfig(); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
@@ -201,21 +590,9 @@ func handleProviderSet(manager *config.Manager, name, apiKey, endpoint, modelNam
 
 // handleProviderRemove removes a provider configuration
 func handleProviderRemove(manager *config.Manager, name string) error {
-	globalConfig := manager.GetGlobalConfig()
-	if globalConfig == nil || globalConfig.Providers == nil {
-		return fmt.Errorf("provider %s not found", name)
-	}
-
-	if _, ok := globalConfig.Providers[name]; !ok {
-		return fmt.Errorf("provider %s not found", name)
-	}
-
-	// Remove the provider
-	delete(globalConfig.Providers, name)
-
-	// If this was the default provider, clear it
-	if globalConfig.DefaultProvider == name {
-		globalConfig.DefaultProvider = ""
+	// Remove the provider and its stored API key
+	if err := manager.RemoveProvider(name); err != nil {
+		return err
 	}
 
 	// Save the configuration
@@ -314,3 +691,313 @@ func handleRepoModelSet(manager *config.Manager, name string) error {
 	fmt.Printf("Repository model set to %s\n", name)
 	return nil
 }
+
+// handleAccessibilityGet shows whether accessibility mode is enabled
+func handleAccessibilityGet(manager *config.Manager) error {
+	if manager.IsAccessibilityEnabled() {
+		fmt.Println("Accessibility mode: on")
+	} else {
+		fmt.Println("Accessibility mode: off")
+	}
+	return nil
+}
+
+// handleAccessibilitySet enables or disables accessibility mode
+func handleAccessibilitySet(manager *config.Manager, enabled bool) error {
+	// Set accessibility mode
+	manager.SetAccessibility(enabled)
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	return handleAccessibilityGet(manager)
+}
+
+// handleResponseLanguageGet shows the response language
+func handleResponseLanguageGet(manager *config.Manager) error {
+	language := manager.GetResponseLanguage()
+	if language == "" {
+		fmt.Println("Response language: the language of the user")
+		return nil
+	}
+	fmt.Printf("Response language: %s\n", prompts.LanguageName(language))
+	return nil
+}
+
+// handleResponseLanguageSet sets the response language globally or for the repository
+func handleResponseLanguageSet(manager *config.Manager, language string, repo bool) error {
+	if language == "default" {
+		language = ""
+	}
+	manager.SetResponseLanguage(language, repo)
+
+	if repo {
+		if err := manager.SaveRepoConfig(); err != nil {
+			return fmt.Errorf("failed to save repository configuration: %w", err)
+		}
+	} else if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	return handleResponseLanguageGet(manager)
+}
+
+// handleProfileList lists all profiles
+func handleProfileList(manager *config.Manager) error {
+	names := manager.ProfileNames()
+	if len(names) == 0 {
+		fmt.Println("No profiles configured")
+		return nil
+	}
+
+	active := manager.GetActiveProfile()
+	fmt.Println("Profiles:")
+	for _, name := range names {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		profile, _ := manager.GetProfile(name)
+		fmt.Printf(" %s %s: %s\n", marker, name, describeProfile(profile))
+	}
+
+	return nil
+}
+
+// handleProfileGet gets a profile
+func handleProfileGet(manager *config.Manager, name string) error {
+	profile, ok := manager.GetProfile(name)
+	if !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+
+	fmt.Printf("Profile: %s\n", name)
+	if name == manager.GetActiveProfile() {
+		fmt.Println("  Active: yes")
+	}
+	if profile.Provider != "" {
+		fmt.Printf("  Provider: %s\n", profile.Provider)
+	}
+	if profile.ModelName != "" {
+		fmt.Printf("  Model: %s\n", profile.ModelName)
+	}
+	if profile.Budget > 0 {
+		fmt.Printf("  Budget: $%.2f per task\n", profile.Budget)
+	}
+	fmt.Printf("  Auto-approve: %s\n", describeAutoApprove(profile.AutoApprove))
+
+	return nil
+}
+
+// describeProfile describes a profile on one line for display
+func describeProfile(profile config.Profile) string {
+	var parts []string
+	if profile.Provider != "" {
+		parts = append(parts, "provider "+profile.Provider)
+	}
+	if profile.ModelName != "" {
+		parts = append(parts, "model "+profile.ModelName)
+	}
+	if profile.Budget > 0 {
+		parts = append(parts, fmt.Sprintf("budget $%.2f", profile.Budget))
+	}
+	parts = append(parts, "auto-approve "+describeAutoApprove(profile.AutoApprove))
+	return strings.Join(parts, ", ")
+}
+
+// describeAutoApprove describes the auto-approved actions for display
+func describeAutoApprove(autoApprove config.AutoApprove) string {
+	var actions []string
+	if autoApprove.ReadFiles {
+		actions = append(actions, autoApproveRead)
+	}
+	if autoApprove.EditFiles {
+		actions = append(actions, autoApproveEdit)
+	}
+	if autoApprove.ExecuteCommands {
+		actions = append(actions, autoApproveExecute)
+	}
+	if len(actions) == 0 {
+		return "none"
+	}
+	return strings.Join(actions, ", ")
+}
+
+// budgetFlag returns the --budget flag of config profile create, or nil if it was not given
+func budgetFlag() *float64 {
+	if !profileCreateBudgetSet {
+		return nil
+	}
+	return profileCreateBudget
+}
+
+// handleProfileCreate creates or updates a profile.
+// Settings that are not given keep their current value.
+func handleProfileCreate(manager *config.Manager, name, providerName, modelName string, budget *float64, autoApprove []string) error {
+	// Get existing profile if it exists
+	profile, ok := manager.GetProfile(name)
+	if !ok {
+		profile = config.Profile{}
+	}
+
+	// Check if the provider exists in global config
+	if providerName != "" {
+		if _, ok := manager.GetProvider(providerName); !ok {
+			fmt.Fprintf(os.Stderr, "Warning: provider %s not found in global configuration\n", providerName)
+		}
+		profile.Provider = providerName
+	}
+	if modelName != "" {
+		profile.ModelName = modelName
+	}
+	if budget != nil {
+		if *budget < 0 {
+			return errors.New("budget must not be negative")
+		}
+		profile.Budget = *budget
+	}
+	if len(autoApprove) > 0 {
+		profile.AutoApprove = config.AutoApprove{}
+		for _, action := range autoApprove {
+			switch action {
+			case autoApproveRead:
+				profile.AutoApprove.ReadFiles = true
+			case autoApproveEdit:
+				profile.AutoApprove.EditFiles = true
+			case autoApproveExecute:
+				profile.AutoApprove.ExecuteCommands = true
+			}
+		}
+	}
+
+	// Set the profile
+	manager.SetProfile(name, profile)
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if ok {
+		fmt.Printf("Profile %s updated\n", name)
+	} else {
+		fmt.Printf("Profile %s created\n", name)
+	}
+	return nil
+}
+
+// handleProfileSwitch switches the active profile
+func handleProfileSwitch(manager *config.Manager, name string, none bool) error {
+	if none == (name != "") {
+		return errors.New("give either a profile name or --none")
+	}
+
+	// Set the active profile
+	if err := manager.SetActiveProfile(name); err != nil {
+		return err
+	}
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if none {
+		fmt.Println("Profiles deactivated")
+	} else {
+		fmt.Printf("Switched to profile %s\n", name)
+	}
+	return nil
+}
+
+// handleProfileRemove removes a profile
+func handleProfileRemove(manager *config.Manager, name string) error {
+	// Remove the profile
+	if err := manager.RemoveProfile(name); err != nil {
+		return err
+	}
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("Profile %s removed\n", name)
+	return nil
+}
+
+// handleForgeList lists all configured forges
+func handleForgeList(manager *config.Manager) error {
+	hosts := manager.ForgeHosts()
+	if len(hosts) == 0 {
+		fmt.Println("No forges configured")
+		return nil
+	}
+
+	fmt.Println("Configured forges:")
+	for _, host := range hosts {
+		f, _ := manager.GetForge(host)
+		fmt.Printf("  %s:\n", host)
+		if f.Type != "" {
+			fmt.Printf("    Type: %s\n", f.Type)
+		}
+		if f.APIURL != "" {
+			fmt.Printf("    API URL: %s\n", f.APIURL)
+		}
+		switch {
+		case f.TokenStore != "":
+			fmt.Printf("    Token: (stored in %s)\n", f.TokenStore)
+		case f.Token != "":
+			fmt.Printf("    Token: %s\n", maskAPIKey(f.Token))
+		}
+	}
+	return nil
+}
+
+// handleForgeSet sets the configuration of a forge
+func handleForgeSet(manager *config.Manager, host, forgeType, apiURL, token, tokenStore string) error {
+	// Get the existing forge if it exists
+	f, _ := manager.GetForge(host)
+
+	// Update the forge with the new values
+	if forgeType != "" {
+		f.Type = forgeType
+	}
+	if apiURL != "" {
+		f.APIURL = apiURL
+	}
+	manager.SetForge(host, f)
+
+	// Store the token
+	if token != "" {
+		if err := manager.SetForgeToken(host, token, tokenStore); err != nil {
+			return err
+		}
+	}
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("Forge %s updated\n", host)
+	return nil
+}
+
+// handleForgeRemove removes the configuration of a forge
+func handleForgeRemove(manager *config.Manager, host string) error {
+	// Remove the forge and its stored token
+	if err := manager.RemoveForge(host); err != nil {
+		return err
+	}
+
+	// Save the configuration
+	if err := manager.SaveGlobalConfig(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("Forge %s removed\n", host)
+	return nil
+}
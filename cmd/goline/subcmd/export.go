@@ -0,0 +1,58 @@
+package subcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kazz187/goline/internal/core/export"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// Export renders the persisted conversation of a task into a document.
+// The document is written to output, or to stdout if output is empty.
+func Export(taskID, format, output string) error {
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return err
+	}
+
+	task, err := store.LoadTask()
+	if errors.Is(err, os.ErrNotExist) {
+		// The history can be exported without the metadata
+		task = &pb.Task{Id: taskID}
+	} else if err != nil {
+		return err
+	}
+
+	history, report, err := store.LoadHistory()
+	if err != nil {
+		return err
+	}
+	if report.Files == 0 && task.InitialPrompt == "" {
+		return fmt.Errorf("no stored data found for task %s", taskID)
+	}
+	if !report.OK() {
+		fmt.Fprintf(os.Stderr, "Warning: %d damaged record(s) were skipped, run goline tasks verify %s for details\n", len(report.Problems), taskID)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := export.Render(w, export.Format(format), export.Transcript{Task: task, History: history}); err != nil {
+		return err
+	}
+	if output != "" {
+		fmt.Fprintf(os.Stderr, "Exported task %s to %s\n", taskID, output)
+	}
+	return nil
+}
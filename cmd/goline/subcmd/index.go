@@ -0,0 +1,152 @@
+package subcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/fswatch"
+	"github.com/kazz187/goline/internal/core/index"
+)
+
+// IndexOptions holds the options for the index command
+type IndexOptions struct {
+	// Watch keeps the index up to date as files change, until interrupted
+	Watch bool
+	// Search prints the chunks most similar to the query instead of only updating the index
+	Search string
+}
+
+// Index builds or updates the semantic index of the workspace
+func Index(opts IndexOptions) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	ix, path, err := openIndex(manager, workingDir)
+	if err != nil {
+		return err
+	}
+
+	// Stop indexing on Ctrl+C or SIGTERM
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	start := time.Now()
+	stats, err := ix.Update(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Indexed %d files (%d chunks), %d updated and %d removed in %s\n",
+		stats.Files, stats.Chunks, stats.Updated, stats.Removed, time.Since(start).Round(time.Millisecond))
+	fmt.Fprintf(os.Stderr, "Index stored at %s\n", path)
+
+	if opts.Search != "" {
+		results, err := ix.Search(ctx, opts.Search, "", index.DefaultLimit)
+		if err != nil {
+			return err
+		}
+		fmt.Println(index.FormatResults(results))
+	}
+	if !opts.Watch {
+		return nil
+	}
+
+	service, err := fswatch.New(workingDir)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	defer ix.WatchIgnore(service)()
+	service.Subscribe(fswatch.MatchAll, time.Second, func(paths []string) {
+		stats, err := ix.UpdateFiles(ctx, paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update the index: %v\n", err)
+			return
+		}
+		if err := ix.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return
+		}
+		if stats.Updated > 0 || stats.Removed > 0 {
+			fmt.Fprintf(os.Stderr, "Updated %d files, removed %d\n", stats.Updated, stats.Removed)
+		}
+	})
+	fmt.Fprintln(os.Stderr, "Watching for changes, press Ctrl+C to stop")
+	<-ctx.Done()
+	return nil
+}
+
+// openIndex opens the stored semantic index of the workspace with the configured embedder
+func openIndex(manager *config.Manager, workingDir string) (*index.Index, string, error) {
+	embedder, err := newEmbedder(manager)
+	if err != nil {
+		return nil, "", err
+	}
+	path, err := index.DefaultPath(workingDir)
+	if err != nil {
+		return nil, "", err
+	}
+	ix, err := index.Open(path, workingDir, embedder)
+	if err != nil {
+		return nil, "", err
+	}
+	return ix, path, nil
+}
+
+// newEmbedder creates the embedder of the semantic index: the embeddings API of the configured
+// provider, or the local hash embedder if none is configured
+func newEmbedder(manager *config.Manager) (index.Embedder, error) {
+	cfg := manager.GetIndex()
+	if cfg.Provider == "" {
+		return index.HashEmbedder{}, nil
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("index.model must be set with index.provider")
+	}
+	apiKey, err := manager.GetProviderAPIKey(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+	providerConfig, _ := manager.GetProvider(cfg.Provider)
+	return index.NewOpenAIEmbedder(apiKey, providerConfig.Endpoint, cfg.Model), nil
+}
+
+// openTaskIndex opens the semantic index searched by the tasks of the workspace, brought up to
+// date with the changes made since it was last updated. It is nil if the index is disabled or
+// the workspace was never indexed with `goline index`.
+func openTaskIndex(ctx context.Context, manager *config.Manager, workingDir string) *index.Index {
+	if manager.GetIndex().Disabled {
+		return nil
+	}
+	path, err := index.DefaultPath(workingDir)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	ix, _, err := openIndex(manager, workingDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to open the semantic index: %v\n", err)
+		return nil
+	}
+	if _, err := ix.Update(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update the semantic index: %v\n", err)
+		return ix
+	}
+	if err := ix.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return ix
+}
@@ -0,0 +1,46 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kazz187/goline/internal/forge"
+)
+
+// issuePrompt fetches an issue and returns the first message of a task working on it. The
+// repository of an owner/repo#123 reference is looked up on the forge of the origin remote,
+// or on GitHub outside of a repository.
+func issuePrompt(ctx context.Context, ref, instructions string) (string, error) {
+	repo, number, err := forge.ParseIssue(ref)
+	if err != nil {
+		return "", err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	if repo.Host == "" {
+		repo.Host = "github.com"
+		if origin, err := forge.RemoteRepository(workingDir, "origin"); err == nil {
+			repo.Host = origin.Host
+		}
+	}
+
+	manager, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	client, err := newForge(manager, repo.Host, false)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Fetching issue %s#%d...\n", repo, number)
+	issue, err := client.GetIssue(ctx, repo, number)
+	if err != nil {
+		return "", err
+	}
+	return issue.Prompt(instructions, workingDir), nil
+}
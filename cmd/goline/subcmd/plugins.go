@@ -0,0 +1,21 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/plugins"
+)
+
+// loadPlugins loads the plugin tools and registers them, so they are parsed and documented
+// to the AI. Plugins that fail to load are reported and skipped.
+func loadPlugins(manager *config.Manager) *plugins.Set {
+	set, errs := plugins.Load(context.Background(), manager.GetPluginDirs(), manager.GetPlugins().Timeout)
+	errs = append(errs, set.Register()...)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return set
+}
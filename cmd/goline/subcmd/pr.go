@@ -0,0 +1,154 @@
+package subcmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/export"
+	"github.com/kazz187/goline/internal/core/gitcommit"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/forge"
+)
+
+// PullRequestOptions holds the options for the pr create command
+type PullRequestOptions struct {
+	// TaskID is the ID of the task whose changes are proposed
+	TaskID string
+	// Remote is the git remote the branch is pushed to
+	Remote string
+	// Base is the branch the changes are merged into, the default branch of the remote if empty
+	Base string
+	// Branch is the branch the changes are pushed to, goline/<task ID> if empty
+	Branch string
+	// Draft opens the pull request as a draft
+	Draft bool
+}
+
+// CreatePullRequest pushes the commits of a task to a branch and opens a pull request for them,
+// described by the AI from the transcript of the task
+func CreatePullRequest(opts PullRequestOptions) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(manager)
+	if err != nil {
+		return err
+	}
+
+	// Load the transcript of the task
+	store, err := taskstore.NewStore(opts.TaskID)
+	if err != nil {
+		return err
+	}
+	task, err := store.LoadTask()
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("task %s not found", opts.TaskID)
+	} else if err != nil {
+		return err
+	}
+	history, _, err := store.LoadHistory()
+	if err != nil {
+		return err
+	}
+	var transcript bytes.Buffer
+	if err := export.Render(&transcript, export.FormatMarkdown, export.Transcript{Task: task, History: history}); err != nil {
+		return err
+	}
+
+	workingDir := task.WorkingDirectory
+	if workingDir == "" {
+		if workingDir, err = os.Getwd(); err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	// Only committed changes are pushed
+	paths, err := gitcommit.TaskPaths(opts.TaskID)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 0 {
+		uncommitted, err := forge.Uncommitted(workingDir, paths)
+		if err != nil {
+			return err
+		}
+		if len(uncommitted) > 0 {
+			return fmt.Errorf("the files edited by the task have uncommitted changes, commit them first, e.g. with the commit command of the REPL:\n%s", strings.Join(uncommitted, "\n"))
+		}
+	}
+
+	// Find the forge of the remote
+	repo, err := forge.RemoteRepository(workingDir, opts.Remote)
+	if err != nil {
+		return err
+	}
+	client, err := newForge(manager, repo.Host, true)
+	if err != nil {
+		return err
+	}
+
+	base := opts.Base
+	if base == "" {
+		base = forge.DefaultBranch(workingDir, opts.Remote)
+	}
+	branch := opts.Branch
+	if branch == "" {
+		branch = "goline/" + opts.TaskID
+	}
+	changes, err := forge.Changes(workingDir, opts.Remote+"/"+base)
+	if err != nil {
+		return err
+	}
+
+	// Stop on Ctrl+C
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	fmt.Fprintln(os.Stderr, "Describing changes...")
+	description, _, err := forge.Describe(ctx, p, transcript.String(), changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Pushing to %s %s...\n", opts.Remote, branch)
+	if err := forge.Push(workingDir, opts.Remote, branch); err != nil {
+		return err
+	}
+
+	url, err := client.CreatePullRequest(ctx, repo, forge.PullRequest{
+		Title: description.Title,
+		Body:  description.Body,
+		Head:  branch,
+		Base:  base,
+		Draft: opts.Draft,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// newForge creates the client of the forge of a host from its configuration. Without a token,
+// only public repositories can be read.
+func newForge(manager *config.Manager, host string, requireToken bool) (forge.Forge, error) {
+	forgeConfig, _ := manager.GetForge(host)
+	forgeType := forgeConfig.Type
+	if forgeType == "" {
+		forgeType = forge.DetectType(host)
+	}
+	token, err := manager.GetForgeToken(host, forgeType)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && requireToken {
+		return nil, fmt.Errorf("no token configured for %s, set one with goline config forge set %s --token <token>", host, host)
+	}
+	return forge.New(forgeType, host, forgeConfig.APIURL, token)
+}
@@ -0,0 +1,143 @@
+package subcmd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/metrics"
+	"github.com/kazz187/goline/internal/provider"
+	_ "github.com/kazz187/goline/internal/provider/anthropic"    // Register the Anthropic provider
+	_ "github.com/kazz187/goline/internal/provider/deepseek"     // Register the DeepSeek provider
+	_ "github.com/kazz187/goline/internal/provider/mock"         // Register the mock provider replaying fixtures
+	_ "github.com/kazz187/goline/internal/provider/openaicompat" // Register the OpenAI-compatible provider
+	"github.com/kazz187/goline/internal/tracing"
+	"github.com/kazz187/goline/internal/tui"
+)
+
+// newProvider creates the effective provider from the configuration
+func newProvider(manager *config.Manager) (provider.Provider, error) {
+	return newProviderFor(manager, manager.GetEffectiveProvider(), manager.GetEffectiveModelName(), nil)
+}
+
+// splitModel splits a model prefixed with its provider, e.g. anthropic/claude-3-5-haiku-20241022.
+// The prefix is only a provider if one of its name is configured or registered, as the names of
+// the models of some gateways have slashes too. The provider is empty when there is no prefix.
+func splitModel(manager *config.Manager, spec string) (providerName, modelName string) {
+	prefix, rest, ok := strings.Cut(spec, "/")
+	if !ok {
+		return "", spec
+	}
+	if _, configured := manager.GetProvider(prefix); configured {
+		return prefix, rest
+	}
+	if _, registered := provider.GetFactory(prefix); registered {
+		return prefix, rest
+	}
+	return "", spec
+}
+
+// useModel selects the model of a --model flag for this run, checking that its provider can be created
+func useModel(manager *config.Manager, spec string) error {
+	providerName, modelName := splitModel(manager, spec)
+	manager.UseModel(providerName, modelName)
+	p, err := newProvider(manager)
+	if err != nil {
+		return fmt.Errorf("cannot use model %s: %w", spec, err)
+	}
+	return checkModel(p, modelName)
+}
+
+// checkModel checks that a provider uses the model asked for, as the providers with built-in
+// models fall back to their default model for the names they do not know
+func checkModel(p provider.Provider, modelName string) error {
+	if got := p.GetModel().Name; modelName != "" && got != modelName {
+		return fmt.Errorf("unknown model %s of provider %s", modelName, p.Name())
+	}
+	return nil
+}
+
+// resolveModelChoice resolves the argument of the model command of the REPL, a model of the
+// current provider or a model prefixed with its provider, by creating the provider
+func resolveModelChoice(manager *config.Manager, currentProvider, spec string) (tui.ModelChoice, error) {
+	providerName, modelName := splitModel(manager, spec)
+	providerName = cmp.Or(providerName, currentProvider)
+	p, err := newProviderFor(manager, providerName, modelName, nil)
+	if err != nil {
+		return tui.ModelChoice{}, err
+	}
+	if err := checkModel(p, modelName); err != nil {
+		return tui.ModelChoice{}, err
+	}
+	model := p.GetModel()
+	return tui.ModelChoice{Provider: providerName, Model: model.Name, ContextWindow: model.MaxTokens, Capabilities: p.Capabilities()}, nil
+}
+
+// newProviderFor creates a provider configured in the configuration with a model. Its requests
+// are recorded by trace unless it is nil, with its API key redacted.
+func newProviderFor(manager *config.Manager, name, modelName string, trace *provider.TraceRecorder) (provider.Provider, error) {
+	if name == "" {
+		return nil, errors.New("no provider configured, run `goline config provider set` and `goline config default-provider set` first")
+	}
+
+	// The provider may only be configured through its GOLINE_<PROVIDER>_API_KEY environment variable
+	apiKey, err := manager.GetProviderAPIKey(name)
+	if err != nil {
+		return nil, err
+	}
+	providerConfig, _ := manager.GetProvider(name)
+
+	opts := provider.Options{
+		Timeouts: provider.Timeouts{
+			Connect:   providerConfig.Timeouts.Connect,
+			Read:      providerConfig.Timeouts.Read,
+			Total:     providerConfig.Timeouts.Total,
+			Idle:      providerConfig.Timeouts.Idle,
+			KeepAlive: providerConfig.Timeouts.KeepAlive,
+		},
+		StreamFormat:         provider.StreamFormat(providerConfig.StreamFormat),
+		DisablePromptCaching: providerConfig.DisablePromptCaching,
+		Thinking: provider.Thinking{
+			Disabled:     providerConfig.Thinking.Disabled,
+			BudgetTokens: providerConfig.Thinking.BudgetTokens,
+		},
+		Model: provider.ModelInfo{
+			MaxTokens:       providerConfig.Model.ContextWindow,
+			InputCostPer1K:  providerConfig.Model.InputCostPer1K,
+			OutputCostPer1K: providerConfig.Model.OutputCostPer1K,
+		},
+		Capabilities: provider.Capabilities{
+			Tools:     providerConfig.Model.SupportsTools,
+			Vision:    providerConfig.Model.SupportsVision,
+			Reasoning: providerConfig.Model.SupportsReasoning,
+		},
+		Generation: provider.GenerationOptions{
+			Temperature:     providerConfig.Generation.Temperature,
+			TopP:            providerConfig.Generation.TopP,
+			MaxOutputTokens: providerConfig.Generation.MaxOutputTokens,
+		},
+	}
+	if trace != nil {
+		trace.Redact(apiKey)
+		opts.Trace = trace
+	}
+	// Several providers can share an implementation, e.g. OpenAI-compatible servers
+	providerType := cmp.Or(providerConfig.Type, name)
+	p, err := provider.Create(providerType, apiKey, providerConfig.Endpoint, modelName, opts)
+	if err != nil {
+		if errors.Is(err, provider.ErrProviderNotFound) {
+			return nil, fmt.Errorf("unknown provider: %s", providerType)
+		}
+		return nil, fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	// The tasks using the provider share its rate limits, throttled requests are not counted by the metrics
+	limiter := provider.SharedRateLimiter(name, provider.RateLimits{
+		RequestsPerMinute: providerConfig.RateLimit.RequestsPerMinute,
+		TokensPerMinute:   providerConfig.RateLimit.TokensPerMinute,
+		MaxConcurrent:     providerConfig.RateLimit.MaxConcurrent,
+	})
+	return provider.LimitProvider(metrics.InstrumentProvider(tracing.TraceProvider(p)), limiter), nil
+}
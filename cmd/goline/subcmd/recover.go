@@ -0,0 +1,70 @@
+package subcmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/apply"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/tasklock"
+)
+
+// recoverApply checks whether applying edits was interrupted for a task and
+// lets the user roll back to the pre-apply checkpoint or continue with the pending edits
+func recoverApply(taskID, workingDir string, lock *tasklock.Lock, in io.Reader, out io.Writer) error {
+	checkpoints := checkpoint.NewService()
+	checkpoints.SetLock(taskID, lock)
+	applier, err := apply.NewApplier(taskID, workingDir, checkpoints)
+	if err != nil {
+		return err
+	}
+	applier.SetLock(lock)
+
+	journal, err := applier.Pending()
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return nil
+	}
+
+	fmt.Fprint(out, apply.FormatJournal(journal))
+	if lock.IsReadOnly() {
+		fmt.Fprintln(out, "The task is open read-only, resume it on the host holding it to recover the edits")
+		return nil
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprint(out, "Roll back to the pre-apply checkpoint (r), continue applying the pending edits (c), or keep the files as they are (k)? [r/c/k] ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			// No answer, keep the journal so the choice is offered again next time
+			fmt.Fprintln(out)
+			return nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "r":
+			if err := applier.Rollback(); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Rolled back to checkpoint %s\n", journal.CheckpointId)
+			return nil
+		case "c":
+			if err := applier.Continue(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Applied the pending edits")
+			return nil
+		case "k":
+			if err := applier.Discard(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Kept the working directory as it is")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package subcmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/agent"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/audit"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	"github.com/kazz187/goline/internal/core/hooks"
+	"github.com/kazz187/goline/internal/core/index"
+	"github.com/kazz187/goline/internal/core/plugins"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/tui"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// replRunner runs the messages of the REPL tasks with the AI agent. Each task has its own
+// agent, whose conversation goes on from one message of the task to the next.
+type replRunner struct {
+	manager    *config.Manager
+	workingDir string
+	readOnly   *cmdpolicy.ReadOnly
+	policy     *cmdpolicy.Policy
+	plugins    *plugins.Set
+	index      *index.Index
+	// firstTask is the task the REPL was started on, locked by lock. The tasks opened in the
+	// REPL are locked when they run their first message.
+	firstTask string
+	lock      *tasklock.Lock
+
+	mu    sync.Mutex
+	tasks map[string]*replTask
+}
+
+// replTask is a REPL task and its agent
+type replTask struct {
+	task     *pb.Task
+	store    *taskstore.Store
+	lock     *tasklock.Lock
+	agent    *agent.Agent
+	approver *replApprover
+	output   *replOutput
+	// promptOpts build the system prompt, again when the model or response language changes
+	promptOpts prompts.SystemPromptOptions
+	model      tui.ModelChoice
+}
+
+// newREPLRunner creates the runner of the tasks of a REPL started on a task, restricted to
+// readOnly unless it is nil
+func newREPLRunner(manager *config.Manager, taskID string, lock *tasklock.Lock, readOnly *cmdpolicy.ReadOnly) (*replRunner, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+	policy, err := cmdpolicy.New(manager.GetCommandPolicy())
+	if err != nil {
+		return nil, err
+	}
+	return &replRunner{
+		manager:    manager,
+		workingDir: workingDir,
+		readOnly:   readOnly,
+		policy:     policy,
+		// Register the plugin tools before the system prompts document the tools
+		plugins:   loadPlugins(manager),
+		index:     openTaskIndex(context.Background(), manager, workingDir),
+		firstTask: taskID,
+		lock:      lock,
+		tasks:     make(map[string]*replTask),
+	}, nil
+}
+
+// Run implements tui.TaskRunner
+func (r *replRunner) Run(ctx context.Context, taskID, message string, out tui.HistoryWriter) error {
+	t, err := r.task(ctx, taskID, message, out)
+	if err != nil {
+		return err
+	}
+	t.output.out, t.approver.out = out, out
+	if err := r.applySettings(t, out); err != nil {
+		return err
+	}
+	if attachments, ok := out.(tui.TaskAttachments); ok && len(attachments.Images()) > 0 {
+		if err := t.agent.AttachImages(attachments.Images()...); err != nil {
+			return err
+		}
+	}
+
+	result, err := t.agent.Run(ctx, message)
+	return t.finish(out, result, err)
+}
+
+// Retry implements tui.TaskRetrier
+func (r *replRunner) Retry(ctx context.Context, taskID string, model tui.ModelChoice, out tui.HistoryWriter) error {
+	r.mu.Lock()
+	t, ok := r.tasks[taskID]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("task %s has no answer to regenerate yet", taskID)
+	}
+	t.output.out, t.approver.out = out, out
+	if err := r.applySettings(t, out); err != nil {
+		return err
+	}
+	// The other model only regenerates the answer, the task keeps its own
+	var p provider.Provider
+	if model.Provider != "" || model.Model != "" {
+		var err error
+		if p, err = newProviderFor(r.manager, cmp.Or(model.Provider, t.model.Provider), model.Model, nil); err != nil {
+			return err
+		}
+	}
+
+	result, err := t.agent.Retry(ctx, p)
+	return t.finish(out, result, err)
+}
+
+// finish shows the outcome of a run of the agent of the task and saves the task
+func (t *replTask) finish(out tui.HistoryWriter, result *agent.Result, runErr error) error {
+	t.output.flush()
+	if result != nil && result.Completion != "" {
+		out.AddSystemMessage(result.Completion)
+		if result.Command != "" && !result.CommandRun {
+			out.AddSystemMessage(fmt.Sprintf("Run `%s` to see the result.", result.Command))
+		}
+	}
+	t.task.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := t.store.SaveTask(t.task); err != nil {
+		out.AddSystemMessage(fmt.Sprintf("Warning: failed to save task: %v", err))
+	}
+	return runErr
+}
+
+// task returns the task with its agent, created for the first message of the task
+func (r *replRunner) task(ctx context.Context, taskID, message string, out tui.HistoryWriter) (*replTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tasks[taskID]; ok {
+		return t, nil
+	}
+
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return nil, err
+	}
+	lock := r.lock
+	if taskID != r.firstTask {
+		if lock, err = lockTask(taskID); err != nil {
+			return nil, err
+		}
+	}
+	store.SetLock(lock)
+	t, err := r.newTask(ctx, taskID, store, lock, message, out)
+	if err != nil {
+		if lock != r.lock {
+			lock.Release()
+		}
+		return nil, err
+	}
+	r.tasks[taskID] = t
+	return t, nil
+}
+
+// newTask loads the task, or saves it as a new one, and creates its agent
+func (r *replRunner) newTask(ctx context.Context, taskID string, store *taskstore.Store, lock *tasklock.Lock, message string, out tui.HistoryWriter) (*replTask, error) {
+	model := tui.ModelChoice{Provider: r.manager.GetEffectiveProvider(), Model: r.manager.GetEffectiveModelName()}
+	if settings, ok := out.(tui.TaskSettings); ok && settings.Model().Provider != "" {
+		model = settings.Model()
+	}
+	p, err := newProviderFor(r.manager, model.Provider, model.Model, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := store.LoadTask()
+	if errors.Is(err, os.ErrNotExist) {
+		now := time.Now().Format(time.RFC3339)
+		task = &pb.Task{
+			Id:               taskID,
+			State:            pb.TaskState_TASK_STATE_ACTIVE,
+			Provider:         p.Name(),
+			Model:            p.GetModel().Name,
+			InitialPrompt:    message,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+			WorkingDirectory: r.workingDir,
+		}
+		detectWorkspace(r.workingDir).Record(task)
+		err = store.SaveTask(task)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := checkpoint.NewService()
+	checkpoints.SetLock(taskID, lock)
+	applier, err := apply.NewApplier(taskID, r.workingDir, checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	applier.SetLock(lock)
+
+	rules, err := prompts.LoadUserRules(r.workingDir)
+	if err != nil {
+		out.AddSystemMessage(fmt.Sprintf("Warning: failed to load user rules: %v", err))
+	}
+	autoApprove := r.manager.GetEffectiveAutoApprove()
+	promptOpts := prompts.SystemPromptOptions{
+		Cwd:              r.workingDir,
+		Mode:             prompts.ModeAct,
+		AutoApprove:      autoApprove,
+		UserRules:        rules,
+		CanDelegate:      true,
+		ResponseLanguage: r.manager.GetResponseLanguage(),
+		SemanticSearch:   r.index != nil,
+		ContextRoots:     r.manager.GetContextRoots(),
+		Capabilities:     p.Capabilities(),
+	}
+	delegation, err := newDelegation(r.manager, promptOpts, &childTasks{parent: task, parentStore: store}, nil)
+	if err != nil {
+		return nil, err
+	}
+	summarizer, err := newSummarizer(r.manager, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	outbound := r.manager.GetOutbound()
+	auditLog, err := audit.Open(taskID, outbound)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &replTask{
+		task:       task,
+		store:      store,
+		lock:       lock,
+		output:     &replOutput{},
+		promptOpts: promptOpts,
+		model:      model,
+	}
+	t.approver = &replApprover{policy: agent.PolicyApprover{AutoApprove: autoApprove}, output: t.output}
+	autonomy := r.manager.GetAutonomy()
+	// The REPL notifies the user of the tasks waiting for input, failing or completing
+	t.agent = agent.New(agent.Options{
+		TaskID:          taskID,
+		WorkingDir:      r.workingDir,
+		Provider:        p,
+		SystemPrompt:    prompts.NewSystemPromptBuilder(p.Name()).Build(promptOpts),
+		Approver:        t.approver,
+		Applier:         applier,
+		Recorder:        taskstore.NewRecorder(store),
+		Output:          t.output,
+		Plugins:         r.plugins,
+		Hooks:           hooks.New(r.manager.GetHooks()),
+		Delegation:      delegation,
+		TimeLimit:       autonomy.Duration,
+		SummaryInterval: autonomy.SummaryInterval,
+		Summarizer:      summarizer,
+		RecentFiles:     newRecentFiles(ctx, r.manager, r.workingDir),
+		Index:           r.index,
+		ContextRoots:    promptOpts.ContextRoots,
+		CommandPolicy:   r.policy,
+		ReadOnly:        r.readOnly,
+		DeniedPaths:     outbound.DenyPaths,
+		Audit:           auditLog,
+		AutoFixAttempts: autoFixAttempts(r.manager),
+		MaxMistakes:     autonomy.MaxMistakes,
+	})
+	return t, nil
+}
+
+// applySettings applies the model, response language and sampling settings changed with the
+// REPL commands since the last message of the task
+func (r *replRunner) applySettings(t *replTask, out tui.HistoryWriter) error {
+	settings, ok := out.(tui.TaskSettings)
+	if !ok {
+		return nil
+	}
+	rebuild := false
+	if model := settings.Model(); model.Provider != "" && (model.Provider != t.model.Provider || model.Model != t.model.Model) {
+		p, err := newProviderFor(r.manager, model.Provider, model.Model, nil)
+		if err != nil {
+			return err
+		}
+		t.agent.SetProvider(p)
+		t.model = model
+		t.promptOpts.Capabilities = p.Capabilities()
+		rebuild = true
+	}
+	if language := cmp.Or(settings.ResponseLanguage(), r.manager.GetResponseLanguage()); language != t.promptOpts.ResponseLanguage {
+		t.promptOpts.ResponseLanguage = language
+		rebuild = true
+	}
+	if rebuild {
+		t.agent.SetSystemPrompt(prompts.NewSystemPromptBuilder(t.model.Provider).Build(t.promptOpts))
+	}
+	t.agent.SetGeneration(settings.Generation())
+	return nil
+}
+
+// Close releases the locks of the tasks opened in the REPL
+func (r *replRunner) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tasks {
+		if t.lock != r.lock {
+			t.lock.Release()
+		}
+	}
+}
+
+// replOutput writes the output of the agent of a task to its history in the REPL, set to the
+// history writer of the message being run. The streamed text is added as one entry up to
+// whatever else the history shows, e.g. a tool use or a question, rather than one per chunk.
+type replOutput struct {
+	out     tui.HistoryWriter
+	pending strings.Builder
+}
+
+func (o *replOutput) Write(p []byte) (int, error) {
+	return o.pending.Write(p)
+}
+
+// flush adds the text written since the last flush to the history
+func (o *replOutput) flush() {
+	text := strings.TrimSpace(o.pending.String())
+	o.pending.Reset()
+	if text != "" {
+		o.out.AddAgentOutput(text)
+	}
+}
+
+// StreamToolUse implements agent.ToolUseStreamer
+func (o *replOutput) StreamToolUse(toolUse assistantmessage.ToolUse) {
+	o.flush()
+	if previewer, ok := o.out.(tui.ToolUsePreviewer); ok {
+		previewer.PreviewToolUse(toolUse)
+	}
+}
+
+// ReportThrottle implements agent.ThrottleReporter
+func (o *replOutput) ReportThrottle(wait time.Duration) {
+	o.flush()
+	if reporter, ok := o.out.(tui.ThrottleReporter); ok {
+		reporter.ReportThrottle(wait)
+	}
+}
+
+// ReportThrottleEnd implements agent.ThrottleReporter
+func (o *replOutput) ReportThrottleEnd() {
+	if reporter, ok := o.out.(tui.ThrottleReporter); ok {
+		reporter.ReportThrottleEnd()
+	}
+}
+
+// ReportOffline implements agent.ConnectivityReporter
+func (o *replOutput) ReportOffline(err error) {
+	o.flush()
+	if reporter, ok := o.out.(tui.ConnectivityReporter); ok {
+		reporter.ReportOffline(err)
+	}
+}
+
+// ReportOnline implements agent.ConnectivityReporter
+func (o *replOutput) ReportOnline() {
+	if reporter, ok := o.out.(tui.ConnectivityReporter); ok {
+		reporter.ReportOnline()
+	}
+}
+
+// ReportTruncation implements agent.TruncationReporter
+func (o *replOutput) ReportTruncation(reasons []string) {
+	o.flush()
+	if reporter, ok := o.out.(tui.TruncationReporter); ok {
+		reporter.ReportTruncation(reasons)
+	}
+}
+
+// approvalOptions are the answers to the approvals asked in the REPL
+var approvalOptions = []string{"yes", "no"}
+
+// replApprover approves the tool uses of the agent of a task allowed by the auto-approval
+// policy, and asks the user in the REPL for the others
+type replApprover struct {
+	policy agent.PolicyApprover
+	out    tui.HistoryWriter
+	// output is flushed before the user is asked, to show what the question is about
+	output *replOutput
+}
+
+// Approve implements agent.Approver
+func (a *replApprover) Approve(ctx context.Context, toolUse assistantmessage.ToolUse) (bool, error) {
+	if approved, err := a.policy.Approve(ctx, toolUse); err != nil || approved {
+		return approved, err
+	}
+	target := cmp.Or(toolUse.Params[assistantmessage.CommandParam], toolUse.Params[assistantmessage.PathParam])
+	if target == "" {
+		return a.confirm(ctx, fmt.Sprintf("Allow %s?", toolUse.Name))
+	}
+	return a.confirm(ctx, fmt.Sprintf("Allow %s on %s?", toolUse.Name, target))
+}
+
+// OverrideCommandPolicy implements agent.PolicyOverrider
+func (a *replApprover) OverrideCommandPolicy(ctx context.Context, command, rule string) (bool, error) {
+	return a.confirm(ctx, fmt.Sprintf("The command %s is blocked by the rule %q of the command policy. Run it anyway?", command, rule))
+}
+
+// ApproveShowcase implements agent.ShowcaseApprover
+func (a *replApprover) ApproveShowcase(ctx context.Context, result, command string) (bool, error) {
+	return a.confirm(ctx, fmt.Sprintf("Run `%s` to see the result?", command))
+}
+
+// AnswerQuestion implements agent.QuestionAnswerer
+func (a *replApprover) AnswerQuestion(ctx context.Context, question string, options []string) (string, error) {
+	asker, ok := a.out.(tui.QuestionAsker)
+	if !ok {
+		return "", agent.ErrNeedsInput
+	}
+	a.output.flush()
+	return asker.AskQuestion(ctx, question, options)
+}
+
+// confirm asks the user a yes or no question, denying when nobody can answer it
+func (a *replApprover) confirm(ctx context.Context, question string) (bool, error) {
+	asker, ok := a.out.(tui.QuestionAsker)
+	if !ok {
+		return false, nil
+	}
+	a.output.flush()
+	answer, err := asker.AskQuestion(ctx, question, approvalOptions)
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "yes" || answer == "y", nil
+}
@@ -0,0 +1,159 @@
+package subcmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/tui"
+)
+
+// replWriter records the history of a REPL task, answering the questions put to the user with answer
+type replWriter struct {
+	entries   []string
+	questions []string
+	answer    string
+}
+
+func (w *replWriter) AddUserInput(input string)       { w.entries = append(w.entries, input) }
+func (w *replWriter) AddAgentOutput(output string)    { w.entries = append(w.entries, output) }
+func (w *replWriter) AddSystemMessage(message string) { w.entries = append(w.entries, message) }
+
+func (w *replWriter) AskQuestion(ctx context.Context, question string, options []string) (string, error) {
+	w.questions = append(w.questions, question)
+	return w.answer, nil
+}
+
+func TestREPLRunnerAsksApproval(t *testing.T) {
+	for _, tt := range []struct {
+		answer  string
+		written bool
+	}{
+		{answer: "yes", written: true},
+		{answer: "no", written: false},
+	} {
+		t.Run(tt.answer, func(t *testing.T) {
+			workingDir := setupMockRun(t)
+			manager, err := loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner, err := newREPLRunner(manager, "20250101-120000-aaaa", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer runner.Close()
+
+			out := &replWriter{answer: tt.answer}
+			if err := runner.Run(context.Background(), "20250101-120000-aaaa", "create hello.txt", out); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if len(out.questions) != 1 || !strings.Contains(out.questions[0], "hello.txt") {
+				t.Errorf("questions = %q, want the approval of the edit of hello.txt", out.questions)
+			}
+			_, err = os.Stat(filepath.Join(workingDir, "hello.txt"))
+			if written := err == nil; written != tt.written {
+				t.Errorf("hello.txt written = %v, want %v (%v)", written, tt.written, err)
+			}
+			if !slices.Contains(out.entries, "Done") {
+				t.Errorf("history = %q, want the completion of the task", out.entries)
+			}
+		})
+	}
+}
+
+func TestREPLRunnerReadOnly(t *testing.T) {
+	workingDir := setupMockRun(t)
+	manager, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly, err := readOnlyPolicy(manager, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := newREPLRunner(manager, "20250101-120000-aaaa", nil, readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	// The edit is refused before the user is asked to approve it
+	out := &replWriter{answer: "yes"}
+	if err := runner.Run(context.Background(), "20250101-120000-aaaa", "create hello.txt", out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(out.questions) != 0 {
+		t.Errorf("questions = %q, want none", out.questions)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "hello.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("write_to_file ran in read-only mode: %v", err)
+	}
+}
+
+func TestREPLRunnerKeepsConversation(t *testing.T) {
+	setupMockRun(t)
+	manager, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := newREPLRunner(manager, "20250101-120000-aaaa", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	out := &replWriter{answer: "yes"}
+	if err := runner.Run(context.Background(), "20250101-120000-aaaa", "create hello.txt", out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	first := runner.tasks["20250101-120000-aaaa"]
+	// The second message goes on with the agent of the task, whose fixture has no response left
+	if err := runner.Run(context.Background(), "20250101-120000-aaaa", "thanks", out); err == nil || errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want the end of the fixture", err)
+	}
+	if runner.tasks["20250101-120000-aaaa"] != first {
+		t.Error("the second message of the task got another agent")
+	}
+}
+
+func TestREPLRunnerRetry(t *testing.T) {
+	setupMockRun(t)
+	fixture := "loop: true\nresponses:\n  - text: \"<attempt_completion>\\n<result>Done</result>\\n</attempt_completion>\"\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), "fixture.yaml"), []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := newREPLRunner(manager, "20250101-120000-aaaa", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	out := &replWriter{}
+	if err := runner.Retry(context.Background(), "20250101-120000-aaaa", tui.ModelChoice{}, out); err == nil {
+		t.Error("Retry() before the first message succeeded")
+	}
+	if err := runner.Run(context.Background(), "20250101-120000-aaaa", "explain main.go", out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if err := runner.Retry(context.Background(), "20250101-120000-aaaa", tui.ModelChoice{Provider: "mock"}, out); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	var completions int
+	for _, entry := range out.entries {
+		if entry == "Done" {
+			completions++
+		}
+	}
+	if completions != 2 {
+		t.Errorf("history = %q, want the completion of the regenerated answer", out.entries)
+	}
+}
@@ -0,0 +1,113 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/audit"
+	"github.com/kazz187/goline/internal/core/mentions"
+	"github.com/kazz187/goline/internal/core/review"
+)
+
+// ReviewOptions holds the options for the review command
+type ReviewOptions struct {
+	// Instructions are optional review instructions, mentions are expanded
+	Instructions string
+	// Staged reviews the staged changes instead of the working tree
+	Staged bool
+	// Ref reviews a branch or pull request ref instead of the working tree
+	Ref string
+	// JSON prints the findings as JSON
+	JSON bool
+	// FailOn is the severity at or above which the command fails, empty to never fail
+	FailOn string
+}
+
+// ErrReviewFindings is returned when the review has findings at or above the fail-on severity
+var ErrReviewFindings = errors.New("review found problems")
+
+// newReviewer creates the reviewer of the review command of the REPL, nil if no provider is
+// configured. The files included by the mentions of its instructions are recorded in the
+// outbound audit log of the task of the REPL.
+func newReviewer(manager *config.Manager, taskID string) *review.Reviewer {
+	p, err := newProvider(manager)
+	if err != nil {
+		slog.Warn("Reviews are not available", "error", err)
+		return nil
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		slog.Warn("Reviews are not available", "error", err)
+		return nil
+	}
+	outbound := manager.GetOutbound()
+	auditLog, err := audit.Open(taskID, outbound)
+	if err != nil {
+		slog.Warn("Reviews are not available", "error", err)
+		return nil
+	}
+	reviewer := review.NewReviewer(p, workingDir)
+	reviewer.SetMentionOptions(mentions.Options{DeniedPaths: outbound.DenyPaths, RecordFile: auditLog.RecordFile})
+	return reviewer
+}
+
+// Review asks the AI to critique a git diff without editing any file
+func Review(opts ReviewOptions) error {
+	var failOn review.Severity
+	if opts.FailOn != "" {
+		var err error
+		if failOn, err = review.ParseSeverity(opts.FailOn); err != nil {
+			return err
+		}
+	}
+
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(manager)
+	if err != nil {
+		return err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Stop the review on Ctrl+C or SIGTERM
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	if !opts.JSON {
+		fmt.Fprintln(os.Stderr, "Reviewing changes...")
+	}
+	source := review.Source{Staged: opts.Staged, Ref: opts.Ref}
+	reviewer := review.NewReviewer(p, workingDir)
+	reviewer.SetMentionOptions(mentions.Options{DeniedPaths: manager.GetOutbound().DenyPaths})
+	result, err := reviewer.Review(ctx, source, opts.Instructions)
+	if err != nil {
+		return err
+	}
+
+	// Print the findings
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to encode review result: %w", err)
+		}
+	} else {
+		fmt.Print(review.Format(result))
+	}
+
+	if failOn != "" && result.Count(failOn) > 0 {
+		return fmt.Errorf("%w: %d finding(s) with severity %s or higher", ErrReviewFindings, result.Count(failOn), failOn)
+	}
+	return nil
+}
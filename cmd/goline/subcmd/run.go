@@ -0,0 +1,540 @@
+package subcmd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/agent"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/audit"
+	"github.com/kazz187/goline/internal/core/bootstrap"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	"github.com/kazz187/goline/internal/core/conversation"
+	"github.com/kazz187/goline/internal/core/gitcommit"
+	"github.com/kazz187/goline/internal/core/hooks"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/core/recent"
+	"github.com/kazz187/goline/internal/core/stdin"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/core/templates"
+	"github.com/kazz187/goline/internal/metrics"
+	"github.com/kazz187/goline/internal/notify"
+	"github.com/kazz187/goline/internal/provider"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// Exit codes of the run command besides 0 for a completed task and 1 for an error
+const (
+	// ExitIncomplete is returned when the task stopped before it was completed,
+	// because the AI needed more input or a limit was reached
+	ExitIncomplete = 2
+	// ExitInterrupted is returned when the task was interrupted
+	ExitInterrupted = 130
+)
+
+// RunOptions holds the options for the run command
+type RunOptions struct {
+	// Prompt is the task, read from stdin if empty or "-"
+	Prompt string
+	// Approve lists the actions run without asking (read, edit, execute), in addition to
+	// those approved by the profile
+	Approve []string
+	// MaxTurns is the maximum number of AI responses
+	MaxTurns int
+	// Duration pauses the task for review once it has run that long, the configured one if zero
+	Duration time.Duration
+	// SummaryInterval is how often a progress summary is posted, the configured one if zero
+	SummaryInterval time.Duration
+	// TraceLLM records the requests sent to the providers and their raw responses in the task directory
+	TraceLLM bool
+	// Model is the model of the task, of another provider if prefixed with it, the configured one if empty
+	Model string
+	// Template is the task template of the task, bundling its first message, model, tools,
+	// auto-approvals and context
+	Template string
+	// ReadOnly disables the file edits, the plugins and the commands other than the safe read
+	// commands, to use the AI agent as a question and answer assistant on the codebase
+	ReadOnly bool
+}
+
+// Run runs a task without the REPL, streaming the output to stdout.
+// Tool uses that are not auto-approved are denied, as nobody can approve them.
+func Run(opts RunOptions) (err error) {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var template templates.Template
+	var prompt string
+	var mentioned []mentionedFile
+	if opts.Template != "" {
+		// The template has the task, the prompt argument and piped content are optional
+		if template, err = loadTemplate(opts.Template); err != nil {
+			return err
+		}
+		if prompt, err = templateMessage(template, opts.Prompt, mentionOptions(manager, &mentioned)); err != nil {
+			return err
+		}
+		piped, err := readPiped(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = stdin.Attach(prompt, piped)
+	} else if prompt, err = runPrompt(opts.Prompt, os.Stdin); err != nil {
+		return err
+	}
+
+	if opts.Model != "" {
+		if err := useModel(manager, opts.Model); err != nil {
+			return err
+		}
+	}
+	if err := applyTemplateModel(manager, template, opts.Model); err != nil {
+		return err
+	}
+	autoApprove := manager.GetEffectiveAutoApprove()
+	addTemplateApprovals(&autoApprove, template)
+	if err := addApprovals(&autoApprove, opts.Approve); err != nil {
+		return err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Create the task
+	taskID, err := taskstore.NewTaskID()
+	if err != nil {
+		return err
+	}
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return err
+	}
+
+	// The requests are recorded in the task directory
+	var trace *provider.TraceRecorder
+	if opts.TraceLLM {
+		trace = provider.NewTraceRecorder(store.TraceDir())
+	}
+	p, err := newProviderFor(manager, manager.GetEffectiveProvider(), manager.GetEffectiveModelName(), trace)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockTask(taskID)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	store.SetLock(lock)
+	if trace != nil {
+		fmt.Fprintf(os.Stderr, "Recording the provider requests in %s, view them with `goline trace show %s`\n", trace.Dir(), taskID)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	task := &pb.Task{
+		Id:               taskID,
+		State:            pb.TaskState_TASK_STATE_ACTIVE,
+		Provider:         p.Name(),
+		Model:            p.GetModel().Name,
+		InitialPrompt:    prompt,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		WorkingDirectory: workingDir,
+	}
+	detectWorkspace(workingDir).Record(task)
+	if err := store.SaveTask(task); err != nil {
+		return err
+	}
+	defer recoverTask(store, task, &err)
+
+	checkpoints := checkpoint.NewService()
+	checkpoints.SetLock(taskID, lock)
+	applier, err := apply.NewApplier(taskID, workingDir, checkpoints)
+	if err != nil {
+		return err
+	}
+	applier.SetLock(lock)
+
+	// Register the plugin tools before the system prompt documents the tools
+	pluginSet := loadPlugins(manager)
+
+	// Stop the task on Ctrl+C or SIGTERM, it is then paused to be resumed
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	rules, err := prompts.LoadUserRules(workingDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load user rules: %v\n", err)
+	}
+	semanticIndex := openTaskIndex(ctx, manager, workingDir)
+	promptOpts := prompts.SystemPromptOptions{
+		Cwd:              workingDir,
+		Mode:             prompts.ModeAct,
+		AutoApprove:      autoApprove,
+		UserRules:        rules,
+		Headless:         true,
+		CanDelegate:      true,
+		ResponseLanguage: manager.GetResponseLanguage(),
+		SemanticSearch:   semanticIndex != nil,
+		ContextRoots:     manager.GetContextRoots(),
+		Capabilities:     p.Capabilities(),
+	}
+	if promptOpts.Tools, err = templateTools(template, promptOpts); err != nil {
+		return err
+	}
+	systemPrompt := prompts.NewSystemPromptBuilder(p.Name()).Build(promptOpts)
+	delegation, err := newDelegation(manager, promptOpts, &childTasks{parent: task, parentStore: store}, trace)
+	if err != nil {
+		return err
+	}
+	summarizer, err := newSummarizer(manager, p, trace)
+	if err != nil {
+		return err
+	}
+
+	commandPolicy, err := cmdpolicy.New(manager.GetCommandPolicy())
+	if err != nil {
+		return err
+	}
+	readOnly, err := readOnlyPolicy(manager, opts.ReadOnly)
+	if err != nil {
+		return err
+	}
+	outbound := manager.GetOutbound()
+	auditLog, err := audit.Open(taskID, outbound)
+	if err != nil {
+		return err
+	}
+	for _, file := range mentioned {
+		auditLog.RecordFile(file.path, file.size)
+	}
+
+	metrics.TaskStarted()
+	defer metrics.TaskFinished()
+
+	var approver agent.Approver = agent.PolicyApprover{AutoApprove: autoApprove}
+	if len(promptOpts.Tools) > 0 {
+		approver = agent.RestrictTools(approver, promptOpts.Tools)
+	}
+
+	autonomy := manager.GetAutonomy()
+	fmt.Fprintf(os.Stderr, "Running task %s...\n", taskID)
+	if readOnly != nil {
+		fmt.Fprintln(os.Stderr, "Read-only mode: the AI agent can read the workspace but not modify it.")
+	}
+	a := agent.New(agent.Options{
+		TaskID:          taskID,
+		WorkingDir:      workingDir,
+		Provider:        p,
+		SystemPrompt:    systemPrompt,
+		Approver:        approver,
+		Applier:         applier,
+		Recorder:        taskstore.NewRecorder(store),
+		Output:          os.Stdout,
+		MaxTurns:        opts.MaxTurns,
+		Plugins:         pluginSet,
+		Hooks:           hooks.New(manager.GetHooks()),
+		Notifier:        notify.New(manager.GetNotifications()),
+		Delegation:      delegation,
+		TimeLimit:       cmp.Or(opts.Duration, autonomy.Duration),
+		SummaryInterval: cmp.Or(opts.SummaryInterval, autonomy.SummaryInterval),
+		Summarizer:      summarizer,
+		RecentFiles:     newRecentFiles(ctx, manager, workingDir),
+		Index:           semanticIndex,
+		ContextRoots:    promptOpts.ContextRoots,
+		CommandPolicy:   commandPolicy,
+		ReadOnly:        readOnly,
+		DeniedPaths:     outbound.DenyPaths,
+		Audit:           auditLog,
+		AutoFixAttempts: autoFixAttempts(manager),
+		MaxMistakes:     autonomy.MaxMistakes,
+	})
+	// The workspace context is sent with the first message but not stored as the prompt of the task
+	result, runErr := a.Run(ctx, bootstrap.Attach(prompt, workspaceContext(ctx, manager, workingDir)))
+
+	// Save the outcome, an incomplete task can be resumed
+	if runErr != nil && ctx.Err() != nil {
+		pauseTask(store, task, "interrupted")
+	} else {
+		task.State = pb.TaskState_TASK_STATE_COMPLETED
+		if runErr != nil {
+			task.State = pb.TaskState_TASK_STATE_PAUSED
+		}
+		task.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := store.SaveTask(task); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save task: %v\n", err)
+		}
+	}
+
+	if result != nil {
+		if result.Completion != "" {
+			fmt.Printf("\n%s\n", result.Completion)
+			if result.Command != "" && !result.CommandRun {
+				fmt.Printf("\nRun `%s` to see the result.\n", result.Command)
+			}
+		}
+		if result.Question != "" {
+			fmt.Printf("\nThe AI asked: %s\n", result.Question)
+			for i, option := range result.Options {
+				fmt.Printf("  %d. %s\n", i+1, option)
+			}
+		}
+		if errors.Is(runErr, agent.ErrTimeLimit) {
+			fmt.Printf("\nTask %s was paused for review at the end of its time box, resume it with `goline resume %s`.\n", taskID, taskID)
+		}
+		fmt.Fprintf(os.Stderr, "Task %s: %d turn(s), %d input and %d output tokens, $%.4f\n",
+			taskID, result.Turns, result.Usage.InputTokens, result.Usage.OutputTokens, result.Usage.TotalCost)
+	}
+	if runErr == nil && manager.GetGit().AutoCommit {
+		if err := commitTask(ctx, gitcommit.NewCommitter(p, workingDir), taskID, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to commit the changes of the task: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", errInterrupted, ctx.Err())
+	}
+	return runErr
+}
+
+// readOnlyPolicy compiles the commands allowed in read-only mode, nil when it is not enabled
+func readOnlyPolicy(manager *config.Manager, enabled bool) (*cmdpolicy.ReadOnly, error) {
+	if !enabled {
+		return nil, nil
+	}
+	return cmdpolicy.NewReadOnly(manager.GetCommandPolicy().ReadOnly)
+}
+
+// newSummarizer creates the summarizer keeping the conversation within the context window,
+// nil if the summaries are disabled. The summaries are written by the task's provider unless
+// a summarization profile is configured. The requests of the summaries are recorded by trace unless it is nil.
+func newSummarizer(manager *config.Manager, taskProvider provider.Provider, trace *provider.TraceRecorder) (*conversation.Summarizer, error) {
+	cfg := manager.GetSummarization()
+	if cfg.Disabled {
+		return nil, nil
+	}
+	summarizer := &conversation.Summarizer{
+		Provider:  taskProvider,
+		Threshold: cfg.Threshold,
+		KeepTurns: cfg.KeepTurns,
+	}
+	if cfg.Profile != "" {
+		if _, ok := manager.GetProfile(cfg.Profile); !ok {
+			return nil, fmt.Errorf("summarization profile %s not found", cfg.Profile)
+		}
+		name, modelName := manager.GetSummarizationModel()
+		p, err := newProviderFor(manager, name, modelName, trace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the provider of summaries: %w", err)
+		}
+		summarizer.Provider = p
+	}
+	return summarizer, nil
+}
+
+// newRecentFiles creates the tracker of the recently relevant files, nil if they are disabled.
+// With git enabled, the files changed per git are listed from the start.
+func newRecentFiles(ctx context.Context, manager *config.Manager, workingDir string) *recent.Tracker {
+	cfg := manager.GetRecentFiles()
+	if cfg.Disabled {
+		return nil
+	}
+	tracker := recent.NewTracker(cfg.Limit)
+	if cfg.Git {
+		changes, err := recent.GitChanges(ctx, workingDir, cfg.GitCommits)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list the files changed per git: %v\n", err)
+		}
+		tracker.AddGitChanges(changes)
+	}
+	return tracker
+}
+
+// autoFixAttempts returns the configured number of attempts to fix a failure before the user is
+// asked, zero when auto-fix is disabled
+func autoFixAttempts(manager *config.Manager) int {
+	cfg := manager.GetAutoFix()
+	if cfg.Disabled {
+		return 0
+	}
+	return cmp.Or(cfg.MaxAttempts, agent.DefaultAutoFixAttempts)
+}
+
+// workspaceContext gathers the workspace context added to the first message of a new task,
+// empty if it is disabled or cannot be gathered
+func workspaceContext(ctx context.Context, manager *config.Manager, workingDir string) string {
+	cfg := manager.GetBootstrap()
+	if cfg.Disabled {
+		return ""
+	}
+	snapshot, err := bootstrap.Gather(ctx, workingDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to gather the workspace context: %v\n", err)
+		return ""
+	}
+	return snapshot.Format(cfg.MaxBytes)
+}
+
+// newDelegation configures the child tasks of a task, run with the model of the delegation profile if one is set.
+// The requests of the child tasks are recorded by trace unless it is nil.
+func newDelegation(manager *config.Manager, parentOpts prompts.SystemPromptOptions, store agent.ChildStore, trace *provider.TraceRecorder) (*agent.Delegation, error) {
+	cfg := manager.GetDelegation()
+	delegation := &agent.Delegation{
+		Tools:    prompts.EnabledTools(parentOpts),
+		MaxTurns: cfg.MaxTurns,
+		Store:    store,
+	}
+	if cfg.Profile != "" {
+		if _, ok := manager.GetProfile(cfg.Profile); !ok {
+			return nil, fmt.Errorf("delegation profile %s not found", cfg.Profile)
+		}
+		name, modelName := manager.GetDelegationModel()
+		p, err := newProviderFor(manager, name, modelName, trace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the provider of child tasks: %w", err)
+		}
+		delegation.Provider = p
+	}
+
+	providerName, capabilities := manager.GetEffectiveProvider(), parentOpts.Capabilities
+	if delegation.Provider != nil {
+		providerName, capabilities = delegation.Provider.Name(), delegation.Provider.Capabilities()
+	}
+	delegation.SystemPrompt = func(tools []assistantmessage.ToolUseName) string {
+		opts := parentOpts
+		opts.CanDelegate = false
+		opts.Tools = tools
+		opts.Capabilities = capabilities
+		return prompts.NewSystemPromptBuilder(providerName).Build(opts)
+	}
+	return delegation, nil
+}
+
+// childTasks stores the child tasks delegated by a task and links them to it
+type childTasks struct {
+	parent      *pb.Task
+	parentStore *taskstore.Store
+	stores      map[string]*taskstore.Store
+}
+
+// Create implements agent.ChildStore
+func (c *childTasks) Create(child *pb.Task) (*taskstore.Recorder, error) {
+	child.WorkspaceRoot, child.RepositoryUrl = c.parent.WorkspaceRoot, c.parent.RepositoryUrl
+	store, err := taskstore.NewStore(child.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.SaveTask(child); err != nil {
+		return nil, err
+	}
+	if c.stores == nil {
+		c.stores = make(map[string]*taskstore.Store)
+	}
+	c.stores[child.Id] = store
+
+	c.parent.ChildTaskIds = append(c.parent.ChildTaskIds, child.Id)
+	c.parent.UpdatedAt = child.CreatedAt
+	if err := c.parentStore.SaveTask(c.parent); err != nil {
+		return nil, err
+	}
+	return taskstore.NewRecorder(store), nil
+}
+
+// Finish implements agent.ChildStore
+func (c *childTasks) Finish(child *pb.Task) error {
+	store, ok := c.stores[child.Id]
+	if !ok {
+		return fmt.Errorf("unknown child task %s", child.Id)
+	}
+	return store.SaveTask(child)
+}
+
+// errInterrupted is returned when the task was interrupted with Ctrl+C
+var errInterrupted = errors.New("task interrupted")
+
+// ExitCode returns the exit code of the process for an error returned by a command
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errInterrupted):
+		return ExitInterrupted
+	case errors.Is(err, agent.ErrNeedsInput), errors.Is(err, agent.ErrTurnLimit), errors.Is(err, agent.ErrTimeLimit), errors.Is(err, agent.ErrNoToolUse):
+		return ExitIncomplete
+	default:
+		return 1
+	}
+}
+
+// runPrompt returns the prompt given as an argument with the content piped to stdin
+// attached as context, or reads the whole prompt from stdin
+func runPrompt(arg string, in *os.File) (string, error) {
+	if arg != "" && arg != "-" {
+		piped, err := readPiped(in)
+		if err != nil {
+			return "", err
+		}
+		return stdin.Attach(arg, piped), nil
+	}
+
+	// Refuse to wait for a prompt typed on a terminal, scripts pipe it in
+	if isTerminal(in) {
+		return "", errors.New("no prompt given, pass it as an argument or pipe it to stdin")
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt from stdin: %w", err)
+	}
+	prompt := strings.TrimSpace(string(data))
+	if prompt == "" {
+		return "", errors.New("the prompt read from stdin is empty")
+	}
+	return prompt, nil
+}
+
+// readPiped reads the content piped to stdin, or returns nil when stdin is a terminal or empty
+func readPiped(in *os.File) (*stdin.Input, error) {
+	if !stdin.Piped(in) {
+		return nil, nil
+	}
+	piped, err := stdin.Read(in, stdin.DefaultMaxBytes)
+	if err != nil || piped == nil {
+		return nil, err
+	}
+	switch {
+	case piped.Binary:
+		fmt.Fprintf(os.Stderr, "Warning: stdin looks binary, its %d bytes are omitted\n", piped.Size)
+	case piped.Truncated:
+		fmt.Fprintf(os.Stderr, "Warning: stdin is %d bytes, only its start and end are attached\n", piped.Size)
+	}
+	return piped, nil
+}
+
+// addApprovals adds the actions named on the command line to an auto-approval policy
+func addApprovals(autoApprove *config.AutoApprove, actions []string) error {
+	for _, action := range actions {
+		switch action {
+		case "read":
+			autoApprove.ReadFiles = true
+		case "edit":
+			autoApprove.EditFiles = true
+		case "execute":
+			autoApprove.ExecuteCommands = true
+		default:
+			return fmt.Errorf("unknown action to approve %q, expected read, edit or execute", action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package subcmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixture is a mock provider fixture creating hello.txt then completing the task
+const writeFixture = `responses:
+  - text: "<write_to_file>\n<path>hello.txt</path>\n<content>hello\n</content>\n</write_to_file>"
+  - text: "<attempt_completion>\n<result>Done</result>\n</attempt_completion>"
+`
+
+// setupMockRun configures the mock provider replaying writeFixture in a temporary home and
+// changes to a temporary working directory, which it returns
+func setupMockRun(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	fixture := filepath.Join(home, "fixture.yaml")
+	if err := os.WriteFile(fixture, []byte(writeFixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := "providers:\n  mock:\n    api_key: test\n    endpoint: " + fixture + "\ndefault_provider: mock\n"
+	if err := os.MkdirAll(filepath.Join(home, ".goline"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".goline", "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingDir := t.TempDir()
+	t.Chdir(workingDir)
+	return workingDir
+}
+
+func TestRunReadOnly(t *testing.T) {
+	workingDir := setupMockRun(t)
+	if err := Run(RunOptions{Prompt: "create hello.txt", Approve: []string{"edit"}, ReadOnly: true}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "hello.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("write_to_file ran in read-only mode: %v", err)
+	}
+
+	// The same task writes the file without read-only mode
+	if err := Run(RunOptions{Prompt: "create hello.txt", Approve: []string{"edit"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "hello.txt")); err != nil {
+		t.Errorf("write_to_file did not run: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/kazz187/goline/internal/server"
+)
+
+// Serve serves the Goline gRPC API on the given address until interrupted.
+// If metricsAddr is not empty, Prometheus metrics are served on it as well.
+func Serve(addr, metricsAddr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	var metricsListener net.Listener
+	if metricsAddr != "" {
+		metricsListener, err = net.Listen("tcp", metricsAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", metricsAddr, err)
+		}
+	}
+
+	// Stop serving on Ctrl+C or SIGTERM
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	// Stop both servers when either fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	servers := []func() error{func() error { return server.Serve(ctx, listener) }}
+	fmt.Fprintf(os.Stderr, "Serving the Goline API on %s (press Ctrl+C to stop)...\n", listener.Addr())
+	if metricsListener != nil {
+		fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", metricsListener.Addr())
+		servers = append(servers, func() error { return server.ServeMetrics(ctx, metricsListener) })
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, serve := range servers {
+		go func() {
+			err := serve()
+			cancel()
+			errCh <- err
+		}()
+	}
+	var firstErr error
+	for range servers {
+		if err := <-errCh; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
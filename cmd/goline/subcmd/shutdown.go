@@ -0,0 +1,63 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// shutdownSignals are the signals stopping a command gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// shutdownContext returns a context cancelled on Ctrl+C or SIGTERM, so that the agent loop,
+// the provider requests and the commands stop and the command saves its state. Only the first
+// signal is caught: a second Ctrl+C kills the process at once if stopping hangs.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			fmt.Fprintln(os.Stderr, "\nStopping... press Ctrl+C again to quit at once")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// pauseTask saves a task that was stopped before its end as paused and prints the command
+// resuming it
+func pauseTask(store *taskstore.Store, task *pb.Task, reason string) {
+	task.State = pb.TaskState_TASK_STATE_PAUSED
+	task.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := store.SaveTask(task); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save task: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Task %s was %s, resume it with `goline resume %s`.\n", task.Id, reason, task.Id)
+}
+
+// recoverTask recovers from a panic while running a task: the task is paused so that it can
+// be resumed, and the panic is returned as the error of the command. It must be deferred.
+func recoverTask(store *taskstore.Store, task *pb.Task, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	slog.Error("Task panicked", "task", task.Id, "panic", v, "stack", string(debug.Stack()))
+	pauseTask(store, task, "stopped by a crash")
+	*err = fmt.Errorf("task %s crashed: %v", task.Id, v)
+}
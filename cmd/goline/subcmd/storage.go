@@ -0,0 +1,190 @@
+package subcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+)
+
+// StorageOptions are the options of the storage command
+type StorageOptions struct {
+	// Prune deletes the tasks suggested to get under the quota
+	Prune bool
+}
+
+// Storage prints the disk space used by every task and, when the configured quota is
+// exceeded, the tasks to delete to get under it
+func Storage(opts StorageOptions) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	quota, err := manager.GetStorageQuota()
+	if err != nil {
+		return err
+	}
+	tasksDir, err := tasksDir()
+	if err != nil {
+		return err
+	}
+	usages, err := taskstore.ScanUsage(tasksDir)
+	if err != nil {
+		return err
+	}
+
+	printUsage(os.Stdout, usages)
+	if quota <= 0 {
+		fmt.Println("No storage quota configured, set storage.quota in the config (e.g. 20GB) to get pruning suggestions.")
+		return nil
+	}
+
+	total := totalUsage(usages)
+	if total <= quota {
+		fmt.Printf("Quota: %s, %s available\n", formatSize(quota), formatSize(quota-total))
+		return nil
+	}
+	suggested := taskstore.SuggestPrune(usages, quota, nil)
+	fmt.Printf("Quota: %s, exceeded by %s\n\n", formatSize(quota), formatSize(total-quota))
+	fmt.Println("Deleting these tasks, least recently used first, gets under the quota:")
+	for _, u := range suggested {
+		fmt.Printf("  %s  %s  last used %s\n", u.TaskID, formatSize(u.Total()), u.LastModified.Local().Format(time.DateTime))
+	}
+	if !opts.Prune {
+		fmt.Println("\nRun `goline storage --prune` to delete them.")
+		return nil
+	}
+
+	fmt.Println()
+	return pruneTasks(tasksDir, suggested)
+}
+
+// pruneTasks deletes tasks, skipping those in use by another process
+func pruneTasks(tasksDir string, usages []taskstore.Usage) error {
+	var freed int64
+	var errs []error
+	for _, u := range usages {
+		lock, err := tasklock.Acquire(filepath.Join(tasksDir, u.TaskID))
+		if err != nil {
+			if errors.Is(err, tasklock.ErrHeld) {
+				fmt.Printf("Skipped %s: %v\n", u.TaskID, err)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("failed to lock task %s: %w", u.TaskID, err))
+			continue
+		}
+		// The task is deleted under its lock, so that no process opens it meanwhile. The lock
+		// file is deleted with the task directory, releasing it afterwards does nothing.
+		err = taskstore.NewStoreInDir(tasksDir, u.TaskID).Remove()
+		lock.Release()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete task %s: %w", u.TaskID, err))
+			continue
+		}
+		freed += u.Total()
+		fmt.Printf("Deleted %s\n", u.TaskID)
+	}
+	fmt.Printf("Freed %s\n", formatSize(freed))
+	return errors.Join(errs...)
+}
+
+// StartStorageNotice measures the disk space used by the tasks in the background when a quota
+// is configured and returns a function printing a notice if the quota is exceeded. The
+// function prints nothing if the measurement has not finished yet.
+func StartStorageNotice() func() {
+	if !isTerminal(os.Stderr) {
+		return func() {}
+	}
+	manager, err := loadConfig()
+	if err != nil {
+		return func() {}
+	}
+	quota, err := manager.GetStorageQuota()
+	if err != nil || quota <= 0 {
+		return func() {}
+	}
+	tasksDir, err := tasksDir()
+	if err != nil {
+		return func() {}
+	}
+
+	used := make(chan int64, 1)
+	go func() {
+		// The notice is best effort, a failed scan is silently retried on the next run
+		usages, _ := taskstore.ScanUsage(tasksDir)
+		used <- totalUsage(usages)
+	}()
+
+	return func() {
+		select {
+		case total := <-used:
+			if total > quota {
+				fmt.Fprintf(os.Stderr, "\nTasks use %s, over the storage quota of %s.\nRun `goline storage` to see which tasks to delete.\n", formatSize(total), formatSize(quota))
+			}
+		default:
+		}
+	}
+}
+
+// printUsage prints the disk space used by each task and the totals
+func printUsage(out io.Writer, usages []taskstore.Usage) {
+	if len(usages) == 0 {
+		fmt.Fprintln(out, "No tasks stored")
+		return
+	}
+
+	var total taskstore.Usage
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tCHECKPOINTS\tTRANSCRIPT\tOTHER\tTOTAL\tLAST USED")
+	for _, u := range usages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.TaskID, formatSize(u.Checkpoints), formatSize(u.Transcript),
+			formatSize(u.Other), formatSize(u.Total()), u.LastModified.Local().Format(time.DateTime))
+		total.Checkpoints += u.Checkpoints
+		total.Transcript += u.Transcript
+		total.Other += u.Other
+	}
+	fmt.Fprintf(w, "%d task(s)\t%s\t%s\t%s\t%s\n", len(usages), formatSize(total.Checkpoints), formatSize(total.Transcript),
+		formatSize(total.Other), formatSize(total.Total()))
+	w.Flush()
+	fmt.Fprintln(out)
+}
+
+// totalUsage returns the disk space used by all tasks
+func totalUsage(usages []taskstore.Usage) int64 {
+	var total int64
+	for _, u := range usages {
+		total += u.Total()
+	}
+	return total
+}
+
+// tasksDir returns the directory the tasks are stored in
+func tasksDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".goline", "tasks"), nil
+}
+
+// formatSize formats a size in bytes with a unit, in powers of 1024 as storage.quota
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TB", value)
+}
@@ -0,0 +1,38 @@
+package subcmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+)
+
+func TestPruneTasks(t *testing.T) {
+	tasksDir := t.TempDir()
+	for _, taskID := range []string{"idle", "busy"} {
+		if err := os.MkdirAll(filepath.Join(tasksDir, taskID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tasksDir, taskID+".pb"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	held, err := tasklock.Acquire(filepath.Join(tasksDir, "busy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	if err := pruneTasks(tasksDir, []taskstore.Usage{{TaskID: "idle"}, {TaskID: "busy"}}); err != nil {
+		t.Fatalf("pruneTasks() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tasksDir, "idle")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the idle task was not deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tasksDir, "busy.pb")); err != nil {
+		t.Errorf("the task held by another process was deleted: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package subcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/taskdb"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/core/workspace"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// promptColumnRunes is the width of the prompts shown in the task list
+const promptColumnRunes = 60
+
+// openCatalog opens the catalog of the tasks configured by storage.backend
+func openCatalog(manager *config.Manager) (taskstore.Catalog, error) {
+	dir, err := tasksDir()
+	if err != nil {
+		return nil, err
+	}
+	switch backend := manager.GetStorage().Backend; backend {
+	case "", "files":
+		return taskstore.NewFileCatalog(dir), nil
+	case "sqlite":
+		return taskdb.Open(filepath.Join(filepath.Dir(dir), "tasks.db"), dir)
+	default:
+		return nil, fmt.Errorf("unknown storage.backend %q, expected files or sqlite", backend)
+	}
+}
+
+// ListTasks lists the tasks of the workspace of the current directory, or of every workspace
+// if all is set, the most recently updated first
+func ListTasks(all bool) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	catalog, err := openCatalog(manager)
+	if err != nil {
+		return err
+	}
+	defer catalog.Close()
+
+	tasks, err := catalog.Tasks()
+	if err != nil {
+		return err
+	}
+	if all {
+		printTasks(os.Stdout, tasks, true)
+		return nil
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	current := detectWorkspace(workingDir)
+	tasks = slices.DeleteFunc(tasks, func(task *pb.Task) bool { return !current.Contains(task) })
+	if len(tasks) == 0 {
+		fmt.Printf("No tasks in %s, list the tasks of every workspace with --all\n", current.Root)
+		return nil
+	}
+	printTasks(os.Stdout, tasks, false)
+	return nil
+}
+
+// printTasks prints the ID, state, last update and prompt of tasks, and their workspace if
+// withWorkspace is set
+func printTasks(out io.Writer, tasks []*pb.Task, withWorkspace bool) {
+	if len(tasks) == 0 {
+		fmt.Fprintln(out, "No tasks stored")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "ID\tSTATE\tUPDATED\tPROMPT"
+	if withWorkspace {
+		header += "\tWORKSPACE"
+	}
+	fmt.Fprintln(w, header)
+	for _, task := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s", task.Id, stateLabel(task.State), formatTimestamp(task.UpdatedAt), shorten(task.InitialPrompt, promptColumnRunes))
+		if withWorkspace {
+			fmt.Fprintf(w, "\t%s", workspace.Of(task).Root)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// detectWorkspace returns the workspace of a working directory, the directory itself if its
+// repository cannot be read
+func detectWorkspace(workingDir string) workspace.Workspace {
+	w, err := workspace.Detect(workingDir)
+	if err != nil {
+		slog.Warn("Failed to detect the workspace", "error", err)
+		return workspace.Workspace{Root: workingDir}
+	}
+	return w
+}
+
+// checkWorkspace returns an error if a task belongs to another workspace than the working
+// directory, unless ignore is set. Tasks without stored metadata are not checked.
+func checkWorkspace(taskID, workingDir string, ignore bool) error {
+	store, err := taskstore.NewStore(taskID)
+	if err != nil {
+		return err
+	}
+	task, err := store.LoadTask()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	current := detectWorkspace(workingDir)
+	own := workspace.Of(task)
+	if own.Root == "" || current.Contains(task) {
+		return nil
+	}
+	if ignore {
+		fmt.Fprintf(os.Stderr, "Warning: task %s belongs to %s, resuming it in %s\n", taskID, own.Root, current.Root)
+		return nil
+	}
+	return fmt.Errorf("task %s belongs to %s, not %s: resume it from there, or pass --ignore-workspace to resume it here", taskID, own.Root, current.Root)
+}
+
+// SearchOptions are the options of the search command
+type SearchOptions struct {
+	// Query is the words to search for
+	Query string
+	// Limit is the maximum number of matches shown
+	Limit int
+}
+
+// Search searches the transcripts of the tasks and prints the matching events, the best
+// matches first
+func Search(opts SearchOptions) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	catalog, err := openCatalog(manager)
+	if err != nil {
+		return err
+	}
+	defer catalog.Close()
+
+	matches, err := catalog.Search(opts.Query, opts.Limit)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Printf("No task transcript matches %q\n", opts.Query)
+		return nil
+	}
+	for _, m := range matches {
+		fmt.Printf("%s  %s  %s\n  %s\n", m.Task.Id, formatTimestamp(m.Timestamp), m.Kind, m.Snippet)
+	}
+	return nil
+}
+
+// stateLabel returns the name of a task state, e.g. paused
+func stateLabel(state pb.TaskState) string {
+	return strings.ToLower(strings.TrimPrefix(state.String(), "TASK_STATE_"))
+}
+
+// formatTimestamp formats an RFC 3339 timestamp in the local time, or returns it as is if it
+// cannot be parsed
+func formatTimestamp(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// shorten returns the first line of text, cut to maxRunes runes
+func shorten(text string, maxRunes int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if runes := []rune(line); len(runes) > maxRunes {
+		return string(runes[:maxRunes-3]) + "..."
+	}
+	return line
+}
@@ -0,0 +1,128 @@
+package subcmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/mentions"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/core/templates"
+)
+
+// alwaysAllowedTools are the tools a task started from a template can use whatever its tools,
+// to ask the user and to finish
+var alwaysAllowedTools = []assistantmessage.ToolUseName{
+	assistantmessage.AskFollowupQuestionToolName,
+	assistantmessage.AttemptCompletionToolName,
+}
+
+// loadTemplate loads a task template of the repository or of ~/.goline/templates
+func loadTemplate(name string) (templates.Template, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return templates.Template{}, fmt.Errorf("failed to get current directory: %w", err)
+	}
+	store := templates.OpenDefault(workingDir)
+	template, err := store.Get(name)
+	if errors.Is(err, templates.ErrNotFound) {
+		list, _ := store.List()
+		names := make([]string, len(list))
+		for i, available := range list {
+			names[i] = available.Name
+		}
+		if len(names) == 0 {
+			return templates.Template{}, fmt.Errorf("%w, add it to .goline/templates/%s.yaml", err, name)
+		}
+		return templates.Template{}, fmt.Errorf("%w, available templates: %s", err, strings.Join(names, ", "))
+	}
+	return template, err
+}
+
+// templateMessage builds the first message of a task started from a template, with the content
+// of the mentioned files and folders allowed by opts
+func templateMessage(template templates.Template, prompt string, opts mentions.Options) (string, error) {
+	message := template.FirstMessage(prompt)
+	if len(template.Mentions) == 0 {
+		return message, nil
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return mentions.ReplaceMentionsWithContent(message, workingDir, opts)
+}
+
+// mentionedFile is a file whose content a mention included in the first message of a task
+type mentionedFile struct {
+	path string
+	size int
+}
+
+// mentionOptions returns the options of the mentions of the first message of a task, which
+// leave out the paths denied by the outbound policy and collect the files included in files,
+// to record them in the audit log of the task once it has one
+func mentionOptions(manager *config.Manager, files *[]mentionedFile) mentions.Options {
+	return mentions.Options{
+		DeniedPaths: manager.GetOutbound().DenyPaths,
+		RecordFile: func(path string, size int) {
+			*files = append(*files, mentionedFile{path: path, size: size})
+		},
+	}
+}
+
+// applyTemplateModel selects the model of a template, unless the model was given with --model
+func applyTemplateModel(manager *config.Manager, template templates.Template, model string) error {
+	if model != "" || template.Model == "" {
+		return nil
+	}
+	if err := useModel(manager, template.Model); err != nil {
+		return fmt.Errorf("model of task template %s: %w", template.Name, err)
+	}
+	return nil
+}
+
+// addTemplateApprovals adds the auto-approvals of a template to those of the profile
+func addTemplateApprovals(autoApprove *config.AutoApprove, template templates.Template) {
+	autoApprove.ReadFiles = autoApprove.ReadFiles || template.AutoApprove.ReadFiles
+	autoApprove.EditFiles = autoApprove.EditFiles || template.AutoApprove.EditFiles
+	autoApprove.ExecuteCommands = autoApprove.ExecuteCommands || template.AutoApprove.ExecuteCommands
+}
+
+// templateTools returns the tools of a template checked against those available to the task,
+// nil if the template does not restrict them
+func templateTools(template templates.Template, opts prompts.SystemPromptOptions) ([]assistantmessage.ToolUseName, error) {
+	if len(template.Tools) == 0 {
+		return nil, nil
+	}
+	available := prompts.EnabledTools(opts)
+	tools := slices.Clone(alwaysAllowedTools)
+	for _, name := range template.Tools {
+		tool := assistantmessage.ToolUseName(strings.TrimSpace(name))
+		if !slices.Contains(available, tool) {
+			return nil, fmt.Errorf("unknown tool %q in task template %s", name, template.Name)
+		}
+		if !slices.Contains(tools, tool) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools, nil
+}
+
+// CompleteTemplates lists the task templates, to complete the --template flags
+func CompleteTemplates() []string {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	list, _ := templates.OpenDefault(workingDir).List()
+	names := make([]string, len(list))
+	for i, template := range list {
+		names[i] = template.Name
+	}
+	return names
+}
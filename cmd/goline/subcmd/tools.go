@@ -0,0 +1,45 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+)
+
+// Tools prints the schema of every tool the agent can use, including the plugin tools
+func Tools(jsonOutput bool) error {
+	if manager, err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: plugin tools are not listed: %v\n", err)
+	} else {
+		loadPlugins(manager)
+	}
+	schemas := assistantmessage.ToolSchemas()
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(schemas); err != nil {
+			return fmt.Errorf("failed to encode tool schemas: %w", err)
+		}
+		return nil
+	}
+
+	for _, schema := range schemas {
+		if assistantmessage.IsBuiltinTool(schema.Name) {
+			fmt.Printf("%s\n  %s\n", schema.Name, schema.Description)
+		} else {
+			fmt.Printf("%s (plugin)\n  %s\n", schema.Name, schema.Description)
+		}
+		for _, param := range schema.Parameters {
+			requirement := "optional"
+			if param.Required {
+				requirement = "required"
+			}
+			fmt.Printf("  - %s (%s, %s): %s\n", param.Name, param.Type, requirement, param.Description)
+		}
+		fmt.Println()
+	}
+	return nil
+}
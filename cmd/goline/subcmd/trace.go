@@ -0,0 +1,111 @@
+package subcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// TraceOptions are the options of the trace show command
+type TraceOptions struct {
+	// TaskID is the task whose provider requests are shown
+	TaskID string
+	// Request is the number of the request shown in full, 0 to list the requests
+	Request int
+}
+
+// ShowTrace prints the provider requests recorded with run --trace-llm: the list of the
+// requests, or one request with its payload and raw response
+func ShowTrace(opts TraceOptions) error {
+	store, err := taskstore.NewStore(opts.TaskID)
+	if err != nil {
+		return err
+	}
+	entries, err := provider.ReadTrace(store.TraceDir())
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return fmt.Errorf("no provider requests recorded for task %s, run tasks with `goline run --trace-llm` to record them", opts.TaskID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Request == 0 {
+		printTraceList(os.Stdout, entries)
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.Sequence == opts.Request {
+			printTraceEntry(os.Stdout, entry)
+			return nil
+		}
+	}
+	return fmt.Errorf("request %d not found in the trace of task %s, it has %d request(s)", opts.Request, opts.TaskID, len(entries))
+}
+
+// printTraceList prints one line per recorded request
+func printTraceList(out io.Writer, entries []provider.TraceEntry) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTIME\tSTATUS\tDURATION\tREQUEST\tRESPONSE\tURL")
+	for _, entry := range entries {
+		status := fmt.Sprint(entry.Status)
+		if entry.Error != "" {
+			status = "error"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s %s\n", entry.Sequence, entry.Time.Local().Format(time.DateTime), status,
+			entry.Duration.Round(time.Millisecond), formatSize(int64(len(entry.RequestBody))), formatSize(int64(len(entry.ResponseBody))),
+			entry.Method, entry.URL)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nShow a request with its payload and raw response with `goline trace show <taskID> <#>`.")
+}
+
+// printTraceEntry prints a recorded request with its indented payload, then its raw response
+func printTraceEntry(out io.Writer, entry provider.TraceEntry) {
+	fmt.Fprintf(out, "Request %d sent %s\n%s %s\n", entry.Sequence, entry.Time.Local().Format(time.DateTime), entry.Method, entry.URL)
+	printTraceHeaders(out, entry.RequestHeaders)
+	if entry.RequestBody != "" {
+		var indented bytes.Buffer
+		if json.Indent(&indented, []byte(entry.RequestBody), "", "  ") == nil {
+			fmt.Fprintf(out, "\n%s\n", indented.String())
+		} else {
+			fmt.Fprintf(out, "\n%s\n", entry.RequestBody)
+		}
+	}
+
+	fmt.Fprintln(out)
+	if entry.Status != 0 {
+		fmt.Fprintf(out, "Response %d %s after %s\n", entry.Status, http.StatusText(entry.Status), entry.Duration.Round(time.Millisecond))
+		printTraceHeaders(out, entry.ResponseHeaders)
+		fmt.Fprintf(out, "\n%s", entry.ResponseBody)
+		if len(entry.ResponseBody) > 0 && entry.ResponseBody[len(entry.ResponseBody)-1] != '\n' {
+			fmt.Fprintln(out)
+		}
+	}
+	if entry.Error != "" {
+		fmt.Fprintf(out, "Error after %s: %s\n", entry.Duration.Round(time.Millisecond), entry.Error)
+	}
+}
+
+// printTraceHeaders prints headers sorted by name
+func printTraceHeaders(out io.Writer, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(out, "%s: %s\n", name, value)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package subcmd
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/tracing"
+)
+
+// tracingFlushTimeout bounds how long exiting waits for the pending traces to be exported
+const tracingFlushTimeout = 5 * time.Second
+
+// StartTracing exports traces when tracing is configured.
+// It returns a function flushing the pending traces, to be called before exiting.
+func StartTracing(version string) func() {
+	// A broken configuration is reported by the command itself
+	var cfg config.Tracing
+	if manager, err := loadConfig(); err == nil {
+		cfg = manager.GetTracing()
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), cfg, version)
+	if err != nil {
+		slog.Warn("Tracing is disabled", "error", err)
+		return func() {}
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to export traces", "error", err)
+		}
+	}
+}
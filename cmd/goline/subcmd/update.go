@@ -0,0 +1,122 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kazz187/goline/internal/update"
+)
+
+// updateNoticeTimeout bounds the release check made for the new version notice
+const updateNoticeTimeout = 3 * time.Second
+
+// SelfUpdateOptions holds the options for the self-update command
+type SelfUpdateOptions struct {
+	// Version is the running version
+	Version string
+	// Channel is the release channel, the configured one if empty
+	Channel string
+	// Check only reports whether a new version is available
+	Check bool
+}
+
+// SelfUpdate replaces the running binary with the newest release of the channel.
+// Binaries installed by Homebrew or Scoop are left to the package manager.
+func SelfUpdate(opts SelfUpdateOptions) error {
+	channel := opts.Channel
+	if channel == "" {
+		channel = updateChannel()
+	}
+
+	ctx := context.Background()
+	client := update.NewClient()
+	release, err := client.Latest(ctx, channel)
+	if err != nil {
+		return err
+	}
+	if update.Compare(release.Tag, opts.Version) <= 0 {
+		fmt.Printf("goline %s is up to date (latest %s release: %s)\n", opts.Version, channel, release.Tag)
+		return nil
+	}
+	if opts.Check {
+		fmt.Printf("goline %s is available (current: %s), run `goline self-update` to install it\n", release.Tag, opts.Version)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the goline binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	if managed := update.PackageManager(executable); managed != nil {
+		return managed
+	}
+
+	if update.PublicKey == "" {
+		fmt.Fprintf(os.Stderr, "Warning: this build has no release signing key, the checksums of %s are not verified against a signature\n", release.Tag)
+	}
+	fmt.Printf("Updating goline %s to %s...\n", opts.Version, release.Tag)
+	if err := client.Install(ctx, release, executable); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s to %s\n", executable, release.Tag)
+	return nil
+}
+
+// StartUpdateNotice checks for a new version in the background while the command runs.
+// It returns a function printing a notice to stderr if the check found one, which does not wait
+// for a check still in progress. The notice is skipped when disabled in the config or with
+// GOLINE_NO_UPDATE_NOTICE, and when stderr is not a terminal.
+func StartUpdateNotice(version string) func() {
+	if os.Getenv("GOLINE_NO_UPDATE_NOTICE") != "" || !isTerminal(os.Stderr) {
+		return func() {}
+	}
+	manager, err := loadConfig()
+	if err != nil || manager.GetUpdates().DisableNotice {
+		return func() {}
+	}
+	checker, err := update.NewChecker()
+	if err != nil {
+		return func() {}
+	}
+
+	latest := make(chan string, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), updateNoticeTimeout)
+		defer cancel()
+		// The notice is best effort, a failed check is silently retried on the next run
+		tag, _ := checker.Check(ctx, version, updateChannel())
+		latest <- tag
+	}()
+
+	return func() {
+		select {
+		case tag := <-latest:
+			if tag != "" {
+				fmt.Fprintf(os.Stderr, "\nA new version of goline is available: %s (current: %s)\nRun `goline self-update` to update, or set updates.disable_notice in the config to hide this notice.\n", tag, version)
+			}
+		default:
+		}
+	}
+}
+
+// updateChannel returns the configured release channel
+func updateChannel() string {
+	if manager, err := loadConfig(); err == nil {
+		if channel := manager.GetUpdates().Channel; channel != "" {
+			return channel
+		}
+	}
+	return update.ChannelStable
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
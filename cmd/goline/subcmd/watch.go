@@ -0,0 +1,53 @@
+package subcmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/watch"
+)
+
+// WatchOptions holds the options for the watch command
+type WatchOptions struct {
+	// Prompt is the instruction re-run on every change
+	Prompt string
+	// Command is an optional shell command whose output is sent with the prompt
+	Command string
+	// Debounce is how long the workspace must be quiet before the prompt is re-run
+	Debounce time.Duration
+}
+
+// Watch re-runs a read-only prompt whenever files in the workspace change
+func Watch(opts WatchOptions) error {
+	manager, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(manager)
+	if err != nil {
+		return err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	runner, err := watch.NewRunner(p, workingDir, watch.Options{
+		Prompt:   opts.Prompt,
+		Command:  opts.Command,
+		Debounce: opts.Debounce,
+	}, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	// Stop watching on Ctrl+C or SIGTERM
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	return runner.Run(ctx)
+}
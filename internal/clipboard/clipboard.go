@@ -0,0 +1,51 @@
+// Package clipboard reads and writes the system clipboard with the clipboard commands of the
+// system: pbcopy and pbpaste on macOS, wl-copy and wl-paste on Wayland, xclip or xsel on X11
+// and PowerShell on Windows.
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnavailable is returned when the system has no clipboard command
+var ErrUnavailable = errors.New("no clipboard is available")
+
+// tool is the pair of commands copying their input to the clipboard and pasting it to their output
+type tool struct {
+	copy  []string
+	paste []string
+}
+
+// Read returns the text of the clipboard, with LF line breaks
+func Read(ctx context.Context) (string, error) {
+	t, err := detect()
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.paste[0], t.paste[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", t.paste[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.ReplaceAll(stdout.String(), "\r\n", "\n"), nil
+}
+
+// Write copies text to the clipboard
+func Write(ctx context.Context, text string) error {
+	t, err := detect()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, t.copy[0], t.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", t.copy[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+package clipboard
+
+// detect returns the clipboard commands of macOS
+func detect() (tool, error) {
+	return tool{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}, nil
+}
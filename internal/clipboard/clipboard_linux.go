@@ -0,0 +1,40 @@
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// linuxTools are the clipboard commands tried in turn, those of Wayland first in a Wayland session
+var linuxTools = []struct {
+	wayland bool
+	tool    tool
+}{
+	{wayland: true, tool: tool{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}}},
+	{tool: tool{copy: []string{"xclip", "-selection", "clipboard", "-in"}, paste: []string{"xclip", "-selection", "clipboard", "-out"}}},
+	{tool: tool{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}}},
+}
+
+// detect returns the first clipboard commands installed for the display server of the session
+func detect() (tool, error) {
+	return detectLinux(os.Getenv, exec.LookPath)
+}
+
+// detectLinux returns the first clipboard commands found with lookPath for the display server
+// given by the environment
+func detectLinux(getenv func(string) string, lookPath func(string) (string, error)) (tool, error) {
+	wayland, x11 := getenv("WAYLAND_DISPLAY") != "", getenv("DISPLAY") != ""
+	for _, candidate := range linuxTools {
+		if candidate.wayland && !wayland || !candidate.wayland && !x11 {
+			continue
+		}
+		if _, err := lookPath(candidate.tool.copy[0]); err == nil {
+			return candidate.tool, nil
+		}
+	}
+	if !wayland && !x11 {
+		return tool{}, fmt.Errorf("%w: no graphical session", ErrUnavailable)
+	}
+	return tool{}, fmt.Errorf("%w: install wl-clipboard, xclip or xsel", ErrUnavailable)
+}
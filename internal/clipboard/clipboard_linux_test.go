@@ -0,0 +1,44 @@
+package clipboard
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"testing"
+)
+
+func TestDetectLinux(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		installed []string
+		want      string
+	}{
+		{name: "wayland", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, installed: []string{"wl-copy", "xclip"}, want: "wl-copy"},
+		{name: "xwayland fallback", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, installed: []string{"xsel"}, want: "xsel"},
+		{name: "x11", env: map[string]string{"DISPLAY": ":0"}, installed: []string{"wl-copy", "xclip", "xsel"}, want: "xclip"},
+		{name: "nothing installed", env: map[string]string{"DISPLAY": ":0"}},
+		{name: "no graphical session", installed: []string{"xclip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			lookPath := func(file string) (string, error) {
+				if slices.Contains(tt.installed, file) {
+					return "/usr/bin/" + file, nil
+				}
+				return "", exec.ErrNotFound
+			}
+			got, err := detectLinux(getenv, lookPath)
+			if tt.want == "" {
+				if !errors.Is(err, ErrUnavailable) {
+					t.Errorf("detectLinux() = %v, %v, want ErrUnavailable", got, err)
+				}
+				return
+			}
+			if err != nil || got.copy[0] != tt.want {
+				t.Errorf("detectLinux() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
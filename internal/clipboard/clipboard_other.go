@@ -0,0 +1,8 @@
+//go:build !darwin && !linux && !windows
+
+package clipboard
+
+// detect fails, the clipboard is not available on this system
+func detect() (tool, error) {
+	return tool{}, ErrUnavailable
+}
@@ -0,0 +1,16 @@
+package clipboard
+
+// setClipboardScript copies the standard input, read as UTF-8, to the clipboard
+const setClipboardScript = `[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())`
+
+// getClipboardScript writes the clipboard to the standard output as UTF-8
+const getClipboardScript = `[Console]::OutputEncoding = [Text.Encoding]::UTF8; [Console]::Write((Get-Clipboard -Raw))`
+
+// detect returns the clipboard commands of Windows, which run PowerShell
+func detect() (tool, error) {
+	powershell := []string{"powershell.exe", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command"}
+	return tool{
+		copy:  append(powershell[:len(powershell):len(powershell)], setClipboardScript),
+		paste: append(powershell[:len(powershell):len(powershell)], getClipboardScript),
+	}, nil
+}
@@ -5,35 +5,408 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
 
+	"github.com/kazz187/goline/internal/credentials"
 	"gopkg.in/yaml.v3"
 )
 
+// PlaintextAPIKeyStore keeps the API key in the configuration file
+const PlaintextAPIKeyStore = "plaintext"
+
 // Provider represents an AI provider configuration
 type Provider struct {
-	APIKey    string `yaml:"api_key"`
-	Endpoint  string `yaml:"endpoint,omitempty"`
+	// Type is the implementation of the provider, e.g. openai-compatible to configure several
+	// OpenAI-compatible servers under names of their own. The name of the provider if empty.
+	Type string `yaml:"type,omitempty"`
+	// APIKey is the API key stored in plain text, empty when it is kept in a credential store
+	APIKey string `yaml:"api_key,omitempty"`
+	// APIKeyStore is the credential backend holding the API key (keychain or file)
+	APIKeyStore string `yaml:"api_key_store,omitempty"`
+	// Endpoint overrides the API endpoint of the provider
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// ModelName is the default model of the provider
 	ModelName string `yaml:"model_name,omitempty"`
+	// Model describes the model of the providers whose models are not built in, such as openai-compatible
+	Model ModelSpec `yaml:"model,omitempty"`
+	// Timeouts are the network timeouts of the provider
+	Timeouts Timeouts `yaml:"timeouts,omitempty"`
+	// StreamFormat is the wire format of streamed responses (sse, jsonl or ndjson),
+	// for OpenAI-compatible gateways that do not stream server-sent events
+	StreamFormat string `yaml:"stream_format,omitempty"`
+	// DisablePromptCaching stops marking the stable prefix of requests for caching, for
+	// providers that support prompt caching
+	DisablePromptCaching bool `yaml:"disable_prompt_caching,omitempty"`
+	// RateLimit keeps the requests of all the tasks of a goline process under the limits of the provider
+	RateLimit RateLimit `yaml:"rate_limit,omitempty"`
+	// Thinking configures the extended thinking of the models that support it
+	Thinking Thinking `yaml:"thinking,omitempty"`
+	// Generation are the sampling settings of the requests of the provider
+	Generation Generation `yaml:"generation,omitempty"`
+}
+
+// Generation represents the sampling settings of a provider, left to the provider when unset
+type Generation struct {
+	// Temperature controls the randomness of the responses, 0 for deterministic ones
+	Temperature *float64 `yaml:"temperature,omitempty"`
+	// TopP samples from the tokens making up this probability mass
+	TopP *float64 `yaml:"top_p,omitempty"`
+	// MaxOutputTokens is the maximum number of tokens of a response, the output limit of the model if zero
+	MaxOutputTokens int `yaml:"max_output_tokens,omitempty"`
+}
+
+// Thinking represents the extended thinking settings of a provider
+type Thinking struct {
+	// Disabled turns extended thinking off, it is on by default for the models that support it
+	Disabled bool `yaml:"disabled,omitempty"`
+	// BudgetTokens is the maximum number of tokens the model thinks with, the provider default if zero
+	BudgetTokens int `yaml:"budget_tokens,omitempty"`
+}
+
+// ModelSpec represents the description of a model a provider does not know
+type ModelSpec struct {
+	// ContextWindow is the number of tokens the model can process, the provider default if zero
+	ContextWindow int `yaml:"context_window,omitempty"`
+	// InputCostPer1K and OutputCostPer1K are the prices of 1000 input and output tokens
+	InputCostPer1K  float64 `yaml:"input_cost_per_1k,omitempty"`
+	OutputCostPer1K float64 `yaml:"output_cost_per_1k,omitempty"`
+	// SupportsTools tells that the model calls tools natively, for structured responses
+	SupportsTools bool `yaml:"supports_tools,omitempty"`
+	// SupportsVision tells that the model reads images
+	SupportsVision bool `yaml:"supports_vision,omitempty"`
+	// SupportsReasoning tells that the model streams its reasoning apart from its response
+	SupportsReasoning bool `yaml:"supports_reasoning,omitempty"`
+}
+
+// RateLimit represents the limits of the requests sent to a provider. Zero values are not limited.
+type RateLimit struct {
+	// RequestsPerMinute is the maximum number of requests sent in any minute
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty"`
+	// TokensPerMinute is the maximum number of input and output tokens used in any minute
+	TokensPerMinute int `yaml:"tokens_per_minute,omitempty"`
+	// MaxConcurrent is the maximum number of requests streaming at the same time
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+}
+
+// Timeouts represents the network timeouts of a provider.
+// Zero values fall back to the provider defaults.
+type Timeouts struct {
+	// Connect is the maximum time to establish a connection
+	Connect time.Duration `yaml:"connect,omitempty"`
+	// Read is the maximum time to wait for the first byte and between streamed chunks
+	Read time.Duration `yaml:"read,omitempty"`
+	// Total is the maximum duration of a whole request, a streamed response being only bounded
+	// by Read once it started
+	Total time.Duration `yaml:"total,omitempty"`
+	// Idle is the maximum time an idle connection is kept open for the next requests
+	Idle time.Duration `yaml:"idle,omitempty"`
+	// KeepAlive is the interval of the TCP keep-alive probes of the connections
+	KeepAlive time.Duration `yaml:"keep_alive,omitempty"`
 }
 
 // Config represents the Goline configuration
 type Config struct {
+	// Version is the schema version of the file, see CurrentVersion
+	Version int `yaml:"version,omitempty"`
 	// Providers is a map of provider name to provider configuration
 	Providers map[string]Provider `yaml:"providers"`
 	// DefaultProvider is the name of the default provider to use
 	DefaultProvider string `yaml:"default_provider,omitempty"`
 	// TasksDir is the directory where tasks are stored
 	TasksDir string `yaml:"tasks_dir,omitempty"`
+	// Accessibility replaces the grid TUI with a linear, plain-text interface for screen readers
+	Accessibility bool `yaml:"accessibility,omitempty"`
+	// ResponseLanguage is the language the AI writes its explanations in, e.g. ja or en,
+	// the language of the user's messages if empty
+	ResponseLanguage string `yaml:"response_language,omitempty"`
+	// Profiles is a map of profile name to profile
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// ActiveProfile is the name of the profile used when none is selected on the command line
+	ActiveProfile string `yaml:"active_profile,omitempty"`
+	// Tracing configures the export of OpenTelemetry traces
+	Tracing Tracing `yaml:"tracing,omitempty"`
+	// Updates configures the self-update command and the new version notice
+	Updates Updates `yaml:"updates,omitempty"`
+	// Plugins configures the tools provided by external executables
+	Plugins Plugins `yaml:"plugins,omitempty"`
+	// Hooks configures the commands run on task lifecycle events
+	Hooks Hooks `yaml:"hooks,omitempty"`
+	// Delegation configures the child tasks the AI delegates work to with new_task
+	Delegation Delegation `yaml:"delegation,omitempty"`
+	// Autonomy configures the time box of tasks run with goline run and the mistakes they tolerate
+	Autonomy Autonomy `yaml:"autonomy,omitempty"`
+	// Summarization configures the summaries of older turns that keep a conversation within the context window
+	Summarization Summarization `yaml:"summarization,omitempty"`
+	// Storage configures the disk space used by the tasks in ~/.goline
+	Storage Storage `yaml:"storage,omitempty"`
+	// RecentFiles configures the recently relevant files listed to the AI
+	RecentFiles RecentFiles `yaml:"recent_files,omitempty"`
+	// Bootstrap configures the workspace context added to the first message of new tasks
+	Bootstrap Bootstrap `yaml:"bootstrap,omitempty"`
+	// AutoFix configures how failing commands and edit checks are fed back to the AI to fix
+	AutoFix AutoFix `yaml:"auto_fix,omitempty"`
+	// Index configures the semantic code index searched with semantic_search
+	Index Index `yaml:"index,omitempty"`
+	// CommandPolicy configures the commands execute_command may run without asking or never runs
+	CommandPolicy CommandPolicy `yaml:"command_policy,omitempty"`
+	// Outbound limits the content sent to the providers
+	Outbound Outbound `yaml:"outbound,omitempty"`
+	// Git configures the commits of the changes made by the tasks
+	Git Git `yaml:"git,omitempty"`
+	// Forges is a map of host name to the code host pull requests are opened on
+	Forges map[string]Forge `yaml:"forges,omitempty"`
+	// TUI is the appearance of the TUI
+	TUI TUI `yaml:"tui,omitempty"`
+	// SlashCommands is a map of name to the prompt templates run as /name in the REPL
+	SlashCommands map[string]SlashCommand `yaml:"slash_commands,omitempty"`
+	// Notifications configures the pings sent when a task needs attention
+	Notifications Notifications `yaml:"notifications,omitempty"`
+}
+
+// Notifications represents the pings sent when a task waits for approval or input, fails or completes
+type Notifications struct {
+	// Desktop shows desktop notifications: osascript on macOS, notify-send on Linux, a toast on Windows
+	Desktop bool `yaml:"desktop,omitempty"`
+	// Bell rings the terminal bell
+	Bell bool `yaml:"bell,omitempty"`
+	// Webhooks are URLs the notifications are posted to as Slack-compatible JSON
+	Webhooks []string `yaml:"webhooks,omitempty"`
+	// Events are the events notified among approval_needed, input_needed, error and completed, all if empty
+	Events []string `yaml:"events,omitempty"`
+}
+
+// SlashCommand is a prompt template run as a slash command in the REPL
+type SlashCommand struct {
+	// Description is shown in the help of the REPL
+	Description string `yaml:"description,omitempty"`
+	// Prompt is sent to the AI with {{args}} replaced by the arguments of the command, and
+	// {{arg1}}, {{arg2}}... by their words
+	Prompt string `yaml:"prompt"`
+}
+
+// Git represents how the changes made by the tasks are committed to the repository
+type Git struct {
+	// AutoCommit stages the files edited by a task run with goline run once it completes, and
+	// commits them with a conventional commit message written by the AI after it is approved
+	AutoCommit bool `yaml:"auto_commit,omitempty"`
+}
+
+// TUI represents the appearance of the TUI
+type TUI struct {
+	// Theme is the color preset, dark (default) or light
+	Theme string `yaml:"theme,omitempty"`
+	// ThemeFile is a YAML file overriding the colors and borders of the preset. It is loaded
+	// again when it changes while the TUI runs.
+	ThemeFile string `yaml:"theme_file,omitempty"`
+	// Layout sets the proportions of the panes
+	Layout Layout `yaml:"layout,omitempty"`
+}
+
+// Layout represents the proportions of the panes of the TUI, the defaults when zero
+type Layout struct {
+	// HistoryHeight is the share of the height of the terminal taken by the history, 0.7 by default
+	HistoryHeight float64 `yaml:"history_height,omitempty"`
+	// TasksWidth is the share of the width taken by the tasks overview, 0.25 by default
+	TasksWidth float64 `yaml:"tasks_width,omitempty"`
+	// FileTreeWidth is the share of the width taken by the file tree when shown, 0.2 by default
+	FileTreeWidth float64 `yaml:"file_tree_width,omitempty"`
+}
+
+// CommandPolicy represents the rules evaluated before execute_command runs a command.
+// A rule is a glob where * matches any text, e.g. "git push --force*", or a regular expression
+// when prefixed with re:, e.g. "re:^npm (publish|unpublish)". Built-in rules deny destructive
+// commands such as rm -rf / and package publishes.
+type CommandPolicy struct {
+	// Allow are the commands run without asking, even if running commands is not auto-approved
+	Allow []string `yaml:"allow,omitempty"`
+	// Deny are the commands never run unless the user approves them explicitly, they win over Allow
+	Deny []string `yaml:"deny,omitempty"`
+	// DisableDefaults turns the built-in deny rules off
+	DisableDefaults bool `yaml:"disable_defaults,omitempty"`
+	// ReadOnly are the commands run in read-only mode in addition to the built-in safe read commands
+	ReadOnly []string `yaml:"read_only,omitempty"`
+}
+
+// Index represents how the semantic code index of a workspace is built. The index is built
+// with `goline index`, and semantic_search is available to the tasks of indexed workspaces.
+type Index struct {
+	// Disabled turns the semantic_search tool off, even in indexed workspaces
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Provider is the configured provider whose API key and endpoint compute the embeddings with
+	// an OpenAI-compatible embeddings API. The embeddings are computed locally by hashing the
+	// identifiers and words of the code if empty.
+	Provider string `yaml:"provider,omitempty"`
+	// Model is the embeddings model of the provider, e.g. text-embedding-3-small
+	Model string `yaml:"model,omitempty"`
+}
+
+// RecentFiles represents the files listed to the AI in the environment details as recently
+// relevant: the files read and edited during the task, most relevant first
+type RecentFiles struct {
+	// Disabled stops listing the recently relevant files
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Limit is the number of files listed, 10 if zero
+	Limit int `yaml:"limit,omitempty"`
+	// Git also lists the files with uncommitted changes when the task starts
+	Git bool `yaml:"git,omitempty"`
+	// GitCommits also lists, with Git, the files changed by that many recent commits
+	GitCommits int `yaml:"git_commits,omitempty"`
+}
+
+// Bootstrap represents the workspace context gathered when a task starts: a summary of the
+// file tree, the languages and frameworks, the git branch and recent commits, and an excerpt
+// of the README
+type Bootstrap struct {
+	// Disabled stops adding the workspace context to the first message
+	Disabled bool `yaml:"disabled,omitempty"`
+	// MaxBytes is the size of the workspace context, 8192 if zero
+	MaxBytes int `yaml:"max_bytes,omitempty"`
+}
+
+// AutoFix represents the automatic retries of failures: when a command exits with an error or
+// the checks run after an edit report problems, the failure is fed back to the AI to fix before
+// the user is asked
+type AutoFix struct {
+	// Disabled leaves the failures to the AI without counting the attempts to fix them
+	Disabled bool `yaml:"disabled,omitempty"`
+	// MaxAttempts is the number of attempts to fix a failure before the user is asked, 3 if zero
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+}
+
+// Storage represents the limits of the disk space used by the tasks and how they are indexed
+type Storage struct {
+	// Quota is the disk space the tasks may use before tasks to delete are suggested,
+	// e.g. 20GB or 500MB, no quota if empty
+	Quota string `yaml:"quota,omitempty"`
+	// Backend is how the tasks are listed and searched: "files" reads the task files each time,
+	// "sqlite" indexes them in ~/.goline/tasks.db for fast listing and full-text search.
+	// files if empty.
+	Backend string `yaml:"backend,omitempty"`
+}
+
+// Outbound represents the limits of the content sent to the providers. What is sent is
+// recorded in the audit log of each task, shown by goline audit.
+type Outbound struct {
+	// MaxRequestSize is the largest request sent to a provider, e.g. 500KB, no limit if empty
+	MaxRequestSize string `yaml:"max_request_size,omitempty"`
+	// MaxTaskSize is the total size of the requests of a task, e.g. 20MB, no limit if empty
+	MaxTaskSize string `yaml:"max_task_size,omitempty"`
+	// DenyPaths are gitignore patterns of the files never read by the AI, in addition to the
+	// .golineignore files, which cannot re-include them
+	DenyPaths []string `yaml:"deny_paths,omitempty"`
+}
+
+// Summarization represents how older turns are summarized when a conversation approaches
+// the context window of the model
+type Summarization struct {
+	// Disabled turns the summaries off, requests then fail once the window is exceeded
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Profile is the profile whose provider and model write the summaries, e.g. a cheaper model.
+	// The model of the task writes them if empty.
+	Profile string `yaml:"profile,omitempty"`
+	// Threshold is the share of the context window above which older turns are summarized, 0.8 if zero
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// KeepTurns is the number of recent turns kept verbatim, 6 if zero
+	KeepTurns int `yaml:"keep_turns,omitempty"`
+}
+
+// Autonomy represents the time box of autonomous runs and the mistakes they tolerate
+type Autonomy struct {
+	// Duration pauses a run for review once it has run that long, no limit if zero
+	Duration time.Duration `yaml:"duration,omitempty"`
+	// SummaryInterval is how often a progress summary is posted to the history, never if zero
+	SummaryInterval time.Duration `yaml:"summary_interval,omitempty"`
+	// MaxMistakes pauses a run to ask the user for guidance once the AI made that many mistakes
+	// in a row, e.g. tool uses with invalid parameters or diffs that do not apply, 3 if zero
+	MaxMistakes int `yaml:"max_mistakes,omitempty"`
+}
+
+// Delegation represents the configuration of the child tasks delegated with new_task
+type Delegation struct {
+	// Profile is the profile whose provider and model run the child tasks, e.g. a cheaper model.
+	// Child tasks use the provider and model of their parent if empty.
+	Profile string `yaml:"profile,omitempty"`
+	// MaxTurns is the maximum number of AI responses of a child task, 20 if zero
+	MaxTurns int `yaml:"max_turns,omitempty"`
+}
+
+// Hooks represents the commands run on task lifecycle events.
+// Each command is run by the shell with the event as JSON on stdin.
+type Hooks struct {
+	// OnTaskStart are run before the first request of a task, a failure stops the task
+	OnTaskStart []string `yaml:"on_task_start,omitempty"`
+	// OnToolApproved are run before an approved tool use runs, a failure denies the tool use
+	OnToolApproved []string `yaml:"on_tool_approved,omitempty"`
+	// OnFileWritten are run after the AI created or updated a file, their failures are reported to the AI
+	OnFileWritten []string `yaml:"on_file_written,omitempty"`
+	// OnTaskComplete are run when a run of a task ends, whether it completed or not
+	OnTaskComplete []string `yaml:"on_task_complete,omitempty"`
+	// OnProgress are run with the progress summaries of a time-boxed run, e.g. to send a notification
+	OnProgress []string `yaml:"on_progress,omitempty"`
+	// Timeout is the maximum duration of a hook command, 30 seconds if zero
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Plugins represents the plugin tools configuration.
+// Executables in .goline/tools of the repository and ~/.goline/tools are always loaded.
+type Plugins struct {
+	// Dirs are additional directories of plugin executables
+	Dirs []string `yaml:"dirs,omitempty"`
+	// Timeout is the maximum duration of a plugin run, one minute if zero
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Updates represents the update configuration
+type Updates struct {
+	// Channel is the release channel, stable (the default) or prerelease
+	Channel string `yaml:"channel,omitempty"`
+	// DisableNotice turns off the notice printed at startup when a new version is available
+	DisableNotice bool `yaml:"disable_notice,omitempty"`
+}
+
+// Tracing represents the OpenTelemetry tracing configuration.
+// Traces are exported only when an endpoint is set here or through the
+// standard OTEL_EXPORTER_OTLP_ENDPOINT environment variables.
+type Tracing struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// SampleRatio is the fraction of turns traced, all of them when zero
+	SampleRatio float64 `yaml:"sample_ratio,omitempty"`
 }
 
 // RepoConfig represents repository-specific configuration
 type RepoConfig struct {
+	// Version is the schema version of the file, see CurrentVersion
+	Version int `yaml:"version,omitempty"`
 	// Provider is the name of the provider to use for this repository
 	Provider string `yaml:"provider,omitempty"`
 	// ModelName is the name of the model to use for this repository
 	ModelName string `yaml:"model_name,omitempty"`
 	// TasksDir is the directory where tasks are stored for this repository
 	TasksDir string `yaml:"tasks_dir,omitempty"`
+	// ResponseLanguage overrides the response language of the global config for this repository
+	ResponseLanguage string `yaml:"response_language,omitempty"`
+	// ContextRoots are directories outside the repository the AI may read but not modify
+	ContextRoots []ContextRoot `yaml:"context_roots,omitempty"`
+	// CommandPolicy adds deny rules to the command policy of the global config for this
+	// repository. Its Allow, ReadOnly and DisableDefaults are ignored so that a cloned repository
+	// cannot run commands without asking, in read-only mode too, or turn the built-in rules off.
+	CommandPolicy CommandPolicy `yaml:"command_policy,omitempty"`
+	// Outbound adds denied paths to the outbound policy of the global config for this repository,
+	// its size limits apply when they are lower than the global ones
+	Outbound Outbound `yaml:"outbound,omitempty"`
+}
+
+// ContextRoot is a read-only directory given to the AI as context, e.g. a sibling repository
+// of a shared library. Its files are referred to as name:path.
+type ContextRoot struct {
+	// Name labels the paths of the directory, the base name of Path if empty
+	Name string `yaml:"name,omitempty"`
+	// Path is the directory, relative to the repository root if not absolute
+	Path string `yaml:"path"`
 }
 
 // Manager handles configuration file operations
@@ -42,6 +415,18 @@ type Manager struct {
 	repoConfig   *RepoConfig
 	globalPath   string
 	repoPath     string
+
+	// Configurations as read from disk and as expanded, used to keep ${VAR} references when saving
+	globalRaw      *Config
+	globalResolved *Config
+	repoRaw        *RepoConfig
+	repoResolved   *RepoConfig
+
+	// selectedProfile is the profile selected for this run with UseProfile
+	selectedProfile string
+	// modelProvider and modelName are the provider and model selected for this run with UseModel
+	modelProvider string
+	modelName     string
 }
 
 // NewManager creates a new configuration manager
@@ -91,25 +476,71 @@ func findRepoRoot() (string, error) {
 	}
 }
 
-// Load loads both global and repository-specific configurations
+// Load loads both global and repository-specific configurations.
+// ${VAR} and ${VAR:-default} references to environment variables are expanded, and a
+// *MissingVariablesError is returned if a referenced variable is not set.
 func (m *Manager) Load() error {
 	// Load global config
 	globalConfig, err := m.loadGlobalConfig()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("failed to load global config: %w", err)
 	}
+	m.globalRaw = globalConfig.clone()
+	if err := expandReferences(m.globalPath, globalConfig); err != nil {
+		return err
+	}
 	m.globalConfig = globalConfig
+	m.globalResolved = globalConfig.clone()
 
 	// Load repo config if it exists
 	repoConfig, err := m.loadRepoConfig()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("failed to load repo config: %w", err)
 	}
+	repoRaw := *repoConfig
+	m.repoRaw = &repoRaw
+	if err := expandReferences(m.repoPath, repoConfig); err != nil {
+		return err
+	}
 	m.repoConfig = repoConfig
+	repoResolved := *repoConfig
+	m.repoResolved = &repoResolved
+
+	return nil
+}
 
+// expandReferences expands the environment variable references of a loaded configuration
+func expandReferences(path string, config any) error {
+	references := make(map[string][]string)
+	expandConfig(config, references)
+	if len(references) > 0 {
+		return &MissingVariablesError{Path: path, References: references}
+	}
 	return nil
 }
 
+// clone returns a copy of the configuration
+func (c *Config) clone() *Config {
+	clone := *c
+	clone.Providers = make(map[string]Provider, len(c.Providers))
+	for name, provider := range c.Providers {
+		clone.Providers[name] = provider
+	}
+	if c.Profiles != nil {
+		clone.Profiles = make(map[string]Profile, len(c.Profiles))
+		for name, profile := range c.Profiles {
+			clone.Profiles[name] = profile
+		}
+	}
+	if c.Forges != nil {
+		clone.Forges = make(map[string]Forge, len(c.Forges))
+		for host, forge := range c.Forges {
+			clone.Forges[host] = forge
+		}
+	}
+	return &clone
+}
+
 // loadGlobalConfig loads the global configuration file
 func (m *Manager) loadGlobalConfig() (*Config, error) {
 	data, err := os.ReadFile(m.globalPath)
@@ -123,8 +554,13 @@ func (m *Manager) loadGlobalConfig() (*Config, error) {
 		return nil, err
 	}
 
+	data, err = migrateFile(m.globalPath, data, globalMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate global config: %w", err)
+	}
+
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := decodeStrict(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse global config: %w", err)
 	}
 
@@ -147,8 +583,13 @@ func (m *Manager) loadRepoConfig() (*RepoConfig, error) {
 		return nil, err
 	}
 
+	data, err = migrateFile(m.repoPath, data, repoMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate repo config: %w", err)
+	}
+
 	var config RepoConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := decodeStrict(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse repo config: %w", err)
 	}
 
@@ -167,12 +608,20 @@ func (m *Manager) SaveGlobalConfig() error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err := yaml.Marshal(m.globalConfig)
+	// Write the unchanged settings back with their environment variable references
+	config := m.globalConfig.clone()
+	config.Version = CurrentVersion
+	if m.globalRaw != nil && m.globalResolved != nil {
+		restoreReferences(reflect.ValueOf(config).Elem(), reflect.ValueOf(m.globalRaw).Elem(), reflect.ValueOf(m.globalResolved).Elem())
+	}
+
+	data, err := yaml.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("failed to marshal global config: %w", err)
 	}
 
-	if err := os.WriteFile(m.globalPath, data, 0644); err != nil {
+	// The global config can hold API keys, so it is only readable by the user
+	if err := os.WriteFile(m.globalPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write global config: %w", err)
 	}
 
@@ -191,7 +640,14 @@ func (m *Manager) SaveRepoConfig() error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err := yaml.Marshal(m.repoConfig)
+	// Write the unchanged settings back with their environment variable references
+	config := *m.repoConfig
+	config.Version = CurrentVersion
+	if m.repoRaw != nil && m.repoResolved != nil {
+		restoreReferences(reflect.ValueOf(&config).Elem(), reflect.ValueOf(m.repoRaw).Elem(), reflect.ValueOf(m.repoResolved).Elem())
+	}
+
+	data, err := yaml.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("failed to marshal repo config: %w", err)
 	}
@@ -232,6 +688,99 @@ func (m *Manager) GetProvider(name string) (Provider, bool) {
 	return provider, ok
 }
 
+// SetProviderAPIKey stores the API key of a provider through a credential backend.
+// With the plaintext backend the key is kept in the configuration file, otherwise it is
+// written to the backend and removed from the configuration file.
+// The provider must have been set with SetProvider.
+func (m *Manager) SetProviderAPIKey(name, apiKey, backend string) error {
+	provider, ok := m.GetProvider(name)
+	if !ok {
+		return fmt.Errorf("provider %s not found", name)
+	}
+
+	if backend == PlaintextAPIKeyStore {
+		m.deleteStoredAPIKey(name, provider)
+		provider.APIKey = apiKey
+		provider.APIKeyStore = ""
+		m.SetProvider(name, provider)
+		return nil
+	}
+
+	store, err := credentials.Open(backend)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(name, apiKey); err != nil {
+		return fmt.Errorf("failed to store API key: %w", err)
+	}
+	if provider.APIKeyStore != "" && provider.APIKeyStore != store.Name() {
+		m.deleteStoredAPIKey(name, provider)
+	}
+
+	provider.APIKey = ""
+	provider.APIKeyStore = store.Name()
+	m.SetProvider(name, provider)
+	return nil
+}
+
+// GetProviderAPIKey returns the API key of a provider, reading it from its credential backend if needed.
+// When no key is configured, the GOLINE_<PROVIDER>_API_KEY environment variable is used,
+// e.g. GOLINE_ANTHROPIC_API_KEY.
+func (m *Manager) GetProviderAPIKey(name string) (string, error) {
+	provider, ok := m.GetProvider(name)
+	if !ok || (provider.APIKey == "" && provider.APIKeyStore == "") {
+		if apiKey := os.Getenv(apiKeyEnvName(name)); apiKey != "" {
+			return apiKey, nil
+		}
+		if !ok {
+			return "", fmt.Errorf("provider %s not found", name)
+		}
+	}
+	if provider.APIKeyStore == "" {
+		return provider.APIKey, nil
+	}
+
+	store, err := credentials.Open(provider.APIKeyStore)
+	if err != nil {
+		return "", err
+	}
+	apiKey, err := store.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key of provider %s from %s: %w", name, provider.APIKeyStore, err)
+	}
+	return apiKey, nil
+}
+
+// RemoveProvider removes a provider from the global config along with its stored API key
+func (m *Manager) RemoveProvider(name string) error {
+	provider, ok := m.GetProvider(name)
+	if !ok {
+		return fmt.Errorf("provider %s not found", name)
+	}
+
+	m.deleteStoredAPIKey(name, provider)
+	delete(m.globalConfig.Providers, name)
+
+	// If this was the default provider, clear it
+	if m.globalConfig.DefaultProvider == name {
+		m.globalConfig.DefaultProvider = ""
+	}
+	return nil
+}
+
+// deleteStoredAPIKey removes the API key of a provider from its credential backend.
+// A key that cannot be removed is left behind, as it is no longer referenced.
+func (m *Manager) deleteStoredAPIKey(name string, provider Provider) {
+	if provider.APIKeyStore == "" {
+		return
+	}
+	store, err := credentials.Open(provider.APIKeyStore)
+	if err != nil {
+		return
+	}
+	_ = store.Delete(name)
+}
+
 // SetDefaultProvider sets the default provider in the global config
 func (m *Manager) SetDefaultProvider(name string) {
 	if m.globalConfig == nil {
@@ -250,6 +799,280 @@ func (m *Manager) GetDefaultProvider() string {
 	return m.globalConfig.DefaultProvider
 }
 
+// SetAccessibility enables or disables accessibility mode in the global config
+func (m *Manager) SetAccessibility(enabled bool) {
+	if m.globalConfig == nil {
+		m.globalConfig = &Config{
+			Providers: make(map[string]Provider),
+		}
+	}
+	m.globalConfig.Accessibility = enabled
+}
+
+// IsAccessibilityEnabled returns whether accessibility mode is enabled in the global config
+func (m *Manager) IsAccessibilityEnabled() bool {
+	if m.globalConfig == nil {
+		return false
+	}
+	return m.globalConfig.Accessibility
+}
+
+// SetResponseLanguage sets the response language of the global config, or of the repository
+// config if repo is true. An empty language removes the setting.
+func (m *Manager) SetResponseLanguage(language string, repo bool) {
+	if repo {
+		if m.repoConfig == nil {
+			m.repoConfig = &RepoConfig{}
+		}
+		m.repoConfig.ResponseLanguage = language
+		return
+	}
+	if m.globalConfig == nil {
+		m.globalConfig = &Config{
+			Providers: make(map[string]Provider),
+		}
+	}
+	m.globalConfig.ResponseLanguage = language
+}
+
+// GetResponseLanguage returns the language the AI writes its explanations in: that of the
+// repository config, falling back to the global config. Empty means the language of the user.
+func (m *Manager) GetResponseLanguage() string {
+	if m.repoConfig != nil && m.repoConfig.ResponseLanguage != "" {
+		return m.repoConfig.ResponseLanguage
+	}
+	if m.globalConfig == nil {
+		return ""
+	}
+	return m.globalConfig.ResponseLanguage
+}
+
+// GetTracing returns the tracing configuration of the global config
+func (m *Manager) GetTracing() Tracing {
+	if m.globalConfig == nil {
+		return Tracing{}
+	}
+	return m.globalConfig.Tracing
+}
+
+// GetPlugins returns the plugin configuration of the global config
+func (m *Manager) GetPlugins() Plugins {
+	if m.globalConfig == nil {
+		return Plugins{}
+	}
+	return m.globalConfig.Plugins
+}
+
+// GetPluginDirs returns the directories searched for plugin tools, in order of precedence:
+// .goline/tools in the repository, ~/.goline/tools and the directories of the global config
+func (m *Manager) GetPluginDirs() []string {
+	repoRoot := filepath.Dir(filepath.Dir(m.repoPath))
+	dirs := []string{
+		filepath.Join(repoRoot, ".goline", "tools"),
+		filepath.Join(filepath.Dir(m.globalPath), "tools"),
+	}
+	return append(dirs, m.GetPlugins().Dirs...)
+}
+
+// GetHooks returns the hooks configuration of the global config
+func (m *Manager) GetHooks() Hooks {
+	if m.globalConfig == nil {
+		return Hooks{}
+	}
+	return m.globalConfig.Hooks
+}
+
+// GetDelegation returns the delegation configuration of the global config
+func (m *Manager) GetDelegation() Delegation {
+	if m.globalConfig == nil {
+		return Delegation{}
+	}
+	return m.globalConfig.Delegation
+}
+
+// GetDelegationModel returns the provider and model of the child tasks: those of the delegation
+// profile, falling back to the effective provider and the provider's default model
+func (m *Manager) GetDelegationModel() (string, string) {
+	return m.profileModel(m.GetDelegation().Profile)
+}
+
+// profileModel returns the provider and model of a profile, falling back to the effective
+// provider and the provider's default model
+func (m *Manager) profileModel(name string) (string, string) {
+	profile, ok := m.GetProfile(name)
+	if !ok {
+		return m.GetEffectiveProvider(), m.GetEffectiveModelName()
+	}
+	if profile.Provider == "" {
+		profile.Provider = m.GetEffectiveProvider()
+	}
+	if profile.ModelName == "" {
+		profile.ModelName = m.providerModelName(profile.Provider)
+	}
+	return profile.Provider, profile.ModelName
+}
+
+// GetSummarization returns the summarization configuration of the global config
+func (m *Manager) GetSummarization() Summarization {
+	if m.globalConfig == nil {
+		return Summarization{}
+	}
+	return m.globalConfig.Summarization
+}
+
+// GetSummarizationModel returns the provider and model writing the summaries of older turns:
+// those of the summarization profile, falling back to the effective provider and the provider's default model
+func (m *Manager) GetSummarizationModel() (string, string) {
+	return m.profileModel(m.GetSummarization().Profile)
+}
+
+// GetStorage returns the storage configuration of the global config
+func (m *Manager) GetStorage() Storage {
+	if m.globalConfig == nil {
+		return Storage{}
+	}
+	return m.globalConfig.Storage
+}
+
+// GetStorageQuota returns the storage quota in bytes, 0 if none is configured
+func (m *Manager) GetStorageQuota() (int64, error) {
+	quota := m.GetStorage().Quota
+	if quota == "" {
+		return 0, nil
+	}
+	size, err := ParseSize(quota)
+	if err != nil {
+		return 0, fmt.Errorf("invalid storage.quota: %w", err)
+	}
+	return size, nil
+}
+
+// GetOutbound returns the outbound policy: the denied paths of the global and repository
+// configs, and the lower of their size limits
+func (m *Manager) GetOutbound() Outbound {
+	var outbound Outbound
+	for _, o := range m.outbounds() {
+		outbound.MaxRequestSize = lowerSize(outbound.MaxRequestSize, o.MaxRequestSize)
+		outbound.MaxTaskSize = lowerSize(outbound.MaxTaskSize, o.MaxTaskSize)
+		outbound.DenyPaths = append(outbound.DenyPaths, o.DenyPaths...)
+	}
+	return outbound
+}
+
+// outbounds returns the outbound policies of the global and repository configs
+func (m *Manager) outbounds() []Outbound {
+	var outbounds []Outbound
+	if m.globalConfig != nil {
+		outbounds = append(outbounds, m.globalConfig.Outbound)
+	}
+	if m.repoConfig != nil {
+		outbounds = append(outbounds, m.repoConfig.Outbound)
+	}
+	return outbounds
+}
+
+// lowerSize returns the lower of two size limits, the other one when a limit is empty or
+// invalid, so that the invalid one is reported when it is parsed
+func lowerSize(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	sizeA, errA := ParseSize(a)
+	sizeB, errB := ParseSize(b)
+	switch {
+	case errA != nil:
+		return a
+	case errB != nil:
+		return b
+	case sizeB < sizeA:
+		return b
+	}
+	return a
+}
+
+// GetIndex returns the semantic index configuration of the global config
+func (m *Manager) GetIndex() Index {
+	if m.globalConfig == nil {
+		return Index{}
+	}
+	return m.globalConfig.Index
+}
+
+// GetRecentFiles returns the recent files configuration of the global config
+func (m *Manager) GetRecentFiles() RecentFiles {
+	if m.globalConfig == nil {
+		return RecentFiles{}
+	}
+	return m.globalConfig.RecentFiles
+}
+
+// GetBootstrap returns the workspace context configuration of the global config
+func (m *Manager) GetBootstrap() Bootstrap {
+	if m.globalConfig == nil {
+		return Bootstrap{}
+	}
+	return m.globalConfig.Bootstrap
+}
+
+// GetAutoFix returns the auto-fix configuration of the global config
+func (m *Manager) GetAutoFix() AutoFix {
+	if m.globalConfig == nil {
+		return AutoFix{}
+	}
+	return m.globalConfig.AutoFix
+}
+
+// GetGit returns the git configuration of the global config
+func (m *Manager) GetGit() Git {
+	if m.globalConfig == nil {
+		return Git{}
+	}
+	return m.globalConfig.Git
+}
+
+// GetSlashCommands returns the slash commands defined in the global config
+func (m *Manager) GetSlashCommands() map[string]SlashCommand {
+	if m.globalConfig == nil {
+		return nil
+	}
+	return m.globalConfig.SlashCommands
+}
+
+// GetNotifications returns the notifications configuration of the global config
+func (m *Manager) GetNotifications() Notifications {
+	if m.globalConfig == nil {
+		return Notifications{}
+	}
+	return m.globalConfig.Notifications
+}
+
+// GetTUI returns the appearance of the TUI from the global config
+func (m *Manager) GetTUI() TUI {
+	if m.globalConfig == nil {
+		return TUI{}
+	}
+	return m.globalConfig.TUI
+}
+
+// GetAutonomy returns the autonomy configuration of the global config
+func (m *Manager) GetAutonomy() Autonomy {
+	if m.globalConfig == nil {
+		return Autonomy{}
+	}
+	return m.globalConfig.Autonomy
+}
+
+// GetUpdates returns the update configuration of the global config
+func (m *Manager) GetUpdates() Updates {
+	if m.globalConfig == nil {
+		return Updates{}
+	}
+	return m.globalConfig.Updates
+}
+
 // SetRepoProvider sets the provider for the repository config
 func (m *Manager) SetRepoProvider(name string) {
 	if m.repoConfig == nil {
@@ -282,12 +1105,33 @@ func (m *Manager) GetRepoModelName() string {
 	return m.repoConfig.ModelName
 }
 
+// UseModel selects a provider and a model for this run only, e.g. from the --model flag.
+// They take precedence over the profiles and the repository config. An empty provider keeps
+// the effective one, and an empty model selects the default model of the provider.
+func (m *Manager) UseModel(providerName, modelName string) {
+	m.modelProvider = providerName
+	m.modelName = modelName
+	if modelName == "" {
+		m.modelName = m.providerModelName(m.GetEffectiveProvider())
+	}
+}
+
 // GetEffectiveProvider returns the effective provider to use
-// It first checks the repo config, then falls back to the global default
+// It first checks the model and the profile selected for this run, then the repo config, then
+// the active profile, and falls back to the global default
 func (m *Manager) GetEffectiveProvider() string {
+	if m.modelProvider != "" {
+		return m.modelProvider
+	}
+	if profile, ok := m.selectedProfileSettings(); ok && profile.Provider != "" {
+		return profile.Provider
+	}
 	if m.repoConfig != nil && m.repoConfig.Provider != "" {
 		return m.repoConfig.Provider
 	}
+	if profile, ok := m.activeProfileSettings(); ok && profile.Provider != "" {
+		return profile.Provider
+	}
 	if m.globalConfig != nil {
 		return m.globalConfig.DefaultProvider
 	}
@@ -295,24 +1139,85 @@ func (m *Manager) GetEffectiveProvider() string {
 }
 
 // GetEffectiveModelName returns the effective model name to use
-// It first checks the repo config, then falls back to the provider's default
+// It checks the same places as GetEffectiveProvider, then falls back to the provider's default
 func (m *Manager) GetEffectiveModelName() string {
-	// First check repo config
+	if m.modelName != "" {
+		return m.modelName
+	}
+
+	// First check the profile selected for this run.
+	// A profile that switches the provider must not get the repository's model of another provider.
+	if profile, ok := m.selectedProfileSettings(); ok {
+		if profile.ModelName != "" {
+			return profile.ModelName
+		}
+		if profile.Provider != "" {
+			return m.providerModelName(profile.Provider)
+		}
+	}
+
+	// Then check repo config
 	if m.repoConfig != nil && m.repoConfig.ModelName != "" {
 		return m.repoConfig.ModelName
 	}
 
-	// Then check provider's default model
-	providerName := m.GetEffectiveProvider()
-	if providerName != "" {
-		if provider, ok := m.GetProvider(providerName); ok && provider.ModelName != "" {
-			return provider.ModelName
-		}
+	// Then check the active profile
+	if profile, ok := m.activeProfileSettings(); ok && profile.ModelName != "" {
+		return profile.ModelName
 	}
 
+	// Then check provider's default model
+	return m.providerModelName(m.GetEffectiveProvider())
+}
+
+// providerModelName returns the default model of a provider
+func (m *Manager) providerModelName(name string) string {
+	if name == "" {
+		return ""
+	}
+	if provider, ok := m.GetProvider(name); ok {
+		return provider.ModelName
+	}
 	return ""
 }
 
+// GetCommandPolicy returns the command policy: the rules of the global config followed by the
+// deny rules of the repository
+func (m *Manager) GetCommandPolicy() CommandPolicy {
+	var policy CommandPolicy
+	if m.globalConfig != nil {
+		policy.Allow = append(policy.Allow, m.globalConfig.CommandPolicy.Allow...)
+		policy.Deny = append(policy.Deny, m.globalConfig.CommandPolicy.Deny...)
+		policy.ReadOnly = append(policy.ReadOnly, m.globalConfig.CommandPolicy.ReadOnly...)
+		policy.DisableDefaults = m.globalConfig.CommandPolicy.DisableDefaults
+	}
+	if m.repoConfig != nil {
+		policy.Deny = append(policy.Deny, m.repoConfig.CommandPolicy.Deny...)
+	}
+	return policy
+}
+
+// GetContextRoots returns the read-only context directories of the repository, with absolute
+// paths and their names defaulted
+func (m *Manager) GetContextRoots() []ContextRoot {
+	if m.repoConfig == nil {
+		return nil
+	}
+	repoRoot := filepath.Dir(filepath.Dir(m.repoPath))
+	roots := make([]ContextRoot, 0, len(m.repoConfig.ContextRoots))
+	for _, root := range m.repoConfig.ContextRoots {
+		if !filepath.IsAbs(root.Path) {
+			root.Path = filepath.Join(repoRoot, root.Path)
+		}
+		root.Path = filepath.Clean(root.Path)
+		if root.Name == "" {
+			root.Name = filepath.Base(root.Path)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
 // GetEffectiveTasksDir returns the effective tasks directory to use
 // It first checks the repo config, then falls back to the global config
 func (m *Manager) GetEffectiveTasksDir() string {
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRepoCommandPolicy(t *testing.T) {
+	m := newTestManager(t, `command_policy:
+  allow: ["go test*"]
+  deny: ["make deploy*"]
+  read_only: ["make lint"]
+`)
+	if err := os.MkdirAll(filepath.Dir(m.repoPath), 0755); err != nil {
+		t.Fatalf("Failed to create repo config directory: %v", err)
+	}
+	repoYAML := `command_policy:
+  allow: ["*"]
+  deny: ["terraform apply*"]
+  read_only: ["make"]
+  disable_defaults: true
+`
+	if err := os.WriteFile(m.repoPath, []byte(repoYAML), 0644); err != nil {
+		t.Fatalf("Failed to write repo config: %v", err)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// A repository only adds deny rules, the commands it runs in read-only mode are ignored too
+	policy := m.GetCommandPolicy()
+	if !reflect.DeepEqual(policy.Allow, []string{"go test*"}) {
+		t.Errorf("Allow = %q, want the global rules only", policy.Allow)
+	}
+	if !reflect.DeepEqual(policy.Deny, []string{"make deploy*", "terraform apply*"}) {
+		t.Errorf("Deny = %q", policy.Deny)
+	}
+	if !reflect.DeepEqual(policy.ReadOnly, []string{"make lint"}) {
+		t.Errorf("ReadOnly = %q, want the global rules only", policy.ReadOnly)
+	}
+	if policy.DisableDefaults {
+		t.Error("the repository turned the built-in rules off")
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// referencePattern matches ${VAR} and ${VAR:-default} references, and the $$ escape
+var referencePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// MissingVariablesError is returned when a configuration file references environment variables that are not set
+type MissingVariablesError struct {
+	// Path is the configuration file
+	Path string
+	// References maps each missing variable to the settings referencing it
+	References map[string][]string
+}
+
+// Error returns the error message
+func (e *MissingVariablesError) Error() string {
+	names := make([]string, 0, len(e.References))
+	for name := range e.References {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (used by %s)", name, strings.Join(e.References[name], ", ")))
+	}
+	return fmt.Sprintf("%s references environment variables that are not set: %s", e.Path, strings.Join(parts, "; "))
+}
+
+// expandString replaces ${VAR} references in s with the values of environment variables.
+// ${VAR:-default} uses default when VAR is unset or empty, and $$ is a literal $.
+// The names of unset variables without a default are returned.
+func expandString(s string) (string, []string) {
+	var missing []string
+	result := referencePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		groups := referencePattern.FindStringSubmatch(match)
+		name, hasDefault, def := groups[1], groups[2] != "", groups[3]
+		if value, ok := os.LookupEnv(name); ok && (value != "" || !hasDefault) {
+			return value
+		}
+		if hasDefault {
+			return def
+		}
+		missing = append(missing, name)
+		return match
+	})
+	return result, missing
+}
+
+// expandConfig expands the references in every string of a configuration struct in place.
+// The settings referencing unset variables are collected in references, keyed by variable name.
+func expandConfig(v any, references map[string][]string) {
+	expandValue(reflect.ValueOf(v).Elem(), "", references)
+}
+
+// expandValue expands the references in the strings of v
+func expandValue(v reflect.Value, path string, references map[string][]string) {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, missing := expandString(v.String())
+		for _, name := range missing {
+			references[name] = append(references[name], path)
+		}
+		v.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			expandValue(v.Field(i), joinPath(path, yamlName(field)), references)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// Map values are not addressable, so they are expanded on a copy
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			expandValue(elem, joinPath(path, fmt.Sprint(key.Interface())), references)
+			v.SetMapIndex(key, elem)
+		}
+	}
+}
+
+// restoreReferences puts the references of raw back into current, for every string that
+// still holds the value it was expanded to in resolved. Values changed since loading are kept.
+// This keeps ${VAR} references, and the secrets they stand for, out of saved files.
+func restoreReferences(current, raw, resolved reflect.Value) {
+	switch current.Kind() {
+	case reflect.String:
+		if raw.String() != resolved.String() && current.String() == resolved.String() {
+			current.SetString(raw.String())
+		}
+	case reflect.Struct:
+		for i := 0; i < current.NumField(); i++ {
+			if current.Type().Field(i).IsExported() {
+				restoreReferences(current.Field(i), raw.Field(i), resolved.Field(i))
+			}
+		}
+	case reflect.Map:
+		if raw.IsNil() || resolved.IsNil() {
+			return
+		}
+		for _, key := range current.MapKeys() {
+			rawElem, resolvedElem := raw.MapIndex(key), resolved.MapIndex(key)
+			if !rawElem.IsValid() || !resolvedElem.IsValid() {
+				continue
+			}
+			elem := reflect.New(current.Type().Elem()).Elem()
+			elem.Set(current.MapIndex(key))
+			restoreReferences(elem, rawElem, resolvedElem)
+			current.SetMapIndex(key, elem)
+		}
+	}
+}
+
+// yamlName returns the YAML name of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// joinPath joins a setting path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// apiKeyEnvName returns the environment variable used as a fallback for the API key of a provider,
+// e.g. GOLINE_ANTHROPIC_API_KEY
+func apiKeyEnvName(provider string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, provider)
+	return "GOLINE_" + name + "_API_KEY"
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestManager(t *testing.T, globalYAML string) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	m := &Manager{
+		globalPath: filepath.Join(dir, "global", "config.yaml"),
+		repoPath:   filepath.Join(dir, "repo", ".goline", "config.yaml"),
+	}
+	if err := os.MkdirAll(filepath.Dir(m.globalPath), 0755); err != nil {
+		t.Fatalf("Failed to create config directory: %v", err)
+	}
+	if err := os.WriteFile(m.globalPath, []byte(globalYAML), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return m
+}
+
+func TestLoadExpandsReferences(t *testing.T) {
+	t.Setenv("TEST_ANTHROPIC_KEY", "sk-from-env")
+	t.Setenv("TEST_MODEL", "")
+
+	m := newTestManager(t, `providers:
+  anthropic:
+    api_key: ${TEST_ANTHROPIC_KEY}
+    model_name: ${TEST_MODEL:-claude-default}
+    endpoint: https://example.com/$$path
+`)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	provider, _ := m.GetProvider("anthropic")
+	if provider.APIKey != "sk-from-env" || provider.ModelName != "claude-default" || provider.Endpoint != "https://example.com/$path" {
+		t.Errorf("Unexpected expanded provider: %+v", provider)
+	}
+
+	// Saving keeps the references of unchanged settings and never writes the secret
+	provider.ModelName = "claude-new"
+	m.SetProvider("anthropic", provider)
+	if err := m.SaveGlobalConfig(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	data, err := os.ReadFile(m.globalPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(data), "${TEST_ANTHROPIC_KEY}") || strings.Contains(string(data), "sk-from-env") {
+		t.Errorf("Expected the API key reference to be kept, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "claude-new") {
+		t.Errorf("Expected the changed model to be saved, got:\n%s", data)
+	}
+}
+
+func TestLoadMissingVariable(t *testing.T) {
+	m := newTestManager(t, `providers:
+  anthropic:
+    api_key: ${TEST_UNSET_VARIABLE_FOR_GOLINE}
+`)
+	err := m.Load()
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Expected MissingVariablesError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "TEST_UNSET_VARIABLE_FOR_GOLINE (used by providers.anthropic.api_key)") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestAPIKeyEnvFallback(t *testing.T) {
+	t.Setenv("GOLINE_OPENAI_COMPATIBLE_API_KEY", "sk-fallback")
+
+	m := newTestManager(t, "providers: {}\n")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	apiKey, err := m.GetProviderAPIKey("openai-compatible")
+	if err != nil || apiKey != "sk-fallback" {
+		t.Errorf("Expected fallback API key, got %q (%v)", apiKey, err)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/kazz187/goline/internal/credentials"
+)
+
+// forgeTokenAccount prefixes the credential store accounts of forge tokens, which are kept apart
+// from the API keys of the providers
+const forgeTokenAccount = "forge:"
+
+// Forge represents a code host pull requests are opened on, e.g. github.com or a self-managed GitLab
+type Forge struct {
+	// Type is the API of the host, github or gitlab, guessed from the host name if empty
+	Type string `yaml:"type,omitempty"`
+	// APIURL overrides the API endpoint, e.g. https://github.example.com/api/v3
+	APIURL string `yaml:"api_url,omitempty"`
+	// Token is the access token stored in plain text, empty when it is kept in a credential store
+	Token string `yaml:"token,omitempty"`
+	// TokenStore is the credential backend holding the access token (keychain or file)
+	TokenStore string `yaml:"token_store,omitempty"`
+}
+
+// SetForge sets the configuration of the forge of a host in the global config
+func (m *Manager) SetForge(host string, forge Forge) {
+	if m.globalConfig == nil {
+		m.globalConfig = &Config{
+			Providers: make(map[string]Provider),
+		}
+	}
+	if m.globalConfig.Forges == nil {
+		m.globalConfig.Forges = make(map[string]Forge)
+	}
+	m.globalConfig.Forges[host] = forge
+}
+
+// GetForge returns the configuration of the forge of a host from the global config
+func (m *Manager) GetForge(host string) (Forge, bool) {
+	if m.globalConfig == nil || m.globalConfig.Forges == nil {
+		return Forge{}, false
+	}
+	forge, ok := m.globalConfig.Forges[host]
+	return forge, ok
+}
+
+// ForgeHosts returns the hosts of the configured forges, sorted
+func (m *Manager) ForgeHosts() []string {
+	if m.globalConfig == nil {
+		return nil
+	}
+	hosts := make([]string, 0, len(m.globalConfig.Forges))
+	for host := range m.globalConfig.Forges {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// RemoveForge removes the configuration of the forge of a host along with its stored token
+func (m *Manager) RemoveForge(host string) error {
+	forge, ok := m.GetForge(host)
+	if !ok {
+		return fmt.Errorf("forge %s not found", host)
+	}
+	m.deleteStoredForgeToken(host, forge)
+	delete(m.globalConfig.Forges, host)
+	return nil
+}
+
+// SetForgeToken stores the access token of the forge of a host in a credential backend, or in
+// the configuration file with the plaintext backend
+func (m *Manager) SetForgeToken(host, token, backend string) error {
+	forge, _ := m.GetForge(host)
+	if backend == PlaintextAPIKeyStore {
+		m.deleteStoredForgeToken(host, forge)
+		forge.Token = token
+		forge.TokenStore = ""
+		m.SetForge(host, forge)
+		return nil
+	}
+
+	store, err := credentials.Open(backend)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(forgeTokenAccount+host, token); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	if forge.TokenStore != "" && forge.TokenStore != store.Name() {
+		m.deleteStoredForgeToken(host, forge)
+	}
+
+	forge.Token = ""
+	forge.TokenStore = store.Name()
+	m.SetForge(host, forge)
+	return nil
+}
+
+// GetForgeToken returns the access token of the forge of a host, reading it from its credential
+// backend if needed. When no token is configured, the GITHUB_TOKEN or GITLAB_TOKEN environment
+// variable of the type of the forge is used, empty if it is not set either.
+func (m *Manager) GetForgeToken(host, forgeType string) (string, error) {
+	forge, _ := m.GetForge(host)
+	if forge.TokenStore == "" {
+		if forge.Token != "" {
+			return forge.Token, nil
+		}
+		if forgeType == "gitlab" {
+			return os.Getenv("GITLAB_TOKEN"), nil
+		}
+		return os.Getenv("GITHUB_TOKEN"), nil
+	}
+
+	store, err := credentials.Open(forge.TokenStore)
+	if err != nil {
+		return "", err
+	}
+	token, err := store.Get(forgeTokenAccount + host)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the token of %s from %s: %w", host, forge.TokenStore, err)
+	}
+	return token, nil
+}
+
+// deleteStoredForgeToken removes the token of a forge from its credential backend.
+// A token that cannot be removed is left behind, as it is no longer referenced.
+func (m *Manager) deleteStoredForgeToken(host string, forge Forge) {
+	if forge.TokenStore == "" {
+		return
+	}
+	store, err := credentials.Open(forge.TokenStore)
+	if err != nil {
+		return
+	}
+	_ = store.Delete(forgeTokenAccount + host)
+}
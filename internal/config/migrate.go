@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the schema version of the configuration files written by this version of Goline.
+// Files without a version were written before the schema was versioned and are version 0.
+const CurrentVersion = 1
+
+// Migration upgrades a configuration file from the previous schema version
+type Migration struct {
+	// Version is the schema version the migration upgrades to
+	Version int
+	// Description explains the change, it is logged when the migration runs
+	Description string
+	// Migrate rewrites the decoded YAML document in place
+	Migrate func(doc map[string]any) error
+}
+
+// globalMigrations upgrade the global configuration file, in version order
+var globalMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "read provider timeouts written as bare numbers as seconds instead of nanoseconds",
+		Migrate:     migrateTimeoutSeconds,
+	},
+}
+
+// repoMigrations upgrade the repository configuration file, in version order
+var repoMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "record the schema version",
+		Migrate:     func(map[string]any) error { return nil },
+	},
+}
+
+// NewerVersionError is returned when a configuration file was written by a newer version of Goline
+type NewerVersionError struct {
+	// Path is the path of the configuration file
+	Path string
+	// Version is the schema version of the file
+	Version int
+}
+
+func (e *NewerVersionError) Error() string {
+	return fmt.Sprintf("%s uses config schema version %d, but this version of goline only supports up to version %d, upgrade goline to use it", e.Path, e.Version, CurrentVersion)
+}
+
+// migrateFile upgrades the data of a configuration file to the current schema version.
+// When migrations are applied, the original file is backed up next to it and replaced
+// with the migrated data, which is returned.
+func migrateFile(path string, data []byte, migrations []Migration) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		// Nothing to migrate in an empty file
+		return data, nil
+	}
+
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version > CurrentVersion {
+		return nil, &NewerVersionError{Path: path, Version: version}
+	}
+	if version == CurrentVersion {
+		return data, nil
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := migration.Migrate(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s to version %d: %w", path, migration.Version, err)
+		}
+		slog.Info("Migrated config", "path", path, "version", migration.Version, "change", migration.Description)
+	}
+	doc["version"] = CurrentVersion
+
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migrated config: %w", err)
+	}
+
+	// Keep the original, so nothing is lost if a migration misbehaves
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	backup := backupPath(path, version)
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to back up config before migrating it: %w", err)
+	}
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	slog.Info("Backed up config before migrating it", "path", path, "backup", backup)
+
+	return migrated, nil
+}
+
+// documentVersion returns the schema version of a decoded configuration file
+func documentVersion(doc map[string]any) (int, error) {
+	value, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+	version, ok := value.(int)
+	if !ok || version < 0 {
+		return 0, fmt.Errorf("invalid config version %v", value)
+	}
+	return version, nil
+}
+
+// backupPath returns a path that does not exist yet to back up a configuration file of a version
+func backupPath(path string, version int) string {
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(backup); errors.Is(err, os.ErrNotExist) {
+		return backup
+	}
+	return fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102-150405"))
+}
+
+// decodeStrict decodes a configuration file, failing on settings that are not known
+// instead of dropping them the next time the file is saved
+func decodeStrict(data []byte, out any) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// migrateTimeoutSeconds converts provider timeouts written as bare numbers, which were
+// read as nanoseconds, to durations in seconds
+func migrateTimeoutSeconds(doc map[string]any) error {
+	providers, _ := doc["providers"].(map[string]any)
+	for _, p := range providers {
+		settings, _ := p.(map[string]any)
+		timeouts, _ := settings["timeouts"].(map[string]any)
+		for name, value := range timeouts {
+			switch v := value.(type) {
+			case int:
+				timeouts[name] = fmt.Sprintf("%ds", v)
+			case float64:
+				timeouts[name] = strconv.FormatFloat(v, 'f', -1, 64) + "s"
+			}
+		}
+	}
+	return nil
+}
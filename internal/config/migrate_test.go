@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMigratesUnversionedConfig(t *testing.T) {
+	original := `providers:
+  anthropic:
+    model_name: claude
+    timeouts:
+      connect: 10
+      read: 2.5
+      total: 5m
+default_provider: anthropic
+`
+	m := newTestManager(t, original)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	provider, _ := m.GetProvider("anthropic")
+	if provider.Timeouts.Connect != 10*time.Second || provider.Timeouts.Read != 2500*time.Millisecond || provider.Timeouts.Total != 5*time.Minute {
+		t.Errorf("Unexpected timeouts after migration: %+v", provider.Timeouts)
+	}
+	if m.GetDefaultProvider() != "anthropic" {
+		t.Errorf("Expected the default provider to be kept, got %q", m.GetDefaultProvider())
+	}
+
+	// The original is backed up and the file is rewritten with the current version
+	backup, err := os.ReadFile(m.globalPath + ".v0.bak")
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if string(backup) != original {
+		t.Errorf("Backup differs from the original:\n%s", backup)
+	}
+	migrated, err := os.ReadFile(m.globalPath)
+	if err != nil {
+		t.Fatalf("Failed to read migrated config: %v", err)
+	}
+	if !strings.Contains(string(migrated), "version: 1") || !strings.Contains(string(migrated), "connect: 10s") {
+		t.Errorf("Unexpected migrated config:\n%s", migrated)
+	}
+
+	// Loading again does not migrate twice
+	if err := os.Remove(m.globalPath + ".v0.bak"); err != nil {
+		t.Fatalf("Failed to remove backup: %v", err)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if _, err := os.Stat(m.globalPath + ".v0.bak"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a current config not to be backed up again")
+	}
+}
+
+func TestLoadRejectsNewerConfig(t *testing.T) {
+	m := newTestManager(t, "version: 99\nproviders: {}\n")
+	var newer *NewerVersionError
+	if err := m.Load(); !errors.As(err, &newer) || newer.Version != 99 {
+		t.Errorf("Expected a NewerVersionError, got %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownSettings(t *testing.T) {
+	m := newTestManager(t, "version: 1\nproviders: {}\nthemes:\n  dark: true\n")
+	if err := m.Load(); err == nil || !strings.Contains(err.Error(), "themes") {
+		t.Errorf("Expected an error naming the unknown setting, got %v", err)
+	}
+}
+
+func TestSaveWritesCurrentVersion(t *testing.T) {
+	m := newTestManager(t, "")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	m.SetDefaultProvider("anthropic")
+	if err := m.SaveGlobalConfig(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	data, err := os.ReadFile(m.globalPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(data), "version: 1") {
+		t.Errorf("Expected the saved config to record its version:\n%s", data)
+	}
+}
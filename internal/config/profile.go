@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Profile bundles the settings used together for a kind of work, such as "work", "personal" or "cheap"
+type Profile struct {
+	// Provider is the name of the provider to use
+	Provider string `yaml:"provider,omitempty"`
+	// ModelName is the name of the model to use
+	ModelName string `yaml:"model_name,omitempty"`
+	// Budget is the maximum cost of a task in USD, zero for no limit
+	Budget float64 `yaml:"budget,omitempty"`
+	// AutoApprove lists the actions run without asking the user
+	AutoApprove AutoApprove `yaml:"auto_approve,omitempty"`
+}
+
+// AutoApprove represents the actions that are run without asking the user
+type AutoApprove struct {
+	// ReadFiles approves reading and listing files
+	ReadFiles bool `yaml:"read_files,omitempty"`
+	// EditFiles approves creating, editing and deleting files
+	EditFiles bool `yaml:"edit_files,omitempty"`
+	// ExecuteCommands approves running commands
+	ExecuteCommands bool `yaml:"execute_commands,omitempty"`
+}
+
+// SetProfile sets a profile in the global config
+func (m *Manager) SetProfile(name string, profile Profile) {
+	if m.globalConfig == nil {
+		m.globalConfig = &Config{
+			Providers: make(map[string]Provider),
+		}
+	}
+	if m.globalConfig.Profiles == nil {
+		m.globalConfig.Profiles = make(map[string]Profile)
+	}
+	m.globalConfig.Profiles[name] = profile
+}
+
+// GetProfile returns a profile from the global config
+func (m *Manager) GetProfile(name string) (Profile, bool) {
+	if m.globalConfig == nil || m.globalConfig.Profiles == nil {
+		return Profile{}, false
+	}
+	profile, ok := m.globalConfig.Profiles[name]
+	return profile, ok
+}
+
+// ProfileNames returns the names of all profiles, sorted
+func (m *Manager) ProfileNames() []string {
+	if m.globalConfig == nil {
+		return nil
+	}
+	names := make([]string, 0, len(m.globalConfig.Profiles))
+	for name := range m.globalConfig.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RemoveProfile removes a profile from the global config
+func (m *Manager) RemoveProfile(name string) error {
+	if _, ok := m.GetProfile(name); !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+
+	delete(m.globalConfig.Profiles, name)
+
+	// If this was the active profile, clear it
+	if m.globalConfig.ActiveProfile == name {
+		m.globalConfig.ActiveProfile = ""
+	}
+	return nil
+}
+
+// SetActiveProfile sets the profile used when none is selected on the command line.
+// An empty name deactivates profiles.
+func (m *Manager) SetActiveProfile(name string) error {
+	if name != "" {
+		if _, ok := m.GetProfile(name); !ok {
+			return fmt.Errorf("profile %s not found", name)
+		}
+	}
+	if m.globalConfig == nil {
+		m.globalConfig = &Config{
+			Providers: make(map[string]Provider),
+		}
+	}
+	m.globalConfig.ActiveProfile = name
+	return nil
+}
+
+// GetActiveProfile returns the name of the profile used when none is selected on the command line
+func (m *Manager) GetActiveProfile() string {
+	if m.globalConfig == nil {
+		return ""
+	}
+	return m.globalConfig.ActiveProfile
+}
+
+// UseProfile selects a profile for this run only, e.g. from the --profile flag.
+// A selected profile takes precedence over the repository config, unlike the active profile.
+func (m *Manager) UseProfile(name string) error {
+	if _, ok := m.GetProfile(name); !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+	m.selectedProfile = name
+	return nil
+}
+
+// GetEffectiveProfile returns the profile in effect: the profile selected for this run,
+// or else the active profile
+func (m *Manager) GetEffectiveProfile() (string, Profile, bool) {
+	name := m.selectedProfile
+	if name == "" {
+		name = m.GetActiveProfile()
+	}
+	if name == "" {
+		return "", Profile{}, false
+	}
+	profile, ok := m.GetProfile(name)
+	return name, profile, ok
+}
+
+// GetEffectiveBudget returns the maximum cost of a task in USD from the effective profile, zero for no limit
+func (m *Manager) GetEffectiveBudget() float64 {
+	_, profile, _ := m.GetEffectiveProfile()
+	return profile.Budget
+}
+
+// GetEffectiveAutoApprove returns the actions run without asking the user from the effective profile
+func (m *Manager) GetEffectiveAutoApprove() AutoApprove {
+	_, profile, _ := m.GetEffectiveProfile()
+	return profile.AutoApprove
+}
+
+// selectedProfileSettings returns the profile selected for this run, if any
+func (m *Manager) selectedProfileSettings() (Profile, bool) {
+	if m.selectedProfile == "" {
+		return Profile{}, false
+	}
+	return m.GetProfile(m.selectedProfile)
+}
+
+// activeProfileSettings returns the active profile, if any
+func (m *Manager) activeProfileSettings() (Profile, bool) {
+	name := m.GetActiveProfile()
+	if name == "" {
+		return Profile{}, false
+	}
+	return m.GetProfile(name)
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEffectiveSettingsWithProfiles(t *testing.T) {
+	m := newTestManager(t, `providers:
+  anthropic:
+    model_name: claude-default
+  deepseek:
+    model_name: deepseek-chat
+default_provider: anthropic
+profiles:
+  work:
+    provider: anthropic
+    model_name: claude-work
+    budget: 5
+    auto_approve:
+      read_files: true
+  cheap:
+    provider: deepseek
+active_profile: work
+`)
+	if err := os.MkdirAll(filepath.Dir(m.repoPath), 0755); err != nil {
+		t.Fatalf("Failed to create repo config directory: %v", err)
+	}
+	if err := os.WriteFile(m.repoPath, []byte("model_name: claude-repo\n"), 0644); err != nil {
+		t.Fatalf("Failed to write repo config: %v", err)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// The repository config wins over the active profile
+	if got := m.GetEffectiveModelName(); got != "claude-repo" {
+		t.Errorf("Expected the repository model, got %q", got)
+	}
+	if got := m.GetEffectiveBudget(); got != 5 {
+		t.Errorf("Expected the active profile budget, got %v", got)
+	}
+	if !m.GetEffectiveAutoApprove().ReadFiles {
+		t.Error("Expected reads to be auto-approved by the active profile")
+	}
+
+	// A profile selected for the run wins over the repository config, and a profile that
+	// switches the provider uses that provider's default model
+	if err := m.UseProfile("cheap"); err != nil {
+		t.Fatalf("Failed to select profile: %v", err)
+	}
+	if got := m.GetEffectiveProvider(); got != "deepseek" {
+		t.Errorf("Expected the selected profile provider, got %q", got)
+	}
+	if got := m.GetEffectiveModelName(); got != "deepseek-chat" {
+		t.Errorf("Expected the provider default model, got %q", got)
+	}
+	if got := m.GetEffectiveBudget(); got != 0 {
+		t.Errorf("Expected no budget, got %v", got)
+	}
+
+	if err := m.UseProfile("missing"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestUseModel(t *testing.T) {
+	m := newTestManager(t, `providers:
+  anthropic:
+    model_name: claude-default
+  deepseek:
+    model_name: deepseek-chat
+default_provider: anthropic
+profiles:
+  cheap:
+    provider: deepseek
+`)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := m.UseProfile("cheap"); err != nil {
+		t.Fatalf("Failed to select profile: %v", err)
+	}
+
+	// The model selected for the run wins over the selected profile
+	m.UseModel("", "deepseek-reasoner")
+	if got := m.GetEffectiveProvider(); got != "deepseek" {
+		t.Errorf("Expected the provider of the profile, got %q", got)
+	}
+	if got := m.GetEffectiveModelName(); got != "deepseek-reasoner" {
+		t.Errorf("Expected the selected model, got %q", got)
+	}
+
+	// A provider without a model selects its default model
+	m.UseModel("anthropic", "")
+	if got := m.GetEffectiveProvider(); got != "anthropic" {
+		t.Errorf("Expected the selected provider, got %q", got)
+	}
+	if got := m.GetEffectiveModelName(); got != "claude-default" {
+		t.Errorf("Expected the default model of the selected provider, got %q", got)
+	}
+}
+
+func TestRemoveActiveProfile(t *testing.T) {
+	m := newTestManager(t, "profiles:\n  work:\n    provider: anthropic\nactive_profile: work\n")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := m.RemoveProfile("work"); err != nil {
+		t.Fatalf("Failed to remove profile: %v", err)
+	}
+	if m.GetActiveProfile() != "" {
+		t.Errorf("Expected the active profile to be cleared, got %q", m.GetActiveProfile())
+	}
+	if err := m.SetActiveProfile("work"); err == nil {
+		t.Error("Expected an error when switching to a removed profile")
+	}
+}
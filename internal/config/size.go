@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the multipliers of the size suffixes, powers of 1024 as for disk usage
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+	"T":  1 << 40,
+	"TB": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. 512MB, 1.5GB or 20G.
+// Units are powers of 1024, KiB, MiB, GiB and TiB are accepted as well.
+func ParseSize(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, unit := value, ""
+	if i >= 0 {
+		number, unit = value[:i], strings.TrimSpace(value[i:])
+	}
+	unit = strings.Replace(strings.ToUpper(unit), "IB", "B", 1)
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q, expected B, KB, MB, GB or TB", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
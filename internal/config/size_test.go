@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "512MB", want: 512 << 20},
+		{in: "20G", want: 20 << 30},
+		{in: "1.5 GiB", want: 3 << 29},
+		{in: "2tb", want: 2 << 40},
+		{in: "10XB", wantErr: true},
+		{in: "GB", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,708 @@
+// Package agent runs the loop of a task: it sends the conversation to the provider, runs the
+// tool the AI asks for and sends the result back, until the AI completes the task.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/audit"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	"github.com/kazz187/goline/internal/core/conversation"
+	"github.com/kazz187/goline/internal/core/hooks"
+	"github.com/kazz187/goline/internal/core/ignore"
+	"github.com/kazz187/goline/internal/core/index"
+	"github.com/kazz187/goline/internal/core/plugins"
+	"github.com/kazz187/goline/internal/core/recent"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/notify"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/tracing"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// DefaultMaxTurns is the number of AI responses after which a task is stopped
+const DefaultMaxTurns = 50
+
+// maxContinuations is the number of times a truncated response is continued before it is used as is
+const maxContinuations = 2
+
+var (
+	// ErrNeedsInput is returned when the AI asks a question that nobody can answer
+	ErrNeedsInput = errors.New("the AI needs more input to continue")
+	// ErrTurnLimit is returned when the task did not complete within the maximum number of turns
+	ErrTurnLimit = errors.New("turn limit reached before the task was completed")
+	// ErrNoToolUse is returned when the AI repeatedly answers without using a tool and nobody can give it guidance
+	ErrNoToolUse = errors.New("the AI repeatedly answered without using a tool")
+	// ErrTimeLimit is returned when the run was paused for review at the end of its time box
+	ErrTimeLimit = errors.New("time limit reached before the task was completed")
+)
+
+// ToolUseStreamer is implemented by outputs that show the tool uses of the AI while they are
+// streamed, e.g. the content of a file as it is written, instead of once the response is complete
+type ToolUseStreamer interface {
+	// StreamToolUse shows a tool use as parsed so far. It is called again each time the tool
+	// use grows, and a last time once it is complete.
+	StreamToolUse(toolUse assistantmessage.ToolUse)
+}
+
+// ThrottleReporter is implemented by outputs that show when a request waits for the rate
+// limits of the provider, e.g. in the status of the task
+type ThrottleReporter interface {
+	// ReportThrottle is called when the request starts waiting, with how long or zero if it
+	// waits for other requests to end
+	ReportThrottle(wait time.Duration)
+	// ReportThrottleEnd is called once the request is sent
+	ReportThrottleEnd()
+}
+
+// TruncationReporter is implemented by outputs that let the user ask for the rest of a
+// response still truncated once the continuations were exhausted
+type TruncationReporter interface {
+	// ReportTruncation is called with why the response looks truncated
+	ReportTruncation(reasons []string)
+}
+
+// Options configures an agent
+type Options struct {
+	// TaskID is the ID of the task
+	TaskID string
+	// WorkingDir is the directory the tools work in
+	WorkingDir string
+	// Provider is the provider generating the responses
+	Provider provider.Provider
+	// SystemPrompt is the system prompt sent with every request
+	SystemPrompt string
+	// Generation are the sampling settings of the requests, those of the provider if unset
+	Generation provider.GenerationOptions
+	// Approver decides which tool uses run
+	Approver Approver
+	// Applier writes the file edits, saving a checkpoint before each of them
+	Applier *apply.Applier
+	// Recorder records the history of the task, nil to not record it
+	Recorder *taskstore.Recorder
+	// Output receives the streamed responses and the tool activity. Outputs implementing
+	// ToolUseStreamer are also given the tool uses while they are streamed, those
+	// implementing ThrottleReporter are told when requests wait for the rate limits, and those
+	// implementing TruncationReporter when a response stays truncated.
+	Output io.Writer
+	// MaxTurns is the maximum number of AI responses, DefaultMaxTurns if zero
+	MaxTurns int
+	// Plugins provide the tools registered in addition to the built-in ones, nil if there are none
+	Plugins *plugins.Set
+	// Hooks run the commands configured on the task lifecycle events, nil if there are none
+	Hooks *hooks.Runner
+	// Notifier pings the user when the run needs input, stops or completes, nil to not notify
+	Notifier *notify.Dispatcher
+	// Delegation lets the AI delegate parts of the task to child tasks, nil to not allow it
+	Delegation *Delegation
+	// TimeLimit pauses the run for review once it has run that long, no limit if zero
+	TimeLimit time.Duration
+	// SummaryInterval is how often a progress summary is posted, never if zero
+	SummaryInterval time.Duration
+	// Summarizer compresses the older turns once the conversation approaches the context window, nil to never compress them
+	Summarizer *conversation.Summarizer
+	// RecentFiles tracks the files read and edited, listed in the environment details sent
+	// with the tool results whenever they change. Nil to not track them.
+	RecentFiles *recent.Tracker
+	// Index is the semantic index of the workspace searched by semantic_search, nil if it is not indexed
+	Index *index.Index
+	// ContextRoots are directories outside the workspace that the tools may read but not modify
+	ContextRoots []config.ContextRoot
+	// CommandPolicy allows and denies commands before they are approved, nil to leave every command to the approver
+	CommandPolicy *cmdpolicy.Policy
+	// ReadOnly disables the tools modifying the workspace whatever the approver decides: file
+	// edits, plugins and the commands it does not allow. Nil to allow every tool.
+	ReadOnly *cmdpolicy.ReadOnly
+	// DeniedPaths are gitignore patterns of the files the tools never read, in addition to the
+	// .golineignore files, which cannot re-include them
+	DeniedPaths []string
+	// Audit records the files and requests sent to the provider and refuses the requests over
+	// the limits of the outbound policy, nil to not audit them
+	Audit *audit.Log
+	// AutoFixAttempts is how many times in a row a failing command or the failing checks of a file
+	// are fed back to the AI to fix before the user is asked, zero to leave the failures to the AI
+	AutoFixAttempts int
+	// MaxMistakes is the number of mistakes in a row after which the user is asked for guidance:
+	// responses without a tool use, tool uses with invalid parameters and diffs that do not apply.
+	// DefaultMaxMistakes if zero.
+	MaxMistakes int
+}
+
+// Result is the outcome of a run
+type Result struct {
+	// Completion is the result presented by the AI with attempt_completion
+	Completion string
+	// Command is the command suggested by the AI to showcase the result
+	Command string
+	// CommandRun reports whether Command was run, as the user wanted, and CommandOutput is its output
+	CommandRun    bool
+	CommandOutput string
+	// Question is the question the AI asked when it needed more input, and Options the answers it suggested
+	Question string
+	Options  []string
+	// Turns is the number of AI responses
+	Turns int
+	// Usage is the token usage of the run
+	Usage provider.Usage
+}
+
+// Agent runs the loop of a task
+type Agent struct {
+	opts         Options
+	conversation *conversation.Conversation
+	ignore       *ignore.Controller
+	roots        []*contextRoot
+	progress     progress
+	now          func() time.Time
+	// offlineRetry is the first delay before a request queued while offline is sent again
+	offlineRetry time.Duration
+	// offlineWait is how long a request is queued at most before the run fails
+	offlineWait time.Duration
+	// environment is the last environment details sent, they are only sent again when they change
+	environment string
+	// pending are the files written in parts that are not finalized yet, by path
+	pending map[string]*pendingWrite
+	// seen is the content of the files when the AI last read or wrote them, by absolute path,
+	// to tell the modifications made since
+	seen map[string]string
+	// fixAttempts are the auto-fix attempts of the failing commands and file checks
+	fixAttempts map[string]int
+	// mistakes are the mistakes of the AI since its last successful tool use
+	mistakes mistakes
+	// images are attached to the next user message
+	images []provider.Image
+}
+
+// New creates an agent
+func New(opts Options) *Agent {
+	if opts.MaxTurns <= 0 {
+		opts.MaxTurns = DefaultMaxTurns
+	}
+	if opts.MaxMistakes <= 0 {
+		opts.MaxMistakes = DefaultMaxMistakes
+	}
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+
+	controller := ignore.NewController(opts.WorkingDir)
+	if err := controller.Initialize(); err != nil {
+		slog.Warn("Failed to load .golineignore", "error", err)
+	}
+	controller.Deny(opts.DeniedPaths...)
+
+	return &Agent{
+		opts:         opts,
+		conversation: conversation.New(),
+		ignore:       controller,
+		roots:        newContextRoots(opts.ContextRoots, opts.DeniedPaths),
+		now:          time.Now,
+		offlineRetry: defaultOfflineRetry,
+		offlineWait:  maxOfflineWait,
+		pending:      make(map[string]*pendingWrite),
+		seen:         make(map[string]string),
+		fixAttempts:  make(map[string]int),
+	}
+}
+
+// SetProvider switches the provider and model generating the next responses, e.g. to a cheaper
+// model for the rest of the task. The switch is written to the output and the task history,
+// and the context window of the model applies from the next request on. It must not be called
+// while the agent runs.
+func (a *Agent) SetProvider(p provider.Provider) {
+	a.opts.Provider = p
+	model := p.GetModel()
+	message := fmt.Sprintf("Switched to model %s of provider %s, with a context window of %d tokens", model.Name, p.Name(), model.MaxTokens)
+	fmt.Fprintf(a.opts.Output, "\n[model] %s\n", message)
+	if a.opts.Recorder != nil {
+		if err := a.opts.Recorder.RecordSystemEvent(message, pb.SystemEventType_SYSTEM_EVENT_TYPE_INFO); err != nil {
+			slog.Warn("Failed to record task history", "error", err)
+		}
+	}
+}
+
+// SetSystemPrompt changes the system prompt of the next requests, e.g. for the response
+// language or the capabilities of another model. It must not be called while the agent runs.
+func (a *Agent) SetSystemPrompt(prompt string) {
+	a.opts.SystemPrompt = prompt
+}
+
+// SetGeneration changes the sampling settings of the next requests. It must not be called while
+// the agent runs.
+func (a *Agent) SetGeneration(opts provider.GenerationOptions) {
+	a.opts.Generation = opts
+}
+
+// generation returns the sampling settings of the next request. An output limit set for
+// another model is lowered to the limit of the model, e.g. after a switch to a smaller one.
+func (a *Agent) generation() provider.GenerationOptions {
+	return a.generationFor(a.opts.Provider)
+}
+
+// generationFor returns the sampling settings of a request sent to p
+func (a *Agent) generationFor(p provider.Provider) provider.GenerationOptions {
+	opts := a.opts.Generation
+	if limit := p.Capabilities().MaxOutputTokens; limit > 0 && opts.MaxOutputTokens > limit {
+		opts.MaxOutputTokens = limit
+	}
+	return opts
+}
+
+// AttachImages attaches images to the next user message, e.g. to the task of the next run. It
+// fails when the model cannot read images. It must not be called while the agent runs.
+func (a *Agent) AttachImages(images ...provider.Image) error {
+	if !a.opts.Provider.Capabilities().Vision {
+		return fmt.Errorf("model %s of provider %s cannot read images", a.opts.Provider.GetModel().Name, a.opts.Provider.Name())
+	}
+	a.images = append(a.images, images...)
+	return nil
+}
+
+// Run runs the task until the AI completes it, asks a question or a limit is reached.
+// The result is returned with ErrNeedsInput, ErrTurnLimit, ErrTimeLimit and ErrNoToolUse so the
+// progress made so far can be reported.
+func (a *Agent) Run(ctx context.Context, prompt string) (*Result, error) {
+	ctx, span := tracing.Start(ctx, "agent.run", tracing.AttrTaskID.String(a.opts.TaskID))
+	result, err := a.run(ctx, prompt)
+	a.taskCompleted(ctx, result, err)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (a *Agent) run(ctx context.Context, prompt string) (*Result, error) {
+	result := &Result{}
+	a.progress = progress{started: a.now()}
+	a.progress.lastSummary = a.progress.started
+	if err := a.runHooks(ctx, hooks.Payload{Event: hooks.EventTaskStart, Prompt: prompt}); err != nil {
+		return result, err
+	}
+	a.addUserMessage(a.withEnvironment(fmt.Sprintf("<task>\n%s\n</task>", prompt)), pb.UserMessageType_USER_MESSAGE_TYPE_ASK)
+	return a.loop(ctx, result, a.send)
+}
+
+// Retry discards the last response of the AI and generates it again with p, another model or
+// provider than that of the agent, or the provider of the agent if nil. The discarded response
+// is kept as an alternative of the new one, and the task goes on from the new one as in Run.
+// It fails with conversation.ErrNoAssistantTurn when the task does not end with a response of
+// the AI, e.g. after a tool result. It must not be called while the agent runs.
+func (a *Agent) Retry(ctx context.Context, p provider.Provider) (*Result, error) {
+	turns := a.conversation.Turns()
+	if len(turns) == 0 || turns[len(turns)-1].Role != conversation.RoleAssistant {
+		return &Result{}, conversation.ErrNoAssistantTurn
+	}
+	if p == nil {
+		p = a.opts.Provider
+	}
+
+	ctx, span := tracing.Start(ctx, "agent.retry", tracing.AttrTaskID.String(a.opts.TaskID))
+	a.progress = progress{started: a.now()}
+	a.progress.lastSummary = a.progress.started
+	result, err := a.loop(ctx, &Result{}, func(ctx context.Context, result *Result) (string, error) {
+		return a.regenerate(ctx, p, result)
+	})
+	a.taskCompleted(ctx, result, err)
+	tracing.End(span, err)
+	return result, err
+}
+
+// loop runs the turns of the task until the AI completes it, asks a question or a limit is
+// reached. The response of the first turn is returned by first, those of the next turns by send.
+func (a *Agent) loop(ctx context.Context, result *Result, first func(context.Context, *Result) (string, error)) (*Result, error) {
+	next := first
+	for result.Turns < a.opts.MaxTurns {
+		if err := a.checkTimeBox(ctx, result); err != nil {
+			return result, err
+		}
+		result.Turns++
+		content, err := next(ctx, result)
+		next = a.send
+		if err != nil {
+			return result, err
+		}
+
+		toolUse := firstToolUse(assistantmessage.ParseAssistantMessage(content))
+		if toolUse == nil {
+			guidance, err := a.addMistake(ctx, mistakeNoToolUse, result)
+			if err != nil {
+				return result, err
+			}
+			a.addUserMessage(withGuidance(noToolUsedMessage, guidance), pb.UserMessageType_USER_MESSAGE_TYPE_UNSPECIFIED)
+			continue
+		}
+
+		switch toolUse.Name {
+		case assistantmessage.AttemptCompletionToolName:
+			if paths := a.unfinalizedWrites(); len(paths) > 0 {
+				err := fmt.Errorf("files written in parts are not finalized: %s. Send their last part with mode finalize before completing the task", strings.Join(paths, ", "))
+				a.recordTool(*toolUse, "", err)
+				a.addUserMessage(toolResultMessage(*toolUse, "", err), pb.UserMessageType_USER_MESSAGE_TYPE_UNSPECIFIED)
+				continue
+			}
+			a.completeTask(ctx, *toolUse, result)
+			return result, nil
+		case assistantmessage.AskFollowupQuestionToolName:
+			output, err := a.askFollowup(ctx, *toolUse, result)
+			a.recordTool(*toolUse, output, err)
+			if err != nil {
+				return result, err
+			}
+			a.addUserMessage(a.withEnvironment(toolResultMessage(*toolUse, output, nil)), pb.UserMessageType_USER_MESSAGE_TYPE_ASK)
+			continue
+		}
+
+		fmt.Fprintf(a.opts.Output, "\n[%s] %s\n", toolUse.Name, describeToolUse(*toolUse))
+		output, err := a.runTool(ctx, *toolUse, result)
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		// The outputs of the tools that do not fit them to the context window themselves,
+		// e.g. those of plugins, are truncated
+		output = truncateHeadTail(output, a.outputBudget())
+		a.recordTool(*toolUse, output, err)
+		message := toolResultMessage(*toolUse, output, err)
+		var mistake *mistakeError
+		if errors.As(err, &mistake) {
+			guidance, err := a.addMistake(ctx, mistake.kind, result)
+			if err != nil {
+				return result, err
+			}
+			message = withGuidance(message, guidance)
+		}
+		if err != nil {
+			fmt.Fprintf(a.opts.Output, "[%s] %v\n", toolUse.Name, err)
+		} else {
+			a.mistakes = mistakes{}
+			a.progress.track(*toolUse)
+			fix, err := a.autoFix(ctx, *toolUse, output, result)
+			if err != nil {
+				return result, err
+			}
+			if fix != "" {
+				message += "\n\n" + fix
+			}
+		}
+		a.addUserMessage(a.withEnvironment(message), pb.UserMessageType_USER_MESSAGE_TYPE_UNSPECIFIED)
+	}
+
+	return result, ErrTurnLimit
+}
+
+// runHooks runs the hooks of an event of the task
+func (a *Agent) runHooks(ctx context.Context, payload hooks.Payload) error {
+	payload.TaskID = a.opts.TaskID
+	payload.WorkingDirectory = a.opts.WorkingDir
+	return a.opts.Hooks.Run(ctx, payload)
+}
+
+// taskCompleted runs the on_task_complete hooks with the outcome of a run, and notifies the
+// user unless the task was cancelled. The hooks run even when the task was cancelled, and
+// their failures are only logged.
+func (a *Agent) taskCompleted(ctx context.Context, result *Result, err error) {
+	payload := hooks.Payload{Event: hooks.EventTaskComplete, Result: result.Completion}
+	switch {
+	case err == nil:
+		payload.Status = "completed"
+	case errors.Is(err, ErrNeedsInput):
+		payload.Status = "needs_input"
+		payload.Result = result.Question
+	case errors.Is(err, ErrTurnLimit):
+		payload.Status = "turn_limit"
+	case errors.Is(err, ErrTimeLimit):
+		payload.Status = "time_limit"
+	case errors.Is(err, ErrNoToolUse):
+		payload.Status = "no_tool_use"
+	case ctx.Err() != nil:
+		payload.Status = "cancelled"
+	default:
+		payload.Status = "failed"
+	}
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	if err := a.runHooks(context.WithoutCancel(ctx), payload); err != nil {
+		slog.Warn("Hook failed", "error", err)
+	}
+
+	notification := notify.Notification{Event: notify.EventError, TaskID: a.opts.TaskID, Message: payload.Error}
+	switch payload.Status {
+	case "cancelled":
+		return
+	case "completed":
+		notification.Event, notification.Message = notify.EventCompleted, payload.Result
+	case "needs_input":
+		notification.Event, notification.Message = notify.EventInputNeeded, payload.Result
+	}
+	a.opts.Notifier.Notify(ctx, notification)
+}
+
+// send sends the conversation to the provider, streams the response to the output
+// and adds it to the conversation. A response that looks truncated is continued up to
+// maxContinuations times, and the continuations are stitched to it. A request that cannot
+// reach the provider waits for the connection to come back, see streamOnline.
+func (a *Agent) send(ctx context.Context, result *Result) (string, error) {
+	a.compact(ctx, result)
+	messages := a.conversation.Messages()
+	content, stopReason, usage, err := a.streamOnline(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; ; i++ {
+		reasons := assistantmessage.DetectTruncation(content, stopReason)
+		if len(reasons) == 0 {
+			break
+		}
+		if i == maxContinuations {
+			fmt.Fprintf(a.opts.Output, "[truncated] The response may be incomplete: %s\n", strings.Join(reasons, ", "))
+			if reporter, ok := a.opts.Output.(TruncationReporter); ok {
+				reporter.ReportTruncation(reasons)
+			}
+			break
+		}
+		fmt.Fprintf(a.opts.Output, "[truncated] %s, asking the AI to continue\n", strings.Join(reasons, ", "))
+		continuation, reason, more, err := a.streamOnline(ctx, append(slices.Clone(messages),
+			provider.Message{Role: conversation.RoleAssistant, Content: content},
+			provider.Message{Role: conversation.RoleUser, Content: assistantmessage.ContinuationPrompt},
+		))
+		if err != nil {
+			return "", err
+		}
+		content = assistantmessage.StitchContinuation(content, continuation)
+		stopReason = reason
+		usage = sumUsage(usage, more)
+	}
+
+	name, model := a.opts.Provider.Name(), a.opts.Provider.GetModel().Name
+	a.conversation.AddAssistantMessage(content, name, model)
+	if usage != nil {
+		addUsage(&result.Usage, usage)
+	}
+	record(a, a.opts.Recorder.RecordAIResponse, &pb.AIResponse{
+		Content:  content,
+		Provider: name,
+		Model:    model,
+		Usage:    conversation.UsageToProto(usage),
+	})
+	return content, nil
+}
+
+// regenerate generates the last response of the AI again with p, streams it to the output and
+// records it with the discarded responses as its alternatives
+func (a *Agent) regenerate(ctx context.Context, p provider.Provider, result *Result) (string, error) {
+	messages := a.conversation.Messages()
+	if err := a.opts.Audit.Request(p, audit.RequestSize(a.opts.SystemPrompt, messages[:len(messages)-1])); err != nil {
+		return "", err
+	}
+	events, err := a.conversation.Retry(ctx, p, a.opts.SystemPrompt, a.generationFor(p))
+	if err != nil {
+		return "", err
+	}
+	var streamErr error
+	for event := range events {
+		switch event.Type {
+		case "text":
+			fmt.Fprint(a.opts.Output, event.Text)
+		case "error":
+			streamErr = event.AsError()
+		}
+	}
+	fmt.Fprintln(a.opts.Output)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if streamErr != nil {
+		return "", fmt.Errorf("request failed: %w", streamErr)
+	}
+
+	turns := a.conversation.Turns()
+	turn := turns[len(turns)-1]
+	if turn.Usage != nil {
+		addUsage(&result.Usage, turn.Usage)
+	}
+	record(a, a.opts.Recorder.RecordAIResponse, turn.ToProto())
+	return turn.Content, nil
+}
+
+// stream sends messages to the provider and streams the response to the output, returning
+// the response with its stop reason and usage. The text already shown by the interrupted
+// attempts of the request, tracked by shown, is not printed again.
+func (a *Agent) stream(ctx context.Context, messages []provider.Message, shown *shownResponse) (string, string, *provider.Usage, error) {
+	if err := a.opts.Audit.Request(a.opts.Provider, audit.RequestSize(a.opts.SystemPrompt, messages)); err != nil {
+		return "", "", nil, err
+	}
+	events, err := a.opts.Provider.CreateMessage(ctx, a.opts.SystemPrompt, messages, a.generation())
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	streamer, _ := a.opts.Output.(ToolUseStreamer)
+	throttleReporter, _ := a.opts.Output.(ThrottleReporter)
+	parser := assistantmessage.NewParser()
+	var response strings.Builder
+	var usage *provider.Usage
+	var stopReason string
+	var streamErr error
+	throttled := false
+	for event := range events {
+		if throttled && event.Type != "throttled" && throttleReporter != nil {
+			throttleReporter.ReportThrottleEnd()
+		}
+		throttled = event.Type == "throttled"
+		switch event.Type {
+		case "throttled":
+			if event.Throttle > 0 {
+				fmt.Fprintf(a.opts.Output, "[throttled] Waiting %s for the rate limits of the provider\n", event.Throttle.Round(time.Second))
+			} else {
+				fmt.Fprintln(a.opts.Output, "[throttled] Waiting for other requests to the provider to end")
+			}
+			if throttleReporter != nil {
+				throttleReporter.ReportThrottle(event.Throttle)
+			}
+		case "text":
+			response.WriteString(event.Text)
+			fmt.Fprint(a.opts.Output, shown.next(response.String(), event.Text))
+			if streamer != nil {
+				for _, delta := range parser.Append(event.Text) {
+					if toolUse, ok := delta.Block.(assistantmessage.ToolUse); ok {
+						streamer.StreamToolUse(toolUse)
+					}
+				}
+			}
+		case "usage":
+			usage = event.Usage
+		case "stop":
+			stopReason = event.StopReason
+		case "error":
+			streamErr = event.AsError()
+		}
+	}
+	if throttled && throttleReporter != nil {
+		throttleReporter.ReportThrottleEnd()
+	}
+	shown.end(response.String())
+	fmt.Fprintln(a.opts.Output)
+	if err := ctx.Err(); err != nil {
+		return "", "", nil, err
+	}
+	if streamErr != nil {
+		return "", "", nil, fmt.Errorf("request failed: %w", streamErr)
+	}
+	return response.String(), stopReason, usage, nil
+}
+
+// compact summarizes the older turns when the conversation approaches the context window.
+// A failed summary is only logged, the request is then sent with the whole conversation.
+func (a *Agent) compact(ctx context.Context, result *Result) {
+	s := a.opts.Summarizer
+	if s == nil || !s.NeedsSummary(a.opts.Provider.GetModel().MaxTokens, a.opts.SystemPrompt, a.conversation) {
+		return
+	}
+	summary, err := s.Summarize(ctx, a.conversation)
+	if errors.Is(err, conversation.ErrNothingToSummarize) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to summarize older turns", "error", err)
+		return
+	}
+
+	fmt.Fprintf(a.opts.Output, "\n[context] Summarized %d earlier turn(s) to fit the context window\n", len(summary.Originals))
+	if summary.Usage != nil {
+		addUsage(&result.Usage, summary.Usage)
+	}
+	record(a, a.opts.Recorder.RecordContextSummary, summary.ToProto())
+}
+
+// addUserMessage adds a user turn to the conversation and records it
+func (a *Agent) addUserMessage(content string, messageType pb.UserMessageType) {
+	a.conversation.AddUserMessage(content, a.images...)
+	a.images = nil
+	if a.opts.Recorder == nil {
+		return
+	}
+	if err := a.opts.Recorder.RecordUserMessage(content, messageType); err != nil {
+		slog.Warn("Failed to record message", "error", err)
+	}
+}
+
+// withEnvironment appends the environment details to a user message if they changed since they were last sent
+func (a *Agent) withEnvironment(content string) string {
+	var files []recent.File
+	for _, f := range a.opts.RecentFiles.Files() {
+		if a.ignore.ValidateAccess(filepath.Join(a.opts.WorkingDir, f.Path)) {
+			files = append(files, f)
+		}
+	}
+	environment := recent.FormatSection(files)
+	if environment == "" || environment == a.environment {
+		return content
+	}
+	a.environment = environment
+	return fmt.Sprintf("%s\n\n<environment_details>\n%s\n</environment_details>", content, environment)
+}
+
+// recordTool records a tool call
+func (a *Agent) recordTool(toolUse assistantmessage.ToolUse, output string, err error) {
+	event := &pb.ToolCallEvent{
+		ToolName:  string(toolUse.Name),
+		Arguments: formatParams(toolUse.Params),
+		Result:    output,
+		Success:   err == nil,
+	}
+	if err != nil {
+		event.ErrorMessage = err.Error()
+	}
+	record(a, a.opts.Recorder.RecordToolCall, event)
+}
+
+// record records an event with a recorder method, logging failures as the task can go on without its history
+func record[T any](a *Agent, method func(T) error, event T) {
+	if a.opts.Recorder == nil {
+		return
+	}
+	if err := method(event); err != nil {
+		slog.Warn("Failed to record task history", "error", err)
+	}
+}
+
+// firstToolUse returns the first complete tool use of a response, the AI uses one tool per message
+func firstToolUse(blocks []interface{}) *assistantmessage.ToolUse {
+	for _, block := range blocks {
+		if toolUse, ok := block.(assistantmessage.ToolUse); ok && !toolUse.Partial {
+			return &toolUse
+		}
+	}
+	return nil
+}
+
+// sumUsage returns the usage of two requests, either of which can be nil
+func sumUsage(a, b *provider.Usage) *provider.Usage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	total := *a
+	addUsage(&total, b)
+	return &total
+}
+
+// addUsage adds the usage of a response to a total
+func addUsage(total, usage *provider.Usage) {
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.CacheReadTokens += usage.CacheReadTokens
+	total.CacheWriteTokens += usage.CacheWriteTokens
+	total.TotalCost += usage.TotalCost
+}
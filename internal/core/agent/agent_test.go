@@ -0,0 +1,1093 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/audit"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	"github.com/kazz187/goline/internal/core/conversation"
+	"github.com/kazz187/goline/internal/core/hooks"
+	"github.com/kazz187/goline/internal/core/recent"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+// scriptedProvider answers with fixed responses in order and keeps the messages it received
+type scriptedProvider struct {
+	responses []string
+	requests  [][]provider.Message
+	// generations are the sampling settings of the requests
+	generations  []provider.GenerationOptions
+	window       int
+	capabilities provider.Capabilities
+	// chunkSize splits the responses into text events of that many bytes, one event if zero
+	chunkSize int
+}
+
+func (p *scriptedProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	p.requests = append(p.requests, messages)
+	p.generations = append(p.generations, opts)
+	if len(p.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+
+	size := p.chunkSize
+	if size <= 0 {
+		size = max(len(response), 1)
+	}
+	ch := make(chan provider.StreamEvent, len(response)/size+2)
+	for i := 0; i < len(response); i += size {
+		ch <- provider.StreamEvent{Type: "text", Text: response[i:min(i+size, len(response))]}
+	}
+	ch <- provider.StreamEvent{Type: "usage", Usage: &provider.Usage{InputTokens: 10, OutputTokens: 5}}
+	close(ch)
+	return ch, nil
+}
+
+func (p *scriptedProvider) GetModel() provider.ModelInfo {
+	return provider.ModelInfo{Name: "model", MaxTokens: p.window}
+}
+
+func (p *scriptedProvider) Capabilities() provider.Capabilities {
+	return p.capabilities
+}
+
+func (p *scriptedProvider) Name() string {
+	return "scripted"
+}
+
+// lastMessage returns the last message sent in the nth request
+func (p *scriptedProvider) lastMessage(n int) string {
+	messages := p.requests[n]
+	return messages[len(messages)-1].Content
+}
+
+func newTestAgent(t *testing.T, p provider.Provider, autoApprove config.AutoApprove) (*Agent, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+
+	applier, err := apply.NewApplier("task-1", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("NewApplier() error = %v", err)
+	}
+	return New(Options{
+		TaskID:     "task-1",
+		WorkingDir: workingDir,
+		Provider:   p,
+		Approver:   PolicyApprover{AutoApprove: autoApprove},
+		Applier:    applier,
+	}), workingDir
+}
+
+func TestRunCompletesTask(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"I will create the file.\n<write_to_file>\n<path>hello.txt</path>\n<content>hello\n</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>Created hello.txt</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+
+	result, err := a.Run(context.Background(), "Create hello.txt")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Completion != "Created hello.txt" || result.Turns != 2 || result.Usage.InputTokens != 20 {
+		t.Errorf("result = %+v", result)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workingDir, "hello.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("hello.txt = %q, %v", data, err)
+	}
+	if got := p.lastMessage(1); !strings.HasPrefix(got, "[write_to_file for 'hello.txt'] Result:\nCreated hello.txt.") {
+		t.Errorf("tool result message = %q", got)
+	}
+}
+
+func TestRunSendsAttachedImages(t *testing.T) {
+	image := provider.Image{MediaType: "image/png", Data: []byte("png")}
+	a, _ := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	if err := a.AttachImages(image); err == nil {
+		t.Error("AttachImages() succeeded with a model that cannot read images")
+	}
+
+	p := &scriptedProvider{responses: []string{
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<attempt_completion>\n<result>It is a login form</result>\n</attempt_completion>",
+	}, capabilities: provider.Capabilities{Vision: true}}
+	a, _ = newTestAgent(t, p, config.AutoApprove{ReadFiles: true})
+	if err := a.AttachImages(image); err != nil {
+		t.Fatalf("AttachImages() error = %v", err)
+	}
+	if _, err := a.Run(context.Background(), "What is this screen? [image: screen.png 800x600]"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	last := p.requests[len(p.requests)-1]
+	if len(last[0].Images) != 1 || last[0].Images[0].MediaType != "image/png" {
+		t.Errorf("task images = %+v, want the attached image", last[0].Images)
+	}
+	if images := last[len(last)-1].Images; len(images) != 0 {
+		t.Errorf("tool result images = %+v, want the image attached to the task only", images)
+	}
+}
+
+func TestRunLimitsOutputToModel(t *testing.T) {
+	p := &scriptedProvider{
+		responses:    []string{"<attempt_completion>\n<result>Done</result>\n</attempt_completion>"},
+		capabilities: provider.Capabilities{MaxOutputTokens: 4096},
+	}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	a.SetGeneration(provider.GenerationOptions{MaxOutputTokens: 64000})
+
+	if _, err := a.Run(context.Background(), "Finish"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.generations[0].MaxOutputTokens; got != 4096 {
+		t.Errorf("MaxOutputTokens = %d, want the limit of the model", got)
+	}
+}
+
+func TestRunWithMockProvider(t *testing.T) {
+	fixture, err := mock.Parse([]byte(`
+responses:
+  - text: "<write_to_file>\n<path>hello.txt</path>\n<content>hello\n</content>\n</write_to_file>"
+  - events:
+      - {type: text, text: "<attempt_completion>\n<result>Created "}
+      - {type: text, text: "hello.txt</result>\n</attempt_completion>"}
+      - {type: usage, usage: {input_tokens: 120, output_tokens: 8}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := mock.New(fixture)
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+
+	result, err := a.Run(context.Background(), "Create hello.txt")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Completion != "Created hello.txt" || result.Turns != 2 || result.Usage.InputTokens != 120 {
+		t.Errorf("result = %+v", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(workingDir, "hello.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("hello.txt = %q, %v", data, err)
+	}
+	requests := p.Requests()
+	if len(requests) != 2 || !strings.Contains(requests[1].Messages[len(requests[1].Messages)-1].Content, "[write_to_file for 'hello.txt'] Result:") {
+		t.Errorf("requests = %+v, want the tool result sent back", requests)
+	}
+}
+
+func TestSetProviderSwitchesModel(t *testing.T) {
+	completion := []byte("responses:\n  - text: \"<attempt_completion>\\n<result>Done</result>\\n</attempt_completion>\"\n")
+	small, err := mock.Parse(append([]byte("model: small\nmax_tokens: 8000\n"), completion...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := mock.Parse(append([]byte("model: large\nmax_tokens: 200000\n"), completion...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := mock.New(small), mock.New(large)
+	a, _ := newTestAgent(t, first, config.AutoApprove{})
+	var out strings.Builder
+	a.opts.Output = &out
+
+	if _, err := a.Run(context.Background(), "First task"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	a.SetProvider(second)
+	if _, err := a.Run(context.Background(), "Second task"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(first.Requests()) != 1 || len(second.Requests()) != 1 {
+		t.Errorf("requests = %d and %d, want one for each model", len(first.Requests()), len(second.Requests()))
+	}
+	// The second model gets the whole conversation
+	if messages := second.Requests()[0].Messages; !strings.Contains(messages[0].Content, "First task") {
+		t.Errorf("messages = %+v, want the conversation of the first model", messages)
+	}
+	if !strings.Contains(out.String(), "[model] Switched to model large of provider mock, with a context window of 200000 tokens") {
+		t.Errorf("output = %q, want the switch", out.String())
+	}
+}
+
+func TestRetryRegeneratesLastResponse(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<attempt_completion>\n<result>First answer</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	if _, err := a.Retry(context.Background(), nil); !errors.Is(err, conversation.ErrNoAssistantTurn) {
+		t.Errorf("Retry() before any response error = %v, want ErrNoAssistantTurn", err)
+	}
+	if _, err := a.Run(context.Background(), "Explain"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// The new response is generated by the other model and goes on as a turn of the task
+	other := mock.New(&mock.Fixture{Model: "other", Responses: []mock.Response{
+		{Text: "<attempt_completion>\n<result>Second answer</result>\n</attempt_completion>"},
+	}})
+	result, err := a.Retry(context.Background(), other)
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if result.Completion != "Second answer" || result.Turns != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	// The discarded response is not sent to the other model
+	if messages := other.Requests()[0].Messages; len(messages) != 1 {
+		t.Errorf("messages = %+v, want the task only", messages)
+	}
+	turns := a.conversation.Turns()
+	last := turns[len(turns)-1]
+	if len(turns) != 2 || last.Model != "other" || len(last.Alternatives) != 1 || !strings.Contains(last.Alternatives[0].Content, "First answer") {
+		t.Errorf("turns = %+v, want the new response with the discarded one as an alternative", turns)
+	}
+}
+
+// throttleOutput records the throttles reported to the output
+type throttleOutput struct {
+	strings.Builder
+	reports []string
+}
+
+func (o *throttleOutput) ReportThrottle(wait time.Duration) {
+	o.reports = append(o.reports, "wait "+wait.String())
+}
+
+func (o *throttleOutput) ReportThrottleEnd() {
+	o.reports = append(o.reports, "end")
+}
+
+func TestRunReportsThrottles(t *testing.T) {
+	fixture, err := mock.Parse([]byte(`
+responses:
+  - events:
+      - {type: throttled, throttle: 30s}
+      - {type: throttled, throttle: 12s}
+      - {type: text, text: "<attempt_completion>\n<result>Done</result>\n</attempt_completion>"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := newTestAgent(t, mock.New(fixture), config.AutoApprove{})
+	out := &throttleOutput{}
+	a.opts.Output = out
+
+	if _, err := a.Run(context.Background(), "Do it"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []string{"wait 30s", "wait 12s", "end"}; !slices.Equal(out.reports, want) {
+		t.Errorf("reports = %v, want %v", out.reports, want)
+	}
+	if !strings.Contains(out.String(), "[throttled] Waiting 12s for the rate limits of the provider") {
+		t.Errorf("output = %q, want the wait", out.String())
+	}
+}
+
+// offlineProvider fails the requests with a lost connection until offline reaches zero, after
+// streaming partial
+type offlineProvider struct {
+	*scriptedProvider
+	offline int
+	partial string
+}
+
+func (p *offlineProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	if p.offline == 0 {
+		return p.scriptedProvider.CreateMessage(ctx, systemPrompt, messages, opts)
+	}
+	p.offline--
+	err := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	ch := make(chan provider.StreamEvent, 2)
+	if p.partial != "" {
+		ch <- provider.StreamEvent{Type: "text", Text: p.partial}
+	}
+	ch <- provider.StreamEvent{Type: "error", Text: "Error: " + err.Error(), Err: err}
+	close(ch)
+	return ch, nil
+}
+
+// connectivityOutput records the connectivity reported to the output
+type connectivityOutput struct {
+	strings.Builder
+	reports []string
+}
+
+func (o *connectivityOutput) ReportOffline(err error) {
+	o.reports = append(o.reports, "offline")
+}
+
+func (o *connectivityOutput) ReportOnline() {
+	o.reports = append(o.reports, "online")
+}
+
+func TestRunQueuesRequestsWhileOffline(t *testing.T) {
+	p := &offlineProvider{scriptedProvider: &scriptedProvider{responses: []string{
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}}, offline: 3, partial: "<attempt_completion>\n<result>"}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	a.offlineRetry = time.Millisecond
+	out := &connectivityOutput{}
+	a.opts.Output = out
+
+	result, err := a.Run(context.Background(), "Do it")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Completion != "Done" || p.offline != 0 {
+		t.Errorf("result = %+v after %d failures left", result, p.offline)
+	}
+	// The queued request is the one that failed, with the pending user message
+	if got := p.lastMessage(0); !strings.Contains(got, "Do it") {
+		t.Errorf("queued message = %q", got)
+	}
+	if got := strings.Join(out.reports, ","); got != "offline,online" {
+		t.Errorf("reports = %s, want offline,online", got)
+	}
+	if !strings.Contains(out.String(), "[offline] The request is queued") {
+		t.Errorf("output = %q", out.String())
+	}
+	// The text streamed before the connection was lost is not printed again
+	if n := strings.Count(out.String(), "<attempt_completion>"); n != 1 {
+		t.Errorf("the partial response was printed %d times: %q", n, out.String())
+	}
+
+	// The request is given up after offlineWait
+	p = &offlineProvider{scriptedProvider: &scriptedProvider{}, offline: -1}
+	a, _ = newTestAgent(t, p, config.AutoApprove{})
+	a.offlineRetry = time.Millisecond
+	a.offlineWait = 5 * time.Millisecond
+	if _, err := a.Run(context.Background(), "Do it"); err == nil || !provider.IsConnectivityError(err) {
+		t.Errorf("Run() error = %v, want the connectivity error", err)
+	}
+
+	// Cancelling the run stops waiting for the connection
+	p = &offlineProvider{scriptedProvider: &scriptedProvider{}, offline: -1}
+	a, _ = newTestAgent(t, p, config.AutoApprove{})
+	a.offlineRetry = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := a.Run(ctx, "Do it"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want the cancellation", err)
+	}
+}
+
+func TestRunDeniesUnapprovedTools(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>hello.txt</path>\n<content>hello</content>\n</write_to_file>",
+		"<execute_command>\n<command>echo hi</command>\n<requires_approval>true</requires_approval>\n</execute_command>",
+		"<attempt_completion>\n<result>Could not do it</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{ReadFiles: true, ExecuteCommands: true})
+
+	if _, err := a.Run(context.Background(), "Create hello.txt"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "hello.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("an unapproved edit was written")
+	}
+	for i := 1; i <= 2; i++ {
+		if got := p.lastMessage(i); !strings.Contains(got, "The user denied this operation.") {
+			t.Errorf("message %d = %q, want a denial", i, got)
+		}
+	}
+}
+
+func TestRunStopsWhenInputIsNeeded(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<ask_followup_question>\n<question>Which file?</question>\n</ask_followup_question>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+
+	result, err := a.Run(context.Background(), "Fix it")
+	if !errors.Is(err, ErrNeedsInput) {
+		t.Fatalf("Run() error = %v, want ErrNeedsInput", err)
+	}
+	if result.Question != "Which file?" {
+		t.Errorf("question = %q", result.Question)
+	}
+}
+
+func TestRunStopsWithoutToolUse(t *testing.T) {
+	p := &scriptedProvider{responses: []string{"Hmm.", "Let me think.", "Still thinking."}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+
+	if _, err := a.Run(context.Background(), "Fix it"); !errors.Is(err, ErrNoToolUse) {
+		t.Fatalf("Run() error = %v, want ErrNoToolUse", err)
+	}
+	if got := p.lastMessage(1); got != noToolUsedMessage {
+		t.Errorf("message = %q, want the no tool used reminder", got)
+	}
+}
+
+func TestRunStopsAtTurnLimit(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<list_files>\n<path>.</path>\n</list_files>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{ReadFiles: true})
+	a.opts.MaxTurns = 2
+
+	result, err := a.Run(context.Background(), "Look around")
+	if !errors.Is(err, ErrTurnLimit) || result.Turns != 2 {
+		t.Fatalf("Run() = %+v, %v, want ErrTurnLimit after 2 turns", result, err)
+	}
+}
+
+func TestRunRunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in tests are shell commands")
+	}
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>hello.txt</path>\n<content>hello</content>\n</write_to_file>",
+		"<execute_command>\n<command>touch ran</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true, ExecuteCommands: true})
+	a.opts.Hooks = hooks.New(config.Hooks{
+		OnTaskStart:    []string{"echo start >> events.log"},
+		OnToolApproved: []string{`grep -q '"tool":"execute_command"' && exit 1; true`},
+		OnFileWritten:  []string{"echo written >> events.log"},
+		OnTaskComplete: []string{`grep -q '"status":"completed"' && echo complete >> events.log`},
+	})
+
+	if _, err := a.Run(context.Background(), "Create hello.txt"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	events, err := os.ReadFile(filepath.Join(workingDir, "events.log"))
+	if err != nil || string(events) != "start\nwritten\ncomplete\n" {
+		t.Errorf("events = %q, %v", events, err)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "ran")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a command denied by a hook was run")
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "denied by a hook") {
+		t.Errorf("tool result message = %q, want the hook denial", got)
+	}
+}
+
+func TestRunReportsFileWrittenDiagnostics(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>main.go</path>\n<content>package main</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+	a.opts.Hooks = hooks.New(config.Hooks{OnFileWritten: []string{"echo 'main.go:1: missing func main'; exit 1"}})
+
+	if _, err := a.Run(context.Background(), "Create main.go"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := p.lastMessage(1)
+	if !strings.Contains(got, "Created main.go.") || !strings.Contains(got, "<diagnostics>") || !strings.Contains(got, "main.go:1: missing func main") {
+		t.Errorf("tool result message = %q, want the diagnostics", got)
+	}
+}
+
+func TestRunPausesAtTimeLimit(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>a.txt</path>\n<content>a</content>\n</write_to_file>",
+		"<write_to_file>\n<path>b.txt</path>\n<content>b</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+	var output strings.Builder
+	a.opts.Output = &output
+	a.opts.TimeLimit = 10 * time.Minute
+	a.opts.SummaryInterval = 5 * time.Minute
+	// Every turn takes four minutes
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time {
+		defer func() { now = now.Add(4 * time.Minute) }()
+		return now
+	}
+
+	result, err := a.Run(context.Background(), "Create files")
+	if !errors.Is(err, ErrTimeLimit) || result.Turns != 2 {
+		t.Fatalf("Run() = %+v, %v, want ErrTimeLimit after 2 turns", result, err)
+	}
+	want := []string{
+		"[progress] Progress after 8m0s: 1 turn(s), 1 file(s) changed (a.txt)",
+		"[progress] Progress after 12m0s: 2 turn(s), 2 file(s) changed (a.txt, b.txt), 20 input and 10 output tokens, $0.0000. Last step: [write_to_file] b.txt Time limit reached, pausing for review.",
+	}
+	for _, s := range want {
+		if !strings.Contains(output.String(), s) {
+			t.Errorf("output does not contain %q:\n%s", s, output.String())
+		}
+	}
+}
+
+func TestRunSummarizesOlderTurns(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}, window: 1}
+	summarizer := &scriptedProvider{responses: []string{"Listed the files twice.", "Listed the files three times."}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{ReadFiles: true})
+	var output strings.Builder
+	a.opts.Output = &output
+	a.opts.Summarizer = &conversation.Summarizer{Provider: summarizer, KeepTurns: 2}
+
+	result, err := a.Run(context.Background(), "Look around")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// The third request is the first with older turns to summarize
+	messages := p.requests[2]
+	if len(messages) != 3 || !strings.Contains(messages[0].Content, "Look around") || !strings.Contains(messages[0].Content, "Listed the files twice.") {
+		t.Errorf("third request = %+v", messages)
+	}
+	if !strings.Contains(output.String(), "[context] Summarized 3 earlier turn(s)") {
+		t.Errorf("output = %q", output.String())
+	}
+	if result.Usage.InputTokens != 60 {
+		t.Errorf("input tokens = %d, want the summary included", result.Usage.InputTokens)
+	}
+}
+
+func TestRunListsRecentFiles(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>a.txt</path>\n<content>a</content>\n</write_to_file>",
+		"<read_file>\n<path>a.txt</path>\n</read_file>",
+		"<list_files>\n<path>.</path>\n</list_files>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{ReadFiles: true, EditFiles: true})
+	a.opts.RecentFiles = recent.NewTracker(0)
+
+	if _, err := a.Run(context.Background(), "Write a.txt"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.lastMessage(0); strings.Contains(got, "<environment_details>") {
+		t.Errorf("task message = %q, want no environment details before a file is used", got)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "<environment_details>\n# Recently Relevant Files\n") || !strings.Contains(got, "a.txt (edited)") {
+		t.Errorf("message after the edit = %q", got)
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "a.txt (edited, read)") {
+		t.Errorf("message after the read = %q", got)
+	}
+	// Unchanged environment details are not sent again
+	if got := p.lastMessage(3); strings.Contains(got, "<environment_details>") {
+		t.Errorf("message after list_files = %q", got)
+	}
+}
+
+func TestRunWritesFileInParts(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>big.txt</path>\n<content>line 1\nline 2\n</content>\n<mode>append</mode>\n</write_to_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+		"<write_to_file>\n<path>big.txt</path>\n<content>line 3</content>\n<mode>append</mode>\n</write_to_file>",
+		"<write_to_file>\n<path>big.txt</path>\n<content>line 4</content>\n<mode>finalize</mode>\n</write_to_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+
+	result, err := a.Run(context.Background(), "Write big.txt")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Turns != 5 {
+		t.Errorf("turns = %d, want the first completion refused", result.Turns)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "Received part 1 of big.txt") {
+		t.Errorf("message after the first part = %q", got)
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "not finalized: big.txt") {
+		t.Errorf("message after the early completion = %q", got)
+	}
+	if got := p.lastMessage(4); !strings.Contains(got, "Created big.txt. Assembled from 3 part(s).") {
+		t.Errorf("message after finalizing = %q", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workingDir, "big.txt"))
+	if err != nil || string(data) != "line 1\nline 2\nline 3\nline 4" {
+		t.Errorf("big.txt = %q, %v", data, err)
+	}
+}
+
+func TestWriteFileInModeRejectsUnknownMode(t *testing.T) {
+	a, workingDir := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	if _, err := a.writeFileInMode(context.Background(), "a.txt", "a", "prepend", 1); err == nil {
+		t.Error("writeFileInMode() with an unknown mode succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt was written: %v", err)
+	}
+}
+
+// streamingOutput records the tool uses streamed to it
+type streamingOutput struct {
+	strings.Builder
+	toolUses []assistantmessage.ToolUse
+}
+
+func (o *streamingOutput) StreamToolUse(toolUse assistantmessage.ToolUse) {
+	o.toolUses = append(o.toolUses, toolUse)
+}
+
+func TestRunStreamsToolUses(t *testing.T) {
+	p := &scriptedProvider{chunkSize: 8, responses: []string{
+		"<write_to_file>\n<path>a.txt</path>\n<content>\none\ntwo\n</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+	output := &streamingOutput{}
+	a.opts.Output = output
+
+	if _, err := a.Run(context.Background(), "Write a.txt"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var contents []string
+	for _, toolUse := range output.toolUses {
+		if toolUse.Name == assistantmessage.WriteToFileToolName && toolUse.Partial {
+			contents = append(contents, toolUse.Params[assistantmessage.ContentParam])
+		}
+	}
+	if !slices.Contains(contents, "one") || !slices.Contains(contents, "one\ntwo") {
+		t.Errorf("streamed contents = %q, want the content as it grows", contents)
+	}
+	last := output.toolUses[len(output.toolUses)-1]
+	if last.Name != assistantmessage.AttemptCompletionToolName || last.Partial || last.Params[assistantmessage.ResultParam] != "done" {
+		t.Errorf("last streamed tool use = %+v, want the complete attempt_completion", last)
+	}
+}
+
+func TestRunContinuesTruncatedResponse(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<attempt_completion>\n<result>do",
+		"ne</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+
+	result, err := a.Run(context.Background(), "Finish")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Completion != "done" || result.Turns != 1 {
+		t.Errorf("result = %+v, want the stitched completion in one turn", result)
+	}
+	if got := p.lastMessage(1); got != assistantmessage.ContinuationPrompt {
+		t.Errorf("continuation request ends with %q", got)
+	}
+	turns := a.conversation.Turns()
+	if got := turns[len(turns)-1].Content; got != "<attempt_completion>\n<result>done</result>\n</attempt_completion>" {
+		t.Errorf("assistant message = %q, want the stitched response", got)
+	}
+}
+
+func TestContextRootsAreReadOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir, shared := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{"util.go": "package util\n", "secret.txt": "token", ".golineignore": "secret.txt\n"} {
+		if err := os.WriteFile(filepath.Join(shared, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	applier, err := apply.NewApplier("task-1", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("NewApplier() error = %v", err)
+	}
+	a := New(Options{
+		TaskID:       "task-1",
+		WorkingDir:   workingDir,
+		Provider:     &scriptedProvider{},
+		Approver:     PolicyApprover{},
+		Applier:      applier,
+		ContextRoots: []config.ContextRoot{{Name: "shared", Path: shared}},
+	})
+
+	if content, err := a.readFile("shared:util.go", "", ""); err != nil || content != "1 | package util" {
+		t.Errorf("readFile(shared:util.go) = %q, %v", content, err)
+	}
+	if _, err := a.readFile("shared:secret.txt", "", ""); err == nil {
+		t.Error("readFile() of a file ignored in the context directory succeeded")
+	}
+	if output, err := a.searchFiles("shared:", "package", ""); err != nil || output != "shared:util.go:1: package util" {
+		t.Errorf("searchFiles() = %q, %v", output, err)
+	}
+
+	for _, path := range []string{"shared:util.go", filepath.Join(shared, "new.go")} {
+		if _, err := a.writeFileInMode(context.Background(), path, "package x\n", "", 1); err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("writeFileInMode(%s) error = %v, want read-only", path, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(shared, "util.go")); string(data) != "package util\n" {
+		t.Errorf("util.go was modified: %q", data)
+	}
+}
+
+func TestEditsOutsideWorkingDirAreRefused(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>../escaped.txt</path>\n<content>x\n</content>\n</write_to_file>",
+		"<write_to_file>\n<path>" + outside + "</path>\n<content>x\n</content>\n</write_to_file>",
+		"<replace_in_file>\n<path>" + outside + "</path>\n<diff>\n------- SEARCH\nx\n=======\ny\n+++++++ REPLACE\n</diff>\n</replace_in_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+
+	if _, err := a.Run(context.Background(), "Write outside"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, path := range []string{filepath.Join(filepath.Dir(workingDir), "escaped.txt"), outside} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was written outside the working directory: %v", path, err)
+		}
+	}
+	for n := 1; n <= 3; n++ {
+		if got := p.lastMessage(n); !strings.Contains(got, "outside the working directory") {
+			t.Errorf("tool result = %q, want the edit refused", got)
+		}
+	}
+}
+
+// firstHunkRejecter approves the edits and rejects the first hunk of each of them
+type firstHunkRejecter struct {
+	PolicyApprover
+}
+
+func (firstHunkRejecter) ReviewEdit(ctx context.Context, path, original, proposed string) (string, error) {
+	hunks := apply.SplitHunks(original, proposed)
+	hunks[0].Accepted = false
+	return apply.JoinHunks(original, hunks), nil
+}
+
+func TestRunSendsEditFeedback(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>a.txt</path>\n<content>ONE\ntwo\nTHREE\n</content>\n</write_to_file>",
+		"<write_to_file>\n<path>b.txt</path>\n<content>new\n</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{})
+	a.opts.Approver = firstHunkRejecter{PolicyApprover{AutoApprove: config.AutoApprove{EditFiles: true}}}
+	if err := os.WriteFile(filepath.Join(workingDir, "a.txt"), []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Run(context.Background(), "Capitalize"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workingDir, "a.txt")); string(data) != "one\ntwo\nTHREE" {
+		t.Errorf("a.txt = %q, want the first hunk rejected", data)
+	}
+	got := p.lastMessage(1)
+	for _, want := range []string{"Updated a.txt.", "The user modified your change to a.txt", "-ONE\n+one\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message after the edit = %q, want it to contain %q", got, want)
+		}
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "The user rejected your change to b.txt") {
+		t.Errorf("message after the rejected edit = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt was written: %v", err)
+	}
+}
+
+func TestWriteFileMergesModifications(t *testing.T) {
+	a, workingDir := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	path := filepath.Join(workingDir, "a.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\nfour\nfive\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.readFile("a.txt", "", ""); err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\nfour\nFIVE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := a.writeFile(context.Background(), "a.txt", "ONE\ntwo\nthree\nfour\nfive\n", 1)
+	if err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "ONE\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("a.txt = %q, want both changes", data)
+	}
+	if !strings.Contains(output, "your change was merged with the modifications") {
+		t.Errorf("output = %q, want the merge notice", output)
+	}
+
+	// Overlapping changes are refused without a resolver
+	if err := os.WriteFile(path, []byte("uno\ntwo\nthree\nfour\nFIVE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.writeFile(context.Background(), "a.txt", "1\ntwo\nthree\nfour\nFIVE\n", 2); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("writeFile() error = %v, want the overlap refused", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "uno\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("a.txt = %q, want the modification kept", data)
+	}
+}
+
+// reviewModifier modifies the reviewed file like a user editing it during the review, and
+// resolves the conflicts by keeping the merged content
+type reviewModifier struct {
+	PolicyApprover
+	path      string
+	conflicts []apply.Conflict
+}
+
+func (r *reviewModifier) ReviewEdit(ctx context.Context, path, original, proposed string) (string, error) {
+	return proposed, os.WriteFile(r.path, []byte(strings.Replace(original, "c", "C", 1)), 0644)
+}
+
+func (r *reviewModifier) ResolveConflict(ctx context.Context, conflict apply.Conflict) (string, error) {
+	r.conflicts = append(r.conflicts, conflict)
+	return conflict.Merged, nil
+}
+
+func TestEditResolvesModificationsDuringReview(t *testing.T) {
+	a, workingDir := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	path := filepath.Join(workingDir, "a.txt")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resolver := &reviewModifier{path: path}
+	a.opts.Approver = resolver
+
+	output, err := a.replaceInFile(context.Background(), "a.txt", "<<<<<<< SEARCH\na\n=======\nA\n>>>>>>> REPLACE", 1)
+	if err != nil {
+		t.Fatalf("replaceInFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "A\nb\nC\n" {
+		t.Errorf("a.txt = %q, want the edit merged with the modification", data)
+	}
+	if len(resolver.conflicts) != 1 || resolver.conflicts[0].Current != "a\nb\nC\n" || resolver.conflicts[0].Conflicts != 0 {
+		t.Errorf("conflicts = %+v, want the modification made during the review", resolver.conflicts)
+	}
+	if !strings.Contains(output, "Updated a.txt.") || !strings.Contains(output, "merged") {
+		t.Errorf("output = %q", output)
+	}
+}
+
+func TestRunEvaluatesCommandPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands run with sh")
+	}
+	p := &scriptedProvider{responses: []string{
+		"<execute_command>\n<command>echo allowed</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		"<execute_command>\n<command>echo hi && git push --force</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	// Running commands is not auto-approved, the allow rule runs echo anyway
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	policy, err := cmdpolicy.New(config.CommandPolicy{Allow: []string{"echo *"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.opts.CommandPolicy = policy
+
+	if _, err := a.Run(context.Background(), "Run commands"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "allowed") || strings.Contains(got, "denied") {
+		t.Errorf("message after the allowed command = %q", got)
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "blocked by the rule") {
+		t.Errorf("message after the denied command = %q", got)
+	}
+}
+
+func TestRunInReadOnlyMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands run with sh")
+	}
+	p := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>a.txt</path>\n<content>a\n</content>\n</write_to_file>",
+		"<execute_command>\n<command>touch b.txt</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		"<execute_command>\n<command>echo readable</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	// The approvals do not matter in read-only mode
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true, ExecuteCommands: true})
+	readOnly, err := cmdpolicy.NewReadOnly(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.opts.ReadOnly = readOnly
+
+	if _, err := a.Run(context.Background(), "Explore"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "disabled in read-only mode") {
+		t.Errorf("message after the write = %q", got)
+	}
+	if got := p.lastMessage(2); !strings.Contains(got, "only the commands reading the workspace") {
+		t.Errorf("message after the modifying command = %q", got)
+	}
+	if got := p.lastMessage(3); !strings.Contains(got, "readable") {
+		t.Errorf("message after the read command = %q", got)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(workingDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was written: %v", name, err)
+		}
+	}
+}
+
+func TestRunWithOutboundPolicy(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<read_file>\n<path>customers/list.csv</path>\n</read_file>",
+		"<read_file>\n<path>main.go</path>\n</read_file>",
+		"<attempt_completion>\n<result>done</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{ReadFiles: true})
+	for name, content := range map[string]string{"customers/list.csv": "alice,bob\n", "main.go": "package main\n"} {
+		path := filepath.Join(workingDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, err := audit.Open("task-1", config.Outbound{MaxRequestSize: "1MB"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	opts := a.opts
+	opts.DeniedPaths = []string{"customers/"}
+	opts.Audit = log
+	a = New(opts)
+
+	if _, err := a.Run(context.Background(), "Read the files"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "blocked by the .golineignore file or the outbound policy") {
+		t.Errorf("message after reading the denied file = %q", got)
+	}
+	entries, err := audit.Load("task-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var files []string
+	requests := 0
+	for _, entry := range entries {
+		switch entry.Kind {
+		case audit.KindFile:
+			files = append(files, entry.Path)
+		case audit.KindRequest:
+			requests++
+		}
+	}
+	if strings.Join(files, ",") != "main.go" || requests != 3 {
+		t.Errorf("audited files %v and %d requests, want [main.go] and 3", files, requests)
+	}
+
+	// A request over the limit is not sent
+	small, err := audit.Open("task-1", config.Outbound{MaxRequestSize: "10"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	opts.Audit = small
+	if _, err := New(opts).Run(context.Background(), "Read the files"); err == nil || !strings.Contains(err.Error(), "outbound policy") {
+		t.Errorf("Run() over the request limit error = %v", err)
+	}
+}
+
+func TestRunAutoFixesFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands run with sh")
+	}
+	failing := "<execute_command>\n<command>test -f fixed</command>\n<requires_approval>false</requires_approval>\n</execute_command>"
+	p := &scriptedProvider{responses: []string{
+		failing,
+		"<write_to_file>\n<path>fixed</path>\n<content>yes</content>\n</write_to_file>",
+		failing,
+		"<execute_command>\n<command>rm fixed</command>\n<requires_approval>false</requires_approval>\n</execute_command>",
+		failing,
+		failing,
+		failing,
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{EditFiles: true, ExecuteCommands: true})
+	a.opts.AutoFixAttempts = 2
+	var output strings.Builder
+	a.opts.Output = &output
+
+	result, err := a.Run(context.Background(), "Make the check pass")
+	if !errors.Is(err, ErrNeedsInput) {
+		t.Fatalf("Run() error = %v, want ErrNeedsInput", err)
+	}
+	if got := p.lastMessage(1); !strings.Contains(got, "[auto-fix attempt 1/2] The command test -f fixed failed.") {
+		t.Errorf("message after the first failure = %q", got)
+	}
+	if got := p.lastMessage(3); strings.Contains(got, "auto-fix") {
+		t.Errorf("message after the check passed = %q", got)
+	}
+	// The attempts start over once the check passed
+	if got := p.lastMessage(5); !strings.Contains(got, "[auto-fix attempt 1/2]") {
+		t.Errorf("message after the check failed again = %q", got)
+	}
+	if got := p.lastMessage(6); !strings.Contains(got, "[auto-fix attempt 2/2]") {
+		t.Errorf("message after the second attempt = %q", got)
+	}
+	if want := "The command test -f fixed failed again after 2 auto-fix attempts. How should the task go on?"; result.Question != want {
+		t.Errorf("question = %q, want %q", result.Question, want)
+	}
+	if got := strings.Count(output.String(), "[auto-fix] Auto-fix attempt"); got != 3 {
+		t.Errorf("auto-fix attempts shown = %d, want 3 in %q", got, output.String())
+	}
+}
+
+func TestRunAsksForGuidanceAfterMistakes(t *testing.T) {
+	responses := []string{
+		"<replace_in_file>\n<path>main.go</path>\n<diff>\n<<<<<<< SEARCH\nmissing\n=======\nfound\n>>>>>>> REPLACE\n</diff>\n</replace_in_file>",
+		"I am not sure what to do.",
+		"<read_file>\n</read_file>",
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	}
+	p := &scriptedProvider{responses: responses}
+	a, workingDir := newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+	if err := os.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a.opts.Approver = &interactiveApprover{PolicyApprover: PolicyApprover{AutoApprove: config.AutoApprove{EditFiles: true}}, answer: "Read main.go first"}
+
+	if _, err := a.Run(context.Background(), "Fix main.go"); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := p.lastMessage(2); strings.Contains(got, "<feedback>") {
+		t.Errorf("guidance asked after 2 mistakes: %q", got)
+	}
+	if got := p.lastMessage(3); !strings.Contains(got, "<feedback>\nRead main.go first\n</feedback>") {
+		t.Errorf("message after 3 mistakes = %q, want the guidance of the user", got)
+	}
+
+	// Without anybody to answer, the run stops for input
+	p = &scriptedProvider{responses: responses}
+	a, workingDir = newTestAgent(t, p, config.AutoApprove{EditFiles: true})
+	if err := os.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), "Fix main.go")
+	if !errors.Is(err, ErrNeedsInput) {
+		t.Fatalf("Run() error = %v, want ErrNeedsInput", err)
+	}
+	want := "The AI made 3 mistakes in a row (responses without a tool use: 1, tool uses with invalid parameters: 1, diffs that did not apply: 1). What guidance can you give it to proceed?"
+	if result.Question != want {
+		t.Errorf("question = %q, want %q", result.Question, want)
+	}
+}
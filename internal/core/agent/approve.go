@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	"github.com/kazz187/goline/internal/core/prompts"
+)
+
+// ErrDenied is the error of a tool use that was not approved
+var ErrDenied = errors.New("the user denied this operation")
+
+// Approver decides whether a tool use may run
+type Approver interface {
+	// Approve reports whether the tool use may run
+	Approve(ctx context.Context, toolUse assistantmessage.ToolUse) (bool, error)
+}
+
+// PolicyOverrider is implemented by the approvers that can ask the user whether to run a
+// command denied by the command policy. Denied commands never run with other approvers.
+type PolicyOverrider interface {
+	// OverrideCommandPolicy reports whether the command denied by the rule may run anyway
+	OverrideCommandPolicy(ctx context.Context, command, rule string) (bool, error)
+}
+
+// checkReadOnly refuses the tool uses modifying the workspace in read-only mode
+func (a *Agent) checkReadOnly(toolUse assistantmessage.ToolUse) error {
+	if a.opts.ReadOnly == nil {
+		return nil
+	}
+	switch toolUse.Name {
+	case assistantmessage.WriteToFileToolName, assistantmessage.ReplaceInFileToolName:
+		return fmt.Errorf("%s is disabled in read-only mode, the files cannot be modified: describe the change to the user instead", toolUse.Name)
+	case assistantmessage.ExecuteCommandToolName:
+		if !a.opts.ReadOnly.Allows(toolUse.Params[assistantmessage.CommandParam]) {
+			return errors.New("only the commands reading the workspace, e.g. ls, cat, grep or git log, without output redirections run in read-only mode")
+		}
+	default:
+		// Plugins run arbitrary code, like commands
+		if !assistantmessage.IsBuiltinTool(toolUse.Name) {
+			return fmt.Errorf("%s is disabled in read-only mode", toolUse.Name)
+		}
+	}
+	return nil
+}
+
+// approve decides whether a tool use may run. Commands are evaluated by the command policy
+// first, which runs the allowed ones without asking the approver and refuses the denied ones.
+func (a *Agent) approve(ctx context.Context, toolUse assistantmessage.ToolUse) (bool, error) {
+	if restricted, ok := a.opts.Approver.(toolsApprover); ok && !slices.Contains(restricted.tools, toolUse.Name) {
+		return false, nil
+	}
+	if toolUse.Name != assistantmessage.ExecuteCommandToolName {
+		return a.opts.Approver.Approve(ctx, toolUse)
+	}
+
+	command := toolUse.Params[assistantmessage.CommandParam]
+	decision := a.opts.CommandPolicy.Evaluate(command)
+	switch decision.Verdict {
+	case cmdpolicy.Allow:
+		return true, nil
+	case cmdpolicy.Deny:
+		if overrider, ok := a.opts.Approver.(PolicyOverrider); ok {
+			approved, err := overrider.OverrideCommandPolicy(ctx, command, decision.Rule)
+			if err != nil || approved {
+				return approved, err
+			}
+		}
+		return false, fmt.Errorf("the command is blocked by the rule %q of the command policy", decision.Rule)
+	default:
+		return a.opts.Approver.Approve(ctx, toolUse)
+	}
+}
+
+// EditReviewer is implemented by the approvers that let the user review the content of a file
+// edit before it is written, e.g. reject some of its hunks (see apply.SplitHunks) or change it
+type EditReviewer interface {
+	// ReviewEdit returns the content to write to path instead of proposed: proposed to accept
+	// the edit as is, original to reject it
+	ReviewEdit(ctx context.Context, path, original, proposed string) (string, error)
+}
+
+// editFeedbackMessage tells the AI how the user changed one of its edits before it was written
+const editFeedbackMessage = `<user_edit_feedback>
+The user modified your change to %s before it was written. This diff goes from the content you proposed to the content that was written:
+
+%s</user_edit_feedback>
+
+The file has the user's version now. Do not revert the user's modifications, and follow the preferences they show for the rest of the task.`
+
+// reviewEdit lets the user review the content of an edit when the approver supports it.
+// It returns the content to write and, when the user changed it, the feedback for the AI.
+func (a *Agent) reviewEdit(ctx context.Context, relPath, original, proposed string) (string, string, error) {
+	reviewer, ok := a.opts.Approver.(EditReviewer)
+	if !ok || proposed == original {
+		return proposed, "", nil
+	}
+	content, err := reviewer.ReviewEdit(ctx, relPath, original, proposed)
+	if err != nil {
+		return "", "", err
+	}
+	if content == proposed {
+		return proposed, "", nil
+	}
+	diff := prompts.NewFormatResponse().CreatePrettyPatch(relPath, proposed, content)
+	return content, fmt.Sprintf(editFeedbackMessage, relPath, diff), nil
+}
+
+// ConflictResolver is implemented by the approvers that let the user resolve an edit of a file
+// modified since the AI read it, e.g. in a three-way merge dialog. Without one, the edits merging
+// cleanly with the modifications are written and the others are refused.
+type ConflictResolver interface {
+	// ResolveConflict returns the content to write to the file: conflict.Merged once its
+	// conflicts are resolved, conflict.Proposed to overwrite the modifications, or
+	// conflict.Current to drop the edit
+	ResolveConflict(ctx context.Context, conflict apply.Conflict) (string, error)
+}
+
+// maxConflictAttempts is the number of times an edit is merged with the modifications made
+// while it is written before giving up
+const maxConflictAttempts = 3
+
+// conflictMergedMessage tells the AI its edit was merged with the modifications of the file
+const conflictMergedMessage = "%s was modified since you last read it, and your change was merged with the modifications. Read the file again before changing it further."
+
+// conflictKeptMessage tells the AI the user dropped its edit for the modifications of the file
+const conflictKeptMessage = "%s was modified since you last read it, and the user kept the modifications: your change was not written. Read the file again before changing it further."
+
+// resolveConflict merges an edit with the modifications of the file made since the content the
+// edit was made from, and returns the content to write
+func (a *Agent) resolveConflict(ctx context.Context, conflict apply.Conflict) (string, error) {
+	conflict.Merged, conflict.Conflicts = apply.Merge(conflict.Base, conflict.Current, conflict.Proposed)
+	if resolver, ok := a.opts.Approver.(ConflictResolver); ok {
+		return resolver.ResolveConflict(ctx, conflict)
+	}
+	return mergeCleanly(conflict)
+}
+
+// mergeCleanly returns the merged content of a conflict, refusing the edits overlapping the
+// modifications of the file
+func mergeCleanly(conflict apply.Conflict) (string, error) {
+	if conflict.Conflicts > 0 {
+		return "", fmt.Errorf("%s was modified since you last read it and %d of your changes overlap the modifications, read the file again and redo your change on its current content", conflict.Path, conflict.Conflicts)
+	}
+	return conflict.Merged, nil
+}
+
+// PolicyApprover approves the tool uses allowed by an auto-approval policy and denies the others.
+// It is used when nobody is there to approve tool uses.
+type PolicyApprover struct {
+	// AutoApprove lists the actions that are approved
+	AutoApprove config.AutoApprove
+}
+
+// Approve implements Approver
+func (p PolicyApprover) Approve(ctx context.Context, toolUse assistantmessage.ToolUse) (bool, error) {
+	switch toolUse.Name {
+	case assistantmessage.ReadFileToolName,
+		assistantmessage.ListFilesToolName,
+		assistantmessage.SearchFilesToolName,
+		assistantmessage.SemanticSearchToolName,
+		assistantmessage.ListCodeDefinitionNamesToolName:
+		return p.AutoApprove.ReadFiles, nil
+	case assistantmessage.WriteToFileToolName,
+		assistantmessage.ReplaceInFileToolName:
+		return p.AutoApprove.EditFiles, nil
+	case assistantmessage.ExecuteCommandToolName:
+		// Commands the AI flags as needing approval always need a person
+		return p.AutoApprove.ExecuteCommands && toolUse.Params[assistantmessage.RequiresApprovalParam] != "true", nil
+	case assistantmessage.NewTaskToolName:
+		// The tool uses of the child task are approved one by one
+		return true, nil
+	default:
+		// Plugins run arbitrary code, like commands
+		if !assistantmessage.IsBuiltinTool(toolUse.Name) {
+			return p.AutoApprove.ExecuteCommands, nil
+		}
+		return false, nil
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// DefaultAutoFixAttempts is the number of attempts to fix a failure before the user is asked
+const DefaultAutoFixAttempts = 3
+
+// autoFixMessage is appended to the result of a failed command or edit check to have the AI fix it
+const autoFixMessage = `[auto-fix attempt %d/%d] The %s failed. Fix the cause of the failure shown above, then check again that it passes.`
+
+// autoFixQuestion is put to the user once a failure persists after the auto-fix attempts
+const autoFixQuestion = "The %s failed again after %d auto-fix attempts. How should the task go on?"
+
+// failedCheck returns what failed in the result of a tool use: the command that exited with an
+// error or the file whose checks reported problems after it was written
+func failedCheck(toolUse assistantmessage.ToolUse, output string) (check string, failed bool) {
+	switch toolUse.Name {
+	case assistantmessage.ExecuteCommandToolName:
+		check = "command " + toolUse.Params[assistantmessage.CommandParam]
+		return check, strings.HasPrefix(output, commandFailed)
+	case assistantmessage.WriteToFileToolName, assistantmessage.ReplaceInFileToolName:
+		check = "checks of " + toolUse.Params[assistantmessage.PathParam]
+		return check, strings.Contains(output, diagnosticsTag)
+	}
+	return "", false
+}
+
+// autoFix feeds the failure of a command or of the checks run after an edit back to the AI,
+// returning the message appended to the tool result. The attempts are counted per command and
+// per file until it passes, and once Options.AutoFixAttempts attempts failed the user is asked how
+// to go on, the run ending with ErrNeedsInput when nobody can answer.
+func (a *Agent) autoFix(ctx context.Context, toolUse assistantmessage.ToolUse, output string, result *Result) (string, error) {
+	check, failed := failedCheck(toolUse, output)
+	if check == "" || a.opts.AutoFixAttempts <= 0 {
+		return "", nil
+	}
+	if !failed {
+		delete(a.fixAttempts, check)
+		return "", nil
+	}
+
+	attempt := a.fixAttempts[check] + 1
+	if attempt <= a.opts.AutoFixAttempts {
+		a.fixAttempts[check] = attempt
+		indicator := fmt.Sprintf("Auto-fix attempt %d/%d: the %s failed", attempt, a.opts.AutoFixAttempts, check)
+		fmt.Fprintf(a.opts.Output, "[auto-fix] %s\n", indicator)
+		if a.opts.Recorder != nil {
+			if err := a.opts.Recorder.RecordSystemEvent(indicator, pb.SystemEventType_SYSTEM_EVENT_TYPE_PROGRESS); err != nil {
+				slog.Warn("Failed to record task history", "error", err)
+			}
+		}
+		return fmt.Sprintf(autoFixMessage, attempt, a.opts.AutoFixAttempts, check), nil
+	}
+
+	delete(a.fixAttempts, check)
+	result.Question = fmt.Sprintf(autoFixQuestion, check, a.opts.AutoFixAttempts)
+	result.Options = nil
+	answerer, ok := a.opts.Approver.(QuestionAnswerer)
+	if !ok {
+		return "", ErrNeedsInput
+	}
+	answer, err := answerer.AnswerQuestion(ctx, result.Question, nil)
+	if err != nil {
+		return "", err
+	}
+	result.Question = ""
+	return fmt.Sprintf("The %s failed again after %d auto-fix attempts and the user was asked how to go on:\n<answer>\n%s\n</answer>", check, a.opts.AutoFixAttempts, answer), nil
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kazz187/goline/internal/core/conversation"
+)
+
+const (
+	// charsPerToken is the average length of a token, used to convert the remaining context
+	// window to a size of output
+	charsPerToken = 4
+	// toolOutputShare is the share of the remaining context window one tool output may take
+	toolOutputShare = 0.25
+	// minToolOutput is the smallest budget of a tool output, so that the tools stay usable
+	// when the context window is nearly full and older turns are about to be summarized
+	minToolOutput = 2000
+	// headShare is the share of a truncated output kept from its beginning, the rest is kept
+	// from its end where commands usually summarize their failures
+	headShare = 0.25
+)
+
+// matchContextWidths are the widths of the lines of search results tried in turn until the
+// results fit their budget, 0 keeping the whole lines
+var matchContextWidths = []int{0, 200, 80}
+
+// outputBudget returns the size in bytes a tool output may take: a share of what remains of
+// the context window of the model, between minToolOutput and maxToolOutput
+func (a *Agent) outputBudget() int {
+	window := a.opts.Provider.GetModel().MaxTokens
+	if window <= 0 {
+		return maxToolOutput
+	}
+	used := conversation.EstimateTokens(a.opts.SystemPrompt, a.conversation.Messages())
+	remaining := float64((window-used)*charsPerToken) * toolOutputShare
+	return max(minToolOutput, min(maxToolOutput, int(remaining)))
+}
+
+// truncateHeadTail keeps the beginning and the end of an output that is larger than limit
+// bytes, replacing its middle with a marker telling how much was left out
+func truncateHeadTail(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	head := runeStart(output, int(float64(limit)*headShare))
+	tail := runeStart(output, len(output)-(limit-head))
+	return fmt.Sprintf("%s\n[... %d bytes truncated ...]\n%s", output[:head], tail-head, output[tail:])
+}
+
+// runeStart moves an index of s back to the start of the rune it is in
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// shortenMatch shortens a line around the match at loc to about width bytes, marking the
+// parts left out with "…"
+func shortenMatch(line string, loc []int, width int) string {
+	if width <= 0 || len(line) <= width {
+		return line
+	}
+	start := max(0, loc[0]-(width-(loc[1]-loc[0]))/2)
+	end := min(len(line), start+width)
+	start = max(0, end-width)
+	start, end = runeStart(line, start), runeStart(line, end)
+	shortened := line[start:end]
+	if start > 0 {
+		shortened = "…" + shortened
+	}
+	if end < len(line) {
+		shortened += "…"
+	}
+	return shortened
+}
+
+// searchMatch is a line matching a search
+type searchMatch struct {
+	// location is the path and line number of the match, e.g. main.go:12
+	location string
+	// line is the matching line and loc the position of the match in it
+	line string
+	loc  []int
+}
+
+// formatMatches formats the results of a search within limit bytes, shortening the lines
+// around their matches and then leaving out the last results when they do not fit
+func formatMatches(matches []searchMatch, limit int) string {
+	var lines []string
+	for _, width := range matchContextWidths {
+		formatted, size := make([]string, len(matches)), 0
+		for i, m := range matches {
+			formatted[i] = fmt.Sprintf("%s: %s", m.location, shortenMatch(m.line, m.loc, width))
+			size += len(formatted[i]) + 1
+		}
+		if size <= limit {
+			return strings.Join(formatted, "\n")
+		}
+	}
+
+	size := 0
+	for _, m := range matches {
+		line := fmt.Sprintf("%s: %s", m.location, shortenMatch(m.line, m.loc, matchContextWidths[len(matchContextWidths)-1]))
+		if size+len(line)+1 > limit && len(lines) > 0 {
+			break
+		}
+		lines = append(lines, line)
+		size += len(line) + 1
+	}
+	return strings.Join(lines, "\n") + fmt.Sprintf("\n\n[only %d of the %d results fit in the context window, narrow the search to see the others]", len(lines), len(matches))
+}
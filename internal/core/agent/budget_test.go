@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+func TestOutputBudget(t *testing.T) {
+	p := &scriptedProvider{}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	if got := a.outputBudget(); got != maxToolOutput {
+		t.Errorf("outputBudget() without a context window = %d, want %d", got, maxToolOutput)
+	}
+
+	p.window = 20000
+	a.conversation.AddUserMessage(strings.Repeat("x", 40000))
+	// 10000 tokens remain, of which a quarter is 2500 tokens
+	if got := a.outputBudget(); got != 10000 {
+		t.Errorf("outputBudget() = %d, want 10000", got)
+	}
+
+	a.conversation.AddUserMessage(strings.Repeat("x", 40000))
+	if got := a.outputBudget(); got != minToolOutput {
+		t.Errorf("outputBudget() with a full context window = %d, want %d", got, minToolOutput)
+	}
+}
+
+func TestTruncateHeadTail(t *testing.T) {
+	if got := truncateHeadTail("short", 10); got != "short" {
+		t.Errorf("truncateHeadTail() of a short output = %q", got)
+	}
+	output := strings.Repeat("a", 100) + strings.Repeat("b", 100)
+	got := truncateHeadTail(output, 40)
+	if want := strings.Repeat("a", 10) + "\n[... 160 bytes truncated ...]\n" + strings.Repeat("b", 30); got != want {
+		t.Errorf("truncateHeadTail() = %q, want %q", got, want)
+	}
+	// Multi-byte characters are not split
+	got = truncateHeadTail(strings.Repeat("あ", 100), 40)
+	if !strings.Contains(got, "bytes truncated") || strings.ContainsRune(got, '�') || !strings.HasPrefix(got, "ああ") {
+		t.Errorf("truncateHeadTail() of multi-byte characters = %q", got)
+	}
+}
+
+func TestFormatMatches(t *testing.T) {
+	long := strings.Repeat("x", 300) + "needle" + strings.Repeat("y", 300)
+	matches := []searchMatch{
+		{location: "a.go:1", line: "func needle()", loc: []int{5, 11}},
+		{location: "b.go:2", line: long, loc: []int{300, 306}},
+	}
+
+	if got := formatMatches(matches, 10000); got != "a.go:1: func needle()\nb.go:2: "+long {
+		t.Errorf("formatMatches() within a large budget = %q", got)
+	}
+
+	got := formatMatches(matches, 300)
+	lines := strings.Split(got, "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "needle") || !strings.HasPrefix(lines[1], "b.go:2: …") || !strings.HasSuffix(lines[1], "…") || len(lines[1]) > 220 {
+		t.Errorf("formatMatches() did not shorten the lines around the matches: %q", got)
+	}
+
+	got = formatMatches(matches, 50)
+	if !strings.HasPrefix(got, "a.go:1: func needle()\n") || !strings.HasSuffix(got, "[only 1 of the 2 results fit in the context window, narrow the search to see the others]") {
+		t.Errorf("formatMatches() within a small budget = %q", got)
+	}
+}
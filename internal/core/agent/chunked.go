@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Modes of write_to_file
+const (
+	// writeModeOverwrite writes the whole content at once, the default
+	writeModeOverwrite = "overwrite"
+	// writeModeAppend adds a part to a file written in parts
+	writeModeAppend = "append"
+	// writeModeFinalize adds the last part to a file written in parts and writes it
+	writeModeFinalize = "finalize"
+)
+
+// maxPendingWrite limits the size of a file written in parts, held in memory until it is finalized
+const maxPendingWrite = 10 << 20
+
+// pendingWrite is a file written in parts, assembled until it is finalized
+type pendingWrite struct {
+	parts []string
+	size  int
+}
+
+// writeFileInMode writes a file whole or in parts. The parts are kept until the last one
+// arrives, so the file is written at once with a single checkpoint, or not at all.
+func (a *Agent) writeFileInMode(ctx context.Context, path, content, mode string, turn int) (string, error) {
+	_, relPath, err := a.resolveWritablePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case "", writeModeOverwrite:
+		output, err := a.writeFile(ctx, path, content, turn)
+		if err == nil && a.pending[relPath] != nil {
+			delete(a.pending, relPath)
+			output += " The parts appended before were discarded."
+		}
+		return output, err
+	case writeModeAppend:
+		pending := a.pending[relPath]
+		if pending == nil {
+			pending = &pendingWrite{}
+			a.pending[relPath] = pending
+		}
+		if pending.size+len(content) > maxPendingWrite {
+			delete(a.pending, relPath)
+			return "", fmt.Errorf("%s exceeds %d bytes when written in parts, the parts were discarded", relPath, maxPendingWrite)
+		}
+		pending.parts = append(pending.parts, content)
+		pending.size += len(content)
+		return fmt.Sprintf("Received part %d of %s (%d bytes so far). The file is not written yet: send the next part with mode append, or the last part with mode finalize.", len(pending.parts), relPath, pending.size), nil
+	case writeModeFinalize:
+		var parts []string
+		if pending := a.pending[relPath]; pending != nil {
+			parts = pending.parts
+		}
+		parts = append(parts[:len(parts):len(parts)], content)
+		// The parts are kept if the write fails, so finalizing can be retried
+		output, err := a.writeFile(ctx, path, strings.Join(parts, "\n"), turn)
+		if err != nil {
+			return "", err
+		}
+		delete(a.pending, relPath)
+		return fmt.Sprintf("%s Assembled from %d part(s).", output, len(parts)), nil
+	default:
+		return "", fmt.Errorf("invalid mode %q, expected %s, %s or %s", mode, writeModeOverwrite, writeModeAppend, writeModeFinalize)
+	}
+}
+
+// unfinalizedWrites returns the paths of the files whose parts were appended but not finalized
+func (a *Agent) unfinalizedWrites() []string {
+	paths := make([]string, 0, len(a.pending))
+	for path := range a.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
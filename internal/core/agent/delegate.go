@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/provider"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// DefaultChildMaxTurns is the maximum number of AI responses of a child task when none is configured
+const DefaultChildMaxTurns = 20
+
+// Delegation lets the AI delegate parts of a task to child tasks with new_task.
+// Child tasks run in the working directory of their parent and cannot delegate in turn.
+type Delegation struct {
+	// Provider generates the responses of the child tasks, e.g. with a cheaper model, the parent's provider if nil
+	Provider provider.Provider
+	// SystemPrompt builds the system prompt of a child task allowed to use the tools
+	SystemPrompt func(tools []assistantmessage.ToolUseName) string
+	// Tools are the tools a child task may be allowed to use
+	Tools []assistantmessage.ToolUseName
+	// MaxTurns is the maximum number of AI responses of a child task, DefaultChildMaxTurns if zero
+	MaxTurns int
+	// Store stores the child tasks, nil to not store them
+	Store ChildStore
+}
+
+// ChildStore stores the child tasks and links them to their parent
+type ChildStore interface {
+	// Create stores a new child task and returns the recorder of its history
+	Create(child *pb.Task) (*taskstore.Recorder, error)
+	// Finish stores the final state of a child task
+	Finish(child *pb.Task) error
+}
+
+// delegate runs a child task to completion and returns its result for the AI
+func (a *Agent) delegate(ctx context.Context, params map[assistantmessage.ToolParamName]string, result *Result) (string, error) {
+	d := a.opts.Delegation
+	if d == nil {
+		return "", errors.New("delegating to child tasks is not enabled")
+	}
+	tools, err := d.allowedTools(params[assistantmessage.AllowedToolsParam])
+	if err != nil {
+		return "", err
+	}
+	maxTurns, err := d.maxTurns(params[assistantmessage.MaxTurnsParam])
+	if err != nil {
+		return "", err
+	}
+	childID, err := taskstore.NewTaskID()
+	if err != nil {
+		return "", err
+	}
+
+	p := d.Provider
+	if p == nil {
+		p = a.opts.Provider
+	}
+	prompt := params[assistantmessage.PromptParam]
+	now := time.Now().Format(time.RFC3339)
+	task := &pb.Task{
+		Id:               childID,
+		State:            pb.TaskState_TASK_STATE_ACTIVE,
+		Provider:         p.Name(),
+		Model:            p.GetModel().Name,
+		InitialPrompt:    prompt,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		WorkingDirectory: a.opts.WorkingDir,
+		ParentTaskId:     a.opts.TaskID,
+	}
+	var recorder *taskstore.Recorder
+	if d.Store != nil {
+		if recorder, err = d.Store.Create(task); err != nil {
+			return "", fmt.Errorf("failed to store child task: %w", err)
+		}
+	}
+
+	fmt.Fprintf(a.opts.Output, "[%s] Running child task %s with %d turn(s) at most\n", assistantmessage.NewTaskToolName, childID, maxTurns)
+	child := New(Options{
+		TaskID:       childID,
+		WorkingDir:   a.opts.WorkingDir,
+		Provider:     p,
+		SystemPrompt: d.SystemPrompt(tools),
+		Approver:     toolsApprover{tools: tools, next: a.opts.Approver},
+		// Edits are checkpointed in the parent task, so they can be restored from it
+		Applier:  a.opts.Applier,
+		Recorder: recorder,
+		Output:   a.opts.Output,
+		MaxTurns: maxTurns,
+		Plugins:  a.opts.Plugins,
+		Hooks:    a.opts.Hooks,
+		Index:    a.opts.Index,
+		// The child tasks see the same context directories and follow the same command policy and read-only mode as the parent
+		ContextRoots:  a.opts.ContextRoots,
+		CommandPolicy: a.opts.CommandPolicy,
+		ReadOnly:      a.opts.ReadOnly,
+		DeniedPaths:   a.opts.DeniedPaths,
+		Audit:         a.opts.Audit,
+		// Their failures are retried as those of the parent
+		AutoFixAttempts: a.opts.AutoFixAttempts,
+		MaxMistakes:     a.opts.MaxMistakes,
+	})
+	childResult, runErr := child.Run(ctx, prompt)
+	addUsage(&result.Usage, &childResult.Usage)
+
+	switch {
+	case runErr == nil:
+		task.State = pb.TaskState_TASK_STATE_COMPLETED
+	case ctx.Err() != nil:
+		task.State = pb.TaskState_TASK_STATE_CANCELLED
+	default:
+		task.State = pb.TaskState_TASK_STATE_PAUSED
+	}
+	task.UpdatedAt = time.Now().Format(time.RFC3339)
+	if d.Store != nil {
+		if err := d.Store.Finish(task); err != nil {
+			fmt.Fprintf(a.opts.Output, "[%s] Failed to store child task: %v\n", assistantmessage.NewTaskToolName, err)
+		}
+	}
+	return childSummary(childID, childResult, runErr)
+}
+
+// allowedTools returns the tools a child task may use: those listed by the AI, or all of them.
+// attempt_completion is always allowed, so the child can report its result.
+func (d *Delegation) allowedTools(list string) ([]assistantmessage.ToolUseName, error) {
+	available := slices.DeleteFunc(slices.Clone(d.Tools), func(name assistantmessage.ToolUseName) bool {
+		return name == assistantmessage.NewTaskToolName
+	})
+	if strings.TrimSpace(list) == "" {
+		return available, nil
+	}
+
+	tools := []assistantmessage.ToolUseName{assistantmessage.AttemptCompletionToolName}
+	for _, name := range strings.Split(list, ",") {
+		name := assistantmessage.ToolUseName(strings.TrimSpace(name))
+		if name == "" || slices.Contains(tools, name) {
+			continue
+		}
+		if !slices.Contains(available, name) {
+			return nil, fmt.Errorf("tool %s cannot be allowed to a child task", name)
+		}
+		tools = append(tools, name)
+	}
+	return tools, nil
+}
+
+// maxTurns returns the turn budget of a child task: the one asked by the AI, within the configured maximum
+func (d *Delegation) maxTurns(value string) (int, error) {
+	limit := d.MaxTurns
+	if limit <= 0 {
+		limit = DefaultChildMaxTurns
+	}
+	if strings.TrimSpace(value) == "" {
+		return limit, nil
+	}
+	turns, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || turns <= 0 {
+		return 0, fmt.Errorf("invalid max_turns %q, expected a positive number", value)
+	}
+	return min(turns, limit), nil
+}
+
+// childSummary summarizes the outcome of a child task for its parent
+func childSummary(childID string, result *Result, err error) (string, error) {
+	switch {
+	case err == nil:
+		summary := fmt.Sprintf("Child task %s completed in %d turn(s).\nResult:\n%s", childID, result.Turns, result.Completion)
+		if result.Command != "" {
+			summary += fmt.Sprintf("\nSuggested command: %s", result.Command)
+		}
+		return summary, nil
+	case errors.Is(err, ErrNeedsInput):
+		return fmt.Sprintf("Child task %s stopped after %d turn(s) because it needs more input: %s", childID, result.Turns, result.Question), nil
+	case errors.Is(err, ErrTurnLimit), errors.Is(err, ErrNoToolUse):
+		return fmt.Sprintf("Child task %s stopped after %d turn(s) without completing: %v. Its changes to the files were kept.", childID, result.Turns, err), nil
+	default:
+		return "", fmt.Errorf("child task %s failed: %w", childID, err)
+	}
+}
+
+// RestrictTools returns an approver denying the tools not in the list and asking the approver
+// for the others, e.g. for a task started from a template allowing only some tools
+func RestrictTools(approver Approver, tools []assistantmessage.ToolUseName) Approver {
+	return toolsApprover{tools: tools, next: approver}
+}
+
+// toolsApprover denies the tools a child task is not allowed to use and asks the parent's approver for the others
+type toolsApprover struct {
+	tools []assistantmessage.ToolUseName
+	next  Approver
+}
+
+// Approve implements Approver
+func (t toolsApprover) Approve(ctx context.Context, toolUse assistantmessage.ToolUse) (bool, error) {
+	if !slices.Contains(t.tools, toolUse.Name) {
+		return false, nil
+	}
+	return t.next.Approve(ctx, toolUse)
+}
+
+// OverrideCommandPolicy implements PolicyOverrider, asking the parent's approver
+func (t toolsApprover) OverrideCommandPolicy(ctx context.Context, command, rule string) (bool, error) {
+	if overrider, ok := t.next.(PolicyOverrider); ok {
+		return overrider.OverrideCommandPolicy(ctx, command, rule)
+	}
+	return false, nil
+}
+
+// ReviewEdit implements EditReviewer, the edits of a child task are reviewed like those of its parent
+func (t toolsApprover) ReviewEdit(ctx context.Context, path, original, proposed string) (string, error) {
+	if reviewer, ok := t.next.(EditReviewer); ok {
+		return reviewer.ReviewEdit(ctx, path, original, proposed)
+	}
+	return proposed, nil
+}
+
+// ResolveConflict implements ConflictResolver, asking the parent's approver
+func (t toolsApprover) ResolveConflict(ctx context.Context, conflict apply.Conflict) (string, error) {
+	if resolver, ok := t.next.(ConflictResolver); ok {
+		return resolver.ResolveConflict(ctx, conflict)
+	}
+	return mergeCleanly(conflict)
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// memoryChildStore keeps the child tasks in memory
+type memoryChildStore struct {
+	created  []*pb.Task
+	finished []*pb.Task
+}
+
+func (s *memoryChildStore) Create(child *pb.Task) (*taskstore.Recorder, error) {
+	s.created = append(s.created, child)
+	return nil, nil
+}
+
+func (s *memoryChildStore) Finish(child *pb.Task) error {
+	s.finished = append(s.finished, child)
+	return nil
+}
+
+func TestRunDelegatesToChildTask(t *testing.T) {
+	parent := &scriptedProvider{responses: []string{
+		"<new_task>\n<prompt>Create notes.txt</prompt>\n<allowed_tools>write_to_file, execute_command</allowed_tools>\n<max_turns>50</max_turns>\n</new_task>",
+		"<attempt_completion>\n<result>Delegated</result>\n</attempt_completion>",
+	}}
+	child := &scriptedProvider{responses: []string{
+		"<write_to_file>\n<path>notes.txt</path>\n<content>notes</content>\n</write_to_file>",
+		"<read_file>\n<path>notes.txt</path>\n</read_file>",
+		"<attempt_completion>\n<result>Wrote notes.txt</result>\n</attempt_completion>",
+	}}
+	a, workingDir := newTestAgent(t, parent, config.AutoApprove{ReadFiles: true, EditFiles: true})
+	store := &memoryChildStore{}
+	var childTools []assistantmessage.ToolUseName
+	a.opts.Delegation = &Delegation{
+		Provider: child,
+		SystemPrompt: func(tools []assistantmessage.ToolUseName) string {
+			childTools = tools
+			return "child prompt"
+		},
+		Tools:    []assistantmessage.ToolUseName{assistantmessage.ReadFileToolName, assistantmessage.WriteToFileToolName, assistantmessage.ExecuteCommandToolName, assistantmessage.AttemptCompletionToolName, assistantmessage.NewTaskToolName},
+		MaxTurns: 5,
+		Store:    store,
+	}
+
+	result, err := a.Run(context.Background(), "Take notes")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(workingDir, "notes.txt")); err != nil || string(data) != "notes" {
+		t.Errorf("notes.txt = %q, %v", data, err)
+	}
+	// The child's usage is added to the parent's
+	if result.Usage.InputTokens != 50 {
+		t.Errorf("input tokens = %d, want those of the parent and the child", result.Usage.InputTokens)
+	}
+	if strings.Join(toolNames(childTools), ",") != "attempt_completion,write_to_file,execute_command" {
+		t.Errorf("child tools = %v", childTools)
+	}
+	// read_file was not allowed to the child
+	if got := child.lastMessage(2); !strings.Contains(got, "The user denied this operation.") {
+		t.Errorf("child message = %q, want a denial", got)
+	}
+
+	if len(store.created) != 1 || len(store.finished) != 1 {
+		t.Fatalf("stored %d created and %d finished child tasks", len(store.created), len(store.finished))
+	}
+	task := store.finished[0]
+	if task.ParentTaskId != "task-1" || task.State != pb.TaskState_TASK_STATE_COMPLETED || task.InitialPrompt != "Create notes.txt" {
+		t.Errorf("child task = %v", task)
+	}
+	summary := parent.lastMessage(1)
+	if !strings.Contains(summary, "Child task "+task.Id+" completed in 3 turn(s).") || !strings.Contains(summary, "Wrote notes.txt") {
+		t.Errorf("summary = %q", summary)
+	}
+}
+
+func TestDelegationLimits(t *testing.T) {
+	d := &Delegation{
+		Tools:    []assistantmessage.ToolUseName{assistantmessage.ReadFileToolName, assistantmessage.AttemptCompletionToolName, assistantmessage.NewTaskToolName},
+		MaxTurns: 10,
+	}
+	tools, err := d.allowedTools("")
+	if err != nil || strings.Join(toolNames(tools), ",") != "read_file,attempt_completion" {
+		t.Errorf("allowedTools() = %v, %v, want every tool but new_task", tools, err)
+	}
+	if _, err := d.allowedTools("new_task"); err == nil {
+		t.Error("allowedTools() allowed a child to delegate")
+	}
+
+	for value, want := range map[string]int{"": 10, "3": 3, "30": 10} {
+		if got, err := d.maxTurns(value); err != nil || got != want {
+			t.Errorf("maxTurns(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	if _, err := d.maxTurns("-1"); err == nil {
+		t.Error("maxTurns() accepted a negative number")
+	}
+}
+
+func toolNames(tools []assistantmessage.ToolUseName) []string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = string(tool)
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/cmdpolicy"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// QuestionAnswerer is implemented by the approvers that can put the questions of the AI to the
+// user. Without one, ask_followup_question ends the run with ErrNeedsInput.
+type QuestionAnswerer interface {
+	// AnswerQuestion returns the answer of the user to a question, options are the answers
+	// suggested by the AI, possibly none
+	AnswerQuestion(ctx context.Context, question string, options []string) (string, error)
+}
+
+// ShowcaseApprover is implemented by the approvers that offer to run the command suggested
+// with the result of attempt_completion. Without one, the command is only reported.
+type ShowcaseApprover interface {
+	// ApproveShowcase reports whether the user wants to run the command showcasing the result
+	ApproveShowcase(ctx context.Context, result, command string) (bool, error)
+}
+
+// parseOptions parses the options of ask_followup_question, a JSON array of strings. Options
+// that are not a valid array are dropped, the question can still be answered without them.
+func parseOptions(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	var options []string
+	if err := json.Unmarshal([]byte(value), &options); err != nil {
+		slog.Warn("Ignoring invalid options of ask_followup_question", "options", value, "error", err)
+		return nil
+	}
+	return options
+}
+
+// askFollowup puts the question of the AI to the user and returns the tool result with the
+// answer. It returns ErrNeedsInput when nobody can answer.
+func (a *Agent) askFollowup(ctx context.Context, toolUse assistantmessage.ToolUse, result *Result) (string, error) {
+	result.Question = toolUse.Params[assistantmessage.QuestionParam]
+	result.Options = parseOptions(toolUse.Params[assistantmessage.OptionsParam])
+
+	answerer, ok := a.opts.Approver.(QuestionAnswerer)
+	if !ok {
+		return "", ErrNeedsInput
+	}
+	answer, err := answerer.AnswerQuestion(ctx, result.Question, result.Options)
+	if err != nil {
+		return "", err
+	}
+	result.Question, result.Options = "", nil
+	return fmt.Sprintf("<answer>\n%s\n</answer>", answer), nil
+}
+
+// completeTask records the completion of the task and runs the command showcasing the result
+// if the user wants to
+func (a *Agent) completeTask(ctx context.Context, toolUse assistantmessage.ToolUse, result *Result) {
+	result.Completion = toolUse.Params[assistantmessage.ResultParam]
+	result.Command = toolUse.Params[assistantmessage.CommandParam]
+	a.recordTool(toolUse, result.Completion, nil)
+	if a.opts.Recorder != nil {
+		if err := a.opts.Recorder.RecordSystemEvent(result.Completion, pb.SystemEventType_SYSTEM_EVENT_TYPE_TASK_COMPLETED); err != nil {
+			slog.Warn("Failed to record task history", "error", err)
+		}
+	}
+
+	approver, ok := a.opts.Approver.(ShowcaseApprover)
+	if result.Command == "" || !ok {
+		return
+	}
+	// The command policy applies to the showcase command as to any other command
+	if decision := a.opts.CommandPolicy.Evaluate(result.Command); decision.Verdict == cmdpolicy.Deny {
+		fmt.Fprintf(a.opts.Output, "[showcase] %s is blocked by the rule %q of the command policy\n", result.Command, decision.Rule)
+		return
+	}
+	approved, err := approver.ApproveShowcase(ctx, result.Completion, result.Command)
+	if err != nil || !approved {
+		return
+	}
+	output, err := a.executeCommand(ctx, result.Command)
+	if err != nil {
+		output = err.Error()
+	}
+	result.CommandRun, result.CommandOutput = true, output
+	fmt.Fprintf(a.opts.Output, "\n[showcase] %s\n%s\n", result.Command, output)
+}
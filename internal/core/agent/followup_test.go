@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+// interactiveApprover answers the questions of the AI and runs the showcase commands
+type interactiveApprover struct {
+	PolicyApprover
+	answer   string
+	options  []string
+	showcase bool
+}
+
+func (p *interactiveApprover) AnswerQuestion(ctx context.Context, question string, options []string) (string, error) {
+	p.options = options
+	return p.answer, nil
+}
+
+func (p *interactiveApprover) ApproveShowcase(ctx context.Context, result, command string) (bool, error) {
+	return p.showcase, nil
+}
+
+func TestRunAnswersFollowupQuestions(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<ask_followup_question>\n<question>Which file?</question>\n<options>[\"a.go\", \"b.go\"]</options>\n</ask_followup_question>",
+		"<attempt_completion>\n<result>Fixed b.go</result>\n</attempt_completion>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+	approver := &interactiveApprover{answer: "b.go"}
+	a.opts.Approver = approver
+
+	result, err := a.Run(context.Background(), "Fix it")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !slices.Equal(approver.options, []string{"a.go", "b.go"}) {
+		t.Errorf("options = %q", approver.options)
+	}
+	if result.Completion != "Fixed b.go" || result.Question != "" {
+		t.Errorf("result = %+v, want the completion after the answer", result)
+	}
+	if got := p.lastMessage(1); !strings.HasPrefix(got, "[ask_followup_question for 'Which file?'] Result:\n<answer>\nb.go\n</answer>") {
+		t.Errorf("answer message = %q", got)
+	}
+}
+
+func TestRunReportsQuestionOptions(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		"<ask_followup_question>\n<question>Which file?</question>\n<options>[\"a.go\", \"b.go\"]</options>\n</ask_followup_question>",
+	}}
+	a, _ := newTestAgent(t, p, config.AutoApprove{})
+
+	result, err := a.Run(context.Background(), "Fix it")
+	if !errors.Is(err, ErrNeedsInput) {
+		t.Fatalf("Run() error = %v, want ErrNeedsInput", err)
+	}
+	if !slices.Equal(result.Options, []string{"a.go", "b.go"}) {
+		t.Errorf("options = %q", result.Options)
+	}
+}
+
+func TestRunRunsShowcaseCommand(t *testing.T) {
+	for _, showcase := range []bool{true, false} {
+		p := &scriptedProvider{responses: []string{
+			"<attempt_completion>\n<result>Done</result>\n<command>echo showcased</command>\n</attempt_completion>",
+		}}
+		a, _ := newTestAgent(t, p, config.AutoApprove{})
+		a.opts.Approver = &interactiveApprover{showcase: showcase}
+
+		result, err := a.Run(context.Background(), "Finish")
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if result.CommandRun != showcase || strings.Contains(result.CommandOutput, "showcased") != showcase {
+			t.Errorf("showcase approved %v: result = %+v", showcase, result)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	if got := parseOptions(` ["yes", "no"] `); !slices.Equal(got, []string{"yes", "no"}) {
+		t.Errorf("parseOptions() = %q", got)
+	}
+	for _, invalid := range []string{"", "yes, no", `{"a": 1}`} {
+		if got := parseOptions(invalid); got != nil {
+			t.Errorf("parseOptions(%q) = %q, want no options", invalid, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/prompts"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// DefaultMaxMistakes is the number of consecutive mistakes of the AI after which the user is
+// asked for guidance
+const DefaultMaxMistakes = 3
+
+// mistake is a kind of mistake of the AI
+type mistake int
+
+const (
+	// mistakeNoToolUse is a response without a tool use
+	mistakeNoToolUse mistake = iota
+	// mistakeInvalidParams is a tool use with missing or invalid parameters
+	mistakeInvalidParams
+	// mistakeFailedDiff is a replace_in_file diff that does not apply to the file
+	mistakeFailedDiff
+)
+
+// String returns the description of a kind of mistake, as counted in the question to the user
+func (m mistake) String() string {
+	switch m {
+	case mistakeNoToolUse:
+		return "responses without a tool use"
+	case mistakeInvalidParams:
+		return "tool uses with invalid parameters"
+	default:
+		return "diffs that did not apply"
+	}
+}
+
+// mistakeError is the error of a tool use that failed because of a mistake of the AI
+type mistakeError struct {
+	kind mistake
+	err  error
+}
+
+func (e *mistakeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *mistakeError) Unwrap() error {
+	return e.err
+}
+
+// mistakes counts the mistakes of the AI since its last successful tool use, by kind
+type mistakes [mistakeFailedDiff + 1]int
+
+// add counts a mistake and returns the number of mistakes in a row
+func (m *mistakes) add(kind mistake) int {
+	m[kind]++
+	return m.inARow()
+}
+
+// inARow returns the number of mistakes since the last successful tool use
+func (m *mistakes) inARow() int {
+	n := 0
+	for _, count := range m {
+		n += count
+	}
+	return n
+}
+
+// describe lists the mistakes by kind, e.g. "tool uses with invalid parameters: 2"
+func (m *mistakes) describe() string {
+	var parts []string
+	for kind, count := range m {
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", mistake(kind), count))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tooManyMistakesQuestion is put to the user once the AI made too many mistakes in a row
+const tooManyMistakesQuestion = "The AI made %d mistakes in a row (%s). What guidance can you give it to proceed?"
+
+// addMistake counts a mistake of the AI and, once Options.MaxMistakes mistakes were made in a
+// row, pauses the task to ask the user for guidance. It returns the message giving the guidance
+// to the AI, empty if the user was not asked. When nobody can answer, the run ends with
+// ErrNoToolUse if the AI only answered without tools and ErrNeedsInput otherwise.
+func (a *Agent) addMistake(ctx context.Context, kind mistake, result *Result) (string, error) {
+	if a.mistakes.add(kind) < a.opts.MaxMistakes {
+		return "", nil
+	}
+
+	description := a.mistakes.describe()
+	fmt.Fprintf(a.opts.Output, "\n[mistakes] %d mistakes in a row: %s\n", a.mistakes.inARow(), description)
+	if a.opts.Recorder != nil {
+		message := fmt.Sprintf("Paused after %d mistakes in a row: %s", a.mistakes.inARow(), description)
+		if err := a.opts.Recorder.RecordSystemEvent(message, pb.SystemEventType_SYSTEM_EVENT_TYPE_WARNING); err != nil {
+			slog.Warn("Failed to record task history", "error", err)
+		}
+	}
+
+	question := fmt.Sprintf(tooManyMistakesQuestion, a.mistakes.inARow(), description)
+	answerer, ok := a.opts.Approver.(QuestionAnswerer)
+	if !ok {
+		if a.mistakes[mistakeNoToolUse] == a.mistakes.inARow() {
+			return "", ErrNoToolUse
+		}
+		result.Question, result.Options = question, nil
+		return "", ErrNeedsInput
+	}
+	feedback, err := answerer.AnswerQuestion(ctx, question, nil)
+	if err != nil {
+		return "", err
+	}
+	a.mistakes = mistakes{}
+	return prompts.NewFormatResponse().TooManyMistakes(feedback), nil
+}
+
+// withGuidance appends the guidance of the user, if any, to a message
+func withGuidance(message, guidance string) string {
+	if guidance == "" {
+		return message
+	}
+	return message + "\n\n" + guidance
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+const (
+	// defaultOfflineRetry is the first delay before a request queued while the provider cannot
+	// be reached is sent again, doubled after each failure up to maxOfflineRetry
+	defaultOfflineRetry = 2 * time.Second
+	// maxOfflineRetry is the longest delay between two attempts of a queued request
+	maxOfflineRetry = time.Minute
+	// maxOfflineWait is how long a request is queued at most, the run then fails
+	maxOfflineWait = 15 * time.Minute
+)
+
+// ConnectivityReporter is implemented by outputs that show when the provider cannot be reached
+// and the request waits for the connection to come back, e.g. in the status of the task
+type ConnectivityReporter interface {
+	// ReportOffline is called when a request failed to reach the provider and is queued
+	ReportOffline(err error)
+	// ReportOnline is called once the queued request reached the provider, or was given up
+	ReportOnline()
+}
+
+// streamOnline streams a request like stream, queuing it while the provider cannot be reached:
+// the request, which carries the pending user message and tool results, is sent again until
+// the connection is back instead of failing the turn. The attempts stop when the run is
+// cancelled or after offlineWait, and the text shown before the connection was lost is not
+// printed again.
+func (a *Agent) streamOnline(ctx context.Context, messages []provider.Message) (string, string, *provider.Usage, error) {
+	reporter, _ := a.opts.Output.(ConnectivityReporter)
+	delay := a.offlineRetry
+	var shown shownResponse
+	var offlineSince time.Time
+	for attempt := 1; ; attempt++ {
+		content, stopReason, usage, err := a.stream(ctx, messages, &shown)
+		if err == nil || ctx.Err() != nil || !provider.IsConnectivityError(err) {
+			if attempt > 1 {
+				if err == nil {
+					fmt.Fprintln(a.opts.Output, "[online] The connection is back, the queued request was sent")
+				}
+				if reporter != nil {
+					reporter.ReportOnline()
+				}
+			}
+			return content, stopReason, usage, err
+		}
+
+		if attempt == 1 {
+			offlineSince = a.now()
+			fmt.Fprintf(a.opts.Output, "[offline] The provider cannot be reached: %v\n", err)
+			fmt.Fprintln(a.opts.Output, "[offline] The request is queued and sent again once the connection is back")
+			if reporter != nil {
+				reporter.ReportOffline(err)
+			}
+		}
+		if waited := a.now().Sub(offlineSince); waited+delay > a.offlineWait {
+			if reporter != nil {
+				reporter.ReportOnline()
+			}
+			return "", "", nil, fmt.Errorf("the provider could not be reached after %d attempt(s) in %s: %w", attempt, waited.Round(time.Second), err)
+		}
+		select {
+		case <-ctx.Done():
+			if reporter != nil {
+				reporter.ReportOnline()
+			}
+			return "", "", nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxOfflineRetry)
+	}
+}
+
+// shownResponse is the text of a response shown by the attempts of a request. A response
+// streamed again after the connection was lost is only printed past the text the interrupted
+// attempts showed, or shown again after a notice when it differs from it.
+type shownResponse struct {
+	// text is the text shown by the previous attempts, empty once the attempt passed it
+	text string
+	// caughtUp tells that the current attempt printed past text
+	caughtUp bool
+}
+
+// next returns the text to print for an event of the current attempt, which streamed response
+// so far and text last
+func (s *shownResponse) next(response, text string) string {
+	switch {
+	case s == nil || s.text == "" || s.caughtUp:
+		s.markCaughtUp()
+		return text
+	case strings.HasPrefix(s.text, response):
+		return ""
+	case strings.HasPrefix(response, s.text):
+		s.caughtUp = true
+		return response[len(s.text):]
+	default:
+		s.caughtUp = true
+		return "\n[offline] The response sent again differs, the interrupted one above is discarded\n" + response
+	}
+}
+
+// markCaughtUp records that the current attempt shows its whole response
+func (s *shownResponse) markCaughtUp() {
+	if s != nil {
+		s.caughtUp = true
+	}
+}
+
+// end records the response of an attempt, shown as far as it was printed, for the next attempt
+func (s *shownResponse) end(response string) {
+	if s == nil {
+		return
+	}
+	if s.caughtUp {
+		s.text = response
+	}
+	s.caughtUp = false
+}
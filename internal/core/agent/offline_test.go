@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShownResponse(t *testing.T) {
+	// attempt streams the events of an attempt and returns what was printed
+	attempt := func(s *shownResponse, events ...string) string {
+		var response, printed strings.Builder
+		for _, event := range events {
+			response.WriteString(event)
+			printed.WriteString(s.next(response.String(), event))
+		}
+		s.end(response.String())
+		return printed.String()
+	}
+
+	var s shownResponse
+	if got := attempt(&s, "Hello", ", wor"); got != "Hello, wor" {
+		t.Errorf("first attempt printed %q", got)
+	}
+	if got := attempt(&s, "Hel"); got != "" {
+		t.Errorf("attempt within the shown text printed %q", got)
+	}
+	if got := attempt(&s, "Hello", ", world", "!"); got != "ld!" {
+		t.Errorf("attempt past the shown text printed %q", got)
+	}
+	if got := attempt(&s, "Hi", " there"); !strings.Contains(got, "the interrupted one above is discarded\nHi") || !strings.HasSuffix(got, "Hi there") {
+		t.Errorf("differing attempt printed %q", got)
+	}
+	if got := attempt(&s, "Hi there", " again"); got != " again" {
+		t.Errorf("attempt after a differing one printed %q", got)
+	}
+}
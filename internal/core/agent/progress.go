@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/hooks"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// maxSummaryFiles is the number of changed files named in a progress summary
+const maxSummaryFiles = 5
+
+// progress tracks what a run did for its progress summaries
+type progress struct {
+	started     time.Time
+	lastSummary time.Time
+	files       []string
+	commands    int
+	lastStep    string
+}
+
+// track records a tool use that ran
+func (p *progress) track(toolUse assistantmessage.ToolUse) {
+	switch toolUse.Name {
+	case assistantmessage.WriteToFileToolName, assistantmessage.ReplaceInFileToolName:
+		if path := toolUse.Params[assistantmessage.PathParam]; !slices.Contains(p.files, path) {
+			p.files = append(p.files, path)
+		}
+	case assistantmessage.ExecuteCommandToolName:
+		p.commands++
+	}
+	p.lastStep = fmt.Sprintf("[%s] %s", toolUse.Name, describeToolUse(toolUse))
+}
+
+// summary summarizes the progress of a run at a time
+func (p *progress) summary(now time.Time, result *Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Progress after %s: %d turn(s)", now.Sub(p.started).Round(time.Second), result.Turns)
+	if len(p.files) > 0 {
+		named := p.files[:min(len(p.files), maxSummaryFiles)]
+		fmt.Fprintf(&b, ", %d file(s) changed (%s", len(p.files), strings.Join(named, ", "))
+		if len(p.files) > len(named) {
+			b.WriteString(", ...")
+		}
+		b.WriteString(")")
+	}
+	if p.commands > 0 {
+		fmt.Fprintf(&b, ", %d command(s) run", p.commands)
+	}
+	fmt.Fprintf(&b, ", %d input and %d output tokens, $%.4f.", result.Usage.InputTokens, result.Usage.OutputTokens, result.Usage.TotalCost)
+	if p.lastStep != "" {
+		fmt.Fprintf(&b, " Last step: %s", p.lastStep)
+	}
+	return b.String()
+}
+
+// checkTimeBox posts a progress summary when one is due and reports ErrTimeLimit once the
+// run has used its time. It is checked between turns, so a turn is never interrupted.
+func (a *Agent) checkTimeBox(ctx context.Context, result *Result) error {
+	now := a.now()
+	if a.opts.TimeLimit > 0 && now.Sub(a.progress.started) >= a.opts.TimeLimit {
+		a.postProgress(ctx, now, result, "Time limit reached, pausing for review.")
+		return ErrTimeLimit
+	}
+	if a.opts.SummaryInterval > 0 && now.Sub(a.progress.lastSummary) >= a.opts.SummaryInterval {
+		a.postProgress(ctx, now, result, "")
+	}
+	return nil
+}
+
+// postProgress writes a progress summary to the output and the task history and sends it to the on_progress hooks
+func (a *Agent) postProgress(ctx context.Context, now time.Time, result *Result, note string) {
+	a.progress.lastSummary = now
+	summary := a.progress.summary(now, result)
+	if note != "" {
+		summary += " " + note
+	}
+
+	fmt.Fprintf(a.opts.Output, "\n[progress] %s\n", summary)
+	if a.opts.Recorder != nil {
+		if err := a.opts.Recorder.RecordSystemEvent(summary, pb.SystemEventType_SYSTEM_EVENT_TYPE_PROGRESS); err != nil {
+			slog.Warn("Failed to record task history", "error", err)
+		}
+	}
+	if err := a.runHooks(ctx, hooks.Payload{Event: hooks.EventProgress, Summary: summary}); err != nil {
+		slog.Warn("Hook failed", "error", err)
+	}
+}
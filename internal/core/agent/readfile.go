@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// maxReadLines limits the number of lines returned by read_file at once
+const maxReadLines = 2000
+
+// Byte order marks of the encodings detected by decodeText
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// readFile returns the lines of a file between startLine and endLine, both optional, prefixed
+// with their numbers. Files in UTF-16 or Shift-JIS are decoded, and the output is truncated to
+// maxReadLines lines or the output budget with a notice telling how to read the rest.
+func (a *Agent) readFile(path, startLine, endLine string) (string, error) {
+	absPath, relPath, err := a.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	start, err := parseLineParam("start_line", startLine, 1)
+	if err != nil {
+		return "", err
+	}
+	end, err := parseLineParam("end_line", endLine, 0)
+	if err != nil {
+		return "", err
+	}
+	if end != 0 && end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", err
+	}
+	content, encodingName, err := decodeText(data)
+	if err != nil {
+		return "", fmt.Errorf("%s %w", path, err)
+	}
+	a.opts.RecentFiles.Read(relPath)
+	a.seen[absPath] = string(data)
+
+	if content == "" {
+		return fmt.Sprintf("%s is empty.", relPath), nil
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if start > len(lines) {
+		return "", fmt.Errorf("start_line %d is after the end of %s, which has %d lines", start, relPath, len(lines))
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+
+	var b strings.Builder
+	if encodingName != "" {
+		fmt.Fprintf(&b, "[Decoded from %s]\n", encodingName)
+	}
+	width := len(strconv.Itoa(end))
+	limit := a.outputBudget()
+	last := start - 1
+	for n := start; n <= end && n-start < maxReadLines; n++ {
+		line := fmt.Sprintf("%*d | %s\n", width, n, strings.TrimSuffix(lines[n-1], "\r"))
+		if b.Len()+len(line) > limit && n > start {
+			break
+		}
+		b.WriteString(line)
+		last = n
+	}
+	a.opts.Audit.RecordFile(relPath, b.Len())
+	if last < end {
+		fmt.Fprintf(&b, "[Showing lines %d-%d of %d. Read the rest with start_line %d.]\n", start, last, len(lines), last+1)
+	} else if start > 1 || end < len(lines) {
+		fmt.Fprintf(&b, "[Showing lines %d-%d of %d.]\n", start, end, len(lines))
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// parseLineParam parses an optional line number parameter, def if it is empty
+func parseLineParam(name, value string, def int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a line number starting at 1, got %q", name, value)
+	}
+	return n, nil
+}
+
+// decodeText decodes the content of a text file to UTF-8 and returns the name of the encoding
+// it was decoded from, empty for UTF-8. UTF-16 is detected from its byte order mark, and
+// content that is not valid UTF-8 is tried as Shift-JIS. Binary content is an error.
+func decodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeWith(data, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "UTF-16LE")
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeWith(data, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "UTF-16BE")
+	}
+	if isBinary(data) {
+		return "", "", fmt.Errorf("is a binary file")
+	}
+	if utf8.Valid(data) {
+		return string(data), "", nil
+	}
+	if content, name, err := decodeWith(data, japanese.ShiftJIS, "Shift-JIS"); err == nil {
+		return content, name, nil
+	}
+	return "", "", fmt.Errorf("is neither UTF-8, UTF-16 nor Shift-JIS text")
+}
+
+// decodeWith decodes data with an encoding, failing if it has bytes the encoding cannot decode
+func decodeWith(data []byte, enc encoding.Encoding, name string) (string, string, error) {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+		return "", "", fmt.Errorf("is not valid %s text", name)
+	}
+	return string(decoded), name, nil
+}
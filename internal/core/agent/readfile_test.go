@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+func TestReadFile(t *testing.T) {
+	a, workingDir := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	var lines []string
+	for i := 1; i <= 12; i++ {
+		lines = append(lines, "line "+strings.Repeat("x", i))
+	}
+	files := map[string][]byte{
+		"lines.txt": []byte(strings.Join(lines, "\n") + "\n"),
+		"crlf.txt":  []byte("a\r\nb\r\n"),
+		"empty.txt": nil,
+		"utf16.txt": {0xFF, 0xFE, 'h', 0, 'i', 0, '\n', 0},
+		"sjis.txt":  {0x82, 0xB1, 0x82, 0xF1, 0x82, 0xC9, 0x82, 0xBF, 0x82, 0xCD},
+		"image.png": {0x89, 'P', 'N', 'G', 0, 0, 0, 0x0D},
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(workingDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path, start, end string
+		want             string
+		wantErr          string
+	}{
+		{path: "lines.txt", start: "10", end: "11", want: "10 | line xxxxxxxxxx\n11 | line xxxxxxxxxxx\n[Showing lines 10-11 of 12.]"},
+		{path: "lines.txt", start: "12", end: "99", want: "12 | line xxxxxxxxxxxx\n[Showing lines 12-12 of 12.]"},
+		{path: "crlf.txt", want: "1 | a\n2 | b"},
+		{path: "empty.txt", want: "empty.txt is empty."},
+		{path: "utf16.txt", want: "[Decoded from UTF-16LE]\n1 | hi"},
+		{path: "sjis.txt", want: "[Decoded from Shift-JIS]\n1 | こんにちは"},
+		{path: "image.png", wantErr: "binary file"},
+		{path: "lines.txt", start: "13", wantErr: "which has 12 lines"},
+		{path: "lines.txt", start: "5", end: "4", wantErr: "before start_line"},
+		{path: "lines.txt", start: "zero", wantErr: "must be a line number"},
+	}
+	for _, tt := range tests {
+		got, err := a.readFile(tt.path, tt.start, tt.end)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readFile(%s, %q, %q) error = %v, want %q", tt.path, tt.start, tt.end, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("readFile(%s, %q, %q) = %q, %v, want %q", tt.path, tt.start, tt.end, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadFileTruncatesLargeFiles(t *testing.T) {
+	a, workingDir := newTestAgent(t, &scriptedProvider{}, config.AutoApprove{})
+	content := strings.Repeat("line\n", maxReadLines+500)
+	if err := os.WriteFile(filepath.Join(workingDir, "big.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := a.readFile("big.txt", "", "")
+	if err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+	if !strings.HasSuffix(got, "[Showing lines 1-2000 of 2500. Read the rest with start_line 2001.]") {
+		t.Errorf("readFile() ends with %q", got[len(got)-100:])
+	}
+
+	got, err = a.readFile("big.txt", "2001", "")
+	if err != nil || !strings.HasPrefix(got, "2001 | line") || !strings.HasSuffix(got, "[Showing lines 2001-2500 of 2500.]") {
+		t.Errorf("readFile(2001) = %q..., %v", got[:min(len(got), 50)], err)
+	}
+}
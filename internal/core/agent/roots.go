@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/ignore"
+)
+
+// contextRoot is a read-only context directory with the ignore rules of its own .golineignore files
+type contextRoot struct {
+	config.ContextRoot
+	ignore *ignore.Controller
+}
+
+// newContextRoots loads the ignore rules of the context directories, with the denied patterns.
+// Directories with a name that cannot label a path are left out.
+func newContextRoots(roots []config.ContextRoot, denied []string) []*contextRoot {
+	var result []*contextRoot
+	for _, root := range roots {
+		if root.Name == "" || strings.ContainsAny(root.Name, `:/\`) {
+			slog.Warn("Invalid context directory name", "name", root.Name, "path", root.Path)
+			continue
+		}
+		controller := ignore.NewController(root.Path)
+		if err := controller.Initialize(); err != nil {
+			slog.Warn("Failed to load .golineignore", "path", root.Path, "error", err)
+		}
+		controller.Deny(denied...)
+		result = append(result, &contextRoot{ContextRoot: root, ignore: controller})
+	}
+	return result
+}
+
+// rootPath splits a path written name:path into its context directory and the path within it
+func (a *Agent) rootPath(path string) (*contextRoot, string, bool) {
+	name, rel, ok := strings.Cut(path, ":")
+	if !ok {
+		return nil, "", false
+	}
+	for _, root := range a.roots {
+		if root.Name == name {
+			return root, rel, true
+		}
+	}
+	return nil, "", false
+}
+
+// rootOf returns the context directory containing an absolute path, nil if it is in none
+func (a *Agent) rootOf(absPath string) *contextRoot {
+	for _, root := range a.roots {
+		if within(root.Path, absPath) {
+			return root
+		}
+	}
+	return nil
+}
+
+// within reports whether an absolute path is dir or in it
+func within(dir, absPath string) bool {
+	rel, err := filepath.Rel(dir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ignoreFor returns the ignore rules of an absolute path: those of the context directory
+// containing it, or else those of the workspace
+func (a *Agent) ignoreFor(absPath string) *ignore.Controller {
+	if root := a.rootOf(absPath); root != nil {
+		return root.ignore
+	}
+	return a.ignore
+}
+
+// accessible reports whether an absolute path is not ignored
+func (a *Agent) accessible(absPath string) bool {
+	return a.ignoreFor(absPath).ValidateAccess(absPath)
+}
+
+// displayPath returns the path shown to the AI for an absolute path: relative to the working
+// directory, or name:path in a context directory
+func (a *Agent) displayPath(absPath string) string {
+	if root := a.rootOf(absPath); root != nil {
+		rel, _ := filepath.Rel(root.Path, absPath)
+		if rel == "." {
+			rel = ""
+		}
+		return root.Name + ":" + filepath.ToSlash(rel)
+	}
+	relPath, err := filepath.Rel(a.opts.WorkingDir, absPath)
+	if err != nil {
+		relPath = absPath
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// resolveWritablePath resolves a path like resolvePath, refusing the paths of the read-only
+// context directories and the paths outside the working directory, whatever the auto-approval
+// settings: only the files of the working directory can be edited.
+func (a *Agent) resolveWritablePath(path string) (string, string, error) {
+	absPath, relPath, err := a.resolvePath(path)
+	if err != nil {
+		return "", "", err
+	}
+	if root := a.rootOf(absPath); root != nil {
+		return "", "", fmt.Errorf("%s is in the read-only context directory %s, only the files of the working directory can be edited", path, root.Name)
+	}
+	if !within(filepath.Clean(a.opts.WorkingDir), absPath) {
+		return "", "", fmt.Errorf("%s is outside the working directory, only the files of the working directory can be edited", path)
+	}
+	return absPath, relPath, nil
+}
@@ -0,0 +1,482 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/hooks"
+	"github.com/kazz187/goline/internal/core/index"
+	"github.com/kazz187/goline/internal/core/shell"
+	"github.com/kazz187/goline/internal/tracing"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+const (
+	// maxToolOutput limits the output of a tool sent to the AI, which is further limited by
+	// the remaining context window, see outputBudget
+	maxToolOutput = 50000
+	// maxListedFiles limits the number of files listed by list_files
+	maxListedFiles = 200
+	// maxSearchResults limits the number of lines returned by search_files
+	maxSearchResults = 300
+)
+
+const (
+	// commandFailed starts the output of a command that exited with an error
+	commandFailed = "Command failed: "
+	// diagnosticsTag wraps the problems reported by the checks run after an edit
+	diagnosticsTag = "<diagnostics>"
+)
+
+// noToolUsedMessage is sent when a response does not use a tool
+const noToolUsedMessage = `[ERROR] You did not use a tool in your previous response! Please retry with a tool use.
+
+If you have completed the task, use the attempt_completion tool. Otherwise, use the tool that takes the next step of the task.`
+
+// runTool approves and runs a tool use, returning its output for the AI
+func (a *Agent) runTool(ctx context.Context, toolUse assistantmessage.ToolUse, result *Result) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "tool.execute", tracing.AttrTool.String(string(toolUse.Name)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := assistantmessage.ValidateToolUse(toolUse); err != nil {
+		return "", &mistakeError{kind: mistakeInvalidParams, err: err}
+	}
+	if err := a.checkReadOnly(toolUse); err != nil {
+		return "", err
+	}
+	approved, err := a.approve(ctx, toolUse)
+	if err != nil {
+		return "", err
+	}
+	if !approved {
+		return "", ErrDenied
+	}
+	if err := a.runHooks(ctx, hooks.Payload{Event: hooks.EventToolApproved, Tool: string(toolUse.Name), Params: formatHookParams(toolUse.Params)}); err != nil {
+		return "", fmt.Errorf("denied by a hook: %w", err)
+	}
+
+	params, turn := toolUse.Params, result.Turns
+	switch toolUse.Name {
+	case assistantmessage.ReadFileToolName:
+		return a.readFile(params[assistantmessage.PathParam], params[assistantmessage.StartLineParam], params[assistantmessage.EndLineParam])
+	case assistantmessage.WriteToFileToolName:
+		return a.writeFileInMode(ctx, params[assistantmessage.PathParam], params[assistantmessage.ContentParam], params[assistantmessage.ModeParam], turn)
+	case assistantmessage.ReplaceInFileToolName:
+		return a.replaceInFile(ctx, params[assistantmessage.PathParam], params[assistantmessage.DiffParam], turn)
+	case assistantmessage.ListFilesToolName:
+		return a.listFiles(params[assistantmessage.PathParam], params[assistantmessage.RecursiveParam] == "true")
+	case assistantmessage.SearchFilesToolName:
+		return a.searchFiles(params[assistantmessage.PathParam], params[assistantmessage.RegexParam], params[assistantmessage.FilePatternParam])
+	case assistantmessage.SemanticSearchToolName:
+		return a.semanticSearch(ctx, params[assistantmessage.QueryParam], params[assistantmessage.PathParam])
+	case assistantmessage.ExecuteCommandToolName:
+		return a.executeCommand(ctx, params[assistantmessage.CommandParam])
+	case assistantmessage.NewTaskToolName:
+		return a.delegate(ctx, params, result)
+	default:
+		if _, ok := a.opts.Plugins.Lookup(toolUse.Name); ok {
+			return a.opts.Plugins.Run(ctx, a.opts.WorkingDir, toolUse)
+		}
+		return "", fmt.Errorf("tool %s is not available", toolUse.Name)
+	}
+}
+
+// resolvePath resolves a path given by the AI against the working directory, or against a
+// context directory for paths written name:path, refusing paths blocked by .golineignore.
+// The returned path is the one shown to the AI, see displayPath.
+func (a *Agent) resolvePath(path string) (string, string, error) {
+	absPath := path
+	if root, rel, ok := a.rootPath(path); ok {
+		absPath = filepath.Join(root.Path, rel)
+	} else if !filepath.IsAbs(path) {
+		absPath = filepath.Join(a.opts.WorkingDir, path)
+	}
+	absPath = filepath.Clean(absPath)
+	if !a.accessible(absPath) {
+		return "", "", fmt.Errorf("access to %s is blocked by %s", path, a.blockingRules())
+	}
+	return absPath, a.displayPath(absPath), nil
+}
+
+// blockingRules names the rules blocking the paths the tools may not access
+func (a *Agent) blockingRules() string {
+	if len(a.opts.DeniedPaths) > 0 {
+		return "the .golineignore file or the outbound policy"
+	}
+	return "the .golineignore file"
+}
+
+// writeFile creates or replaces a file, keeping the CRLF line breaks of the file it replaces
+func (a *Agent) writeFile(ctx context.Context, path, content string, turn int) (string, error) {
+	return a.edit(ctx, path, turn, true, func(original string) (string, error) {
+		return assistantmessage.MatchLineEndings(original, content), nil
+	})
+}
+
+// replaceInFile applies SEARCH/REPLACE blocks or a unified diff to a file
+func (a *Agent) replaceInFile(ctx context.Context, path, diff string, turn int) (string, error) {
+	return a.edit(ctx, path, turn, false, func(original string) (string, error) {
+		content, err := assistantmessage.ApplyFileDiff(diff, original)
+		if err != nil {
+			return "", &mistakeError{kind: mistakeFailedDiff, err: err}
+		}
+		return content, nil
+	})
+}
+
+// edit writes the new content of a file through the applier, which saves a checkpoint first,
+// records the modification and runs the on_file_written hooks.
+// The whole content of a file is written over the content the AI last saw: when the file was
+// modified since, or while the user reviews the edit, the edit is merged with the
+// modifications instead of overwriting them (see resolveConflict).
+func (a *Agent) edit(ctx context.Context, path string, turn int, wholeFile bool, newContent func(original string) (string, error)) (string, error) {
+	absPath, relPath, err := a.resolveWritablePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	modification := pb.ModificationType_MODIFICATION_TYPE_UPDATE
+	original, err := os.ReadFile(absPath)
+	if errors.Is(err, os.ErrNotExist) {
+		modification = pb.ModificationType_MODIFICATION_TYPE_CREATE
+	} else if err != nil {
+		return "", err
+	}
+
+	base := string(original)
+	if seen, ok := a.seen[absPath]; ok && wholeFile {
+		base = seen
+	}
+	content, err := newContent(base)
+	if err != nil {
+		return "", err
+	}
+	merged := base != string(original)
+	if merged {
+		content, err = a.resolveConflict(ctx, apply.Conflict{Path: relPath, Base: base, Current: string(original), Proposed: content})
+		if err != nil {
+			return "", err
+		}
+		if content == string(original) {
+			a.seen[absPath] = content
+			return fmt.Sprintf(conflictKeptMessage, relPath), nil
+		}
+	}
+	content, feedback, err := a.reviewEdit(ctx, relPath, string(original), content)
+	if err != nil {
+		return "", err
+	}
+	if content == string(original) && feedback != "" {
+		return fmt.Sprintf("The user rejected your change to %s, the file was not modified.\n\n%s", relPath, feedback), nil
+	}
+
+	// The checkpoint saved before the edit is where the task can be restored or branched from
+	for attempt := 1; ; attempt++ {
+		edit := apply.Edit{Path: relPath, Type: modification, Content: content}
+		if modification == pb.ModificationType_MODIFICATION_TYPE_UPDATE {
+			edit.BaseHash = apply.HashContent(string(original))
+		}
+		checkpointEvent, err := a.opts.Applier.Apply(fmt.Sprintf("turn-%d", turn), []apply.Edit{edit})
+		if checkpointEvent != nil {
+			record(a, a.opts.Recorder.RecordCheckpoint, checkpointEvent)
+		}
+		var conflict *apply.ConflictError
+		if !errors.As(err, &conflict) || attempt == maxConflictAttempts {
+			if err != nil {
+				return "", err
+			}
+			break
+		}
+
+		// The file was modified while the edit was prepared or reviewed
+		current, err := os.ReadFile(absPath)
+		if errors.Is(err, os.ErrNotExist) {
+			modification = pb.ModificationType_MODIFICATION_TYPE_CREATE
+		} else if err != nil {
+			return "", err
+		}
+		content, err = a.resolveConflict(ctx, apply.Conflict{Path: relPath, Base: string(original), Current: string(current), Proposed: content})
+		if err != nil {
+			return "", err
+		}
+		original, merged = current, true
+		if content == string(original) {
+			a.seen[absPath] = content
+			return fmt.Sprintf(conflictKeptMessage, relPath), nil
+		}
+	}
+	a.seen[absPath] = content
+	a.opts.RecentFiles.Edited(relPath)
+
+	fileDiff := checkpoint.FileDiff{RelativePath: relPath, AbsolutePath: absPath, Before: string(original), After: content, BeforeMode: filemode.Regular, AfterMode: filemode.Regular}
+	if modification == pb.ModificationType_MODIFICATION_TYPE_CREATE {
+		fileDiff.BeforeMode = filemode.Empty
+	}
+	diff, err := checkpoint.FormatPatch([]checkpoint.FileDiff{fileDiff})
+	if err != nil {
+		diff = ""
+	}
+	record(a, a.opts.Recorder.RecordFileModification, &pb.FileModificationEvent{
+		FilePath: relPath,
+		Type:     modification,
+		Diff:     diff,
+	})
+	// The on_file_written hooks are the diagnostics of the written file, e.g. a linter, and
+	// their failures are reported for the AI to fix
+	diagnostics := a.runHooks(ctx, hooks.Payload{Event: hooks.EventFileWritten, Path: relPath})
+
+	output := fmt.Sprintf("Updated %s.", relPath)
+	if modification == pb.ModificationType_MODIFICATION_TYPE_CREATE {
+		output = fmt.Sprintf("Created %s.", relPath)
+	}
+	if merged {
+		output += "\n\n" + fmt.Sprintf(conflictMergedMessage, relPath)
+	}
+	if diagnostics != nil {
+		output += fmt.Sprintf("\n\nThe checks run after writing the file reported problems:\n%s\n%v\n</diagnostics>", diagnosticsTag, diagnostics)
+	}
+	if feedback != "" {
+		output += "\n\n" + feedback
+	}
+	return output, nil
+}
+
+// listFiles lists the files of a directory, recursively or not
+func (a *Agent) listFiles(path string, recursive bool) (string, error) {
+	absPath, _, err := a.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var files []string
+	truncated := false
+	err = a.ignoreFor(absPath).WalkAllowed(absPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == absPath {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if len(files) >= maxListedFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		rel, _ := filepath.Rel(absPath, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			rel += "/"
+		}
+		files = append(files, rel)
+		if d.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(files)
+	if len(files) == 0 {
+		return "No files found.", nil
+	}
+	output := strings.Join(files, "\n")
+	if truncated {
+		output += fmt.Sprintf("\n\n[only the first %d files are listed]", maxListedFiles)
+	}
+	return output, nil
+}
+
+// searchFiles searches the files under a directory for a regular expression
+func (a *Agent) searchFiles(path, pattern, filePattern string) (string, error) {
+	absPath, _, err := a.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	if filePattern == "" {
+		filePattern = "*"
+	}
+
+	var results []searchMatch
+	err = a.ignoreFor(absPath).WalkAllowed(absPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if match, _ := filepath.Match(filePattern, d.Name()); !match {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil || isBinary(data) {
+			return nil
+		}
+		rel := a.displayPath(p)
+		matched := 0
+		defer func() {
+			if matched > 0 {
+				a.opts.Audit.RecordFile(rel, matched)
+			}
+		}()
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if len(results) >= maxSearchResults {
+				return filepath.SkipAll
+			}
+			results = append(results, searchMatch{location: fmt.Sprintf("%s:%d", rel, i+1), line: line, loc: loc})
+			matched += len(line)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(results) == 0 {
+		return "No results found.", nil
+	}
+	output := formatMatches(results, a.outputBudget())
+	if len(results) >= maxSearchResults {
+		output += fmt.Sprintf("\n\n[only the first %d results are shown]", maxSearchResults)
+	}
+	return output, nil
+}
+
+// semanticSearch searches the semantic index for the chunks of files related to a query
+func (a *Agent) semanticSearch(ctx context.Context, query, path string) (string, error) {
+	if a.opts.Index == nil {
+		return "", errors.New("the workspace is not indexed, run `goline index` first")
+	}
+	dir := ""
+	if path != "" {
+		absPath, relPath, err := a.resolvePath(path)
+		if err != nil {
+			return "", err
+		}
+		if root := a.rootOf(absPath); root != nil {
+			return "", fmt.Errorf("only the working directory is indexed, search the context directory %s with search_files", root.Name)
+		}
+		dir = relPath
+	}
+	results, err := a.opts.Index.Search(ctx, query, dir, index.DefaultLimit)
+	if err != nil {
+		return "", err
+	}
+	// The index may hold chunks of files ignored since it was built
+	allowed := results[:0]
+	for _, r := range results {
+		if a.ignore.ValidateAccess(filepath.Join(a.opts.WorkingDir, filepath.FromSlash(r.Path))) {
+			allowed = append(allowed, r)
+			a.opts.Audit.RecordFile(r.Path, len(r.Content))
+		}
+	}
+	return index.FormatResults(allowed), nil
+}
+
+// executeCommand runs a shell command in the working directory and returns its combined output.
+// A command that fails is not an error of the tool, its exit status is reported to the AI.
+func (a *Agent) executeCommand(ctx context.Context, command string) (string, error) {
+	if path := a.ignore.ValidateCommand(command); path != "" {
+		return "", fmt.Errorf("the command accesses %s, which is blocked by %s", path, a.blockingRules())
+	}
+
+	cmd := shell.Default().Command(ctx, command)
+	cmd.Dir = a.opts.WorkingDir
+	output, err := cmd.CombinedOutput()
+
+	// Commands on Windows write CRLF line breaks
+	result := strings.ReplaceAll(string(output), "\r\n", "\n")
+	result = truncateHeadTail(result, a.outputBudget())
+	if err != nil {
+		return fmt.Sprintf("%s%v\nOutput:\n%s", commandFailed, err, result), nil
+	}
+	return fmt.Sprintf("Command completed.\nOutput:\n%s", result), nil
+}
+
+// toolResultMessage formats the result of a tool use as the next user message
+func toolResultMessage(toolUse assistantmessage.ToolUse, output string, err error) string {
+	header := fmt.Sprintf("[%s for '%s']", toolUse.Name, describeToolUse(toolUse))
+	switch {
+	case errors.Is(err, ErrDenied):
+		return header + " Result:\nThe user denied this operation."
+	case err != nil:
+		return fmt.Sprintf("%s Error:\n%v", header, err)
+	default:
+		return fmt.Sprintf("%s Result:\n%s", header, output)
+	}
+}
+
+// describeToolUse returns the main argument of a tool use for display
+func describeToolUse(toolUse assistantmessage.ToolUse) string {
+	if command, ok := toolUse.Params[assistantmessage.CommandParam]; ok {
+		return command
+	}
+	if regex, ok := toolUse.Params[assistantmessage.RegexParam]; ok {
+		return fmt.Sprintf("%s in %s", regex, toolUse.Params[assistantmessage.PathParam])
+	}
+	for _, param := range []assistantmessage.ToolParamName{assistantmessage.PromptParam, assistantmessage.QuestionParam} {
+		if text, ok := toolUse.Params[param]; ok {
+			firstLine, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+			return firstLine
+		}
+	}
+	return toolUse.Params[assistantmessage.PathParam]
+}
+
+// formatParams formats the parameters of a tool use in a stable order for the task history
+func formatParams(params map[assistantmessage.ToolParamName]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "<%s>%s</%s>\n", name, params[assistantmessage.ToolParamName(name)], name)
+	}
+	return b.String()
+}
+
+// formatHookParams converts the parameters of a tool use for a hook payload
+func formatHookParams(params map[assistantmessage.ToolParamName]string) map[string]string {
+	converted := make(map[string]string, len(params))
+	for name, value := range params {
+		converted[string(name)] = value
+	}
+	return converted
+}
+
+// isBinary reports whether data looks like the content of a binary file
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
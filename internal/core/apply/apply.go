@@ -0,0 +1,345 @@
+package apply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/regions"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/tracing"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Edit represents a single file edit proposed by the agent
+type Edit struct {
+	// Path to the file, relative to the working directory
+	Path string
+	// Type of modification
+	Type pb.ModificationType
+	// New path of the file (for renames)
+	NewPath string
+	// Content of the file after the edit (for creates and updates)
+	Content string
+	// BaseHash is the hash of the content the edit was made from, see HashContent. When set,
+	// the edit is refused with a ConflictError if the file no longer has this content.
+	BaseHash string
+}
+
+// HashContent returns the hex encoded SHA-256 hash of the content of a file
+func HashContent(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+// ConflictError is returned by Apply when a file was modified since the content an edit was
+// made from was read, so that the edit would overwrite the modification
+type ConflictError struct {
+	// Path is the path of the file, relative to the working directory
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was modified since it was read", e.Path)
+}
+
+// Applier applies multi-file edits for a task.
+// Before the first edit is written, a checkpoint is saved, the edited files that checkpoints
+// do not capture are backed up, and an apply journal is recorded in the task directory.
+// The journal is updated after every edit and removed once all edits are applied, so an
+// interrupted apply can be rolled back or continued.
+type Applier struct {
+	taskID      string
+	workingDir  string
+	checkpoints *checkpoint.Service
+	regions     *regions.Tracker
+	journalPath string
+	lock        *tasklock.Lock
+}
+
+// NewApplier creates a new applier for a task
+func NewApplier(taskID, workingDir string, checkpoints *checkpoint.Service) (*Applier, error) {
+	journalPath, err := getJournalPath(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker, err := regions.NewTracker(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Applier{
+		taskID:      taskID,
+		workingDir:  workingDir,
+		checkpoints: checkpoints,
+		regions:     tracker,
+		journalPath: journalPath,
+	}, nil
+}
+
+// SetLock sets the task lock checked before every write.
+// Without a lock, writes are not checked.
+func (a *Applier) SetLock(lock *tasklock.Lock) {
+	a.lock = lock
+}
+
+// Apply applies edits in order and returns the checkpoint saved before them, to record in the
+// history of the task
+func (a *Applier) Apply(suggestionID string, edits []Edit) (_ *pb.CheckpointEvent, err error) {
+	_, span := tracing.Start(context.Background(), "tool.apply_edits",
+		tracing.AttrTaskID.String(a.taskID),
+		attribute.String("goline.suggestion.id", suggestionID),
+		attribute.Int("goline.edits", len(edits)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if err := a.lock.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Refuse to start while a previous apply is unresolved
+	pending, err := a.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("a previous apply of suggestion %s was interrupted, roll it back or continue it first", pending.SuggestionId)
+	}
+
+	// Refuse to overwrite the files modified since the edits were made
+	if err := a.checkBases(edits); err != nil {
+		return nil, err
+	}
+
+	// Save a checkpoint to roll back to
+	event, err := a.checkpoints.SaveCheckpoint(a.taskID, a.workingDir, checkpointPrefix+suggestionID, "Saved automatically before applying edits")
+	if err != nil {
+		return nil, fmt.Errorf("failed to save pre-apply checkpoint: %w", err)
+	}
+	if err := a.backup(event.CheckpointId, edits); err != nil {
+		return nil, fmt.Errorf("failed to back up the files checkpoints do not capture: %w", err)
+	}
+	if err := a.recordApplied(event.CheckpointId, edits); err != nil {
+		return nil, fmt.Errorf("failed to record the edited paths: %w", err)
+	}
+
+	// Record the journal before touching any file
+	journal := &pb.ApplyJournal{
+		SuggestionId: suggestionID,
+		CheckpointId: event.CheckpointId,
+		StartedAt:    time.Now().Format(time.RFC3339),
+	}
+	for _, edit := range edits {
+		journal.Entries = append(journal.Entries, &pb.ApplyJournalEntry{
+			FilePath:    edit.Path,
+			Type:        edit.Type,
+			NewFilePath: edit.NewPath,
+			Content:     edit.Content,
+			ContentHash: HashContent(edit.Content),
+			State:       pb.ApplyEntryState_APPLY_ENTRY_STATE_PENDING,
+		})
+	}
+	if err := saveJournal(a.journalPath, journal); err != nil {
+		return nil, err
+	}
+
+	return event, a.run(journal)
+}
+
+// checkBases returns a ConflictError for the first edit whose file no longer has the content
+// the edit was made from. A file missing now has no content.
+func (a *Applier) checkBases(edits []Edit) error {
+	for _, edit := range edits {
+		if edit.BaseHash == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(a.workingDir, edit.Path))
+		if errors.Is(err, os.ErrNotExist) {
+			return &ConflictError{Path: edit.Path}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", edit.Path, err)
+		}
+		if HashContent(string(data)) != edit.BaseHash {
+			return &ConflictError{Path: edit.Path}
+		}
+	}
+	return nil
+}
+
+// Pending returns the journal of an interrupted apply, or nil if there is none
+func (a *Applier) Pending() (*pb.ApplyJournal, error) {
+	return loadJournal(a.journalPath)
+}
+
+// Continue applies the pending edits of an interrupted apply
+func (a *Applier) Continue() error {
+	journal, err := a.Pending()
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return errors.New("no interrupted apply to continue")
+	}
+
+	return a.run(journal)
+}
+
+// Rollback restores the checkpoint saved before an interrupted apply started
+func (a *Applier) Rollback() error {
+	journal, err := a.Pending()
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return errors.New("no interrupted apply to roll back")
+	}
+	if err := a.lock.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := a.checkpoints.RestoreCheckpoint(a.taskID, a.workingDir, journal.CheckpointId); err != nil {
+		return fmt.Errorf("failed to restore pre-apply checkpoint: %w", err)
+	}
+	if err := a.restoreBackups(journal.CheckpointId); err != nil {
+		return fmt.Errorf("failed to restore backed up files: %w", err)
+	}
+
+	return removeJournal(a.journalPath)
+}
+
+// Discard forgets an interrupted apply and keeps the working directory as it is
+func (a *Applier) Discard() error {
+	if err := a.lock.Validate(); err != nil {
+		return err
+	}
+	return removeJournal(a.journalPath)
+}
+
+// run applies the pending entries of a journal
+func (a *Applier) run(journal *pb.ApplyJournal) error {
+	for _, entry := range journal.Entries {
+		if entry.State == pb.ApplyEntryState_APPLY_ENTRY_STATE_APPLIED {
+			continue
+		}
+
+		// Stop as soon as another process has taken the task over
+		if err := a.lock.Validate(); err != nil {
+			return err
+		}
+
+		before, _ := os.ReadFile(filepath.Join(a.workingDir, entry.FilePath))
+		if err := a.applyEntry(entry); err != nil {
+			return fmt.Errorf("failed to apply edit to %s: %w", entry.FilePath, err)
+		}
+		a.trackEntry(entry, string(before))
+
+		entry.State = pb.ApplyEntryState_APPLY_ENTRY_STATE_APPLIED
+		if err := saveJournal(a.journalPath, journal); err != nil {
+			return err
+		}
+	}
+
+	return removeJournal(a.journalPath)
+}
+
+// applyEntry applies a single edit to the working directory.
+// Applying an edit twice has the same result as applying it once, so an edit that
+// was written right before the journal was updated can safely be applied again.
+func (a *Applier) applyEntry(entry *pb.ApplyJournalEntry) error {
+	path := filepath.Join(a.workingDir, entry.FilePath)
+
+	switch entry.Type {
+	case pb.ModificationType_MODIFICATION_TYPE_DELETE:
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	case pb.ModificationType_MODIFICATION_TYPE_RENAME:
+		newPath := filepath.Join(a.workingDir, entry.NewFilePath)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			// Already renamed
+			if _, err := os.Stat(newPath); err == nil {
+				return nil
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			return err
+		}
+		return os.Rename(path, newPath)
+	default:
+		return writeFile(path, []byte(entry.Content))
+	}
+}
+
+// trackEntry records the lines changed by an applied edit.
+// Tracking is informational, so failures are logged instead of failing the apply.
+func (a *Applier) trackEntry(entry *pb.ApplyJournalEntry, before string) {
+	var err error
+	switch entry.Type {
+	case pb.ModificationType_MODIFICATION_TYPE_DELETE:
+		err = a.regions.RecordDelete(entry.FilePath)
+	case pb.ModificationType_MODIFICATION_TYPE_RENAME:
+		err = a.regions.RecordRename(entry.FilePath, entry.NewFilePath)
+	default:
+		err = a.regions.RecordEdit(entry.FilePath, before, entry.Content)
+	}
+	if err != nil {
+		slog.Warn("Failed to track edited regions", "path", entry.FilePath, "error", err)
+	}
+}
+
+// writeFile writes a file atomically: the content is written and synced to a temporary file
+// in the same directory, which then replaces the file, so it is never left half written.
+// The parent directories are created, the mode of an existing file is kept and a symlink is
+// written through to its target.
+func writeFile(path string, content []byte) error {
+	return writeFileMode(path, content, 0644)
+}
+
+// writeFileMode writes a file like writeFile, with mode if the file does not exist yet
+func writeFileMode(path string, content []byte, mode os.FileMode) (err error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// The .tmp suffix keeps a file left by a crash out of the checkpoints
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goline-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,297 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// newInterruptedApplier sets up an applier whose apply was interrupted after the first of three edits
+func newInterruptedApplier(t *testing.T) (*Applier, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	workingDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a1", "b.txt": "b1", "c.txt": "c1"} {
+		if err := os.WriteFile(filepath.Join(workingDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	applier, err := NewApplier("test-task-apply", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("Failed to create applier: %v", err)
+	}
+
+	// Make the second edit fail by turning its target into a directory
+	blocker := filepath.Join(workingDir, "b.txt")
+	if err := os.Remove(blocker); err != nil {
+		t.Fatalf("Failed to remove b.txt: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(blocker, "child"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	_, err = applier.Apply("suggestion-1", []Edit{
+		{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "a2"},
+		{Path: "b.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "b2"},
+		{Path: "c.txt", Type: pb.ModificationType_MODIFICATION_TYPE_DELETE},
+	})
+	if err == nil {
+		t.Fatal("Expected apply to fail")
+	}
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatalf("Failed to remove directory: %v", err)
+	}
+
+	return applier, workingDir
+}
+
+func TestApplierContinue(t *testing.T) {
+	applier, workingDir := newInterruptedApplier(t)
+
+	journal, err := applier.Pending()
+	if err != nil || journal == nil {
+		t.Fatalf("Expected an interrupted apply, got %v (%v)", journal, err)
+	}
+	states := []pb.ApplyEntryState{
+		pb.ApplyEntryState_APPLY_ENTRY_STATE_APPLIED,
+		pb.ApplyEntryState_APPLY_ENTRY_STATE_PENDING,
+		pb.ApplyEntryState_APPLY_ENTRY_STATE_PENDING,
+	}
+	for i, entry := range journal.Entries {
+		if entry.State != states[i] {
+			t.Errorf("Expected %s to be %v, got %v", entry.FilePath, states[i], entry.State)
+		}
+	}
+
+	if err := applier.Continue(); err != nil {
+		t.Fatalf("Failed to continue: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(workingDir, "b.txt")); string(content) != "b2" {
+		t.Errorf("Expected b.txt to be updated, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected c.txt to be deleted, got %v", err)
+	}
+	if journal, _ := applier.Pending(); journal != nil {
+		t.Error("Expected the journal to be removed")
+	}
+}
+
+func TestApplierRollback(t *testing.T) {
+	applier, workingDir := newInterruptedApplier(t)
+
+	if err := applier.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	for name, expected := range map[string]string{"a.txt": "a1", "c.txt": "c1"} {
+		if content, _ := os.ReadFile(filepath.Join(workingDir, name)); string(content) != expected {
+			t.Errorf("Expected %s to be %q, got %q", name, expected, content)
+		}
+	}
+	// b.txt did not exist when the pre-apply checkpoint was saved
+	if _, err := os.Stat(filepath.Join(workingDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected b.txt to be removed, got %v", err)
+	}
+	if journal, _ := applier.Pending(); journal != nil {
+		t.Error("Expected the journal to be removed")
+	}
+}
+
+func TestApplierRollbackRestoresBackups(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	// .env files are excluded from checkpoints
+	if err := os.WriteFile(filepath.Join(workingDir, ".env"), []byte("TOKEN=1"), 0600); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(workingDir, "blocker", "child"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	applier, err := NewApplier("test-task-backup", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("Failed to create applier: %v", err)
+	}
+	_, err = applier.Apply("suggestion-1", []Edit{
+		{Path: ".env", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "TOKEN=2"},
+		{Path: "blocker", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "x"},
+	})
+	if err == nil {
+		t.Fatal("Expected apply to fail")
+	}
+	if content, _ := os.ReadFile(filepath.Join(workingDir, ".env")); string(content) != "TOKEN=2" {
+		t.Fatalf("Expected .env to be updated, got %q", content)
+	}
+
+	if err := applier.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(workingDir, ".env"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected .env to keep its mode, got %v (%v)", info, err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(workingDir, ".env")); string(content) != "TOKEN=1" {
+		t.Errorf("Expected .env to be restored from its backup, got %q", content)
+	}
+}
+
+func TestApplierRefusesModifiedFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	path := filepath.Join(workingDir, "a.txt")
+	if err := os.WriteFile(path, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applier, err := NewApplier("test-task-conflict", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("Failed to create applier: %v", err)
+	}
+
+	edit := Edit{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "edited", BaseHash: HashContent("read")}
+	event, err := applier.Apply("suggestion-1", []Edit{edit})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Path != "a.txt" || event != nil {
+		t.Fatalf("Expected a conflict on a.txt, got %v (%v)", err, event)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "modified" {
+		t.Errorf("Expected a.txt to keep its modification, got %q", content)
+	}
+
+	edit.BaseHash = HashContent("modified")
+	if _, err := applier.Apply("suggestion-2", []Edit{edit}); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "edited" {
+		t.Errorf("Expected a.txt to be edited, got %q", content)
+	}
+}
+
+func TestApplierUndo(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	path := filepath.Join(workingDir, "a.txt")
+	if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applier, err := NewApplier("test-task-undo", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("Failed to create applier: %v", err)
+	}
+	for i, content := range []string{"v1", "v2"} {
+		edits := []Edit{{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: content}}
+		if i == 1 {
+			edits = append(edits, Edit{Path: "b.txt", Type: pb.ModificationType_MODIFICATION_TYPE_CREATE, Content: "b"})
+		}
+		if _, err := applier.Apply(fmt.Sprintf("turn-%d", i+1), edits); err != nil {
+			t.Fatalf("Failed to apply: %v", err)
+		}
+	}
+
+	undone, err := applier.Undo(false)
+	if err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if undone.SuggestionID != "turn-2" || strings.Join(undone.Paths, ",") != "a.txt,b.txt" {
+		t.Errorf("Expected turn-2 to be undone on a.txt and b.txt, got %+v", undone)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "v1" {
+		t.Errorf("Expected a.txt to be back to v1, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected b.txt to be removed, got %v", err)
+	}
+
+	if undone, err := applier.Undo(false); err != nil || undone.SuggestionID != "turn-1" {
+		t.Fatalf("Expected turn-1 to be undone, got %+v (%v)", undone, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "v0" {
+		t.Errorf("Expected a.txt to be back to v0, got %q", content)
+	}
+	if _, err := applier.Undo(false); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected nothing left to undo, got %v", err)
+	}
+}
+
+func TestApplierUndoOtherChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a0", "notes.txt": "n0"} {
+		if err := os.WriteFile(filepath.Join(workingDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	applier, err := NewApplier("test-task-undo-others", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatalf("Failed to create applier: %v", err)
+	}
+	if _, err := applier.Apply("turn-1", []Edit{{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "a1"}}); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+	// The user edits a file the apply did not touch
+	notes := filepath.Join(workingDir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("n1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var others *OtherChangesError
+	if _, err := applier.Undo(false); !errors.As(err, &others) || strings.Join(others.Paths, ",") != "notes.txt" || others.SuggestionID != "turn-1" {
+		t.Fatalf("Expected notes.txt to be reported, got %v", err)
+	}
+	if content, _ := os.ReadFile(notes); string(content) != "n1" {
+		t.Errorf("Expected notes.txt to be kept, got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(workingDir, "a.txt")); string(content) != "a1" {
+		t.Errorf("Expected a.txt to be kept, got %q", content)
+	}
+
+	if _, err := applier.Undo(true); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if content, _ := os.ReadFile(notes); string(content) != "n0" {
+		t.Errorf("Expected notes.txt to be reverted, got %q", content)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(script, []byte("old"), 0755); err != nil {
+		t.Fatalf("Failed to write run.sh: %v", err)
+	}
+	link := filepath.Join(dir, "link.sh")
+	if err := os.Symlink("run.sh", link); err != nil {
+		t.Skipf("Symlinks are not supported: %v", err)
+	}
+
+	if err := writeFile(link, []byte("new")); err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "run.sh" {
+		t.Errorf("Expected the symlink to be kept, got %q (%v)", target, err)
+	}
+	info, err := os.Stat(script)
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected run.sh to keep its mode, got %v (%v)", info, err)
+	}
+	if content, _ := os.ReadFile(script); string(content) != "new" {
+		t.Errorf("Expected run.sh to be written through the symlink, got %q", content)
+	}
+
+	if err := writeFile(filepath.Join(dir, "a", "b", "new.txt"), []byte("x")); err != nil {
+		t.Fatalf("writeFile() of a new file error = %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".goline-") {
+			t.Errorf("Temporary file %s was left behind", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package apply
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// backupsDirName is the directory of the task directory holding the backups of the files
+// that checkpoints do not capture, one directory per pre-apply checkpoint
+const backupsDirName = "backups"
+
+// backupDir returns the directory of the backups taken with a checkpoint
+func (a *Applier) backupDir(checkpointID string) string {
+	return filepath.Join(filepath.Dir(a.journalPath), backupsDirName, checkpointID)
+}
+
+// backup copies the existing files modified by edits that checkpoints do not capture, such as
+// ignored files, so a rollback can restore them along with the checkpoint
+func (a *Applier) backup(checkpointID string, edits []Edit) error {
+	for _, edit := range edits {
+		if edit.Type == pb.ModificationType_MODIFICATION_TYPE_CREATE {
+			continue
+		}
+		path := filepath.Join(a.workingDir, edit.Path)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		captured, err := a.checkpoints.Captures(a.taskID, a.workingDir, edit.Path)
+		if err != nil {
+			return err
+		}
+		if captured {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := writeFileMode(filepath.Join(a.backupDir(checkpointID), edit.Path), content, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBackups writes back the files backed up with a checkpoint
+func (a *Applier) restoreBackups(checkpointID string) error {
+	dir := a.backupDir(checkpointID)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeFileMode(filepath.Join(a.workingDir, relPath), content, info.Mode().Perm())
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
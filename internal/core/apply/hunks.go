@@ -0,0 +1,69 @@
+package apply
+
+import (
+	"strings"
+
+	utilsdiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Hunk is a contiguous change of lines between the original and the proposed content of a file,
+// which the user can accept or reject on its own
+type Hunk struct {
+	// Line is the first line of the hunk in the original content, starting at 1
+	Line int
+	// Before is the text of the original content replaced by the hunk, empty for an insertion
+	Before string
+	// After is the proposed text, empty for a deletion
+	After string
+	// Accepted reports whether the hunk is applied, see JoinHunks
+	Accepted bool
+
+	// offset is the byte offset of Before in the original content
+	offset int
+}
+
+// SplitHunks splits the changes from original to proposed into hunks, all accepted
+func SplitHunks(original, proposed string) []Hunk {
+	var hunks []Hunk
+	var current *Hunk
+	offset, line := 0, 1
+	for _, d := range utilsdiff.Do(original, proposed) {
+		if d.Type == diffmatchpatch.DiffEqual {
+			current = nil
+			offset += len(d.Text)
+			line += strings.Count(d.Text, "\n")
+			continue
+		}
+		if current == nil {
+			hunks = append(hunks, Hunk{Line: line, Accepted: true, offset: offset})
+			current = &hunks[len(hunks)-1]
+		}
+		if d.Type == diffmatchpatch.DiffDelete {
+			current.Before += d.Text
+			offset += len(d.Text)
+			line += strings.Count(d.Text, "\n")
+		} else {
+			current.After += d.Text
+		}
+	}
+	return hunks
+}
+
+// JoinHunks returns original with the accepted hunks applied.
+// The hunks must have been split from original by SplitHunks.
+func JoinHunks(original string, hunks []Hunk) string {
+	var b strings.Builder
+	offset := 0
+	for _, hunk := range hunks {
+		b.WriteString(original[offset:hunk.offset])
+		if hunk.Accepted {
+			b.WriteString(hunk.After)
+		} else {
+			b.WriteString(hunk.Before)
+		}
+		offset = hunk.offset + len(hunk.Before)
+	}
+	b.WriteString(original[offset:])
+	return b.String()
+}
@@ -0,0 +1,31 @@
+package apply
+
+import "testing"
+
+func TestSplitAndJoinHunks(t *testing.T) {
+	original := "a\nb\nc\nd\ne\n"
+	proposed := "a\nB\nc\nd\ne\nf\n"
+
+	hunks := SplitHunks(original, proposed)
+	if len(hunks) != 2 {
+		t.Fatalf("SplitHunks() = %+v, want 2 hunks", hunks)
+	}
+	if h := hunks[0]; h.Line != 2 || h.Before != "b\n" || h.After != "B\n" {
+		t.Errorf("first hunk = %+v", h)
+	}
+	if h := hunks[1]; h.Line != 6 || h.Before != "" || h.After != "f\n" {
+		t.Errorf("second hunk = %+v", h)
+	}
+
+	if got := JoinHunks(original, hunks); got != proposed {
+		t.Errorf("JoinHunks() with all hunks = %q, want %q", got, proposed)
+	}
+	hunks[0].Accepted = false
+	if got, want := JoinHunks(original, hunks), "a\nb\nc\nd\ne\nf\n"; got != want {
+		t.Errorf("JoinHunks() without the first hunk = %q, want %q", got, want)
+	}
+	hunks[1].Accepted = false
+	if got := JoinHunks(original, hunks); got != original {
+		t.Errorf("JoinHunks() without any hunk = %q, want %q", got, original)
+	}
+}
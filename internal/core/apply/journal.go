@@ -0,0 +1,130 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// journalFileName is the name of the apply journal file in the task directory
+const journalFileName = "apply_journal.pb"
+
+// getJournalPath returns the path to the apply journal of a task
+func getJournalPath(taskID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".goline", "tasks", taskID, journalFileName), nil
+}
+
+// loadJournal loads an apply journal, returning nil if it does not exist
+func loadJournal(path string) (*pb.ApplyJournal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read apply journal: %w", err)
+	}
+
+	journal := &pb.ApplyJournal{}
+	if err := proto.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("failed to decode apply journal: %w", err)
+	}
+
+	return journal, nil
+}
+
+// saveJournal writes an apply journal and syncs it to disk,
+// so the progress survives the process being killed between two edits
+func saveJournal(path string, journal *pb.ApplyJournal) error {
+	data, err := proto.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("failed to encode apply journal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create task directory: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to write apply journal: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write apply journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write apply journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write apply journal: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// removeJournal removes an apply journal
+func removeJournal(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove apply journal: %w", err)
+	}
+	return nil
+}
+
+// FormatJournal formats an apply journal for display
+func FormatJournal(journal *pb.ApplyJournal) string {
+	var applied, pending []string
+	for _, entry := range journal.Entries {
+		line := fmt.Sprintf("  %s %s", describeType(entry.Type), entry.FilePath)
+		if entry.Type == pb.ModificationType_MODIFICATION_TYPE_RENAME {
+			line += " -> " + entry.NewFilePath
+		}
+
+		if entry.State == pb.ApplyEntryState_APPLY_ENTRY_STATE_APPLIED {
+			applied = append(applied, line)
+		} else {
+			pending = append(pending, line)
+		}
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Applying edits was interrupted (started at %s)\n", journal.StartedAt)
+	fmt.Fprintf(&result, "Applied (%d):\n", len(applied))
+	for _, line := range applied {
+		result.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&result, "Pending (%d):\n", len(pending))
+	for _, line := range pending {
+		result.WriteString(line + "\n")
+	}
+	if journal.CheckpointId != "" {
+		fmt.Fprintf(&result, "Pre-apply checkpoint: %s\n", journal.CheckpointId)
+	}
+
+	return result.String()
+}
+
+// describeType returns a short description of a modification type
+func describeType(t pb.ModificationType) string {
+	switch t {
+	case pb.ModificationType_MODIFICATION_TYPE_CREATE:
+		return "create"
+	case pb.ModificationType_MODIFICATION_TYPE_DELETE:
+		return "delete"
+	case pb.ModificationType_MODIFICATION_TYPE_RENAME:
+		return "rename"
+	default:
+		return "update"
+	}
+}
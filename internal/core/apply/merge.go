@@ -0,0 +1,123 @@
+package apply
+
+import (
+	"sort"
+	"strings"
+)
+
+// Conflict markers around the overlapping changes of a merge, the lines of the file on disk
+// first and those of the edit second, as git writes them
+const (
+	markerCurrent   = "<<<<<<< current\n"
+	markerSeparator = "=======\n"
+	markerProposed  = ">>>>>>> proposed\n"
+)
+
+// Conflict is an edit of a file that was modified since the content the edit was made from
+// was read
+type Conflict struct {
+	// Path is the path of the file, relative to the working directory
+	Path string
+	// Base is the content the edit was made from
+	Base string
+	// Current is the content of the file now
+	Current string
+	// Proposed is the content of the file after the edit
+	Proposed string
+	// Merged is the edit merged into the current content, see Merge
+	Merged string
+	// Conflicts is the number of overlapping changes in Merged
+	Conflicts int
+}
+
+// change is a hunk of one side of a merge, replacing base[start:end] with after
+type change struct {
+	start, end int
+	after      string
+	proposed   bool
+}
+
+// Merge merges the changes from base to proposed into current, line by line. The changes
+// both sides made to the same or adjacent lines conflict unless they are identical: the two
+// versions of the lines are written between conflict markers and counted.
+func Merge(base, current, proposed string) (string, int) {
+	var changes []change
+	for _, hunk := range SplitHunks(base, current) {
+		changes = append(changes, change{start: hunk.offset, end: hunk.offset + len(hunk.Before), after: hunk.After})
+	}
+	for _, hunk := range SplitHunks(base, proposed) {
+		changes = append(changes, change{start: hunk.offset, end: hunk.offset + len(hunk.Before), after: hunk.After, proposed: true})
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].start < changes[j].start })
+
+	var b strings.Builder
+	conflicts, offset := 0, 0
+	for i := 0; i < len(changes); {
+		// Group the changes touching each other
+		start, end := changes[i].start, changes[i].end
+		j := i + 1
+		for j < len(changes) && changes[j].start <= end {
+			end = max(end, changes[j].end)
+			j++
+		}
+		group := changes[i:j]
+		i = j
+
+		b.WriteString(base[offset:start])
+		offset = end
+		currentText := applyChanges(base, start, end, group, false)
+		proposedText := applyChanges(base, start, end, group, true)
+		switch {
+		case currentText == proposedText:
+			b.WriteString(currentText)
+		case !hasSide(group, true):
+			b.WriteString(currentText)
+		case !hasSide(group, false):
+			b.WriteString(proposedText)
+		default:
+			conflicts++
+			b.WriteString(markerCurrent)
+			b.WriteString(terminateLine(currentText))
+			b.WriteString(markerSeparator)
+			b.WriteString(terminateLine(proposedText))
+			b.WriteString(markerProposed)
+		}
+	}
+	b.WriteString(base[offset:])
+	return b.String(), conflicts
+}
+
+// applyChanges returns base[start:end] with the changes of one side applied
+func applyChanges(base string, start, end int, changes []change, proposed bool) string {
+	var b strings.Builder
+	offset := start
+	for _, c := range changes {
+		if c.proposed != proposed {
+			continue
+		}
+		b.WriteString(base[offset:c.start])
+		b.WriteString(c.after)
+		offset = c.end
+	}
+	b.WriteString(base[offset:end])
+	return b.String()
+}
+
+// hasSide reports whether changes have a change of a side
+func hasSide(changes []change, proposed bool) bool {
+	for _, c := range changes {
+		if c.proposed == proposed {
+			return true
+		}
+	}
+	return false
+}
+
+// terminateLine ends text with a line break, so that the conflict marker following it is on
+// its own line
+func terminateLine(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
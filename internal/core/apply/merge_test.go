@@ -0,0 +1,26 @@
+package apply
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name              string
+		current, proposed string
+		want              string
+		wantConflicts     int
+	}{
+		{"separate changes", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", 0},
+		{"identical changes", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", 0},
+		{"unchanged file", base, "a\nb\nC\nd\ne\n", "a\nb\nC\nd\ne\n", 0},
+		{"overlapping changes", "a\nB\nc\nd\ne\n", "a\nb2\nc\nd\ne\n", "a\n<<<<<<< current\nB\n=======\nb2\n>>>>>>> proposed\nc\nd\ne\n", 1},
+		{"adjacent changes", "a\nB\nc\nd\ne\n", "a\nb\nC\nd\ne\n", "a\n<<<<<<< current\nB\nc\n=======\nb\nC\n>>>>>>> proposed\nd\ne\n", 1},
+		{"last line without line break", "a\nb\nc\nd\nx", "a\nb\nc\nd\ny", "a\nb\nc\nd\n<<<<<<< current\nx\n=======\ny\n>>>>>>> proposed\n", 1},
+	}
+	for _, tt := range tests {
+		got, conflicts := Merge(base, tt.current, tt.proposed)
+		if got != tt.want || conflicts != tt.wantConflicts {
+			t.Errorf("%s: Merge() = %q, %d, want %q, %d", tt.name, got, conflicts, tt.want, tt.wantConflicts)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// checkpointPrefix is the prefix of the names of the checkpoints saved before each apply,
+// followed by the suggestion ID
+const checkpointPrefix = "before apply "
+
+// appliedDirName is the directory of the task directory recording the paths edited by each
+// apply, one file per pre-apply checkpoint
+const appliedDirName = "applied"
+
+// ErrNothingToUndo is returned by Undo when the task has no apply left to undo
+var ErrNothingToUndo = errors.New("no apply left to undo")
+
+// OtherChangesError is returned by Undo when files the apply did not edit were changed since
+// it, by the user or by the commands run after it, so the undo would revert them too
+type OtherChangesError struct {
+	// SuggestionID is the ID of the suggestion of the apply
+	SuggestionID string
+	// Paths are the paths of the files, relative to the working directory
+	Paths []string
+}
+
+func (e *OtherChangesError) Error() string {
+	return fmt.Sprintf("%s changed since the edits of %s without being edited by them", strings.Join(e.Paths, ", "), e.SuggestionID)
+}
+
+// Undone is an apply reverted by Undo
+type Undone struct {
+	// SuggestionID is the ID of the suggestion of the apply, e.g. turn-3
+	SuggestionID string
+	// Checkpoint is the restored checkpoint, to record in the history of the task
+	Checkpoint *pb.CheckpointEvent
+	// Paths are the paths of the restored files, relative to the working directory
+	Paths []string
+}
+
+// Undo reverts the last apply by restoring the checkpoint saved before it, along with the files
+// it backed up. Everything changed since the checkpoint is reverted, including the files
+// written by the commands run after the apply; changes outside the working directory cannot be.
+// The checkpoints the working directory already matches were restored by the previous undos,
+// so each undo goes one apply further back.
+// Unless force is set, nothing is reverted and an OtherChangesError is returned when files the
+// apply did not edit were changed since it.
+func (a *Applier) Undo(force bool) (*Undone, error) {
+	if err := a.lock.Validate(); err != nil {
+		return nil, err
+	}
+	pending, err := a.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("the apply of suggestion %s was interrupted, roll it back or continue it first", pending.SuggestionId)
+	}
+
+	manager, err := a.checkpoints.GetManager(a.taskID, a.workingDir)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := manager.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range checkpoints {
+		suggestionID, ok := strings.CutPrefix(cp.Name, checkpointPrefix)
+		if !ok {
+			continue
+		}
+		diffs, err := manager.GetDiff(cp.ID, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		if !force {
+			applied, err := a.appliedPaths(cp.ID)
+			if err != nil {
+				return nil, err
+			}
+			var others []string
+			for _, diff := range diffs {
+				if !applied[diff.RelativePath] {
+					others = append(others, diff.RelativePath)
+				}
+			}
+			if len(others) > 0 {
+				return nil, &OtherChangesError{SuggestionID: suggestionID, Paths: others}
+			}
+		}
+
+		event, err := a.checkpoints.RestoreCheckpoint(a.taskID, a.workingDir, cp.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore pre-apply checkpoint: %w", err)
+		}
+		if err := a.restoreBackups(cp.ID); err != nil {
+			return nil, fmt.Errorf("failed to restore backed up files: %w", err)
+		}
+		undone := &Undone{SuggestionID: suggestionID, Checkpoint: event}
+		for _, diff := range diffs {
+			undone.Paths = append(undone.Paths, diff.RelativePath)
+		}
+		return undone, nil
+	}
+	return nil, ErrNothingToUndo
+}
+
+// appliedFile returns the file recording the paths edited by the apply of a checkpoint
+func (a *Applier) appliedFile(checkpointID string) string {
+	return filepath.Join(filepath.Dir(a.journalPath), appliedDirName, checkpointID)
+}
+
+// recordApplied records the paths edited by the apply of a checkpoint, one per line
+func (a *Applier) recordApplied(checkpointID string, edits []Edit) error {
+	var paths strings.Builder
+	for _, edit := range edits {
+		paths.WriteString(filepath.ToSlash(edit.Path) + "\n")
+		if edit.NewPath != "" {
+			paths.WriteString(filepath.ToSlash(edit.NewPath) + "\n")
+		}
+	}
+	return writeFile(a.appliedFile(checkpointID), []byte(paths.String()))
+}
+
+// appliedPaths returns the paths edited by the apply of a checkpoint. None are known for the
+// applies recorded before the paths were, so all their changes count as other changes.
+func (a *Applier) appliedPaths(checkpointID string) (map[string]bool, error) {
+	data, err := os.ReadFile(a.appliedFile(checkpointID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the paths edited by the apply: %w", err)
+	}
+	paths := make(map[string]bool)
+	for _, path := range strings.Split(string(data), "\n") {
+		if path != "" {
+			paths[path] = true
+		}
+	}
+	return paths, nil
+}
@@ -1,9 +1,13 @@
 package assistantmessage
 
 import (
+	"context"
 	"errors"
 	"regexp"
 	"strings"
+
+	"github.com/kazz187/goline/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Markers for diff blocks
@@ -14,121 +18,58 @@ const (
 )
 
 // LineTrimmedFallbackMatch attempts a line-trimmed fallback match for the given search content in the original content.
-// It returns the start and end indices of the match if found, or an error if not found.
+// It returns the start and end indices of the first match if found, or an error if not found.
 func LineTrimmedFallbackMatch(originalContent, searchContent string, startIndex int) (int, int, error) {
-	// Split both contents into lines
-	originalLines := strings.Split(originalContent, "\n")
-	searchLines := strings.Split(searchContent, "\n")
-
-	// Trim trailing empty line if exists (from the trailing \n in searchContent)
-	if len(searchLines) > 0 && searchLines[len(searchLines)-1] == "" {
-		searchLines = searchLines[:len(searchLines)-1]
-	}
-
-	// Find the line number where startIndex falls
-	startLineNum := 0
-	currentIndex := 0
-	for currentIndex < startIndex && startLineNum < len(originalLines) {
-		currentIndex += len(originalLines[startLineNum]) + 1 // +1 for \n
-		startLineNum++
-	}
-
-	// For each possible starting position in original content
-	for i := startLineNum; i <= len(originalLines)-len(searchLines); i++ {
-		matches := true
-
-		// Try to match all search lines from this position
-		for j := 0; j < len(searchLines); j++ {
-			originalTrimmed := strings.TrimSpace(originalLines[i+j])
-			searchTrimmed := strings.TrimSpace(searchLines[j])
-
-			if originalTrimmed != searchTrimmed {
-				matches = false
-				break
-			}
-		}
-
-		// If we found a match, calculate the exact character positions
-		if matches {
-			// Find start character index
-			matchStartIndex := 0
-			for k := 0; k < i; k++ {
-				matchStartIndex += len(originalLines[k]) + 1 // +1 for \n
-			}
-
-			// Find end character index
-			matchEndIndex := matchStartIndex
-			for k := 0; k < len(searchLines); k++ {
-				matchEndIndex += len(originalLines[i+k]) + 1 // +1 for \n
-			}
-
-			return matchStartIndex, matchEndIndex, nil
-		}
+	original := splitTextLines(originalContent)
+	search := searchLines(searchContent)
+	matches := lineTrimmedMatches(original, search, original.lineAt(startIndex))
+	if len(search) == 0 || len(matches) == 0 {
+		return 0, 0, errors.New("no line-trimmed match found")
 	}
-
-	return 0, 0, errors.New("no line-trimmed match found")
+	start, end := original.span(matches[0], len(search))
+	return start, end, nil
 }
 
 // BlockAnchorFallbackMatch attempts to match blocks of code by using the first and last lines as anchors.
-// It returns the start and end indices of the match if found, or an error if not found.
+// It returns the start and end indices of the first match if found, or an error if not found.
 func BlockAnchorFallbackMatch(originalContent, searchContent string, startIndex int) (int, int, error) {
-	originalLines := strings.Split(originalContent, "\n")
-	searchLines := strings.Split(searchContent, "\n")
-
-	// Only use this approach for blocks of 3+ lines
-	if len(searchLines) < 3 {
+	original := splitTextLines(originalContent)
+	search := searchLines(searchContent)
+	if len(search) < 3 {
 		return 0, 0, errors.New("search content too short for block anchor match")
 	}
-
-	// Trim trailing empty line if exists
-	if len(searchLines) > 0 && searchLines[len(searchLines)-1] == "" {
-		searchLines = searchLines[:len(searchLines)-1]
-	}
-
-	firstLineSearch := strings.TrimSpace(searchLines[0])
-	lastLineSearch := strings.TrimSpace(searchLines[len(searchLines)-1])
-	searchBlockSize := len(searchLines)
-
-	// Find the line number where startIndex falls
-	startLineNum := 0
-	currentIndex := 0
-	for currentIndex < startIndex && startLineNum < len(originalLines) {
-		currentIndex += len(originalLines[startLineNum]) + 1
-		startLineNum++
-	}
-
-	// Look for matching start and end anchors
-	for i := startLineNum; i <= len(originalLines)-searchBlockSize; i++ {
-		// Check if first line matches
-		if strings.TrimSpace(originalLines[i]) != firstLineSearch {
-			continue
-		}
-
-		// Check if last line matches at the expected position
-		if strings.TrimSpace(originalLines[i+searchBlockSize-1]) != lastLineSearch {
-			continue
-		}
-
-		// Calculate exact character positions
-		matchStartIndex := 0
-		for k := 0; k < i; k++ {
-			matchStartIndex += len(originalLines[k]) + 1
-		}
-
-		matchEndIndex := matchStartIndex
-		for k := 0; k < searchBlockSize; k++ {
-			matchEndIndex += len(originalLines[i+k]) + 1
-		}
-
-		return matchStartIndex, matchEndIndex, nil
+	matches := blockAnchorMatches(original, search, original.lineAt(startIndex))
+	if len(matches) == 0 {
+		return 0, 0, errors.New("no block anchor match found")
 	}
-
-	return 0, 0, errors.New("no block anchor match found")
+	start, end := original.span(matches[0], len(search))
+	return start, end, nil
 }
 
 // ConstructNewFileContent reconstructs the file content by applying a streamed diff to the original file content.
-func ConstructNewFileContent(diffContent, originalContent string, isFinal bool) (string, error) {
-	result := ""
+// A SEARCH block matching several places of the file is an AmbiguousMatchError, and one
+// matching nothing a NoMatchError.
+func ConstructNewFileContent(diffContent, originalContent string, isFinal bool) (result string, err error) {
+	_, span := tracing.Start(context.Background(), "parser.construct_new_file_content",
+		attribute.Int("goline.diff.length", len(diffContent)),
+		attribute.Bool("goline.diff.final", isFinal),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// Files with CRLF line breaks are edited with LF line breaks, like the SEARCH/REPLACE
+	// blocks are written, and get their CRLF line breaks back. Blocks written with CRLF line
+	// breaks, e.g. by models on Windows, are read with LF line breaks whatever the file uses.
+	diffContent = strings.ReplaceAll(diffContent, "\r\n", "\n")
+	crlf := usesCRLF(originalContent)
+	if crlf {
+		originalContent = strings.ReplaceAll(originalContent, "\r\n", "\n")
+		defer func() {
+			if err == nil {
+				result = strings.ReplaceAll(result, "\n", "\r\n")
+			}
+		}()
+	}
+
 	lastProcessedIndex := 0
 
 	currentSearchContent := ""
@@ -175,27 +116,10 @@ func ConstructNewFileContent(diffContent, originalContent string, isFinal bool)
 					searchEndIndex = len(originalContent)
 				}
 			} else {
-				// Exact search match scenario
-				exactIndex := strings.Index(originalContent[lastProcessedIndex:], currentSearchContent)
-				if exactIndex != -1 {
-					searchMatchIndex = lastProcessedIndex + exactIndex
-					searchEndIndex = searchMatchIndex + len(currentSearchContent)
-				} else {
-					// Attempt fallback line-trimmed matching
-					matchStart, matchEnd, err := LineTrimmedFallbackMatch(originalContent, currentSearchContent, lastProcessedIndex)
-					if err == nil {
-						searchMatchIndex = matchStart
-						searchEndIndex = matchEnd
-					} else {
-						// Try block anchor fallback for larger blocks
-						matchStart, matchEnd, err := BlockAnchorFallbackMatch(originalContent, currentSearchContent, lastProcessedIndex)
-						if err == nil {
-							searchMatchIndex = matchStart
-							searchEndIndex = matchEnd
-						} else {
-							return "", errors.New("the SEARCH block does not match anything in the file")
-						}
-					}
+				// Exact, whitespace-insensitive, anchored or fuzzy match
+				searchMatchIndex, searchEndIndex, err = findSearchMatch(originalContent, currentSearchContent, lastProcessedIndex)
+				if err != nil {
+					return "", err
 				}
 			}
 
@@ -240,6 +164,21 @@ func ConstructNewFileContent(diffContent, originalContent string, isFinal bool)
 	return result, nil
 }
 
+// usesCRLF reports whether all the line breaks of content are CRLF
+func usesCRLF(content string) bool {
+	crlf := strings.Count(content, "\r\n")
+	return crlf > 0 && crlf == strings.Count(content, "\n")
+}
+
+// MatchLineEndings returns the content written over a file with CRLF line breaks if all those
+// of the file are, as models write LF line breaks. Otherwise content is returned as is.
+func MatchLineEndings(original, content string) string {
+	if !usesCRLF(original) || strings.Contains(content, "\r\n") {
+		return content
+	}
+	return strings.ReplaceAll(content, "\n", "\r\n")
+}
+
 // ParseDiff parses a diff string into search and replace blocks
 func ParseDiff(diffContent string) ([]map[string]string, error) {
 	var blocks []map[string]string
@@ -0,0 +1,224 @@
+package assistantmessage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// block formats a SEARCH/REPLACE block
+func block(search, replace string) string {
+	return SearchMarker + "\n" + search + DividerMarker + "\n" + replace + ReplaceMarker + "\n"
+}
+
+func TestConstructNewFileContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		diff     string
+		want     string
+	}{
+		{
+			name:     "exact",
+			original: "a\nb\nc\n",
+			diff:     block("b\n", "B\n"),
+			want:     "a\nB\nc\n",
+		},
+		{
+			name:     "indentation",
+			original: "func f() {\n\treturn 1\n}\n",
+			diff:     block("    return 1\n", "\treturn 2\n"),
+			want:     "func f() {\n\treturn 2\n}\n",
+		},
+		{
+			name:     "last line without line break",
+			original: "a\nb",
+			diff:     block("  b\n", "B\n"),
+			want:     "a\nB\n",
+		},
+		{
+			name:     "several blocks in order",
+			original: "x := 1\ny := 2\nx := 1\n",
+			diff:     block("x := 1\ny := 2\n", "x := 3\ny := 2\n") + block("x := 1\n", "x := 4\n"),
+			want:     "x := 3\ny := 2\nx := 4\n",
+		},
+		{
+			name:     "fuzzy",
+			original: "func Sum(a, b int) int {\n\ttotal := a + b\n\tlog.Printf(\"sum of %d and %d is %d\", a, b, total)\n\treturn total\n}\n",
+			diff:     block("func Sum(a int, b int) int {\n\ttotal := a + b\n\tlog.Printf(\"sum of %d and %d is %d\", a, b, total)\n\treturn total\n", "func Sum(a, b int) int {\n\treturn a + b\n"),
+			want:     "func Sum(a, b int) int {\n\treturn a + b\n}\n",
+		},
+		{
+			name:     "CRLF",
+			original: "a\r\nb\r\nc\r\n",
+			diff:     block("b\n", "B\nB2\n"),
+			want:     "a\r\nB\r\nB2\r\nc\r\n",
+		},
+		{
+			name:     "CRLF diff",
+			original: "a\r\nb\r\nc\r\n",
+			diff:     strings.ReplaceAll(block("a\nb\n", "A\n"), "\n", "\r\n"),
+			want:     "A\r\nc\r\n",
+		},
+		{
+			name:     "CRLF diff of a LF file",
+			original: "a\nb\nc\n",
+			diff:     strings.ReplaceAll(block("b\n", "B\n"), "\n", "\r\n"),
+			want:     "a\nB\nc\n",
+		},
+		{
+			name:     "mixed line breaks are kept",
+			original: "a\r\nb\nc\n",
+			diff:     block("b\n", "B\n"),
+			want:     "a\r\nB\nc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConstructNewFileContent(tt.diff, tt.original, true)
+			if err != nil || got != tt.want {
+				t.Errorf("ConstructNewFileContent() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLineEndings(t *testing.T) {
+	tests := []struct {
+		name, original, content, want string
+	}{
+		{"LF file", "a\nb\n", "c\nd\n", "c\nd\n"},
+		{"CRLF file", "a\r\nb\r\n", "c\nd\n", "c\r\nd\r\n"},
+		{"CRLF content", "a\r\nb\r\n", "c\r\nd\r\n", "c\r\nd\r\n"},
+		{"mixed file", "a\r\nb\n", "c\nd\n", "c\nd\n"},
+		{"new file", "", "c\n", "c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchLineEndings(tt.original, tt.content); got != tt.want {
+				t.Errorf("MatchLineEndings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstructNewFileContentAmbiguous(t *testing.T) {
+	original := "if err != nil {\n\treturn err\n}\nx()\nif err != nil {\n\treturn err\n}\n"
+
+	_, err := ConstructNewFileContent(block("if err != nil {\n\treturn err\n}\n", "if err != nil {\n\treturn nil\n}\n"), original, true)
+	var ambiguous *AmbiguousMatchError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Lines) != 2 || ambiguous.Lines[0] != 1 || ambiguous.Lines[1] != 5 {
+		t.Fatalf("error = %v, want an ambiguous match at lines 1 and 5", err)
+	}
+	if !strings.Contains(err.Error(), "at lines 1, 5") || !strings.Contains(err.Error(), "Include more of the surrounding lines") {
+		t.Errorf("error message = %q", err)
+	}
+
+	// Surrounding lines disambiguate the match
+	got, err := ConstructNewFileContent(block("x()\nif err != nil {\n\treturn err\n", "x()\nif err != nil {\n\treturn nil\n"), original, true)
+	if err != nil || got != "if err != nil {\n\treturn err\n}\nx()\nif err != nil {\n\treturn nil\n}\n" {
+		t.Errorf("ConstructNewFileContent() = %q, %v", got, err)
+	}
+}
+
+func TestConstructNewFileContentNoMatch(t *testing.T) {
+	original := "func a() {\n\tfmt.Println(\"hello\")\n}\n"
+
+	_, err := ConstructNewFileContent(block("func a() {\n\tfmt.Println(\"bye\")\n", "x\n"), original, true)
+	var noMatch *NoMatchError
+	if !errors.As(err, &noMatch) {
+		t.Fatalf("error = %v, want no match", err)
+	}
+	if noMatch.Line != 1 || noMatch.Similarity != 0.75 || !strings.Contains(err.Error(), "fmt.Println(\"hello\")") {
+		t.Errorf("error = %v, want the closest lines", err)
+	}
+
+	_, err = ConstructNewFileContent(block("something else entirely\n", "x\n"), original, true)
+	if !errors.As(err, &noMatch) || noMatch.Closest != "" {
+		t.Errorf("error = %v, want no closest lines", err)
+	}
+}
+
+func TestFuzzyMatchEqualWindows(t *testing.T) {
+	// Windows scored in the order of their bounds are still reported in the order of the file
+	original := splitTextLines("x := compute(a, b, c, d, e, f, g, h, i)\nother\nx := compute(a, b, c, d, e, f, g, h, i)\n")
+	_, _, err := fuzzyMatch(original, []string{"x := compute(a, b, c, d, e, f, g, h, j)"}, 0)
+	var ambiguous *AmbiguousMatchError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Lines) != 2 || ambiguous.Lines[0] != 1 || ambiguous.Lines[1] != 3 {
+		t.Errorf("error = %v, want an ambiguous match at lines 1 and 3", err)
+	}
+
+	_, _, err = fuzzyMatch(original, []string{"x := compute(a, b, c, d, e, z, y, w)"}, 0)
+	var noMatch *NoMatchError
+	if !errors.As(err, &noMatch) || noMatch.Line != 1 {
+		t.Errorf("error = %v, want the closest lines at line 1", err)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := strings.Fields("return a + b")
+	if got := similarity(a, a, 0); got != 1 {
+		t.Errorf("similarity of equal words = %v", got)
+	}
+	if got := similarity(a, strings.Fields("return a - b"), 0); got != 0.75 {
+		t.Errorf("similarity with one word replaced = %v", got)
+	}
+	if got := similarity(a, strings.Fields("return a - b"), 0.75); got != 0.75 {
+		t.Errorf("similarity of exactly the minimum = %v", got)
+	}
+	if got := similarity(a, strings.Fields("return b - a"), 0.75); got != 0 {
+		t.Errorf("similarity below the minimum = %v", got)
+	}
+	if got := similarity(a, strings.Fields("x"), minReportedSimilarity); got != 0 {
+		t.Errorf("similarity of very different lengths = %v", got)
+	}
+}
+
+func TestLevenshteinLimit(t *testing.T) {
+	words := strings.Fields
+	for _, tt := range []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"a b c d", "a b c d", 0, 0},
+		{"a b c d", "a x c d", 4, 1},
+		{"a b c d", "b c d e", 4, 2},
+		{"a b c d", "b c d e", 1, 2},
+		{"a b c d", "w x y z", 2, 3},
+		{"a b c d", "a b", 1, 2},
+		{"", "a b", 2, 2},
+	} {
+		if got := levenshtein(words(tt.a), words(tt.b), tt.limit); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// benchmarkLines returns n lines of code, from the line first, each of them with its own names
+func benchmarkLines(first, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		line := first + i
+		lines[i] = fmt.Sprintf("\tif err := step%d(ctx, opts.Value%d); err != nil {\n\t\treturn fmt.Errorf(\"failed to run step %d: %%w\", err)\n\t}", line, line%7, line)
+	}
+	return lines
+}
+
+func BenchmarkFuzzyMatch(b *testing.B) {
+	// A large file, and a long SEARCH block with a few words changed from its lines
+	original := splitTextLines(strings.Join(benchmarkLines(0, 5000), "\n") + "\n")
+	search := searchLines(strings.Join(benchmarkLines(4000, 50), "\n") + "\n")
+	for i := range search {
+		if i%10 == 0 {
+			search[i] = strings.Replace(search[i], "err", "e", 1)
+		}
+	}
+	b.SetBytes(int64(len(original.text)))
+	for b.Loop() {
+		if _, _, err := fuzzyMatch(original, search, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package assistantmessage
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// FuzzyMatchThreshold is the minimum similarity, between 0 and 1, of the lines of the file
+	// matched by a SEARCH block that no exact or whitespace-insensitive match was found for
+	FuzzyMatchThreshold = 0.9
+	// maxFuzzyCandidates limits the number of windows of the file scored by the fuzzy matcher
+	maxFuzzyCandidates = 20000
+	// minReportedSimilarity is the minimum similarity of the lines shown as the closest to a SEARCH block matching nothing
+	minReportedSimilarity = 0.5
+	// maxReportedLines limits the number of match locations named in an ambiguity error
+	maxReportedLines = 5
+)
+
+// AmbiguousMatchError is returned when a SEARCH block or a unified diff hunk matches several places of the file
+type AmbiguousMatchError struct {
+	// Lines are the first lines of the matches, starting at 1
+	Lines []int
+	// Hunk reports whether the ambiguous match is that of a unified diff hunk
+	Hunk bool
+}
+
+func (e *AmbiguousMatchError) Error() string {
+	lines := make([]string, 0, maxReportedLines)
+	for _, line := range e.Lines[:min(len(e.Lines), maxReportedLines)] {
+		lines = append(lines, fmt.Sprint(line))
+	}
+	if len(e.Lines) > maxReportedLines {
+		lines = append(lines, "...")
+	}
+	if e.Hunk {
+		return fmt.Sprintf("the hunk matches %d places in the file, at lines %s. Give the line number of the change in the @@ header, or include more context lines so that it matches only one of them",
+			len(e.Lines), strings.Join(lines, ", "))
+	}
+	return fmt.Sprintf("the SEARCH block matches %d places in the file, at lines %s. Include more of the surrounding lines in the SEARCH block so that it matches only one of them, or use one SEARCH/REPLACE block per place in the order they appear in the file",
+		len(e.Lines), strings.Join(lines, ", "))
+}
+
+// NoMatchError is returned when a SEARCH block matches nothing in the file.
+// It describes the closest lines of the file, if any are similar enough to be worth showing.
+type NoMatchError struct {
+	// Closest are the lines of the file most similar to the SEARCH block, empty if none are similar
+	Closest string
+	// Line is the first line of Closest, starting at 1
+	Line int
+	// Similarity is the similarity of Closest to the SEARCH block, between 0 and 1
+	Similarity float64
+}
+
+func (e *NoMatchError) Error() string {
+	message := "the SEARCH block does not match anything in the file"
+	if e.Closest == "" {
+		return message
+	}
+	return fmt.Sprintf("%s. The most similar lines, at line %d with %.0f%% similarity, are:\n%s\nThe SEARCH block must match the lines of the file exactly, read the file again if it changed",
+		message, e.Line, e.Similarity*100, e.Closest)
+}
+
+// textLines holds the lines of a text with the offset each of them starts at
+type textLines struct {
+	text    string
+	lines   []string
+	offsets []int
+}
+
+func splitTextLines(text string) textLines {
+	t := textLines{text: text, lines: strings.Split(text, "\n")}
+	offset := 0
+	for _, line := range t.lines {
+		t.offsets = append(t.offsets, offset)
+		offset += len(line) + 1
+	}
+	return t
+}
+
+// lineAt returns the index of the first line starting at or after offset
+func (t textLines) lineAt(offset int) int {
+	for i, start := range t.offsets {
+		if start >= offset {
+			return i
+		}
+	}
+	return len(t.lines)
+}
+
+// lineOf returns the number, starting at 1, of the line containing offset
+func (t textLines) lineOf(offset int) int {
+	return strings.Count(t.text[:offset], "\n") + 1
+}
+
+// span returns the offsets of n lines starting at line i, including the line break of the last one
+func (t textLines) span(i, n int) (int, int) {
+	end := len(t.text)
+	if i+n < len(t.offsets) {
+		end = t.offsets[i+n]
+	}
+	return t.offsets[i], end
+}
+
+// searchLines splits the content of a SEARCH block into lines, without the empty line after its last line break
+func searchLines(searchContent string) []string {
+	lines := strings.Split(searchContent, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// findSearchMatch finds the part of the original content matched by a SEARCH block, at or
+// after startIndex. It tries in order an exact match, a match of the lines ignoring their
+// leading and trailing whitespace, a match anchored on the first and last lines of blocks of
+// three lines or more, and a fuzzy match of lines at least FuzzyMatchThreshold similar. The
+// first strategy finding matches decides: several matches are an AmbiguousMatchError.
+func findSearchMatch(originalContent, searchContent string, startIndex int) (int, int, error) {
+	original := splitTextLines(originalContent)
+
+	var starts []int
+	for pos := startIndex; pos <= len(originalContent); {
+		i := strings.Index(originalContent[pos:], searchContent)
+		if i < 0 {
+			break
+		}
+		starts = append(starts, pos+i)
+		pos += i + 1
+	}
+	if len(starts) == 1 {
+		return starts[0], starts[0] + len(searchContent), nil
+	}
+	if len(starts) > 1 {
+		return 0, 0, ambiguous(original, starts)
+	}
+
+	search := searchLines(searchContent)
+	if len(search) == 0 {
+		return 0, 0, &NoMatchError{}
+	}
+	for _, strategy := range []func(textLines, []string, int) []int{lineTrimmedMatches, blockAnchorMatches} {
+		matches := strategy(original, search, original.lineAt(startIndex))
+		if len(matches) == 1 {
+			start, end := original.span(matches[0], len(search))
+			return start, end, nil
+		}
+		if len(matches) > 1 {
+			starts := make([]int, len(matches))
+			for i, line := range matches {
+				starts[i] = original.offsets[line]
+			}
+			return 0, 0, ambiguous(original, starts)
+		}
+	}
+	return fuzzyMatch(original, search, original.lineAt(startIndex))
+}
+
+// ambiguous returns the error of a SEARCH block matching at several offsets
+func ambiguous(original textLines, starts []int) error {
+	lines := make([]int, len(starts))
+	for i, start := range starts {
+		lines[i] = original.lineOf(start)
+	}
+	return &AmbiguousMatchError{Lines: lines}
+}
+
+// lineTrimmedMatches returns the lines, from startLine, starting the matches of the search
+// lines ignoring their leading and trailing whitespace
+func lineTrimmedMatches(original textLines, search []string, startLine int) []int {
+	var matches []int
+	for i := startLine; i <= len(original.lines)-len(search); i++ {
+		matched := true
+		for j, line := range search {
+			if strings.TrimSpace(original.lines[i+j]) != strings.TrimSpace(line) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// blockAnchorMatches returns the lines, from startLine, starting the blocks whose first and
+// last lines match those of search lines of three lines or more
+func blockAnchorMatches(original textLines, search []string, startLine int) []int {
+	if len(search) < 3 {
+		return nil
+	}
+	first, last := strings.TrimSpace(search[0]), strings.TrimSpace(search[len(search)-1])
+	var matches []int
+	for i := startLine; i <= len(original.lines)-len(search); i++ {
+		if strings.TrimSpace(original.lines[i]) == first && strings.TrimSpace(original.lines[i+len(search)-1]) == last {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// fuzzyMatch finds the lines, from startLine, most similar to the search lines, comparing the
+// words of the lines with the Levenshtein distance. The match must be at least
+// FuzzyMatchThreshold similar and more similar than any other block of lines.
+func fuzzyMatch(original textLines, search []string, startLine int) (int, int, error) {
+	// The words are compared as numbers, and those of each line split once
+	words := make(map[string]int)
+	wordsOf := func(text string) []int {
+		var ids []int
+		for _, field := range strings.Fields(text) {
+			id, ok := words[field]
+			if !ok {
+				id = len(words)
+				words[field] = id
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	searchWords := wordsOf(strings.Join(search, "\n"))
+	end := min(len(original.lines)-len(search), startLine+maxFuzzyCandidates-1)
+	if end < startLine {
+		return 0, 0, &NoMatchError{}
+	}
+	lineWords := make([][]int, end+len(search)-startLine)
+	for i := range lineWords {
+		lineWords[i] = wordsOf(original.lines[startLine+i])
+	}
+
+	// The words each window does not share with the search lines bound its distance to them,
+	// the windows are scored from the lowest bound, so that the windows less similar than the
+	// best one so far, or than what is worth reporting, can be skipped or not scored exactly
+	bag := newWordBag(searchWords, len(words))
+	for _, line := range lineWords[:len(search)] {
+		bag.add(line, 1)
+	}
+	windows := make([]fuzzyWindow, 0, end-startLine+1)
+	for i := startLine; i <= end; i++ {
+		if i > startLine {
+			bag.add(lineWords[i-1-startLine], -1)
+			bag.add(lineWords[i-1-startLine+len(search)], 1)
+		}
+		windows = append(windows, fuzzyWindow{line: i, bound: float64(bag.distance()) / float64(max(bag.size, len(searchWords), 1))})
+	}
+	slices.SortStableFunc(windows, func(a, b fuzzyWindow) int { return cmp.Compare(a.bound, b.bound) })
+
+	best, bestScore := -1, 0.0
+	var tied []int
+	var window []int
+	for _, w := range windows {
+		atLeast := max(bestScore, minReportedSimilarity)
+		if w.bound > 1-atLeast+1e-9 {
+			break
+		}
+		window = window[:0]
+		for _, line := range lineWords[w.line-startLine : w.line-startLine+len(search)] {
+			window = append(window, line...)
+		}
+		score := similarity(window, searchWords, atLeast)
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = w.line, score, []int{w.line}
+		case score == bestScore && best >= 0:
+			tied = append(tied, w.line)
+		}
+	}
+	// Of equally similar windows, the first in the file is the closest
+	slices.Sort(tied)
+	if len(tied) > 0 {
+		best = tied[0]
+	}
+	if best < 0 || bestScore == 0 {
+		return 0, 0, &NoMatchError{}
+	}
+	if bestScore < minReportedSimilarity {
+		return 0, 0, &NoMatchError{}
+	}
+	if bestScore < FuzzyMatchThreshold {
+		start, end := original.span(best, len(search))
+		return 0, 0, &NoMatchError{
+			Closest:    strings.TrimSuffix(original.text[start:end], "\n"),
+			Line:       best + 1,
+			Similarity: bestScore,
+		}
+	}
+	if len(tied) > 1 {
+		starts := make([]int, len(tied))
+		for i, line := range tied {
+			starts[i] = original.offsets[line]
+		}
+		return 0, 0, ambiguous(original, starts)
+	}
+	start, end := original.span(best, len(search))
+	return start, end, nil
+}
+
+// fuzzyWindow is a window of lines of the file starting at line, whose words differ from
+// those of the search lines by at least bound, from 0 to 1
+type fuzzyWindow struct {
+	line  int
+	bound float64
+}
+
+// wordBag counts the words of a window of lines missing from the search lines and the words
+// of the search lines missing from the window, as the window slides over the file
+type wordBag struct {
+	// counts are the occurrences of each word in the window less those in the search lines
+	counts []int
+	// extra and missing are the sums of the positive and negative counts
+	extra, missing int
+	// size is the number of words of the window
+	size int
+}
+
+func newWordBag(search []int, words int) *wordBag {
+	b := &wordBag{counts: make([]int, words)}
+	for _, word := range search {
+		b.counts[word]--
+		b.missing++
+	}
+	return b
+}
+
+// add adds the words of a line to the window, or removes them if delta is -1
+func (b *wordBag) add(line []int, delta int) {
+	for _, word := range line {
+		before := b.counts[word]
+		b.counts[word] += delta
+		b.extra += max(b.counts[word], 0) - max(before, 0)
+		b.missing += max(-b.counts[word], 0) - max(-before, 0)
+	}
+	b.size += delta * len(line)
+}
+
+// distance returns a lower bound of the Levenshtein distance of the window to the search lines:
+// each word of one missing from the other is inserted, deleted or replaced
+func (b *wordBag) distance() int {
+	return max(b.extra, b.missing)
+}
+
+// similarity returns how similar two lists of words are, from 0 for nothing in common to 1
+// for equal lists, from their Levenshtein distance. Lists less similar than atLeast score 0,
+// their distance is only computed up to the largest one scoring atLeast.
+func similarity[T comparable](a, b []T, atLeast float64) float64 {
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+	// The tolerance keeps the lists scoring exactly atLeast despite the rounding
+	limit := int((1-atLeast)*float64(longest) + 1e-9)
+	distance := levenshtein(a, b, limit)
+	if distance > limit {
+		return 0
+	}
+	return 1 - float64(distance)/float64(longest)
+}
+
+// levenshtein returns the number of words inserted, deleted or replaced to turn a into b, or
+// limit+1 if more than limit are. Only the cells of the distance matrix at most limit away
+// from its diagonal are computed, and the computation stops at the first row whose cells all
+// exceed limit.
+func levenshtein[T comparable](a, b []T, limit int) int {
+	exceeded := limit + 1
+	// The distance is at least the difference of the lengths
+	if diff := len(a) - len(b); max(diff, -diff) > limit {
+		return exceeded
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = min(j, exceeded)
+	}
+	for i := 1; i <= len(a); i++ {
+		lo, hi := max(1, i-limit), min(len(b), i+limit)
+		curr[0] = min(i, exceeded)
+		rowMin := exceeded
+		if lo == 1 {
+			rowMin = curr[0]
+		} else {
+			curr[lo-1] = exceeded
+		}
+		for j := lo; j <= hi; j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost, exceeded)
+			rowMin = min(rowMin, curr[j])
+		}
+		if hi < len(b) {
+			curr[hi+1] = exceeded
+		}
+		if rowMin > limit {
+			return exceeded
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
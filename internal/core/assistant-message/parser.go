@@ -1,135 +1,258 @@
 package assistantmessage
 
 import (
-	"fmt"
+	"context"
+	"maps"
 	"strings"
+
+	"github.com/kazz187/goline/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ParseAssistantMessage parses an assistant message into content blocks
 func ParseAssistantMessage(assistantMessage string) []interface{} {
-	var contentBlocks []interface{}
-	var currentTextContent *TextContent
-	var currentTextContentStartIndex int
-	var currentToolUse *ToolUse
-	var currentToolUseStartIndex int
-	var currentParamName ToolParamName
-	var currentParamValueStartIndex int
-	var accumulator string
-
-	for i, char := range assistantMessage {
-		accumulator += string(char)
-
-		// There should not be a param without a tool use
-		if currentToolUse != nil && currentParamName != "" {
-			currentParamValue := accumulator[currentParamValueStartIndex:]
-			paramClosingTag := fmt.Sprintf("</%s>", currentParamName)
-			if strings.HasSuffix(currentParamValue, paramClosingTag) {
-				// End of param value
-				paramValue := currentParamValue[:len(currentParamValue)-len(paramClosingTag)]
-				currentToolUse.Params[currentParamName] = strings.TrimSpace(paramValue)
-				currentParamName = ""
-				continue
-			} else {
-				// Partial param value is accumulating
-				continue
+	_, span := tracing.Start(context.Background(), "parser.parse_assistant_message", attribute.Int("goline.message.length", len(assistantMessage)))
+	defer span.End()
+
+	p := NewParser()
+	p.Append(assistantMessage)
+	contentBlocks := p.Blocks()
+
+	span.SetAttributes(attribute.Int("goline.parser.blocks", len(contentBlocks)))
+	return contentBlocks
+}
+
+// BlockDelta is a change of the content blocks of a streamed assistant message
+type BlockDelta struct {
+	// Index is the index of the block in the message
+	Index int
+	// Block is the whole block as of the change, a TextContent or a ToolUse. It replaces the
+	// block reported before at the same index: a partial text block ending with the start of
+	// a tool use tag becomes the tool use once the tag is complete.
+	Block interface{}
+}
+
+// CDATA sections let a parameter value contain anything, including the closing tag of the
+// parameter: the text between cdataStart and cdataEnd is the value, as is
+const (
+	cdataStart = "<![CDATA["
+	cdataEnd   = "]]>"
+)
+
+// Parser parses an assistant message incrementally as it is streamed. Each chunk is parsed
+// once: tags are only looked for where a '>' closes them, so parsing a message takes a time
+// linear in its length however it is split into chunks.
+//
+// Parameter values often contain code with tags of their own, so inside a tool use:
+//   - only the parameters of the tool open a parameter, and only once each,
+//   - the value of a parameter goes up to the last of its closing tags before the next
+//     parameter or the end of the tool use,
+//   - a value wrapped in a CDATA section is taken as is.
+type Parser struct {
+	// message is the message received so far, parsed up to pos
+	message strings.Builder
+	pos     int
+	// blocks are the completed blocks
+	blocks []interface{}
+
+	// toolNames are the tags recognized as tool uses, and toolParams those recognized as the
+	// parameters of each tool
+	toolNames  map[string]ToolUseName
+	toolParams map[ToolUseName]map[string]ToolParamName
+	// maxTagLength is the length of the longest tag name
+	maxTagLength int
+
+	// textStart is the start of the current text block, -1 out of text
+	textStart int
+	// toolUse is the current tool use, nil out of tool uses, and toolStart where its content starts
+	toolUse   *ToolUse
+	toolStart int
+	// param is the parameter of the current tool use being read, and paramStart where its value starts
+	param      ToolParamName
+	paramStart int
+	// lastParam is the last parameter read, whose value a later closing tag extends, and
+	// lastParamStart where its value starts
+	lastParam      ToolParamName
+	lastParamStart int
+}
+
+// NewParser creates a parser of an assistant message, recognizing the tools known when it is created
+func NewParser() *Parser {
+	p := &Parser{
+		toolNames:  make(map[string]ToolUseName),
+		toolParams: make(map[ToolUseName]map[string]ToolParamName),
+		textStart:  -1,
+	}
+	allParams := AllToolParamNames()
+	for _, name := range AllToolUseNames() {
+		p.toolNames[string(name)] = name
+		p.maxTagLength = max(p.maxTagLength, len(name))
+
+		params := allParams
+		if schema, ok := LookupToolSchema(name); ok {
+			params = params[:0:0]
+			for _, param := range schema.Parameters {
+				params = append(params, param.Name)
 			}
 		}
+		p.toolParams[name] = make(map[string]ToolParamName, len(params))
+		for _, param := range params {
+			p.toolParams[name][string(param)] = param
+			p.maxTagLength = max(p.maxTagLength, len(param))
+		}
+	}
+	return p
+}
 
-		// No currentParamName
-
-		if currentToolUse != nil {
-			currentToolValue := accumulator[currentToolUseStartIndex:]
-			toolUseClosingTag := fmt.Sprintf("</%s>", currentToolUse.Name)
-			if strings.HasSuffix(currentToolValue, toolUseClosingTag) {
-				// End of a tool use
-				currentToolUse.Content.Partial = false
-				contentBlocks = append(contentBlocks, *currentToolUse)
-				currentToolUse = nil
-				continue
-			} else {
-				// Check for parameter opening tags
-				for _, paramName := range AllToolParamNames() {
-					paramOpeningTag := fmt.Sprintf("<%s>", paramName)
-					if strings.HasSuffix(accumulator, paramOpeningTag) {
-						// Start of a new parameter
-						currentParamName = paramName
-						currentParamValueStartIndex = len(accumulator)
-						break
-					}
-				}
-
-				// Special case for write_to_file where file contents could contain the closing tag
-				if currentToolUse.Name == WriteToFileToolName && strings.HasSuffix(accumulator, fmt.Sprintf("</%s>", ContentParam)) {
-					toolContent := accumulator[currentToolUseStartIndex:]
-					contentStartTag := fmt.Sprintf("<%s>", ContentParam)
-					contentEndTag := fmt.Sprintf("</%s>", ContentParam)
-					contentStartIndex := strings.Index(toolContent, contentStartTag) + len(contentStartTag)
-					contentEndIndex := strings.LastIndex(toolContent, contentEndTag)
-					if contentStartIndex != -1 && contentEndIndex != -1 && contentEndIndex > contentStartIndex {
-						currentToolUse.Params[ContentParam] = strings.TrimSpace(toolContent[contentStartIndex:contentEndIndex])
-					}
-				}
-
-				// Partial tool value is accumulating
-				continue
-			}
+// Append parses the next chunk of the message and returns the blocks it changed: those it
+// completed and the partial block the message ends with.
+func (p *Parser) Append(chunk string) []BlockDelta {
+	if chunk == "" {
+		return nil
+	}
+	p.message.WriteString(chunk)
+	message := p.message.String()
+
+	completed := len(p.blocks)
+	for ; p.pos < len(message); p.pos++ {
+		if p.toolUse == nil && p.textStart < 0 {
+			// Text starts at the beginning of the message and after each tool use
+			p.textStart = p.pos
+		}
+		if message[p.pos] == '>' {
+			p.closeTag(message, p.pos+1)
 		}
+	}
 
-		// No currentToolUse
-
-		didStartToolUse := false
-		for _, toolName := range AllToolUseNames() {
-			toolUseOpeningTag := fmt.Sprintf("<%s>", toolName)
-			if strings.HasSuffix(accumulator, toolUseOpeningTag) {
-				// Start of a new tool use
-				newToolUse := NewToolUse(toolName, true)
-				currentToolUse = &newToolUse
-				currentToolUseStartIndex = len(accumulator)
-
-				// This also indicates the end of the current text content
-				if currentTextContent != nil {
-					currentTextContent.Content.Partial = false
-					// Remove the partially accumulated tool use tag from the end of text
-					content := currentTextContent.Content.Content
-					tagStart := len(content) - len(toolUseOpeningTag) + 1
-					if tagStart > 0 {
-						currentTextContent.Content.Content = strings.TrimSpace(content[:tagStart])
-					}
-					contentBlocks = append(contentBlocks, *currentTextContent)
-					currentTextContent = nil
-				}
-
-				didStartToolUse = true
-				break
-			}
+	var deltas []BlockDelta
+	for i := completed; i < len(p.blocks); i++ {
+		deltas = append(deltas, BlockDelta{Index: i, Block: p.blocks[i]})
+	}
+	if partial := p.partialBlock(); partial != nil {
+		deltas = append(deltas, BlockDelta{Index: len(p.blocks), Block: partial})
+	}
+	return deltas
+}
+
+// Blocks returns the blocks of the message received so far. The last block is partial if the
+// message stops in the middle of it.
+func (p *Parser) Blocks() []interface{} {
+	blocks := append([]interface{}(nil), p.blocks...)
+	if partial := p.partialBlock(); partial != nil {
+		blocks = append(blocks, partial)
+	}
+	return blocks
+}
+
+// closeTag handles the tag, if any, that message[:end] ends with
+func (p *Parser) closeTag(message string, end int) {
+	switch {
+	case p.param != "":
+		closingTag := "</" + string(p.param) + ">"
+		if end-p.paramStart < len(closingTag) || !strings.HasSuffix(message[:end], closingTag) {
+			return
+		}
+		raw := message[p.paramStart : end-len(closingTag)]
+		cdata := isCDATA(raw)
+		if cdata && !strings.HasSuffix(strings.TrimSpace(raw), cdataEnd) {
+			// The closing tag is inside the CDATA section
+			return
 		}
+		p.toolUse.Params[p.param] = paramValue(raw)
+		p.lastParam, p.lastParamStart = "", 0
+		if !cdata {
+			p.lastParam, p.lastParamStart = p.param, p.paramStart
+		}
+		p.param = ""
 
-		if !didStartToolUse {
-			// No tool use, so it must be text either at the beginning or between tools
-			if currentTextContent == nil {
-				currentTextContentStartIndex = i
-				newTextContent := NewTextContent(accumulator[currentTextContentStartIndex:], true)
-				currentTextContent = &newTextContent
-			} else {
-				currentTextContent.Content.Content = strings.TrimSpace(accumulator[currentTextContentStartIndex:])
+	case p.toolUse != nil:
+		if end-p.toolStart >= len(p.toolUse.Name)+3 && strings.HasSuffix(message[:end], "</"+string(p.toolUse.Name)+">") {
+			p.toolUse.Partial = false
+			p.blocks = append(p.blocks, *p.toolUse)
+			p.toolUse = nil
+			p.lastParam = ""
+			return
+		}
+		if name, ok := p.tagName(message, end); ok {
+			param, ok := p.toolParams[p.toolUse.Name][name]
+			// A parameter given already is part of the value of the previous parameter
+			if _, given := p.toolUse.Params[param]; ok && !given {
+				p.param = param
+				p.paramStart = end
+				p.lastParam = ""
+				return
 			}
 		}
-	}
+		// The value of the last parameter goes up to its last closing tag
+		if p.lastParam != "" && strings.HasSuffix(message[:end], "</"+string(p.lastParam)+">") {
+			p.toolUse.Params[p.lastParam] = paramValue(message[p.lastParamStart : end-len(p.lastParam)-3])
+		}
 
-	if currentToolUse != nil {
-		// Stream did not complete tool call, add it as partial
-		if currentParamName != "" {
-			// Tool call has a parameter that was not completed
-			currentToolUse.Params[currentParamName] = strings.TrimSpace(accumulator[currentParamValueStartIndex:])
+	default:
+		name, ok := p.tagName(message, end)
+		if !ok {
+			return
+		}
+		toolName, ok := p.toolNames[name]
+		if !ok {
+			return
+		}
+		// The tag ends the current text, which is dropped if there is nothing else in it
+		if text := strings.TrimSpace(message[p.textStart : end-len(name)-2]); text != "" {
+			p.blocks = append(p.blocks, NewTextContent(text, false))
 		}
-		contentBlocks = append(contentBlocks, *currentToolUse)
+		p.textStart = -1
+		toolUse := NewToolUse(toolName, true)
+		p.toolUse = &toolUse
+		p.toolStart = end
 	}
+}
 
-	// Note: it doesn't matter if check for currentToolUse or currentTextContent, only one of them will be defined since only one can be partial at a time
-	if currentTextContent != nil {
-		// Stream did not complete text content, add it as partial
-		contentBlocks = append(contentBlocks, *currentTextContent)
+// tagName returns the name of the opening tag message[:end] ends with
+func (p *Parser) tagName(message string, end int) (string, bool) {
+	start := strings.LastIndexByte(message[max(0, end-p.maxTagLength-2):end], '<')
+	if start < 0 {
+		return "", false
+	}
+	name := message[max(0, end-p.maxTagLength-2)+start+1 : end-1]
+	if name == "" || name[0] == '/' {
+		return "", false
 	}
+	return name, true
+}
 
-	return contentBlocks
+// partialBlock returns the block the message received so far stops in, nil if it stops
+// between blocks
+func (p *Parser) partialBlock() interface{} {
+	message := p.message.String()
+	if p.toolUse != nil {
+		toolUse := *p.toolUse
+		toolUse.Params = maps.Clone(p.toolUse.Params)
+		if p.param != "" {
+			// The value of the parameter is not complete yet
+			toolUse.Params[p.param] = paramValue(message[p.paramStart:])
+		}
+		return toolUse
+	}
+	if p.textStart >= 0 {
+		if text := strings.TrimSpace(message[p.textStart:]); text != "" {
+			return NewTextContent(text, true)
+		}
+	}
+	return nil
+}
+
+// isCDATA reports whether the raw value of a parameter is a CDATA section
+func isCDATA(raw string) bool {
+	return strings.HasPrefix(strings.TrimSpace(raw), cdataStart)
+}
+
+// paramValue returns the value of a parameter from its raw text: the content of its CDATA
+// section as is, or the text without its leading and trailing whitespace
+func paramValue(raw string) string {
+	value := strings.TrimSpace(raw)
+	if !strings.HasPrefix(value, cdataStart) {
+		return value
+	}
+	return strings.TrimSuffix(value[len(cdataStart):], cdataEnd)
 }
@@ -0,0 +1,236 @@
+package assistantmessage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// toolUse creates a tool use block
+func toolUse(name ToolUseName, partial bool, params map[ToolParamName]string) ToolUse {
+	t := NewToolUse(name, partial)
+	for k, v := range params {
+		t.Params[k] = v
+	}
+	return t
+}
+
+func TestParseAssistantMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []interface{}
+	}{
+		{
+			name:    "text only",
+			message: "  Hello, world.\n",
+			want:    []interface{}{NewTextContent("Hello, world.", true)},
+		},
+		{
+			name:    "text and tool use",
+			message: "Reading the file.\n<read_file>\n<path>main.go</path>\n</read_file>",
+			want: []interface{}{
+				NewTextContent("Reading the file.", false),
+				toolUse(ReadFileToolName, false, map[ToolParamName]string{PathParam: "main.go"}),
+			},
+		},
+		{
+			name:    "tool uses separated by whitespace",
+			message: "<read_file><path>a</path></read_file>\n\n<read_file><path>b</path></read_file>\n",
+			want: []interface{}{
+				toolUse(ReadFileToolName, false, map[ToolParamName]string{PathParam: "a"}),
+				toolUse(ReadFileToolName, false, map[ToolParamName]string{PathParam: "b"}),
+			},
+		},
+		{
+			name:    "partial parameter",
+			message: "<execute_command>\n<command>go test",
+			want:    []interface{}{toolUse(ExecuteCommandToolName, true, map[ToolParamName]string{CommandParam: "go test"})},
+		},
+		{
+			name:    "unknown tags are text",
+			message: "Use <b>bold</b> and x > y.",
+			want:    []interface{}{NewTextContent("Use <b>bold</b> and x > y.", true)},
+		},
+		{
+			name:    "tags of tools are text in parameters",
+			message: "<attempt_completion><result>Added <read_file> support.</result></attempt_completion>",
+			want:    []interface{}{toolUse(AttemptCompletionToolName, false, map[ToolParamName]string{ResultParam: "Added <read_file> support."})},
+		},
+		{
+			name:    "write_to_file content containing its closing tag",
+			message: "<write_to_file><path>a.xml</path><content>\n<content>x</content>\n</content></write_to_file>",
+			want: []interface{}{toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "a.xml",
+				ContentParam: "<content>x</content>",
+			})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseAssistantMessage(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAssistantMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAdversarialMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    ToolUse
+	}{
+		{
+			name:    "diff containing its closing tag",
+			message: "<replace_in_file><path>p.md</path><diff>\n<<<<<<< SEARCH\nUse </diff>.\n=======\nUse </diff> tags.\n>>>>>>> REPLACE\n</diff></replace_in_file>",
+			want: toolUse(ReplaceInFileToolName, false, map[ToolParamName]string{
+				PathParam: "p.md",
+				DiffParam: "<<<<<<< SEARCH\nUse </diff>.\n=======\nUse </diff> tags.\n>>>>>>> REPLACE",
+			}),
+		},
+		{
+			name:    "content containing a parameter given already",
+			message: "<write_to_file><path>a.html</path><content><p>x</content>\n<path>b</path>\n</content></write_to_file>",
+			want: toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "a.html",
+				ContentParam: "<p>x</content>\n<path>b</path>",
+			}),
+		},
+		{
+			name:    "content containing a parameter of another tool",
+			message: "<write_to_file><path>a.xml</path><content>x</content><command>rm -rf /</command></content></write_to_file>",
+			want: toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "a.xml",
+				ContentParam: "x</content><command>rm -rf /</command>",
+			}),
+		},
+		{
+			name:    "CDATA section",
+			message: "<write_to_file><path>p.txt</path><content><![CDATA[a </content> </write_to_file> b]]></content></write_to_file>",
+			want: toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "p.txt",
+				ContentParam: "a </content> </write_to_file> b",
+			}),
+		},
+		{
+			name:    "CDATA section keeps whitespace",
+			message: "<write_to_file>\n<path>p.py</path>\n<content>\n<![CDATA[\n    indented\n]]>\n</content>\n</write_to_file>",
+			want: toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "p.py",
+				ContentParam: "\n    indented\n",
+			}),
+		},
+		{
+			name:    "unclosed CDATA section",
+			message: "<write_to_file><path>p.txt</path><content><![CDATA[x</content>",
+			want: toolUse(WriteToFileToolName, true, map[ToolParamName]string{
+				PathParam:    "p.txt",
+				ContentParam: "x</content>",
+			}),
+		},
+		{
+			name:    "opening tag of the parameter in its value",
+			message: "<attempt_completion><result>Wrapped in <result> tags.</result></attempt_completion>",
+			want:    toolUse(AttemptCompletionToolName, false, map[ToolParamName]string{ResultParam: "Wrapped in <result> tags."}),
+		},
+		{
+			name:    "redirections in a command",
+			message: "<execute_command><command>echo a > b.txt && cat <b.txt 2>&1</command><requires_approval>false</requires_approval></execute_command>",
+			want: toolUse(ExecuteCommandToolName, false, map[ToolParamName]string{
+				CommandParam:          "echo a > b.txt && cat <b.txt 2>&1",
+				RequiresApprovalParam: "false",
+			}),
+		},
+		{
+			name:    "closing tag of the tool in a value",
+			message: "<write_to_file><path>t.md</path><content>end with </write_to_file></content></write_to_file>",
+			want: toolUse(WriteToFileToolName, false, map[ToolParamName]string{
+				PathParam:    "t.md",
+				ContentParam: "end with </write_to_file>",
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := ParseAssistantMessage(tt.message)
+			if len(blocks) != 1 || !reflect.DeepEqual(blocks[0], tt.want) {
+				t.Fatalf("ParseAssistantMessage() = %+v, want %+v", blocks, tt.want)
+			}
+			for size := 1; size < 8; size++ {
+				p := NewParser()
+				for i := 0; i < len(tt.message); i += size {
+					p.Append(tt.message[i:min(i+size, len(tt.message))])
+				}
+				if got := p.Blocks(); !reflect.DeepEqual(got, blocks) {
+					t.Fatalf("chunks of %d: Blocks() = %+v, want %+v", size, got, blocks)
+				}
+			}
+		})
+	}
+}
+
+func TestParserChunks(t *testing.T) {
+	message := "I will write the file.\n<write_to_file>\n<path>hello.go</path>\n<content>\npackage main\n\nfunc main() {}\n</content>\n</write_to_file>\nDone <b>now</b>."
+	want := ParseAssistantMessage(message)
+
+	for size := 1; size <= len(message); size++ {
+		p := NewParser()
+		for i := 0; i < len(message); i += size {
+			p.Append(message[i:min(i+size, len(message))])
+		}
+		if got := p.Blocks(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("chunks of %d: Blocks() = %+v, want %+v", size, got, want)
+		}
+	}
+}
+
+func TestParserDeltas(t *testing.T) {
+	p := NewParser()
+
+	deltas := p.Append("Reading.\n<read_fi")
+	if len(deltas) != 1 || deltas[0].Index != 0 || deltas[0].Block != NewTextContent("Reading.\n<read_fi", true) {
+		t.Fatalf("deltas = %+v, want the partial text", deltas)
+	}
+
+	deltas = p.Append("le>\n<path>main")
+	if len(deltas) != 2 || deltas[0].Block != NewTextContent("Reading.", false) {
+		t.Fatalf("deltas = %+v, want the completed text and the partial tool use", deltas)
+	}
+	if tool, ok := deltas[1].Block.(ToolUse); !ok || deltas[1].Index != 1 || !tool.Partial || tool.Params[PathParam] != "main" {
+		t.Fatalf("delta = %+v, want the partial tool use", deltas[1])
+	}
+
+	deltas = p.Append(".go</path></read_file>")
+	if len(deltas) != 1 || deltas[0].Index != 1 {
+		t.Fatalf("deltas = %+v, want the completed tool use", deltas)
+	}
+	if tool := deltas[0].Block.(ToolUse); tool.Partial || tool.Params[PathParam] != "main.go" {
+		t.Errorf("tool use = %+v", tool)
+	}
+
+	if deltas := p.Append(""); deltas != nil {
+		t.Errorf("deltas of an empty chunk = %+v", deltas)
+	}
+}
+
+// benchmarkMessage is a long response writing a file
+var benchmarkMessage = "Writing the file.\n<write_to_file>\n<path>big.go</path>\n<content>\n" +
+	strings.Repeat("func f() { if a > b { return <-ch } }\n", 5000) + "</content>\n</write_to_file>"
+
+func BenchmarkParseAssistantMessage(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkMessage)))
+	for b.Loop() {
+		ParseAssistantMessage(benchmarkMessage)
+	}
+}
+
+func BenchmarkParserStream(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkMessage)))
+	for b.Loop() {
+		p := NewParser()
+		for i := 0; i < len(benchmarkMessage); i += 20 {
+			p.Append(benchmarkMessage[i:min(i+20, len(benchmarkMessage))])
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package assistantmessage
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ToolParamType represents the type of a tool parameter value.
+// Values are always sent as text inside XML tags, the type tells how the text is interpreted.
+type ToolParamType string
+
+const (
+	// StringParamType is free-form text
+	StringParamType ToolParamType = "string"
+	// BooleanParamType is "true" or "false"
+	BooleanParamType ToolParamType = "boolean"
+	// JSONParamType is a JSON object
+	JSONParamType ToolParamType = "json"
+)
+
+// ToolParameter describes a parameter of a tool
+type ToolParameter struct {
+	Name        ToolParamName `json:"name"`
+	Description string        `json:"description"`
+	Required    bool          `json:"required"`
+	Type        ToolParamType `json:"type"`
+}
+
+// ToolSchema describes a tool the agent can use
+type ToolSchema struct {
+	Name        ToolUseName     `json:"name"`
+	Description string          `json:"description"`
+	Parameters  []ToolParameter `json:"parameters"`
+}
+
+// toolSchemas is the registry of all tools, in the order they are documented to the model
+var toolSchemas = []ToolSchema{
+	{
+		Name:        ExecuteCommandToolName,
+		Description: "Request to execute a CLI command on the system.",
+		Parameters: []ToolParameter{
+			{Name: CommandParam, Description: "The CLI command to execute.", Required: true, Type: StringParamType},
+			{Name: RequiresApprovalParam, Description: "A boolean indicating whether this command requires explicit user approval.", Required: true, Type: BooleanParamType},
+		},
+	},
+	{
+		Name:        ReadFileToolName,
+		Description: "Request to read the contents of a file at the specified path. Each line is prefixed with its line number and \" | \", which are not part of the file: leave them out of the SEARCH blocks of replace_in_file. Large files are truncated with a notice telling how to read the rest with start_line. Files encoded in UTF-16 or Shift-JIS are decoded.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the file to read (relative to the current working directory)", Required: true, Type: StringParamType},
+			{Name: StartLineParam, Description: "The first line to read, starting at 1. Defaults to the first line of the file.", Required: false, Type: StringParamType},
+			{Name: EndLineParam, Description: "The last line to read, included. Defaults to the last line of the file.", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        WriteToFileToolName,
+		Description: "Request to write content to a file at the specified path. A file too large for one message can be written in parts split between lines: send every part but the last with mode append, then the last part with mode finalize. The parts are joined with line breaks and the file is only written once it is finalized.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the file to write to", Required: true, Type: StringParamType},
+			{Name: ContentParam, Description: "The content to write to the file, or the next part of it with mode append or finalize.", Required: true, Type: StringParamType},
+			{Name: ModeParam, Description: "overwrite (the default) to write the whole content at once, append to add a part to a file written in parts, finalize to add the last part and write the file.", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        ReplaceInFileToolName,
+		Description: "Request to replace sections of content in an existing file. The changes are written as SEARCH/REPLACE blocks, or as a unified diff whose hunks start with @@ headers and whose lines start with a space for context, - for removed and + for added lines.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the file to modify", Required: true, Type: StringParamType},
+			{Name: DiffParam, Description: "One or more SEARCH/REPLACE blocks, or the hunks of a unified diff, in the order they appear in the file. Each SEARCH block must match exactly one place of the file, include enough surrounding lines to make it unique.", Required: true, Type: StringParamType},
+		},
+	},
+	{
+		Name:        SearchFilesToolName,
+		Description: "Request to perform a regex search across files.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the directory to search in", Required: true, Type: StringParamType},
+			{Name: RegexParam, Description: "The regular expression pattern to search for", Required: true, Type: StringParamType},
+			{Name: FilePatternParam, Description: "Glob pattern to filter files", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        SemanticSearchToolName,
+		Description: "Request to search the semantic index of the workspace for the code related to a description, when the names or the exact text to look for with search_files are not known. Returns the most similar chunks of files with their line ranges.",
+		Parameters: []ToolParameter{
+			{Name: QueryParam, Description: "A description of the code to find, e.g. \"where the retry delay of API requests is computed\"", Required: true, Type: StringParamType},
+			{Name: PathParam, Description: "The path of a directory to restrict the search to", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        ListFilesToolName,
+		Description: "Request to list files and directories.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the directory to list contents for", Required: true, Type: StringParamType},
+			{Name: RecursiveParam, Description: "Whether to list files recursively", Required: false, Type: BooleanParamType},
+		},
+	},
+	{
+		Name:        ListCodeDefinitionNamesToolName,
+		Description: "Request to list definition names (classes, functions, methods, etc.) used in source code files at the top level of the specified directory.",
+		Parameters: []ToolParameter{
+			{Name: PathParam, Description: "The path of the directory to list top level source code definitions for", Required: true, Type: StringParamType},
+		},
+	},
+	{
+		Name:        BrowserActionToolName,
+		Description: "Request to interact with a Puppeteer-controlled browser.",
+		Parameters: []ToolParameter{
+			{Name: ActionParam, Description: "The action to perform: launch, click, type, scroll_down, scroll_up or close", Required: true, Type: StringParamType},
+			{Name: URLParam, Description: "The URL to open, for the launch action", Required: false, Type: StringParamType},
+			{Name: CoordinateParam, Description: "The x,y coordinates to click, for the click action", Required: false, Type: StringParamType},
+			{Name: TextParam, Description: "The text to type, for the type action", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        UseMcpToolToolName,
+		Description: "Request to use a tool provided by a connected MCP server.",
+		Parameters: []ToolParameter{
+			{Name: ServerNameParam, Description: "The name of the MCP server providing the tool", Required: true, Type: StringParamType},
+			{Name: ToolNameParam, Description: "The name of the tool to execute", Required: true, Type: StringParamType},
+			{Name: ArgumentsParam, Description: "A JSON object containing the tool's input parameters", Required: true, Type: JSONParamType},
+		},
+	},
+	{
+		Name:        AccessMcpResourceToolName,
+		Description: "Request to access a resource provided by a connected MCP server.",
+		Parameters: []ToolParameter{
+			{Name: ServerNameParam, Description: "The name of the MCP server providing the resource", Required: true, Type: StringParamType},
+			{Name: URIParam, Description: "The URI identifying the resource to access", Required: true, Type: StringParamType},
+		},
+	},
+	{
+		Name:        AskFollowupQuestionToolName,
+		Description: "Ask the user a question to gather additional information.",
+		Parameters: []ToolParameter{
+			{Name: QuestionParam, Description: "The question to ask the user.", Required: true, Type: StringParamType},
+			{Name: OptionsParam, Description: "A JSON array of 2 to 5 answers the user can pick from, e.g. [\"Option 1\", \"Option 2\"]. The user can still answer something else.", Required: false, Type: JSONParamType},
+		},
+	},
+	{
+		Name:        PlanModeResponseToolName,
+		Description: "Respond to the user's inquiry while planning a solution.",
+		Parameters: []ToolParameter{
+			{Name: ResponseParam, Description: "The response to provide to the user.", Required: true, Type: StringParamType},
+		},
+	},
+	{
+		Name:        AttemptCompletionToolName,
+		Description: "Present the result of your work to the user.",
+		Parameters: []ToolParameter{
+			{Name: ResultParam, Description: "The result of the task.", Required: true, Type: StringParamType},
+			{Name: CommandParam, Description: "A CLI command to showcase the result, e.g. `open index.html`. The user is offered to run it.", Required: false, Type: StringParamType},
+		},
+	},
+	{
+		Name:        NewTaskToolName,
+		Description: "Delegate a self-contained part of the task to a child task, which runs to completion with its own prompt and turn budget and returns its result.",
+		Parameters: []ToolParameter{
+			{Name: PromptParam, Description: "The complete instructions of the child task, including the context it needs, as it does not see this conversation.", Required: true, Type: StringParamType},
+			{Name: AllowedToolsParam, Description: "A comma-separated list of the tools the child task may use, all of yours if omitted.", Required: false, Type: StringParamType},
+			{Name: MaxTurnsParam, Description: "The maximum number of responses of the child task.", Required: false, Type: StringParamType},
+		},
+	},
+}
+
+// registeredSchemas are the tools defined outside goline, such as plugins, registered with RegisterToolSchema
+var (
+	registeredMu      sync.RWMutex
+	registeredSchemas []ToolSchema
+)
+
+// toolNamePattern is the form of tool and parameter names, which are used as XML tags
+var toolNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RegisterToolSchema adds a tool defined outside goline, such as a plugin, to the registry,
+// so that its tool uses are parsed, validated and documented to the model
+func RegisterToolSchema(schema ToolSchema) error {
+	if !toolNamePattern.MatchString(string(schema.Name)) {
+		return fmt.Errorf("invalid tool name %q, expected lowercase letters, digits and underscores", schema.Name)
+	}
+	if _, ok := LookupToolSchema(schema.Name); ok {
+		return fmt.Errorf("tool %s is already defined", schema.Name)
+	}
+	schema.Parameters = append([]ToolParameter(nil), schema.Parameters...)
+	seen := make(map[ToolParamName]bool, len(schema.Parameters))
+	for i, param := range schema.Parameters {
+		if !toolNamePattern.MatchString(string(param.Name)) {
+			return fmt.Errorf("invalid parameter name %q for tool %s", param.Name, schema.Name)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("duplicate parameter %s for tool %s", param.Name, schema.Name)
+		}
+		seen[param.Name] = true
+		switch param.Type {
+		case "":
+			schema.Parameters[i].Type = StringParamType
+		case StringParamType, BooleanParamType, JSONParamType:
+		default:
+			return fmt.Errorf("invalid type %q of parameter %s for tool %s", param.Type, param.Name, schema.Name)
+		}
+	}
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registeredSchemas = append(registeredSchemas, schema)
+	return nil
+}
+
+// unregisterToolSchema removes a registered tool, for tests
+func unregisterToolSchema(name ToolUseName) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registeredSchemas = slices.DeleteFunc(registeredSchemas, func(schema ToolSchema) bool {
+		return schema.Name == name
+	})
+}
+
+// IsBuiltinTool reports whether a tool is provided by goline rather than registered with RegisterToolSchema
+func IsBuiltinTool(name ToolUseName) bool {
+	for _, schema := range toolSchemas {
+		if schema.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allSchemas returns the built-in tools followed by the registered ones
+func allSchemas() []ToolSchema {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return append(slices.Clip(toolSchemas), registeredSchemas...)
+}
+
+// ToolSchemas returns the schema of every tool, the built-in ones first.
+// The returned slice is a copy and can be modified by the caller.
+func ToolSchemas() []ToolSchema {
+	all := allSchemas()
+	schemas := make([]ToolSchema, len(all))
+	for i, schema := range all {
+		schema.Parameters = append([]ToolParameter(nil), schema.Parameters...)
+		schemas[i] = schema
+	}
+	return schemas
+}
+
+// LookupToolSchema returns the schema of a tool
+func LookupToolSchema(name ToolUseName) (ToolSchema, bool) {
+	for _, schema := range allSchemas() {
+		if schema.Name == name {
+			schema.Parameters = append([]ToolParameter(nil), schema.Parameters...)
+			return schema, true
+		}
+	}
+	return ToolSchema{}, false
+}
+
+// ValidateToolUse checks a complete tool use against its schema.
+// It reports unknown tools and parameters, missing required parameters and values of the wrong type.
+func ValidateToolUse(toolUse ToolUse) error {
+	schema, ok := LookupToolSchema(toolUse.Name)
+	if !ok {
+		return fmt.Errorf("unknown tool: %s", toolUse.Name)
+	}
+
+	params := make(map[ToolParamName]ToolParameter, len(schema.Parameters))
+	for _, param := range schema.Parameters {
+		params[param.Name] = param
+		value, given := toolUse.Params[param.Name]
+		if param.Required && (!given || strings.TrimSpace(value) == "") {
+			return fmt.Errorf("missing required parameter %s for tool %s", param.Name, schema.Name)
+		}
+	}
+
+	for name, value := range toolUse.Params {
+		param, ok := params[name]
+		if !ok {
+			return fmt.Errorf("unknown parameter %s for tool %s", name, schema.Name)
+		}
+		if err := validateParamValue(param, value); err != nil {
+			return fmt.Errorf("invalid parameter %s for tool %s: %w", name, schema.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateParamValue checks that a parameter value can be interpreted as the parameter type
+func validateParamValue(param ToolParameter, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	switch param.Type {
+	case BooleanParamType:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+	case JSONParamType:
+		var object map[string]any
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return fmt.Errorf("expected a JSON object: %w", err)
+		}
+	}
+	return nil
+}
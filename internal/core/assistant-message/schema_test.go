@@ -0,0 +1,118 @@
+package assistantmessage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolSchemasCoverAllTools(t *testing.T) {
+	known := make(map[ToolParamName]bool)
+	for _, name := range AllToolParamNames() {
+		known[name] = true
+	}
+
+	for _, name := range AllToolUseNames() {
+		schema, ok := LookupToolSchema(name)
+		if !ok {
+			t.Errorf("No schema for tool %s", name)
+			continue
+		}
+		if schema.Description == "" {
+			t.Errorf("Tool %s has no description", name)
+		}
+		for _, param := range schema.Parameters {
+			if !known[param.Name] {
+				t.Errorf("Tool %s has unknown parameter %s", name, param.Name)
+			}
+		}
+	}
+
+	if len(ToolSchemas()) != len(AllToolUseNames()) {
+		t.Errorf("Expected %d schemas, got %d", len(AllToolUseNames()), len(ToolSchemas()))
+	}
+}
+
+func TestValidateToolUse(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    ToolUseName
+		params  map[ToolParamName]string
+		wantErr string
+	}{
+		{"valid", ListFilesToolName, map[ToolParamName]string{PathParam: ".", RecursiveParam: "true"}, ""},
+		{"optional omitted", ListFilesToolName, map[ToolParamName]string{PathParam: "."}, ""},
+		{"unknown tool", "rm_rf", nil, "unknown tool"},
+		{"missing required", WriteToFileToolName, map[ToolParamName]string{PathParam: "a.go"}, "missing required parameter content"},
+		{"unknown parameter", ReadFileToolName, map[ToolParamName]string{PathParam: "a.go", RegexParam: "x"}, "unknown parameter regex"},
+		{"invalid boolean", ListFilesToolName, map[ToolParamName]string{PathParam: ".", RecursiveParam: "yes"}, "expected true or false"},
+		{"invalid json", UseMcpToolToolName, map[ToolParamName]string{ServerNameParam: "s", ToolNameParam: "t", ArgumentsParam: "[1]"}, "expected a JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolUse := NewToolUse(tt.tool, false)
+			for name, value := range tt.params {
+				toolUse.Params[name] = value
+			}
+
+			err := ValidateToolUse(toolUse)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRegisterToolSchema(t *testing.T) {
+	schema := ToolSchema{
+		Name:        "run_migration",
+		Description: "Run the database migrations.",
+		Parameters: []ToolParameter{
+			{Name: "env", Description: "The environment to migrate", Required: true},
+			{Name: "dry_run", Description: "Only print the migrations", Type: BooleanParamType},
+		},
+	}
+	if err := RegisterToolSchema(schema); err != nil {
+		t.Fatalf("RegisterToolSchema() error = %v", err)
+	}
+	t.Cleanup(func() { unregisterToolSchema(schema.Name) })
+
+	if IsBuiltinTool(schema.Name) {
+		t.Error("a registered tool is reported as built-in")
+	}
+	registered, ok := LookupToolSchema(schema.Name)
+	if !ok || registered.Parameters[0].Type != StringParamType {
+		t.Errorf("LookupToolSchema() = %+v, %v, want the tool with string as the default type", registered, ok)
+	}
+
+	blocks := ParseAssistantMessage("Migrating.\n<run_migration>\n<env>staging</env>\n<dry_run>true</dry_run>\n</run_migration>")
+	if len(blocks) != 2 {
+		t.Fatalf("ParseAssistantMessage() = %d blocks, want 2", len(blocks))
+	}
+	toolUse, ok := blocks[1].(ToolUse)
+	if !ok || toolUse.Name != schema.Name || toolUse.Params["env"] != "staging" {
+		t.Fatalf("tool use = %+v", blocks[1])
+	}
+	if err := ValidateToolUse(toolUse); err != nil {
+		t.Errorf("ValidateToolUse() error = %v", err)
+	}
+
+	for _, invalid := range []ToolSchema{
+		schema,
+		{Name: ReadFileToolName, Description: "Shadow a built-in tool."},
+		{Name: "Bad-Name", Description: "Not usable as an XML tag."},
+		{Name: "bad_param", Description: "Bad parameter.", Parameters: []ToolParameter{{Name: "a b"}}},
+		{Name: "bad_type", Description: "Bad type.", Parameters: []ToolParameter{{Name: "n", Type: "number"}}},
+	} {
+		if err := RegisterToolSchema(invalid); err == nil {
+			t.Errorf("RegisterToolSchema(%s) succeeded, want an error", invalid.Name)
+			unregisterToolSchema(invalid.Name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package assistantmessage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// ContinuationPrompt asks the AI to resume a truncated response where it stopped
+const ContinuationPrompt = "Your previous response was cut off. Continue it exactly from where it stopped, without repeating what you already wrote and without any introduction."
+
+// minStitchOverlap is the shortest text repeated at the start of a continuation that is
+// dropped when it is stitched, shorter overlaps are likely to be coincidental
+const minStitchOverlap = 16
+
+// maxStitchOverlap bounds how far back a continuation is matched against the truncated response
+const maxStitchOverlap = 2000
+
+// DetectTruncation returns why a response looks cut off, nil if it looks complete.
+// stopReason is the stop reason reported by the provider, empty if unknown.
+func DetectTruncation(content, stopReason string) []string {
+	var reasons []string
+	if stopReason == provider.StopReasonMaxTokens {
+		reasons = append(reasons, "the response reached the output token limit")
+	}
+
+	blocks := ParseAssistantMessage(content)
+	if len(blocks) > 0 {
+		if toolUse, ok := blocks[len(blocks)-1].(ToolUse); ok && toolUse.Partial {
+			reasons = append(reasons, fmt.Sprintf("the %s tool use is not closed", toolUse.Name))
+		}
+	}
+
+	fences := 0
+	for _, block := range blocks {
+		text, ok := block.(TextContent)
+		if !ok {
+			continue
+		}
+		for _, line := range strings.Split(text.Content.Content, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				fences++
+			}
+		}
+	}
+	if fences%2 != 0 {
+		reasons = append(reasons, "a code block is not closed")
+	}
+	return reasons
+}
+
+// StitchContinuation joins a truncated response and its continuation. Models often repeat
+// the end of the truncated response before going on, the repeated text is kept only once.
+func StitchContinuation(truncated, continuation string) string {
+	for n := min(len(truncated), len(continuation), maxStitchOverlap); n >= minStitchOverlap; n-- {
+		if strings.HasSuffix(truncated, continuation[:n]) {
+			return truncated + continuation[n:]
+		}
+	}
+	return truncated + continuation
+}
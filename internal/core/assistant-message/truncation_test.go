@@ -0,0 +1,66 @@
+package assistantmessage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+func TestDetectTruncation(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		stopReason string
+		want       []string
+	}{
+		{
+			name:    "complete",
+			content: "Done.\n<attempt_completion>\n<result>ok</result>\n</attempt_completion>",
+		},
+		{
+			name:       "token limit",
+			content:    "I will",
+			stopReason: provider.StopReasonMaxTokens,
+			want:       []string{"the response reached the output token limit"},
+		},
+		{
+			name:    "unterminated tool use",
+			content: "<write_to_file>\n<path>a.go</path>\n<content>package a",
+			want:    []string{"the write_to_file tool use is not closed"},
+		},
+		{
+			name:    "unbalanced code fence",
+			content: "Here is the code:\n```go\nfunc main() {",
+			want:    []string{"a code block is not closed"},
+		},
+		{
+			name:    "fences in tool parameters are not counted",
+			content: "<write_to_file>\n<path>README.md</path>\n<content>```sh\n</content>\n</write_to_file>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectTruncation(tt.content, tt.stopReason); !slices.Equal(got, tt.want) {
+				t.Errorf("DetectTruncation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStitchContinuation(t *testing.T) {
+	tests := []struct {
+		truncated, continuation, want string
+	}{
+		{"func main() {\n\tfmt.Pri", "ntln(1)\n}", "func main() {\n\tfmt.Println(1)\n}"},
+		// The repeated end of the truncated response is kept once
+		{"first line\nsecond line is long", "second line is long\nthird line", "first line\nsecond line is long\nthird line"},
+		// Short overlaps are kept, they are likely to be coincidental
+		{"a = b", "b + c", "a = bb + c"},
+	}
+	for _, tt := range tests {
+		if got := StitchContinuation(tt.truncated, tt.continuation); got != tt.want {
+			t.Errorf("StitchContinuation(%q, %q) = %q, want %q", tt.truncated, tt.continuation, got, tt.want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package assistantmessage
 
+import "slices"
+
 // ContentType represents the type of content in an assistant message
 type ContentType string
 
@@ -54,6 +56,8 @@ const (
 	AskFollowupQuestionToolName     ToolUseName = "ask_followup_question"
 	PlanModeResponseToolName        ToolUseName = "plan_mode_response"
 	AttemptCompletionToolName       ToolUseName = "attempt_completion"
+	NewTaskToolName                 ToolUseName = "new_task"
+	SemanticSearchToolName          ToolUseName = "semantic_search"
 )
 
 // Tool parameter names
@@ -77,6 +81,14 @@ const (
 	QuestionParam         ToolParamName = "question"
 	ResponseParam         ToolParamName = "response"
 	ResultParam           ToolParamName = "result"
+	PromptParam           ToolParamName = "prompt"
+	AllowedToolsParam     ToolParamName = "allowed_tools"
+	MaxTurnsParam         ToolParamName = "max_turns"
+	ModeParam             ToolParamName = "mode"
+	QueryParam            ToolParamName = "query"
+	StartLineParam        ToolParamName = "start_line"
+	EndLineParam          ToolParamName = "end_line"
+	OptionsParam          ToolParamName = "options"
 )
 
 // ToolUse represents a tool use in an assistant message
@@ -98,9 +110,9 @@ func NewToolUse(name ToolUseName, partial bool) ToolUse {
 	}
 }
 
-// AllToolUseNames returns all tool use names
+// AllToolUseNames returns all tool use names, including the registered tools
 func AllToolUseNames() []ToolUseName {
-	return []ToolUseName{
+	names := []ToolUseName{
 		ExecuteCommandToolName,
 		ReadFileToolName,
 		WriteToFileToolName,
@@ -114,12 +126,21 @@ func AllToolUseNames() []ToolUseName {
 		AskFollowupQuestionToolName,
 		PlanModeResponseToolName,
 		AttemptCompletionToolName,
+		NewTaskToolName,
+		SemanticSearchToolName,
+	}
+
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	for _, schema := range registeredSchemas {
+		names = append(names, schema.Name)
 	}
+	return names
 }
 
-// AllToolParamNames returns all tool parameter names
+// AllToolParamNames returns all tool parameter names, including those of the registered tools
 func AllToolParamNames() []ToolParamName {
-	return []ToolParamName{
+	names := []ToolParamName{
 		CommandParam,
 		RequiresApprovalParam,
 		PathParam,
@@ -139,5 +160,24 @@ func AllToolParamNames() []ToolParamName {
 		QuestionParam,
 		ResponseParam,
 		ResultParam,
+		PromptParam,
+		AllowedToolsParam,
+		MaxTurnsParam,
+		ModeParam,
+		QueryParam,
+		StartLineParam,
+		EndLineParam,
+		OptionsParam,
+	}
+
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	for _, schema := range registeredSchemas {
+		for _, param := range schema.Parameters {
+			if !slices.Contains(names, param.Name) {
+				names = append(names, param.Name)
+			}
+		}
 	}
+	return names
 }
@@ -0,0 +1,202 @@
+package assistantmessage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeaderPattern matches the header of a unified diff hunk. The line numbers are optional,
+// as models often write the header as a bare "@@ ... @@" or "@@".
+var hunkHeaderPattern = regexp.MustCompile(`^@@(?:\s+-(\d+)(?:,\d+)?\s+\+\d+(?:,\d+)?)?.*$`)
+
+// unifiedHunk is a hunk of a unified diff
+type unifiedHunk struct {
+	// line is the first line of the hunk in the original content, starting at 1, zero if unknown
+	line int
+	// before are the context and removed lines, after the context and added lines
+	before, after []string
+}
+
+// IsUnifiedDiff reports whether a diff is a unified diff rather than SEARCH/REPLACE blocks
+func IsUnifiedDiff(diffContent string) bool {
+	if strings.Contains(diffContent, SearchMarker) {
+		return false
+	}
+	for _, line := range strings.Split(diffContent, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyFileDiff applies the diff of replace_in_file to the content of a file, written either
+// as SEARCH/REPLACE blocks or as a unified diff
+func ApplyFileDiff(diffContent, originalContent string) (string, error) {
+	if IsUnifiedDiff(diffContent) {
+		return ApplyUnifiedDiff(diffContent, originalContent)
+	}
+	return ConstructNewFileContent(diffContent, originalContent, true)
+}
+
+// ApplyUnifiedDiff applies the hunks of a unified diff to the content of a file, in order.
+// A hunk is looked for at the line of its header first, then at the nearest line it matches,
+// as the line numbers written by models are often off. Without a line number, a hunk matching
+// several places is an AmbiguousMatchError. Lines are compared ignoring their leading and
+// trailing whitespace when they do not match exactly.
+func ApplyUnifiedDiff(diffContent, originalContent string) (result string, err error) {
+	diffContent = strings.ReplaceAll(diffContent, "\r\n", "\n")
+	crlf := usesCRLF(originalContent)
+	if crlf {
+		originalContent = strings.ReplaceAll(originalContent, "\r\n", "\n")
+		defer func() {
+			if err == nil {
+				result = strings.ReplaceAll(result, "\n", "\r\n")
+			}
+		}()
+	}
+
+	hunks, err := parseUnifiedDiff(diffContent)
+	if err != nil {
+		return "", err
+	}
+
+	// The file is edited as lines, the last one without its line break
+	trailingNewline := strings.HasSuffix(originalContent, "\n")
+	lines := strings.Split(strings.TrimSuffix(originalContent, "\n"), "\n")
+	if originalContent == "" {
+		lines = nil
+	}
+
+	var out []string
+	next := 0
+	for i, hunk := range hunks {
+		start, err := findHunk(lines, hunk, next)
+		if err != nil {
+			return "", fmt.Errorf("hunk %d: %w", i+1, err)
+		}
+		out = append(out, lines[next:start]...)
+		out = append(out, hunk.after...)
+		next = start + len(hunk.before)
+	}
+	out = append(out, lines[next:]...)
+
+	result = strings.Join(out, "\n")
+	if len(out) > 0 && (trailingNewline || originalContent == "") {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// parseUnifiedDiff parses the hunks of a unified diff. The lines before the first hunk, such
+// as the file headers, are ignored.
+func parseUnifiedDiff(diffContent string) ([]unifiedHunk, error) {
+	var hunks []unifiedHunk
+	var current *unifiedHunk
+	for _, line := range strings.Split(diffContent, "\n") {
+		if match := hunkHeaderPattern.FindStringSubmatch(line); match != nil {
+			hunks = append(hunks, unifiedHunk{})
+			current = &hunks[len(hunks)-1]
+			if match[1] != "" {
+				current.line, _ = strconv.Atoi(match[1])
+			}
+			continue
+		}
+		// The file headers come before the first hunk, and "\ No newline at end of file" is not a line
+		if current == nil || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "-"):
+			current.before = append(current.before, line[1:])
+		case strings.HasPrefix(line, "+"):
+			current.after = append(current.after, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.before = append(current.before, line[1:])
+			current.after = append(current.after, line[1:])
+		case line == "":
+			// An empty context line whose leading space was trimmed
+			current.before = append(current.before, "")
+			current.after = append(current.after, "")
+		default:
+			return nil, fmt.Errorf("invalid line in a hunk of the unified diff: %q, each line must start with a space, - or +", line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("no hunks found in the unified diff")
+	}
+
+	// Trailing empty context lines are usually the end of the diff, not lines of the file
+	for i := range hunks {
+		hunk := &hunks[i]
+		for len(hunk.before) > 0 && len(hunk.after) > 0 && hunk.before[len(hunk.before)-1] == "" && hunk.after[len(hunk.after)-1] == "" {
+			hunk.before = hunk.before[:len(hunk.before)-1]
+			hunk.after = hunk.after[:len(hunk.after)-1]
+		}
+	}
+	return hunks, nil
+}
+
+// findHunk returns the index of the line, at or after from, where the original lines of a hunk
+// start
+func findHunk(lines []string, hunk unifiedHunk, from int) (int, error) {
+	if len(hunk.before) == 0 {
+		// A pure insertion goes at its line, or at the end of the file
+		if hunk.line > 0 {
+			return min(max(hunk.line-1, from), len(lines)), nil
+		}
+		return len(lines), nil
+	}
+
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	} {
+		var matches []int
+		for i := from; i <= len(lines)-len(hunk.before); i++ {
+			if hunkMatches(lines[i:], hunk.before, equal) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if hunk.line == 0 {
+			if len(matches) > 1 {
+				starts := make([]int, len(matches))
+				for i, match := range matches {
+					starts[i] = match + 1
+				}
+				return 0, &AmbiguousMatchError{Lines: starts, Hunk: true}
+			}
+			return matches[0], nil
+		}
+		// The match nearest to the line of the header wins
+		best := matches[0]
+		for _, match := range matches[1:] {
+			if distance(match, hunk.line-1) < distance(best, hunk.line-1) {
+				best = match
+			}
+		}
+		return best, nil
+	}
+	return 0, errors.New("the context and removed lines of the hunk do not match the file, read the file again if it changed")
+}
+
+// hunkMatches reports whether lines start with the lines of a hunk
+func hunkMatches(lines, hunk []string, equal func(a, b string) bool) bool {
+	for i, line := range hunk {
+		if !equal(lines[i], line) {
+			return false
+		}
+	}
+	return true
+}
+
+// distance returns the absolute difference of two line indexes
+func distance(a, b int) int {
+	return max(a-b, b-a)
+}
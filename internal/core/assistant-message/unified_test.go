@@ -0,0 +1,105 @@
+package assistantmessage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	original := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	tests := []struct {
+		name     string
+		original string
+		diff     string
+		want     string
+	}{
+		{
+			name:     "with file headers",
+			original: original,
+			diff:     "--- a/main.go\n+++ b/main.go\n@@ -5,3 +5,3 @@\n func main() {\n-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"bye\")\n }\n",
+			want:     "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"bye\")\n}\n",
+		},
+		{
+			name:     "wrong line number",
+			original: original,
+			diff:     "@@ -40,2 +40,3 @@\n func main() {\n+\tdefer fmt.Println(\"done\")\n \tfmt.Println(\"hello\")\n",
+			want:     "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tdefer fmt.Println(\"done\")\n\tfmt.Println(\"hello\")\n}\n",
+		},
+		{
+			name:     "bare headers and several hunks",
+			original: original,
+			diff:     "@@\n-package main\n+package app\n@@ ... @@\n-func main() {\n+func Run() {\n",
+			want:     "package app\n\nimport \"fmt\"\n\nfunc Run() {\n\tfmt.Println(\"hello\")\n}\n",
+		},
+		{
+			name:     "indentation differences",
+			original: original,
+			diff:     "@@ -6 +6 @@\n-    fmt.Println(\"hello\")\n+\tfmt.Println(\"hi\")\n",
+			want:     "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		},
+		{
+			name:     "nearest match to the line number",
+			original: "x\ny\nx\ny\n",
+			diff:     "@@ -3,2 +3,2 @@\n x\n-y\n+z\n",
+			want:     "x\ny\nx\nz\n",
+		},
+		{
+			name:     "no newline at end of file",
+			original: "a\nb",
+			diff:     "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			want:     "a\nc",
+		},
+		{
+			name:     "CRLF",
+			original: "a\r\nb\r\n",
+			diff:     "@@ -2 +2,2 @@\n-b\n+B\n+C\n",
+			want:     "a\r\nB\r\nC\r\n",
+		},
+		{
+			name:     "CRLF diff of a LF file",
+			original: "a\nb\n",
+			diff:     "@@ -2 +2 @@\r\n-b\r\n+B\r\n",
+			want:     "a\nB\n",
+		},
+		{
+			name:     "new file",
+			original: "",
+			diff:     "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			want:     "one\ntwo\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyFileDiff(tt.diff, tt.original)
+			if err != nil || got != tt.want {
+				t.Errorf("ApplyFileDiff() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUnifiedDiffErrors(t *testing.T) {
+	original := "x\ny\nx\ny\n"
+
+	_, err := ApplyUnifiedDiff("@@\n x\n-y\n+z\n", original)
+	var ambiguous *AmbiguousMatchError
+	if !errors.As(err, &ambiguous) || !ambiguous.Hunk || len(ambiguous.Lines) != 2 {
+		t.Errorf("error = %v, want an ambiguous hunk", err)
+	}
+
+	if _, err := ApplyUnifiedDiff("@@ -1 +1 @@\n-w\n+z\n", original); err == nil {
+		t.Error("a hunk not matching the file was applied")
+	}
+	if _, err := ApplyUnifiedDiff("@@ -1 +1 @@\nx\n", original); err == nil {
+		t.Error("a hunk with a line without prefix was applied")
+	}
+}
+
+func TestIsUnifiedDiff(t *testing.T) {
+	if !IsUnifiedDiff("--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n") {
+		t.Error("unified diff not detected")
+	}
+	if IsUnifiedDiff(block("@@ -1 +1 @@\n", "x\n")) {
+		t.Error("SEARCH/REPLACE blocks detected as a unified diff")
+	}
+}
@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// auditFileName is the name of the file in the task directory that stores the audit log
+const auditFileName = "outbound_audit.jsonl"
+
+// Kinds of the entries of the audit log
+const (
+	// KindFile is a file whose content was given to the AI
+	KindFile = "file"
+	// KindRequest is a request sent to a provider
+	KindRequest = "request"
+	// KindBlocked is a request refused by the outbound policy
+	KindBlocked = "blocked"
+)
+
+// Entry is an entry of the audit log of a task
+type Entry struct {
+	// Time is when the content was sent
+	Time time.Time `json:"time"`
+	// Kind is the kind of the entry, KindFile, KindRequest or KindBlocked
+	Kind string `json:"kind"`
+	// Path is the path of the file, relative to the working directory, for KindFile
+	Path string `json:"path,omitempty"`
+	// Bytes is the size of the content of the file or the request
+	Bytes int64 `json:"bytes"`
+	// Provider and Model received the request, for KindRequest and KindBlocked
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Reason is why the request was refused, for KindBlocked
+	Reason string `json:"reason,omitempty"`
+}
+
+// Log records the content a task sends to the providers in ~/.goline/tasks/<id>/outbound_audit.jsonl
+// and refuses the requests exceeding the size limits of the outbound policy.
+// A nil Log records nothing and allows every request.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	// maxRequest and maxTask are the size limits in bytes, zero for none
+	maxRequest int64
+	maxTask    int64
+	// sent is the total size of the requests of the task so far, resumed runs included
+	sent int64
+	now  func() time.Time
+}
+
+// Open opens the audit log of a task with the size limits of an outbound policy
+func Open(taskID string, policy config.Outbound) (*Log, error) {
+	path, err := logPath(taskID)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path, now: time.Now}
+	if l.maxRequest, err = parseLimit("outbound.max_request_size", policy.MaxRequestSize); err != nil {
+		return nil, err
+	}
+	if l.maxTask, err = parseLimit("outbound.max_task_size", policy.MaxTaskSize); err != nil {
+		return nil, err
+	}
+
+	entries, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Kind == KindRequest {
+			l.sent += entry.Bytes
+		}
+	}
+	return l, nil
+}
+
+// logPath returns the path of the audit log of a task
+func logPath(taskID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".goline", "tasks", taskID, auditFileName), nil
+}
+
+// parseLimit parses a size limit of the configuration, zero if it is empty
+func parseLimit(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := config.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return size, nil
+}
+
+// Request checks a request of size bytes to the model of a provider against the size limits
+// and records it, or records it as blocked and returns an error when it exceeds one of them
+func (l *Log) Request(p provider.Provider, size int64) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := Entry{Kind: KindRequest, Bytes: size, Provider: p.Name(), Model: p.GetModel().Name}
+	switch {
+	case l.maxRequest > 0 && size > l.maxRequest:
+		entry.Reason = fmt.Sprintf("the request of %d bytes exceeds outbound.max_request_size of %d bytes", size, l.maxRequest)
+	case l.maxTask > 0 && l.sent+size > l.maxTask:
+		entry.Reason = fmt.Sprintf("the task would send %d bytes, over outbound.max_task_size of %d bytes", l.sent+size, l.maxTask)
+	}
+	if entry.Reason != "" {
+		entry.Kind = KindBlocked
+		l.append(entry)
+		return fmt.Errorf("blocked by the outbound policy: %s", entry.Reason)
+	}
+
+	l.sent += size
+	l.append(entry)
+	return nil
+}
+
+// RecordFile records that size bytes of the content of a file, relative to the working
+// directory, were given to the AI
+func (l *Log) RecordFile(path string, size int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.append(Entry{Kind: KindFile, Path: filepath.ToSlash(path), Bytes: int64(size)})
+}
+
+// append writes an entry to the log. Must be called with mu held. A failure is only logged,
+// the task goes on without its audit log.
+func (l *Log) append(entry Entry) {
+	entry.Time = l.now()
+	if err := l.write(entry); err != nil {
+		slog.Warn("Failed to write the outbound audit log", "error", err)
+	}
+}
+
+// write writes an entry at the end of the log file
+func (l *Log) write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create task directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load returns the entries of the audit log of a task, oldest first, none if nothing was sent
+func Load(taskID string) ([]Entry, error) {
+	path, err := logPath(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return load(path)
+}
+
+// load reads the entries of an audit log file
+func load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the outbound audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse the outbound audit log: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the outbound audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// RequestSize returns the size in bytes of the content of a request: the system prompt, and
+// the text, reasoning, tool calls and results and images of the messages
+func RequestSize(systemPrompt string, messages []provider.Message) int64 {
+	size := int64(len(systemPrompt))
+	for _, m := range messages {
+		size += int64(len(m.Content) + len(m.ReasoningContent))
+		for _, block := range m.Thinking {
+			size += int64(len(block.Thinking) + len(block.Data))
+		}
+		for _, call := range m.ToolCalls {
+			size += int64(len(call.Input))
+		}
+		for _, result := range m.ToolResults {
+			size += int64(len(result.Content))
+		}
+		for _, image := range m.Images {
+			size += int64(len(image.Data))
+		}
+	}
+	return size
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+func TestLog(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	p := mock.New(&mock.Fixture{Model: "mock-model"})
+	policy := config.Outbound{MaxRequestSize: "100", MaxTaskSize: "250"}
+
+	l, err := Open("task", policy)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	l.RecordFile("src/main.go", 42)
+	if err := l.Request(p, 100); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if err := l.Request(p, 101); err == nil || !strings.Contains(err.Error(), "max_request_size") {
+		t.Errorf("Request() over the request limit error = %v", err)
+	}
+
+	// The requests of earlier runs count towards the task limit
+	l, err = Open("task", policy)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := l.Request(p, 100); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if err := l.Request(p, 60); err == nil || !strings.Contains(err.Error(), "max_task_size") {
+		t.Errorf("Request() over the task limit error = %v", err)
+	}
+
+	entries, err := Load("task")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var kinds []string
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+	}
+	want := []string{KindFile, KindRequest, KindBlocked, KindRequest, KindBlocked}
+	if strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Fatalf("kinds = %v, want %v", kinds, want)
+	}
+	if entries[0].Path != "src/main.go" || entries[0].Bytes != 42 {
+		t.Errorf("file entry = %+v", entries[0])
+	}
+	if entries[1].Provider != mock.Name || entries[1].Model != "mock-model" {
+		t.Errorf("request entry = %+v", entries[1])
+	}
+
+	if _, err := Open("task", config.Outbound{MaxTaskSize: "lots"}); err == nil {
+		t.Error("Open() accepted an invalid size")
+	}
+	var nilLog *Log
+	if err := nilLog.Request(p, 1<<40); err != nil {
+		t.Errorf("nil Log refused a request: %v", err)
+	}
+}
+
+func TestRequestSize(t *testing.T) {
+	messages := []provider.Message{
+		{Role: "user", Content: "hello", Images: []provider.Image{{Data: []byte("1234")}}},
+		{Role: "assistant", Content: "hi", ToolCalls: []provider.ToolCall{{Input: []byte(`{}`)}}},
+		{Role: "user", ToolResults: []provider.ToolResult{{Content: "done"}}},
+	}
+	if got, want := RequestSize("system", messages), int64(6+5+4+2+2+4); got != want {
+		t.Errorf("RequestSize() = %d, want %d", got, want)
+	}
+}
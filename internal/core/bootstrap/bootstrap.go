@@ -0,0 +1,419 @@
+// Package bootstrap gathers the workspace context of a new task, so the AI knows the project
+// without exploring it first: a summary of the file tree honoring the ignore rules, the
+// languages and frameworks, the git branch and recent commits, and an excerpt of the README.
+// The context is lightweight by design, the walk and the excerpt are bounded and the formatted
+// block fits in a size budget.
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/ignore"
+	"github.com/kazz187/goline/internal/gitexec"
+)
+
+// DefaultMaxBytes is the size of the workspace context when none is configured
+const DefaultMaxBytes = 8192
+
+const (
+	// maxWalkedFiles stops the walk of large workspaces, the counts are then lower bounds
+	maxWalkedFiles = 20000
+	// maxCommits is the number of recent commits listed
+	maxCommits = 5
+	// maxReadmeBytes is the size of the README excerpt before the budget applies
+	maxReadmeBytes = 2048
+	// minReadmeBytes is the smallest README excerpt worth adding
+	minReadmeBytes = 200
+)
+
+// skippedDirs are directories left out of the file tree even when they are not ignored
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// languages maps the file extensions to their language
+var languages = map[string]string{
+	".go":    "Go",
+	".rs":    "Rust",
+	".py":    "Python",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".swift": "Swift",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".scala": "Scala",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".dart":  "Dart",
+	".lua":   "Lua",
+	".sh":    "Shell",
+	".proto": "Protocol Buffers",
+	".sql":   "SQL",
+	".vue":   "Vue",
+}
+
+// markers maps the files at the root of a workspace to the tool or framework they reveal
+var markers = map[string]string{
+	"go.mod":             "Go modules",
+	"Cargo.toml":         "Cargo",
+	"package.json":       "npm",
+	"pnpm-lock.yaml":     "pnpm",
+	"yarn.lock":          "Yarn",
+	"pyproject.toml":     "pyproject",
+	"requirements.txt":   "pip",
+	"Pipfile":            "Pipenv",
+	"Gemfile":            "Bundler",
+	"pom.xml":            "Maven",
+	"build.gradle":       "Gradle",
+	"build.gradle.kts":   "Gradle",
+	"composer.json":      "Composer",
+	"Dockerfile":         "Docker",
+	"docker-compose.yml": "Docker Compose",
+	"compose.yaml":       "Docker Compose",
+	"Makefile":           "Make",
+	"buf.yaml":           "Buf",
+	"tsconfig.json":      "TypeScript compiler",
+}
+
+// dependencies maps the names found in the dependency files to the framework they reveal
+var dependencies = map[string]map[string]string{
+	"package.json": {
+		`"react"`:   "React",
+		`"next"`:    "Next.js",
+		`"vue"`:     "Vue",
+		`"svelte"`:  "Svelte",
+		`"express"`: "Express",
+		`"jest"`:    "Jest",
+		`"vitest"`:  "Vitest",
+	},
+	"requirements.txt": {"django": "Django", "flask": "Flask", "fastapi": "FastAPI", "pytest": "pytest"},
+	"pyproject.toml":   {"django": "Django", "flask": "Flask", "fastapi": "FastAPI", "pytest": "pytest"},
+	"Gemfile":          {"rails": "Rails", "rspec": "RSpec"},
+	"go.mod":           {"gin-gonic/gin": "Gin", "labstack/echo": "Echo", "gofiber/fiber": "Fiber", "connectrpc.com/connect": "Connect"},
+	"Cargo.toml":       {"tokio": "Tokio", "axum": "Axum", "actix-web": "Actix Web"},
+}
+
+// readmeNames are the names of the README files, in the order they are looked up
+var readmeNames = []string{"README.md", "README", "README.rst", "README.txt", "readme.md"}
+
+// Entry is a file or a directory at the root of the workspace
+type Entry struct {
+	// Name is the name of the file or directory
+	Name string
+	// Dir is set for the directories
+	Dir bool
+	// Files is the number of files in a directory, not ignored
+	Files int
+}
+
+// Snapshot is the workspace context of a task
+type Snapshot struct {
+	// Entries are the files and directories at the root of the workspace, directories first
+	Entries []Entry
+	// Files is the number of files of the workspace, not ignored
+	Files int
+	// Truncated is set when the workspace has more files than were walked
+	Truncated bool
+	// Languages are the languages of the files, the most used first
+	Languages []string
+	// Frameworks are the tools and frameworks revealed by the files at the root
+	Frameworks []string
+	// Branch is the current git branch, empty outside a git repository
+	Branch string
+	// Commits are the recent commits as "hash subject", the last first
+	Commits []string
+	// Readme is an excerpt of the README, empty without one
+	Readme string
+}
+
+// Gather gathers the workspace context of a working directory. The ignored files are left
+// out, and git is only asked for the branch and the commits when the directory is a repository.
+func Gather(ctx context.Context, workingDir string) (*Snapshot, error) {
+	controller := ignore.NewController(workingDir)
+	if err := controller.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to load the ignore rules: %w", err)
+	}
+
+	s := &Snapshot{}
+	if err := s.walk(workingDir, controller); err != nil {
+		return nil, err
+	}
+	s.detectFrameworks(workingDir)
+	s.readGit(ctx, workingDir)
+	s.readReadme(workingDir, controller)
+	return s, nil
+}
+
+// walk counts the files of the workspace, per directory at its root and per language
+func (s *Snapshot) walk(workingDir string, controller *ignore.Controller) error {
+	dirs := make(map[string]*Entry)
+	languageFiles := make(map[string]int)
+	err := controller.WalkAllowed(workingDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories are left out
+			if d != nil && d.IsDir() && path != workingDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == workingDir {
+			return nil
+		}
+		rel, err := filepath.Rel(workingDir, path)
+		if err != nil {
+			return nil
+		}
+		top, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			if !nested {
+				entry := &Entry{Name: top, Dir: true}
+				dirs[top] = entry
+				s.Entries = append(s.Entries, *entry)
+			}
+			return nil
+		}
+
+		if s.Files >= maxWalkedFiles {
+			s.Truncated = true
+			return filepath.SkipAll
+		}
+		s.Files++
+		if language, ok := languages[strings.ToLower(filepath.Ext(path))]; ok {
+			languageFiles[language]++
+		}
+		if nested {
+			if entry, ok := dirs[top]; ok {
+				entry.Files++
+			}
+		} else {
+			s.Entries = append(s.Entries, Entry{Name: top})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk the workspace: %w", err)
+	}
+
+	for i := range s.Entries {
+		if entry, ok := dirs[s.Entries[i].Name]; ok && s.Entries[i].Dir {
+			s.Entries[i].Files = entry.Files
+		}
+	}
+	sort.SliceStable(s.Entries, func(i, j int) bool { return s.Entries[i].Dir && !s.Entries[j].Dir })
+
+	for language := range languageFiles {
+		s.Languages = append(s.Languages, language)
+	}
+	sort.Slice(s.Languages, func(i, j int) bool {
+		a, b := s.Languages[i], s.Languages[j]
+		if languageFiles[a] != languageFiles[b] {
+			return languageFiles[a] > languageFiles[b]
+		}
+		return a < b
+	})
+	return nil
+}
+
+// detectFrameworks detects the tools and frameworks from the files at the root of the workspace
+func (s *Snapshot) detectFrameworks(workingDir string) {
+	seen := make(map[string]bool)
+	add := func(framework string) {
+		if !seen[framework] {
+			seen[framework] = true
+			s.Frameworks = append(s.Frameworks, framework)
+		}
+	}
+	for _, entry := range s.Entries {
+		if entry.Dir {
+			continue
+		}
+		if tool, ok := markers[entry.Name]; ok {
+			add(tool)
+		}
+		names, ok := dependencies[entry.Name]
+		if !ok {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(workingDir, entry.Name))
+		if err != nil {
+			continue
+		}
+		lower := strings.ToLower(string(content))
+		for name, framework := range names {
+			if strings.Contains(lower, name) {
+				add(framework)
+			}
+		}
+	}
+	sort.Strings(s.Frameworks)
+}
+
+// readGit reads the current branch and the recent commits, nothing outside a git repository
+func (s *Snapshot) readGit(ctx context.Context, workingDir string) {
+	branch, err := gitexec.Run(ctx, workingDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return
+	}
+	s.Branch = strings.TrimSpace(branch)
+	log, err := gitexec.Run(ctx, workingDir, "log", fmt.Sprintf("-%d", maxCommits), "--format=%h %s")
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(log, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			s.Commits = append(s.Commits, line)
+		}
+	}
+}
+
+// readReadme reads the beginning of the README, cut at the end of a line
+func (s *Snapshot) readReadme(workingDir string, controller *ignore.Controller) {
+	for _, name := range readmeNames {
+		path := filepath.Join(workingDir, name)
+		if !controller.ValidateAccess(path) {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		var b strings.Builder
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if b.Len()+len(line)+1 > maxReadmeBytes {
+				break
+			}
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		s.Readme = strings.TrimSpace(b.String())
+		return
+	}
+}
+
+// Format formats the workspace context as a block for the AI within maxBytes, DefaultMaxBytes
+// if zero. The file tree is shortened first, then the README excerpt is cut to the remaining budget.
+func (s *Snapshot) Format(maxBytes int) string {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	const openTag, closeTag = "<workspace_context>\n", "</workspace_context>"
+
+	var head strings.Builder
+	if len(s.Languages) > 0 {
+		fmt.Fprintf(&head, "Languages: %s\n", strings.Join(s.Languages, ", "))
+	}
+	if len(s.Frameworks) > 0 {
+		fmt.Fprintf(&head, "Frameworks and tools: %s\n", strings.Join(s.Frameworks, ", "))
+	}
+	if s.Branch != "" {
+		fmt.Fprintf(&head, "Git branch: %s\n", s.Branch)
+	}
+	if len(s.Commits) > 0 {
+		head.WriteString("Recent commits:\n")
+		for _, commit := range s.Commits {
+			fmt.Fprintf(&head, "- %s\n", commit)
+		}
+	}
+
+	budget := maxBytes - len(openTag) - len(closeTag) - head.Len()
+	var tree strings.Builder
+	if len(s.Entries) > 0 {
+		files := fmt.Sprintf("%d files", s.Files)
+		if s.Truncated {
+			files = fmt.Sprintf("more than %d files", s.Files)
+		}
+		header := fmt.Sprintf("File tree (%s, ignored files left out):\n", files)
+		if len(header) < budget {
+			tree.WriteString(header)
+			for i, entry := range s.Entries {
+				line := fmt.Sprintf("- %s\n", entry.Name)
+				if entry.Dir {
+					line = fmt.Sprintf("- %s/ (%d files)\n", entry.Name, entry.Files)
+				}
+				more := fmt.Sprintf("- ... %d more entries\n", len(s.Entries)-i)
+				if tree.Len()+len(line)+len(more) > budget {
+					tree.WriteString(more)
+					break
+				}
+				tree.WriteString(line)
+			}
+		}
+	}
+	budget -= tree.Len()
+
+	var readme string
+	if s.Readme != "" {
+		const readmeHeader, readmeCut = "README excerpt:\n", "\n..."
+		excerpt := s.Readme
+		room := budget - len(readmeHeader) - 1
+		if len(excerpt) > room {
+			excerpt = cutAtLine(excerpt, room-len(readmeCut))
+			if len(excerpt) >= minReadmeBytes {
+				excerpt += readmeCut
+			} else {
+				excerpt = ""
+			}
+		}
+		if excerpt != "" {
+			readme = readmeHeader + excerpt + "\n"
+		}
+	}
+
+	body := head.String() + tree.String() + readme
+	if body == "" {
+		return ""
+	}
+	return openTag + body + closeTag
+}
+
+// Attach appends the workspace context to the first message of a task
+func Attach(message, block string) string {
+	if block == "" {
+		return message
+	}
+	return message + "\n\n" + block
+}
+
+// cutAtLine cuts text to at most n bytes, at the end of a line when there is one
+func cutAtLine(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(text) <= n {
+		return text
+	}
+	text = strings.ToValidUTF8(text[:n], "")
+	if i := strings.LastIndexByte(text, '\n'); i > 0 {
+		return strings.TrimRight(text[:i], "\n")
+	}
+	return text
+}
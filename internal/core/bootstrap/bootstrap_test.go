@@ -0,0 +1,136 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":               "module example.com/app\n\nrequire github.com/gin-gonic/gin v1.10.0\n",
+		"main.go":              "package main\n",
+		"README.md":            "# App\n\nAn example application.\n",
+		".golineignore":        "secret/\n",
+		"cmd/app/main.go":      "package main\n",
+		"cmd/app/main_test.go": "package main\n",
+		"web/index.ts":         "export {}\n",
+		"secret/key.go":        "package secret\n",
+		"node_modules/x/x.js":  "",
+		".env":                 "TOKEN=x\n",
+	})
+
+	s, err := Gather(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	wantEntries := []Entry{
+		{Name: "cmd", Dir: true, Files: 2},
+		{Name: "web", Dir: true, Files: 1},
+		{Name: "README.md"},
+		{Name: "go.mod"},
+		{Name: "main.go"},
+	}
+	if !reflect.DeepEqual(s.Entries, wantEntries) {
+		t.Errorf("Entries = %+v, want %+v", s.Entries, wantEntries)
+	}
+	if s.Files != 6 {
+		t.Errorf("Files = %d, want 6", s.Files)
+	}
+	if want := []string{"Go", "TypeScript"}; !reflect.DeepEqual(s.Languages, want) {
+		t.Errorf("Languages = %v, want %v", s.Languages, want)
+	}
+	if want := []string{"Gin", "Go modules"}; !reflect.DeepEqual(s.Frameworks, want) {
+		t.Errorf("Frameworks = %v, want %v", s.Frameworks, want)
+	}
+	if s.Readme != "# App\n\nAn example application." {
+		t.Errorf("Readme = %q", s.Readme)
+	}
+	if s.Branch != "" || len(s.Commits) != 0 {
+		t.Errorf("Branch, Commits = %q, %v outside a git repository", s.Branch, s.Commits)
+	}
+}
+
+func TestGatherGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+
+	s, err := Gather(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if s.Branch != "main" || len(s.Commits) != 1 || !strings.HasSuffix(s.Commits[0], " Initial commit") {
+		t.Errorf("Branch, Commits = %q, %v", s.Branch, s.Commits)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := &Snapshot{
+		Files:      3,
+		Languages:  []string{"Go"},
+		Frameworks: []string{"Go modules"},
+		Branch:     "main",
+		Commits:    []string{"abc1234 Add the parser"},
+		Readme:     strings.Repeat("A line of the README.\n", 50),
+	}
+	for i := 0; i < 100; i++ {
+		s.Entries = append(s.Entries, Entry{Name: strings.Repeat("d", 20), Dir: true, Files: i})
+	}
+
+	full := s.Format(1 << 20)
+	for _, want := range []string{"<workspace_context>\n", "Languages: Go\n", "Frameworks and tools: Go modules\n", "Git branch: main\n", "- abc1234 Add the parser\n", "File tree (3 files, ignored files left out):\n", "README excerpt:\n", "</workspace_context>"} {
+		if !strings.Contains(full, want) {
+			t.Errorf("Format() does not contain %q:\n%s", want, full)
+		}
+	}
+	if strings.Contains(full, "more entries") {
+		t.Errorf("Format() shortened the file tree within a large budget:\n%s", full)
+	}
+
+	small := s.Format(1024)
+	if len(small) > 1024 {
+		t.Errorf("len(Format(1024)) = %d", len(small))
+	}
+	if !strings.Contains(small, "more entries\n") || !strings.Contains(small, "Git branch: main\n") {
+		t.Errorf("Format(1024) did not shorten the file tree:\n%s", small)
+	}
+
+	if got := (&Snapshot{}).Format(0); got != "" {
+		t.Errorf("Format() of an empty snapshot = %q", got)
+	}
+	if got := Attach("Fix the bug", ""); got != "Fix the bug" {
+		t.Errorf("Attach() without context = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CopyCheckpoints copies the shadow repositories of a task to a new task, so a task branched
+// from it can restore and diff its checkpoints. A task without checkpoints copies nothing.
+func CopyCheckpoints(fromTaskID, toTaskID string) error {
+	from, err := (&Manager{taskID: fromTaskID}).getCheckpointsRoot()
+	if err != nil {
+		return err
+	}
+	to, err := (&Manager{taskID: toTaskID}).getCheckpointsRoot()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create task directory: %w", err)
+	}
+	if err := os.CopyFS(to, os.DirFS(from)); err != nil {
+		return fmt.Errorf("failed to copy the checkpoints of task %s: %w", fromTaskID, err)
+	}
+	return nil
+}
+
+// Checkpoint returns the checkpoint of a full or abbreviated ID
+func (m *Manager) Checkpoint(id string) (CheckpointInfo, error) {
+	commit, err := m.resolveCommit(id)
+	if err != nil {
+		return CheckpointInfo{}, err
+	}
+	message := strings.TrimSpace(strings.SplitN(commit.Message, "\n", 2)[0])
+	return CheckpointInfo{
+		ID:        commit.Hash.String(),
+		Name:      strings.TrimPrefix(message, "checkpoint: "),
+		Timestamp: time.Unix(commit.Author.When.Unix(), 0),
+	}, nil
+}
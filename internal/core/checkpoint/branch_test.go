@@ -0,0 +1,58 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCopyCheckpoints tests that a branched task restores the checkpoints of its original task
+// without changing them
+func TestCopyCheckpoints(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	file := filepath.Join(workingDir, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	original := newTestManager(t, "task-original", workingDir)
+	first, err := original.CreateCheckpoint("First", "")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := original.CreateCheckpoint("Second", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	if err := CopyCheckpoints("task-original", "task-branch"); err != nil {
+		t.Fatalf("CopyCheckpoints() error = %v", err)
+	}
+	branch := newTestManager(t, "task-branch", workingDir)
+	info, err := branch.Checkpoint(first[:8])
+	if err != nil || info.ID != first || info.Name != "First" {
+		t.Fatalf("Checkpoint(%s) = %+v, %v", first[:8], info, err)
+	}
+	if err := branch.RestoreCheckpoint(info.ID); err != nil {
+		t.Fatalf("RestoreCheckpoint() error = %v", err)
+	}
+	if content, _ := os.ReadFile(file); string(content) != "package main\n" {
+		t.Errorf("Restored content = %q", content)
+	}
+
+	// The branch only lists the checkpoints up to the one it was restored to, the original all of them
+	if checkpoints, err := branch.GetCheckpoints(); err != nil || len(checkpoints) != 1 {
+		t.Errorf("Checkpoints of the branch = %v, %v", checkpoints, err)
+	}
+	if checkpoints, err := original.GetCheckpoints(); err != nil || len(checkpoints) != 2 {
+		t.Errorf("Checkpoints of the original task = %v, %v", checkpoints, err)
+	}
+
+	// A task without checkpoints copies nothing
+	if err := CopyCheckpoints("task-missing", "task-other"); err != nil {
+		t.Errorf("CopyCheckpoints() of a task without checkpoints error = %v", err)
+	}
+}
@@ -1,27 +1,153 @@
 package checkpoint
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/kazz187/goline/internal/core/ignore"
+	"github.com/kazz187/goline/internal/core/tasklock"
 	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
 )
 
-// Manager handles checkpoint operations for a task
+// Identity used for checkpoint commits
+const (
+	checkpointAuthorName  = "Goline Checkpoint"
+	checkpointAuthorEmail = "checkpoint@goline.bot"
+)
+
+// defaultExcludes are the patterns that are never stored in checkpoints
+var defaultExcludes = []string{
+	// Git directories
+	".git/",
+	".git_disabled/",
+
+	// Build and dependency directories
+	"node_modules/",
+	"__pycache__/",
+	"env/",
+	"venv/",
+	"target/dependency/",
+	"build/dependencies/",
+	"dist/",
+	"out/",
+	"bundle/",
+	"vendor/",
+	"tmp/",
+	"temp/",
+	"deps/",
+	"pkg/",
+	"Pods/",
+
+	// Media files
+	"*.jpg",
+	"*.jpeg",
+	"*.png",
+	"*.gif",
+	"*.bmp",
+	"*.ico",
+	"*.mp3",
+	"*.mp4",
+	"*.wav",
+	"*.avi",
+	"*.mov",
+	"*.wmv",
+	"*.webm",
+	"*.webp",
+	"*.m4a",
+	"*.flac",
+
+	// Build and dependency directories
+	"build/",
+	"bin/",
+	"obj/",
+	".gradle/",
+	".idea/",
+	".vscode/",
+	".vs/",
+	"coverage/",
+	".next/",
+	".nuxt/",
+
+	// Cache and temporary files
+	"*.cache",
+	"*.tmp",
+	"*.temp",
+	"*.swp",
+	"*.swo",
+	"*.pyc",
+	"*.pyo",
+	".pytest_cache/",
+	".eslintcache",
+
+	// Environment and config files
+	".env*",
+	"*.local",
+	"*.development",
+	"*.production",
+
+	// Large data files
+	"*.zip",
+	"*.tar",
+	"*.gz",
+	"*.rar",
+	"*.7z",
+	"*.iso",
+	"*.bin",
+	"*.exe",
+	"*.dll",
+	"*.so",
+	"*.dylib",
+
+	// Database files
+	"*.sqlite",
+	"*.db",
+	"*.sql",
+
+	// Log files
+	"*.logs",
+	"*.error",
+	"npm-debug.log*",
+	"yarn-debug.log*",
+	"yarn-error.log*",
+
+	// System files
+	".DS_Store",
+}
+
+// Manager handles checkpoint operations for a task.
+// Checkpoints are stored in a shadow git repository whose worktree is the
+// task's working directory. The repository is managed with go-git, so no git
+// binary is required.
 type Manager struct {
 	taskID           string
 	workingDir       string
 	ignoreController *ignore.Controller
 	shadowGitPath    string
+	repo             *git.Repository
+	excludes         []string
+	lock             *tasklock.Lock
+
+	// State of the last written file snapshot, used to skip unchanged files
+	maxSnapshotFileSize int64
+	lastSnapshotID      string
+	lastSnapshot        map[string]snapshotEntry
+	// lastSnapshotTime is when the last written file snapshot started reading the files
+	lastSnapshotTime time.Time
 }
 
 // NewManager creates a new checkpoint manager for a task
@@ -32,18 +158,32 @@ func NewManager(taskID, workingDir string) (*Manager, error) {
 	}
 
 	return &Manager{
-		taskID:           taskID,
-		workingDir:       workingDir,
-		ignoreController: ignoreController,
+		taskID:              taskID,
+		workingDir:          workingDir,
+		ignoreController:    ignoreController,
+		maxSnapshotFileSize: DefaultMaxSnapshotFileSize,
 	}, nil
 }
 
+// SetLock sets the task lock checked before every write.
+// Without a lock, writes are not checked.
+func (m *Manager) SetLock(lock *tasklock.Lock) {
+	m.lock = lock
+}
+
+// readOnly reports whether the task is open read-only
+func (m *Manager) readOnly() bool {
+	return m.lock != nil && m.lock.IsReadOnly()
+}
+
 // Initialize initializes the checkpoint manager
 func (m *Manager) Initialize() error {
-	// Check if git is installed
-	if err := m.checkGitInstalled(); err != nil {
+	// Collect exclude patterns
+	lfsPatterns, err := m.getLFSPatterns()
+	if err != nil {
 		return err
 	}
+	m.excludes = append(append([]string{}, defaultExcludes...), lfsPatterns...)
 
 	// Initialize shadow git repository
 	gitPath, err := m.initShadowGit()
@@ -55,33 +195,47 @@ func (m *Manager) Initialize() error {
 	return nil
 }
 
-// checkGitInstalled checks if git is installed on the system
-func (m *Manager) checkGitInstalled() error {
-	cmd := exec.Command("git", "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git must be installed to use checkpoints: %w", err)
-	}
-	return nil
-}
-
-// getShadowGitPath returns the path to the shadow git repository
+// getShadowGitPath returns the path to the shadow git repository of the working directory.
+// Shadow repositories created by older versions, and those of workspaces that were moved,
+// are migrated to the key of the working directory.
 func (m *Manager) getShadowGitPath() (string, error) {
-	// Get the goline data directory
-	homeDir, err := os.UserHomeDir()
+	root, err := m.getCheckpointsRoot()
 	if err != nil {
-		return "", fmt.Errorf("failed to get user home directory: %w", err)
+		return "", err
+	}
+
+	// Use .goline/tasks/[taskID]/checkpoints/[workspaceKey]/.git
+	checkpointsDir := filepath.Join(root, workspaceKey(m.workingDir))
+	gitPath := filepath.Join(checkpointsDir, ".git")
+	if m.readOnly() {
+		// Another process holds the task, its repositories must not be moved
+		if _, err := os.Stat(gitPath); err != nil {
+			return "", fmt.Errorf("no checkpoints for this workspace: %w", tasklock.ErrReadOnly)
+		}
+		return gitPath, nil
+	}
+
+	if err := migrateLegacyShadowGit(root); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(gitPath); errors.Is(err, os.ErrNotExist) {
+		if _, err := m.adoptMovedWorkspace(root, checkpointsDir); err != nil {
+			return "", err
+		}
 	}
 
-	// Use .goline/tasks/[taskID]/checkpoints/.git
-	checkpointsDir := filepath.Join(homeDir, ".goline", "tasks", m.taskID, "checkpoints")
 	if err := os.MkdirAll(checkpointsDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create checkpoints directory: %w", err)
 	}
-
-	gitPath := filepath.Join(checkpointsDir, ".git")
 	return gitPath, nil
 }
 
+// openShadowRepo opens the shadow git repository at gitPath with the working directory as worktree
+func (m *Manager) openShadowRepo(gitPath string) (*git.Repository, error) {
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	return git.Open(storage, osfs.New(m.workingDir))
+}
+
 // initShadowGit initializes the shadow git repository
 func (m *Manager) initShadowGit() (string, error) {
 	gitPath, err := m.getShadowGitPath()
@@ -91,43 +245,61 @@ func (m *Manager) initShadowGit() (string, error) {
 
 	// Check if git repository already exists
 	if _, err := os.Stat(gitPath); err == nil {
-		// Verify worktree configuration
+		repo, err := m.openShadowRepo(gitPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to open git repository: %w", err)
+		}
+		m.repo = repo
+
+		// The key matches, but the path may be spelled differently (trailing slash, relative path)
 		worktree, err := m.getShadowGitConfigWorkTree()
 		if err != nil {
 			return "", err
 		}
-		if worktree != m.workingDir {
-			return "", fmt.Errorf("checkpoints can only be used in the original workspace: %s", worktree)
+		if worktree != m.workingDir && !m.readOnly() {
+			if err := writeWorktreeConfig(gitPath, m.workingDir); err != nil {
+				return "", err
+			}
+			if m.repo, err = m.openShadowRepo(gitPath); err != nil {
+				return "", fmt.Errorf("failed to open git repository: %w", err)
+			}
+		}
+		// Repositories created before the project was recorded record it now, so they can
+		// follow the workspace once it is moved
+		if !m.readOnly() {
+			if err := m.recordProjectRoot(gitPath); err != nil {
+				return "", err
+			}
 		}
 		return gitPath, nil
 	}
 
-	// Initialize new git repository
-	checkpointsDir := filepath.Dir(gitPath)
-	cmd := exec.Command("git", "init")
-	cmd.Dir = checkpointsDir
-	if err := cmd.Run(); err != nil {
+	// Initialize new git repository.
+	// The repository is created bare and the worktree is attached afterwards,
+	// because go-git would otherwise write a .git file into the workspace.
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	repo, err := git.Init(storage, nil)
+	if err != nil {
 		return "", fmt.Errorf("failed to initialize git repository: %w", err)
 	}
 
 	// Configure git repository
-	configs := []struct {
-		key, value string
-	}{
-		{"core.worktree", m.workingDir},
-		{"commit.gpgSign", "false"},
-		{"user.name", "Goline Checkpoint"},
-		{"user.email", "checkpoint@goline.bot"},
-		{"core.quotePath", "false"},
-		{"core.precomposeunicode", "true"},
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to configure git repository: %w", err)
 	}
-
-	for _, config := range configs {
-		cmd := exec.Command("git", "config", config.key, config.value)
-		cmd.Dir = checkpointsDir
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to configure git repository: %w", err)
-		}
+	cfg.Core.IsBare = false
+	cfg.Core.Worktree = m.workingDir
+	cfg.User.Name = checkpointAuthorName
+	cfg.User.Email = checkpointAuthorEmail
+	cfg.Raw.Section("commit").SetOption("gpgSign", "false")
+	cfg.Raw.Section("core").SetOption("quotePath", "false")
+	cfg.Raw.Section("core").SetOption("precomposeunicode", "true")
+	if project := projectRoot(m.workingDir); project != "" {
+		cfg.Raw.Section(projectRootSection).SetOption(projectRootOption, project)
+	}
+	if err := repo.SetConfig(cfg); err != nil {
+		return "", fmt.Errorf("failed to configure git repository: %w", err)
 	}
 
 	// Set up excludes
@@ -135,34 +307,48 @@ func (m *Manager) initShadowGit() (string, error) {
 		return "", err
 	}
 
+	// Reopen with the working directory attached
+	m.repo, err = m.openShadowRepo(gitPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open git repository: %w", err)
+	}
+
 	// Initial commit
-	cmd = exec.Command("git", "commit", "--allow-empty", "-m", "initial commit")
-	cmd.Dir = checkpointsDir
-	if err := cmd.Run(); err != nil {
+	if _, err := m.commit("initial commit"); err != nil {
 		return "", fmt.Errorf("failed to create initial commit: %w", err)
 	}
 
 	return gitPath, nil
 }
 
-// getShadowGitConfigWorkTree returns the worktree path from the shadow git configuration
-func (m *Manager) getShadowGitConfigWorkTree() (string, error) {
-	gitPath, err := m.getShadowGitPath()
-	if err != nil {
-		return "", err
+// recordProjectRoot records the project root commit of the working directory in the shadow
+// repository at gitPath, unless it is recorded already or the working directory is not in a
+// git repository
+func (m *Manager) recordProjectRoot(gitPath string) error {
+	recorded, err := readProjectRootConfig(gitPath)
+	if err != nil || recorded != "" {
+		return err
 	}
+	project := projectRoot(m.workingDir)
+	if project == "" {
+		return nil
+	}
+	return writeProjectRootConfig(gitPath, project)
+}
 
-	cmd := exec.Command("git", "config", "core.worktree")
-	cmd.Dir = filepath.Dir(gitPath)
-	output, err := cmd.Output()
+// getShadowGitConfigWorkTree returns the worktree path from the shadow git configuration
+func (m *Manager) getShadowGitConfigWorkTree() (string, error) {
+	cfg, err := m.repo.Config()
 	if err != nil {
 		return "", fmt.Errorf("failed to get worktree configuration: %w", err)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return strings.TrimSpace(cfg.Core.Worktree), nil
 }
 
-// writeExcludesFile writes the excludes file for the shadow git repository
+// writeExcludesFile writes the excludes file for the shadow git repository.
+// The file is not used by go-git itself but keeps the shadow repository
+// consistent when inspected with the git command line.
 func (m *Manager) writeExcludesFile(gitPath string) error {
 	excludesDir := filepath.Join(gitPath, "info")
 	if err := os.MkdirAll(excludesDir, 0755); err != nil {
@@ -170,112 +356,7 @@ func (m *Manager) writeExcludesFile(gitPath string) error {
 	}
 
 	excludesPath := filepath.Join(excludesDir, "exclude")
-	excludes := []string{
-		// Git directories
-		".git/",
-		".git_disabled/",
-
-		// Build and dependency directories
-		"node_modules/",
-		"__pycache__/",
-		"env/",
-		"venv/",
-		"target/dependency/",
-		"build/dependencies/",
-		"dist/",
-		"out/",
-		"bundle/",
-		"vendor/",
-		"tmp/",
-		"temp/",
-		"deps/",
-		"pkg/",
-		"Pods/",
-
-		// Media files
-		"*.jpg",
-		"*.jpeg",
-		"*.png",
-		"*.gif",
-		"*.bmp",
-		"*.ico",
-		"*.mp3",
-		"*.mp4",
-		"*.wav",
-		"*.avi",
-		"*.mov",
-		"*.wmv",
-		"*.webm",
-		"*.webp",
-		"*.m4a",
-		"*.flac",
-
-		// Build and dependency directories
-		"build/",
-		"bin/",
-		"obj/",
-		".gradle/",
-		".idea/",
-		".vscode/",
-		".vs/",
-		"coverage/",
-		".next/",
-		".nuxt/",
-
-		// Cache and temporary files
-		"*.cache",
-		"*.tmp",
-		"*.temp",
-		"*.swp",
-		"*.swo",
-		"*.pyc",
-		"*.pyo",
-		".pytest_cache/",
-		".eslintcache",
-
-		// Environment and config files
-		".env*",
-		"*.local",
-		"*.development",
-		"*.production",
-
-		// Large data files
-		"*.zip",
-		"*.tar",
-		"*.gz",
-		"*.rar",
-		"*.7z",
-		"*.iso",
-		"*.bin",
-		"*.exe",
-		"*.dll",
-		"*.so",
-		"*.dylib",
-
-		// Database files
-		"*.sqlite",
-		"*.db",
-		"*.sql",
-
-		// Log files
-		"*.logs",
-		"*.error",
-		"npm-debug.log*",
-		"yarn-debug.log*",
-		"yarn-error.log*",
-
-		// System files
-		".DS_Store",
-	}
-
-	// Add LFS patterns from .gitattributes if it exists
-	lfsPatterns, err := m.getLFSPatterns()
-	if err != nil {
-		return err
-	}
-	excludes = append(excludes, lfsPatterns...)
-
-	return os.WriteFile(excludesPath, []byte(strings.Join(excludes, "\n")), 0644)
+	return os.WriteFile(excludesPath, []byte(strings.Join(m.excludes, "\n")), 0644)
 }
 
 // getLFSPatterns returns LFS patterns from .gitattributes
@@ -303,350 +384,673 @@ func (m *Manager) getLFSPatterns() ([]string, error) {
 	return patterns, nil
 }
 
-// renameNestedGitRepos renames nested .git directories to avoid conflicts
-func (m *Manager) renameNestedGitRepos(disable bool) error {
-	suffix := "_disabled"
+// excludeMatcher returns a matcher for the checkpoint excludes and the workspace's .gitignore files
+func (m *Manager) excludeMatcher() gitignore.Matcher {
+	var patterns []gitignore.Pattern
+	for _, exclude := range m.excludes {
+		patterns = append(patterns, gitignore.ParsePattern(exclude, nil))
+	}
+
+	workspacePatterns, err := gitignore.ReadPatterns(osfs.New(m.workingDir), nil)
+	if err == nil {
+		patterns = append(patterns, workspacePatterns...)
+	}
+
+	return gitignore.NewMatcher(patterns)
+}
+
+// walkWorktree calls fn for every file in the working directory that is tracked by checkpoints.
+// Excluded directories are pruned instead of being traversed.
+func (m *Manager) walkWorktree(fn func(relPath, absPath string, info fs.FileInfo) error) error {
+	matcher := m.excludeMatcher()
 
-	var gitPaths []string
-	err := filepath.WalkDir(m.workingDir, func(path string, d fs.DirEntry, err error) error {
+	return filepath.WalkDir(m.workingDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".git"+suffix) {
-			// Skip the root .git directory
-			if filepath.Dir(path) == m.workingDir {
+		if path == m.workingDir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(m.workingDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		parts := strings.Split(relPath, "/")
+
+		if d.IsDir() {
+			// Nested repositories are stored as plain files, their .git directories never are
+			if d.Name() == ".git" || matcher.Match(parts, true) {
 				return filepath.SkipDir
 			}
-			gitPaths = append(gitPaths, path)
+			return nil
 		}
-		return nil
+		if matcher.Match(parts, false) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Skip sockets, devices and other special files
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		return fn(relPath, path, info)
 	})
+}
+
+// Captures reports whether checkpoints capture a file of the working directory, given by its
+// path relative to it. Files matching the checkpoint excludes or the workspace's .gitignore
+// files, and those in a .git directory, are not captured.
+func (m *Manager) Captures(relPath string) bool {
+	matcher := m.excludeMatcher()
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for i := 1; i < len(parts); i++ {
+		if parts[i-1] == ".git" || matcher.Match(parts[:i], true) {
+			return false
+		}
+	}
+	return !matcher.Match(parts, false)
+}
+
+// readWorktreeFile reads a file from the working directory, returning the link target for symlinks
+func readWorktreeFile(absPath string, info fs.FileInfo) ([]byte, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(target), nil
+	}
+	return os.ReadFile(absPath)
+}
+
+// writeBlob stores content as a blob object in the shadow repository
+func (m *Manager) writeBlob(content []byte) (plumbing.Hash, error) {
+	obj := m.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	w, err := obj.Writer()
 	if err != nil {
-		return err
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
 	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return m.repo.Storer.SetEncodedObject(obj)
+}
 
-	for _, gitPath := range gitPaths {
-		var newPath string
-		if disable {
-			newPath = gitPath + suffix
-		} else {
-			newPath = strings.TrimSuffix(gitPath, suffix)
+// addAllFiles stages the whole working directory in the shadow repository index.
+// Files whose size and modification time are unchanged since the last checkpoint
+// reuse the stored blob, so only modified files are read. As in git, files modified
+// no earlier than the index was written are read again: they may have changed
+// within the resolution of the modification time after they were staged.
+func (m *Manager) addAllFiles() error {
+	idx, err := m.repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	// Without the time the index was written, no entry can be trusted
+	var indexWritten time.Time
+	if info, err := os.Stat(filepath.Join(m.shadowGitPath, "index")); err == nil {
+		indexWritten = info.ModTime()
+	}
+
+	previous := make(map[string]*index.Entry, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		previous[entry.Name] = entry
+	}
+
+	newIdx := &index.Index{Version: 2}
+	err = m.walkWorktree(func(relPath, absPath string, info fs.FileInfo) error {
+		mode, err := filemode.NewFromOSFileMode(info.Mode())
+		if err != nil {
+			return err
+		}
+
+		if entry, ok := previous[relPath]; ok && entry.Mode == mode &&
+			entry.Size == uint32(info.Size()) && entry.ModifiedAt.Equal(info.ModTime()) &&
+			entry.ModifiedAt.Before(indexWritten) {
+			newIdx.Entries = append(newIdx.Entries, entry)
+			return nil
 		}
 
-		if err := os.Rename(gitPath, newPath); err != nil {
+		content, err := readWorktreeFile(absPath, info)
+		if err != nil {
 			return err
 		}
+		hash, err := m.writeBlob(content)
+		if err != nil {
+			return err
+		}
+
+		newIdx.Entries = append(newIdx.Entries, &index.Entry{
+			Hash:       hash,
+			Name:       relPath,
+			ModifiedAt: info.ModTime(),
+			Mode:       mode,
+			Size:       uint32(info.Size()),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add files to git: %w", err)
 	}
 
-	return nil
+	sort.Slice(newIdx.Entries, func(i, j int) bool {
+		return newIdx.Entries[i].Name < newIdx.Entries[j].Name
+	})
+
+	return m.repo.Storer.SetIndex(newIdx)
 }
 
-// addAllFiles adds all files to the shadow git repository
-func (m *Manager) addAllFiles() error {
-	// Disable nested git repositories
-	if err := m.renameNestedGitRepos(true); err != nil {
-		return err
+// commit records the current index as a new commit
+func (m *Manager) commit(message string) (plumbing.Hash, error) {
+	worktree, err := m.repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
 	}
-	defer m.renameNestedGitRepos(false)
 
-	// Add all files
-	cmd := exec.Command("git", "add", ".")
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add files to git: %w", err)
+	return worktree.Commit(message, &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author: &object.Signature{
+			Name:  checkpointAuthorName,
+			Email: checkpointAuthorEmail,
+			When:  time.Now(),
+		},
+	})
+}
+
+// resolveCommit resolves a full or abbreviated checkpoint ID to a commit
+func (m *Manager) resolveCommit(id string) (*object.Commit, error) {
+	hash, err := m.repo.ResolveRevision(plumbing.Revision(id))
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint not found: %s: %w", id, err)
 	}
 
-	return nil
+	commit, err := m.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint not found: %s: %w", id, err)
+	}
+
+	return commit, nil
 }
 
 // CreateCheckpoint creates a new checkpoint
 func (m *Manager) CreateCheckpoint(name, description string) (string, error) {
+	if err := m.lock.Validate(); err != nil {
+		return "", err
+	}
+
 	// Add all files to git
 	if err := m.addAllFiles(); err != nil {
 		return "", err
 	}
 
 	// Create commit
-	cmd := exec.Command("git", "commit", "--allow-empty", "-m", fmt.Sprintf("checkpoint: %s", name))
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	if err := cmd.Run(); err != nil {
+	hash, err := m.commit(fmt.Sprintf("checkpoint: %s", name))
+	if err != nil {
 		return "", fmt.Errorf("failed to create checkpoint: %w", err)
 	}
 
-	// Get commit hash
-	cmd = exec.Command("git", "rev-parse", "HEAD")
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	output, err := cmd.Output()
+	return hash.String(), nil
+}
+
+// RestoreCheckpoint restores a checkpoint.
+// Files that are not part of the checkpoint are removed and checkpointed files
+// are rewritten, while excluded files (dependencies, secrets, ...) are left alone.
+func (m *Manager) RestoreCheckpoint(commitHash string) error {
+	if err := m.lock.Validate(); err != nil {
+		return err
+	}
+
+	commit, err := m.resolveCommit(commitHash)
 	if err != nil {
-		return "", fmt.Errorf("failed to get commit hash: %w", err)
+		return err
 	}
 
-	commitHash := strings.TrimSpace(string(output))
-	return commitHash, nil
-}
+	// Collect the files stored in the checkpoint
+	files, err := checkpointFiles(commit)
+	if err != nil {
+		return err
+	}
 
-// RestoreCheckpoint restores a checkpoint
-func (m *Manager) RestoreCheckpoint(commitHash string) error {
-	// Clean working directory and force reset
-	cmd := exec.Command("git", "clean", "-f", "-d")
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	if err := cmd.Run(); err != nil {
+	// Clean working directory
+	var removedDirs []string
+	err = m.walkWorktree(func(relPath, absPath string, info fs.FileInfo) error {
+		if _, ok := files[relPath]; ok {
+			return nil
+		}
+		if err := os.Remove(absPath); err != nil {
+			return err
+		}
+		removedDirs = append(removedDirs, filepath.Dir(absPath))
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to clean working directory: %w", err)
 	}
+	m.removeEmptyDirs(removedDirs)
 
-	// Reset to commit
-	cmd = exec.Command("git", "reset", "--hard", commitHash)
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	if err := cmd.Run(); err != nil {
+	// Write checkpoint content
+	for _, f := range files {
+		if err := m.checkoutFile(f); err != nil {
+			return fmt.Errorf("failed to reset to checkpoint: %w", err)
+		}
+	}
+
+	// Move the shadow repository to the checkpoint
+	worktree, err := m.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: commit.Hash, Mode: git.MixedReset}); err != nil {
 		return fmt.Errorf("failed to reset to checkpoint: %w", err)
 	}
 
 	return nil
 }
 
+// RestoreFiles restores only the given paths from a checkpoint, leaving other working tree changes intact.
+// A path can name a file or a directory. Files under the path that did not exist in the
+// checkpoint are removed. The shadow repository itself is not moved to the checkpoint.
+func (m *Manager) RestoreFiles(commitHash string, paths []string) error {
+	if err := m.lock.Validate(); err != nil {
+		return err
+	}
+
+	commit, err := m.resolveCommit(commitHash)
+	if err != nil {
+		return err
+	}
+
+	// Collect the files stored in the checkpoint
+	files, err := checkpointFiles(commit)
+	if err != nil {
+		return err
+	}
+
+	// Normalize the paths
+	prefixes := make([]string, 0, len(paths))
+	for _, path := range paths {
+		relPath, err := m.relativePath(path)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, relPath)
+	}
+	matches := func(relPath string) bool {
+		for _, prefix := range prefixes {
+			if prefix == "." || relPath == prefix || strings.HasPrefix(relPath, prefix+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Remove files that did not exist in the checkpoint
+	matched := false
+	var removedDirs []string
+	err = m.walkWorktree(func(relPath, absPath string, info fs.FileInfo) error {
+		if !matches(relPath) {
+			return nil
+		}
+		matched = true
+		if _, ok := files[relPath]; ok {
+			return nil
+		}
+		if err := os.Remove(absPath); err != nil {
+			return err
+		}
+		removedDirs = append(removedDirs, filepath.Dir(absPath))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clean working directory: %w", err)
+	}
+	m.removeEmptyDirs(removedDirs)
+
+	// Write checkpoint content
+	for name, f := range files {
+		if !matches(name) {
+			continue
+		}
+		matched = true
+		if err := m.checkoutFile(f); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("no files match %s in checkpoint %s", strings.Join(paths, ", "), commitHash)
+	}
+
+	return nil
+}
+
+// relativePath converts a path to a slash separated path relative to the working directory
+func (m *Manager) relativePath(path string) (string, error) {
+	absPath := path
+	if !filepath.IsAbs(path) {
+		absPath = filepath.Join(m.workingDir, path)
+	}
+
+	relPath, err := filepath.Rel(m.workingDir, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path is outside the workspace: %s", path)
+	}
+
+	return filepath.ToSlash(relPath), nil
+}
+
+// checkpointFiles returns the files stored in a checkpoint by path
+func checkpointFiles(commit *object.Commit) (map[string]*object.File, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint tree: %w", err)
+	}
+
+	files := make(map[string]*object.File)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = f
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint files: %w", err)
+	}
+
+	return files, nil
+}
+
+// checkoutFile writes a checkpointed file to the working directory unless it is already up to date
+func (m *Manager) checkoutFile(f *object.File) error {
+	absPath := filepath.Join(m.workingDir, filepath.FromSlash(f.Name))
+
+	if info, err := os.Lstat(absPath); err == nil {
+		current, err := readWorktreeFile(absPath, info)
+		if err == nil && plumbing.ComputeHash(plumbing.BlobObject, current) == f.Hash {
+			return nil
+		}
+	}
+
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if mode&os.ModeSymlink != 0 {
+		return os.Symlink(content, absPath)
+	}
+	return os.WriteFile(absPath, []byte(content), mode.Perm())
+}
+
+// removeEmptyDirs removes the given directories and their parents inside the workspace if they became empty
+func (m *Manager) removeEmptyDirs(dirs []string) {
+	// Deepest directories first
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+	for _, dir := range dirs {
+		for dir != m.workingDir && strings.HasPrefix(dir, m.workingDir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
 // GetDiff returns the diff between two checkpoints
 func (m *Manager) GetDiff(fromHash, toHash string) ([]FileDiff, error) {
+	fromCommit, err := m.resolveCommit(fromHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff summary: %w", err)
+	}
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff summary: %w", err)
+	}
+
 	// If toHash is empty, compare to working directory
-	diffArg := fmt.Sprintf("%s..%s", fromHash, toHash)
 	if toHash == "" {
-		diffArg = fromHash
+		return m.diffWithWorktree(fromTree)
 	}
 
-	// Get diff summary
-	cmd := exec.Command("git", "diff", "--name-only", diffArg)
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	output, err := cmd.Output()
+	toCommit, err := m.resolveCommit(toHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff summary: %w", err)
+	}
+	toTree, err := toCommit.Tree()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get diff summary: %w", err)
 	}
 
-	changedFiles := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(changedFiles) == 1 && changedFiles[0] == "" {
-		return nil, nil
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff summary: %w", err)
 	}
 
 	var diffs []FileDiff
-	for _, file := range changedFiles {
-		// Skip empty lines
-		if file == "" {
-			continue
+	for _, change := range changes {
+		from, to, err := change.Files()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get diff: %w", err)
 		}
 
-		// Get file content before
-		var beforeContent string
-		beforeCmd := exec.Command("git", "show", fmt.Sprintf("%s:%s", fromHash, file))
-		beforeCmd.Dir = filepath.Dir(m.shadowGitPath)
-		beforeOutput, err := beforeCmd.Output()
-		if err != nil {
-			// File didn't exist in older commit
-			beforeContent = ""
-		} else {
-			beforeContent = string(beforeOutput)
-		}
-
-		// Get file content after
-		var afterContent string
-		if toHash == "" {
-			// Read from disk
-			afterPath := filepath.Join(m.workingDir, file)
-			afterBytes, err := os.ReadFile(afterPath)
-			if err != nil {
-				// File might be deleted
-				afterContent = ""
-			} else {
-				afterContent = string(afterBytes)
+		// Get file content and mode before and after
+		var file, beforeContent, afterContent string
+		var beforeMode, afterMode filemode.FileMode
+		if from != nil {
+			file, beforeMode = from.Name, from.Mode
+			if beforeContent, err = from.Contents(); err != nil {
+				return nil, err
 			}
-		} else {
-			// Get from git
-			afterCmd := exec.Command("git", "show", fmt.Sprintf("%s:%s", toHash, file))
-			afterCmd.Dir = filepath.Dir(m.shadowGitPath)
-			afterOutput, err := afterCmd.Output()
-			if err != nil {
-				// File didn't exist in newer commit
-				afterContent = ""
-			} else {
-				afterContent = string(afterOutput)
+		}
+		if to != nil {
+			file, afterMode = to.Name, to.Mode
+			if afterContent, err = to.Contents(); err != nil {
+				return nil, err
 			}
 		}
 
-		// Create diff
-		diff := FileDiff{
+		diffs = append(diffs, FileDiff{
 			RelativePath: file,
 			AbsolutePath: filepath.Join(m.workingDir, file),
 			Before:       beforeContent,
 			After:        afterContent,
-		}
-		diffs = append(diffs, diff)
+			BeforeMode:   beforeMode,
+			AfterMode:    afterMode,
+		})
 	}
 
+	sortDiffs(diffs)
 	return diffs, nil
 }
 
-// GetCheckpoints returns all checkpoints for the task
-func (m *Manager) GetCheckpoints() ([]CheckpointInfo, error) {
-	// Get all commits
-	cmd := exec.Command("git", "log", "--pretty=format:%H|%s|%at")
-	cmd.Dir = filepath.Dir(m.shadowGitPath)
-	output, err := cmd.Output()
+// diffWithWorktree returns the diff between a checkpoint tree and the working directory
+func (m *Manager) diffWithWorktree(tree *object.Tree) ([]FileDiff, error) {
+	// Collect the files stored in the checkpoint
+	files := make(map[string]*object.File)
+	err := tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = f
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get commits: %w", err)
+		return nil, fmt.Errorf("failed to get diff summary: %w", err)
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var checkpoints []CheckpointInfo
-	for _, line := range lines {
-		parts := strings.SplitN(line, "|", 3)
-		if len(parts) != 3 {
-			continue
-		}
+	var diffs []FileDiff
+	seen := make(map[string]bool)
+	err = m.walkWorktree(func(relPath, absPath string, info fs.FileInfo) error {
+		seen[relPath] = true
 
-		hash := parts[0]
-		message := parts[1]
-		timestamp, err := strconv.ParseInt(parts[2], 10, 64)
+		content, err := readWorktreeFile(absPath, info)
 		if err != nil {
-			continue
+			return err
+		}
+		mode, err := filemode.NewFromOSFileMode(info.Mode())
+		if err != nil {
+			return err
 		}
 
-		// Skip initial commit
-		if message == "initial commit" {
-			continue
+		f, ok := files[relPath]
+		if ok && plumbing.ComputeHash(plumbing.BlobObject, content) == f.Hash && f.Mode == mode {
+			return nil
 		}
 
-		// Extract name from message
-		name := message
-		if strings.HasPrefix(message, "checkpoint: ") {
-			name = strings.TrimPrefix(message, "checkpoint: ")
+		// File is new or modified
+		var beforeContent string
+		var beforeMode filemode.FileMode
+		if ok {
+			beforeMode = f.Mode
+			if beforeContent, err = f.Contents(); err != nil {
+				return err
+			}
 		}
+		diffs = append(diffs, FileDiff{
+			RelativePath: relPath,
+			AbsolutePath: absPath,
+			Before:       beforeContent,
+			After:        string(content),
+			BeforeMode:   beforeMode,
+			AfterMode:    mode,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %w", err)
+	}
 
-		checkpoint := CheckpointInfo{
-			ID:        hash,
-			Name:      name,
-			Timestamp: time.Unix(timestamp, 0),
+	// Files that only exist in the checkpoint were deleted
+	for name, f := range files {
+		if seen[name] {
+			continue
 		}
-		checkpoints = append(checkpoints, checkpoint)
+		beforeContent, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, FileDiff{
+			RelativePath: name,
+			AbsolutePath: filepath.Join(m.workingDir, name),
+			Before:       beforeContent,
+			BeforeMode:   f.Mode,
+		})
 	}
 
-	return checkpoints, nil
+	sortDiffs(diffs)
+	return diffs, nil
 }
 
-// CreateCheckpointProto creates a checkpoint proto message
-func (m *Manager) CreateCheckpointProto(id, name, description string) (*pb.Checkpoint, error) {
-	// Get file snapshots
-	var fileSnapshots []*pb.FileSnapshot
-	err := filepath.WalkDir(m.workingDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
+// sortDiffs sorts diffs by path
+func sortDiffs(diffs []FileDiff) {
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].RelativePath < diffs[j].RelativePath
+	})
+}
 
-		// Skip files that should be ignored
-		relPath, err := filepath.Rel(m.workingDir, path)
-		if err != nil {
-			return err
-		}
-		if !m.ignoreController.ValidateAccess(relPath) {
-			return nil
-		}
+// GetCheckpoints returns all checkpoints for the task
+func (m *Manager) GetCheckpoints() ([]CheckpointInfo, error) {
+	// Get all commits
+	iter, err := m.repo.Log(&git.LogOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits: %w", err)
+	}
+	defer iter.Close()
 
-		// Read file content
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return err
+	var checkpoints []CheckpointInfo
+	err = iter.ForEach(func(c *object.Commit) error {
+		message := strings.TrimSpace(strings.SplitN(c.Message, "\n", 2)[0])
+
+		// Skip initial commit
+		if message == "initial commit" {
+			return nil
 		}
 
-		// Calculate content hash
-		hash := sha256.Sum256(content)
-		contentHash := hex.EncodeToString(hash[:])
+		// Extract name from message
+		name := strings.TrimPrefix(message, "checkpoint: ")
 
-		fileSnapshot := &pb.FileSnapshot{
-			FilePath:    relPath,
-			Content:     string(content),
-			ContentHash: contentHash,
-		}
-		fileSnapshots = append(fileSnapshots, fileSnapshot)
+		checkpoints = append(checkpoints, CheckpointInfo{
+			ID:        c.Hash.String(),
+			Name:      name,
+			Timestamp: time.Unix(c.Author.When.Unix(), 0),
+		})
 		return nil
 	})
 	if err != nil {
-		return nil, err
-	}
-
-	// Get git status
-	gitStatus, err := m.getGitStatus()
-	if err != nil {
-		// Git status is optional, so we can continue without it
-		gitStatus = nil
-	}
-
-	// Create checkpoint proto
-	checkpoint := &pb.Checkpoint{
-		Id:          id,
-		Name:        name,
-		Description: description,
-		Timestamp:   time.Now().Format(time.RFC3339),
-		Files:       fileSnapshots,
-		GitStatus:   gitStatus,
+		return nil, fmt.Errorf("failed to get commits: %w", err)
 	}
 
-	return checkpoint, nil
+	return checkpoints, nil
 }
 
 // getGitStatus returns the git status of the workspace
 func (m *Manager) getGitStatus() (*pb.GitStatus, error) {
 	// Check if workspace is a git repository
-	gitDir := filepath.Join(m.workingDir, ".git")
-	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		return nil, nil
-	}
-
-	// Get current branch
-	branchCmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	branchCmd.Dir = m.workingDir
-	branchOutput, err := branchCmd.Output()
+	repo, err := git.PlainOpen(m.workingDir)
 	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	branch := strings.TrimSpace(string(branchOutput))
 
-	// Get current commit hash
-	hashCmd := exec.Command("git", "rev-parse", "HEAD")
-	hashCmd.Dir = m.workingDir
-	hashOutput, err := hashCmd.Output()
+	// Get current branch and commit hash
+	head, err := repo.Head()
 	if err != nil {
 		return nil, err
 	}
-	commitHash := strings.TrimSpace(string(hashOutput))
+	branch := "HEAD"
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	commitHash := head.Hash().String()
 
 	// Check if there are uncommitted changes
-	statusCmd := exec.Command("git", "status", "--porcelain")
-	statusCmd.Dir = m.workingDir
-	statusOutput, err := statusCmd.Output()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
 	if err != nil {
 		return nil, err
 	}
-	hasUncommittedChanges := len(statusOutput) > 0
 
 	// Get modified files
 	var modifiedFiles []string
-	if hasUncommittedChanges {
-		lines := strings.Split(strings.TrimSpace(string(statusOutput)), "\n")
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-			// Extract file path from status line
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				modifiedFiles = append(modifiedFiles, parts[1])
-			}
+	for path, fileStatus := range status {
+		if fileStatus.Staging == git.Unmodified && fileStatus.Worktree == git.Unmodified {
+			continue
 		}
+		modifiedFiles = append(modifiedFiles, path)
 	}
+	sort.Strings(modifiedFiles)
 
 	gitStatus := &pb.GitStatus{
 		Branch:                branch,
 		CommitHash:            commitHash,
-		HasUncommittedChanges: hasUncommittedChanges,
+		HasUncommittedChanges: len(modifiedFiles) > 0,
 		ModifiedFiles:         modifiedFiles,
 	}
 
@@ -659,6 +1063,10 @@ type FileDiff struct {
 	AbsolutePath string
 	Before       string
 	After        string
+	// BeforeMode and AfterMode are the modes of the file on each side, filemode.Empty where
+	// it does not exist, so an empty file is not mistaken for a missing one
+	BeforeMode filemode.FileMode
+	AfterMode  filemode.FileMode
 }
 
 // CheckpointInfo represents information about a checkpoint
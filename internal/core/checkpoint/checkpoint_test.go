@@ -3,8 +3,11 @@ package checkpoint
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 )
 
 // Skip TestCheckpointManager for now as it requires mocking
@@ -116,6 +119,10 @@ func TestCheckpointService(t *testing.T) {
 	if err := os.WriteFile(testFilePath, []byte(modifiedContent), 0644); err != nil {
 		t.Fatalf("Failed to modify test file: %v", err)
 	}
+	// An empty file is created, not missing
+	if err := os.WriteFile(filepath.Join(tempDir, "empty.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create empty file: %v", err)
+	}
 
 	// Get diff
 	diffs, err := service.GetDiff(taskID, tempDir, checkpointID, "")
@@ -124,13 +131,19 @@ func TestCheckpointService(t *testing.T) {
 	}
 
 	// Verify diff
-	if len(diffs) != 1 {
-		t.Fatalf("Expected 1 diff, got %d", len(diffs))
+	if len(diffs) != 2 {
+		t.Fatalf("Expected 2 diffs, got %d", len(diffs))
+	}
+	if d := diffs[0]; d.RelativePath != "empty.txt" || d.BeforeMode != filemode.Empty || d.AfterMode != filemode.Regular {
+		t.Errorf("Expected empty.txt to be created, got %+v", d)
 	}
 
 	// Format diff
 	diffText := service.FormatDiff(diffs)
 	t.Logf("Diff: %s", diffText)
+	if !strings.Contains(diffText, "File: empty.txt\n  (New file)") {
+		t.Errorf("Expected empty.txt to be shown as a new file, got:\n%s", diffText)
+	}
 
 	// Get checkpoints
 	checkpoints, err := service.GetCheckpoints(taskID, tempDir)
@@ -160,3 +173,204 @@ func TestCheckpointService(t *testing.T) {
 		t.Errorf("Expected restored content %q, got %q", testContent, string(restoredContent))
 	}
 }
+
+// TestCheckpointManagerWithoutGit tests that checkpoints work without the git binary
+func TestCheckpointManagerWithoutGit(t *testing.T) {
+	// Hide the git binary and keep the shadow repository out of the real home directory
+	t.Setenv("PATH", "")
+	t.Setenv("HOME", t.TempDir())
+
+	workingDir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(workingDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	writeFile("main.go", "package main\n")
+	writeFile("node_modules/dep/index.js", "module.exports = {}\n")
+
+	manager, err := NewManager("test-task-without-git", workingDir)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint manager: %v", err)
+	}
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize checkpoint manager: %v", err)
+	}
+
+	checkpointID, err := manager.CreateCheckpoint("First", "")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	// Modify a tracked file, add a new one and touch an excluded one
+	writeFile("main.go", "package main\n\nfunc main() {}\n")
+	writeFile("sub/new.go", "package sub\n")
+	writeFile("node_modules/dep/index.js", "module.exports = { changed: true }\n")
+
+	diffs, err := manager.GetDiff(checkpointID, "")
+	if err != nil {
+		t.Fatalf("Failed to get diff: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].RelativePath != "main.go" || diffs[1].RelativePath != "sub/new.go" {
+		t.Fatalf("Unexpected diffs: %+v", diffs)
+	}
+
+	if err := manager.RestoreCheckpoint(checkpointID); err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(workingDir, "main.go"))
+	if err != nil || string(content) != "package main\n" {
+		t.Errorf("Expected main.go to be restored, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("Expected sub directory to be removed, got %v", err)
+	}
+	content, err = os.ReadFile(filepath.Join(workingDir, "node_modules/dep/index.js"))
+	if err != nil || string(content) != "module.exports = { changed: true }\n" {
+		t.Errorf("Expected excluded file to be left alone, got %q (%v)", content, err)
+	}
+
+	checkpoints, err := manager.GetCheckpoints()
+	if err != nil {
+		t.Fatalf("Failed to get checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].ID != checkpointID || checkpoints[0].Name != "First" {
+		t.Errorf("Unexpected checkpoints: %+v", checkpoints)
+	}
+}
+
+// TestRestoreFiles tests restoring only some files from a checkpoint
+func TestRestoreFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	workingDir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(workingDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	readFile := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(workingDir, name))
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+	writeFile("a.go", "a1")
+	writeFile("src/b.go", "b1")
+
+	manager, err := NewManager("test-task-restore-files", workingDir)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint manager: %v", err)
+	}
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize checkpoint manager: %v", err)
+	}
+	checkpointID, err := manager.CreateCheckpoint("First", "")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	writeFile("a.go", "a2")
+	writeFile("src/b.go", "b2")
+	writeFile("src/c.go", "c2")
+
+	// Restore a directory, including removing the file created after the checkpoint
+	if err := manager.RestoreFiles(checkpointID, []string{"./src"}); err != nil {
+		t.Fatalf("Failed to restore files: %v", err)
+	}
+	if got := readFile("src/b.go"); got != "b1" {
+		t.Errorf("Expected src/b.go to be restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "src", "c.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected src/c.go to be removed, got %v", err)
+	}
+	if got := readFile("a.go"); got != "a2" {
+		t.Errorf("Expected a.go to be left intact, got %q", got)
+	}
+
+	// Restore a single file
+	if err := manager.RestoreFiles(checkpointID, []string{"a.go"}); err != nil {
+		t.Fatalf("Failed to restore files: %v", err)
+	}
+	if got := readFile("a.go"); got != "a1" {
+		t.Errorf("Expected a.go to be restored, got %q", got)
+	}
+
+	if err := manager.RestoreFiles(checkpointID, []string{"missing.go"}); err == nil {
+		t.Error("Expected an error for a path that matches nothing")
+	}
+	if err := manager.RestoreFiles(checkpointID, []string{"../outside.go"}); err == nil {
+		t.Error("Expected an error for a path outside the workspace")
+	}
+}
+
+func TestCheckpointRereadsRacyFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	workingDir := t.TempDir()
+	path := filepath.Join(workingDir, "a.go")
+	// The two versions of the file have the same size and modification time, as when it is
+	// modified again within the resolution of the modification time
+	modTime := time.Now().Add(time.Hour)
+	writeFile := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write a.go: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set the modification time of a.go: %v", err)
+		}
+	}
+	writeFile("a1")
+
+	manager, err := NewManager("test-task-racy", workingDir)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint manager: %v", err)
+	}
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize checkpoint manager: %v", err)
+	}
+	if _, err := manager.CreateCheckpoint("First", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	if _, err := manager.SaveCheckpointProto("first", "First", ""); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+
+	writeFile("a2")
+	checkpointID, err := manager.CreateCheckpoint("Second", "")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	if _, err := manager.SaveCheckpointProto("second", "Second", ""); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+
+	writeFile("a3")
+	if err := manager.RestoreFiles(checkpointID, []string{"a.go"}); err != nil {
+		t.Fatalf("Failed to restore files: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "a2" {
+		t.Errorf("Expected a.go to be restored to a2, got %q", content)
+	}
+	second, err := manager.LoadCheckpointProto("second")
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if len(second.Files) != 1 || second.Files[0].Content != "a2" {
+		t.Errorf("Expected the snapshot to store a2, got %v", second.Files)
+	}
+}
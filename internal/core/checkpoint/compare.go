@@ -0,0 +1,282 @@
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ChangeKind is how a file changed between the base and the final checkpoint of a task
+type ChangeKind string
+
+// Change kinds
+const (
+	ChangeUnchanged ChangeKind = "unchanged"
+	ChangeAdded     ChangeKind = "added"
+	ChangeModified  ChangeKind = "modified"
+	ChangeDeleted   ChangeKind = "deleted"
+)
+
+// FileComparison compares the changes two tasks made to a file
+type FileComparison struct {
+	// Path of the file, relative to the working directory
+	Path string
+	// ChangeA is how task A changed the file
+	ChangeA ChangeKind
+	// ChangeB is how task B changed the file
+	ChangeB ChangeKind
+	// Same reports whether both tasks ended with the same content
+	Same bool
+	// ContentA is the content at the final checkpoint of task A, empty if the file does not exist
+	ContentA string
+	// ContentB is the content at the final checkpoint of task B, empty if the file does not exist
+	ContentB string
+	// ModeA is the mode at the final checkpoint of task A, filemode.Empty if the file does not exist
+	ModeA filemode.FileMode
+	// ModeB is the mode at the final checkpoint of task B, filemode.Empty if the file does not exist
+	ModeB filemode.FileMode
+}
+
+// Comparison compares the final checkpoints of two tasks against a common base
+type Comparison struct {
+	// FinalA is the final checkpoint of task A
+	FinalA string
+	// FinalB is the final checkpoint of task B
+	FinalB string
+	// Base is the checkpoint both tasks are compared against
+	Base string
+	// CommonBase reports whether both tasks started from the same files.
+	// Otherwise the starting point of task A is used as the base.
+	CommonBase bool
+	// Files are the files changed by at least one task, sorted by path
+	Files []FileComparison
+}
+
+// Compare compares the final checkpoints of two tasks.
+// Both tasks are compared against the first checkpoint of task A, the state of the workspace
+// when it started, so the result shows what each task changed and where the changes agree.
+func Compare(a, b *Manager) (*Comparison, error) {
+	baseA, finalA, err := a.baseAndFinal()
+	if err != nil {
+		return nil, fmt.Errorf("task %s: %w", a.taskID, err)
+	}
+	baseB, finalB, err := b.baseAndFinal()
+	if err != nil {
+		return nil, fmt.Errorf("task %s: %w", b.taskID, err)
+	}
+
+	baseFiles, err := checkpointFiles(baseA)
+	if err != nil {
+		return nil, err
+	}
+	filesA, err := checkpointFiles(finalA)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := checkpointFiles(finalB)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{
+		FinalA:     finalA.Hash.String(),
+		FinalB:     finalB.Hash.String(),
+		Base:       baseA.Hash.String(),
+		CommonBase: baseA.TreeHash == baseB.TreeHash,
+	}
+
+	// Blobs are addressed by content, so files of both repositories can be compared by hash
+	paths := make(map[string]bool)
+	for _, files := range []map[string]*object.File{baseFiles, filesA, filesB} {
+		for path := range files {
+			paths[path] = true
+		}
+	}
+	for path := range paths {
+		base, fileA, fileB := baseFiles[path], filesA[path], filesB[path]
+		changeA := changeKind(base, fileA)
+		changeB := changeKind(base, fileB)
+		if changeA == ChangeUnchanged && changeB == ChangeUnchanged {
+			continue
+		}
+
+		file := FileComparison{
+			Path:    path,
+			ChangeA: changeA,
+			ChangeB: changeB,
+			Same:    fileHash(fileA) == fileHash(fileB) && fileMode(fileA) == fileMode(fileB),
+			ModeA:   fileMode(fileA),
+			ModeB:   fileMode(fileB),
+		}
+		if !file.Same {
+			if file.ContentA, err = fileContents(fileA); err != nil {
+				return nil, err
+			}
+			if file.ContentB, err = fileContents(fileB); err != nil {
+				return nil, err
+			}
+		}
+		comparison.Files = append(comparison.Files, file)
+	}
+	sort.Slice(comparison.Files, func(i, j int) bool {
+		return comparison.Files[i].Path < comparison.Files[j].Path
+	})
+
+	return comparison, nil
+}
+
+// baseAndFinal returns the first and the current checkpoint of the task
+func (m *Manager) baseAndFinal() (*object.Commit, *object.Commit, error) {
+	head, err := m.repo.Head()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the final checkpoint: %w", err)
+	}
+	final, err := m.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the final checkpoint: %w", err)
+	}
+
+	if final.NumParents() == 0 {
+		return nil, nil, errors.New("no checkpoints")
+	}
+
+	// The first checkpoint records the workspace when the task started.
+	// It follows the empty initial commit of the shadow repository.
+	base := final
+	for {
+		parent, err := base.Parent(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get the first checkpoint: %w", err)
+		}
+		if parent.NumParents() == 0 {
+			return base, final, nil
+		}
+		base = parent
+	}
+}
+
+// Differences returns the files whose final content differs between the two tasks,
+// as diffs from task A to task B
+func (c *Comparison) Differences() []FileDiff {
+	var diffs []FileDiff
+	for _, file := range c.Files {
+		if file.Same {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			RelativePath: file.Path,
+			Before:       file.ContentA,
+			After:        file.ContentB,
+			BeforeMode:   file.ModeA,
+			AfterMode:    file.ModeB,
+		})
+	}
+	return diffs
+}
+
+// Format formats the comparison side by side for display
+func (c *Comparison) Format(taskA, taskB string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "A: %s (final checkpoint %s)\n", taskA, shortID(c.FinalA))
+	fmt.Fprintf(&b, "B: %s (final checkpoint %s)\n", taskB, shortID(c.FinalB))
+	if c.CommonBase {
+		fmt.Fprintf(&b, "Base: common starting point %s\n", shortID(c.Base))
+	} else {
+		fmt.Fprintf(&b, "Base: starting point of A %s (the tasks started from different files)\n", shortID(c.Base))
+	}
+
+	if len(c.Files) == 0 {
+		b.WriteString("\nNeither task changed any file\n")
+		return b.String()
+	}
+
+	width := len("File")
+	for _, file := range c.Files {
+		width = max(width, len(file.Path))
+	}
+
+	var same, different, onlyA, onlyB int
+	fmt.Fprintf(&b, "\n%-*s  %-10s  %-10s  %s\n", width, "File", "A", "B", "Result")
+	for _, file := range c.Files {
+		result := "different"
+		switch {
+		case file.ChangeB == ChangeUnchanged:
+			result = "only A"
+			onlyA++
+		case file.ChangeA == ChangeUnchanged:
+			result = "only B"
+			onlyB++
+		case file.Same:
+			result = "same"
+			same++
+		default:
+			different++
+		}
+		fmt.Fprintf(&b, "%-*s  %-10s  %-10s  %s\n", width, file.Path, displayChange(file.ChangeA), displayChange(file.ChangeB), result)
+	}
+
+	fmt.Fprintf(&b, "\n%d file(s) changed: %d same, %d different, %d only in A, %d only in B\n", len(c.Files), same, different, onlyA, onlyB)
+	return b.String()
+}
+
+// changeKind returns how a file changed from base to final
+func changeKind(base, final *object.File) ChangeKind {
+	switch {
+	case base == nil && final == nil:
+		return ChangeUnchanged
+	case base == nil:
+		return ChangeAdded
+	case final == nil:
+		return ChangeDeleted
+	case base.Hash == final.Hash:
+		return ChangeUnchanged
+	default:
+		return ChangeModified
+	}
+}
+
+// displayChange returns a change kind for display, with a dash for unchanged files
+func displayChange(kind ChangeKind) string {
+	if kind == ChangeUnchanged {
+		return "-"
+	}
+	return string(kind)
+}
+
+// fileHash returns the blob hash of a file, or the zero hash if it does not exist
+func fileHash(f *object.File) plumbing.Hash {
+	if f == nil {
+		return plumbing.ZeroHash
+	}
+	return f.Hash
+}
+
+// fileMode returns the mode of a file, or filemode.Empty if it does not exist
+func fileMode(f *object.File) filemode.FileMode {
+	if f == nil {
+		return filemode.Empty
+	}
+	return f.Mode
+}
+
+// fileContents returns the content of a file, or an empty string if it does not exist
+func fileContents(f *object.File) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	return f.Contents()
+}
+
+// shortID returns the abbreviated form of a checkpoint ID
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,91 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files into a directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+// TestCompare tests comparing two tasks that started from copies of the same workspace
+func TestCompare(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	initial := map[string]string{
+		"same.txt":   "one\n",
+		"differ.txt": "two\n",
+		"keep.txt":   "three\n",
+		"drop.txt":   "four\n",
+	}
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	writeFiles(t, dirA, initial)
+	writeFiles(t, dirB, initial)
+
+	managerA := newTestManager(t, "task-a", dirA)
+	if _, err := managerA.CreateCheckpoint("start", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	writeFiles(t, dirA, map[string]string{"same.txt": "one!\n", "differ.txt": "two A\n", "new.txt": "new\n"})
+	if _, err := managerA.CreateCheckpoint("A", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	managerB := newTestManager(t, "task-b", dirB)
+	if _, err := managerB.CreateCheckpoint("start", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	writeFiles(t, dirB, map[string]string{"same.txt": "one!\n", "differ.txt": "two B\n"})
+	if err := os.Remove(filepath.Join(dirB, "drop.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if _, err := managerB.CreateCheckpoint("B", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	comparison, err := Compare(managerA, managerB)
+	if err != nil {
+		t.Fatalf("Failed to compare tasks: %v", err)
+	}
+	if !comparison.CommonBase {
+		t.Error("Expected the tasks to share a common base")
+	}
+
+	got := make(map[string]FileComparison)
+	for _, file := range comparison.Files {
+		got[file.Path] = file
+	}
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 changed files, got %+v", comparison.Files)
+	}
+	if f := got["same.txt"]; !f.Same || f.ChangeA != ChangeModified || f.ChangeB != ChangeModified {
+		t.Errorf("Unexpected same.txt: %+v", f)
+	}
+	if f := got["differ.txt"]; f.Same || f.ContentA != "two A\n" || f.ContentB != "two B\n" {
+		t.Errorf("Unexpected differ.txt: %+v", f)
+	}
+	if f := got["new.txt"]; f.ChangeA != ChangeAdded || f.ChangeB != ChangeUnchanged {
+		t.Errorf("Unexpected new.txt: %+v", f)
+	}
+	if f := got["drop.txt"]; f.ChangeA != ChangeUnchanged || f.ChangeB != ChangeDeleted {
+		t.Errorf("Unexpected drop.txt: %+v", f)
+	}
+
+	if diffs := comparison.Differences(); len(diffs) != 3 {
+		t.Errorf("Expected 3 differing files, got %d", len(diffs))
+	}
+	output := comparison.Format("task-a", "task-b")
+	if !strings.Contains(output, "4 file(s) changed: 1 same, 1 different, 1 only in A, 1 only in B") {
+		t.Errorf("Unexpected summary:\n%s", output)
+	}
+}
@@ -0,0 +1,148 @@
+package checkpoint
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	utilsdiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// WritePatch writes diffs as a git-style unified diff that can be applied with `git apply`
+func WritePatch(w io.Writer, diffs []FileDiff) error {
+	patch := &filePatches{}
+	for _, d := range diffs {
+		patch.patches = append(patch.patches, newFilePatch(d))
+	}
+
+	return diff.NewUnifiedEncoder(w, diff.DefaultContextLines).Encode(patch)
+}
+
+// FormatPatch formats diffs as a git-style unified diff
+func FormatPatch(diffs []FileDiff) (string, error) {
+	var buf bytes.Buffer
+	if err := WritePatch(&buf, diffs); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// filePatches implements diff.Patch for a list of file diffs
+type filePatches struct {
+	patches []diff.FilePatch
+}
+
+// FilePatches implements diff.Patch
+func (p *filePatches) FilePatches() []diff.FilePatch {
+	return p.patches
+}
+
+// Message implements diff.Patch
+func (p *filePatches) Message() string {
+	return ""
+}
+
+// filePatch implements diff.FilePatch for a single file diff
+type filePatch struct {
+	from, to diff.File
+	binary   bool
+	chunks   []diff.Chunk
+}
+
+// newFilePatch creates a file patch from a file diff.
+// A side whose mode is filemode.Empty is a missing file, like FormatDiff shows it.
+func newFilePatch(d FileDiff) *filePatch {
+	p := &filePatch{
+		binary: strings.ContainsRune(d.Before, 0) || strings.ContainsRune(d.After, 0),
+	}
+	if d.BeforeMode != filemode.Empty {
+		p.from = newPatchFile(d.RelativePath, d.Before, d.BeforeMode)
+	}
+	if d.AfterMode != filemode.Empty {
+		p.to = newPatchFile(d.RelativePath, d.After, d.AfterMode)
+	}
+	if p.binary {
+		return p
+	}
+
+	for _, change := range utilsdiff.Do(d.Before, d.After) {
+		var op diff.Operation
+		switch change.Type {
+		case diffmatchpatch.DiffInsert:
+			op = diff.Add
+		case diffmatchpatch.DiffDelete:
+			op = diff.Delete
+		default:
+			op = diff.Equal
+		}
+		p.chunks = append(p.chunks, &patchChunk{content: change.Text, op: op})
+	}
+
+	return p
+}
+
+// IsBinary implements diff.FilePatch
+func (p *filePatch) IsBinary() bool {
+	return p.binary
+}
+
+// Files implements diff.FilePatch
+func (p *filePatch) Files() (diff.File, diff.File) {
+	return p.from, p.to
+}
+
+// Chunks implements diff.FilePatch
+func (p *filePatch) Chunks() []diff.Chunk {
+	return p.chunks
+}
+
+// patchFile implements diff.File
+type patchFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+// newPatchFile creates a patch file for the given content and mode
+func newPatchFile(path, content string, mode filemode.FileMode) *patchFile {
+	return &patchFile{
+		path: path,
+		hash: plumbing.ComputeHash(plumbing.BlobObject, []byte(content)),
+		mode: mode,
+	}
+}
+
+// Hash implements diff.File
+func (f *patchFile) Hash() plumbing.Hash {
+	return f.hash
+}
+
+// Mode implements diff.File
+func (f *patchFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+// Path implements diff.File
+func (f *patchFile) Path() string {
+	return f.path
+}
+
+// patchChunk implements diff.Chunk
+type patchChunk struct {
+	content string
+	op      diff.Operation
+}
+
+// Content implements diff.Chunk
+func (c *patchChunk) Content() string {
+	return c.content
+}
+
+// Type implements diff.Chunk
+func (c *patchChunk) Type() diff.Operation {
+	return c.op
+}
@@ -0,0 +1,40 @@
+package checkpoint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestFormatPatch(t *testing.T) {
+	diffs := []FileDiff{
+		{RelativePath: "empty.txt", AfterMode: filemode.Regular},
+		{RelativePath: "main.go", Before: "package main\n\nfunc main() {}\n", After: "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n", BeforeMode: filemode.Regular, AfterMode: filemode.Regular},
+		{RelativePath: "new.txt", After: "hello\n", AfterMode: filemode.Regular},
+		{RelativePath: "old.txt", Before: "bye\n", BeforeMode: filemode.Regular},
+		{RelativePath: "run.sh", Before: "echo\n", After: "echo\n", BeforeMode: filemode.Regular, AfterMode: filemode.Executable},
+	}
+
+	patch, err := FormatPatch(diffs)
+	if err != nil {
+		t.Fatalf("Failed to format patch: %v", err)
+	}
+
+	expected := []string{
+		"diff --git a/empty.txt b/empty.txt\nnew file mode 100644",
+		"diff --git a/main.go b/main.go",
+		"--- a/main.go\n+++ b/main.go\n",
+		"-func main() {}\n+func main() {\n+\tprintln(\"hi\")\n+}\n",
+		"diff --git a/new.txt b/new.txt\nnew file mode 100644",
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hello\n",
+		"diff --git a/old.txt b/old.txt\ndeleted file mode 100644",
+		"--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+		"diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755",
+	}
+	for _, want := range expected {
+		if !strings.Contains(patch, want) {
+			t.Errorf("Expected patch to contain %q, got:\n%s", want, patch)
+		}
+	}
+}
@@ -1,28 +1,48 @@
 package checkpoint
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/tracing"
 	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
 )
 
 // Service provides checkpoint functionality for tasks
 type Service struct {
 	managers map[string]*Manager
+	locks    map[string]*tasklock.Lock
 }
 
 // NewService creates a new checkpoint service
 func NewService() *Service {
 	return &Service{
 		managers: make(map[string]*Manager),
+		locks:    make(map[string]*tasklock.Lock),
+	}
+}
+
+// SetLock sets the lock of a task, checked before every checkpoint write of the task
+func (s *Service) SetLock(taskID string, lock *tasklock.Lock) {
+	s.locks[taskID] = lock
+	for _, manager := range s.managers {
+		if manager.taskID == taskID {
+			manager.SetLock(lock)
+		}
 	}
 }
 
 // GetManager returns a checkpoint manager for a task
 func (s *Service) GetManager(taskID, workingDir string) (*Manager, error) {
-	// Check if manager already exists
-	if manager, ok := s.managers[taskID]; ok {
+	// Check if manager already exists, managers are kept per task and workspace
+	key := taskID + "\x00" + normalizeWorkspace(workingDir)
+	if manager, ok := s.managers[key]; ok {
 		return manager, nil
 	}
 
@@ -33,17 +53,30 @@ func (s *Service) GetManager(taskID, workingDir string) (*Manager, error) {
 	}
 
 	// Initialize manager
+	manager.SetLock(s.locks[taskID])
 	if err := manager.Initialize(); err != nil {
 		return nil, err
 	}
 
 	// Store manager
-	s.managers[taskID] = manager
+	s.managers[key] = manager
 	return manager, nil
 }
 
+// Captures reports whether the checkpoints of a task capture a file, see Manager.Captures
+func (s *Service) Captures(taskID, workingDir, relPath string) (bool, error) {
+	manager, err := s.GetManager(taskID, workingDir)
+	if err != nil {
+		return false, err
+	}
+	return manager.Captures(relPath), nil
+}
+
 // SaveCheckpoint saves a checkpoint for a task
-func (s *Service) SaveCheckpoint(taskID, workingDir, name, description string) (*pb.CheckpointEvent, error) {
+func (s *Service) SaveCheckpoint(taskID, workingDir, name, description string) (_ *pb.CheckpointEvent, err error) {
+	_, span := tracing.Start(context.Background(), "checkpoint.save", tracing.AttrTaskID.String(taskID))
+	defer func() { tracing.End(span, err) }()
+
 	// Get manager
 	manager, err := s.GetManager(taskID, workingDir)
 	if err != nil {
@@ -56,6 +89,14 @@ func (s *Service) SaveCheckpoint(taskID, workingDir, name, description string) (
 		return nil, err
 	}
 
+	span.SetAttributes(tracing.AttrCheckpointID.String(checkpointID))
+
+	// The file snapshot describes the checkpoint, the checkpoint itself is the commit of the
+	// shadow repository, so a failed snapshot is only logged
+	if _, err := manager.SaveCheckpointProto(checkpointID, name, description); err != nil {
+		slog.Warn("Failed to save the file snapshot of the checkpoint", "checkpoint", checkpointID, "error", err)
+	}
+
 	// Create checkpoint event
 	checkpointEvent := &pb.CheckpointEvent{
 		OperationType: pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_SAVE,
@@ -68,7 +109,10 @@ func (s *Service) SaveCheckpoint(taskID, workingDir, name, description string) (
 }
 
 // RestoreCheckpoint restores a checkpoint for a task
-func (s *Service) RestoreCheckpoint(taskID, workingDir, checkpointID string) (*pb.CheckpointEvent, error) {
+func (s *Service) RestoreCheckpoint(taskID, workingDir, checkpointID string) (_ *pb.CheckpointEvent, err error) {
+	_, span := tracing.Start(context.Background(), "checkpoint.restore", tracing.AttrTaskID.String(taskID), tracing.AttrCheckpointID.String(checkpointID))
+	defer func() { tracing.End(span, err) }()
+
 	// Get manager
 	manager, err := s.GetManager(taskID, workingDir)
 	if err != nil {
@@ -108,6 +152,32 @@ func (s *Service) RestoreCheckpoint(taskID, workingDir, checkpointID string) (*p
 	return checkpointEvent, nil
 }
 
+// RestoreFiles restores only the given paths from a checkpoint for a task
+func (s *Service) RestoreFiles(taskID, workingDir, checkpointID string, paths []string) (_ *pb.CheckpointEvent, err error) {
+	_, span := tracing.Start(context.Background(), "checkpoint.restore_files", tracing.AttrTaskID.String(taskID), tracing.AttrCheckpointID.String(checkpointID))
+	defer func() { tracing.End(span, err) }()
+
+	// Get manager
+	manager, err := s.GetManager(taskID, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restore files
+	if err := manager.RestoreFiles(checkpointID, paths); err != nil {
+		return nil, err
+	}
+
+	// Create checkpoint event
+	checkpointEvent := &pb.CheckpointEvent{
+		OperationType: pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_RESTORE,
+		CheckpointId:  checkpointID,
+		Description:   fmt.Sprintf("Restored %s", strings.Join(paths, ", ")),
+	}
+
+	return checkpointEvent, nil
+}
+
 // GetCheckpoints returns all checkpoints for a task
 func (s *Service) GetCheckpoints(taskID, workingDir string) ([]CheckpointInfo, error) {
 	// Get manager
@@ -141,9 +211,9 @@ func (s *Service) FormatDiff(diffs []FileDiff) string {
 	var result string
 	for _, diff := range diffs {
 		result += fmt.Sprintf("File: %s\n", diff.RelativePath)
-		if diff.Before == "" && diff.After != "" {
+		if diff.BeforeMode == filemode.Empty {
 			result += "  (New file)\n"
-		} else if diff.Before != "" && diff.After == "" {
+		} else if diff.AfterMode == filemode.Empty {
 			result += "  (Deleted)\n"
 		} else {
 			result += "  (Modified)\n"
@@ -154,6 +224,30 @@ func (s *Service) FormatDiff(diffs []FileDiff) string {
 	return result
 }
 
+// FormatUnifiedDiff formats a diff as a unified diff for display
+func (s *Service) FormatUnifiedDiff(diffs []FileDiff) (string, error) {
+	if len(diffs) == 0 {
+		return "No changes", nil
+	}
+
+	return FormatPatch(diffs)
+}
+
+// ExportPatch writes a diff to a .patch file that can be applied to another clone with `git apply`
+func (s *Service) ExportPatch(diffs []FileDiff, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create patch file: %w", err)
+	}
+
+	if err := WritePatch(f, diffs); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write patch file: %w", err)
+	}
+
+	return f.Close()
+}
+
 // FormatCheckpointList formats a list of checkpoints for display
 func (s *Service) FormatCheckpointList(checkpoints []CheckpointInfo) string {
 	if len(checkpoints) == 0 {
@@ -0,0 +1,308 @@
+package checkpoint
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// checksumSuffix is the suffix of the file holding the SHA-256 checksum of a snapshot
+const checksumSuffix = ".sha256"
+
+// ErrCorruptSnapshot is returned when a snapshot does not match its checksum
+var ErrCorruptSnapshot = errors.New("snapshot is corrupted")
+
+// DefaultMaxSnapshotFileSize is the largest file whose content is stored in a file snapshot
+const DefaultMaxSnapshotFileSize = 1 << 20
+
+// binaryDetectionSize is the number of leading bytes inspected to detect binary files
+const binaryDetectionSize = 8000
+
+// checkpointFilesField is the field number of Checkpoint.files
+var checkpointFilesField = (&pb.Checkpoint{}).ProtoReflect().Descriptor().Fields().ByName("files").Number()
+
+// snapshotEntry remembers the state of a file in the last written snapshot
+type snapshotEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+	state   pb.FileSnapshotContentState
+}
+
+// SetMaxSnapshotFileSize sets the largest file whose content is stored in a file snapshot.
+// Larger files are recorded with their hash only.
+func (m *Manager) SetMaxSnapshotFileSize(size int64) {
+	m.maxSnapshotFileSize = size
+}
+
+// CreateCheckpointProto creates a checkpoint proto message, deduplicated against the last saved
+// snapshot. Prefer SaveCheckpointProto for large workspaces, it never holds all snapshots in memory.
+func (m *Manager) CreateCheckpointProto(id, name, description string) (*pb.Checkpoint, error) {
+	var buf bytes.Buffer
+	if _, err := m.writeCheckpointProto(&buf, id, name, description); err != nil {
+		return nil, err
+	}
+
+	checkpoint := &pb.Checkpoint{}
+	if err := proto.Unmarshal(buf.Bytes(), checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// SaveCheckpointProto streams a checkpoint proto message to the task's snapshot directory
+// and returns the path of the written file. The next snapshots are deduplicated against it
+// once it is saved.
+func (m *Manager) SaveCheckpointProto(id, name, description string) (string, error) {
+	if err := m.lock.Validate(); err != nil {
+		return "", err
+	}
+
+	snapshotPath, err := m.snapshotPath(id)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshots directory: %w", err)
+	}
+
+	// Write to a temporary file first so a failed snapshot never replaces a good one
+	tmp, err := os.CreateTemp(filepath.Dir(snapshotPath), id+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Hash the snapshot while it is written, so corruption can be detected when it is loaded
+	hash := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	started := time.Now()
+	snapshot, err := m.writeCheckpointProto(w, id, name, description)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), snapshotPath); err != nil {
+		return "", fmt.Errorf("failed to save snapshot file: %w", err)
+	}
+	if err := os.WriteFile(snapshotPath+checksumSuffix, []byte(hex.EncodeToString(hash.Sum(nil))+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write snapshot checksum: %w", err)
+	}
+
+	// Only a saved snapshot can be referred to by the unchanged files of the next ones
+	m.lastSnapshotID = id
+	m.lastSnapshot = snapshot
+	m.lastSnapshotTime = started
+	return snapshotPath, nil
+}
+
+// LoadCheckpointProto loads a checkpoint proto message saved with SaveCheckpointProto
+func (m *Manager) LoadCheckpointProto(id string) (*pb.Checkpoint, error) {
+	snapshotPath, err := m.snapshotPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+
+	// Snapshots written before checksums were introduced have no checksum file
+	if sum, err := os.ReadFile(snapshotPath + checksumSuffix); err == nil {
+		actual := sha256.Sum256(data)
+		if strings.TrimSpace(string(sum)) != hex.EncodeToString(actual[:]) {
+			return nil, fmt.Errorf("snapshot of checkpoint %s: %w", id, ErrCorruptSnapshot)
+		}
+	}
+
+	checkpoint := &pb.Checkpoint{}
+	if err := proto.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// snapshotPath returns the path of the snapshot file for a checkpoint
+func (m *Manager) snapshotPath(id string) (string, error) {
+	if m.shadowGitPath == "" {
+		return "", fmt.Errorf("checkpoint manager is not initialized")
+	}
+
+	return filepath.Join(filepath.Dir(m.shadowGitPath), "snapshots", id+".pb"), nil
+}
+
+// writeCheckpointProto writes a checkpoint proto message to w and returns the state of its
+// files, to deduplicate the next snapshots against it once it is saved.
+// File snapshots are encoded one at a time, so memory usage does not grow with the workspace.
+// Files unchanged since the previous snapshot are written without content and refer to the
+// previous checkpoint, binary files and files larger than the size limit are recorded with
+// their hash only.
+func (m *Manager) writeCheckpointProto(w io.Writer, id, name, description string) (map[string]snapshotEntry, error) {
+	// Write the checkpoint header
+	header, err := proto.Marshal(&pb.Checkpoint{
+		Id:                   id,
+		Name:                 name,
+		Description:          description,
+		Timestamp:            time.Now().Format(time.RFC3339),
+		PreviousCheckpointId: m.lastSnapshotID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	// Write file snapshots as repeated Checkpoint.files fields
+	snapshot := make(map[string]snapshotEntry)
+	var buf []byte
+	err = m.walkWorktree(func(relPath, absPath string, info fs.FileInfo) error {
+		// Skip symlinks and files that should be ignored
+		if !info.Mode().IsRegular() || !m.ignoreController.ValidateAccess(relPath) {
+			return nil
+		}
+
+		fileSnapshot, entry, err := m.snapshotFile(relPath, absPath, info)
+		if err != nil {
+			return err
+		}
+		snapshot[relPath] = entry
+
+		data, err := proto.Marshal(fileSnapshot)
+		if err != nil {
+			return err
+		}
+		buf = protowire.AppendTag(buf[:0], checkpointFilesField, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+		_, err = w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Get git status
+	gitStatus, err := m.getGitStatus()
+	if err != nil {
+		// Git status is optional, so we can continue without it
+		gitStatus = nil
+	}
+	if gitStatus != nil {
+		trailer, err := proto.Marshal(&pb.Checkpoint{GitStatus: gitStatus})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(trailer); err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// snapshotFile creates the snapshot of a single file
+func (m *Manager) snapshotFile(relPath, absPath string, info fs.FileInfo) (*pb.FileSnapshot, snapshotEntry, error) {
+	entry := snapshotEntry{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	fileSnapshot := &pb.FileSnapshot{
+		FilePath: relPath,
+		Size:     info.Size(),
+	}
+
+	// Files whose size and modification time did not change are not read again, unless they
+	// were modified once the last snapshot started, possibly again after it read them
+	previous, hasPrevious := m.lastSnapshot[relPath]
+	if hasPrevious && previous.size == entry.size && previous.modTime.Equal(entry.modTime) &&
+		previous.modTime.Before(m.lastSnapshotTime) {
+		entry.hash = previous.hash
+		entry.state = unchangedState(previous.state)
+		fileSnapshot.ContentHash = entry.hash
+		fileSnapshot.ContentState = entry.state
+		return fileSnapshot, entry, nil
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return nil, entry, err
+	}
+	defer f.Close()
+
+	// Detect binary files from the head of the file
+	head := make([]byte, binaryDetectionSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, entry, err
+	}
+	head = head[:n]
+	binary := bytes.IndexByte(head, 0) >= 0
+	tooLarge := info.Size() > m.maxSnapshotFileSize
+
+	// Hash the whole file, keeping the content only if it will be stored
+	hasher := sha256.New()
+	hasher.Write(head)
+	var content bytes.Buffer
+	if binary || tooLarge {
+		_, err = io.Copy(hasher, f)
+	} else {
+		content.Write(head)
+		_, err = io.Copy(io.MultiWriter(hasher, &content), f)
+	}
+	if err != nil {
+		return nil, entry, err
+	}
+	entry.hash = hex.EncodeToString(hasher.Sum(nil))
+	fileSnapshot.ContentHash = entry.hash
+
+	switch {
+	case hasPrevious && previous.hash == entry.hash:
+		entry.state = unchangedState(previous.state)
+	case binary:
+		entry.state = pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_BINARY
+	case tooLarge:
+		entry.state = pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_TOO_LARGE
+	default:
+		entry.state = pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_STORED
+		fileSnapshot.Content = content.String()
+	}
+	fileSnapshot.ContentState = entry.state
+
+	return fileSnapshot, entry, nil
+}
+
+// unchangedState returns the content state of a file that did not change since the previous snapshot.
+// Content that was never stored keeps the reason why it was omitted.
+func unchangedState(previous pb.FileSnapshotContentState) pb.FileSnapshotContentState {
+	switch previous {
+	case pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_BINARY,
+		pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_TOO_LARGE:
+		return previous
+	default:
+		return pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_UNCHANGED
+	}
+}
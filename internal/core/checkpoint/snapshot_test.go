@@ -0,0 +1,146 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func TestSaveCheckpointProto(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	workingDir := t.TempDir()
+	files := map[string][]byte{
+		"main.go":   []byte("package main\n"),
+		"large.txt": make([]byte, 64),
+		"image.dat": {0x89, 'P', 'N', 'G', 0x00, 0x01},
+	}
+	for i := range files["large.txt"] {
+		files["large.txt"][i] = 'a'
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(workingDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	manager, err := NewManager("test-task-snapshot", workingDir)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint manager: %v", err)
+	}
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize checkpoint manager: %v", err)
+	}
+	manager.SetMaxSnapshotFileSize(32)
+
+	states := func(checkpoint *pb.Checkpoint) map[string]pb.FileSnapshotContentState {
+		result := make(map[string]pb.FileSnapshotContentState)
+		for _, file := range checkpoint.Files {
+			result[file.FilePath] = file.ContentState
+		}
+		return result
+	}
+
+	// First snapshot stores text content only
+	if _, err := manager.SaveCheckpointProto("first", "First", ""); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	first, err := manager.LoadCheckpointProto("first")
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	expected := map[string]pb.FileSnapshotContentState{
+		"main.go":   pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_STORED,
+		"large.txt": pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_TOO_LARGE,
+		"image.dat": pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_BINARY,
+	}
+	for name, state := range states(first) {
+		if expected[name] != state {
+			t.Errorf("Expected %s to be %v, got %v", name, expected[name], state)
+		}
+	}
+	for _, file := range first.Files {
+		if file.FilePath == "main.go" && file.Content != "package main\n" {
+			t.Errorf("Expected main.go content to be stored, got %q", file.Content)
+		}
+		if file.FilePath != "main.go" && file.Content != "" {
+			t.Errorf("Expected %s content to be omitted", file.FilePath)
+		}
+	}
+
+	// A damaged snapshot is detected when it is loaded
+	firstPath, err := manager.snapshotPath("first")
+	if err != nil {
+		t.Fatalf("Failed to get snapshot path: %v", err)
+	}
+	data, err := os.ReadFile(firstPath)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if err := os.WriteFile(firstPath, data[:len(data)-1], 0644); err != nil {
+		t.Fatalf("Failed to truncate snapshot: %v", err)
+	}
+	if _, err := manager.LoadCheckpointProto("first"); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("Expected ErrCorruptSnapshot, got %v", err)
+	}
+
+	// Second snapshot only stores changed files
+	if err := os.WriteFile(filepath.Join(workingDir, "new.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write new.go: %v", err)
+	}
+	second, err := manager.CreateCheckpointProto("second", "Second", "")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	if second.PreviousCheckpointId != "first" {
+		t.Errorf("Expected previous checkpoint %q, got %q", "first", second.PreviousCheckpointId)
+	}
+	expected["main.go"] = pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_UNCHANGED
+	expected["new.go"] = pb.FileSnapshotContentState_FILE_SNAPSHOT_CONTENT_STATE_STORED
+	got := states(second)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d files, got %d", len(expected), len(got))
+	}
+	for name, state := range got {
+		if expected[name] != state {
+			t.Errorf("Expected %s to be %v, got %v", name, expected[name], state)
+		}
+	}
+
+	// Snapshots that are not saved are not referred to by the next ones
+	third, err := manager.CreateCheckpointProto("third", "Third", "")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	if third.PreviousCheckpointId != "first" {
+		t.Errorf("Expected previous checkpoint %q, got %q", "first", third.PreviousCheckpointId)
+	}
+}
+
+func TestSaveCheckpointWritesSnapshot(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write main.go: %v", err)
+	}
+
+	service := NewService()
+	event, err := service.SaveCheckpoint("test-task-service-snapshot", workingDir, "First", "")
+	if err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+	manager, err := service.GetManager("test-task-service-snapshot", workingDir)
+	if err != nil {
+		t.Fatalf("Failed to get checkpoint manager: %v", err)
+	}
+	snapshot, err := manager.LoadCheckpointProto(event.CheckpointId)
+	if err != nil {
+		t.Fatalf("Failed to load the snapshot of the checkpoint: %v", err)
+	}
+	if len(snapshot.Files) != 1 || snapshot.Files[0].Content != "package main\n" {
+		t.Errorf("Expected the snapshot of main.go, got %v", snapshot.Files)
+	}
+}
@@ -0,0 +1,271 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// workspaceKeyLength is the number of hex characters of the path hash used to key a workspace
+const workspaceKeyLength = 16
+
+// projectRootSection and projectRootOption are the shadow repository configuration recording
+// the root commit of the git repository of the workspace, see projectRoot
+const (
+	projectRootSection = "goline"
+	projectRootOption  = "projectRoot"
+)
+
+// workspaceKey returns the key of the shadow repository of a working directory.
+// The key is a hash of the cleaned absolute path, so the same task can keep
+// separate checkpoints for every workspace it is used in.
+func workspaceKey(workingDir string) string {
+	hash := sha256.Sum256([]byte(normalizeWorkspace(workingDir)))
+	return hex.EncodeToString(hash[:])[:workspaceKeyLength]
+}
+
+// normalizeWorkspace returns the cleaned absolute form of a working directory
+func normalizeWorkspace(workingDir string) string {
+	if abs, err := filepath.Abs(workingDir); err == nil {
+		workingDir = abs
+	}
+	return filepath.Clean(workingDir)
+}
+
+// getCheckpointsRoot returns the directory holding the shadow repositories of the task
+func (m *Manager) getCheckpointsRoot() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".goline", "tasks", m.taskID, "checkpoints"), nil
+}
+
+// readWorktreeConfig returns the worktree configured in the shadow repository at gitPath
+func readWorktreeConfig(gitPath string) (string, error) {
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	cfg, err := storage.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree configuration: %w", err)
+	}
+
+	return strings.TrimSpace(cfg.Core.Worktree), nil
+}
+
+// writeWorktreeConfig points the shadow repository at gitPath to a new worktree
+func writeWorktreeConfig(gitPath, worktree string) error {
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	cfg, err := storage.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree configuration: %w", err)
+	}
+
+	cfg.Core.Worktree = worktree
+	if err := storage.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to update worktree configuration: %w", err)
+	}
+
+	return nil
+}
+
+// projectRoot returns the root commit of the git repository of a working directory, reached by
+// following the first parents from HEAD. It identifies the project wherever its directory is
+// moved, and is empty when the working directory is not in a git repository with commits.
+func projectRoot(workingDir string) string {
+	repo, err := git.PlainOpenWithOptions(workingDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return ""
+	}
+	for commit.NumParents() > 0 {
+		if commit, err = commit.Parent(0); err != nil {
+			return ""
+		}
+	}
+	return commit.Hash.String()
+}
+
+// readProjectRootConfig returns the project root commit recorded in the shadow repository at
+// gitPath, empty if none is
+func readProjectRootConfig(gitPath string) (string, error) {
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	cfg, err := storage.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to get project configuration: %w", err)
+	}
+
+	return cfg.Raw.Section(projectRootSection).Option(projectRootOption), nil
+}
+
+// writeProjectRootConfig records the project root commit in the shadow repository at gitPath
+func writeProjectRootConfig(gitPath, root string) error {
+	storage := filesystem.NewStorage(osfs.New(gitPath), cache.NewObjectLRUDefault())
+	cfg, err := storage.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get project configuration: %w", err)
+	}
+
+	cfg.Raw.Section(projectRootSection).SetOption(projectRootOption, root)
+	if err := storage.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to update project configuration: %w", err)
+	}
+
+	return nil
+}
+
+// migrateLegacyShadowGit moves a shadow repository created before checkpoints were keyed
+// by workspace (checkpoints/.git) to the key of the workspace it was created for
+func migrateLegacyShadowGit(root string) error {
+	legacyGitPath := filepath.Join(root, ".git")
+	if _, err := os.Stat(legacyGitPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to check legacy checkpoints: %w", err)
+	}
+
+	worktree, err := readWorktreeConfig(legacyGitPath)
+	if err != nil {
+		return err
+	}
+	targetDir := filepath.Join(root, workspaceKey(worktree))
+	if _, err := os.Stat(filepath.Join(targetDir, ".git")); err == nil {
+		return fmt.Errorf("cannot migrate legacy checkpoints, %s already has a repository", targetDir)
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoints directory: %w", err)
+	}
+
+	// Move the repository and the snapshots stored next to it
+	if err := os.Rename(legacyGitPath, filepath.Join(targetDir, ".git")); err != nil {
+		return fmt.Errorf("failed to migrate legacy checkpoints: %w", err)
+	}
+	legacySnapshots := filepath.Join(root, "snapshots")
+	targetSnapshots := filepath.Join(targetDir, "snapshots")
+	if _, err := os.Stat(targetSnapshots); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(legacySnapshots, targetSnapshots); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to migrate legacy snapshots: %w", err)
+		}
+	}
+
+	slog.Info("Migrated checkpoints to per-workspace storage", "workspace", worktree, "path", targetDir)
+	return nil
+}
+
+// adoptMovedWorkspace looks for a shadow repository of the task whose workspace no longer
+// exists, and moves it to targetDir with its worktree pointed at the working directory.
+// This keeps the checkpoints of a project directory that was moved or renamed.
+// Only a repository recording the same project root commit as the working directory is
+// adopted, so the checkpoints of another project are never restored over it; workspaces
+// outside git repositories start new checkpoints when moved.
+// It reports whether a repository was adopted.
+func (m *Manager) adoptMovedWorkspace(root, targetDir string) (bool, error) {
+	project := projectRoot(m.workingDir)
+	if project == "" {
+		return false, nil
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read checkpoints directory: %w", err)
+	}
+
+	// Pick the most recently used repository of a missing workspace
+	var candidate, candidateWorktree string
+	var candidateTime int64
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "snapshots" {
+			continue
+		}
+		gitPath := filepath.Join(root, entry.Name(), ".git")
+		info, err := os.Stat(gitPath)
+		if err != nil {
+			continue
+		}
+		worktree, err := readWorktreeConfig(gitPath)
+		if err != nil || worktree == "" {
+			continue
+		}
+		if _, err := os.Stat(worktree); !errors.Is(err, os.ErrNotExist) {
+			// The workspace still exists, its checkpoints belong to it
+			continue
+		}
+		if recorded, err := readProjectRootConfig(gitPath); err != nil || recorded != project {
+			// The workspace was another project, or one whose project is unknown
+			continue
+		}
+		if candidate == "" || info.ModTime().UnixNano() > candidateTime {
+			candidate = filepath.Join(root, entry.Name())
+			candidateWorktree = worktree
+			candidateTime = info.ModTime().UnixNano()
+		}
+	}
+	if candidate == "" {
+		return false, nil
+	}
+
+	if err := os.Rename(candidate, targetDir); err != nil {
+		return false, fmt.Errorf("failed to migrate checkpoints of moved workspace: %w", err)
+	}
+	if err := writeWorktreeConfig(filepath.Join(targetDir, ".git"), m.workingDir); err != nil {
+		return false, err
+	}
+
+	slog.Info("Migrated checkpoints of moved workspace", "from", candidateWorktree, "to", m.workingDir)
+	return true, nil
+}
+
+// Workspaces returns the working directories the task has checkpoints for
+func (m *Manager) Workspaces() ([]string, error) {
+	root, err := m.getCheckpointsRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoints directory: %w", err)
+	}
+
+	var workspaces []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		gitPath := filepath.Join(root, entry.Name(), ".git")
+		if _, err := os.Stat(gitPath); err != nil {
+			continue
+		}
+		worktree, err := readWorktreeConfig(gitPath)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, worktree)
+	}
+
+	return workspaces, nil
+}
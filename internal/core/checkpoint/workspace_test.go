@@ -0,0 +1,163 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func newTestManager(t *testing.T, taskID, workingDir string) *Manager {
+	t.Helper()
+	manager, err := NewManager(taskID, workingDir)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint manager: %v", err)
+	}
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize checkpoint manager: %v", err)
+	}
+	return manager
+}
+
+// initProject makes dir a git repository with a commit of its files, whose message sets the
+// root commit apart from other projects
+func initProject(t *testing.T, dir, message string) {
+	t.Helper()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to initialize project: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to get worktree: %v", err)
+	}
+	if err := worktree.AddGlob("."); err != nil {
+		t.Fatalf("Failed to add files: %v", err)
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := worktree.Commit(message, &git.CommitOptions{Author: signature, AllowEmptyCommits: true}); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+}
+
+// TestWorkspaceIsolation tests that a task keeps separate checkpoints per workspace
+func TestWorkspaceIsolation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	first := t.TempDir()
+	second := t.TempDir()
+	for _, dir := range []string{first, second} {
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	firstManager := newTestManager(t, "task-workspaces", first)
+	if _, err := firstManager.CreateCheckpoint("First", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	// A second workspace of the same task used to fail, it now gets its own repository
+	secondManager := newTestManager(t, "task-workspaces", second)
+	checkpoints, err := secondManager.GetCheckpoints()
+	if err != nil {
+		t.Fatalf("Failed to get checkpoints: %v", err)
+	}
+	if len(checkpoints) != 0 {
+		t.Errorf("Expected no checkpoints in the second workspace, got %+v", checkpoints)
+	}
+
+	workspaces, err := secondManager.Workspaces()
+	if err != nil {
+		t.Fatalf("Failed to list workspaces: %v", err)
+	}
+	if len(workspaces) != 2 {
+		t.Errorf("Expected 2 workspaces, got %v", workspaces)
+	}
+}
+
+// TestMovedWorkspaceMigration tests that checkpoints follow a moved project directory
+func TestMovedWorkspaceMigration(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	parent := t.TempDir()
+	oldDir := filepath.Join(parent, "old")
+	newDir := filepath.Join(parent, "new")
+	if err := os.MkdirAll(oldDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(oldDir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	initProject(t, oldDir, "Initial commit")
+
+	manager := newTestManager(t, "task-moved", oldDir)
+	checkpointID, err := manager.CreateCheckpoint("Before move", "")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+
+	// Simulate a repository created before checkpoints were keyed by workspace
+	root, err := manager.getCheckpointsRoot()
+	if err != nil {
+		t.Fatalf("Failed to get checkpoints root: %v", err)
+	}
+	if err := os.Rename(filepath.Join(root, workspaceKey(oldDir), ".git"), filepath.Join(root, ".git")); err != nil {
+		t.Fatalf("Failed to move repository: %v", err)
+	}
+
+	// Move the project
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatalf("Failed to move workspace: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(newDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	moved := newTestManager(t, "task-moved", newDir)
+	if err := moved.RestoreCheckpoint(checkpointID); err != nil {
+		t.Fatalf("Failed to restore checkpoint in moved workspace: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(newDir, "main.go"))
+	if err != nil || string(content) != "package main\n" {
+		t.Errorf("Expected main.go to be restored, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected legacy repository to be migrated, got %v", err)
+	}
+}
+
+// TestMovedWorkspaceOtherProject tests that the checkpoints of a missing workspace are not
+// adopted by a directory of another project
+func TestMovedWorkspaceOtherProject(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	oldDir := filepath.Join(t.TempDir(), "project")
+	if err := os.MkdirAll(oldDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	initProject(t, oldDir, "First project")
+	manager := newTestManager(t, "task-other-project", oldDir)
+	if _, err := manager.CreateCheckpoint("Before removal", ""); err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		t.Fatalf("Failed to remove workspace: %v", err)
+	}
+
+	otherProject := t.TempDir()
+	initProject(t, otherProject, "Second project")
+	for _, dir := range []string{otherProject, t.TempDir()} {
+		other := newTestManager(t, "task-other-project", dir)
+		checkpoints, err := other.GetCheckpoints()
+		if err != nil {
+			t.Fatalf("Failed to get checkpoints: %v", err)
+		}
+		if len(checkpoints) != 0 {
+			t.Errorf("Expected %s not to adopt the checkpoints of another project, got %+v", dir, checkpoints)
+		}
+	}
+}
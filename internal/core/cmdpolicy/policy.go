@@ -0,0 +1,276 @@
+// Package cmdpolicy evaluates the commands the AI runs with execute_command against allow and
+// deny rules, before they are approved.
+package cmdpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+// regexPrefix marks a rule written as a regular expression instead of a glob
+const regexPrefix = "re:"
+
+// DefaultDeny are the built-in deny rules: commands destroying data outside the workspace,
+// rewriting the history of a remote, and publishing packages
+var DefaultDeny = []string{
+	`re:^rm\s+(-\S+\s+)*(/|/\*|~|~/|\$HOME|\$HOME/)(\s|$)`,
+	`re:^git\s+push\b.*\s(--force|-f)(\s|=|$)`,
+	`re:^(npm|yarn|pnpm)\s+publish\b`,
+	`re:^cargo\s+publish\b`,
+	`re:^gem\s+push\b`,
+	`re:^twine\s+upload\b`,
+	`re:^poetry\s+publish\b`,
+	`re:^mkfs(\.\w+)?\b`,
+	`re:^dd\b.*\bof=/dev/`,
+	// The fork bomb is matched against the whole command, it is made of several commands
+	`re::\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`,
+}
+
+// Verdict is the outcome of the evaluation of a command
+type Verdict int
+
+const (
+	// Ask leaves the command to the usual approval
+	Ask Verdict = iota
+	// Allow runs the command without asking
+	Allow
+	// Deny refuses the command unless the user approves it explicitly
+	Deny
+)
+
+// Decision is the verdict of the policy on a command and the rule that decided it
+type Decision struct {
+	Verdict Verdict
+	// Rule is the matching rule as configured, empty for Ask
+	Rule string
+}
+
+// rule is a compiled allow or deny rule
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Policy holds the compiled rules of a command policy. A nil policy asks for every command.
+type Policy struct {
+	allow []rule
+	deny  []rule
+}
+
+// New compiles a command policy, with the built-in deny rules unless they are disabled
+func New(cfg config.CommandPolicy) (*Policy, error) {
+	deny := cfg.Deny
+	if !cfg.DisableDefaults {
+		deny = append(append([]string{}, DefaultDeny...), deny...)
+	}
+	p := &Policy{}
+	var err error
+	if p.allow, err = compile(cfg.Allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = compile(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// compile compiles rules written as globs or regular expressions
+func compile(patterns []string) ([]rule, error) {
+	var rules []rule
+	for _, pattern := range patterns {
+		expr, ok := strings.CutPrefix(pattern, regexPrefix)
+		if !ok {
+			expr = globToRegexp(pattern)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command policy rule %q: %w", pattern, err)
+		}
+		rules = append(rules, rule{pattern: pattern, re: re})
+	}
+	return rules, nil
+}
+
+// globToRegexp converts a glob matching a whole command to a regular expression.
+// * matches any text, spaces and slashes included, and ? any character.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Evaluate decides whether a command runs. The deny rules are matched against the whole
+// command and each of the commands it chains with ;, &&, || or |, and win over the allow rules.
+// The command is allowed when each of its commands matches an allow rule, unless it runs
+// commands in the background, substitutes commands or redirects to files, which are asked.
+func (p *Policy) Evaluate(command string) Decision {
+	if p == nil {
+		return Decision{Verdict: Ask}
+	}
+	command = strings.TrimSpace(command)
+	segments := Split(command)
+	for _, r := range p.deny {
+		if r.re.MatchString(command) {
+			return Decision{Verdict: Deny, Rule: r.pattern}
+		}
+		for _, segment := range segments {
+			if r.re.MatchString(segment) {
+				return Decision{Verdict: Deny, Rule: r.pattern}
+			}
+		}
+	}
+
+	if len(p.allow) == 0 || len(segments) == 0 || redirects(command) {
+		return Decision{Verdict: Ask}
+	}
+	var matched string
+	for _, segment := range segments {
+		r, ok := match(p.allow, segment)
+		if !ok {
+			return Decision{Verdict: Ask}
+		}
+		matched = r.pattern
+	}
+	return Decision{Verdict: Allow, Rule: matched}
+}
+
+// match returns the first rule matching a command
+func match(rules []rule, command string) (rule, bool) {
+	for _, r := range rules {
+		if r.re.MatchString(command) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// Split splits a shell command into the commands it chains with ;, &&, ||, | and newlines,
+// outside of quotes. The leading sudo, env and variable assignments of each command are removed,
+// so the rules match the program that runs.
+func Split(command string) []string {
+	var segments []string
+	for _, segment := range splitChain(command) {
+		if rest, _ := trimPrefixes(segment); rest != "" {
+			segments = append(segments, rest)
+		}
+	}
+	return segments
+}
+
+// splitChain splits a shell command into the commands it chains with ;, &&, ||, | and
+// newlines, outside of quotes, keeping their prefixes
+func splitChain(command string) []string {
+	var segments []string
+	var current strings.Builder
+	flush := func() {
+		if segment := strings.TrimSpace(current.String()); segment != "" {
+			segments = append(segments, segment)
+		}
+		current.Reset()
+	}
+
+	var quote rune
+	escaped := false
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';' || r == '\n' || r == '|':
+			flush()
+			if r == '|' && i+1 < len(runes) && runes[i+1] == '|' {
+				i++
+			}
+			continue
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			flush()
+			i++
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+	return segments
+}
+
+// trimPrefixes removes the words that run the program of a command on its behalf: sudo, env,
+// command, exec and variable assignments, whose values may be quoted. It also reports whether
+// the command sets variables, which can change what the program runs.
+func trimPrefixes(command string) (string, bool) {
+	assigns := false
+	rest := strings.TrimSpace(command)
+	for rest != "" {
+		word, next := nextWord(rest)
+		switch {
+		case word == "sudo" || word == "env" || word == "command" || word == "exec":
+		case isAssignment(word):
+			assigns = true
+		default:
+			return rest, assigns
+		}
+		rest = next
+	}
+	return "", assigns
+}
+
+// nextWord splits the first shell word of a command, as written with its quotes, from the
+// rest of the command
+func nextWord(command string) (string, string) {
+	var quote rune
+	escaped := false
+	for i, r := range command {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case unicode.IsSpace(r):
+			return command[:i], strings.TrimSpace(command[i:])
+		}
+	}
+	return command, ""
+}
+
+// isAssignment reports whether a shell word assigns a variable, e.g. FOO='a b'
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
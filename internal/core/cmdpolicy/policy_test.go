@@ -0,0 +1,90 @@
+package cmdpolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+func TestSplit(t *testing.T) {
+	tests := map[string][]string{
+		"go test ./...":                       {"go test ./..."},
+		"cd web && npm ci || echo failed; ls": {"cd web", "npm ci", "echo failed", "ls"},
+		"cat a.txt | grep 'x | y; z'":         {"cat a.txt", "grep 'x | y; z'"},
+		"sudo FOO=1 env rm -rf /":             {"rm -rf /"},
+		"FOO='a b' BAR=\"c d\" rm -rf /":      {"rm -rf /"},
+		"1FOO=x ls":                           {"1FOO=x ls"},
+		"echo \"a && b\" && make":             {"echo \"a && b\"", "make"},
+		"  ":                                  nil,
+	}
+	for command, want := range tests {
+		if got := Split(command); !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policy, err := New(config.CommandPolicy{
+		Allow: []string{"go test*", "go build*", "re:^git (status|diff)\\b"},
+		Deny:  []string{"go test ./internal/secret*"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := map[string]Verdict{
+		"go test ./...":                   Allow,
+		"go build ./... && go test ./...": Allow,
+		"git status":                      Allow,
+		"go test ./... && make":           Ask,
+		"make":                            Ask,
+		"go test ./internal/secret/...":   Deny,
+		"rm -rf /":                        Deny,
+		"sudo rm -rf ~":                   Deny,
+		"rm -rf ./build":                  Ask,
+		"git push --force origin main":    Deny,
+		"git push -f":                     Deny,
+		"git push origin main":            Ask,
+		"go test ./... && npm publish":    Deny,
+		":(){ :|:& };:":                   Deny,
+		// Quoted assignments are skipped like the other prefixes
+		"FOO='a b' rm -rf /":                    Deny,
+		"GIT_DIR=\"x y\" git push --force":      Deny,
+		"env A='1 2' npm publish":               Deny,
+		"sudo FOO='a b' env BAR=\"c\" rm -rf ~": Deny,
+		// Allowed commands that run others in the background, substitute or redirect are asked
+		"go test ./... & rm -rf ~/work":   Ask,
+		"go test $(rm -rf ~/work)":        Ask,
+		"go test `rm -rf ~/work`":         Ask,
+		"go test ./... > ~/.bashrc":       Ask,
+		"go test ./... && go build ./...": Allow,
+	}
+	for command, want := range tests {
+		if got := policy.Evaluate(command); got.Verdict != want {
+			t.Errorf("Evaluate(%q) = %+v, want verdict %d", command, got, want)
+		}
+	}
+
+	if got := policy.Evaluate("go test ./internal/secret/..."); got.Rule != "go test ./internal/secret*" {
+		t.Errorf("deny rule = %q", got.Rule)
+	}
+	var none *Policy
+	if got := none.Evaluate("rm -rf /"); got.Verdict != Ask {
+		t.Errorf("nil policy verdict = %d, want Ask", got.Verdict)
+	}
+}
+
+func TestNewWithoutDefaults(t *testing.T) {
+	policy, err := New(config.CommandPolicy{DisableDefaults: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := policy.Evaluate("npm publish"); got.Verdict != Ask {
+		t.Errorf("Evaluate(npm publish) without defaults = %+v", got)
+	}
+	if _, err := New(config.CommandPolicy{Deny: []string{"re:("}}); err == nil {
+		t.Error("New() with an invalid regular expression succeeded")
+	}
+}
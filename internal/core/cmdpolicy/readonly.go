@@ -0,0 +1,103 @@
+package cmdpolicy
+
+// ReadOnlyCommands are the built-in rules of the commands allowed in read-only mode, which
+// read the workspace without modifying it
+var ReadOnlyCommands = []string{
+	`re:^(ls|tree|pwd|cat|head|tail|wc|file|stat|du|df|which|type|echo|printf|basename|dirname|realpath|readlink|diff|cmp|grep|egrep|fgrep|rg|find|cut|sort|tr|column|nl|jq|md5sum|sha1sum|sha256sum|whoami|uname|printenv)(\s|$)`,
+	`re:^git\s+(status|log|diff|show|blame|grep|ls-files|ls-tree|rev-parse|describe|shortlog|cat-file)(\s|$)`,
+	`re:^go\s+(list|doc|version)(\s|$)`,
+}
+
+// readOnlyExceptions are the options of the read-only commands that write files or run other
+// commands, e.g. go list -toolexec or file -C compiling a magic file, refused in read-only mode. Long options match by their prefix since sort and git
+// accept abbreviated ones, and short options match within bundled ones, e.g. sort -ro out.
+var readOnlyExceptions = []string{
+	`re:^find\s.*\s-(delete|exec|execdir|ok|okdir|fprint|fprint0|fprintf|fls)(\s|$)`,
+	`re:^sort\s(.*\s)?(-[a-zA-Z]*o|--o|--co)`,
+	`re:^tree\s(.*\s)?-o(\s|$)`,
+	`re:^rg\s(.*\s)?--pre(\s|=|$)`,
+	`re:^git\s.*\s--(out|ext|textc)`,
+	`re:^git\s+grep\s(.*\s)?(-[a-zA-Z]*O|--open)`,
+	`re:^go\s+list\s(.*\s)?--?(toolexec|exec|mod|modfile|overlay)(\s|=|$)`,
+	`re:^file\s(.*\s)?(-[a-zA-Z]*C|--compile)`,
+}
+
+// ReadOnly decides which commands run in read-only mode, where the AI explores the workspace
+// without modifying it
+type ReadOnly struct {
+	allow      []rule
+	exceptions []rule
+}
+
+// NewReadOnly compiles the rules of the commands allowed in read-only mode: ReadOnlyCommands
+// and the configured ones
+func NewReadOnly(allow []string) (*ReadOnly, error) {
+	r := &ReadOnly{}
+	var err error
+	if r.allow, err = compile(append(append([]string{}, ReadOnlyCommands...), allow...)); err != nil {
+		return nil, err
+	}
+	if r.exceptions, err = compile(readOnlyExceptions); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Allows reports whether a command may run in read-only mode: each of the commands it chains
+// must match a rule, and none may redirect its output to a file, substitute another command
+// or set environment variables, e.g. GIT_EXTERNAL_DIFF, that make it run other commands
+func (r *ReadOnly) Allows(command string) bool {
+	if redirects(command) {
+		return false
+	}
+	chain := splitChain(command)
+	if len(chain) == 0 {
+		return false
+	}
+	for _, segment := range chain {
+		segment, assigns := trimPrefixes(segment)
+		if assigns || segment == "" {
+			return false
+		}
+		if _, ok := match(r.allow, segment); !ok {
+			return false
+		}
+		if _, ok := match(r.exceptions, segment); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// redirects reports whether a command redirects an output to a file or substitutes a process,
+// outside of quotes, runs in the background or substitutes commands, even in double quotes
+func redirects(command string) bool {
+	var quote rune
+	escaped := false
+	runes := []rune(command)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			}
+		case r == '`' || (r == '$' && i+1 < len(runes) && runes[i+1] == '('):
+			return true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '>' || (r == '<' && i+1 < len(runes) && runes[i+1] == '('):
+			return true
+		case r == '&' && (i+1 >= len(runes) || runes[i+1] != '&') && (i == 0 || runes[i-1] != '&'):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package cmdpolicy
+
+import "testing"
+
+func TestReadOnlyAllows(t *testing.T) {
+	readOnly, err := NewReadOnly([]string{"make lint"})
+	if err != nil {
+		t.Fatalf("NewReadOnly() error = %v", err)
+	}
+
+	tests := map[string]bool{
+		"ls -la":                              true,
+		"grep -rn 'a > b' internal | head":    true,
+		"git log --oneline -5 && git status":  true,
+		"find . -name '*.go'":                 true,
+		"make lint":                           true,
+		"rm -rf build":                        false,
+		"cat a.txt > b.txt":                   false,
+		"echo $(rm -rf x)":                    false,
+		"echo \"`touch x`\"":                  false,
+		"ls & rm x":                           false,
+		"find . -name '*.tmp' -delete":        false,
+		"sort -o out.txt in.txt":              false,
+		"git diff --output=patch.diff":        false,
+		"git push":                            false,
+		"ls; make":                            false,
+		"cat <(touch x)":                      false,
+		"diff a.txt >(tee b.txt)":             false,
+		"GIT_EXTERNAL_DIFF=x.sh git diff":     false,
+		"env GIT_PAGER=x.sh git log":          false,
+		"git diff --ext-diff":                 false,
+		"git diff --no-ext-diff":              true,
+		"git log -p --textconv":               false,
+		"git grep -O'sh -c id' main":          false,
+		"git grep -nO vim main":               false,
+		"git grep --open-files-in-pager main": false,
+		"sort --compress-program=sh in.txt":   false,
+		"sort --compress-prog=sh in.txt":      false,
+		"sort -ro out.txt in.txt":             false,
+		"sort -r in.txt":                      true,
+		"go list -json ./...":                 true,
+		"go list -toolexec=sh -export ./...":  false,
+		"go list -exec x.sh ./...":            false,
+		"go list -mod=mod -m all":             false,
+		"go list -modfile=alt.mod ./...":      false,
+		"go list --overlay=o.json ./...":      false,
+		"file main.go":                        true,
+		"file -C -m magic":                    false,
+		"file -bC":                            false,
+		"file --compile":                      false,
+		"":                                    false,
+	}
+	for command, want := range tests {
+		if got := readOnly.Allows(command); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// Roles of the turns in a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ErrNoAssistantTurn is returned when a retry is requested but the conversation does not end with an assistant turn
+var ErrNoAssistantTurn = errors.New("no assistant turn to retry")
+
+// Alternative is an earlier attempt at an assistant turn that was discarded by a retry
+type Alternative struct {
+	// Content of the discarded attempt
+	Content string
+	// Provider that generated the discarded attempt
+	Provider string
+	// Model that generated the discarded attempt
+	Model string
+	// CreatedAt is when the discarded attempt was generated
+	CreatedAt time.Time
+}
+
+// Turn is a message in a conversation
+type Turn struct {
+	// Role of the message sender, RoleUser or RoleAssistant
+	Role string
+	// Content of the message
+	Content string
+	// Provider that generated an assistant turn
+	Provider string
+	// Model that generated an assistant turn
+	Model string
+	// CreatedAt is when the turn was added
+	CreatedAt time.Time
+	// Usage is the token usage of generating an assistant turn, nil if unknown
+	Usage *provider.Usage
+	// Alternatives are the discarded attempts at an assistant turn, oldest first
+	Alternatives []Alternative
+	// Images are attached to a user turn
+	Images []provider.Image
+}
+
+// Conversation holds the turns exchanged with the AI agent in a task
+type Conversation struct {
+	mu    sync.Mutex
+	turns []Turn
+}
+
+// New creates an empty conversation
+func New() *Conversation {
+	return &Conversation{}
+}
+
+// AddUserMessage appends a user turn, with the images attached to it
+func (c *Conversation) AddUserMessage(content string, images ...provider.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.turns = append(c.turns, Turn{
+		Role:      RoleUser,
+		Content:   content,
+		Images:    images,
+		CreatedAt: time.Now(),
+	})
+}
+
+// AddAssistantMessage appends an assistant turn generated by a provider and model
+func (c *Conversation) AddAssistantMessage(content, providerName, model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.turns = append(c.turns, Turn{
+		Role:      RoleAssistant,
+		Content:   content,
+		Provider:  providerName,
+		Model:     model,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Turns returns a copy of the turns of the conversation
+func (c *Conversation) Turns() []Turn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	turns := make([]Turn, len(c.turns))
+	for i, turn := range c.turns {
+		turn.Alternatives = append([]Alternative(nil), turn.Alternatives...)
+		turns[i] = turn
+	}
+	return turns
+}
+
+// Messages returns the conversation as messages to send to a provider.
+// Discarded alternatives are not sent. The latest user turns carry cache hints, as the
+// conversation only grows between requests.
+func (c *Conversation) Messages() []provider.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	messages := make([]provider.Message, len(c.turns))
+	for i, turn := range c.turns {
+		messages[i] = provider.Message{
+			Role:    turn.Role,
+			Content: turn.Content,
+			Images:  turn.Images,
+		}
+	}
+	provider.MarkCacheHints(messages)
+	return messages
+}
+
+// Retry discards the last assistant turn and asks the provider to generate it again.
+// The provider may use a different model, and opts different parameters than the discarded turn.
+// The returned stream forwards the events of the provider until ctx is done. When it is closed,
+// the new answer is appended as the last assistant turn, with the discarded attempt added to its
+// alternatives. If the provider fails or ctx is done, the discarded turn is put back.
+func (c *Conversation) Retry(ctx context.Context, p provider.Provider, systemPrompt string, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	c.mu.Lock()
+	if len(c.turns) == 0 || c.turns[len(c.turns)-1].Role != RoleAssistant {
+		c.mu.Unlock()
+		return nil, ErrNoAssistantTurn
+	}
+	discarded := c.turns[len(c.turns)-1]
+	c.turns = c.turns[:len(c.turns)-1]
+	c.mu.Unlock()
+
+	events, err := p.CreateMessage(ctx, systemPrompt, c.Messages(), opts)
+	if err != nil {
+		c.restore(discarded)
+		return nil, fmt.Errorf("failed to regenerate the answer: %w", err)
+	}
+
+	alternatives := append(append([]Alternative(nil), discarded.Alternatives...), Alternative{
+		Content:   discarded.Content,
+		Provider:  discarded.Provider,
+		Model:     discarded.Model,
+		CreatedAt: discarded.CreatedAt,
+	})
+
+	out := make(chan provider.StreamEvent)
+	go func() {
+		defer close(out)
+
+		var content strings.Builder
+		var usage *provider.Usage
+		failed := false
+		for event := range events {
+			switch event.Type {
+			case "text":
+				content.WriteString(event.Text)
+			case "usage":
+				usage = event.Usage
+			case "error":
+				failed = true
+			}
+			// The caller stops reading once ctx is done
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				c.restore(discarded)
+				return
+			}
+		}
+
+		if failed || ctx.Err() != nil {
+			c.restore(discarded)
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.turns = append(c.turns, Turn{
+			Role:         RoleAssistant,
+			Content:      content.String(),
+			Provider:     p.Name(),
+			Model:        p.GetModel().Name,
+			CreatedAt:    time.Now(),
+			Usage:        usage,
+			Alternatives: alternatives,
+		})
+	}()
+	return out, nil
+}
+
+// restore puts back an assistant turn discarded by a failed retry
+func (c *Conversation) restore(turn Turn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.turns = append(c.turns, turn)
+}
+
+// Summary returns a one-line, collapsed description of the alternatives of a turn,
+// or an empty string if there are none
+func (t Turn) Summary() string {
+	if len(t.Alternatives) == 0 {
+		return ""
+	}
+	models := make([]string, len(t.Alternatives))
+	for i, alternative := range t.Alternatives {
+		models[i] = modelLabel(alternative.Provider, alternative.Model)
+	}
+	return fmt.Sprintf("[%d alternative(s): %s]", len(t.Alternatives), strings.Join(models, ", "))
+}
+
+// ToProto converts an assistant turn to an AI response
+func (t Turn) ToProto() *pb.AIResponse {
+	response := &pb.AIResponse{
+		Content:  t.Content,
+		Provider: t.Provider,
+		Model:    t.Model,
+		Usage:    UsageToProto(t.Usage),
+	}
+	for _, alternative := range t.Alternatives {
+		response.Alternatives = append(response.Alternatives, &pb.AIResponseAlternative{
+			Content:   alternative.Content,
+			Provider:  alternative.Provider,
+			Model:     alternative.Model,
+			CreatedAt: alternative.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return response
+}
+
+// UsageToProto converts the token usage of a provider, nil if unknown
+func UsageToProto(usage *provider.Usage) *pb.TokenUsage {
+	if usage == nil {
+		return nil
+	}
+	return &pb.TokenUsage{
+		InputTokens:      int64(usage.InputTokens),
+		OutputTokens:     int64(usage.OutputTokens),
+		CacheReadTokens:  int64(usage.CacheReadTokens),
+		CacheWriteTokens: int64(usage.CacheWriteTokens),
+		TotalCost:        usage.TotalCost,
+	}
+}
+
+// modelLabel returns provider/model for display
+func modelLabel(providerName, model string) string {
+	switch {
+	case providerName == "":
+		return model
+	case model == "":
+		return providerName
+	default:
+		return providerName + "/" + model
+	}
+}
@@ -0,0 +1,145 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+// drain reads a stream until it is closed
+func drain(events chan provider.StreamEvent) {
+	for range events {
+	}
+}
+
+func TestRetry(t *testing.T) {
+	c := New()
+	c.AddUserMessage("question")
+	c.AddAssistantMessage("first answer", "mock", "model-a")
+
+	p := mock.New(&mock.Fixture{Model: "model-b", Responses: []mock.Response{{Events: []mock.Event{
+		{Type: "text", Text: "second "},
+		{Type: "usage", Usage: &mock.Usage{InputTokens: 1}},
+		{Type: "text", Text: "answer"},
+	}}}})
+	events, err := c.Retry(context.Background(), p, "system", provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	drain(events)
+
+	// The discarded answer is not sent back to the provider
+	if sent := p.Requests()[0].Messages; len(sent) != 1 || sent[0].Content != "question" {
+		t.Errorf("messages sent = %+v, want only the question", sent)
+	}
+
+	turns := c.Turns()
+	if len(turns) != 2 {
+		t.Fatalf("len(turns) = %d, want 2", len(turns))
+	}
+	last := turns[1]
+	if last.Content != "second answer" || last.Model != "model-b" || last.Provider != "mock" {
+		t.Errorf("last turn = %+v", last)
+	}
+	if last.Usage == nil || last.Usage.InputTokens != 1 {
+		t.Errorf("usage = %+v, want the usage of the stream", last.Usage)
+	}
+	if len(last.Alternatives) != 1 || last.Alternatives[0].Content != "first answer" || last.Alternatives[0].Model != "model-a" {
+		t.Errorf("alternatives = %+v", last.Alternatives)
+	}
+
+	// Retrying again keeps every earlier attempt, oldest first
+	p = mock.New(&mock.Fixture{Model: "model-c", Responses: []mock.Response{{Text: "third answer"}}})
+	events, err = c.Retry(context.Background(), p, "system", provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	drain(events)
+
+	last = c.Turns()[1]
+	if last.Content != "third answer" || len(last.Alternatives) != 2 {
+		t.Fatalf("last turn = %+v", last)
+	}
+	if last.Alternatives[0].Content != "first answer" || last.Alternatives[1].Content != "second answer" {
+		t.Errorf("alternatives = %+v", last.Alternatives)
+	}
+	if got, want := last.Summary(), "[2 alternative(s): mock/model-a, mock/model-b]"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+
+	response := last.ToProto()
+	if response.Model != "model-c" || len(response.Alternatives) != 2 || response.Alternatives[1].Model != "model-b" {
+		t.Errorf("ToProto() = %+v", response)
+	}
+}
+
+func TestRetryWithoutAssistantTurn(t *testing.T) {
+	c := New()
+	if _, err := c.Retry(context.Background(), mock.New(&mock.Fixture{}), "", provider.GenerationOptions{}); !errors.Is(err, ErrNoAssistantTurn) {
+		t.Errorf("Retry() on empty conversation error = %v, want ErrNoAssistantTurn", err)
+	}
+
+	c.AddUserMessage("question")
+	if _, err := c.Retry(context.Background(), mock.New(&mock.Fixture{}), "", provider.GenerationOptions{}); !errors.Is(err, ErrNoAssistantTurn) {
+		t.Errorf("Retry() after user turn error = %v, want ErrNoAssistantTurn", err)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	c := New()
+	c.AddUserMessage("question")
+	c.AddAssistantMessage("answer", "mock", "model-a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := c.Retry(ctx, mock.New(&mock.Fixture{Responses: []mock.Response{{Events: []mock.Event{
+		{Type: "text", Text: "partial"},
+		{Type: "text", Text: " answer"},
+	}}}}), "", provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	// The discarded turn is put back without the stream being read once the caller gave up
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.Turns()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the retry still waits for the stream to be read after the context was cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if turns := c.Turns(); turns[1].Content != "answer" {
+		t.Errorf("turns after cancelled retry = %+v", turns)
+	}
+	if _, ok := <-events; ok {
+		t.Error("the stream was not closed")
+	}
+}
+
+func TestRetryFailureRestoresTurn(t *testing.T) {
+	c := New()
+	c.AddUserMessage("question")
+	c.AddAssistantMessage("answer", "mock", "model-a")
+
+	if _, err := c.Retry(context.Background(), mock.New(&mock.Fixture{Responses: []mock.Response{{Error: "boom"}}}), "", provider.GenerationOptions{}); err == nil {
+		t.Fatal("Retry() error = nil, want error")
+	}
+	if turns := c.Turns(); len(turns) != 2 || turns[1].Content != "answer" {
+		t.Errorf("turns after failed request = %+v", turns)
+	}
+
+	events, err := c.Retry(context.Background(), mock.New(&mock.Fixture{Responses: []mock.Response{{Events: []mock.Event{
+		{Type: "text", Text: "partial"},
+		{Type: "error", Text: "API error"},
+	}}}}), "", provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	drain(events)
+	if turns := c.Turns(); len(turns) != 2 || turns[1].Content != "answer" || len(turns[1].Alternatives) != 0 {
+		t.Errorf("turns after failed stream = %+v", turns)
+	}
+}
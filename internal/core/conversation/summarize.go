@@ -0,0 +1,217 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+const (
+	// DefaultSummarizeThreshold is the share of the context window above which older turns are summarized
+	DefaultSummarizeThreshold = 0.8
+	// DefaultKeepTurns is the number of recent turns kept verbatim when older turns are summarized
+	DefaultKeepTurns = 6
+	// charsPerToken is the average length of a token, used to estimate the size of a request
+	charsPerToken = 4
+	// tokensPerImage is the number of tokens of an image scaled down to the size the models read
+	tokensPerImage = 1600
+	// maxTranscriptTurn limits the length of a turn in the transcript sent to be summarized
+	maxTranscriptTurn = 8000
+	// summaryTag encloses the summary added to the first turn
+	summaryTag = "conversation_summary"
+)
+
+// summarizePrompt is the system prompt of a summarization pass
+const summarizePrompt = `You summarize the beginning of a conversation between a user and Goline, an AI software engineer working on a task with tools, so the conversation can continue within the context window.
+
+Write a concise summary that lets Goline continue the task without the original messages. Keep:
+- the goal of the task and the requirements given by the user
+- the decisions made and why
+- the files read, created or changed, with the facts learned about them
+- the commands run and their important results, including errors not fixed yet
+- what remains to be done
+
+Only output the summary.`
+
+// ErrNothingToSummarize is returned when the conversation has no older turns that can be summarized
+var ErrNothingToSummarize = errors.New("no older turns to summarize")
+
+// EstimateTokens estimates the number of tokens of a request from its length and its images
+func EstimateTokens(systemPrompt string, messages []provider.Message) int {
+	chars, images := len(systemPrompt), 0
+	for _, message := range messages {
+		chars += len(message.Content)
+		images += len(message.Images)
+	}
+	return chars/charsPerToken + images*tokensPerImage
+}
+
+// Summarizer keeps a conversation within the context window of a model by compressing its
+// older turns into a summary
+type Summarizer struct {
+	// Provider generates the summaries, e.g. with a cheaper model
+	Provider provider.Provider
+	// Threshold is the share of the context window above which older turns are summarized,
+	// DefaultSummarizeThreshold if zero
+	Threshold float64
+	// KeepTurns is the number of recent turns kept verbatim, DefaultKeepTurns if zero
+	KeepTurns int
+}
+
+// Summary is the outcome of a summarization pass
+type Summary struct {
+	// Content is the summary that replaced the original turns
+	Content string
+	// Originals are the turns replaced by the summary, oldest first
+	Originals []Turn
+	// Provider is the provider that generated the summary
+	Provider string
+	// Model is the model that generated the summary
+	Model string
+	// Usage is the token usage of generating the summary, nil if unknown
+	Usage *provider.Usage
+}
+
+// NeedsSummary reports whether a request with the conversation would exceed the threshold of a context window
+func (s *Summarizer) NeedsSummary(contextWindow int, systemPrompt string, c *Conversation) bool {
+	if contextWindow <= 0 {
+		return false
+	}
+	threshold := s.Threshold
+	if threshold <= 0 {
+		threshold = DefaultSummarizeThreshold
+	}
+	return float64(EstimateTokens(systemPrompt, c.Messages())) > threshold*float64(contextWindow)
+}
+
+// Summarize compresses the older turns of the conversation into a summary added to the first
+// turn, which holds the task. The recent turns are kept verbatim.
+// ErrNothingToSummarize is returned when there are not enough turns to compress.
+func (s *Summarizer) Summarize(ctx context.Context, c *Conversation) (*Summary, error) {
+	keep := s.KeepTurns
+	if keep <= 0 {
+		keep = DefaultKeepTurns
+	}
+	turns := c.Turns()
+	count := splitPoint(turns, keep)
+	if count == 0 {
+		return nil, ErrNothingToSummarize
+	}
+
+	events, err := s.Provider.CreateMessage(ctx, summarizePrompt, []provider.Message{{Role: RoleUser, Content: transcript(turns[:count])}}, provider.GenerationOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request summary: %w", err)
+	}
+	var content strings.Builder
+	var usage *provider.Usage
+	for event := range events {
+		switch event.Type {
+		case "text":
+			content.WriteString(event.Text)
+		case "usage":
+			usage = event.Usage
+		case "error":
+			err = errors.New(event.Text)
+		}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("summary request failed: %w", err)
+	}
+	text := strings.TrimSpace(content.String())
+	if text == "" {
+		return nil, errors.New("the summary is empty")
+	}
+
+	originals, err := c.compact(turns[:count], text)
+	if err != nil {
+		return nil, err
+	}
+	return &Summary{
+		Content:   text,
+		Originals: originals,
+		Provider:  s.Provider.Name(),
+		Model:     s.Provider.GetModel().Name,
+		Usage:     usage,
+	}, nil
+}
+
+// splitPoint returns the number of older turns to summarize, keeping at least keep recent turns.
+// The summarized turns end with a user turn, so the conversation still alternates once the
+// summary is added to the first turn. It returns 0 when no turn can be summarized.
+func splitPoint(turns []Turn, keep int) int {
+	if len(turns) == 0 || turns[0].Role != RoleUser {
+		return 0
+	}
+	for count := len(turns) - keep; count >= 2; count-- {
+		if turns[count].Role == RoleAssistant && turns[count-1].Role == RoleUser {
+			return count
+		}
+	}
+	return 0
+}
+
+// transcript formats turns to be summarized
+func transcript(turns []Turn) string {
+	var b strings.Builder
+	b.WriteString("Summarize this beginning of the conversation:\n\n")
+	for _, turn := range turns {
+		content := turn.Content
+		if len(content) > maxTranscriptTurn {
+			content = content[:maxTranscriptTurn] + "\n[... truncated ...]"
+		}
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", turn.Role, content)
+	}
+	return b.String()
+}
+
+// compact replaces the first turns of the conversation with a user turn holding the task and
+// the summary, and returns the replaced turns. It fails if the conversation changed since
+// the turns were read.
+func (c *Conversation) compact(turns []Turn, summary string) ([]Turn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.turns) < len(turns) {
+		return nil, errors.New("the conversation changed while it was summarized")
+	}
+	for i, turn := range turns {
+		if c.turns[i].Content != turn.Content || c.turns[i].Role != turn.Role {
+			return nil, errors.New("the conversation changed while it was summarized")
+		}
+	}
+
+	// A previous summary is replaced, as the new one covers it. The images attached to the task
+	// are kept with it.
+	task, _, _ := strings.Cut(c.turns[0].Content, "\n\n<"+summaryTag+">")
+	first := Turn{
+		Role:      RoleUser,
+		Content:   fmt.Sprintf("%s\n\n<%s>\nThe earlier part of this conversation was summarized to fit the context window:\n%s\n</%s>", task, summaryTag, summary, summaryTag),
+		Images:    c.turns[0].Images,
+		CreatedAt: time.Now(),
+	}
+	originals := append([]Turn(nil), c.turns[:len(turns)]...)
+	c.turns = append([]Turn{first}, c.turns[len(turns):]...)
+	return originals, nil
+}
+
+// ToProto converts a summary to the event recording it with the original turns
+func (s *Summary) ToProto() *pb.ContextSummaryEvent {
+	event := &pb.ContextSummaryEvent{
+		Summary:  s.Content,
+		Provider: s.Provider,
+		Model:    s.Model,
+		Usage:    UsageToProto(s.Usage),
+	}
+	for _, turn := range s.Originals {
+		event.OriginalTurns = append(event.OriginalTurns, &pb.ConversationTurn{Role: turn.Role, Content: turn.Content})
+	}
+	return event
+}
@@ -0,0 +1,116 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+// newLongConversation creates a conversation of alternating turns starting with the task
+func newLongConversation(turns int) *Conversation {
+	c := New()
+	c.AddUserMessage("the task")
+	for i := 1; i < turns; i++ {
+		if i%2 == 1 {
+			c.AddAssistantMessage(fmt.Sprintf("answer %d", i), "fake", "model")
+		} else {
+			c.AddUserMessage(fmt.Sprintf("result %d", i))
+		}
+	}
+	return c
+}
+
+func TestNeedsSummary(t *testing.T) {
+	c := New()
+	c.AddUserMessage(strings.Repeat("x", 400))
+	s := &Summarizer{}
+
+	if s.NeedsSummary(0, "", c) {
+		t.Error("NeedsSummary() with unknown window = true, want false")
+	}
+	if s.NeedsSummary(1000, "", c) {
+		t.Error("NeedsSummary() at 10% of the window = true, want false")
+	}
+	if !s.NeedsSummary(110, "", c) {
+		t.Error("NeedsSummary() at 90% of the window = false, want true")
+	}
+	s.Threshold = 0.95
+	if s.NeedsSummary(110, "", c) {
+		t.Error("NeedsSummary() under a 95% threshold = true, want false")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	c := newLongConversation(11)
+	p := mock.New(&mock.Fixture{Model: "cheap", Responses: []mock.Response{
+		{Events: []mock.Event{
+			{Type: "text", Text: "the "},
+			{Type: "text", Text: "summary"},
+			{Type: "usage", Usage: &mock.Usage{InputTokens: 100, OutputTokens: 10}},
+		}},
+		{Text: "newer summary"},
+	}})
+	s := &Summarizer{Provider: p, KeepTurns: 4}
+
+	summary, err := s.Summarize(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+	if summary.Content != "the summary" || summary.Model != "cheap" || summary.Usage.InputTokens != 100 {
+		t.Errorf("summary = %+v", summary)
+	}
+	// Turns 0-6 are summarized, turn 7 is the oldest assistant turn kept with at least 4 turns
+	if len(summary.Originals) != 7 || summary.Originals[6].Content != "result 6" {
+		t.Fatalf("originals = %+v", summary.Originals)
+	}
+	if sent := p.Requests()[0].Messages[0].Content; !strings.Contains(sent, "[assistant]\nanswer 5") {
+		t.Errorf("transcript = %q", sent)
+	}
+
+	turns := c.Turns()
+	if len(turns) != 5 || turns[1].Content != "answer 7" || turns[4].Content != "result 10" {
+		t.Fatalf("turns after summary = %+v", turns)
+	}
+	if first := turns[0]; first.Role != RoleUser || !strings.HasPrefix(first.Content, "the task\n\n<conversation_summary>") || !strings.Contains(first.Content, "the summary") {
+		t.Errorf("first turn = %+v", first)
+	}
+
+	// A second summary replaces the first one
+	for i := 11; i < 17; i++ {
+		if i%2 == 1 {
+			c.AddAssistantMessage(fmt.Sprintf("answer %d", i), "fake", "model")
+		} else {
+			c.AddUserMessage(fmt.Sprintf("result %d", i))
+		}
+	}
+	if _, err := s.Summarize(context.Background(), c); err != nil {
+		t.Fatalf("second Summarize() error = %v", err)
+	}
+	first := c.Turns()[0].Content
+	if strings.Count(first, "<conversation_summary>") != 1 || !strings.Contains(first, "newer summary") || !strings.HasPrefix(first, "the task") {
+		t.Errorf("first turn after second summary = %q", first)
+	}
+}
+
+func TestSummarizeNothingToSummarize(t *testing.T) {
+	c := newLongConversation(5)
+	s := &Summarizer{Provider: mock.New(&mock.Fixture{}), KeepTurns: 4}
+	if _, err := s.Summarize(context.Background(), c); !errors.Is(err, ErrNothingToSummarize) {
+		t.Errorf("Summarize() error = %v, want ErrNothingToSummarize", err)
+	}
+}
+
+func TestSummarizeFailureKeepsTurns(t *testing.T) {
+	c := newLongConversation(11)
+	s := &Summarizer{Provider: mock.New(&mock.Fixture{Responses: []mock.Response{{Events: []mock.Event{{Type: "error", Text: "API error"}}}}}), KeepTurns: 4}
+	if _, err := s.Summarize(context.Background(), c); err == nil {
+		t.Fatal("Summarize() error = nil, want error")
+	}
+	if turns := c.Turns(); len(turns) != 11 || turns[0].Content != "the task" {
+		t.Errorf("turns after failed summary = %+v", turns)
+	}
+}
@@ -0,0 +1,369 @@
+// Package export renders the persisted history of a task into a shareable document.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Format is the format of an exported transcript
+type Format string
+
+// Export formats
+const (
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+	FormatJSON     Format = "json"
+)
+
+// Formats returns the names of all export formats
+func Formats() []string {
+	return []string{string(FormatMarkdown), string(FormatHTML), string(FormatJSON)}
+}
+
+// Transcript is the data of a task rendered by an export
+type Transcript struct {
+	// Task is the task metadata
+	Task *pb.Task
+	// History is the conversation history of the task
+	History *pb.TaskHistory
+}
+
+// Render writes the transcript to w in the given format
+func Render(w io.Writer, format Format, transcript Transcript) error {
+	switch format {
+	case FormatMarkdown:
+		return renderMarkdown(w, transcript)
+	case FormatHTML:
+		return renderHTML(w, transcript)
+	case FormatJSON:
+		return renderJSON(w, transcript)
+	default:
+		return fmt.Errorf("unknown export format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+}
+
+// renderJSON writes the task metadata and history as protobuf JSON
+func renderJSON(w io.Writer, transcript Transcript) error {
+	marshal := protojson.MarshalOptions{UseProtoNames: true}
+	task, err := marshal.Marshal(transcript.Task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+	history, err := marshal.Marshal(transcript.History)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]json.RawMessage{
+		"task":    task,
+		"history": history,
+	})
+}
+
+// entry is an event of the history prepared for rendering
+type entry struct {
+	// Title is the heading of the entry
+	Title string
+	// Timestamp is when the event occurred
+	Timestamp string
+	// Text is prose, such as a message
+	Text string
+	// Blocks are code blocks, such as tool arguments or diffs
+	Blocks []block
+	// Alternatives are the discarded attempts at an AI response
+	Alternatives []alternative
+}
+
+// block is a code block of an entry
+type block struct {
+	// Label describes the block
+	Label string
+	// Language is the language of the block for syntax highlighting
+	Language string
+	// Code is the content of the block
+	Code string
+}
+
+// alternative is a discarded attempt at an AI response
+type alternative struct {
+	// Title names the attempt
+	Title string
+	// Text is the content of the attempt
+	Text string
+}
+
+// entries converts the events of the history for rendering
+func entries(history *pb.TaskHistory) []entry {
+	var result []entry
+	for _, event := range history.GetEvents() {
+		e := entry{Timestamp: event.Timestamp}
+		switch ev := event.Event.(type) {
+		case *pb.TaskEvent_UserMessage:
+			e.Title = "User"
+			e.Text = ev.UserMessage.Content
+		case *pb.TaskEvent_AiResponse:
+			e.Title = "Assistant"
+			if model := modelLabel(ev.AiResponse.Provider, ev.AiResponse.Model); model != "" {
+				e.Title += " (" + model + ")"
+			}
+			e.Text = ev.AiResponse.Content
+			for i, alt := range ev.AiResponse.Alternatives {
+				title := fmt.Sprintf("Alternative %d", i+1)
+				if model := modelLabel(alt.Provider, alt.Model); model != "" {
+					title += " (" + model + ")"
+				}
+				e.Alternatives = append(e.Alternatives, alternative{Title: title, Text: alt.Content})
+			}
+		case *pb.TaskEvent_ToolCall:
+			call := ev.ToolCall
+			e.Title = "Tool call: " + call.ToolName
+			if !call.Success {
+				e.Title += " (failed)"
+				e.Text = call.ErrorMessage
+			}
+			if call.Arguments != "" {
+				e.Blocks = append(e.Blocks, block{Label: "Arguments", Code: call.Arguments})
+			}
+			if call.Result != "" {
+				e.Blocks = append(e.Blocks, block{Label: "Result", Code: call.Result})
+			}
+		case *pb.TaskEvent_FileModification:
+			modification := ev.FileModification
+			e.Title = fmt.Sprintf("File %s: %s", modificationLabel(modification.Type), modification.FilePath)
+			if modification.Diff != "" {
+				e.Blocks = append(e.Blocks, block{Language: "diff", Code: modification.Diff})
+			}
+		case *pb.TaskEvent_Checkpoint:
+			checkpoint := ev.Checkpoint
+			operation := "saved"
+			if checkpoint.OperationType == pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_RESTORE {
+				operation = "restored"
+			}
+			e.Title = fmt.Sprintf("Checkpoint %s: %s", operation, checkpoint.CheckpointId)
+			e.Text = strings.TrimSpace(checkpoint.Name + "\n" + checkpoint.Description)
+		case *pb.TaskEvent_SystemEvent:
+			e.Title = "System"
+			e.Text = ev.SystemEvent.Content
+		case *pb.TaskEvent_ContextSummary:
+			e.Title = fmt.Sprintf("Context summary of %d earlier turn(s)", len(ev.ContextSummary.OriginalTurns))
+			if model := modelLabel(ev.ContextSummary.Provider, ev.ContextSummary.Model); model != "" {
+				e.Title += " (" + model + ")"
+			}
+			e.Text = ev.ContextSummary.Summary
+		default:
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// modificationLabel describes a modification type
+func modificationLabel(modificationType pb.ModificationType) string {
+	switch modificationType {
+	case pb.ModificationType_MODIFICATION_TYPE_CREATE:
+		return "created"
+	case pb.ModificationType_MODIFICATION_TYPE_UPDATE:
+		return "updated"
+	case pb.ModificationType_MODIFICATION_TYPE_DELETE:
+		return "deleted"
+	case pb.ModificationType_MODIFICATION_TYPE_RENAME:
+		return "renamed"
+	default:
+		return "modified"
+	}
+}
+
+// modelLabel returns provider/model for display
+func modelLabel(providerName, model string) string {
+	switch {
+	case providerName == "":
+		return model
+	case model == "":
+		return providerName
+	default:
+		return providerName + "/" + model
+	}
+}
+
+// costSummary returns the lines of the cost summary
+func costSummary(usage *pb.TokenUsage) [][2]string {
+	return [][2]string{
+		{"Input tokens", fmt.Sprint(usage.GetInputTokens())},
+		{"Output tokens", fmt.Sprint(usage.GetOutputTokens())},
+		{"Cache read tokens", fmt.Sprint(usage.GetCacheReadTokens())},
+		{"Cache write tokens", fmt.Sprint(usage.GetCacheWriteTokens())},
+		{"Total cost", fmt.Sprintf("$%.4f", usage.GetTotalCost())},
+	}
+}
+
+// taskDetails returns the lines of the task metadata shown at the top of a transcript
+func taskDetails(task *pb.Task) [][2]string {
+	var details [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			details = append(details, [2]string{name, value})
+		}
+	}
+	add("Model", modelLabel(task.GetProvider(), task.GetModel()))
+	add("Working directory", task.GetWorkingDirectory())
+	add("Created", task.GetCreatedAt())
+	add("Updated", task.GetUpdatedAt())
+	if task.GetState() != pb.TaskState_TASK_STATE_UNSPECIFIED {
+		add("State", strings.ToLower(strings.TrimPrefix(task.GetState().String(), "TASK_STATE_")))
+	}
+	return details
+}
+
+// renderMarkdown writes the transcript as Markdown
+func renderMarkdown(w io.Writer, transcript Transcript) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Task %s\n\n", transcript.Task.GetId())
+	for _, detail := range taskDetails(transcript.Task) {
+		fmt.Fprintf(&b, "- **%s:** %s\n", detail[0], detail[1])
+	}
+	if prompt := transcript.Task.GetInitialPrompt(); prompt != "" {
+		fmt.Fprintf(&b, "\n> %s\n", strings.ReplaceAll(prompt, "\n", "\n> "))
+	}
+
+	b.WriteString("\n## Conversation\n")
+	for _, e := range entries(transcript.History) {
+		fmt.Fprintf(&b, "\n### %s\n\n", e.Title)
+		if e.Timestamp != "" {
+			fmt.Fprintf(&b, "*%s*\n\n", e.Timestamp)
+		}
+		if e.Text != "" {
+			fmt.Fprintf(&b, "%s\n\n", e.Text)
+		}
+		for _, blk := range e.Blocks {
+			if blk.Label != "" {
+				fmt.Fprintf(&b, "%s:\n\n", blk.Label)
+			}
+			fence := codeFence(blk.Code)
+			fmt.Fprintf(&b, "%s%s\n%s\n%s\n\n", fence, blk.Language, strings.TrimRight(blk.Code, "\n"), fence)
+		}
+		for _, alt := range e.Alternatives {
+			fmt.Fprintf(&b, "<details>\n<summary>%s</summary>\n\n%s\n\n</details>\n\n", alt.Title, alt.Text)
+		}
+	}
+
+	b.WriteString("\n## Cost summary\n\n| | |\n|---|---|\n")
+	for _, line := range costSummary(transcript.History.GetTotalUsage()) {
+		fmt.Fprintf(&b, "| %s | %s |\n", line[0], line[1])
+	}
+	if ids := transcript.History.GetCheckpointIds(); len(ids) > 0 {
+		fmt.Fprintf(&b, "\nCheckpoints saved: %s\n", strings.Join(ids, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// codeFence returns a fence longer than any run of backticks in code
+func codeFence(code string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+// htmlTemplate renders a transcript as a standalone HTML document
+var htmlTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Task {{.ID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+pre { background: #f5f5f5; padding: 0.75em; overflow-x: auto; }
+.entry { border-top: 1px solid #ddd; padding-top: 0.5em; }
+.timestamp { color: #777; font-size: 0.9em; }
+.text { white-space: pre-wrap; }
+.diff .add { color: #22863a; }
+.diff .del { color: #b31d28; }
+</style>
+</head>
+<body>
+<h1>Task {{.ID}}</h1>
+{{if .Details}}<ul>
+{{range .Details}}<li><strong>{{index . 0}}:</strong> {{index . 1}}</li>
+{{end}}</ul>{{end}}
+{{if .Prompt}}<blockquote class="text">{{.Prompt}}</blockquote>{{end}}
+<h2>Conversation</h2>
+{{range .Entries}}<div class="entry">
+<h3>{{.Title}}</h3>
+{{if .Timestamp}}<div class="timestamp">{{.Timestamp}}</div>{{end}}
+{{if .Text}}<div class="text">{{.Text}}</div>{{end}}
+{{range .Blocks}}{{if .Label}}<p>{{.Label}}:</p>{{end}}{{if eq .Language "diff"}}<pre class="diff">{{range $.DiffLines .Code}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>{{else}}<pre>{{.Code}}</pre>{{end}}
+{{end}}{{range .Alternatives}}<details><summary>{{.Title}}</summary><div class="text">{{.Text}}</div></details>
+{{end}}</div>
+{{end}}
+<h2>Cost summary</h2>
+<table>
+{{range .Cost}}<tr><th align="left">{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Checkpoints}}<p>Checkpoints saved: {{range $i, $id := .Checkpoints}}{{if $i}}, {{end}}<code>{{$id}}</code>{{end}}</p>{{end}}
+</body>
+</html>
+`))
+
+// htmlData is the data of the HTML template
+type htmlData struct {
+	ID          string
+	Details     [][2]string
+	Prompt      string
+	Entries     []entry
+	Cost        [][2]string
+	Checkpoints []string
+}
+
+// diffLine is a line of a diff with the class used to color it
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+// DiffLines splits a diff into lines classified for coloring
+func (htmlData) DiffLines(diff string) []diffLine {
+	var lines []diffLine
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		class := "context"
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			class = "add"
+		case strings.HasPrefix(line, "-"):
+			class = "del"
+		}
+		lines = append(lines, diffLine{Class: class, Text: line})
+	}
+	return lines
+}
+
+// renderHTML writes the transcript as a standalone HTML document
+func renderHTML(w io.Writer, transcript Transcript) error {
+	data := htmlData{
+		ID:          transcript.Task.GetId(),
+		Details:     taskDetails(transcript.Task),
+		Prompt:      transcript.Task.GetInitialPrompt(),
+		Entries:     entries(transcript.History),
+		Cost:        costSummary(transcript.History.GetTotalUsage()),
+		Checkpoints: transcript.History.GetCheckpointIds(),
+	}
+	if err := htmlTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func testTranscript() Transcript {
+	return Transcript{
+		Task: &pb.Task{Id: "task-1", Provider: "anthropic", Model: "claude", InitialPrompt: "Fix the bug"},
+		History: &pb.TaskHistory{
+			TaskId: "task-1",
+			Events: []*pb.TaskEvent{
+				{Id: "1", Timestamp: "2025-01-01T00:00:00Z", Event: &pb.TaskEvent_UserMessage{UserMessage: &pb.UserMessage{Content: "Fix <the> bug"}}},
+				{Id: "2", Event: &pb.TaskEvent_AiResponse{AiResponse: &pb.AIResponse{
+					Content:      "Done",
+					Model:        "claude",
+					Alternatives: []*pb.AIResponseAlternative{{Content: "First try", Model: "other"}},
+				}}},
+				{Id: "3", Event: &pb.TaskEvent_ToolCall{ToolCall: &pb.ToolCallEvent{ToolName: "read_file", Arguments: "main.go", Result: "package ```main", Success: true}}},
+				{Id: "4", Event: &pb.TaskEvent_FileModification{FileModification: &pb.FileModificationEvent{
+					FilePath: "main.go",
+					Type:     pb.ModificationType_MODIFICATION_TYPE_UPDATE,
+					Diff:     "--- a/main.go\n+++ b/main.go\n-old\n+new\n",
+				}}},
+			},
+			TotalUsage:    &pb.TokenUsage{InputTokens: 100, OutputTokens: 20, TotalCost: 0.0123},
+			CheckpointIds: []string{"cp-1"},
+		},
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatMarkdown, testTranscript()); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Task task-1",
+		"- **Model:** anthropic/claude",
+		"> Fix the bug",
+		"### Assistant (claude)",
+		"<summary>Alternative 1 (other)</summary>",
+		"### Tool call: read_file",
+		"````\npackage ```main\n````",
+		"### File updated: main.go",
+		"```diff\n--- a/main.go",
+		"| Total cost | $0.0123 |",
+		"Checkpoints saved: cp-1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Markdown does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatHTML, testTranscript()); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Task task-1</title>",
+		"Fix &lt;the&gt; bug",
+		`<span class="add">&#43;new</span>`,
+		`<span class="del">-old</span>`,
+		"<details><summary>Alternative 1 (other)</summary>",
+		"<code>cp-1</code>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, FormatJSON, testTranscript()); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	var decoded struct {
+		Task struct {
+			ID string `json:"id"`
+		} `json:"task"`
+		History struct {
+			Events []json.RawMessage `json:"events"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if decoded.Task.ID != "task-1" || len(decoded.History.Events) != 4 {
+		t.Errorf("decoded = %+v", decoded)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if err := Render(&bytes.Buffer{}, Format("pdf"), testTranscript()); err == nil {
+		t.Error("Render() with an unknown format succeeded")
+	}
+}
@@ -0,0 +1,288 @@
+// Package fswatch watches the files of a workspace with fsnotify and notifies the subsystems
+// that subscribed to changes of the paths they care about, e.g. the ignore controller reloads
+// .golineignore and the semantic index indexes the changed files again.
+package fswatch
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// skippedDirs are directories that are never watched, they hold many files changing often
+// that no subscriber cares about
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".goline":      true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Service watches the files of a workspace and calls the subscribers of the changed paths.
+// Directories created after the service started are watched too.
+type Service struct {
+	root    string
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]bool
+}
+
+// New starts watching the workspace at root
+func New(root string) (*Service, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	s := &Service{
+		root:          root,
+		watcher:       watcher,
+		done:          make(chan struct{}),
+		subscriptions: make(map[*subscription]bool),
+	}
+	if err := s.addDir(root, false); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+// Root returns the root of the watched workspace
+func (s *Service) Root() string {
+	return s.root
+}
+
+// Subscribe calls callback with the changed paths that match, relative to the root with
+// forward slashes. The paths are collected until none changed for the debounce duration,
+// and callback is called with them at once, never concurrently with itself.
+// Created, modified, deleted and renamed files are reported alike.
+func (s *Service) Subscribe(match func(path string) bool, debounce time.Duration, callback func(paths []string)) (unsubscribe func()) {
+	sub := &subscription{
+		match:    match,
+		debounce: debounce,
+		callback: callback,
+		pending:  make(map[string]bool),
+	}
+	s.mu.Lock()
+	s.subscriptions[sub] = true
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		delete(s.subscriptions, sub)
+		s.mu.Unlock()
+		sub.stop()
+	}
+}
+
+// Close stops watching, pending changes are not reported
+func (s *Service) Close() error {
+	err := s.watcher.Close()
+	<-s.done
+	s.mu.Lock()
+	for sub := range s.subscriptions {
+		sub.stop()
+	}
+	s.subscriptions = nil
+	s.mu.Unlock()
+	return err
+}
+
+// MatchAll matches every path
+func MatchAll(string) bool {
+	return true
+}
+
+// MatchPaths matches the given paths, relative to the root with forward slashes
+func MatchPaths(paths ...string) func(path string) bool {
+	return func(path string) bool {
+		for _, p := range paths {
+			if path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchBase matches the paths whose last element is one of names, in any directory
+func MatchBase(names ...string) func(path string) bool {
+	return func(path string) bool {
+		base := path[strings.LastIndex(path, "/")+1:]
+		for _, name := range names {
+			if base == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// run dispatches the events of the watcher until it is closed
+func (s *Service) run() {
+	defer close(s.done)
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.handle(event)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("File watcher error", "error", err)
+		}
+	}
+}
+
+// handle publishes the path of an event, and watches the directories it creates
+func (s *Service) handle(event fsnotify.Event) {
+	// Permission changes do not change the content
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	relPath, ok := s.relPath(event.Name)
+	if !ok {
+		return
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			// The files of a new directory can be written before it is watched, so they are
+			// reported as created
+			if err := s.addDir(event.Name, true); err != nil {
+				slog.Warn("Failed to watch directory", "path", event.Name, "error", err)
+			}
+			return
+		}
+	}
+	s.publish(relPath)
+}
+
+// addDir watches a directory and its subdirectories, except the skipped ones.
+// With report, the files found are published as changed.
+func (s *Service) addDir(dir string, report bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear while walking
+			return nil
+		}
+		if !d.IsDir() {
+			if report {
+				if relPath, ok := s.relPath(path); ok {
+					s.publish(relPath)
+				}
+			}
+			return nil
+		}
+		if path != s.root && skippedDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if err := s.watcher.Add(path); err != nil {
+			if path == dir {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			slog.Warn("Failed to watch directory", "path", path, "error", err)
+		}
+		return nil
+	})
+}
+
+// relPath returns a path relative to the root with forward slashes, and false for paths
+// outside the root or in skipped directories
+func (s *Service) relPath(path string) (string, bool) {
+	relPath, err := filepath.Rel(s.root, path)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return "", false
+	}
+	relPath = filepath.ToSlash(relPath)
+	for _, dir := range strings.Split(relPath, "/") {
+		if skippedDirs[dir] {
+			return "", false
+		}
+	}
+	return relPath, true
+}
+
+// publish notifies the subscriptions matching a changed path
+func (s *Service) publish(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscriptions {
+		if sub.match(path) {
+			sub.notify(path)
+		}
+	}
+}
+
+// subscription collects the changed paths of a subscriber until they are reported
+type subscription struct {
+	match    func(path string) bool
+	debounce time.Duration
+	callback func(paths []string)
+
+	// running serializes the callbacks
+	running sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]bool
+	timer   *time.Timer
+	stopped bool
+}
+
+// notify adds a changed path and restarts the debounce timer
+func (sub *subscription) notify(path string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.stopped {
+		return
+	}
+	sub.pending[path] = true
+	if sub.timer == nil {
+		sub.timer = time.AfterFunc(sub.debounce, sub.flush)
+	} else {
+		sub.timer.Reset(sub.debounce)
+	}
+}
+
+// flush reports the pending paths
+func (sub *subscription) flush() {
+	sub.running.Lock()
+	defer sub.running.Unlock()
+
+	sub.mu.Lock()
+	if sub.stopped || len(sub.pending) == 0 {
+		sub.mu.Unlock()
+		return
+	}
+	paths := make([]string, 0, len(sub.pending))
+	for path := range sub.pending {
+		paths = append(paths, path)
+	}
+	sub.pending = make(map[string]bool)
+	sub.mu.Unlock()
+
+	sort.Strings(paths)
+	sub.callback(paths)
+}
+
+// stop drops the pending paths and stops reporting
+func (sub *subscription) stop() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.stopped = true
+	sub.pending = nil
+	if sub.timer != nil {
+		sub.timer.Stop()
+	}
+}
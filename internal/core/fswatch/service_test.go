@@ -0,0 +1,92 @@
+package fswatch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceSubscribe(t *testing.T) {
+	root := t.TempDir()
+	service, err := New(root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer service.Close()
+
+	all := make(chan []string, 10)
+	service.Subscribe(MatchAll, 50*time.Millisecond, func(paths []string) { all <- paths })
+	rules := make(chan []string, 10)
+	service.Subscribe(MatchBase(".golinerules"), 50*time.Millisecond, func(paths []string) { rules <- paths })
+
+	write(t, root, "a.go", "package a")
+	// Files written in a new directory before it is watched are reported too
+	write(t, root, "sub/deep/.golinerules", "Use tabs")
+	write(t, root, ".git/index", "index")
+	write(t, root, "node_modules/x/index.js", "x")
+
+	if got, want := receive(t, all), []string{"a.go", "sub/deep/.golinerules"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed paths = %v, want %v", got, want)
+	}
+	if got, want := receive(t, rules), []string{"sub/deep/.golinerules"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed rules = %v, want %v", got, want)
+	}
+
+	// Files in watched new directories are reported on their own
+	if err := os.Remove(filepath.Join(root, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	write(t, root, "sub/deep/b.go", "package b")
+	if got, want := receive(t, all), []string{"a.go", "sub/deep/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed paths = %v, want %v", got, want)
+	}
+	select {
+	case paths := <-rules:
+		t.Errorf("rules subscriber notified of %v", paths)
+	default:
+	}
+}
+
+func TestServiceUnsubscribe(t *testing.T) {
+	root := t.TempDir()
+	service, err := New(root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer service.Close()
+
+	calls := make(chan []string, 10)
+	unsubscribe := service.Subscribe(MatchPaths("a.go"), 20*time.Millisecond, func(paths []string) { calls <- paths })
+	unsubscribe()
+	write(t, root, "a.go", "package a")
+
+	select {
+	case paths := <-calls:
+		t.Errorf("unsubscribed callback called with %v", paths)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func receive(t *testing.T, ch chan []string) []string {
+	t.Helper()
+	select {
+	case paths := <-ch:
+		return paths
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+		return nil
+	}
+}
+
+func write(t *testing.T, root, path, content string) {
+	t.Helper()
+	absPath := filepath.Join(root, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(absPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
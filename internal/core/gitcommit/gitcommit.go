@@ -0,0 +1,175 @@
+// Package gitcommit commits the changes made by the AI agent to the repository, with a
+// conventional commit message written by the AI
+package gitcommit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/regions"
+	"github.com/kazz187/goline/internal/gitexec"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// maxDiffSize limits the diff sent to the AI to write the commit message
+const maxDiffSize = 100000
+
+// types are the conventional commit types
+var types = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// ErrNothingToCommit is returned when no changes are staged
+var ErrNothingToCommit = errors.New("nothing to commit, no changes are staged")
+
+// messageSchema is the structured response asked to the AI for a commit message
+var messageSchema = provider.Schema{
+	Name:        "commit_message",
+	Description: "Write the git commit message of the staged changes shown as a diff, following the Conventional Commits specification. The subject is written in the imperative mood, in lower case, without a trailing period and in at most 72 characters. The body explains what changed and why when the subject is not enough, wrapped at 72 characters, and is empty otherwise.",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "type": {"type": "string", "enum": ["feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"]},
+    "scope": {"type": "string", "description": "The area of the code changed, e.g. a package name, empty if the changes are not limited to one"},
+    "breaking": {"type": "boolean", "description": "Whether the changes break compatibility"},
+    "subject": {"type": "string"},
+    "body": {"type": "string"}
+  },
+  "required": ["type", "subject"]
+}`),
+}
+
+// Message is a conventional commit message
+type Message struct {
+	Type     string `json:"type"`
+	Scope    string `json:"scope,omitempty"`
+	Breaking bool   `json:"breaking,omitempty"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body,omitempty"`
+}
+
+// String formats the message as a commit message: a header "type(scope)!: subject", then the
+// body after an empty line
+func (m Message) String() string {
+	var b strings.Builder
+	b.WriteString(m.Type)
+	if m.Scope != "" {
+		fmt.Fprintf(&b, "(%s)", m.Scope)
+	}
+	if m.Breaking {
+		b.WriteString("!")
+	}
+	fmt.Fprintf(&b, ": %s", m.Subject)
+	if m.Body != "" {
+		fmt.Fprintf(&b, "\n\n%s", m.Body)
+	}
+	return b.String()
+}
+
+// normalize fixes the common mistakes of generated messages: an unknown type, or a subject
+// ending with a period or spanning several lines
+func (m *Message) normalize() {
+	m.Type = strings.ToLower(strings.TrimSpace(m.Type))
+	if !slices.Contains(types, m.Type) {
+		m.Type = "chore"
+	}
+	m.Scope = strings.TrimSpace(m.Scope)
+	subject, rest, _ := strings.Cut(strings.TrimSpace(m.Subject), "\n")
+	subject = strings.TrimSuffix(strings.TrimSpace(subject), ".")
+	m.Subject = subject
+	m.Body = strings.TrimSpace(strings.TrimSpace(rest) + "\n\n" + strings.TrimSpace(m.Body))
+}
+
+// Committer stages the changes of the working directory and commits them
+type Committer struct {
+	provider   provider.Provider
+	workingDir string
+}
+
+// NewCommitter creates a committer of the repository of the working directory, whose commit
+// messages are written by p
+func NewCommitter(p provider.Provider, workingDir string) *Committer {
+	return &Committer{
+		provider:   p,
+		workingDir: workingDir,
+	}
+}
+
+// Stage stages the changes of the paths, relative to the working directory, including their
+// deletion. All the changes of the working tree are staged if paths is empty.
+func (c *Committer) Stage(paths []string) error {
+	args := []string{"add", "--all", "--"}
+	if len(paths) == 0 {
+		args = append(args, ".")
+	}
+	_, err := gitexec.Run(context.Background(), c.workingDir, append(args, paths...)...)
+	return err
+}
+
+// StagedDiff returns the diff of the staged changes
+func (c *Committer) StagedDiff() (string, error) {
+	return gitexec.Run(context.Background(), c.workingDir, "diff", "--cached")
+}
+
+// GenerateMessage asks the AI for the commit message of the staged changes. It returns
+// ErrNothingToCommit if no changes are staged.
+func (c *Committer) GenerateMessage(ctx context.Context) (Message, provider.Usage, error) {
+	diff, err := c.StagedDiff()
+	if err != nil {
+		return Message{}, provider.Usage{}, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return Message{}, provider.Usage{}, ErrNothingToCommit
+	}
+	if len(diff) > maxDiffSize {
+		diff = diff[:maxDiffSize] + "\n[diff truncated]\n"
+	}
+
+	var message Message
+	usage, err := provider.CreateStructured(ctx, c.provider, messageSchema, []provider.Message{
+		{Role: "user", Content: fmt.Sprintf("Write the commit message of these staged changes:\n\n```diff\n%s```", diff)},
+	}, &message)
+	if err != nil {
+		return Message{}, usage, fmt.Errorf("failed to generate the commit message: %w", err)
+	}
+	message.normalize()
+	if message.Subject == "" {
+		return Message{}, usage, errors.New("failed to generate the commit message: the subject is empty")
+	}
+	return message, usage, nil
+}
+
+// Commit commits the staged changes with the message and returns the abbreviated hash of the commit
+func (c *Committer) Commit(message string) (string, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "", errors.New("the commit message is empty")
+	}
+	if _, err := gitexec.RunInput(context.Background(), c.workingDir, strings.NewReader(message+"\n"), "commit", "--quiet", "--file", "-"); err != nil {
+		return "", err
+	}
+
+	hash, err := gitexec.Run(context.Background(), c.workingDir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(hash), nil
+}
+
+// TaskPaths returns the paths of the files edited by the AI agent in a task, as recorded with
+// their edited regions
+func TaskPaths(taskID string) ([]string, error) {
+	tracker, err := regions.NewTracker(taskID)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, region := range tracker.Regions() {
+		if !slices.Contains(paths, region.Path) {
+			paths = append(paths, region.Path)
+		}
+	}
+	return paths, nil
+}
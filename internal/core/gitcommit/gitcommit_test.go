@@ -0,0 +1,114 @@
+package gitcommit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+// newRepository creates a git repository with a committed file
+func newRepository(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "test")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	write(t, dir, "main.go", "package main\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	return dir, git
+}
+
+// write writes a file of the repository
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	dir, git := newRepository(t)
+	write(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+	write(t, dir, "notes.txt", "not from the agent\n")
+
+	p := mock.New(&mock.Fixture{Responses: []mock.Response{{Text: `{"type": "Feat", "scope": "cli", "subject": "add the main function.", "body": "The binary needs an entry point."}`}}})
+	c := NewCommitter(p, dir)
+	if err := c.Stage([]string{"main.go"}); err != nil {
+		t.Fatalf("Stage() error = %v", err)
+	}
+	message, _, err := c.GenerateMessage(context.Background())
+	if err != nil {
+		t.Fatalf("GenerateMessage() error = %v", err)
+	}
+	if want := "feat(cli): add the main function\n\nThe binary needs an entry point."; message.String() != want {
+		t.Errorf("message = %q, want %q", message.String(), want)
+	}
+	if sent := p.Requests()[0].Messages[0].Content; !strings.Contains(sent, "+func main() {}") || strings.Contains(sent, "notes.txt") {
+		t.Errorf("diff sent = %q, want only the staged changes", sent)
+	}
+
+	hash, err := c.Commit(message.String())
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got := git("log", "-1", "--format=%h %s"); got != hash+" feat(cli): add the main function\n" {
+		t.Errorf("last commit = %q", got)
+	}
+	if status := git("status", "--porcelain"); status != "?? notes.txt\n" {
+		t.Errorf("status = %q, want only the unstaged file", status)
+	}
+}
+
+func TestGenerateMessageWithoutChanges(t *testing.T) {
+	dir, _ := newRepository(t)
+	c := NewCommitter(mock.New(&mock.Fixture{}), dir)
+	if _, _, err := c.GenerateMessage(context.Background()); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("GenerateMessage() error = %v, want ErrNothingToCommit", err)
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	tests := []struct {
+		message Message
+		want    string
+	}{
+		{Message{Type: "fix", Subject: "handle empty input"}, "fix: handle empty input"},
+		{Message{Type: "refactor", Scope: "api", Breaking: true, Subject: "rename the client"}, "refactor(api)!: rename the client"},
+	}
+	for _, tt := range tests {
+		if got := tt.message.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+
+	m := Message{Type: "unknown", Subject: "first line\nsecond line"}
+	m.normalize()
+	if m.String() != "chore: first line\n\nsecond line" {
+		t.Errorf("normalized message = %q", m.String())
+	}
+}
@@ -0,0 +1,166 @@
+// Package hooks runs the commands configured on task lifecycle events, so goline can be
+// integrated with other tools, e.g. to post to a chat, update a ticket or check a policy.
+//
+// Each command is run by the shell in the working directory of the task and receives the
+// event as a JSON Payload on stdin. A failing on_task_start hook stops the task, a failing
+// on_tool_approved hook denies the tool use and the failures of on_file_written hooks are
+// reported to the AI as diagnostics of the file, e.g. of a linter; failures of the other hooks
+// are only logged.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/shell"
+)
+
+// Event is a task lifecycle event hooks are run on
+type Event string
+
+const (
+	// EventTaskStart is sent before the first request of a task
+	EventTaskStart Event = "on_task_start"
+	// EventToolApproved is sent after a tool use was approved, before it runs
+	EventToolApproved Event = "on_tool_approved"
+	// EventFileWritten is sent after a file was created or updated
+	EventFileWritten Event = "on_file_written"
+	// EventTaskComplete is sent when a run of a task ends, whether it completed or not
+	EventTaskComplete Event = "on_task_complete"
+	// EventProgress is sent with the progress summaries of a time-boxed run
+	EventProgress Event = "on_progress"
+)
+
+const (
+	// DefaultTimeout is the maximum duration of a hook command
+	DefaultTimeout = 30 * time.Second
+	// maxStderr limits the error output of a hook reported in errors
+	maxStderr = 2000
+	// waitDelay bounds how long a killed hook's children may keep its output open
+	waitDelay = time.Second
+)
+
+// Payload is the event sent to hook commands on stdin
+type Payload struct {
+	// Event is the event the hook is run on
+	Event Event `json:"event"`
+	// TaskID is the ID of the task
+	TaskID string `json:"task_id"`
+	// WorkingDirectory is the working directory of the task
+	WorkingDirectory string `json:"working_directory"`
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+	// Prompt is the task given to the AI, for on_task_start
+	Prompt string `json:"prompt,omitempty"`
+	// Tool is the name of the tool, for on_tool_approved
+	Tool string `json:"tool,omitempty"`
+	// Params are the parameters of the tool use, for on_tool_approved
+	Params map[string]string `json:"params,omitempty"`
+	// Path is the path of the file relative to the working directory, for on_file_written
+	Path string `json:"path,omitempty"`
+	// Status is how the run ended, for on_task_complete: completed, needs_input, turn_limit, time_limit, no_tool_use, cancelled or failed
+	Status string `json:"status,omitempty"`
+	// Result is the result presented by the AI, for on_task_complete
+	Result string `json:"result,omitempty"`
+	// Error is the reason the run stopped, for on_task_complete
+	Error string `json:"error,omitempty"`
+	// Summary is the progress summary, for on_progress
+	Summary string `json:"summary,omitempty"`
+}
+
+// Runner runs the hook commands of the events
+type Runner struct {
+	commands map[Event][]string
+	timeout  time.Duration
+}
+
+// New creates a runner for the configured hooks
+func New(cfg config.Hooks) *Runner {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Runner{
+		commands: map[Event][]string{
+			EventTaskStart:    cfg.OnTaskStart,
+			EventToolApproved: cfg.OnToolApproved,
+			EventFileWritten:  cfg.OnFileWritten,
+			EventTaskComplete: cfg.OnTaskComplete,
+			EventProgress:     cfg.OnProgress,
+		},
+		timeout: timeout,
+	}
+}
+
+// Run runs the commands of the payload's event one after the other and reports those that failed.
+// A nil runner runs nothing.
+func (r *Runner) Run(ctx context.Context, payload Payload) error {
+	if r == nil || len(r.commands[payload.Event]) == 0 {
+		return nil
+	}
+	if payload.Time.IsZero() {
+		payload.Time = time.Now()
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, command := range r.commands[payload.Event] {
+		if err := r.run(ctx, command, payload, input); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run runs a hook command with the payload on stdin
+func (r *Runner) run(ctx context.Context, command string, payload Payload, input []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := shell.System().Command(ctx, command)
+	cmd.WaitDelay = waitDelay
+	cmd.Dir = payload.WorkingDirectory
+	cmd.Env = append(os.Environ(), "GOLINE_HOOK_EVENT="+string(payload.Event), "GOLINE_TASK_ID="+payload.TaskID)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s hook %q timed out after %s", payload.Event, command, r.timeout)
+		}
+		// Checks such as linters often report on stdout only
+		output := stderr.String()
+		if strings.TrimSpace(output) == "" {
+			output = stdout.String()
+		}
+		return fmt.Errorf("%s hook %q failed: %w%s", payload.Event, command, err, formatStderr(output))
+	}
+	if stdout.Len() > 0 {
+		slog.Debug("Hook output", "event", payload.Event, "command", command, "output", stdout.String())
+	}
+	return nil
+}
+
+// formatStderr formats the error output of a hook to append to an error
+func formatStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	return ": " + stderr
+}
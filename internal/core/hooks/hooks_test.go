@@ -0,0 +1,63 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in tests are shell scripts")
+	}
+	dir := t.TempDir()
+	r := New(config.Hooks{
+		OnFileWritten:  []string{"cat > payload.json", `echo "$GOLINE_HOOK_EVENT $GOLINE_TASK_ID" > env.txt`},
+		OnToolApproved: []string{"echo not allowed >&2; exit 3"},
+		OnTaskComplete: []string{"sleep 5"},
+		Timeout:        100 * time.Millisecond,
+	})
+
+	err := r.Run(context.Background(), Payload{Event: EventFileWritten, TaskID: "task-1", WorkingDirectory: dir, Path: "main.go"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "payload.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload Payload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatalf("payload %s: %v", data, err)
+	}
+	if payload.Event != EventFileWritten || payload.Path != "main.go" || payload.Time.IsZero() {
+		t.Errorf("payload = %+v", payload)
+	}
+	if env, _ := os.ReadFile(filepath.Join(dir, "env.txt")); string(env) != "on_file_written task-1\n" {
+		t.Errorf("environment = %q", env)
+	}
+
+	err = r.Run(context.Background(), Payload{Event: EventToolApproved, WorkingDirectory: dir, Tool: "execute_command"})
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Run() error = %v, want the failure with stderr", err)
+	}
+	err = r.Run(context.Background(), Payload{Event: EventTaskComplete, WorkingDirectory: dir})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() error = %v, want a timeout", err)
+	}
+
+	// Events without hooks and nil runners run nothing
+	if err := r.Run(context.Background(), Payload{Event: EventTaskStart, WorkingDirectory: dir}); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if err := (*Runner)(nil).Run(context.Background(), Payload{Event: EventTaskStart}); err != nil {
+		t.Errorf("Run() on a nil runner error = %v", err)
+	}
+}
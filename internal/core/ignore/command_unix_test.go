@@ -0,0 +1,25 @@
+//go:build !windows
+
+package ignore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateCommandUnixPaths(t *testing.T) {
+	dir := t.TempDir()
+	controller := NewController(dir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	// A leading slash starts an absolute path, not an option as on Windows
+	command := "cat " + filepath.Join(dir, ".env")
+	if got := controller.ValidateCommand(command); got == "" {
+		t.Errorf("ValidateCommand(%q) allowed the command", command)
+	}
+	if got := controller.ValidateCommand("cat README.md"); got != "" {
+		t.Errorf("ValidateCommand() blocked README.md because of %s", got)
+	}
+}
@@ -0,0 +1,38 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateCommandWindowsPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("private/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	controller := NewController(dir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	for _, command := range []string{
+		`type private\data.txt`,
+		`type "` + filepath.Join(dir, ".env") + `"`,
+		`Get-Content -Path ` + filepath.Join(dir, "private", "data.txt"),
+		`more /E .env`,
+	} {
+		if got := controller.ValidateCommand(command); got == "" {
+			t.Errorf("ValidateCommand(%q) allowed the command", command)
+		}
+	}
+	for _, command := range []string{
+		`type README.md`,
+		`more /E src\main.go`,
+		`Select-String -Pattern:TODO README.md`,
+	} {
+		if got := controller.ValidateCommand(command); got != "" {
+			t.Errorf("ValidateCommand(%q) blocked %s", command, got)
+		}
+	}
+}
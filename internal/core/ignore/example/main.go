@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/kazz187/goline/internal/core/fswatch"
 	"github.com/kazz187/goline/internal/core/ignore"
 )
 
@@ -38,8 +39,13 @@ temp.*
 		log.Fatalf("Failed to initialize controller: %v", err)
 	}
 
-	// Create and start the watcher
-	watcher := ignore.NewWatcher(controller, cwd)
+	// Watch the workspace and reload the controller when .golineignore changes
+	service, err := fswatch.New(cwd)
+	if err != nil {
+		log.Fatalf("Failed to watch the workspace: %v", err)
+	}
+	defer service.Close()
+	watcher := ignore.NewWatcher(controller, service)
 	watcher.Start()
 	defer watcher.Stop()
 
@@ -101,7 +107,7 @@ private/
 	}
 
 	// Wait for the watcher to detect the change
-	time.Sleep(3 * time.Second)
+	time.Sleep(time.Second)
 
 	fmt.Println("Updated ignore patterns:")
 	for _, path := range testPaths {
@@ -1,9 +1,13 @@
 package ignore
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	ignore "github.com/sabhiram/go-gitignore"
 )
@@ -11,97 +15,314 @@ import (
 // LockTextSymbol represents a lock emoji used to indicate locked/ignored files
 const LockTextSymbol = "🔒"
 
+// IgnoreFileName is the name of the ignore files of a workspace, at its root or in any subdirectory
+const IgnoreFileName = ".golineignore"
+
+// DefaultPatterns are the built-in patterns of files holding secrets, applied before the
+// global and workspace ignore files, which can re-include them with negated patterns
+var DefaultPatterns = []string{
+	".env",
+	".env.*",
+	"!.env.example",
+	"!.env.sample",
+	"!.env.template",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"*.jks",
+	"*.keystore",
+	"id_rsa",
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	".netrc",
+	".npmrc",
+	".pypirc",
+	".aws/credentials",
+	".docker/config.json",
+}
+
+// skippedDirs are directories never searched for nested ignore files
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// rule is an ignore pattern of an ignore file
+type rule struct {
+	// dir is the directory of the ignore file, relative to the workspace with forward slashes,
+	// empty for the workspace root and the files that apply everywhere
+	dir string
+	// matcher matches the pattern without its negation
+	matcher *ignore.GitIgnore
+	// negate re-includes the paths matched by the pattern
+	negate bool
+	// dirOnly is set for the patterns ending with a slash, which only match directories
+	dirOnly bool
+}
+
 // Controller controls AI access to files by enforcing ignore patterns.
 // Uses the 'go-gitignore' library to support standard .gitignore syntax in .golineignore files.
+// The patterns are, in order of precedence from lowest to highest: DefaultPatterns, the global
+// ~/.goline/ignore file, the .golineignore at the workspace root, and the .golineignore files of
+// subdirectories, deeper ones last. As with gitignore, the last pattern matching a path decides,
+// so a negated pattern ("!path") in a later file re-includes a path ignored by an earlier one.
+// The patterns given to Deny come after all of them and cannot be re-included by the ignore files.
+// It is safe for concurrent use, the patterns can be reloaded while paths are validated.
 type Controller struct {
-	cwd                 string
-	ignoreInstance      *ignore.GitIgnore
-	golineIgnoreContent string
+	cwd string
+	// mu guards the rules, reloaded by the watcher
+	mu    sync.RWMutex
+	rules []rule
+	// denied are the patterns given to Deny
+	denied []string
 }
 
 // NewController creates a new ignore controller for the given working directory
 func NewController(cwd string) *Controller {
 	return &Controller{
-		cwd:                 cwd,
-		ignoreInstance:      nil,
-		golineIgnoreContent: "",
+		cwd: cwd,
 	}
 }
 
 // Initialize initializes the controller by loading custom patterns
 // Must be called after construction and before using the controller
 func (c *Controller) Initialize() error {
-	return c.loadGolineIgnore()
+	return c.loadIgnoreFiles()
 }
 
-// loadGolineIgnore loads custom patterns from .golineignore if it exists
-func (c *Controller) loadGolineIgnore() error {
-	ignorePath := filepath.Join(c.cwd, ".golineignore")
-
-	// Check if .golineignore exists
-	content, err := os.ReadFile(ignorePath)
+// GlobalIgnorePath returns the path of the global ignore file, applied to every workspace
+func GlobalIgnorePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// File doesn't exist, that's fine
-			c.golineIgnoreContent = ""
-			c.ignoreInstance = nil
-			return nil
+		return "", err
+	}
+	return filepath.Join(homeDir, ".goline", "ignore"), nil
+}
+
+// loadIgnoreFiles loads the default patterns, the global ignore file and the ignore files of the workspace
+func (c *Controller) loadIgnoreFiles() error {
+	rules := compileRules("", DefaultPatterns)
+
+	if globalPath, err := GlobalIgnorePath(); err == nil {
+		content, err := os.ReadFile(globalPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
 		}
-		// Other error reading file
+		rules = append(rules, compileRules("", strings.Split(string(content), "\n"))...)
+	}
+
+	dirs, err := c.findIgnoreFiles()
+	if err != nil {
 		return err
 	}
+	if len(dirs) > 0 {
+		// The ignore files themselves are hidden from the AI
+		rules = append(rules, compileRules("", []string{IgnoreFileName})...)
+	}
+	for _, dir := range dirs {
+		content, err := os.ReadFile(filepath.Join(c.cwd, filepath.FromSlash(dir), IgnoreFileName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Deleted since it was found
+				continue
+			}
+			return err
+		}
+		rules = append(rules, compileRules(dir, strings.Split(string(content), "\n"))...)
+	}
 
-	// File exists, parse it
-	c.golineIgnoreContent = string(content)
+	c.mu.Lock()
+	c.rules = append(rules, compileRules("", c.denied)...)
+	c.mu.Unlock()
+	return nil
+}
 
-	// Add .golineignore to the patterns
-	contentWithSelf := c.golineIgnoreContent
-	if !strings.Contains(contentWithSelf, ".golineignore") {
-		contentWithSelf += "\n.golineignore"
+// Deny adds patterns applied after those of the ignore files, e.g. the paths an outbound
+// policy keeps from being sent to the providers. Negated patterns are not allowed, so the
+// ignore files cannot re-include the denied paths.
+func (c *Controller) Deny(patterns ...string) {
+	var denied []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(strings.TrimSpace(pattern), "!") {
+			continue
+		}
+		denied = append(denied, pattern)
 	}
 
-	// Create ignore instance
-	ignoreInstance := ignore.CompileIgnoreLines(strings.Split(contentWithSelf, "\n")...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.denied = append(c.denied, denied...)
+	c.rules = append(c.rules, compileRules("", denied)...)
+}
 
-	c.ignoreInstance = ignoreInstance
-	return nil
+// findIgnoreFiles returns the directories of the workspace holding an ignore file, relative
+// to the workspace with forward slashes, parents before their subdirectories
+func (c *Controller) findIgnoreFiles() ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(c.cwd, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == c.cwd {
+				if os.IsNotExist(err) {
+					return filepath.SkipAll
+				}
+				return err
+			}
+			// Files can disappear while walking
+			return nil
+		}
+		if d.IsDir() {
+			if path != c.cwd && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != IgnoreFileName {
+			return nil
+		}
+		relDir, err := filepath.Rel(c.cwd, filepath.Dir(path))
+		if err != nil {
+			return nil
+		}
+		relDir = filepath.ToSlash(relDir)
+		if relDir == "." {
+			relDir = ""
+		}
+		dirs = append(dirs, relDir)
+		return nil
+	})
+	// The subdirectories sorting before the ignore file of their parent, e.g. .config, are
+	// walked first; order the directories by depth so parents come first
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return depth(dirs[i]) < depth(dirs[j])
+	})
+	return dirs, err
 }
 
-// ValidateAccess checks if a file should be accessible to the AI
-// filePath can be absolute or relative to cwd
-func (c *Controller) ValidateAccess(filePath string) bool {
-	// Always allow access if .golineignore does not exist
-	if c.ignoreInstance == nil {
-		return true
+// depth returns the number of elements of a relative directory, zero for the root
+func depth(dir string) int {
+	if dir == "" {
+		return 0
 	}
+	return strings.Count(dir, "/") + 1
+}
 
-	// Normalize path to be relative to cwd
-	absolutePath := filePath
-	if !filepath.IsAbs(filePath) {
-		absolutePath = filepath.Join(c.cwd, filePath)
+// compileRules compiles the lines of an ignore file of a directory into rules, one per pattern
+func compileRules(dir string, lines []string) []rule {
+	var rules []rule
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(trimmed, "!")
+		if negate {
+			line = strings.TrimPrefix(strings.TrimLeft(line, " "), "!")
+		}
+		dirOnly := strings.HasSuffix(strings.TrimSpace(line), "/")
+		rules = append(rules, rule{dir: dir, matcher: ignore.CompileIgnoreLines(line), negate: negate, dirOnly: dirOnly})
 	}
+	return rules
+}
+
+// ignored reports whether a path relative to the workspace with forward slashes, ending with a
+// slash for a directory, is ignored.
+// As with gitignore, a path cannot be re-included by a negated pattern when one of its parent
+// directories is ignored, so the walks can skip the ignored directories without reading them.
+func (c *Controller) ignored(relativePath string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	relativePath, isDir := strings.CutSuffix(relativePath, "/")
+	for i := 0; i < len(relativePath); i++ {
+		if relativePath[i] != '/' {
+			continue
+		}
+		dir := relativePath[:i]
+		if elem := dir[strings.LastIndex(dir, "/")+1:]; elem == ".." || elem == "." {
+			continue
+		}
+		if c.matches(dir, true) {
+			return true
+		}
+	}
+	return c.matches(relativePath, isDir)
+}
+
+// matches reports whether the last rule matching a path excludes it. Must be called with mu held.
+func (c *Controller) matches(relativePath string, isDir bool) bool {
+	ignored := false
+	for _, r := range c.rules {
+		path := relativePath
+		if r.dir != "" {
+			if !strings.HasPrefix(relativePath, r.dir+"/") {
+				// The rules of an ignore file only apply below its directory
+				continue
+			}
+			path = strings.TrimPrefix(relativePath, r.dir+"/")
+		}
+		if r.dirOnly && isDir {
+			// The trailing slash lets the patterns of directories only, e.g. "build/", match
+			path += "/"
+		}
+		if r.matcher.MatchesPath(path) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// WalkAllowed walks the file tree rooted at root like filepath.WalkDir, calling fn for the
+// files and directories that are not ignored only. The ignored directories are skipped without
+// being read, and nothing is walked if root itself is ignored.
+// root can be absolute or relative to cwd, fn receives the paths as filepath.WalkDir does.
+func (c *Controller) WalkAllowed(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(path, d, err)
+		}
+		if !c.allowed(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, d, nil)
+	})
+}
 
+// allowed reports whether a file or directory is not ignored
+func (c *Controller) allowed(path string, isDir bool) bool {
+	absolutePath := path
+	if !filepath.IsAbs(path) {
+		absolutePath = filepath.Join(c.cwd, path)
+	}
 	relativePath, err := filepath.Rel(c.cwd, absolutePath)
 	if err != nil {
-		// Path is outside cwd, allow access
 		return true
 	}
-
-	// Convert to forward slashes for consistency
 	relativePath = filepath.ToSlash(relativePath)
+	if relativePath == "." {
+		return true
+	}
+	if isDir {
+		relativePath += "/"
+	}
+	return !c.ignored(relativePath)
+}
 
-	// Check if the file is ignored
-	return !c.ignoreInstance.MatchesPath(relativePath)
+// ValidateAccess checks if a file should be accessible to the AI
+// filePath can be absolute or relative to cwd
+func (c *Controller) ValidateAccess(filePath string) bool {
+	return c.allowed(filePath, false)
 }
 
 // ValidateCommand checks if a terminal command should be allowed to execute based on file access patterns
 // Returns path of file that is being accessed if it is being accessed, nil if command is allowed
 func (c *Controller) ValidateCommand(command string) string {
-	// Always allow if no .golineignore exists
-	if c.ignoreInstance == nil {
-		return ""
-	}
-
 	// Split command into parts and get the base command
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
@@ -132,13 +353,12 @@ func (c *Controller) ValidateCommand(command string) string {
 	if _, ok := fileReadingCommands[baseCommand]; ok {
 		// Check each argument that could be a file path
 		for i := 1; i < len(parts); i++ {
-			arg := parts[i]
-			// Skip command flags/options (both Unix and PowerShell style)
-			if strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "/") {
+			arg := strings.Trim(parts[i], `"'`)
+			if isCommandFlag(arg) {
 				continue
 			}
-			// Ignore PowerShell parameter names
-			if strings.Contains(arg, ":") {
+			// Ignore PowerShell parameter names, but not Windows paths such as C:\secrets.txt
+			if strings.Contains(arg, ":") && !isDrivePath(arg) {
 				continue
 			}
 			// Validate file access
@@ -151,6 +371,24 @@ func (c *Controller) ValidateCommand(command string) string {
 	return ""
 }
 
+// isCommandFlag reports whether a command argument is an option: -x on all platforms, and
+// /x as well on Windows, where a leading slash starts an absolute path elsewhere
+func isCommandFlag(arg string) bool {
+	if strings.HasPrefix(arg, "-") {
+		return true
+	}
+	return runtime.GOOS == "windows" && strings.HasPrefix(arg, "/")
+}
+
+// isDrivePath reports whether an argument is an absolute Windows path, e.g. C:\dir\file
+func isDrivePath(arg string) bool {
+	if len(arg) < 3 || arg[1] != ':' || (arg[2] != '\\' && arg[2] != '/') {
+		return false
+	}
+	c := arg[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
 // FilterPaths filters an array of paths, removing those that should be ignored
 func (c *Controller) FilterPaths(paths []string) []string {
 	var allowedPaths []string
@@ -164,7 +402,7 @@ func (c *Controller) FilterPaths(paths []string) []string {
 	return allowedPaths
 }
 
-// Reload reloads the ignore patterns from the .golineignore file
+// Reload reloads the ignore patterns from the ignore files
 func (c *Controller) Reload() error {
-	return c.loadGolineIgnore()
+	return c.loadIgnoreFiles()
 }
@@ -1,8 +1,10 @@
 package ignore
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -145,6 +147,7 @@ file-with-space-at-end.*
 		// Test blocked commands
 		blockedCommands := []string{
 			"cat .env",
+			`cat ".env"`,
 			"grep pattern config.secret",
 			"head -n 10 private/data.txt",
 		}
@@ -190,3 +193,151 @@ file-with-space-at-end.*
 		}
 	})
 }
+
+func TestNestedAndGlobalIgnoreFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	tempDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(home, ".goline", "ignore"):              "*.log\n",
+		filepath.Join(tempDir, ".golineignore"):               "build/\n!.env.local\n",
+		filepath.Join(tempDir, "web", ".golineignore"):        "/dist\n!debug.log\n",
+		filepath.Join(tempDir, "web", "api", ".golineignore"): "*.gen.go\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	controller := NewController(tempDir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize controller: %v", err)
+	}
+
+	tests := map[string]bool{
+		// Built-in defaults, the root file re-includes .env.local
+		".env":             false,
+		"config/.env":      false,
+		".env.local":       true,
+		".env.example":     true,
+		"certs/server.pem": false,
+		// Global ignore file
+		"app.log": false,
+		// Root ignore file
+		"build/out.js": false,
+		// Nested ignore files apply to their directory, anchored patterns to its root
+		"web/dist/app.js":       false,
+		"dist/app.js":           true,
+		"web/src/dist/app.js":   true,
+		"web/debug.log":         true,
+		"web/api/types.gen.go":  false,
+		"types.gen.go":          true,
+		"web/api/.golineignore": false,
+		"web/api/handler.go":    true,
+	}
+	for path, allowed := range tests {
+		if got := controller.ValidateAccess(path); got != allowed {
+			t.Errorf("ValidateAccess(%q) = %v, want %v", path, got, allowed)
+		}
+	}
+}
+
+func TestNegationAndWalkAllowed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	files := map[string]string{
+		".golineignore":          "generated/*\n!generated/keep/\nsecrets/\n!secrets/public.txt\n",
+		"main.go":                "package main",
+		"generated/a.go":         "package generated",
+		"generated/keep/b.go":    "package keep",
+		"secrets/public.txt":     "public",
+		"secrets/token.txt":      "token",
+		"docs/.golineignore":     "*.md\n",
+		"docs/sub/.golineignore": "!README.md\n",
+		"docs/sub/README.md":     "readme",
+		"docs/guide.md":          "guide",
+	}
+	for path, content := range files {
+		path = filepath.Join(tempDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	controller := NewController(tempDir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize controller: %v", err)
+	}
+
+	tests := map[string]bool{
+		"generated/a.go":      false,
+		"generated/keep/b.go": true,
+		// The parent directory is ignored, so the negated pattern cannot re-include the file
+		"secrets/public.txt": false,
+		// A nested file re-includes a file ignored by its parent directory's file
+		"docs/sub/README.md": true,
+		"docs/guide.md":      false,
+	}
+	for path, allowed := range tests {
+		if got := controller.ValidateAccess(path); got != allowed {
+			t.Errorf("ValidateAccess(%q) = %v, want %v", path, got, allowed)
+		}
+	}
+
+	var walked []string
+	err := controller.WalkAllowed(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tempDir, path)
+		walked = append(walked, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkAllowed() error = %v", err)
+	}
+	want := []string{".", "docs", "docs/sub", "docs/sub/README.md", "generated", "generated/keep", "generated/keep/b.go", "main.go"}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("walked %v, want %v", walked, want)
+	}
+}
+
+func TestDeny(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, IgnoreFileName), []byte("!customers/\n!*.csv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	controller := NewController(tempDir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize controller: %v", err)
+	}
+	controller.Deny("customers/", "*.csv", "!customers/public.txt")
+	// The denied patterns survive reloads
+	if err := controller.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	tests := map[string]bool{
+		"customers/list.txt":   false,
+		"customers/public.txt": false,
+		"data/export.csv":      false,
+		"main.go":              true,
+	}
+	for path, allowed := range tests {
+		if got := controller.ValidateAccess(path); got != allowed {
+			t.Errorf("ValidateAccess(%q) = %v, want %v", path, got, allowed)
+		}
+	}
+	if got := controller.ValidateCommand("cat data/export.csv"); got == "" {
+		t.Error("ValidateCommand() allowed a denied file")
+	}
+}
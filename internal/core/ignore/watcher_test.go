@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/fswatch"
 )
 
 func TestWatcherManualReload(t *testing.T) {
@@ -80,3 +83,38 @@ func TestWatcherManualReload(t *testing.T) {
 		t.Errorf("Expected test.txt to be allowed after deletion, but it was blocked")
 	}
 }
+
+func TestWatcherReloadsOnChange(t *testing.T) {
+	tempDir := t.TempDir()
+	ignoreFilePath := filepath.Join(tempDir, ".golineignore")
+	if err := os.WriteFile(ignoreFilePath, []byte("*.secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .golineignore file: %v", err)
+	}
+	controller := NewController(tempDir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize controller: %v", err)
+	}
+
+	service, err := fswatch.New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to watch the workspace: %v", err)
+	}
+	defer service.Close()
+	watcher := NewWatcher(controller, service)
+	watcher.Start()
+	defer watcher.Stop()
+
+	if err := os.WriteFile(ignoreFilePath, []byte("*.txt\n"), 0644); err != nil {
+		t.Fatalf("Failed to update .golineignore file: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for controller.ValidateAccess("test.txt") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the controller to be reloaded after .golineignore changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !controller.ValidateAccess("test.secret") {
+		t.Errorf("Expected test.secret to be allowed after the reload, but it was blocked")
+	}
+}
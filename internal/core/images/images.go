@@ -0,0 +1,179 @@
+// Package images loads the images attached to messages for vision models: it validates them
+// and scales the large ones down to the size the models read, so that they fit the requests.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+const (
+	// MaxFileBytes is the size of the largest image file that can be attached
+	MaxFileBytes = 20 * 1024 * 1024
+	// MaxDimension is the longest side of the images sent, larger images are scaled down as the
+	// models would scale them anyway
+	MaxDimension = 1568
+	// MaxEncodedBytes is the size of the largest encoded image sent, 5 MB once in base64
+	MaxEncodedBytes = 5 * 1024 * 1024 * 3 / 4
+	// maxPixels is the number of pixels of the largest image decoded, so that a small file
+	// claiming huge dimensions does not exhaust the memory
+	maxPixels = 64 * 1024 * 1024
+	// jpegQuality is the quality of the images encoded as JPEG
+	jpegQuality = 85
+)
+
+// ErrUnsupported is returned for files that are not PNG, JPEG or GIF images
+var ErrUnsupported = errors.New("unsupported image format")
+
+// extensions are the extensions of the image files that can be attached
+var extensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// IsImagePath reports whether a path has the extension of an image file that can be attached
+func IsImagePath(path string) bool {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Attachment is an image attached to a message, ready to be sent to a model
+type Attachment struct {
+	// Name is the name of the attached file
+	Name string
+	// Width and Height are the dimensions of the image sent
+	Width, Height int
+	// Resized tells that the image was scaled down or encoded again to fit the limits
+	Resized bool
+	// Image is the encoded image
+	Image provider.Image
+}
+
+// Placeholder returns the text standing for the image in the history and in the message
+func (a Attachment) Placeholder() string {
+	return fmt.Sprintf("[image: %s %dx%d]", a.Name, a.Width, a.Height)
+}
+
+// Load reads and validates an image file, scaling it down when it exceeds MaxDimension or
+// MaxEncodedBytes
+func Load(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if info.IsDir() {
+		return Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > MaxFileBytes {
+		return Attachment{}, fmt.Errorf("%s is larger than %d MB", path, MaxFileBytes/1024/1024)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Decode(filepath.Base(path), data)
+}
+
+// Decode validates an encoded image, scaling it down when it exceeds MaxDimension or
+// MaxEncodedBytes. The images within the limits are sent as they are.
+func Decode(name string, data []byte) (Attachment, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("%s is not a PNG, JPEG or GIF image: %w", name, ErrUnsupported)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return Attachment{}, fmt.Errorf("%s has unsupported dimensions %dx%d", name, config.Width, config.Height)
+	}
+	attachment := Attachment{Name: name, Width: config.Width, Height: config.Height}
+	if max(config.Width, config.Height) <= MaxDimension && len(data) <= MaxEncodedBytes {
+		attachment.Image = provider.Image{MediaType: "image/" + format, Data: data}
+		return attachment, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	img = scale(img, MaxDimension)
+	encoded, mediaType, err := encode(img, format)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	if len(encoded) > MaxEncodedBytes {
+		return Attachment{}, fmt.Errorf("%s is still larger than %d MB once scaled down", name, MaxEncodedBytes/1024/1024)
+	}
+	bounds := img.Bounds()
+	attachment.Width, attachment.Height, attachment.Resized = bounds.Dx(), bounds.Dy(), true
+	attachment.Image = provider.Image{MediaType: mediaType, Data: encoded}
+	return attachment, nil
+}
+
+// encode encodes a scaled image as a JPEG if it was one, and otherwise as a PNG to keep its
+// transparency, falling back to a JPEG when the PNG is too large
+func encode(img image.Image, format string) ([]byte, string, error) {
+	var b bytes.Buffer
+	if format != "jpeg" {
+		if err := png.Encode(&b, img); err != nil {
+			return nil, "", err
+		}
+		if b.Len() <= MaxEncodedBytes {
+			return b.Bytes(), "image/png", nil
+		}
+		b.Reset()
+	}
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, "", err
+	}
+	return b.Bytes(), "image/jpeg", nil
+}
+
+// scale scales an image down so that its longest side is at most maxSide, averaging the source
+// pixels each scaled pixel covers. Smaller images are returned as they are.
+func scale(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if max(width, height) <= maxSide {
+		return src
+	}
+	dstWidth, dstHeight := maxSide, max(1, height*maxSide/width)
+	if height > width {
+		dstWidth, dstHeight = max(1, width*maxSide/height), maxSide
+	}
+
+	// Reading the pixels is much faster from an RGBA image than through At
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+	origin := rgba.Bounds().Min
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := range dstHeight {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := range dstWidth {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := rgba.PixOffset(origin.X+sx, origin.Y+sy)
+					r += int(rgba.Pix[i])
+					g += int(rgba.Pix[i+1])
+					b += int(rgba.Pix[i+2])
+					a += int(rgba.Pix[i+3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
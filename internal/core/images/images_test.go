@@ -0,0 +1,100 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.png")
+	data := encodePNG(t, 40, 20)
+	if err := os.WriteFile(small, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	attachment, err := Load(small)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if attachment.Resized || attachment.Image.MediaType != "image/png" || !bytes.Equal(attachment.Image.Data, data) {
+		t.Errorf("attachment = %+v, want the file sent as it is", attachment)
+	}
+	if got := attachment.Placeholder(); got != "[image: small.png 40x20]" {
+		t.Errorf("Placeholder() = %q", got)
+	}
+
+	text := filepath.Join(dir, "notes.png")
+	if err := os.WriteFile(text, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(text); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Load() of a text file error = %v, want ErrUnsupported", err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("Load() of a directory succeeded")
+	}
+}
+
+func TestDecodeScalesLargeImages(t *testing.T) {
+	attachment, err := Decode("wide.png", encodePNG(t, 2*MaxDimension, MaxDimension/2))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !attachment.Resized || attachment.Width != MaxDimension || attachment.Height != MaxDimension/4 {
+		t.Errorf("attachment = %dx%d resized %v, want %dx%d", attachment.Width, attachment.Height, attachment.Resized, MaxDimension, MaxDimension/4)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(attachment.Image.Data))
+	if err != nil || format != "png" || config.Width != attachment.Width || config.Height != attachment.Height {
+		t.Errorf("encoded image = %s %dx%d, error %v", format, config.Width, config.Height, err)
+	}
+}
+
+func TestScaleAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := range 4 {
+		for y := range 2 {
+			if x%2 == 0 {
+				src.SetRGBA(x, y, color.RGBA{R: 200, A: 255})
+			} else {
+				src.SetRGBA(x, y, color.RGBA{B: 100, A: 255})
+			}
+		}
+	}
+	dst := scale(src, 2)
+	if got := dst.Bounds(); got.Dx() != 2 || got.Dy() != 1 {
+		t.Fatalf("scaled bounds = %v, want 2x1", got)
+	}
+	if got := dst.At(0, 0).(color.RGBA); got != (color.RGBA{R: 100, B: 50, A: 255}) {
+		t.Errorf("scaled pixel = %v, want the average of the pixels it covers", got)
+	}
+}
+
+func TestIsImagePath(t *testing.T) {
+	for path, want := range map[string]bool{"shot.png": true, "photo.JPEG": true, "anim.gif": true, "main.go": false, "image": false} {
+		if got := IsImagePath(path); got != want {
+			t.Errorf("IsImagePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
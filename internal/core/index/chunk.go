@@ -0,0 +1,47 @@
+package index
+
+import "strings"
+
+const (
+	// chunkLines is the number of lines of a chunk
+	chunkLines = 40
+	// chunkOverlap is the number of lines shared by consecutive chunks, so code spanning a
+	// chunk boundary is found in one of them
+	chunkOverlap = 10
+	// maxChunkBytes cuts chunks of very long lines, e.g. minified code
+	maxChunkBytes = 4000
+)
+
+// Chunk is a range of lines of a file
+type Chunk struct {
+	// Path of the file, relative to the root of the workspace with forward slashes
+	Path string
+	// StartLine is the first line of the chunk, starting at 1
+	StartLine int
+	// EndLine is the last line of the chunk, inclusive
+	EndLine int
+	// Content is the content of the lines
+	Content string
+}
+
+// SplitFile splits the content of a file into overlapping chunks of lines.
+// Blank chunks are left out.
+func SplitFile(path, content string) []Chunk {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if len(text) > maxChunkBytes {
+			text = text[:maxChunkBytes]
+		}
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, Chunk{Path: path, StartLine: start + 1, EndLine: end, Content: text})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,193 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultHashDimensions is the number of dimensions of the vectors of the hash embedder
+const DefaultHashDimensions = 512
+
+// embeddingBatchSize is the number of texts sent in one request to an embeddings API
+const embeddingBatchSize = 64
+
+// Embedder computes the embeddings of texts
+type Embedder interface {
+	// Name identifies the embedder and its model, an index is rebuilt when it changes
+	Name() string
+	// Embed returns the vector of each text, all of the same dimensions
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HashEmbedder embeds texts locally by hashing the identifiers and words they contain into
+// a fixed number of dimensions. It needs no model nor network, and finds code sharing its
+// vocabulary with the query rather than code with the same meaning.
+type HashEmbedder struct {
+	// Dimensions is the number of dimensions of the vectors, DefaultHashDimensions if zero
+	Dimensions int
+}
+
+// Name implements Embedder
+func (e HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", e.dimensions())
+}
+
+func (e HashEmbedder) dimensions() int {
+	if e.Dimensions <= 0 {
+		return DefaultHashDimensions
+	}
+	return e.Dimensions
+}
+
+// Embed implements Embedder
+func (e HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+// embed hashes the terms of a text into a vector weighted by their log frequency
+func (e HashEmbedder) embed(text string) []float32 {
+	counts := make(map[string]int)
+	for _, term := range terms(text) {
+		counts[term]++
+	}
+
+	vector := make([]float32, e.dimensions())
+	for term, count := range counts {
+		h := fnv.New32a()
+		h.Write([]byte(term))
+		sum := h.Sum32()
+		// The sign bit spreads the collisions of terms hashed to the same dimension around zero
+		weight := float32(1 + math.Log(float64(count)))
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		vector[int(sum%uint32(len(vector)))] += weight
+	}
+	normalize(vector)
+	return vector
+}
+
+// terms returns the lowercase identifiers of a text, and the words of the identifiers
+// written in camelCase or snake_case, so "parseConfigFile" matches "config file"
+func terms(text string) []string {
+	var terms []string
+	for _, identifier := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		words := splitIdentifier(identifier)
+		if len(words) > 1 {
+			terms = append(terms, strings.ToLower(identifier))
+		}
+		for _, word := range words {
+			if len(word) > 1 {
+				terms = append(terms, strings.ToLower(word))
+			}
+		}
+	}
+	return terms
+}
+
+// splitIdentifier splits an identifier at underscores and case changes
+func splitIdentifier(identifier string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(identifier)
+	for i, r := range runes {
+		if r == '_' {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		}
+		// A new word starts at an uppercase letter after a lowercase one, or before the last
+		// uppercase letter of an acronym, as in "HTTPServer"
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// normalize scales a vector to a length of 1, so the dot product of two vectors is their cosine similarity
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// OpenAIEmbedder embeds texts with an OpenAI-compatible embeddings API
+type OpenAIEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIEmbedder creates an embedder calling the embeddings API at endpoint, the OpenAI API if empty
+func NewOpenAIEmbedder(apiKey, endpoint, model string) *OpenAIEmbedder {
+	cfg := openai.DefaultConfig(apiKey)
+	if endpoint != "" {
+		cfg.BaseURL = strings.TrimSuffix(endpoint, "/")
+	}
+	return &OpenAIEmbedder{client: openai.NewClientWithConfig(cfg), model: model}
+}
+
+// Name implements Embedder
+func (e *OpenAIEmbedder) Name() string {
+	return "openai:" + e.model
+}
+
+// Embed implements Embedder
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch := texts[start:min(start+embeddingBatchSize, len(texts))]
+		resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input: batch,
+			Model: openai.EmbeddingModel(e.model),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed texts: %w", err)
+		}
+		for _, embedding := range resp.Data {
+			if embedding.Index < 0 || embedding.Index >= len(batch) {
+				return nil, fmt.Errorf("embeddings API returned an embedding for unknown input %d", embedding.Index)
+			}
+			vector := embedding.Embedding
+			normalize(vector)
+			vectors[start+embedding.Index] = vector
+		}
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("embeddings API returned no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,383 @@
+// Package index builds a semantic index of the files of a workspace, to find the code related
+// to a query by the similarity of the embeddings of their chunks.
+package index
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kazz187/goline/internal/core/fswatch"
+	"github.com/kazz187/goline/internal/core/ignore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// formatVersion is the version of the stored index, an index of another version is rebuilt
+	formatVersion = 1
+	// maxFileSize skips large files, which are generated or data rather than code
+	maxFileSize = 1 << 20
+	// DefaultLimit is the number of results of a search when no limit is given
+	DefaultLimit = 10
+)
+
+// skippedDirs are directories that are never indexed
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".goline":      true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Index is the semantic index of a workspace. It is safe for concurrent use.
+type Index struct {
+	mu         sync.Mutex
+	root       string
+	path       string
+	embedder   Embedder
+	ignore     *ignore.Controller
+	files      map[string]*pb.IndexedFile
+	dimensions int
+}
+
+// Stats describes an update of the index
+type Stats struct {
+	// Files is the number of indexed files
+	Files int
+	// Updated is the number of files indexed again because they were created or modified
+	Updated int
+	// Removed is the number of files removed from the index because they were deleted or ignored
+	Removed int
+	// Chunks is the number of indexed chunks
+	Chunks int
+}
+
+// Result is a chunk found by a search
+type Result struct {
+	Chunk
+	// Score is the cosine similarity of the chunk to the query, up to 1
+	Score float64
+}
+
+// DefaultPath returns where the index of a workspace is stored, ~/.goline/index/<hash of the root>.pb
+func DefaultPath(root string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(homeDir, ".goline", "index", hex.EncodeToString(sum[:8])+".pb"), nil
+}
+
+// Open loads the index of the workspace at root stored at path. The index is empty if it was
+// not built yet, or built by another embedder, and is filled by Update.
+func Open(path, root string, embedder Embedder) (*Index, error) {
+	controller := ignore.NewController(root)
+	if err := controller.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to load .golineignore: %w", err)
+	}
+	ix := &Index{
+		root:     root,
+		path:     path,
+		embedder: embedder,
+		ignore:   controller,
+		files:    make(map[string]*pb.IndexedFile),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	stored := &pb.SemanticIndex{}
+	if err := proto.Unmarshal(data, stored); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	if stored.Version != formatVersion || stored.Root != root || stored.Embedder != embedder.Name() {
+		return ix, nil
+	}
+	ix.dimensions = int(stored.Dimensions)
+	for _, file := range stored.Files {
+		ix.files[file.Path] = file
+	}
+	return ix, nil
+}
+
+// Update indexes the files created or modified since the last update and removes the deleted ones
+func (ix *Index) Update(ctx context.Context) (Stats, error) {
+	current := make(map[string]fs.FileInfo)
+	err := ix.ignore.WalkAllowed(ix.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear while walking
+			return nil
+		}
+		if d.IsDir() {
+			if path != ix.root && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		relPath, err := filepath.Rel(ix.root, path)
+		if err != nil {
+			return nil
+		}
+		current[filepath.ToSlash(relPath)] = info
+		return ctx.Err()
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	ix.mu.Lock()
+	var removed []string
+	for path := range ix.files {
+		if _, ok := current[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	ix.mu.Unlock()
+	return ix.refresh(ctx, current, removed)
+}
+
+// UpdateFiles indexes again the files at the paths, relative to the root, e.g. the files
+// reported by a watcher. Deleted and ignored files are removed from the index.
+func (ix *Index) UpdateFiles(ctx context.Context, paths []string) (Stats, error) {
+	current := make(map[string]fs.FileInfo)
+	var removed []string
+	for _, path := range paths {
+		path = filepath.ToSlash(path)
+		absPath := filepath.Join(ix.root, filepath.FromSlash(path))
+		info, err := os.Stat(absPath)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize || !ix.ignore.ValidateAccess(absPath) || inSkippedDir(path) {
+			removed = append(removed, path)
+			continue
+		}
+		current[path] = info
+	}
+	return ix.refresh(ctx, current, removed)
+}
+
+// inSkippedDir reports whether a relative path is in a directory that is never indexed
+func inSkippedDir(path string) bool {
+	dirs := strings.Split(path, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		if skippedDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh indexes the files of current whose size or modification time changed and removes
+// the files of removed
+func (ix *Index) refresh(ctx context.Context, current map[string]fs.FileInfo, removed []string) (Stats, error) {
+	ix.mu.Lock()
+	var changed []*pb.IndexedFile
+	for path, info := range current {
+		file, ok := ix.files[path]
+		if ok && file.Size == info.Size() && file.ModTime == info.ModTime().UnixNano() {
+			continue
+		}
+		changed = append(changed, &pb.IndexedFile{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()})
+	}
+	ix.mu.Unlock()
+
+	// Embed the chunks of all changed files at once, without holding the lock during the requests
+	var chunks []Chunk
+	var owners []*pb.IndexedFile
+	for _, file := range changed {
+		data, err := os.ReadFile(filepath.Join(ix.root, filepath.FromSlash(file.Path)))
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			// Unreadable and binary files are indexed without chunks, so they are not read again until they change
+			continue
+		}
+		for _, chunk := range SplitFile(file.Path, string(data)) {
+			chunks = append(chunks, chunk)
+			owners = append(owners, file)
+		}
+	}
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Path + "\n" + chunk.Content
+	}
+	var vectors [][]float32
+	if len(texts) > 0 {
+		var err error
+		if vectors, err = ix.embedder.Embed(ctx, texts); err != nil {
+			return Stats{}, err
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for i, chunk := range chunks {
+		if ix.dimensions == 0 {
+			ix.dimensions = len(vectors[i])
+		}
+		if len(vectors[i]) != ix.dimensions {
+			return Stats{}, fmt.Errorf("embedder returned %d dimensions, the index has %d", len(vectors[i]), ix.dimensions)
+		}
+		owners[i].Chunks = append(owners[i].Chunks, &pb.IndexChunk{
+			StartLine: int32(chunk.StartLine),
+			EndLine:   int32(chunk.EndLine),
+			Content:   chunk.Content,
+			Vector:    vectors[i],
+		})
+	}
+	for _, file := range changed {
+		ix.files[file.Path] = file
+	}
+
+	stats := Stats{Updated: len(changed)}
+	for _, path := range removed {
+		if _, ok := ix.files[path]; ok {
+			delete(ix.files, path)
+			stats.Removed++
+		}
+	}
+	stats.Files = len(ix.files)
+	for _, file := range ix.files {
+		stats.Chunks += len(file.Chunks)
+	}
+	return stats, nil
+}
+
+// Save stores the index, replacing the stored one atomically
+func (ix *Index) Save() error {
+	ix.mu.Lock()
+	stored := &pb.SemanticIndex{
+		Version:    formatVersion,
+		Root:       ix.root,
+		Embedder:   ix.embedder.Name(),
+		Dimensions: int32(ix.dimensions),
+	}
+	for _, file := range ix.files {
+		stored.Files = append(stored.Files, file)
+	}
+	slices.SortFunc(stored.Files, func(a, b *pb.IndexedFile) int { return strings.Compare(a.Path, b.Path) })
+	data, err := proto.Marshal(stored)
+	ix.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmp, ix.path); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// Search returns the chunks most similar to the query, most similar first. Only the files
+// under dir, relative to the root, are searched if it is not empty.
+func (ix *Index) Search(ctx context.Context, query, dir string, limit int) ([]Result, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	vectors, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+
+	prefix := strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+	if prefix == "." {
+		prefix = ""
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var results []Result
+	for path, file := range ix.files {
+		if prefix != "" && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		for _, chunk := range file.Chunks {
+			if len(chunk.Vector) != len(queryVector) {
+				continue
+			}
+			results = append(results, Result{
+				Chunk: Chunk{Path: path, StartLine: int(chunk.StartLine), EndLine: int(chunk.EndLine), Content: chunk.Content},
+				Score: dot(queryVector, chunk.Vector),
+			})
+		}
+	}
+	slices.SortFunc(results, func(a, b Result) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.StartLine, b.StartLine)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// WatchIgnore reloads the .golineignore patterns of the index when they change in the
+// workspace watched by service, until the returned function is called
+func (ix *Index) WatchIgnore(service *fswatch.Service) (stop func()) {
+	watcher := ignore.NewWatcher(ix.ignore, service)
+	watcher.Start()
+	return watcher.Stop
+}
+
+// Len returns the number of indexed files
+func (ix *Index) Len() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return len(ix.files)
+}
+
+// dot returns the dot product of two vectors of the same dimensions
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// FormatResults formats search results for the AI, each chunk with its location and score
+func FormatResults(results []Result) string {
+	if len(results) == 0 {
+		return "No results found."
+	}
+	var b strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "%s:%d-%d (score %.2f)\n%s", result.Path, result.StartLine, result.EndLine, result.Score, result.Content)
+	}
+	return b.String()
+}
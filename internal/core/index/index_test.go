@@ -0,0 +1,138 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitFile(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 75; i++ {
+		lines = append(lines, "line")
+	}
+	chunks := SplitFile("a.go", strings.Join(lines, "\n")+"\n")
+
+	var ranges [][2]int
+	for _, chunk := range chunks {
+		ranges = append(ranges, [2]int{chunk.StartLine, chunk.EndLine})
+	}
+	want := [][2]int{{1, 40}, {31, 70}, {61, 75}}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("SplitFile() ranges = %v, want %v", ranges, want)
+	}
+	if got := SplitFile("blank.txt", "\n\n  \n"); len(got) != 0 {
+		t.Errorf("SplitFile() of a blank file = %v, want no chunks", got)
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := map[string][]string{
+		"parseConfigFile": {"parse", "Config", "File"},
+		"HTTPServer":      {"HTTP", "Server"},
+		"max_chunk_bytes": {"max", "chunk", "bytes"},
+		"utf8Decode":      {"utf8", "Decode"},
+		"plain":           {"plain"},
+	}
+	for identifier, want := range tests {
+		if got := splitIdentifier(identifier); !slices.Equal(got, want) {
+			t.Errorf("splitIdentifier(%q) = %v, want %v", identifier, got, want)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "retry.go", "func retryDelay(attempt int) time.Duration {\n\treturn backoff * attempt\n}\n")
+	writeFile(t, root, "render/markdown.go", "func renderMarkdown(text string) string {\n\treturn glamour.Render(text)\n}\n")
+	writeFile(t, root, "secret/keys.go", "func retryDelayKeys() {}\n")
+	writeFile(t, root, ".golineignore", "secret/\n")
+	path := filepath.Join(t.TempDir(), "index.pb")
+	ctx := context.Background()
+
+	ix, err := Open(path, root, HashEmbedder{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	stats, err := ix.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if stats.Files != 2 || stats.Updated != 2 {
+		t.Errorf("Update() stats = %+v, want 2 files indexed without the ignored ones", stats)
+	}
+
+	results, err := ix.Search(ctx, "retry delay", "", 2)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Path != "retry.go" || results[0].StartLine != 1 || results[0].EndLine != 3 {
+		t.Fatalf("Search() = %+v, want retry.go first", results)
+	}
+	results, err = ix.Search(ctx, "retry delay", "render", 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Path != "render/markdown.go" {
+		t.Errorf("Search() in render = %+v, want only render/markdown.go", results)
+	}
+
+	// Unchanged files are not indexed again, deleted files are removed
+	if err := os.Remove(filepath.Join(root, "retry.go")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = ix.UpdateFiles(ctx, []string{"retry.go", "render/markdown.go"})
+	if err != nil {
+		t.Fatalf("UpdateFiles() error = %v", err)
+	}
+	if stats.Updated != 0 || stats.Removed != 1 || stats.Files != 1 {
+		t.Errorf("UpdateFiles() stats = %+v, want retry.go removed", stats)
+	}
+
+	if err := ix.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reopened, err := Open(path, root, HashEmbedder{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if reopened.Len() != 1 {
+		t.Errorf("reopened index has %d files, want 1", reopened.Len())
+	}
+	if stats, err := reopened.Update(ctx); err != nil || stats.Updated != 0 {
+		t.Errorf("Update() of the reopened index = %+v, %v, want nothing to update", stats, err)
+	}
+
+	// An index built by another embedder is rebuilt
+	other, err := Open(path, root, HashEmbedder{Dimensions: 64})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if other.Len() != 0 {
+		t.Errorf("index of another embedder has %d files, want it rebuilt", other.Len())
+	}
+}
+
+func TestFormatResults(t *testing.T) {
+	got := FormatResults([]Result{{Chunk: Chunk{Path: "a.go", StartLine: 3, EndLine: 4, Content: "x\ny"}, Score: 0.5}})
+	if want := "a.go:3-4 (score 0.50)\nx\ny"; got != want {
+		t.Errorf("FormatResults() = %q, want %q", got, want)
+	}
+	if got := FormatResults(nil); got != "No results found." {
+		t.Errorf("FormatResults(nil) = %q", got)
+	}
+}
+
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	absPath := filepath.Join(root, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(absPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,191 @@
+package mentions
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFolderDepth is the number of levels of a mentioned folder rendered in its tree, the
+	// folders below are listed without their content
+	maxFolderDepth = 3
+	// maxFolderEntries is the number of files and folders rendered in the tree of a folder
+	maxFolderEntries = 500
+	// maxFileBytes is the size of the largest file whose content is included with a folder
+	maxFileBytes = 100 * 1024
+	// maxFolderBytes is the total size of the file contents included with a folder
+	maxFolderBytes = 512 * 1024
+	// sniffBytes is the size of the beginning of a file sniffed to detect binary content
+	sniffBytes = 8000
+)
+
+// treeNode is a file or folder of the tree of a mentioned folder
+type treeNode struct {
+	name string
+	dir  bool
+	// collapsed folders are below maxFolderDepth and their content is not listed
+	collapsed bool
+	children  []*treeNode
+	// note tells why the content of a file is not included, empty if it is
+	note string
+}
+
+// getFolderContent renders the tree of a folder down to maxFolderDepth levels, followed by the
+// content of its text files within maxFileBytes per file and maxFolderBytes in total. The
+// files and folders ignored by .golineignore or denied are left out.
+func (e *expander) getFolderContent(dir string) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a folder", filepath.Base(dir))
+	}
+
+	root := &treeNode{dir: true}
+	folders := map[string]*treeNode{".": root}
+	var contents []string
+	entries, total, truncated, walked := 0, 0, false, false
+	err = e.controller.WalkAllowed(dir, func(p string, d fs.DirEntry, err error) error {
+		if p == dir {
+			walked = true
+			return err
+		}
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entries >= maxFolderEntries {
+			truncated = true
+			return filepath.SkipAll
+		}
+		entries++
+
+		node := &treeNode{name: d.Name(), dir: d.IsDir()}
+		parent := folders[path.Dir(rel)]
+		parent.children = append(parent.children, node)
+		if d.IsDir() {
+			if strings.Count(rel, "/")+1 >= maxFolderDepth {
+				node.collapsed = true
+				return filepath.SkipDir
+			}
+			folders[rel] = node
+			return nil
+		}
+
+		content, note := readMentionedFile(p, maxFolderBytes-total)
+		node.note = note
+		if note == "" {
+			total += len(content)
+			e.record(p, len(content))
+			relPath, _ := filepath.Rel(e.cwd, p)
+			contents = append(contents, fmt.Sprintf("<file_content path=\"%s\">\n%s\n</file_content>", filepath.ToSlash(relPath), content))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !walked {
+		return "", e.blockedError(dir)
+	}
+
+	if len(root.children) == 0 {
+		return "(Empty folder)", nil
+	}
+	var b strings.Builder
+	renderTree(&b, root, "")
+	if truncated {
+		fmt.Fprintf(&b, "(only the first %d entries are listed)\n", maxFolderEntries)
+	}
+	if len(contents) > 0 {
+		b.WriteString("\n" + strings.Join(contents, "\n\n"))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// renderTree writes the children of a folder as tree lines, with the notes of the files whose
+// content is not included
+func renderTree(b *strings.Builder, node *treeNode, prefix string) {
+	for i, child := range node.children {
+		linePrefix, childPrefix := "├── ", "│   "
+		if i == len(node.children)-1 {
+			linePrefix, childPrefix = "└── ", "    "
+		}
+		name := child.name
+		if child.dir {
+			name += "/"
+		}
+		switch {
+		case child.collapsed:
+			name += " …"
+		case child.note != "":
+			name += " (" + child.note + ")"
+		}
+		fmt.Fprintf(b, "%s%s%s\n", prefix, linePrefix, name)
+		if child.dir {
+			renderTree(b, child, prefix+childPrefix)
+		}
+	}
+}
+
+// readMentionedFile reads a file included with a folder, within budget bytes. It returns the
+// note telling why its content is left out instead when it is binary or too large.
+func readMentionedFile(path string, budget int) (string, string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "unreadable"
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", "unreadable"
+	}
+	switch {
+	case info.Size() > maxFileBytes:
+		return "", fmt.Sprintf("%d KB, content left out", info.Size()/1024)
+	case info.Size() > int64(budget):
+		return "", "content left out, the size limit of the folder was reached"
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", "unreadable"
+	}
+	if isBinaryContent(data) {
+		return "", "binary"
+	}
+	return string(data), ""
+}
+
+// isBinaryContent reports whether the beginning of the content of a file looks binary: it has
+// NUL bytes or is not valid UTF-8
+func isBinaryContent(data []byte) bool {
+	sample := data
+	if len(sample) > sniffBytes {
+		sample = sample[:sniffBytes]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	// The sample may end in the middle of a multi-byte character
+	if len(data) > sniffBytes {
+		for i := 0; i < utf8.UTFMax-1 && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	return !utf8.Valid(sample)
+}
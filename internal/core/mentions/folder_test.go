@@ -0,0 +1,92 @@
+package mentions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetFolderContent(t *testing.T) {
+	cwd := t.TempDir()
+	files := map[string]string{
+		".golineignore":          "src/secret.txt\nsrc/build/\n",
+		"src/main.go":            "package main\n",
+		"src/pkg/util.go":        "package pkg\n",
+		"src/pkg/deep/more/x.go": "package more\n",
+		"src/secret.txt":         "TOKEN\n",
+		"src/build/out.txt":      "output\n",
+		"src/logo.dat":           "\x89PNG\x00\x00",
+		"src/big.txt":            strings.Repeat("x", maxFileBytes+1),
+		"src/.git/HEAD":          "ref: refs/heads/main\n",
+		"src/notes.txt":          "notes\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var recorded []string
+	e := newExpander(cwd, Options{RecordFile: func(path string, size int) { recorded = append(recorded, path) }})
+	got, err := e.getFolderContent(filepath.Join(cwd, "src"))
+	if err != nil {
+		t.Fatalf("getFolderContent() error = %v", err)
+	}
+	wantTree := `├── big.txt (100 KB, content left out)
+├── logo.dat (binary)
+├── main.go
+├── notes.txt
+└── pkg/
+    ├── deep/
+    │   └── more/ …
+    └── util.go
+`
+	if !strings.HasPrefix(got, wantTree) {
+		t.Errorf("getFolderContent() tree =\n%s\nwant\n%s", got, wantTree)
+	}
+	for _, want := range []string{
+		"<file_content path=\"src/main.go\">\npackage main\n\n</file_content>",
+		"<file_content path=\"src/pkg/util.go\">\npackage pkg\n\n</file_content>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("getFolderContent() does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"secret", "TOKEN", "build", ".git", "package more"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("getFolderContent() contains %q:\n%s", unwanted, got)
+		}
+	}
+
+	if strings.Join(recorded, ",") != "src/main.go,src/notes.txt,src/pkg/util.go" {
+		t.Errorf("recorded files = %q", recorded)
+	}
+
+	if _, err := e.getFolderContent(filepath.Join(cwd, "src", "build")); err == nil || !strings.Contains(err.Error(), ".golineignore") {
+		t.Errorf("getFolderContent() of an ignored folder error = %v", err)
+	}
+}
+
+func TestIsBinaryContent(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"text", []byte("hello\n"), false},
+		{"utf-8", []byte("こんにちは\n"), false},
+		{"nul byte", []byte("a\x00b"), true},
+		{"invalid utf-8", []byte{0xff, 0xfe, 'a'}, true},
+		{"character cut by the sample", []byte(strings.Repeat("a", sniffBytes-1) + "あ"), false},
+	}
+	for _, tt := range tests {
+		if got := isBinaryContent(tt.data); got != tt.want {
+			t.Errorf("isBinaryContent(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package mentions
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/kazz187/goline/internal/core/ignore"
 )
 
 // MentionType represents the type of mention
@@ -40,57 +43,52 @@ type Mention struct {
 	Processed string
 }
 
-// mentionRegex is the regular expression for detecting mentions
-var mentionRegex = regexp.MustCompile(`@([^\s]+)`)
-
-// ParseMentions parses mentions in a message
+// ParseMentions parses mentions in a message, see scanMentions for their syntax
 func ParseMentions(text string) []Mention {
 	var mentions []Mention
+	for _, s := range scanMentions(text) {
+		mentions = append(mentions, parseMention(s.text))
+	}
+	return mentions
+}
 
-	matches := mentionRegex.FindAllStringSubmatch(text, -1)
-	for _, match := range matches {
-		if len(match) < 2 {
-			continue
-		}
-
-		mentionText := match[1]
-		mention := Mention{
-			Original: mentionText,
-		}
+// parseMention determines the type of a mention from its text
+func parseMention(mentionText string) Mention {
+	mention := Mention{
+		Original: mentionText,
+	}
 
-		// Determine the type of mention
-		if mentionText == "problems" {
-			mention.Type = ProblemsMention
-			mention.Processed = "Workspace Problems"
-		} else if mentionText == "terminal" {
-			mention.Type = TerminalMention
-			mention.Processed = "Terminal Output"
-		} else if mentionText == "git-changes" {
-			mention.Type = GitChangesMention
-			mention.Processed = "Working directory changes"
-		} else if strings.HasPrefix(mentionText, "http") {
-			mention.Type = URLMention
-			mention.Processed = mentionText
-		} else if strings.HasPrefix(mentionText, "/") {
-			if strings.HasSuffix(mentionText, "/") {
-				mention.Type = FolderMention
-				mention.Processed = mentionText[1:] // Remove leading slash
-			} else {
-				mention.Type = FileMention
-				mention.Processed = mentionText[1:] // Remove leading slash
-			}
-		} else if isGitCommitHash(mentionText) {
-			mention.Type = GitCommitMention
-			mention.Processed = fmt.Sprintf("Git commit '%s'", mentionText)
+	// Determine the type of mention
+	if mentionText == "problems" {
+		mention.Type = ProblemsMention
+		mention.Processed = "Workspace Problems"
+	} else if mentionText == "terminal" {
+		mention.Type = TerminalMention
+		mention.Processed = "Terminal Output"
+	} else if mentionText == "git-changes" {
+		mention.Type = GitChangesMention
+		mention.Processed = "Working directory changes"
+	} else if strings.HasPrefix(mentionText, "http") {
+		mention.Type = URLMention
+		mention.Processed = mentionText
+	} else if strings.HasPrefix(mentionText, "/") || strings.HasPrefix(mentionText, `\`) {
+		// Paths typed on Windows, e.g. @\src\main.go, are read with forward slashes
+		path := strings.ReplaceAll(mentionText, `\`, "/")
+		if strings.HasSuffix(path, "/") {
+			mention.Type = FolderMention
 		} else {
-			mention.Type = UnknownMention
-			mention.Processed = mentionText
+			mention.Type = FileMention
 		}
-
-		mentions = append(mentions, mention)
+		mention.Processed = path[1:] // Remove leading slash
+	} else if isGitCommitHash(mentionText) {
+		mention.Type = GitCommitMention
+		mention.Processed = fmt.Sprintf("Git commit '%s'", mentionText)
+	} else {
+		mention.Type = UnknownMention
+		mention.Processed = mentionText
 	}
 
-	return mentions
+	return mention
 }
 
 // isGitCommitHash checks if a string is a git commit hash
@@ -100,39 +98,72 @@ func isGitCommitHash(s string) bool {
 	return match
 }
 
-// ReplaceMentionsWithContent replaces mentions in a message with their content
-func ReplaceMentionsWithContent(text string, cwd string) (string, error) {
-	mentions := ParseMentions(text)
+// Options restricts the files mentions are expanded to and reports those included
+type Options struct {
+	// DeniedPaths are patterns of the files never included, in addition to those ignored by
+	// the .golineignore files, e.g. the denied paths of the outbound policy
+	DeniedPaths []string
+	// RecordFile is called with the path, relative to the working directory, and the size of
+	// the content of each file included, e.g. to record it in the outbound audit log
+	RecordFile func(path string, size int)
+}
 
-	// First, replace mentions in the text with their descriptions
-	parsedText := mentionRegex.ReplaceAllStringFunc(text, func(match string) string {
-		mentionText := match[1:] // Remove @ symbol
-
-		for _, mention := range mentions {
-			if mention.Original == mentionText {
-				switch mention.Type {
-				case FileMention:
-					return fmt.Sprintf("'%s' (see below for file content)", mention.Processed)
-				case FolderMention:
-					return fmt.Sprintf("'%s' (see below for folder content)", mention.Processed)
-				case ProblemsMention:
-					return "Workspace Problems (see below for diagnostics)"
-				case TerminalMention:
-					return "Terminal Output (see below for output)"
-				case GitChangesMention:
-					return "Working directory changes (see below for details)"
-				case GitCommitMention:
-					return fmt.Sprintf("%s (see below for commit info)", mention.Processed)
-				case URLMention:
-					return fmt.Sprintf("'%s' (see below for site content)", mention.Processed)
-				default:
-					return match
-				}
-			}
-		}
+// expander expands the mentions of a message in a working directory
+type expander struct {
+	cwd        string
+	controller *ignore.Controller
+	opts       Options
+}
+
+// newExpander creates an expander reading the files of cwd allowed by its .golineignore files
+// and the denied paths of opts
+func newExpander(cwd string, opts Options) *expander {
+	controller := ignore.NewController(cwd)
+	if err := controller.Initialize(); err != nil {
+		slog.Warn("Failed to load .golineignore", "error", err)
+	}
+	controller.Deny(opts.DeniedPaths...)
+	return &expander{cwd: cwd, controller: controller, opts: opts}
+}
+
+// blockedError returns the error of a file or folder that cannot be included
+func (e *expander) blockedError(path string) error {
+	rules := "the .golineignore file"
+	if len(e.opts.DeniedPaths) > 0 {
+		rules = "the .golineignore file or the outbound policy"
+	}
+	return fmt.Errorf("access to %s is blocked by %s", filepath.Base(path), rules)
+}
+
+// record reports a file whose content is included
+func (e *expander) record(path string, size int) {
+	if e.opts.RecordFile == nil {
+		return
+	}
+	if rel, err := filepath.Rel(e.cwd, path); err == nil {
+		path = rel
+	}
+	e.opts.RecordFile(filepath.ToSlash(path), size)
+}
 
-		return match
-	})
+// ReplaceMentionsWithContent replaces mentions in a message with their content. The files
+// ignored by the .golineignore files or denied by opts are not included.
+func ReplaceMentionsWithContent(text string, cwd string, opts Options) (string, error) {
+	e := newExpander(cwd, opts)
+	spans := scanMentions(text)
+	mentions := make([]Mention, len(spans))
+
+	// First, replace mentions in the text with their descriptions
+	var b strings.Builder
+	last := 0
+	for i, s := range spans {
+		mentions[i] = parseMention(s.text)
+		b.WriteString(unescapeMentions(text[last:s.start]))
+		b.WriteString(describeMention(mentions[i], text[s.start:s.end]))
+		last = s.end
+	}
+	b.WriteString(unescapeMentions(text[last:]))
+	parsedText := b.String()
 
 	// Then, append the content for each mention
 	for _, mention := range mentions {
@@ -141,14 +172,14 @@ func ReplaceMentionsWithContent(text string, cwd string) (string, error) {
 
 		switch mention.Type {
 		case FileMention:
-			content, err = getFileContent(filepath.Join(cwd, mention.Processed))
+			content, err = e.getFileContent(filepath.Join(cwd, mention.Processed))
 			if err != nil {
 				content = fmt.Sprintf("Error fetching content: %s", err.Error())
 			}
 			parsedText += fmt.Sprintf("\n\n<file_content path=\"%s\">\n%s\n</file_content>", mention.Processed, content)
 
 		case FolderMention:
-			content, err = getFolderContent(filepath.Join(cwd, mention.Processed), cwd)
+			content, err = e.getFolderContent(filepath.Join(cwd, mention.Processed))
 			if err != nil {
 				content = fmt.Sprintf("Error fetching content: %s", err.Error())
 			}
@@ -184,79 +215,40 @@ func ReplaceMentionsWithContent(text string, cwd string) (string, error) {
 	return parsedText, nil
 }
 
-// getFileContent reads the content of a file
-func getFileContent(path string) (string, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
+// describeMention returns the text replacing a mention in a message, which refers to its
+// content appended to the message. Unknown mentions are left as they were written.
+func describeMention(mention Mention, written string) string {
+	switch mention.Type {
+	case FileMention:
+		return fmt.Sprintf("'%s' (see below for file content)", mention.Processed)
+	case FolderMention:
+		return fmt.Sprintf("'%s' (see below for folder content)", mention.Processed)
+	case ProblemsMention:
+		return "Workspace Problems (see below for diagnostics)"
+	case TerminalMention:
+		return "Terminal Output (see below for output)"
+	case GitChangesMention:
+		return "Working directory changes (see below for details)"
+	case GitCommitMention:
+		return fmt.Sprintf("%s (see below for commit info)", mention.Processed)
+	case URLMention:
+		return fmt.Sprintf("'%s' (see below for site content)", mention.Processed)
+	default:
+		return written
 	}
-	return string(content), nil
 }
 
-// getFolderContent gets the content of a folder
-func getFolderContent(path string, cwd string) (string, error) {
-	entries, err := os.ReadDir(path)
+// getFileContent reads the content of a file, unless it is ignored or denied
+func (e *expander) getFileContent(path string) (string, error) {
+	if !e.controller.ValidateAccess(path) {
+		return "", e.blockedError(path)
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
-
-	var folderContent strings.Builder
-	var fileContentPromises []string
-
-	for i, entry := range entries {
-		isLast := i == len(entries)-1
-		linePrefix := "└── "
-		if !isLast {
-			linePrefix = "├── "
-		}
-
-		if entry.IsDir() {
-			folderContent.WriteString(fmt.Sprintf("%s%s/\n", linePrefix, entry.Name()))
-			// Not recursively getting folder contents
-		} else {
-			folderContent.WriteString(fmt.Sprintf("%s%s\n", linePrefix, entry.Name()))
-
-			// In a real implementation, we would read file contents here
-			// For now, we'll just add placeholders for non-binary files
-			filePath := filepath.Join(path, entry.Name())
-			relPath, _ := filepath.Rel(cwd, filePath)
-
-			// Check if file is binary (simplified check)
-			if !isBinaryFile(filePath) {
-				content, err := getFileContent(filePath)
-				if err == nil {
-					fileContentPromises = append(fileContentPromises,
-						fmt.Sprintf("<file_content path=\"%s\">\n%s\n</file_content>",
-							filepath.ToSlash(relPath), content))
-				}
-			}
-		}
-	}
-
-	if folderContent.Len() == 0 {
-		return "(Empty folder)", nil
-	}
-
-	result := folderContent.String()
-	if len(fileContentPromises) > 0 {
-		result += "\n" + strings.Join(fileContentPromises, "\n\n")
-	}
-
-	return strings.TrimSpace(result), nil
-}
-
-// isBinaryFile checks if a file is binary (simplified implementation)
-func isBinaryFile(path string) bool {
-	// This is a simplified check - in a real implementation, we would use a more robust method
-	ext := strings.ToLower(filepath.Ext(path))
-	binaryExtensions := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
-		".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
-		".ppt": true, ".pptx": true, ".zip": true, ".tar": true, ".gz": true,
-		".exe": true, ".dll": true, ".so": true, ".dylib": true, ".bin": true,
-	}
-
-	return binaryExtensions[ext]
+	e.record(path, len(content))
+	return string(content), nil
 }
 
 // OpenMention opens a mention (e.g., file, folder, URL)
@@ -0,0 +1,140 @@
+package mentions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMentionsPaths(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Mention
+	}{
+		{"see @/src/main.go", []Mention{{Type: FileMention, Original: "/src/main.go", Processed: "src/main.go"}}},
+		{"see @/src/", []Mention{{Type: FolderMention, Original: "/src/", Processed: "src/"}}},
+		{`see @\src\main.go`, []Mention{{Type: FileMention, Original: `\src\main.go`, Processed: "src/main.go"}}},
+		{`see @/src\pkg\`, []Mention{{Type: FolderMention, Original: `/src\pkg\`, Processed: "src/pkg/"}}},
+	}
+	for _, tt := range tests {
+		if got := ParseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMentions(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseMentionsSyntax(t *testing.T) {
+	file := func(original, processed string) Mention {
+		return Mention{Type: FileMention, Original: original, Processed: processed}
+	}
+	tests := []struct {
+		name string
+		text string
+		want []Mention
+	}{
+		{"start of the text", "@/a.go", []Mention{file("/a.go", "a.go")}},
+		{"comma", "read @/src/a.go, then fix it", []Mention{file("/src/a.go", "src/a.go")}},
+		{"end of a sentence", "Fix @/src/a.go.", []Mention{file("/src/a.go", "src/a.go")}},
+		{"several punctuation marks", "is it @/a.go?!", []Mention{file("/a.go", "a.go")}},
+		{"parentheses around", "(see @/a.go)", []Mention{file("/a.go", "a.go")}},
+		{"balanced parentheses", "see @/img(1).png", []Mention{file("/img(1).png", "img(1).png")}},
+		{"parentheses in the path", "(see @/img(1).png)", []Mention{file("/img(1).png", "img(1).png")}},
+		{"quotes around", `"@/a.go"`, []Mention{file("/a.go", "a.go")}},
+		{"folder before a period", "list @/src/.", []Mention{{Type: FolderMention, Original: "/src/", Processed: "src/"}}},
+		{"quoted path with spaces", `open @"/My Documents/file.txt" now`, []Mention{file("/My Documents/file.txt", "My Documents/file.txt")}},
+		{"quoted path with punctuation", `@"/notes/v1.0, final.txt".`, []Mention{file("/notes/v1.0, final.txt", "notes/v1.0, final.txt")}},
+		{"escaped quote", `@"/say \"hi\".txt"`, []Mention{file(`/say "hi".txt`, `say "hi".txt`)}},
+		{"escaped backslash", `@"\src\My Files\\"`, []Mention{{Type: FolderMention, Original: `\src\My Files\`, Processed: "src/My Files/"}}},
+		{"unterminated quote", `@"/a b.txt`, nil},
+		{"empty quotes", `@"" and @/a.go`, []Mention{file("/a.go", "a.go")}},
+		{"e-mail address", "mail me@example.com", nil},
+		{"escaped @", `literal \@/a.go`, nil},
+		{"lone @", "@ and @.", nil},
+		{"japanese text", "ファイル@/a.go を直して", []Mention{file("/a.go", "a.go")}},
+		{"several mentions", "@problems and @/a.go; @https://example.com/x.", []Mention{
+			{Type: ProblemsMention, Original: "problems", Processed: "Workspace Problems"},
+			file("/a.go", "a.go"),
+			{Type: URLMention, Original: "https://example.com/x", Processed: "https://example.com/x"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceMentionsWithContent(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(cwd, "My Documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, "My Documents", "file.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReplaceMentionsWithContent(`Summarize @"/My Documents/file.txt", mail me\@example.com or @someone.`, cwd, Options{})
+	if err != nil {
+		t.Fatalf("ReplaceMentionsWithContent() error = %v", err)
+	}
+	want := "Summarize 'My Documents/file.txt' (see below for file content), mail me@example.com or @someone." +
+		"\n\n<file_content path=\"My Documents/file.txt\">\nhello\n</file_content>"
+	if got != want {
+		t.Errorf("ReplaceMentionsWithContent() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceMentionsWithContentDeniedPaths(t *testing.T) {
+	cwd := t.TempDir()
+	for name, content := range map[string]string{"main.go": "package main\n", "keys/prod.pem": "KEY\n"} {
+		path := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var recorded []string
+	opts := Options{
+		DeniedPaths: []string{"keys/"},
+		RecordFile:  func(path string, size int) { recorded = append(recorded, fmt.Sprintf("%s:%d", path, size)) },
+	}
+	got, err := ReplaceMentionsWithContent("Compare @/main.go with @/keys/prod.pem and @/keys/", cwd, opts)
+	if err != nil {
+		t.Fatalf("ReplaceMentionsWithContent() error = %v", err)
+	}
+	if strings.Contains(got, "KEY") || !strings.Contains(got, "blocked by the .golineignore file or the outbound policy") {
+		t.Errorf("ReplaceMentionsWithContent() = %q, want the denied files left out", got)
+	}
+	if strings.Join(recorded, ",") != "main.go:13" {
+		t.Errorf("recorded files = %q", recorded)
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"src/main.go", "@/src/main.go"},
+		{"/src/", "@/src/"},
+		{"My Documents/file.txt", `@"/My Documents/file.txt"`},
+		{`say "hi".txt`, `@"/say \"hi\".txt"`},
+	}
+	for _, tt := range tests {
+		got := FormatPath(tt.path)
+		if got != tt.want {
+			t.Errorf("FormatPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		if mentions := ParseMentions(got); len(mentions) != 1 || "/"+mentions[0].Processed != "/"+strings.TrimPrefix(tt.path, "/") {
+			t.Errorf("ParseMentions(FormatPath(%q)) = %+v", tt.path, mentions)
+		}
+	}
+}
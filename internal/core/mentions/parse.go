@@ -0,0 +1,132 @@
+package mentions
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// trailingPunctuation are the characters stripped from the end of unquoted mentions, as they
+// usually end the sentence rather than the mention
+const trailingPunctuation = `.,;:!?'"`
+
+// closingBrackets maps the closing brackets stripped from the end of unquoted mentions when
+// they are not balanced to their opening brackets
+var closingBrackets = map[byte]byte{')': '(', ']': '[', '}': '{', '>': '<'}
+
+// span is a mention found in a text
+type span struct {
+	// start and end are the byte offsets of the mention in the text, from its @ to its last
+	// character including the closing quote
+	start, end int
+	// text is the text of the mention without @, unquoted and unescaped
+	text string
+}
+
+// scanMentions finds the mentions of a text. A mention is @ followed by its text, up to the next
+// whitespace, e.g. @/src/main.go, and:
+//
+//   - Text with spaces is quoted, e.g. @"/My Documents/notes.txt". In quotes, \" is a quote and
+//     \\ a backslash, other backslashes are kept as is, e.g. in @"\src\My Files\a.go".
+//   - The punctuation ending an unquoted mention, e.g. the comma of "@/src/a.go, then", is not
+//     part of it. Closing brackets are only part of it when they close one of its own.
+//   - @ is only a mention at the start of a word, so that e-mail addresses are not mentions.
+//   - \@ is a literal @ that does not start a mention.
+func scanMentions(text string) []span {
+	var spans []span
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' || (i > 0 && !startsWord(text[:i])) {
+			continue
+		}
+		if s, ok := scanMention(text, i); ok {
+			spans = append(spans, s)
+			i = s.end - 1
+		}
+	}
+	return spans
+}
+
+// startsWord reports whether the text following before starts a word: before ends with
+// whitespace or an opening bracket or quote, or with a character that is not ASCII, e.g. in
+// Japanese text written without spaces
+func startsWord(before string) bool {
+	r, _ := utf8.DecodeLastRuneInString(before)
+	if r >= utf8.RuneSelf || unicode.IsSpace(r) {
+		return true
+	}
+	return strings.ContainsRune(`([{<"'`+"`", r)
+}
+
+// scanMention reads the mention whose @ is at offset at of the text
+func scanMention(text string, at int) (span, bool) {
+	i := at + 1
+	if i < len(text) && text[i] == '"' {
+		return scanQuoted(text, at)
+	}
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	mention := trimTrailingPunctuation(text[at+1 : i])
+	if mention == "" {
+		return span{}, false
+	}
+	return span{start: at, end: at + 1 + len(mention), text: mention}, true
+}
+
+// scanQuoted reads a quoted mention, which is not a mention if it is empty or not closed
+func scanQuoted(text string, at int) (span, bool) {
+	var b strings.Builder
+	for i := at + 2; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\\' && i+1 < len(text) && (text[i+1] == '"' || text[i+1] == '\\'):
+			b.WriteByte(text[i+1])
+			i++
+		case c == '"':
+			if b.Len() == 0 {
+				return span{}, false
+			}
+			return span{start: at, end: i + 1, text: b.String()}, true
+		case c == '\n':
+			return span{}, false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return span{}, false
+}
+
+// trimTrailingPunctuation strips the punctuation ending an unquoted mention
+func trimTrailingPunctuation(mention string) string {
+	for mention != "" {
+		last := mention[len(mention)-1]
+		if opening, ok := closingBrackets[last]; ok {
+			if strings.Count(mention, string(opening)) >= strings.Count(mention, string(last)) {
+				return mention
+			}
+		} else if !strings.ContainsRune(trailingPunctuation, rune(last)) {
+			return mention
+		}
+		mention = mention[:len(mention)-1]
+	}
+	return mention
+}
+
+// unescapeMentions turns the escaped \@ of the text between mentions into @
+func unescapeMentions(text string) string {
+	return strings.ReplaceAll(text, `\@`, "@")
+}
+
+// FormatPath returns the mention of a file or folder of the workspace, given relative to it,
+// quoted if it has spaces or quotes
+func FormatPath(path string) string {
+	mention := "/" + strings.TrimPrefix(path, "/")
+	if !strings.ContainsFunc(mention, func(r rune) bool { return unicode.IsSpace(r) || r == '"' }) {
+		return "@" + mention
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(mention)
+	return `@"` + escaped + `"`
+}
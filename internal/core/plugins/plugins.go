@@ -0,0 +1,241 @@
+// Package plugins exposes external executables as tools of the agent.
+//
+// A plugin is an executable that describes itself when run with --describe, printing the
+// JSON schema of its tool:
+//
+//	{"name": "run_migration", "description": "...", "parameters": [{"name": "env", "description": "...", "required": true, "type": "string"}]}
+//
+// When the AI uses the tool, the plugin is run in the working directory without arguments and
+// receives the tool use as a JSON Request on stdin. What it prints to stdout is the result of
+// the tool; when it exits with a non-zero status, stderr is reported to the AI as the error.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+)
+
+const (
+	// DescribeFlag is the flag a plugin is run with to print its schema
+	DescribeFlag = "--describe"
+	// DefaultTimeout is the maximum duration of a plugin run
+	DefaultTimeout = time.Minute
+	// describeTimeout is the maximum duration of the describe handshake
+	describeTimeout = 5 * time.Second
+	// maxOutput limits the output of a plugin sent to the AI
+	maxOutput = 50000
+	// waitDelay bounds how long a killed plugin's children may keep its output open
+	waitDelay = time.Second
+)
+
+// Request is the tool use sent to a plugin on stdin
+type Request struct {
+	// Name is the name of the tool
+	Name string `json:"name"`
+	// Params are the parameters given by the AI
+	Params map[string]string `json:"params"`
+	// WorkingDirectory is the working directory of the task
+	WorkingDirectory string `json:"working_directory"`
+}
+
+// Plugin is an executable providing a tool
+type Plugin struct {
+	// Path is the path of the executable
+	Path string
+	// Schema is the tool the plugin declared
+	Schema assistantmessage.ToolSchema
+}
+
+// Describe runs an executable with --describe and returns the plugin it declares
+func Describe(ctx context.Context, path string) (*Plugin, error) {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, DescribeFlag)
+	cmd.WaitDelay = waitDelay
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %s failed to describe itself: %w%s", path, err, formatStderr(stderr.String()))
+	}
+
+	var schema assistantmessage.ToolSchema
+	decoder := json.NewDecoder(&stdout)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("plugin %s printed an invalid description: %w", path, err)
+	}
+	if schema.Description == "" {
+		return nil, fmt.Errorf("plugin %s has no description", path)
+	}
+	return &Plugin{Path: path, Schema: schema}, nil
+}
+
+// Run runs the plugin for a tool use and returns its output
+func (p *Plugin) Run(ctx context.Context, workingDir string, params map[assistantmessage.ToolParamName]string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request := Request{Name: string(p.Schema.Name), Params: make(map[string]string, len(params)), WorkingDirectory: workingDir}
+	for name, value := range params {
+		request.Params[string(name)] = value
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path)
+	cmd.WaitDelay = waitDelay
+	cmd.Dir = workingDir
+	cmd.Env = append(os.Environ(), "GOLINE_TOOL="+request.Name, "GOLINE_WORKING_DIR="+workingDir)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("plugin %s timed out after %s", p.Schema.Name, timeout)
+		}
+		return "", fmt.Errorf("plugin %s failed: %w%s", p.Schema.Name, err, formatStderr(stderr.String()))
+	}
+
+	output := stdout.String()
+	if len(output) > maxOutput {
+		output = output[:maxOutput] + "\n[output truncated]"
+	}
+	return output, nil
+}
+
+// formatStderr formats the error output of a plugin to append to an error
+func formatStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > maxOutput {
+		stderr = stderr[len(stderr)-maxOutput:]
+	}
+	return "\n" + stderr
+}
+
+// Set is the set of plugins available to a task
+type Set struct {
+	plugins []*Plugin
+	timeout time.Duration
+}
+
+// Load describes the executables of the directories, skipping directories that do not exist.
+// When several plugins declare the same tool, the first one found wins.
+// Plugins that fail to describe themselves are skipped and reported in the returned errors.
+func Load(ctx context.Context, dirs []string, timeout time.Duration) (*Set, []error) {
+	set := &Set{timeout: timeout}
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read plugin directory %s: %w", dir, err))
+			continue
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			plugin, err := Describe(ctx, path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if existing, ok := set.Lookup(plugin.Schema.Name); ok {
+				errs = append(errs, fmt.Errorf("plugin %s declares tool %s, which is already provided by %s", path, plugin.Schema.Name, existing.Path))
+				continue
+			}
+			set.plugins = append(set.plugins, plugin)
+		}
+	}
+	return set, errs
+}
+
+// Register adds the tools of the plugins to the tool registry, so the AI can use them.
+// Plugins whose tool conflicts with another tool are removed from the set and reported.
+func (s *Set) Register() []error {
+	var errs []error
+	registered := s.plugins[:0]
+	for _, plugin := range s.plugins {
+		if err := assistantmessage.RegisterToolSchema(plugin.Schema); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", plugin.Path, err))
+			continue
+		}
+		registered = append(registered, plugin)
+	}
+	s.plugins = registered
+	return errs
+}
+
+// Plugins returns the plugins of the set
+func (s *Set) Plugins() []*Plugin {
+	if s == nil {
+		return nil
+	}
+	return s.plugins
+}
+
+// Lookup returns the plugin providing a tool
+func (s *Set) Lookup(name assistantmessage.ToolUseName) (*Plugin, bool) {
+	for _, plugin := range s.Plugins() {
+		if plugin.Schema.Name == name {
+			return plugin, true
+		}
+	}
+	return nil, false
+}
+
+// Run runs the plugin providing the tool of a tool use
+func (s *Set) Run(ctx context.Context, workingDir string, toolUse assistantmessage.ToolUse) (string, error) {
+	plugin, ok := s.Lookup(toolUse.Name)
+	if !ok {
+		return "", fmt.Errorf("no plugin provides tool %s", toolUse.Name)
+	}
+	return plugin.Run(ctx, workingDir, toolUse.Params, s.timeout)
+}
+
+// isExecutable reports whether path is a regular file that can be executed.
+// Hidden files are skipped, so plugins can keep data next to them.
+func isExecutable(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".bat", ".cmd", ".com":
+			return true
+		}
+		return false
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
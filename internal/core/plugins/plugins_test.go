@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+)
+
+// writePlugin writes a shell script plugin describing itself with describe and running run
+func writePlugin(t *testing.T, dir, name, describe, run string) string {
+	t.Helper()
+	script := "#!/bin/sh\nif [ \"$1\" = \"--describe\" ]; then\ncat <<'JSON'\n" + describe + "\nJSON\nexit 0\nfi\n" + run + "\n"
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	skipOnWindows(t)
+	repoDir, userDir := t.TempDir(), t.TempDir()
+	writePlugin(t, repoDir, "migrate", `{"name": "run_migration", "description": "Run the migrations.", "parameters": [{"name": "env", "description": "Environment", "required": true}]}`, "cat")
+	writePlugin(t, userDir, "migrate", `{"name": "run_migration", "description": "Shadowed.", "parameters": []}`, "cat")
+	writePlugin(t, userDir, "broken", `not json`, "cat")
+	if err := os.WriteFile(filepath.Join(userDir, "README.md"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	set, errs := Load(context.Background(), []string{repoDir, userDir, filepath.Join(t.TempDir(), "missing")}, 0)
+	if len(set.Plugins()) != 1 {
+		t.Fatalf("Load() = %d plugins, want 1", len(set.Plugins()))
+	}
+	plugin, ok := set.Lookup("run_migration")
+	if !ok || plugin.Path != filepath.Join(repoDir, "migrate") || plugin.Schema.Parameters[0].Name != "env" {
+		t.Errorf("Lookup() = %+v, %v, want the plugin of the first directory", plugin, ok)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Load() errors = %v, want the shadowed and the broken plugins", errs)
+	}
+}
+
+func TestRun(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	describe := `{"name": "echo_request", "description": "Echo the request.", "parameters": [{"name": "env", "description": "Environment", "required": true}]}`
+
+	tests := []struct {
+		name       string
+		run        string
+		timeout    time.Duration
+		want       []string
+		wantErr    string
+		wantErrOut string
+	}{
+		{
+			name: "receives the request on stdin",
+			run:  `cat; echo; echo "tool=$GOLINE_TOOL"; pwd`,
+			want: []string{`"name":"echo_request"`, `"params":{"env":"staging"}`, "tool=echo_request", dir},
+		},
+		{
+			name:       "reports stderr on failure",
+			run:        `echo "no such environment" >&2; exit 3`,
+			wantErr:    "exit status 3",
+			wantErrOut: "no such environment",
+		},
+		{
+			name:    "times out",
+			run:     `sleep 5`,
+			timeout: 100 * time.Millisecond,
+			wantErr: "timed out",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePlugin(t, t.TempDir(), "plugin", describe, tt.run)
+			plugin, err := Describe(context.Background(), path)
+			if err != nil {
+				t.Fatalf("Describe() error = %v", err)
+			}
+
+			output, err := plugin.Run(context.Background(), dir, map[assistantmessage.ToolParamName]string{"env": "staging"}, tt.timeout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.wantErrOut) {
+					t.Errorf("Run() error = %v, want %q and %q", err, tt.wantErr, tt.wantErrOut)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(output, s) {
+					t.Errorf("output does not contain %q:\n%s", s, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package prompts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languageNames are the names of the common language codes accepted as response languages
+var languageNames = map[string]string{
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"zh": "Chinese",
+}
+
+// LanguageName returns the name of a language code, e.g. Japanese for ja.
+// Other values, such as language names or regional variants, are returned as they are.
+func LanguageName(language string) string {
+	language = strings.TrimSpace(language)
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// renderLanguage tells the AI which language to write its explanations in.
+// Code stays in English so a bilingual team shares one code base.
+func renderLanguage(opts SystemPromptOptions) string {
+	if strings.TrimSpace(opts.ResponseLanguage) == "" {
+		return ""
+	}
+	return fmt.Sprintf(`LANGUAGE
+
+Write your explanations, questions, plans and completion results in %s, whatever the language of the user's messages. Write code, code comments, identifiers, commit messages and the tool use XML in English unless the user asks otherwise.`, LanguageName(opts.ResponseLanguage))
+}
@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/kazz187/goline/internal/core/checkpoint"
 )
 
 // FormatResponse contains functions for formatting responses
@@ -94,50 +97,25 @@ func (f *FormatResponse) FormatFilesList(absolutePath string, files []string, di
 	}
 }
 
-// CreatePrettyPatch creates a pretty patch for a diff
+// CreatePrettyPatch returns the hunks of the unified diff between two versions of a file,
+// without the file headers, or an empty string when they are equal
 func (f *FormatResponse) CreatePrettyPatch(filename string, oldStr, newStr string) string {
-	// This is a simplified version - in a real implementation, we would use a diff library
 	if filename == "" {
 		filename = "file"
 	}
-	if oldStr == "" {
-		oldStr = ""
-	}
-	if newStr == "" {
-		newStr = ""
+	if oldStr == newStr {
+		return ""
 	}
 
-	// Simple line-by-line diff
-	oldLines := strings.Split(oldStr, "\n")
-	newLines := strings.Split(newStr, "\n")
-
-	var result strings.Builder
-	result.WriteString(fmt.Sprintf("--- %s\n", filename))
-	result.WriteString(fmt.Sprintf("+++ %s\n", filename))
-
-	// Very simple diff algorithm - just show removed lines with - and added lines with +
-	for _, line := range oldLines {
-		if !containsLine(newLines, line) {
-			result.WriteString(fmt.Sprintf("-%s\n", line))
-		}
+	patch, err := checkpoint.FormatPatch([]checkpoint.FileDiff{{RelativePath: filename, Before: oldStr, After: newStr, BeforeMode: filemode.Regular, AfterMode: filemode.Regular}})
+	if err != nil {
+		return ""
 	}
-	for _, line := range newLines {
-		if !containsLine(oldLines, line) {
-			result.WriteString(fmt.Sprintf("+%s\n", line))
-		}
-	}
-
-	return result.String()
-}
-
-// containsLine checks if a slice of strings contains a specific line
-func containsLine(lines []string, line string) bool {
-	for _, l := range lines {
-		if l == line {
-			return true
-		}
+	// The hunks start at the first hunk header, after the git and file headers
+	if i := strings.Index(patch, "\n@@"); i >= 0 {
+		return patch[i+1:]
 	}
-	return false
+	return patch
 }
 
 // toolUseInstructionsReminder is a reminder for tool use instructions
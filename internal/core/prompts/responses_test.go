@@ -0,0 +1,44 @@
+package prompts
+
+import "testing"
+
+func TestCreatePrettyPatch(t *testing.T) {
+	f := NewFormatResponse()
+	tests := []struct {
+		name           string
+		oldStr, newStr string
+		want           string
+	}{
+		{
+			name:   "equal",
+			oldStr: "a\n",
+			newStr: "a\n",
+			want:   "",
+		},
+		{
+			name:   "repeated line moved",
+			oldStr: "a\nb\na\nc\n",
+			newStr: "a\nc\nb\na\n",
+			want:   "@@ -1,4 +1,4 @@\n a\n+c\n b\n a\n-c\n",
+		},
+		{
+			name:   "hunks keep three lines of context",
+			oldStr: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			newStr: "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want:   "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@ 6\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name:   "new file",
+			oldStr: "",
+			newStr: "x\n",
+			want:   "@@ -0,0 +1 @@\n+x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.CreatePrettyPatch("main.go", tt.oldStr, tt.newStr); got != tt.want {
+				t.Errorf("CreatePrettyPatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RulesFileName is the name of the file, or directory of files, holding the rules of a workspace
+const RulesFileName = ".golinerules"
+
+// LoadUserRules loads the custom instructions of the user: the global rules in ~/.goline/rules,
+// followed by the rules of the workspace in .golinerules.
+// Each may be a single file or a directory whose files are read in name order.
+func LoadUserRules(cwd string) (string, error) {
+	var paths []string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(homeDir, ".goline", "rules"))
+	}
+	paths = append(paths, filepath.Join(cwd, RulesFileName))
+
+	var sections []string
+	for _, path := range paths {
+		rules, err := readRules(path)
+		if err != nil {
+			return "", err
+		}
+		sections = append(sections, rules...)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// readRules reads a rules file, or the files of a rules directory in name order.
+// A missing path has no rules.
+func readRules(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules %s: %w", path, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules %s: %w", path, err)
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+		sort.Strings(files)
+	}
+
+	var rules []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules %s: %w", file, err)
+		}
+		if text := strings.TrimSpace(string(content)); text != "" {
+			rules = append(rules, fmt.Sprintf("# %s\n\n%s", filepath.Base(file), text))
+		}
+	}
+	return rules, nil
+}
@@ -2,30 +2,257 @@ package prompts
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/shell"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// Mode is the mode a task runs in
+type Mode string
+
+const (
+	// ModeAct lets the AI change files and run commands to accomplish the task
+	ModeAct Mode = "act"
+	// ModePlan lets the AI explore the workspace and discuss a plan without changing anything
+	ModePlan Mode = "plan"
+)
+
+// MCPServer describes a connected MCP server for the system prompt
+type MCPServer struct {
+	// Name of the server
+	Name string
+	// Tools provided by the server, as "name: description"
+	Tools []string
+	// Resources provided by the server, as URIs
+	Resources []string
+}
+
+// SystemPromptOptions are the settings of a task that shape its system prompt
+type SystemPromptOptions struct {
+	// Cwd is the working directory of the task
+	Cwd string
+	// Mode is the mode of the task, ModeAct if empty
+	Mode Mode
+	// SupportsBrowser reports whether the model can use the browser
+	SupportsBrowser bool
+	// AutoApprove lists the actions run without asking the user
+	AutoApprove config.AutoApprove
+	// MCPServers are the connected MCP servers
+	MCPServers []MCPServer
+	// UserRules are the custom instructions of the user, see LoadUserRules
+	UserRules string
+	// Headless reports whether the task runs without a user to answer questions
+	Headless bool
+	// CanDelegate reports whether the AI can delegate parts of the task to child tasks with new_task
+	CanDelegate bool
+	// Tools restricts the tools of the task to these, e.g. for a child task, all tools if empty
+	Tools []assistantmessage.ToolUseName
+	// ResponseLanguage is the language the AI writes its explanations in, e.g. ja, the language of the user if empty
+	ResponseLanguage string
+	// SemanticSearch reports whether the workspace is indexed for semantic_search
+	SemanticSearch bool
+	// ContextRoots are the read-only directories the AI can read in addition to Cwd
+	ContextRoots []config.ContextRoot
+	// Capabilities are the features of the model
+	Capabilities provider.Capabilities
+}
+
+// Section renders a part of the system prompt.
+// It returns an empty string to leave the section out.
+type Section struct {
+	// Name identifies the section, so variants can replace or remove it
+	Name string
+	// Render renders the section
+	Render func(opts SystemPromptOptions) string
+}
+
+// Names of the default sections
+const (
+	IntroSection      = "intro"
+	ToolUseSection    = "tool_use"
+	MCPSection        = "mcp"
+	ApprovalSection   = "approval"
+	SystemInfoSection = "system_info"
+	ContextSection    = "context_roots"
+	UserRulesSection  = "user_rules"
+	LanguageSection   = "language"
 )
 
-// GetSystemPrompt returns the system prompt for the AI
+// SystemPromptBuilder composes the system prompt from sections
+type SystemPromptBuilder struct {
+	sections []Section
+}
+
+// variants customize the default sections for a provider
+var variants = map[string]func(b *SystemPromptBuilder){
+	"deepseek": func(b *SystemPromptBuilder) {
+		b.Add(Section{Name: "tool_use_reminder", Render: renderToolUseReminder})
+	},
+	// The open models served by OpenAI-compatible servers drift from the tool format the same way
+	"openai-compatible": func(b *SystemPromptBuilder) {
+		b.Add(Section{Name: "tool_use_reminder", Render: renderToolUseReminder})
+	},
+}
+
+// RegisterVariant registers a customization of the system prompt for a provider
+func RegisterVariant(providerName string, customize func(b *SystemPromptBuilder)) {
+	variants[providerName] = customize
+}
+
+// NewSystemPromptBuilder creates a builder with the default sections,
+// customized by the variant registered for the provider, if any
+func NewSystemPromptBuilder(providerName string) *SystemPromptBuilder {
+	b := &SystemPromptBuilder{
+		sections: []Section{
+			{Name: IntroSection, Render: renderIntro},
+			{Name: ToolUseSection, Render: renderToolUse},
+			{Name: MCPSection, Render: renderMCP},
+			{Name: ApprovalSection, Render: renderApproval},
+			{Name: SystemInfoSection, Render: renderSystemInfo},
+			{Name: ContextSection, Render: renderContextRoots},
+			{Name: UserRulesSection, Render: renderUserRules},
+			{Name: LanguageSection, Render: renderLanguage},
+		},
+	}
+	if customize, ok := variants[providerName]; ok {
+		customize(b)
+	}
+	return b
+}
+
+// Add appends a section
+func (b *SystemPromptBuilder) Add(section Section) {
+	b.sections = append(b.sections, section)
+}
+
+// Replace replaces the section with the same name, or appends it if there is none
+func (b *SystemPromptBuilder) Replace(section Section) {
+	for i, s := range b.sections {
+		if s.Name == section.Name {
+			b.sections[i] = section
+			return
+		}
+	}
+	b.Add(section)
+}
+
+// Remove removes the section with the given name
+func (b *SystemPromptBuilder) Remove(name string) {
+	for i, s := range b.sections {
+		if s.Name == name {
+			b.sections = append(b.sections[:i], b.sections[i+1:]...)
+			return
+		}
+	}
+}
+
+// Build renders the system prompt, separating the sections with ====
+func (b *SystemPromptBuilder) Build(opts SystemPromptOptions) string {
+	if opts.Mode == "" {
+		opts.Mode = ModeAct
+	}
+	var parts []string
+	for _, section := range b.sections {
+		if text := strings.TrimSpace(section.Render(opts)); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n====\n\n") + "\n"
+}
+
+// GetSystemPrompt returns the system prompt for the AI in act mode, including the user rules
 func GetSystemPrompt(cwd string, supportsComputerUse bool) string {
-	shell := getShell()
-	osName := getOSName()
-	homeDir := os.Getenv("HOME")
-	if homeDir == "" && runtime.GOOS == "windows" {
-		homeDir = os.Getenv("USERPROFILE")
+	rules, err := LoadUserRules(cwd)
+	if err != nil {
+		slog.Warn("Failed to load user rules", "error", err)
 	}
+	return NewSystemPromptBuilder("").Build(SystemPromptOptions{
+		Cwd:             cwd,
+		Mode:            ModeAct,
+		SupportsBrowser: supportsComputerUse,
+		UserRules:       rules,
+	})
+}
 
-	// Convert paths to use forward slashes for consistency
-	cwd = filepath.ToSlash(cwd)
-	homeDir = filepath.ToSlash(homeDir)
+// EnabledTools returns the tools available to a task, in the order they are documented
+func EnabledTools(opts SystemPromptOptions) []assistantmessage.ToolUseName {
+	var tools []assistantmessage.ToolUseName
+	for _, schema := range assistantmessage.ToolSchemas() {
+		if toolEnabled(schema.Name, opts) {
+			tools = append(tools, schema.Name)
+		}
+	}
+	return tools
+}
 
-	// Build the system prompt
-	return fmt.Sprintf(`You are Goline, a highly skilled software engineer with extensive knowledge in many programming languages, frameworks, design patterns, and best practices.
+// toolEnabled reports whether a tool is available to a task
+func toolEnabled(name assistantmessage.ToolUseName, opts SystemPromptOptions) bool {
+	if len(opts.Tools) > 0 && !slices.Contains(opts.Tools, name) {
+		return false
+	}
+	plan := opts.Mode == ModePlan
+	switch name {
+	case assistantmessage.ExecuteCommandToolName,
+		assistantmessage.WriteToFileToolName,
+		assistantmessage.ReplaceInFileToolName,
+		assistantmessage.AttemptCompletionToolName:
+		return !plan
+	case assistantmessage.PlanModeResponseToolName:
+		return plan
+	case assistantmessage.NewTaskToolName:
+		return !plan && opts.CanDelegate
+	case assistantmessage.AskFollowupQuestionToolName:
+		return !opts.Headless
+	case assistantmessage.SemanticSearchToolName:
+		return opts.SemanticSearch
+	case assistantmessage.BrowserActionToolName:
+		return opts.SupportsBrowser
+	case assistantmessage.UseMcpToolToolName:
+		for _, server := range opts.MCPServers {
+			if len(server.Tools) > 0 {
+				return true
+			}
+		}
+		return false
+	case assistantmessage.AccessMcpResourceToolName:
+		for _, server := range opts.MCPServers {
+			if len(server.Resources) > 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		// Plugin tools may change the workspace
+		return !plan || assistantmessage.IsBuiltinTool(name)
+	}
+}
 
-====
+// renderIntro renders the introduction of the AI
+func renderIntro(opts SystemPromptOptions) string {
+	intro := "You are Goline, a highly skilled software engineer with extensive knowledge in many programming languages, frameworks, design patterns, and best practices."
+	if opts.Mode == ModePlan {
+		intro += "\n\nYou are in plan mode. Explore the workspace, ask questions and discuss a plan with the user using plan_mode_response. Do not change files or run commands until the user switches to act mode."
+	}
+	if opts.Headless {
+		intro += "\n\nYou are running non-interactively. Nobody can answer questions, so make reasonable assumptions, and finish with attempt_completion once the task is done."
+	}
+	if opts.Capabilities.Vision {
+		intro += "\n\nThe user may attach images to their messages, e.g. screenshots of a UI or of an error, marked in the text with placeholders like [image: screenshot.png 800x600]. Look at them when they relate to the task."
+	}
+	return intro
+}
 
-TOOL USE
+// renderToolUse renders the rules of tool use and the documentation of the enabled tools
+func renderToolUse(opts SystemPromptOptions) string {
+	return `TOOL USE
 
 You have access to a set of tools that are executed upon the user's approval. You can use one tool per message, and will receive the result of that tool use in the user's response. You use tools step-by-step to accomplish a given task, with each tool use informed by the result of the previous tool use.
 
@@ -33,76 +260,128 @@ You have access to a set of tools that are executed upon the user's approval. Yo
 
 Tool use is formatted using XML-style tags. The tool name is enclosed in opening and closing tags, and each parameter is similarly enclosed within its own set of tags.
 
+If the value of a parameter contains the closing tag of the parameter, e.g. a file mentioning </content>, wrap the value in a CDATA section: <content><![CDATA[...]]></content>. The text of a CDATA section is used as is, including its whitespace.
+
 # Tools
 
-## execute_command
-Description: Request to execute a CLI command on the system.
-Parameters:
-- command: (required) The CLI command to execute.
-- requires_approval: (required) A boolean indicating whether this command requires explicit user approval.
-
-## read_file
-Description: Request to read the contents of a file at the specified path.
-Parameters:
-- path: (required) The path of the file to read (relative to the current working directory %s)
-
-## write_to_file
-Description: Request to write content to a file at the specified path.
-Parameters:
-- path: (required) The path of the file to write to
-- content: (required) The content to write to the file.
-
-## replace_in_file
-Description: Request to replace sections of content in an existing file.
-Parameters:
-- path: (required) The path of the file to modify
-- diff: (required) One or more SEARCH/REPLACE blocks
-
-## search_files
-Description: Request to perform a regex search across files.
-Parameters:
-- path: (required) The path of the directory to search in
-- regex: (required) The regular expression pattern to search for
-- file_pattern: (optional) Glob pattern to filter files
-
-## list_files
-Description: Request to list files and directories.
-Parameters:
-- path: (required) The path of the directory to list contents for
-- recursive: (optional) Whether to list files recursively
-
-## ask_followup_question
-Description: Ask the user a question to gather additional information.
-Parameters:
-- question: (required) The question to ask the user.
-
-## attempt_completion
-Description: Present the result of your work to the user.
-Parameters:
-- result: (required) The result of the task.
-- command: (optional) A CLI command to showcase the result.
-
-====
-
-SYSTEM INFORMATION
+` + formatTools(EnabledTools(opts))
+}
+
+// formatTools formats the documentation of the given tools from the tool registry
+func formatTools(names []assistantmessage.ToolUseName) string {
+	var b strings.Builder
+	for _, name := range names {
+		schema, ok := assistantmessage.LookupToolSchema(name)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s\nDescription: %s\nParameters:\n", schema.Name, schema.Description)
+		for _, param := range schema.Parameters {
+			requirement := "optional"
+			if param.Required {
+				requirement = "required"
+			}
+			fmt.Fprintf(&b, "- %s: (%s) %s\n", param.Name, requirement, param.Description)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderMCP renders the connected MCP servers and what they provide
+func renderMCP(opts SystemPromptOptions) string {
+	if len(opts.MCPServers) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("MCP SERVERS\n\nThe following MCP servers are connected. Use use_mcp_tool and access_mcp_resource to use what they provide.\n")
+	for _, server := range opts.MCPServers {
+		fmt.Fprintf(&b, "\n## %s\n", server.Name)
+		if len(server.Tools) > 0 {
+			b.WriteString("\n### Available Tools\n")
+			for _, tool := range server.Tools {
+				fmt.Fprintf(&b, "- %s\n", tool)
+			}
+		}
+		if len(server.Resources) > 0 {
+			b.WriteString("\n### Available Resources\n")
+			for _, resource := range server.Resources {
+				fmt.Fprintf(&b, "- %s\n", resource)
+			}
+		}
+	}
+	return b.String()
+}
+
+// renderApproval tells the AI which actions run without asking the user
+func renderApproval(opts SystemPromptOptions) string {
+	var approved []string
+	if opts.AutoApprove.ReadFiles {
+		approved = append(approved, "reading and listing files")
+	}
+	if opts.AutoApprove.EditFiles && opts.Mode != ModePlan {
+		approved = append(approved, "creating and editing files")
+	}
+	if opts.AutoApprove.ExecuteCommands && opts.Mode != ModePlan {
+		approved = append(approved, "running commands that do not require approval")
+	}
+	if len(approved) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`APPROVAL
+
+The following actions run without asking the user: %s. The user may not review them before they take effect, so be careful, and set requires_approval to true for commands with side effects such as installing packages, deleting files or pushing changes.`, strings.Join(approved, ", "))
+}
+
+// renderSystemInfo renders the environment the AI works in
+func renderSystemInfo(opts SystemPromptOptions) string {
+	homeDir := os.Getenv("HOME")
+	if homeDir == "" && runtime.GOOS == "windows" {
+		homeDir = os.Getenv("USERPROFILE")
+	}
+
+	// Convert paths to use forward slashes for consistency
+	return fmt.Sprintf(`SYSTEM INFORMATION
 
 Operating System: %s
 Default Shell: %s
 Home Directory: %s
-Current Working Directory: %s
-`, cwd, osName, shell, homeDir, cwd)
+Current Working Directory: %s`, getOSName(), getShell(), filepath.ToSlash(homeDir), filepath.ToSlash(opts.Cwd))
 }
 
-// getShell returns the default shell
-func getShell() string {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		if runtime.GOOS == "windows" {
-			return "cmd.exe"
-		}
-		return "/bin/sh"
+// renderContextRoots lists the read-only context directories and how their paths are written
+func renderContextRoots(opts SystemPromptOptions) string {
+	if len(opts.ContextRoots) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("READ-ONLY CONTEXT DIRECTORIES\n\nBesides the current working directory, you can read, list and search the files of the following directories, but not modify them:\n\n")
+	for _, root := range opts.ContextRoots {
+		fmt.Fprintf(&b, "- %s: %s\n", root.Name, filepath.ToSlash(root.Path))
+	}
+	example := opts.ContextRoots[0].Name + ":README.md"
+	fmt.Fprintf(&b, "\nRefer to their files with the name of the directory, a colon and the path within it, e.g. %s. Tool results label their files the same way, paths without a name are in the current working directory. Only the files of the current working directory can be created or edited, do not modify the context directories with commands either.", example)
+	return b.String()
+}
+
+// renderUserRules renders the custom instructions of the user
+func renderUserRules(opts SystemPromptOptions) string {
+	if strings.TrimSpace(opts.UserRules) == "" {
+		return ""
 	}
-	return shell
+	return "USER'S CUSTOM INSTRUCTIONS\n\nThe following additional instructions are provided by the user, and should be followed to the best of your ability without interfering with the TOOL USE guidelines.\n\n" + opts.UserRules
+}
+
+// renderToolUseReminder repeats the tool use rules at the end of the prompt,
+// for models that tend to lose track of them in long prompts
+func renderToolUseReminder(opts SystemPromptOptions) string {
+	return "REMINDER\n\nUse exactly one tool per message, and always close every XML tag you open, including the tag of the tool itself."
+}
+
+// getShell returns the shell the commands are run with
+func getShell() string {
+	return shell.Default().Name
 }
 
 // getOSName returns the operating system name
@@ -0,0 +1,172 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+func TestEnabledTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SystemPromptOptions
+		enabled []assistantmessage.ToolUseName
+		absent  []assistantmessage.ToolUseName
+	}{
+		{
+			name:    "act mode",
+			opts:    SystemPromptOptions{Mode: ModeAct},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.WriteToFileToolName, assistantmessage.ExecuteCommandToolName, assistantmessage.AttemptCompletionToolName},
+			absent:  []assistantmessage.ToolUseName{assistantmessage.PlanModeResponseToolName, assistantmessage.BrowserActionToolName, assistantmessage.UseMcpToolToolName, assistantmessage.NewTaskToolName},
+		},
+		{
+			name:    "plan mode",
+			opts:    SystemPromptOptions{Mode: ModePlan},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.ReadFileToolName, assistantmessage.PlanModeResponseToolName},
+			absent:  []assistantmessage.ToolUseName{assistantmessage.WriteToFileToolName, assistantmessage.ReplaceInFileToolName, assistantmessage.ExecuteCommandToolName},
+		},
+		{
+			name:    "browser and MCP tools",
+			opts:    SystemPromptOptions{SupportsBrowser: true, MCPServers: []MCPServer{{Name: "github", Tools: []string{"create_issue: Create an issue"}}}},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.BrowserActionToolName, assistantmessage.UseMcpToolToolName},
+			absent:  []assistantmessage.ToolUseName{assistantmessage.AccessMcpResourceToolName},
+		},
+		{
+			name:    "headless",
+			opts:    SystemPromptOptions{Mode: ModeAct, Headless: true},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.AttemptCompletionToolName},
+			absent:  []assistantmessage.ToolUseName{assistantmessage.AskFollowupQuestionToolName},
+		},
+		{
+			name:    "delegation",
+			opts:    SystemPromptOptions{Mode: ModeAct, CanDelegate: true},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.NewTaskToolName},
+		},
+		{
+			name:    "restricted tools",
+			opts:    SystemPromptOptions{Mode: ModeAct, Tools: []assistantmessage.ToolUseName{assistantmessage.ReadFileToolName, assistantmessage.AttemptCompletionToolName}},
+			enabled: []assistantmessage.ToolUseName{assistantmessage.ReadFileToolName, assistantmessage.AttemptCompletionToolName},
+			absent:  []assistantmessage.ToolUseName{assistantmessage.WriteToFileToolName, assistantmessage.ExecuteCommandToolName, assistantmessage.NewTaskToolName},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools := EnabledTools(tt.opts)
+			for _, name := range tt.enabled {
+				if !slices.Contains(tools, name) {
+					t.Errorf("EnabledTools() does not contain %s", name)
+				}
+			}
+			for _, name := range tt.absent {
+				if slices.Contains(tools, name) {
+					t.Errorf("EnabledTools() contains %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemPromptBuilder(t *testing.T) {
+	opts := SystemPromptOptions{
+		Cwd:         "/work",
+		AutoApprove: config.AutoApprove{ReadFiles: true},
+		MCPServers:  []MCPServer{{Name: "docs", Resources: []string{"docs://index"}}},
+		UserRules:   "Always write tests.",
+	}
+
+	prompt := NewSystemPromptBuilder("").Build(opts)
+	for _, want := range []string{"## access_mcp_resource", "## docs", "docs://index", "reading and listing files", "Always write tests.", "Current Working Directory: /work"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+	if strings.Contains(prompt, "REMINDER") {
+		t.Error("default prompt contains the deepseek reminder")
+	}
+
+	if prompt := NewSystemPromptBuilder("deepseek").Build(opts); !strings.Contains(prompt, "REMINDER") {
+		t.Error("deepseek prompt does not contain the reminder")
+	}
+
+	b := NewSystemPromptBuilder("")
+	b.Remove(SystemInfoSection)
+	b.Replace(Section{Name: IntroSection, Render: func(SystemPromptOptions) string { return "Custom intro" }})
+	prompt = b.Build(SystemPromptOptions{})
+	if !strings.HasPrefix(prompt, "Custom intro\n\n====") {
+		t.Errorf("prompt does not start with the replaced intro: %q", prompt[:min(len(prompt), 40)])
+	}
+	if strings.Contains(prompt, "SYSTEM INFORMATION") || strings.Contains(prompt, "USER'S CUSTOM INSTRUCTIONS") || strings.Contains(prompt, "APPROVAL") {
+		t.Error("prompt contains removed or empty sections")
+	}
+}
+
+func TestResponseLanguage(t *testing.T) {
+	if prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{}); strings.Contains(prompt, "LANGUAGE") {
+		t.Error("prompt without a response language contains the language section")
+	}
+	for language, want := range map[string]string{"ja": "in Japanese,", "EN": "in English,", "pt-BR": "in pt-BR,"} {
+		prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{ResponseLanguage: language})
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt for %s does not contain %q", language, want)
+		}
+	}
+}
+
+func TestVisionCapability(t *testing.T) {
+	if prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{}); strings.Contains(prompt, "attach images") {
+		t.Error("prompt of a model without vision mentions attached images")
+	}
+	prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{Capabilities: provider.Capabilities{Vision: true}})
+	if !strings.Contains(prompt, "The user may attach images") {
+		t.Error("prompt of a model with vision does not mention attached images")
+	}
+}
+
+func TestContextRoots(t *testing.T) {
+	if prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{}); strings.Contains(prompt, "CONTEXT DIRECTORIES") {
+		t.Error("prompt without context directories contains the context section")
+	}
+	prompt := NewSystemPromptBuilder("").Build(SystemPromptOptions{
+		ContextRoots: []config.ContextRoot{{Name: "shared", Path: "/src/shared"}},
+	})
+	for _, want := range []string{"- shared: /src/shared", "e.g. shared:README.md"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+}
+
+func TestLoadUserRules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+
+	rules, err := LoadUserRules(cwd)
+	if err != nil || rules != "" {
+		t.Fatalf("LoadUserRules() without rules = %q, %v", rules, err)
+	}
+
+	dir := filepath.Join(cwd, RulesFileName)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"b.md": "Second rule", "a.md": "First rule", ".hidden": "Ignored"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err = LoadUserRules(cwd)
+	if err != nil {
+		t.Fatalf("LoadUserRules() error = %v", err)
+	}
+	if want := "# a.md\n\nFirst rule\n\n# b.md\n\nSecond rule"; rules != want {
+		t.Errorf("LoadUserRules() = %q, want %q", rules, want)
+	}
+}
@@ -0,0 +1,43 @@
+package prompts
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GetWatchSystemPrompt returns the system prompt used by watch mode.
+// Watch mode is read-only: the AI only reports on the workspace and never uses tools.
+func GetWatchSystemPrompt(cwd string) string {
+	return fmt.Sprintf(`You are Goline running in watch mode, a read-only assistant that runs every time files change in the workspace at %s.
+
+You cannot use tools, run commands or modify files. You receive the user's standing instruction, the files that changed, and the output of the watch command if one is configured.
+
+Respond concisely:
+- Lead with a one-line status (for example "All tests pass" or "2 tests fail").
+- Summarize only what matters for the changes, such as failures, their likely cause, and the file and line to look at.
+- Do not repeat the command output verbatim and do not greet the user.`, filepath.ToSlash(cwd))
+}
+
+// FormatWatchRequest formats the message sent to the AI when watched files change
+func FormatWatchRequest(instruction string, changedFiles []string, command, commandOutput string, commandErr error) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<instruction>\n%s\n</instruction>\n\n", instruction)
+
+	b.WriteString("<changed_files>\n")
+	for _, file := range changedFiles {
+		b.WriteString(file + "\n")
+	}
+	b.WriteString("</changed_files>\n")
+
+	if command != "" {
+		status := "succeeded"
+		if commandErr != nil {
+			status = fmt.Sprintf("failed: %v", commandErr)
+		}
+		fmt.Fprintf(&b, "\n<command_output command=%q status=%q>\n%s\n</command_output>\n", command, status, commandOutput)
+	}
+
+	return b.String()
+}
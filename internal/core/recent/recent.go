@@ -0,0 +1,216 @@
+// Package recent tracks the files read and edited during a task, so the files a task is about
+// can be pointed out to the AI without the user mentioning them.
+package recent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kazz187/goline/internal/gitexec"
+)
+
+// DefaultLimit is the number of files listed when no limit is given
+const DefaultLimit = 10
+
+// Weights of the uses of a file, decayed as other files are used
+const (
+	editWeight = 2.0
+	readWeight = 1.0
+	gitWeight  = 0.5
+	// decay is the factor applied to the weight of a file for each later use of another file
+	decay = 0.9
+)
+
+// File is a file used during a task
+type File struct {
+	// Path is the path of the file, relative to the working directory
+	Path string
+	// Reads is the number of times the file was read
+	Reads int
+	// Edits is the number of times the file was edited
+	Edits int
+	// Git reports whether the file has uncommitted changes or was changed by a recent commit
+	Git bool
+	// last is the tick of the last use of the file
+	last int
+}
+
+// weight returns the relevance of the file at a tick
+func (f *File) weight(now int) float64 {
+	w := float64(f.Edits)*editWeight + float64(f.Reads)*readWeight
+	if f.Git {
+		w += gitWeight
+	}
+	return w * math.Pow(decay, float64(now-f.last))
+}
+
+// Tracker tracks the files used during a task. It is safe for concurrent use.
+type Tracker struct {
+	mu    sync.Mutex
+	limit int
+	files map[string]*File
+	// tick counts the uses of files, to decay the weight of the files not used since
+	tick int
+}
+
+// NewTracker creates a tracker listing up to limit files, DefaultLimit if zero
+func NewTracker(limit int) *Tracker {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Tracker{limit: limit, files: make(map[string]*File)}
+}
+
+// Read records that a file was read
+func (t *Tracker) Read(path string) {
+	t.use(path, func(f *File) { f.Reads++ })
+}
+
+// Edited records that a file was created or edited
+func (t *Tracker) Edited(path string) {
+	t.use(path, func(f *File) { f.Edits++ })
+}
+
+// AddGitChanges records the files changed per git, e.g. as returned by GitChanges.
+// They count less than the files used by the task.
+func (t *Tracker) AddGitChanges(paths []string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, path := range paths {
+		t.file(path).Git = true
+	}
+}
+
+// use records a use of a file
+func (t *Tracker) use(path string, update func(f *File)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tick++
+	f := t.file(path)
+	update(f)
+	f.last = t.tick
+}
+
+// file returns the tracked file of a path, adding it if needed
+func (t *Tracker) file(path string) *File {
+	f, ok := t.files[path]
+	if !ok {
+		f = &File{Path: path, last: t.tick}
+		t.files[path] = f
+	}
+	return f
+}
+
+// Files returns the most relevant files, most relevant first
+func (t *Tracker) Files() []File {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	files := make([]File, 0, len(t.files))
+	for _, f := range t.files {
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		wi, wj := files[i].weight(t.tick), files[j].weight(t.tick)
+		if wi != wj {
+			return wi > wj
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > t.limit {
+		files = files[:t.limit]
+	}
+	return files
+}
+
+// Weights returns the relevance of every tracked file, to rank the files of the repository
+// map. The most relevant file weighs 1.
+func (t *Tracker) Weights() map[string]float64 {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	weights := make(map[string]float64, len(t.files))
+	var top float64
+	for path, f := range t.files {
+		weights[path] = f.weight(t.tick)
+		top = max(top, weights[path])
+	}
+	if top > 0 {
+		for path := range weights {
+			weights[path] /= top
+		}
+	}
+	return weights
+}
+
+// FormatSection formats files as the "Recently Relevant Files" section of the environment
+// details, empty if there are no files
+func FormatSection(files []File) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("# Recently Relevant Files\n")
+	b.WriteString("(Files read or edited during this task and files changed per git, most relevant first)\n")
+	for _, f := range files {
+		var uses []string
+		if f.Edits > 0 {
+			uses = append(uses, "edited")
+		}
+		if f.Reads > 0 {
+			uses = append(uses, "read")
+		}
+		if f.Git {
+			uses = append(uses, "changed in git")
+		}
+		fmt.Fprintf(&b, "%s (%s)\n", f.Path, strings.Join(uses, ", "))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// GitChanges returns the files with uncommitted changes and the files changed by the last
+// commits, relative to the working directory
+func GitChanges(ctx context.Context, workingDir string, commits int) ([]string, error) {
+	queries := [][]string{
+		{"diff", "--name-only", "--relative", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard"},
+	}
+	if commits > 0 {
+		queries = append(queries, []string{"log", fmt.Sprintf("-%d", commits), "--name-only", "--relative", "--format="})
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, args := range queries {
+		output, err := gitexec.Run(ctx, workingDir, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(output, "\n") {
+			if path = strings.TrimSpace(path); path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,102 @@
+package recent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func paths(files []File) []string {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+func TestTrackerRanksFiles(t *testing.T) {
+	tracker := NewTracker(3)
+	tracker.AddGitChanges([]string{"changed.go"})
+	tracker.Read("old.go")
+	tracker.Edited("main.go")
+	tracker.Read("main.go")
+	tracker.Read("new.go")
+	tracker.Read("other.go")
+
+	// Edits count more than reads, and files used long ago fade behind the latest ones
+	if got, want := paths(tracker.Files()), []string{"main.go", "other.go", "new.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+	weights := tracker.Weights()
+	if weights["main.go"] != 1 || weights["changed.go"] <= 0 || weights["changed.go"] >= weights["old.go"] {
+		t.Errorf("Weights() = %v", weights)
+	}
+
+	section := FormatSection(tracker.Files()[:1])
+	if !strings.HasPrefix(section, "# Recently Relevant Files\n") || !strings.HasSuffix(section, "\nmain.go (edited, read)") {
+		t.Errorf("FormatSection() = %q", section)
+	}
+	if FormatSection(nil) != "" {
+		t.Error("FormatSection() without files is not empty")
+	}
+
+	// A nil tracker tracks nothing
+	var none *Tracker
+	none.Read("main.go")
+	if none.Files() != nil {
+		t.Error("nil tracker has files")
+	}
+}
+
+func TestGitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	write("committed.go", "package a")
+	write("old.go", "package a")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	write("committed.go", "package b")
+	git("commit", "-q", "-am", "second")
+	write("modified.go", "package a")
+	git("add", "modified.go")
+	git("commit", "-q", "-m", "third")
+	write("modified.go", "package b")
+	write("untracked.go", "package a")
+
+	changes, err := GitChanges(context.Background(), dir, 0)
+	if err != nil {
+		t.Fatalf("GitChanges() error = %v", err)
+	}
+	if want := []string{"modified.go", "untracked.go"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("GitChanges() = %v, want %v", changes, want)
+	}
+
+	changes, err = GitChanges(context.Background(), dir, 2)
+	if err != nil {
+		t.Fatalf("GitChanges() error = %v", err)
+	}
+	if want := []string{"modified.go", "untracked.go", "committed.go"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("GitChanges() with commits = %v, want %v", changes, want)
+	}
+}
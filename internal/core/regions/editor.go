@@ -0,0 +1,37 @@
+package regions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EditorCommand returns the command that opens path at line in the user's editor.
+// The editor is taken from $VISUAL or $EDITOR and defaults to vi.
+func EditorCommand(path string, line int) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	parts := strings.Fields(editor)
+	name := parts[0]
+	args := append([]string{}, parts[1:]...)
+
+	switch strings.TrimSuffix(filepath.Base(name), ".exe") {
+	case "code", "code-insiders", "codium", "cursor":
+		args = append(args, "-g", fmt.Sprintf("%s:%d", path, line))
+	case "subl", "zed", "hx":
+		args = append(args, fmt.Sprintf("%s:%d", path, line))
+	default:
+		// vi, vim, nvim, emacs, nano, micro and most terminal editors accept +line
+		args = append(args, fmt.Sprintf("+%d", line), path)
+	}
+
+	return exec.Command(name, args...)
+}
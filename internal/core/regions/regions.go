@@ -0,0 +1,260 @@
+package regions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	utilsdiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// regionsFileName is the name of the file in the task directory that stores the edited regions
+const regionsFileName = "edited_regions.json"
+
+// Region is a range of lines last modified by the agent
+type Region struct {
+	// Path to the file, relative to the working directory
+	Path string `json:"path"`
+	// First edited line (1-based)
+	StartLine int `json:"start_line"`
+	// Last edited line (inclusive)
+	EndLine int `json:"end_line"`
+	// Time of the last agent edit to the region
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// Tracker tracks which line ranges of which files were last modified by the agent during a task.
+// Regions follow later edits: lines shift when text is inserted above them, and lines the
+// agent replaces are tracked as the new edit.
+type Tracker struct {
+	mu      sync.Mutex
+	path    string
+	regions map[string][]Region
+}
+
+// NewTracker creates a tracker for a task and loads the regions recorded so far
+func NewTracker(taskID string) (*Tracker, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	t := &Tracker{
+		path:    filepath.Join(homeDir, ".goline", "tasks", taskID, regionsFileName),
+		regions: make(map[string][]Region),
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// load loads the recorded regions
+func (t *Tracker) load() error {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read edited regions: %w", err)
+	}
+
+	var regions []Region
+	if err := json.Unmarshal(data, &regions); err != nil {
+		return fmt.Errorf("failed to parse edited regions: %w", err)
+	}
+	for _, region := range regions {
+		t.regions[region.Path] = append(t.regions[region.Path], region)
+	}
+
+	return nil
+}
+
+// save writes the recorded regions
+func (t *Tracker) save() error {
+	data, err := json.MarshalIndent(t.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode edited regions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create task directory: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write edited regions: %w", err)
+	}
+
+	return nil
+}
+
+// RecordEdit records an agent edit of a file from before to after
+func (t *Tracker) RecordEdit(path, before, after string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	path = filepath.ToSlash(path)
+	now := time.Now()
+
+	edited := mapRegions(t.regions[path], before, after, now)
+	ranges := compress(edited)
+	if len(ranges) == 0 {
+		delete(t.regions, path)
+	} else {
+		regions := make([]Region, 0, len(ranges))
+		for _, r := range ranges {
+			regions = append(regions, Region{
+				Path:      path,
+				StartLine: r.start,
+				EndLine:   r.end,
+				EditedAt:  r.editedAt,
+			})
+		}
+		t.regions[path] = regions
+	}
+
+	return t.save()
+}
+
+// RecordDelete records that the agent deleted a file
+func (t *Tracker) RecordDelete(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.regions, filepath.ToSlash(path))
+	return t.save()
+}
+
+// RecordRename records that the agent renamed a file
+func (t *Tracker) RecordRename(oldPath, newPath string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	oldPath = filepath.ToSlash(oldPath)
+	newPath = filepath.ToSlash(newPath)
+	regions := t.regions[oldPath]
+	delete(t.regions, oldPath)
+	if len(regions) > 0 {
+		for i := range regions {
+			regions[i].Path = newPath
+		}
+		t.regions[newPath] = regions
+	}
+
+	return t.save()
+}
+
+// Regions returns all edited regions sorted by path and line
+func (t *Tracker) Regions() []Region {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.list()
+}
+
+// list returns all edited regions sorted by path and line
+func (t *Tracker) list() []Region {
+	regions := []Region{}
+	for _, fileRegions := range t.regions {
+		regions = append(regions, fileRegions...)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].Path != regions[j].Path {
+			return regions[i].Path < regions[j].Path
+		}
+		return regions[i].StartLine < regions[j].StartLine
+	})
+	return regions
+}
+
+// mapRegions returns, for every line of after, when it was last edited by the agent, the zero
+// time for lines it did not edit. The lines edited now are marked with now, and the lines of
+// previously edited regions are carried over to their new position with their edit time.
+func mapRegions(regions []Region, before, after string, now time.Time) []time.Time {
+	previous := make(map[int]time.Time)
+	for _, region := range regions {
+		for line := region.StartLine; line <= region.EndLine; line++ {
+			previous[line] = region.EditedAt
+		}
+	}
+
+	edited := make([]time.Time, countLines(after)+1)
+	mark := func(line int, at time.Time) {
+		if line >= 1 && line < len(edited) && at.After(edited[line]) {
+			edited[line] = at
+		}
+	}
+
+	oldLine, newLine := 1, 1
+	for _, d := range utilsdiff.Do(before, after) {
+		n := countLines(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for i := 0; i < n; i++ {
+				if at, ok := previous[oldLine+i]; ok {
+					mark(newLine+i, at)
+				}
+			}
+			oldLine += n
+			newLine += n
+		case diffmatchpatch.DiffDelete:
+			// Mark where the lines were removed, unless replacement lines follow
+			mark(newLine, now)
+			if newLine >= len(edited) {
+				mark(newLine-1, now)
+			}
+			oldLine += n
+		case diffmatchpatch.DiffInsert:
+			for i := 0; i < n; i++ {
+				mark(newLine+i, now)
+			}
+			newLine += n
+		}
+	}
+
+	return edited
+}
+
+// lineRange is a range of edited lines, last edited at the latest edit time of its lines
+type lineRange struct {
+	start, end int
+	editedAt   time.Time
+}
+
+// compress converts per-line edit times into ranges of consecutive edited lines
+func compress(edited []time.Time) []lineRange {
+	var ranges []lineRange
+	for line := 1; line < len(edited); line++ {
+		if edited[line].IsZero() {
+			continue
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].end == line-1 {
+			ranges[last].end = line
+			if edited[line].After(ranges[last].editedAt) {
+				ranges[last].editedAt = edited[line]
+			}
+		} else {
+			ranges = append(ranges, lineRange{start: line, end: line, editedAt: edited[line]})
+		}
+	}
+	return ranges
+}
+
+// countLines returns the number of lines in text, counting a final line without a newline
+func countLines(text string) int {
+	if text == "" {
+		return 0
+	}
+	n := strings.Count(text, "\n")
+	if !strings.HasSuffix(text, "\n") {
+		n++
+	}
+	return n
+}
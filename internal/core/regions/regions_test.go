@@ -0,0 +1,80 @@
+package regions
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func ranges(regions []Region) [][2]int {
+	var result [][2]int
+	for _, region := range regions {
+		result = append(result, [2]int{region.StartLine, region.EndLine})
+	}
+	return result
+}
+
+func TestTrackerRecordEdit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tracker, err := NewTracker("task-test")
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	// Replace line 3
+	before := "a\nb\nc\nd\ne\n"
+	after := "a\nb\nC\nd\ne\n"
+	if err := tracker.RecordEdit("main.go", before, after); err != nil {
+		t.Fatalf("Failed to record edit: %v", err)
+	}
+	if got, want := ranges(tracker.Regions()), [][2]int{{3, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected regions %v, got %v", want, got)
+	}
+	firstEdit := tracker.Regions()[0].EditedAt
+
+	// Insert two lines at the top, the earlier region shifts down
+	before = after
+	after = "x\ny\na\nb\nC\nd\ne\n"
+	if err := tracker.RecordEdit("main.go", before, after); err != nil {
+		t.Fatalf("Failed to record edit: %v", err)
+	}
+	if got, want := ranges(tracker.Regions()), [][2]int{{1, 2}, {5, 5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected regions %v, got %v", want, got)
+	}
+	// The region the edit did not touch keeps its edit time
+	if regions := tracker.Regions(); !regions[1].EditedAt.Equal(firstEdit) || regions[0].EditedAt.Before(firstEdit) {
+		t.Errorf("Expected only the inserted lines to be edited now, got %+v", regions)
+	}
+
+	// Edit the line between, the regions merge
+	before = after
+	after = "x\ny\na\nb2\nC\nd\ne\n"
+	if err := tracker.RecordEdit("main.go", before, after); err != nil {
+		t.Fatalf("Failed to record edit: %v", err)
+	}
+	if got, want := ranges(tracker.Regions()), [][2]int{{1, 2}, {4, 5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected regions %v, got %v", want, got)
+	}
+
+	// Regions are persisted and follow renames
+	if err := tracker.RecordRename("main.go", filepath.Join("cmd", "main.go")); err != nil {
+		t.Fatalf("Failed to record rename: %v", err)
+	}
+	reloaded, err := NewTracker("task-test")
+	if err != nil {
+		t.Fatalf("Failed to reload tracker: %v", err)
+	}
+	regions := reloaded.Regions()
+	if len(regions) != 2 || regions[0].Path != "cmd/main.go" {
+		t.Fatalf("Expected regions of cmd/main.go after reload, got %+v", regions)
+	}
+
+	// Deleted files are forgotten
+	if err := reloaded.RecordDelete("cmd/main.go"); err != nil {
+		t.Fatalf("Failed to record delete: %v", err)
+	}
+	if regions := reloaded.Regions(); len(regions) != 0 {
+		t.Errorf("Expected no regions after delete, got %+v", regions)
+	}
+}
@@ -0,0 +1,63 @@
+package regions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SidecarPath is the path of the review sidecar file, relative to the working directory.
+// Annotations are written there so that source files are never touched.
+const SidecarPath = ".goline/agent-edits.json"
+
+// sidecar is the format of the review sidecar file
+type sidecar struct {
+	Version     int          `json:"version"`
+	TaskID      string       `json:"task_id"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Annotations []annotation `json:"annotations"`
+}
+
+// annotation is a comment marker attached to a line range
+type annotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Comment   string `json:"comment"`
+}
+
+// WriteSidecar writes the edited regions as comment markers to the review sidecar file
+// and returns its path
+func WriteSidecar(workingDir, taskID string, regions []Region) (string, error) {
+	s := sidecar{
+		Version:     1,
+		TaskID:      taskID,
+		GeneratedAt: time.Now(),
+		Annotations: []annotation{},
+	}
+	for _, region := range regions {
+		s.Annotations = append(s.Annotations, annotation{
+			Path:      region.Path,
+			StartLine: region.StartLine,
+			EndLine:   region.EndLine,
+			Comment:   fmt.Sprintf("Edited by goline (task %s) at %s", taskID, region.EditedAt.Format(time.RFC3339)),
+		})
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+
+	path := filepath.Join(workingDir, filepath.FromSlash(SidecarPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create sidecar directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write sidecar: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,67 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/kazz187/goline/internal/gitexec"
+)
+
+// maxDiffSize limits the diff sent to the AI
+const maxDiffSize = 200000
+
+// Source selects the changes to review
+type Source struct {
+	// Staged reviews the staged changes instead of the working tree
+	Staged bool
+	// Ref reviews the changes of a branch or pull request ref since it diverged from HEAD.
+	// Refs of the form pull/<n>/head are fetched from origin first.
+	Ref string
+}
+
+// String describes the source
+func (s Source) String() string {
+	switch {
+	case s.Ref != "":
+		return s.Ref
+	case s.Staged:
+		return "staged changes"
+	default:
+		return "working tree"
+	}
+}
+
+// GetDiff returns the git diff of the source in the working directory
+func GetDiff(workingDir string, source Source) (string, error) {
+	if source.Ref != "" && source.Staged {
+		return "", errors.New("a ref and staged changes cannot be reviewed at the same time")
+	}
+
+	var args []string
+	switch {
+	case source.Ref != "":
+		ref := source.Ref
+		if strings.HasPrefix(ref, "pull/") {
+			if _, err := gitexec.Run(context.Background(), workingDir, "fetch", "--quiet", "origin", ref); err != nil {
+				return "", err
+			}
+			ref = "FETCH_HEAD"
+		}
+		args = []string{"diff", "HEAD..." + ref}
+	case source.Staged:
+		args = []string{"diff", "--cached"}
+	default:
+		args = []string{"diff", "HEAD"}
+	}
+
+	diff, err := gitexec.Run(context.Background(), workingDir, args...)
+	if err != nil {
+		return "", err
+	}
+	if len(diff) > maxDiffSize {
+		diff = diff[:maxDiffSize] + "\n[diff truncated]\n"
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,231 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/mentions"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Severity is the severity of a review finding
+type Severity string
+
+const (
+	// SeverityError is a problem that must be fixed
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that should be fixed
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is an optional improvement
+	SeverityInfo Severity = "info"
+)
+
+// rank orders severities from the most to the least severe
+func (s Severity) rank() int {
+	switch s {
+	case SeverityError:
+		return 0
+	case SeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// AtLeast reports whether s is at least as severe as other
+func (s Severity) AtLeast(other Severity) bool {
+	return s.rank() <= other.rank()
+}
+
+// ParseSeverity parses a severity name
+func ParseSeverity(name string) (Severity, error) {
+	switch Severity(strings.ToLower(name)) {
+	case SeverityError:
+		return SeverityError, nil
+	case SeverityWarning:
+		return SeverityWarning, nil
+	case SeverityInfo:
+		return SeverityInfo, nil
+	default:
+		return "", fmt.Errorf("unknown severity: %s", name)
+	}
+}
+
+// Finding is a single review comment
+type Finding struct {
+	File       string   `json:"file"`
+	Line       int      `json:"line"`
+	Severity   Severity `json:"severity"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+// Result is the result of a review
+type Result struct {
+	Source   string    `json:"source"`
+	Summary  string    `json:"summary"`
+	Findings []Finding `json:"findings"`
+}
+
+// Reviewer asks the AI to critique a diff without editing files
+type Reviewer struct {
+	provider   provider.Provider
+	workingDir string
+	// mentions restricts the files the mentions of the instructions are expanded to
+	mentions mentions.Options
+}
+
+// NewReviewer creates a new reviewer
+func NewReviewer(p provider.Provider, workingDir string) *Reviewer {
+	return &Reviewer{
+		provider:   p,
+		workingDir: workingDir,
+	}
+}
+
+// SetMentionOptions sets the files the mentions of the instructions may include, e.g. to leave
+// out the paths denied by the outbound policy and record those sent in an audit log
+func (r *Reviewer) SetMentionOptions(opts mentions.Options) {
+	r.mentions = opts
+}
+
+// Review reviews the changes of the source.
+// Instructions may contain mentions, which are expanded like in a regular task.
+func (r *Reviewer) Review(ctx context.Context, source Source, instructions string) (_ *Result, err error) {
+	ctx, span := tracing.Start(ctx, "review.run", attribute.String("goline.review.source", source.String()))
+	defer func() { tracing.End(span, err) }()
+
+	diff, err := GetDiff(r.workingDir, source)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return &Result{Source: source.String(), Summary: "No changes to review.", Findings: []Finding{}}, nil
+	}
+
+	if instructions != "" {
+		instructions, err = mentions.ReplaceMentionsWithContent(instructions, r.workingDir, r.mentions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process mentions: %w", err)
+		}
+	}
+
+	events, err := r.provider.CreateMessage(ctx, prompts.GetReviewSystemPrompt(r.workingDir), []provider.Message{
+		{Role: "user", Content: prompts.FormatReviewRequest(instructions, source.String(), diff)},
+	}, provider.GenerationOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send review request: %w", err)
+	}
+
+	var response strings.Builder
+	for event := range events {
+		switch event.Type {
+		case "text":
+			response.WriteString(event.Text)
+		case "error":
+			return nil, fmt.Errorf("review failed: %s", event.Text)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := ParseResult(response.String())
+	if err != nil {
+		return nil, err
+	}
+	result.Source = source.String()
+	return result, nil
+}
+
+// ParseResult parses the JSON response of the AI.
+// Text around the JSON object, such as a markdown code fence, is ignored.
+func ParseResult(response string) (*Result, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("review response does not contain a JSON object")
+	}
+
+	var result Result
+	if err := json.Unmarshal([]byte(response[start:end+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse review response: %w", err)
+	}
+
+	// Normalize findings
+	if result.Findings == nil {
+		result.Findings = []Finding{}
+	}
+	for i := range result.Findings {
+		severity, err := ParseSeverity(string(result.Findings[i].Severity))
+		if err != nil {
+			severity = SeverityInfo
+		}
+		result.Findings[i].Severity = severity
+		if result.Findings[i].Line < 0 {
+			result.Findings[i].Line = 0
+		}
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		a, b := result.Findings[i], result.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity.rank() < b.Severity.rank()
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	return &result, nil
+}
+
+// Count returns the number of findings at least as severe as severity
+func (r *Result) Count(severity Severity) int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity.AtLeast(severity) {
+			count++
+		}
+	}
+	return count
+}
+
+// Format formats the result as plain text, one line per finding followed by its suggestion
+func Format(result *Result) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Review of %s\n", result.Source)
+	if result.Summary != "" {
+		fmt.Fprintf(&b, "%s\n", result.Summary)
+	}
+	if len(result.Findings) == 0 {
+		b.WriteString("\nNo findings.\n")
+		return b.String()
+	}
+
+	b.WriteString("\n")
+	for _, finding := range result.Findings {
+		location := finding.File
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", strings.ToUpper(string(finding.Severity)), location, finding.Message)
+		if finding.Suggestion != "" {
+			fmt.Fprintf(&b, "    Suggestion: %s\n", finding.Suggestion)
+		}
+	}
+	fmt.Fprintf(&b, "\n%d error(s), %d warning(s), %d info\n",
+		result.Count(SeverityError),
+		result.Count(SeverityWarning)-result.Count(SeverityError),
+		len(result.Findings)-result.Count(SeverityWarning))
+
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package review
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseResult(t *testing.T) {
+	response := "Here is my review:\n```json\n" + `{
+  "summary": "Mostly fine",
+  "findings": [
+    {"file": "b.go", "line": 3, "severity": "info", "message": "Rename"},
+    {"file": "a.go", "line": 10, "severity": "ERROR", "message": "Nil dereference", "suggestion": "Check err first"},
+    {"file": "a.go", "line": -1, "severity": "critical", "message": "Unknown severity"}
+  ]
+}` + "\n```"
+
+	result, err := ParseResult(response)
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if result.Summary != "Mostly fine" {
+		t.Errorf("Unexpected summary: %q", result.Summary)
+	}
+	if len(result.Findings) != 3 {
+		t.Fatalf("Expected 3 findings, got %d", len(result.Findings))
+	}
+
+	// Errors come first, unknown severities become info
+	first := result.Findings[0]
+	if first.Severity != SeverityError || first.File != "a.go" || first.Line != 10 {
+		t.Errorf("Unexpected first finding: %+v", first)
+	}
+	if result.Findings[1].Severity != SeverityInfo || result.Findings[1].Line != 0 {
+		t.Errorf("Unexpected second finding: %+v", result.Findings[1])
+	}
+	if result.Count(SeverityWarning) != 1 || result.Count(SeverityInfo) != 3 {
+		t.Errorf("Unexpected counts: %d warning or worse, %d total", result.Count(SeverityWarning), result.Count(SeverityInfo))
+	}
+
+	formatted := Format(result)
+	if !strings.Contains(formatted, "[ERROR] a.go:10: Nil dereference") || !strings.Contains(formatted, "Suggestion: Check err first") {
+		t.Errorf("Unexpected formatted result:\n%s", formatted)
+	}
+}
+
+func TestParseResultWithoutJSON(t *testing.T) {
+	if _, err := ParseResult("Looks good to me"); err == nil {
+		t.Error("Expected an error for a response without JSON")
+	}
+}
@@ -0,0 +1,42 @@
+// Package shell runs command lines with the shell of the platform: sh on Unix, and on Windows
+// PowerShell or cmd.exe.
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// waitDelay bounds how long the children of a cancelled command, which outlive the shell, may
+// keep its output open, so that cancelling a command cannot hang its caller
+const waitDelay = 2 * time.Second
+
+// Shell is an interpreter of command lines
+type Shell struct {
+	// Name is the shell shown to the AI, so it writes commands in its syntax
+	Name string
+	// path is the executable of the shell, and args its arguments before the command line
+	path string
+	args []string
+}
+
+// Command returns the command running a command line with the shell. The command is killed
+// when ctx is cancelled, and Wait returns at most waitDelay later.
+func (s Shell) Command(ctx context.Context, commandLine string) *exec.Cmd {
+	cmd := s.command(ctx, commandLine)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// Default returns the shell the commands of the AI are run with: sh on Unix, and on Windows
+// PowerShell if it is installed, cmd.exe otherwise
+func Default() Shell {
+	return defaultShell()
+}
+
+// System returns the shell the commands written by the user are run with, e.g. hooks: sh on
+// Unix and cmd.exe on Windows
+func System() Shell {
+	return systemShell()
+}
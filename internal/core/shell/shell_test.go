@@ -0,0 +1,27 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	for name, s := range map[string]Shell{"default": Default(), "system": System()} {
+		t.Run(name, func(t *testing.T) {
+			out, err := s.Command(context.Background(), "echo hello").CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command() error = %v: %s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != "hello" {
+				t.Errorf("Command() output = %q, want hello", got)
+			}
+		})
+	}
+}
+
+func TestCommandExitStatus(t *testing.T) {
+	if err := System().Command(context.Background(), "exit 3").Run(); err == nil {
+		t.Error("Command() of a failing command line succeeded")
+	}
+}
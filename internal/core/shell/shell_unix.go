@@ -0,0 +1,23 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"os/exec"
+)
+
+// sh runs command lines on Unix
+var sh = Shell{Name: "/bin/sh", path: "sh", args: []string{"-c"}}
+
+func defaultShell() Shell {
+	return sh
+}
+
+func systemShell() Shell {
+	return sh
+}
+
+func (s Shell) command(ctx context.Context, commandLine string) *exec.Cmd {
+	return exec.CommandContext(ctx, s.path, append(s.args, commandLine)...)
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShellUnix(t *testing.T) {
+	if got := Default().Name; got != "/bin/sh" {
+		t.Errorf("Default().Name = %q, want /bin/sh", got)
+	}
+	out, err := Default().Command(context.Background(), `a="x y"; echo "$a" | tr ' ' '-'`).Output()
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	if got := string(out); got != "x-y\n" {
+		t.Errorf("Command() output = %q, want x-y", got)
+	}
+}
+
+func TestCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// sleep outlives the killed shell and keeps the output open
+	start := time.Now()
+	if _, err := Default().Command(ctx, "sleep 30; echo done").CombinedOutput(); err == nil {
+		t.Error("Command() of a cancelled command succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the cancelled command returned after %v", elapsed)
+	}
+}
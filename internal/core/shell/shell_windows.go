@@ -0,0 +1,45 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// cmdShell returns cmd.exe, that of the ComSpec environment variable if set
+func cmdShell() Shell {
+	path := os.Getenv("ComSpec")
+	if path == "" {
+		path = "cmd.exe"
+	}
+	return Shell{Name: "cmd.exe", path: path}
+}
+
+func defaultShell() Shell {
+	// PowerShell 7 is preferred over Windows PowerShell
+	for _, name := range []string{"pwsh.exe", "powershell.exe"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return Shell{Name: "PowerShell", path: path, args: []string{"-NoLogo", "-NoProfile", "-NonInteractive", "-Command"}}
+		}
+	}
+	return cmdShell()
+}
+
+func systemShell() Shell {
+	return cmdShell()
+}
+
+func (s Shell) command(ctx context.Context, commandLine string) *exec.Cmd {
+	if s.Name != "cmd.exe" {
+		return exec.CommandContext(ctx, s.path, append(s.args, commandLine)...)
+	}
+	// cmd.exe parses its command line itself, rather than as the arguments escaped by exec, so
+	// the command line is passed as is, quoted as /S expects
+	cmd := exec.CommandContext(ctx, s.path)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`%s /S /C "%s"`, syscall.EscapeArg(s.path), commandLine),
+	}
+	return cmd
+}
@@ -0,0 +1,25 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShellWindows(t *testing.T) {
+	if got := System().Name; got != "cmd.exe" {
+		t.Errorf("System().Name = %q, want cmd.exe", got)
+	}
+	if got := Default().Name; got != "PowerShell" && got != "cmd.exe" {
+		t.Errorf("Default().Name = %q, want PowerShell or cmd.exe", got)
+	}
+
+	// The quotes of the command line reach cmd.exe as written
+	out, err := System().Command(context.Background(), `echo "a b" && echo c`).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command() error = %v: %s", err, out)
+	}
+	if got := strings.ReplaceAll(string(out), "\r\n", "\n"); got != "\"a b\" \nc\n" {
+		t.Errorf("Command() output = %q", got)
+	}
+}
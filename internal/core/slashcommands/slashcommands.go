@@ -0,0 +1,264 @@
+// Package slashcommands defines the slash commands of the REPL, such as /test or /review:
+// prompt templates sent to the AI with the arguments of the command filled in, so teams can
+// share reusable workflows.
+//
+// Commands are read from the Markdown files of .goline/commands in the repository and of
+// ~/.goline/commands, one file per command named after it, from the slash_commands of the
+// configuration, and from the built-in commands, in this order of precedence. A file can start
+// with a YAML front matter setting the description of the command:
+//
+//	---
+//	description: Run the tests of a package and fix the failures
+//	---
+//	Run the tests of {{arg1}} and fix the failures. {{args}}
+//
+// {{args}} is the whole text of the arguments, {{arg1}}, {{arg2}}... are its words, and
+// {{date}} is today's date.
+package slashcommands
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/snippets"
+	"gopkg.in/yaml.v3"
+)
+
+// fileExt is the extension of the command files
+const fileExt = ".md"
+
+// Sources of the commands, from the highest precedence
+const (
+	SourceRepo    = "repo"
+	SourceGlobal  = "global"
+	SourceConfig  = "config"
+	SourceBuiltin = "builtin"
+)
+
+// ErrNotFound is returned for a command that is not defined
+var ErrNotFound = errors.New("slash command not found")
+
+// namePattern matches the valid command names, without their slash
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// positionalPattern matches the positional arguments of a template
+var positionalPattern = regexp.MustCompile(`\{\{\s*arg([1-9][0-9]*)\s*\}\}`)
+
+// Command is a prompt template run as /name
+type Command struct {
+	// Name is the name of the command, without its slash
+	Name string
+	// Description is shown in the help and the list of the commands
+	Description string
+	// Template is the prompt sent to the AI once the arguments are filled in
+	Template string
+	// Source is where the command is defined, see the Source constants
+	Source string
+}
+
+// builtins are the commands available without any definition
+var builtins = []Command{
+	{
+		Name:        "summarize",
+		Description: "Summarize the work done in this task so far",
+		Template:    "Summarize what has been done in this task so far: the changes made, the decisions taken and what is left to do. Do not change any file. {{args}}",
+	},
+	{
+		Name:        "test",
+		Description: "Run the tests and fix the failures",
+		Template:    "Run the tests of the project and fix the failures, explaining the cause of each failure before fixing it. {{args}}",
+	},
+	{
+		Name:        "review",
+		Description: "Review the uncommitted changes of the working tree",
+		Template:    "Review the uncommitted changes of the working tree, using git diff. Point out bugs, missing tests and unclear code, by file and line, without editing files. {{args}}",
+	},
+}
+
+// Registry looks up the commands of the repository and global directories, of the
+// configuration and the built-in ones. The directories are read at each lookup, so new and
+// edited files are picked up without restarting.
+type Registry struct {
+	globalDir  string
+	repoDir    string
+	configured []Command
+}
+
+// NewRegistry creates a registry of the commands in the given directories and the configured
+// ones. An empty directory is not read.
+func NewRegistry(globalDir, repoDir string, configured []Command) *Registry {
+	return &Registry{globalDir: globalDir, repoDir: repoDir, configured: configured}
+}
+
+// OpenDefault creates a registry of the commands in ~/.goline/commands and in
+// .goline/commands of the repository at cwd
+func OpenDefault(cwd string) *Registry {
+	globalDir := ""
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		globalDir = filepath.Join(homeDir, ".goline", "commands")
+	}
+	return NewRegistry(globalDir, filepath.Join(cwd, ".goline", "commands"), nil)
+}
+
+// SetConfigured replaces the commands defined in the configuration
+func (r *Registry) SetConfigured(configured []Command) {
+	r.configured = configured
+}
+
+// ValidateName checks that a name can name a command
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid slash command name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// List returns the commands sorted by name, each with the definition of the highest precedence
+func (r *Registry) List() ([]Command, error) {
+	byName := make(map[string]Command)
+	for _, command := range builtins {
+		command.Source = SourceBuiltin
+		byName[command.Name] = command
+	}
+	for _, command := range r.configured {
+		command.Source = SourceConfig
+		byName[command.Name] = command
+	}
+	for _, dir := range []struct{ path, source string }{{r.globalDir, SourceGlobal}, {r.repoDir, SourceRepo}} {
+		commands, err := readDir(dir.path, dir.source)
+		if err != nil {
+			return nil, err
+		}
+		for _, command := range commands {
+			byName[command.Name] = command
+		}
+	}
+
+	list := make([]Command, 0, len(byName))
+	for _, command := range byName {
+		list = append(list, command)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get returns the command of a name, without its slash
+func (r *Registry) Get(name string) (Command, error) {
+	list, err := r.List()
+	if err != nil {
+		return Command{}, err
+	}
+	for _, command := range list {
+		if command.Name == name {
+			return command, nil
+		}
+	}
+	return Command{}, fmt.Errorf("%w: /%s", ErrNotFound, name)
+}
+
+// Names returns the names of the commands starting with prefix, with their slash, sorted
+func (r *Registry) Names(prefix string) []string {
+	list, _ := r.List()
+	var names []string
+	for _, command := range list {
+		if name := "/" + command.Name; strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// readDir reads the command files of a directory, none if it does not exist
+func readDir(dir, source string) ([]Command, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list slash commands: %w", err)
+	}
+	var commands []Command
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fileExt)
+		if !ok || entry.IsDir() || ValidateName(name) != nil {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slash command: %w", err)
+		}
+		command, err := Parse(name, string(data))
+		if err != nil {
+			// One broken file does not hide the other commands
+			slog.Warn("Skipping invalid slash command", "path", path, "error", err)
+			continue
+		}
+		command.Source = source
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// Parse parses the content of a command file: an optional YAML front matter between ---
+// lines, and the template
+func Parse(name, content string) (Command, error) {
+	command := Command{Name: name, Template: content}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		return command, nil
+	}
+	frontMatter, template, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		frontMatter, ok = strings.CutSuffix(rest, "\n---")
+		if !ok {
+			return Command{}, errors.New("the front matter is not closed with ---")
+		}
+	}
+	var meta struct {
+		Description string `yaml:"description"`
+	}
+	if err := yaml.Unmarshal([]byte(frontMatter), &meta); err != nil {
+		return Command{}, fmt.Errorf("failed to parse the front matter: %w", err)
+	}
+	command.Description = meta.Description
+	command.Template = strings.TrimLeft(template, "\n")
+	return command, nil
+}
+
+// Render fills in the arguments of a command: {{args}} is their whole text and {{arg1}},
+// {{arg2}}... their words. A positional argument used by the template but not given is an error.
+func (c Command) Render(args string) (string, error) {
+	args = strings.TrimSpace(args)
+	words := strings.Fields(args)
+	vars := map[string]string{"args": args}
+	for i, word := range words {
+		vars["arg"+strconv.Itoa(i+1)] = word
+	}
+
+	expected := 0
+	for _, match := range positionalPattern.FindAllStringSubmatch(c.Template, -1) {
+		n, _ := strconv.Atoi(match[1])
+		expected = max(expected, n)
+	}
+	if len(words) < expected {
+		return "", fmt.Errorf("/%s expects %d argument(s), got %d", c.Name, expected, len(words))
+	}
+
+	prompt, err := snippets.Render(c.Template, vars)
+	if err != nil {
+		return "", fmt.Errorf("/%s: %w", c.Name, err)
+	}
+	return strings.TrimSpace(prompt), nil
+}
@@ -0,0 +1,74 @@
+package slashcommands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          Command
+		wantErr       bool
+	}{
+		{"plain", "Do {{args}}", Command{Name: "plain", Template: "Do {{args}}"}, false},
+		{"front", "---\ndescription: Does it\n---\n\nDo {{args}}\n", Command{Name: "front", Description: "Does it", Template: "Do {{args}}\n"}, false},
+		{"crlf", "---\r\ndescription: Does it\r\n---\r\nDo\r\n", Command{Name: "crlf", Description: "Does it", Template: "Do\n"}, false},
+		{"unclosed", "---\ndescription: Does it\nDo\n", Command{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.name, tt.content)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", tt.content, got, err, tt.want)
+		}
+	}
+}
+
+func TestRegistryPrecedence(t *testing.T) {
+	globalDir, repoDir := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(globalDir, "test.md", "global test")
+	write(globalDir, "lint.md", "global lint")
+	write(repoDir, "lint.md", "repo lint")
+	write(repoDir, "notes.txt", "not a command")
+	write(repoDir, "broken.md", "---\nunclosed")
+	r := NewRegistry(globalDir, repoDir, []Command{{Name: "test", Template: "config test"}, {Name: "deploy", Template: "config deploy"}})
+
+	for name, want := range map[string]Command{
+		"lint":      {Name: "lint", Template: "repo lint", Source: SourceRepo},
+		"test":      {Name: "test", Template: "global test", Source: SourceGlobal},
+		"deploy":    {Name: "deploy", Template: "config deploy", Source: SourceConfig},
+		"summarize": {Name: "summarize", Description: builtins[0].Description, Template: builtins[0].Template, Source: SourceBuiltin},
+	} {
+		if got, err := r.Get(name); err != nil || got != want {
+			t.Errorf("Get(%s) = %+v, %v, want %+v", name, got, err, want)
+		}
+	}
+	if _, err := r.Get("broken"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(broken) error = %v, want ErrNotFound", err)
+	}
+	if got := r.Names("/l"); len(got) != 1 || got[0] != "/lint" {
+		t.Errorf("Names(/l) = %v", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c := Command{Name: "fix", Template: "Fix {{arg1}} in {{ arg2 }}: {{args}}"}
+	got, err := c.Render("  bug main.go  ")
+	if want := "Fix bug in main.go: bug main.go"; err != nil || got != want {
+		t.Errorf("Render() = %q, %v, want %q", got, err, want)
+	}
+	if _, err := c.Render("bug"); err == nil {
+		t.Error("Render() with a missing argument succeeded")
+	}
+	if got, err := (Command{Name: "test", Template: "Run the tests. {{args}}"}).Render(""); err != nil || got != "Run the tests." {
+		t.Errorf("Render() without arguments = %q, %v", got, err)
+	}
+}
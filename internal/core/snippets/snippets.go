@@ -0,0 +1,227 @@
+// Package snippets stores named prompt fragments reused across tasks, such as style guides or
+// deployment steps. Snippets are saved globally in ~/.goline/snippets, or for a repository in
+// .goline/snippets, one Markdown file per snippet. They can hold template variables written
+// {{name}}, filled in when the snippet is inserted.
+package snippets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileExt is the extension of the snippet files
+const fileExt = ".md"
+
+// Scope is where a snippet is saved
+type Scope string
+
+const (
+	// ScopeGlobal snippets are available in every repository
+	ScopeGlobal Scope = "global"
+	// ScopeRepo snippets are available in their repository, and win over global snippets of the same name
+	ScopeRepo Scope = "repo"
+)
+
+// ErrNotFound is returned for a snippet that does not exist
+var ErrNotFound = errors.New("snippet not found")
+
+// namePattern matches the valid snippet names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// variablePattern matches the template variables of a snippet
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Snippet is a named prompt fragment
+type Snippet struct {
+	Name    string
+	Content string
+	Scope   Scope
+}
+
+// Store reads and writes the snippets of the global and repository directories
+type Store struct {
+	globalDir string
+	repoDir   string
+}
+
+// NewStore creates a store of the snippets in the given directories.
+// An empty directory disables its scope.
+func NewStore(globalDir, repoDir string) *Store {
+	return &Store{globalDir: globalDir, repoDir: repoDir}
+}
+
+// OpenDefault creates a store of the snippets in ~/.goline/snippets and in .goline/snippets of
+// the repository at cwd
+func OpenDefault(cwd string) *Store {
+	globalDir := ""
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		globalDir = filepath.Join(homeDir, ".goline", "snippets")
+	}
+	return NewStore(globalDir, filepath.Join(cwd, ".goline", "snippets"))
+}
+
+// ValidateName checks that a name can name a snippet file
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid snippet name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// dir returns the directory of a scope
+func (s *Store) dir(scope Scope) (string, error) {
+	dir := s.globalDir
+	if scope == ScopeRepo {
+		dir = s.repoDir
+	}
+	if dir == "" {
+		return "", fmt.Errorf("%s snippets are not available", scope)
+	}
+	return dir, nil
+}
+
+// Save saves a snippet, replacing the snippet of the same name and scope
+func (s *Store) Save(name, content string, scope Scope) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	dir, err := s.dir(scope)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create snippets directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+fileExt), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to save snippet: %w", err)
+	}
+	return nil
+}
+
+// Get returns the snippet of a name, that of the repository if both scopes have one
+func (s *Store) Get(name string) (Snippet, error) {
+	if err := ValidateName(name); err != nil {
+		return Snippet{}, err
+	}
+	for _, scope := range []Scope{ScopeRepo, ScopeGlobal} {
+		dir, err := s.dir(scope)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name+fileExt))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Snippet{}, fmt.Errorf("failed to read snippet: %w", err)
+		}
+		return Snippet{Name: name, Content: string(data), Scope: scope}, nil
+	}
+	return Snippet{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// List returns the snippets sorted by name, those of the repository hiding the global ones of the same name
+func (s *Store) List() ([]Snippet, error) {
+	byName := make(map[string]Snippet)
+	for _, scope := range []Scope{ScopeGlobal, ScopeRepo} {
+		dir, err := s.dir(scope)
+		if err != nil {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snippets: %w", err)
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), fileExt)
+			if !ok || entry.IsDir() || ValidateName(name) != nil {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read snippet: %w", err)
+			}
+			byName[name] = Snippet{Name: name, Content: string(data), Scope: scope}
+		}
+	}
+
+	list := make([]Snippet, 0, len(byName))
+	for _, snippet := range byName {
+		list = append(list, snippet)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Names returns the names of the snippets starting with prefix, sorted
+func (s *Store) Names(prefix string) []string {
+	list, _ := s.List()
+	var names []string
+	for _, snippet := range list {
+		if strings.HasPrefix(snippet.Name, prefix) {
+			names = append(names, snippet.Name)
+		}
+	}
+	return names
+}
+
+// Delete deletes the snippet of a name and scope
+func (s *Store) Delete(name string, scope Scope) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	dir, err := s.dir(scope)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, name+fileExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// Variables returns the names of the template variables of a snippet, in order of first use
+func Variables(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range variablePattern.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Render fills in the template variables of a snippet. The date variable is today's date
+// unless it is given. A variable without a value is an error.
+func Render(content string, vars map[string]string) (string, error) {
+	values := map[string]string{"date": time.Now().Format(time.DateOnly)}
+	for name, value := range vars {
+		values[name] = value
+	}
+
+	var missing []string
+	for _, name := range Variables(content) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing values for %s, give them as name=value", strings.Join(missing, ", "))
+	}
+
+	return variablePattern.ReplaceAllStringFunc(content, func(match string) string {
+		return values[variablePattern.FindStringSubmatch(match)[1]]
+	}), nil
+}
@@ -0,0 +1,61 @@
+package snippets
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(t.TempDir(), t.TempDir())
+	if err := store.Save("style", "Use tabs", ScopeGlobal); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save("deploy", "Deploy to {{env}}", ScopeGlobal); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save("style", "Use spaces", ScopeRepo); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save("../escape", "x", ScopeRepo); err == nil {
+		t.Error("Save() with an invalid name succeeded")
+	}
+
+	// The repository snippet wins over the global one
+	snippet, err := store.Get("style")
+	if err != nil || snippet.Content != "Use spaces" || snippet.Scope != ScopeRepo {
+		t.Errorf("Get(style) = %+v, %v", snippet, err)
+	}
+	list, err := store.List()
+	if err != nil || len(list) != 2 || list[0].Name != "deploy" || list[1].Content != "Use spaces" {
+		t.Errorf("List() = %+v, %v", list, err)
+	}
+	if got := store.Names("de"); !reflect.DeepEqual(got, []string{"deploy"}) {
+		t.Errorf("Names(de) = %v", got)
+	}
+
+	if err := store.Delete("style", ScopeRepo); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if snippet, err := store.Get("style"); err != nil || snippet.Content != "Use tabs" {
+		t.Errorf("Get(style) after deleting the repository snippet = %+v, %v", snippet, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	content := "Deploy {{ service }} to {{env}}, then check {{service}} on {{date}}"
+	if got, want := Variables(content), []string{"service", "env", "date"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+
+	got, err := Render(content, map[string]string{"service": "api", "env": "staging", "date": "today"})
+	if err != nil || got != "Deploy api to staging, then check api on today" {
+		t.Errorf("Render() = %q, %v", got, err)
+	}
+	if _, err := Render(content, map[string]string{"service": "api"}); err == nil {
+		t.Error("Render() without env succeeded")
+	}
+}
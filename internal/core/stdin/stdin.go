@@ -0,0 +1,142 @@
+// Package stdin attaches content piped to goline, such as a build log, to a prompt as context.
+package stdin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxBytes limits the piped content attached to a prompt
+	DefaultMaxBytes = 100000
+	// headRatio is the share of the limit kept from the start of truncated content.
+	// Most of it is kept from the end, where logs usually report failures.
+	headRatio = 0.2
+	// sniffBytes is how much of the content is inspected to detect binary data
+	sniffBytes = 8000
+)
+
+// Input is content read from stdin
+type Input struct {
+	// Content is the text kept, with a marker where it was truncated
+	Content string
+	// Size is the number of bytes read
+	Size int64
+	// Truncated reports whether part of the content was dropped
+	Truncated bool
+	// Binary reports whether the content looks binary, in which case it is not kept
+	Binary bool
+}
+
+// Piped reports whether f is a pipe or a file rather than a terminal
+func Piped(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// Read reads r to the end, keeping the start and the end of the content when it is
+// longer than maxBytes. It returns nil when nothing was read.
+func Read(r io.Reader, maxBytes int) (*Input, error) {
+	headSize := int(float64(maxBytes) * headRatio)
+	tailSize := maxBytes - headSize
+
+	var head, tail []byte
+	var size int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		size += int64(n)
+
+		if len(head) < headSize {
+			k := min(headSize-len(head), len(chunk))
+			head = append(head, chunk[:k]...)
+			chunk = chunk[k:]
+		}
+		tail = append(tail, chunk...)
+		// Compact the tail once it holds twice what is kept, to bound memory on large inputs
+		if len(tail) > 2*tailSize {
+			tail = append(tail[:0], tail[len(tail)-tailSize:]...)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	input := &Input{Size: size}
+	if isBinary(head, tail) {
+		input.Binary = true
+		return input, nil
+	}
+	if size <= int64(maxBytes) {
+		input.Content = string(head) + string(tail)
+		return input, nil
+	}
+
+	tail = tail[max(len(tail)-tailSize, 0):]
+	omitted := size - int64(len(head)) - int64(len(tail))
+	// Do not start the tail in the middle of a line or a multi-byte character
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)/2 {
+		omitted += int64(i + 1)
+		tail = tail[i+1:]
+	}
+	input.Truncated = true
+	input.Content = fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", strings.ToValidUTF8(string(head), ""), omitted, strings.ToValidUTF8(string(tail), ""))
+	return input, nil
+}
+
+// isBinary reports whether content looks binary, from a NUL byte or invalid UTF-8 at its start
+func isBinary(head, tail []byte) bool {
+	sample := head
+	if len(sample) < sniffBytes {
+		sample = append(sample[:len(sample):len(sample)], tail[:min(sniffBytes-len(sample), len(tail))]...)
+	}
+	if len(sample) > sniffBytes {
+		sample = sample[:sniffBytes]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	// The sample may end in the middle of a multi-byte character
+	for i := 0; i < utf8.UTFMax && len(sample) > 0; i++ {
+		if utf8.Valid(sample) {
+			return false
+		}
+		sample = sample[:len(sample)-1]
+	}
+	return true
+}
+
+// Block formats the input as a context block for the AI
+func (in *Input) Block() string {
+	if in.Binary {
+		return fmt.Sprintf("<stdin_content bytes=\"%d\">\nBinary data was piped to stdin and omitted.\n</stdin_content>", in.Size)
+	}
+	if in.Truncated {
+		return fmt.Sprintf("<stdin_content bytes=\"%d\" truncated=\"true\">\n%s\n</stdin_content>", in.Size, in.Content)
+	}
+	return fmt.Sprintf("<stdin_content bytes=\"%d\">\n%s\n</stdin_content>", in.Size, strings.TrimRight(in.Content, "\n"))
+}
+
+// Attach appends the input to a prompt as a context block
+func Attach(prompt string, in *Input) string {
+	if in == nil {
+		return prompt
+	}
+	if prompt == "" {
+		prompt = "Piped input (see below for content)"
+	}
+	return prompt + "\n\n" + in.Block()
+}
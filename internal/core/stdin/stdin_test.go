@@ -0,0 +1,100 @@
+package stdin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	var log strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&log, "line %04d\n", i)
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		wantNil       bool
+		wantBinary    bool
+		wantTruncated bool
+		wantContains  []string
+		wantExcludes  []string
+	}{
+		{
+			name:    "empty",
+			input:   "",
+			wantNil: true,
+		},
+		{
+			name:         "short",
+			input:        "build failed\n",
+			wantContains: []string{"build failed"},
+		},
+		{
+			name:          "long log keeps start and end",
+			input:         log.String(),
+			wantTruncated: true,
+			wantContains:  []string{"line 0001\n", "line 1000\n", "bytes omitted ...]\nline "},
+			wantExcludes:  []string{"line 0500"},
+		},
+		{
+			name:       "binary",
+			input:      "PK\x03\x04\x00\x00binary",
+			wantBinary: true,
+		},
+		{
+			name:       "invalid utf-8",
+			input:      "\xff\xfe\xfd text",
+			wantBinary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := Read(strings.NewReader(tt.input), 2000)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if tt.wantNil {
+				if in != nil {
+					t.Errorf("Read() = %+v, want nil", in)
+				}
+				return
+			}
+			if in.Size != int64(len(tt.input)) || in.Binary != tt.wantBinary || in.Truncated != tt.wantTruncated {
+				t.Errorf("Read() = size %d binary %v truncated %v", in.Size, in.Binary, in.Truncated)
+			}
+			if tt.wantBinary && in.Content != "" {
+				t.Errorf("binary content was kept: %q", in.Content)
+			}
+			if len(in.Content) > 2100 {
+				t.Errorf("content is %d bytes, want about the 2000 bytes limit", len(in.Content))
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(in.Content, s) {
+					t.Errorf("content does not contain %q:\n%s", s, in.Content)
+				}
+			}
+			for _, s := range tt.wantExcludes {
+				if strings.Contains(in.Content, s) {
+					t.Errorf("content contains %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestAttach(t *testing.T) {
+	in := &Input{Content: "error: undefined: foo\n", Size: 22}
+	want := "why did this fail?\n\n<stdin_content bytes=\"22\">\nerror: undefined: foo\n</stdin_content>"
+	if got := Attach("why did this fail?", in); got != want {
+		t.Errorf("Attach() = %q, want %q", got, want)
+	}
+
+	if got := Attach("", &Input{Size: 10, Binary: true}); !strings.HasPrefix(got, "Piped input (see below for content)") || !strings.Contains(got, "Binary data") {
+		t.Errorf("Attach() = %q", got)
+	}
+	if got := Attach("prompt", nil); got != "prompt" {
+		t.Errorf("Attach() = %q, want the prompt unchanged", got)
+	}
+}
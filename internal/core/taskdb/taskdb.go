@@ -0,0 +1,294 @@
+// Package taskdb indexes the tasks of a tasks directory in a SQLite database, for fast task
+// listing and full-text search over the transcripts.
+//
+// The task files remain the record of the tasks: the database is synchronized with them when
+// it is opened, indexing again only the tasks written since, so it can be deleted at any time
+// and is rebuilt on the next open.
+package taskdb
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/proto"
+
+	// The pure Go SQLite driver, so that goline builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// schemaVersion is the version of the schema, the database is rebuilt when it changes
+const schemaVersion = 1
+
+// schema creates the tables: tasks has the metadata of each task with the fingerprint of its
+// files when it was indexed, and events the text of the events for the full-text search
+const schema = `
+CREATE TABLE tasks (
+	id TEXT PRIMARY KEY,
+	updated_at TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	task BLOB NOT NULL
+);
+CREATE VIRTUAL TABLE events USING fts5(
+	task_id UNINDEXED,
+	event_id UNINDEXED,
+	timestamp UNINDEXED,
+	kind UNINDEXED,
+	content
+);
+`
+
+// DB is a task catalog backed by a SQLite database
+type DB struct {
+	db       *sql.DB
+	tasksDir string
+}
+
+var _ taskstore.Catalog = (*DB)(nil)
+
+// Open opens the database at path, creating it if needed, and synchronizes it with the tasks
+// of tasksDir
+func Open(path, tasksDir string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the task database: %w", err)
+	}
+	dsn := "file:" + url.PathEscape(filepath.ToSlash(path)) + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the task database: %w", err)
+	}
+	d := &DB{db: db, tasksDir: tasksDir}
+	if err := d.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := d.Sync(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// migrate creates the schema, dropping the tables of an older version as they are rebuilt
+// from the task files
+func (d *DB) migrate() error {
+	var version int
+	if err := d.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read the task database version: %w", err)
+	}
+	if version == schemaVersion {
+		return nil
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range []string{"DROP TABLE IF EXISTS tasks", "DROP TABLE IF EXISTS events", schema, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)} {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create the task database: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Sync indexes the tasks written since they were last indexed and removes the deleted tasks
+func (d *DB) Sync() error {
+	ids, err := taskstore.ListTaskIDs(d.tasksDir)
+	if err != nil {
+		return err
+	}
+	indexed, err := d.fingerprints()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		fingerprint, err := taskstore.NewStoreInDir(d.tasksDir, id).Fingerprint()
+		if err != nil {
+			slog.Warn("Skipping unreadable task", "task", id, "error", err)
+			continue
+		}
+		known, ok := indexed[id]
+		delete(indexed, id)
+		if ok && known == fingerprint {
+			continue
+		}
+		if err := d.index(id, fingerprint); err != nil {
+			slog.Warn("Failed to index task", "task", id, "error", err)
+		}
+	}
+
+	// The tasks left were deleted
+	for id := range indexed {
+		if err := d.remove(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprints returns the fingerprints of the indexed tasks by task ID
+func (d *DB) fingerprints() (map[string]string, error) {
+	rows, err := d.db.Query("SELECT id, fingerprint FROM tasks")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the task database: %w", err)
+	}
+	defer rows.Close()
+	fingerprints := make(map[string]string)
+	for rows.Next() {
+		var id, fingerprint string
+		if err := rows.Scan(&id, &fingerprint); err != nil {
+			return nil, err
+		}
+		fingerprints[id] = fingerprint
+	}
+	return fingerprints, rows.Err()
+}
+
+// index indexes the metadata and the transcript of a task, replacing its previous index
+func (d *DB) index(id, fingerprint string) error {
+	store := taskstore.NewStoreInDir(d.tasksDir, id)
+	task, err := store.LoadTask()
+	if err != nil {
+		return err
+	}
+	events, _, err := store.LoadEvents()
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM events WHERE task_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO tasks (id, updated_at, fingerprint, task) VALUES (?, ?, ?, ?)", id, task.UpdatedAt, fingerprint, data); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare("INSERT INTO events (task_id, event_id, timestamp, kind, content) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, event := range events {
+		kind, text := taskstore.EventText(event)
+		if text == "" {
+			continue
+		}
+		if _, err := insert.Exec(id, event.Id, event.Timestamp, kind, text); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// remove removes a deleted task from the index
+func (d *DB) remove(id string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM events WHERE task_id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove task %s from the task database: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM tasks WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove task %s from the task database: %w", id, err)
+	}
+	return tx.Commit()
+}
+
+// Tasks implements taskstore.Catalog
+func (d *DB) Tasks() ([]*pb.Task, error) {
+	rows, err := d.db.Query("SELECT task FROM tasks ORDER BY updated_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	defer rows.Close()
+	var tasks []*pb.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// Search implements taskstore.Catalog. The words of the query match the words of the
+// transcripts starting with them, the matches are ranked by relevance.
+func (d *DB) Search(query string, limit int) ([]taskstore.Match, error) {
+	match := matchExpression(query)
+	if match == "" {
+		return nil, nil
+	}
+	rows, err := d.db.Query(`
+		SELECT tasks.task, events.event_id, events.timestamp, events.kind, snippet(events, 4, '', '', '...', 24)
+		FROM events JOIN tasks ON tasks.id = events.task_id
+		WHERE events MATCH ?
+		ORDER BY rank
+		LIMIT ?`, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tasks: %w", err)
+	}
+	defer rows.Close()
+	var matches []taskstore.Match
+	for rows.Next() {
+		var data []byte
+		var m taskstore.Match
+		if err := rows.Scan(&data, &m.EventID, &m.Timestamp, &m.Kind, &m.Snippet); err != nil {
+			return nil, err
+		}
+		m.Task = &pb.Task{}
+		if err := proto.Unmarshal(data, m.Task); err != nil {
+			return nil, fmt.Errorf("failed to decode task: %w", err)
+		}
+		m.Snippet = strings.Join(strings.Fields(m.Snippet), " ")
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// Close implements taskstore.Catalog
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// scanTask decodes the task of a row
+func scanTask(rows *sql.Rows) (*pb.Task, error) {
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return nil, err
+	}
+	task := &pb.Task{}
+	if err := proto.Unmarshal(data, task); err != nil {
+		return nil, fmt.Errorf("failed to decode task: %w", err)
+	}
+	return task, nil
+}
+
+// matchExpression returns the FTS5 expression matching the text containing every word of a
+// query as a prefix of its words. The words are quoted, so that the query syntax of FTS5 is
+// not interpreted.
+func matchExpression(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
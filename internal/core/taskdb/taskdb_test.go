@@ -0,0 +1,65 @@
+package taskdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/core/taskstore/taskstoretest"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func TestDB(t *testing.T) {
+	tasksDir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	taskstoretest.SaveTask(t, tasksDir, "old", "2026-01-01T00:00:00Z", "fix the flaky login test")
+	taskstoretest.SaveTask(t, tasksDir, "new", "2026-02-01T00:00:00Z", "add a login page")
+
+	db, err := Open(path, tasksDir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	tasks, err := db.Tasks()
+	if err != nil {
+		t.Fatalf("Tasks() error = %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Id != "new" || tasks[1].Id != "old" {
+		t.Errorf("Tasks() = %v, want the most recent first", tasks)
+	}
+	matches, err := db.Search(`log "flaky`, 10)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(matches) != 1 || matches[0].Task.Id != "old" || matches[0].Kind != "user" || matches[0].Snippet != "fix the flaky login test" {
+		t.Errorf("Search() = %+v, want the message with every word", matches)
+	}
+	db.Close()
+
+	// Reopening indexes the tasks written and removes the tasks deleted meanwhile
+	if err := taskstore.NewRecorder(taskstore.NewStoreInDir(tasksDir, "new")).RecordUserMessage("then deploy it", pb.UserMessageType_USER_MESSAGE_TYPE_ASK); err != nil {
+		t.Fatal(err)
+	}
+	if err := taskstore.NewStoreInDir(tasksDir, "old").Remove(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path, tasksDir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	if tasks, _ := db.Tasks(); len(tasks) != 1 || tasks[0].Id != "new" {
+		t.Errorf("Tasks() = %v, want the deleted task removed", tasks)
+	}
+	if matches, _ := db.Search("deploy", 10); len(matches) != 1 || matches[0].Task.Id != "new" {
+		t.Errorf("Search() = %+v, want the new message indexed", matches)
+	}
+	if matches, _ := db.Search("flaky", 10); len(matches) != 0 {
+		t.Errorf("Search() = %+v, want the deleted task removed", matches)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	if got := matchExpression(`fix "login OR`); got != `"fix"* """login"* "OR"*` {
+		t.Errorf("matchExpression() = %s", got)
+	}
+}
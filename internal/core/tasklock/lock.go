@@ -0,0 +1,403 @@
+// Package tasklock guards a task directory against concurrent use from several processes or hosts,
+// for example when ~/.goline/tasks lives on a network filesystem or a synced folder.
+package tasklock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File names in the task directory
+const (
+	lockFileName  = "task.lock"
+	fenceFileName = "task.fence"
+)
+
+// Default timings
+const (
+	// DefaultStaleAfter is how long a lock may go without a heartbeat before it is considered stale
+	DefaultStaleAfter = 2 * time.Minute
+	// heartbeatDivisor sets the heartbeat interval relative to the stale duration
+	heartbeatDivisor = 4
+)
+
+var (
+	// ErrHeld is returned when the task is locked by another live process
+	ErrHeld = errors.New("task is in use by another process")
+	// ErrReadOnly is returned when writing through a read-only lock
+	ErrReadOnly = errors.New("task is open read-only because another process holds it")
+	// ErrLost is returned when the lock was taken over by another process
+	ErrLost = errors.New("task lock was taken over by another process")
+)
+
+// Info describes the holder of a lock
+type Info struct {
+	Host        string    `json:"host"`
+	PID         int       `json:"pid"`
+	Token       uint64    `json:"token"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// String describes the holder
+func (i Info) String() string {
+	return fmt.Sprintf("pid %d on %s since %s", i.PID, i.Host, i.AcquiredAt.Local().Format(time.DateTime))
+}
+
+// HeldError is returned when the task is locked by another process
+type HeldError struct {
+	// Holder is the process holding the lock
+	Holder Info
+}
+
+// Error returns the error message
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("task is in use by %s", e.Holder)
+}
+
+// Is reports whether target is ErrHeld
+func (e *HeldError) Is(target error) bool {
+	return target == ErrHeld
+}
+
+// Lock is a lock on a task directory.
+// A held lock is kept alive by a heartbeat. Writers call Validate before writing, which fails
+// once another process has taken the lock over, so a process that was considered dead (for
+// example after a long network partition) cannot corrupt the task.
+type Lock struct {
+	mu         sync.Mutex
+	dir        string
+	info       Info
+	readOnly   bool
+	holder     Info
+	staleAfter time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// Acquire locks the task directory with the default stale duration
+func Acquire(dir string) (*Lock, error) {
+	return AcquireWithStaleAfter(dir, DefaultStaleAfter)
+}
+
+// AcquireWithStaleAfter locks the task directory.
+// A lock left behind by a dead process, or one whose heartbeat is older than staleAfter, is
+// taken over. If another live process holds the lock, a *HeldError is returned.
+func AcquireWithStaleAfter(dir string, staleAfter time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create task directory: %w", err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	l := &Lock{
+		dir:        dir,
+		staleAfter: staleAfter,
+	}
+
+	// A few attempts are needed when a stale lock is removed by another process at the same time
+	for attempt := 0; attempt < 3; attempt++ {
+		token, err := l.nextToken()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		l.info = Info{
+			Host:        host,
+			PID:         os.Getpid(),
+			Token:       token,
+			AcquiredAt:  now,
+			HeartbeatAt: now,
+		}
+
+		created, err := l.create()
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			l.startHeartbeat()
+			return l, nil
+		}
+
+		// Someone holds the lock, take it over if it is stale
+		holder, err := readInfo(l.lockPath())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !l.isStale(holder) {
+			return nil, &HeldError{Holder: holder}
+		}
+		if err := l.removeStale(holder); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to acquire task lock in %s", dir)
+}
+
+// ReadOnly returns a lock that refuses every write, for opening a task held by another process
+func ReadOnly(dir string, holder Info) *Lock {
+	return &Lock{
+		dir:      dir,
+		readOnly: true,
+		holder:   holder,
+	}
+}
+
+// IsReadOnly reports whether the lock refuses writes
+func (l *Lock) IsReadOnly() bool {
+	return l.readOnly
+}
+
+// Holder returns the process holding the task
+func (l *Lock) Holder() Info {
+	if l.readOnly {
+		return l.holder
+	}
+	return l.info
+}
+
+// Validate checks that the lock is still held by this process.
+// It must be called before writing to the task.
+func (l *Lock) Validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.readOnly {
+		return ErrReadOnly
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.validate()
+}
+
+// Release stops the heartbeat and removes the lock if it is still held by this process
+func (l *Lock) Release() error {
+	if l == nil || l.readOnly {
+		return nil
+	}
+
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.validate(); err != nil {
+		// Someone else owns the lock now, leave it alone
+		return nil
+	}
+	if err := os.Remove(l.lockPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove task lock: %w", err)
+	}
+	return nil
+}
+
+// validate checks the lock file against the held lock, the mutex must be held
+func (l *Lock) validate() error {
+	current, err := readInfo(l.lockPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrLost
+		}
+		return err
+	}
+	if current.Token != l.info.Token || current.Host != l.info.Host || current.PID != l.info.PID {
+		return fmt.Errorf("%w: now held by %s", ErrLost, current)
+	}
+	return nil
+}
+
+// startHeartbeat refreshes the lock until it is released
+func (l *Lock) startHeartbeat() {
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	interval := l.staleAfter / heartbeatDivisor
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				l.heartbeat()
+			}
+		}
+	}()
+}
+
+// heartbeat refreshes the heartbeat time of the lock if it is still held
+func (l *Lock) heartbeat() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.validate() != nil {
+		return
+	}
+	l.info.HeartbeatAt = time.Now().UTC()
+	_ = writeInfo(l.lockPath(), l.info)
+}
+
+// create creates the lock file exclusively and reports whether it was created
+func (l *Lock) create() (bool, error) {
+	data, err := json.Marshal(l.info)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode task lock: %w", err)
+	}
+
+	f, err := os.OpenFile(l.lockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create task lock: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(l.lockPath())
+		return false, fmt.Errorf("failed to write task lock: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(l.lockPath())
+		return false, fmt.Errorf("failed to write task lock: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write task lock: %w", err)
+	}
+	return true, nil
+}
+
+// isStale reports whether a lock holder is gone
+func (l *Lock) isStale(holder Info) bool {
+	if time.Since(holder.HeartbeatAt) > l.staleAfter {
+		return true
+	}
+	// On the same host, a dead process can be detected without waiting for the heartbeat
+	return holder.Host == l.info.Host && holder.PID != l.info.PID && !processAlive(holder.PID)
+}
+
+// removeStale removes a stale lock.
+// The lock is first moved aside and checked, so a fresh lock created by another process
+// in the meantime is restored instead of being removed.
+func (l *Lock) removeStale(stale Info) error {
+	asidePath := fmt.Sprintf("%s.stale-%s-%d", l.lockPath(), sanitize(l.info.Host), l.info.PID)
+	if err := os.Rename(l.lockPath(), asidePath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove stale task lock: %w", err)
+	}
+
+	moved, err := readInfo(asidePath)
+	if err == nil && moved.Token != stale.Token {
+		// Another process acquired the lock in between, put it back
+		if err := os.Rename(asidePath, l.lockPath()); err != nil {
+			return fmt.Errorf("failed to restore task lock: %w", err)
+		}
+		return &HeldError{Holder: moved}
+	}
+
+	os.Remove(asidePath)
+	return nil
+}
+
+// nextToken increments and returns the fencing token of the task
+func (l *Lock) nextToken() (uint64, error) {
+	var token uint64
+	data, err := os.ReadFile(l.fencePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read fencing token: %w", err)
+	}
+	if len(data) > 0 {
+		token, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse fencing token: %w", err)
+		}
+	}
+	token++
+
+	if err := writeFileAtomic(l.fencePath(), []byte(strconv.FormatUint(token, 10))); err != nil {
+		return 0, fmt.Errorf("failed to write fencing token: %w", err)
+	}
+	return token, nil
+}
+
+// lockPath returns the path of the lock file
+func (l *Lock) lockPath() string {
+	return filepath.Join(l.dir, lockFileName)
+}
+
+// fencePath returns the path of the fencing token file
+func (l *Lock) fencePath() string {
+	return filepath.Join(l.dir, fenceFileName)
+}
+
+// readInfo reads a lock file
+func readInfo(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, fmt.Errorf("failed to parse task lock %s: %w", path, err)
+	}
+	return info, nil
+}
+
+// writeInfo rewrites a lock file
+func writeInfo(path string, info Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes a file through a temporary file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// sanitize makes a host name safe for use in a file name
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,75 @@
+package tasklock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireHeld(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer lock.Release()
+
+	if err := lock.Validate(); err != nil {
+		t.Errorf("Expected held lock to be valid, got %v", err)
+	}
+
+	// A second acquire from this live process is refused
+	_, err = Acquire(dir)
+	var held *HeldError
+	if !errors.As(err, &held) || !errors.Is(err, ErrHeld) {
+		t.Fatalf("Expected HeldError, got %v", err)
+	}
+
+	// A read-only lock refuses writes
+	readOnly := ReadOnly(dir, held.Holder)
+	if err := readOnly.Validate(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	second, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Failed to acquire released lock: %v", err)
+	}
+	second.Release()
+}
+
+func TestStaleLockTakeover(t *testing.T) {
+	dir := t.TempDir()
+
+	// A lock whose heartbeat stopped is taken over
+	first, err := AcquireWithStaleAfter(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	first.info.HeartbeatAt = time.Now().Add(-2 * time.Hour)
+	if err := writeInfo(first.lockPath(), first.info); err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+
+	second, err := AcquireWithStaleAfter(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to take over stale lock: %v", err)
+	}
+	defer second.Release()
+	if second.info.Token <= first.info.Token {
+		t.Errorf("Expected fencing token to increase, got %d after %d", second.info.Token, first.info.Token)
+	}
+
+	// The previous holder is fenced off
+	if err := first.Validate(); !errors.Is(err, ErrLost) {
+		t.Errorf("Expected ErrLost for the previous holder, got %v", err)
+	}
+	first.Release()
+	if err := second.Validate(); err != nil {
+		t.Errorf("Expected the new holder to keep the lock, got %v", err)
+	}
+}
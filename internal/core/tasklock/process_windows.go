@@ -0,0 +1,18 @@
+package tasklock
+
+import (
+	"syscall"
+)
+
+// processQueryLimitedInformation is the access right needed to open a process for querying
+const processQueryLimitedInformation = 0x1000
+
+// processAlive reports whether a process with the given pid exists
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	syscall.CloseHandle(h)
+	return true
+}
@@ -0,0 +1,192 @@
+package taskstore
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// snippetRunes is the length of the snippets shown around the matches of a search
+const snippetRunes = 120
+
+// Catalog lists the tasks of a tasks directory and searches their transcripts. The task files
+// remain the record of the tasks: a catalog reads them, and may index them to answer faster.
+type Catalog interface {
+	// Tasks returns the metadata of the tasks, the most recently updated first
+	Tasks() ([]*pb.Task, error)
+	// Search returns the events of the transcripts matching every word of a query, the best
+	// matches first, at most limit of them
+	Search(query string, limit int) ([]Match, error)
+	// Close releases the catalog
+	Close() error
+}
+
+// Match is an event of a task transcript matching a search
+type Match struct {
+	// Task is the metadata of the task
+	Task *pb.Task
+	// EventID is the ID of the matching event
+	EventID string
+	// Timestamp is when the event occurred, in RFC 3339 format
+	Timestamp string
+	// Kind is the kind of event, e.g. user or assistant
+	Kind string
+	// Snippet is the part of the event text around the match
+	Snippet string
+}
+
+// EventText returns the kind of an event and its text searched by catalogs, empty for events
+// without text
+func EventText(event *pb.TaskEvent) (kind, text string) {
+	switch ev := event.Event.(type) {
+	case *pb.TaskEvent_UserMessage:
+		return "user", ev.UserMessage.Content
+	case *pb.TaskEvent_AiResponse:
+		return "assistant", ev.AiResponse.Content
+	case *pb.TaskEvent_ToolCall:
+		call := ev.ToolCall
+		return "tool", strings.TrimSpace(strings.Join([]string{call.ToolName, call.Arguments, call.Result, call.ErrorMessage}, "\n"))
+	case *pb.TaskEvent_FileModification:
+		return "file", ev.FileModification.FilePath
+	case *pb.TaskEvent_SystemEvent:
+		return "system", ev.SystemEvent.Content
+	case *pb.TaskEvent_ContextSummary:
+		return "summary", ev.ContextSummary.Summary
+	default:
+		return "", ""
+	}
+}
+
+// Fingerprint returns a value that changes whenever the metadata or the history of the task
+// is written, for catalogs to tell which tasks to index again
+func (s *Store) Fingerprint() (string, error) {
+	var b strings.Builder
+	paths := []string{s.taskPath()}
+	sequences, err := s.segments()
+	if err != nil {
+		return "", err
+	}
+	for _, sequence := range sequences {
+		paths = append(paths, s.segmentPath(sequence))
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat task file: %w", err)
+		}
+		fmt.Fprintf(&b, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
+
+// fileCatalog reads the task files at each call
+type fileCatalog struct {
+	tasksDir string
+}
+
+// NewFileCatalog returns a catalog reading the task files of a tasks directory at each call,
+// which gets slow with hundreds of tasks
+func NewFileCatalog(tasksDir string) Catalog {
+	return &fileCatalog{tasksDir: tasksDir}
+}
+
+// Tasks implements Catalog
+func (c *fileCatalog) Tasks() ([]*pb.Task, error) {
+	ids, err := ListTaskIDs(c.tasksDir)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*pb.Task, 0, len(ids))
+	for _, id := range ids {
+		task, err := NewStoreInDir(c.tasksDir, id).LoadTask()
+		if err != nil {
+			slog.Warn("Skipping unreadable task", "task", id, "error", err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+// Search implements Catalog
+func (c *fileCatalog) Search(query string, limit int) ([]Match, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+	tasks, err := c.Tasks()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	for _, task := range tasks {
+		events, _, err := NewStoreInDir(c.tasksDir, task.Id).LoadEvents()
+		if err != nil {
+			continue
+		}
+		for _, event := range events {
+			kind, text := EventText(event)
+			if !containsAll(strings.ToLower(text), words) {
+				continue
+			}
+			matches = append(matches, Match{Task: task, EventID: event.Id, Timestamp: event.Timestamp, Kind: kind, Snippet: snippet(text, words[0])})
+			if len(matches) == limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Close implements Catalog
+func (c *fileCatalog) Close() error {
+	return nil
+}
+
+// sortTasks sorts tasks by the time they were last updated, the most recent first
+func sortTasks(tasks []*pb.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].UpdatedAt != tasks[j].UpdatedAt {
+			return tasks[i].UpdatedAt > tasks[j].UpdatedAt
+		}
+		return tasks[i].Id > tasks[j].Id
+	})
+}
+
+// containsAll reports whether text contains every word
+func containsAll(text string, words []string) bool {
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet returns the line of text around the first occurrence of word, ignoring case, on a
+// single line and shortened to about snippetRunes runes
+func snippet(text, word string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	at := strings.Index(strings.ToLower(text), strings.ToLower(word))
+	if at < 0 {
+		at = 0
+	}
+	start := max(0, at-snippetRunes/3)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	shown := text[start:]
+	if start > 0 {
+		shown = "..." + shown
+	}
+	if utf8.RuneCountInString(shown) > snippetRunes {
+		shown = string([]rune(shown)[:snippetRunes]) + "..."
+	}
+	return shown
+}
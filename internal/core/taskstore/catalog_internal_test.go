@@ -0,0 +1,17 @@
+package taskstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a ", 100) + "needle" + strings.Repeat(" b", 100)
+	got := snippet(long, "NEEDLE")
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "needle") {
+		t.Errorf("snippet() = %q, want the text around the word", got)
+	}
+	if got := snippet("one\ntwo", "two"); got != "one two" {
+		t.Errorf("snippet() = %q, want a single line", got)
+	}
+}
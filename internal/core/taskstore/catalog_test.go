@@ -0,0 +1,52 @@
+package taskstore_test
+
+import (
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/core/taskstore/taskstoretest"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func TestFileCatalog(t *testing.T) {
+	dir := t.TempDir()
+	taskstoretest.SaveTask(t, dir, "old", "2026-01-01T00:00:00Z", "fix the flaky Login test")
+	taskstoretest.SaveTask(t, dir, "new", "2026-02-01T00:00:00Z", "add a login page", "then deploy it")
+	catalog := taskstore.NewFileCatalog(dir)
+	defer catalog.Close()
+
+	tasks, err := catalog.Tasks()
+	if err != nil {
+		t.Fatalf("Tasks() error = %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Id != "new" || tasks[1].Id != "old" {
+		t.Errorf("Tasks() = %v, want the most recent first", tasks)
+	}
+
+	matches, err := catalog.Search("LOGIN test", 10)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(matches) != 1 || matches[0].Task.Id != "old" || matches[0].Kind != "user" || matches[0].Snippet != "fix the flaky Login test" {
+		t.Errorf("Search() = %+v, want the message with every word", matches)
+	}
+	if matches, _ := catalog.Search("login", 1); len(matches) != 1 {
+		t.Errorf("Search() returned %d matches, want the limit", len(matches))
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	taskstoretest.SaveTask(t, dir, "task", "2026-01-01T00:00:00Z", "hello")
+	store := taskstore.NewStoreInDir(dir, "task")
+	before, err := store.Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint() error = %v", err)
+	}
+	if err := taskstore.NewRecorder(store).RecordUserMessage("again", pb.UserMessageType_USER_MESSAGE_TYPE_ASK); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := store.Fingerprint(); after == before {
+		t.Error("Fingerprint() did not change when an event was appended")
+	}
+}
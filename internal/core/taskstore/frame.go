@@ -0,0 +1,96 @@
+package taskstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Frame layout: magic (4 bytes), payload length (4 bytes), CRC-32C of the payload (4 bytes), payload
+const (
+	frameMagic      = "GLF1"
+	frameHeaderSize = 12
+	// maxFrameSize guards against a corrupted length field allocating huge buffers
+	maxFrameSize = 256 << 20
+)
+
+// ErrCorrupt is returned when persisted data fails its integrity check
+var ErrCorrupt = errors.New("data is corrupted")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// appendFrame appends a framed payload to buf
+func appendFrame(buf []byte, payload []byte) []byte {
+	var header [frameHeaderSize]byte
+	copy(header[:4], frameMagic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[8:12], crc32.Checksum(payload, crcTable))
+	buf = append(buf, header[:]...)
+	return append(buf, payload...)
+}
+
+// frameProblem is a range of a file that could not be read
+type frameProblem struct {
+	offset int64
+	err    error
+}
+
+// readFrames returns the payloads of all valid frames in data.
+// A damaged frame is reported and skipped by searching for the next frame, so the
+// frames after it are still recovered. A frame cut short at the end of the data,
+// as left by a crash during a write, is reported as truncated.
+func readFrames(data []byte) ([][]byte, []frameProblem) {
+	var payloads [][]byte
+	var problems []frameProblem
+
+	offset := 0
+	for offset < len(data) {
+		payload, err := readFrame(data[offset:])
+		if err == nil {
+			payloads = append(payloads, payload)
+			offset += frameHeaderSize + len(payload)
+			continue
+		}
+
+		problems = append(problems, frameProblem{offset: int64(offset), err: err})
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		// Resynchronize on the next frame
+		next := bytes.Index(data[offset+1:], []byte(frameMagic))
+		if next < 0 {
+			break
+		}
+		offset += 1 + next
+	}
+
+	return payloads, problems
+}
+
+// readFrame reads the frame at the start of data
+func readFrame(data []byte) ([]byte, error) {
+	if len(data) < frameHeaderSize {
+		return nil, fmt.Errorf("truncated frame header: %w", io.ErrUnexpectedEOF)
+	}
+	if string(data[:4]) != frameMagic {
+		return nil, fmt.Errorf("invalid frame header: %w", ErrCorrupt)
+	}
+
+	length := binary.BigEndian.Uint32(data[4:8])
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame length %d: %w", length, ErrCorrupt)
+	}
+	if len(data) < frameHeaderSize+int(length) {
+		return nil, fmt.Errorf("truncated frame: %w", io.ErrUnexpectedEOF)
+	}
+
+	payload := data[frameHeaderSize : frameHeaderSize+int(length)]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(data[8:12]) {
+		return nil, fmt.Errorf("checksum mismatch: %w", ErrCorrupt)
+	}
+	return payload, nil
+}
@@ -0,0 +1,171 @@
+package taskstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// Recorder writes the conversation of a task to its history as it happens.
+// Every event is synced to disk before the Record method returns, so a crash
+// loses at most the event being written.
+type Recorder struct {
+	mu           sync.Mutex
+	store        *Store
+	checkpointID string
+}
+
+// NewRecorder creates a recorder appending to the history of a store
+func NewRecorder(store *Store) *Recorder {
+	return &Recorder{store: store}
+}
+
+// SetCheckpoint sets the checkpoint referenced by the events recorded from now on
+func (r *Recorder) SetCheckpoint(checkpointID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkpointID = checkpointID
+}
+
+// RecordUserMessage records a message from the user
+func (r *Recorder) RecordUserMessage(content string, messageType pb.UserMessageType) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_UserMessage{
+		UserMessage: &pb.UserMessage{Content: content, Type: messageType},
+	}})
+}
+
+// RecordAIResponse records a response from the AI, with its usage
+func (r *Recorder) RecordAIResponse(response *pb.AIResponse) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_AiResponse{AiResponse: response}})
+}
+
+// RecordToolCall records a call to a tool by the AI
+func (r *Recorder) RecordToolCall(toolCall *pb.ToolCallEvent) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_ToolCall{ToolCall: toolCall}})
+}
+
+// RecordFileModification records a change to a file
+func (r *Recorder) RecordFileModification(modification *pb.FileModificationEvent) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_FileModification{FileModification: modification}})
+}
+
+// RecordCheckpoint records a checkpoint operation.
+// The checkpoint becomes the one referenced by the events recorded after it.
+func (r *Recorder) RecordCheckpoint(checkpoint *pb.CheckpointEvent) error {
+	r.SetCheckpoint(checkpoint.CheckpointId)
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_Checkpoint{Checkpoint: checkpoint}})
+}
+
+// RecordSystemEvent records a system message or notification
+func (r *Recorder) RecordSystemEvent(content string, eventType pb.SystemEventType) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_SystemEvent{
+		SystemEvent: &pb.SystemEvent{Content: content, Type: eventType},
+	}})
+}
+
+// RecordContextSummary records older turns compressed into a summary, with the original turns
+func (r *Recorder) RecordContextSummary(summary *pb.ContextSummaryEvent) error {
+	return r.record(&pb.TaskEvent{Event: &pb.TaskEvent_ContextSummary{ContextSummary: summary}})
+}
+
+// record fills in the ID, timestamp and checkpoint of an event and appends it to the history
+func (r *Recorder) record(event *pb.TaskEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+	event.Id = id
+	event.Timestamp = time.Now().Format(time.RFC3339)
+	event.CheckpointId = r.checkpointID
+	return r.store.AppendEvent(event)
+}
+
+// newEventID returns a unique event ID that sorts by creation time
+func newEventID() (string, error) {
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	return fmt.Sprintf("%016x-%s", time.Now().UnixNano(), hex.EncodeToString(suffix[:])), nil
+}
+
+// NewTaskID returns a unique task ID that sorts by creation time
+func NewTaskID() (string, error) {
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("failed to generate task ID: %w", err)
+	}
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix[:])), nil
+}
+
+// LoadHistory reads the task history with the total usage of the AI responses and the
+// checkpoints saved during the task.
+// Damaged events are skipped and listed in the report, as with LoadEvents.
+func (s *Store) LoadHistory() (*pb.TaskHistory, *Report, error) {
+	events, report, err := s.LoadEvents()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history := &pb.TaskHistory{
+		TaskId:     s.taskID,
+		Events:     events,
+		TotalUsage: &pb.TokenUsage{},
+	}
+	saved := make(map[string]bool)
+	for _, event := range events {
+		switch e := event.Event.(type) {
+		case *pb.TaskEvent_AiResponse:
+			addUsage(history.TotalUsage, e.AiResponse.GetUsage())
+		case *pb.TaskEvent_ContextSummary:
+			addUsage(history.TotalUsage, e.ContextSummary.GetUsage())
+		case *pb.TaskEvent_Checkpoint:
+			id := e.Checkpoint.GetCheckpointId()
+			if e.Checkpoint.GetOperationType() == pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_SAVE && id != "" && !saved[id] {
+				saved[id] = true
+				history.CheckpointIds = append(history.CheckpointIds, id)
+			}
+		}
+	}
+	return history, report, nil
+}
+
+// EventsBefore returns the events recorded before a checkpoint was saved, the conversation a
+// task branched at the checkpoint continues from. When the history does not record the saving
+// of the checkpoint, e.g. for a checkpoint saved by hand, the events recorded up to savedAt are kept.
+func EventsBefore(events []*pb.TaskEvent, checkpointID string, savedAt time.Time) []*pb.TaskEvent {
+	for i, event := range events {
+		checkpoint := event.GetCheckpoint()
+		if checkpoint.GetOperationType() == pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_SAVE && checkpoint.GetCheckpointId() == checkpointID {
+			return events[:i]
+		}
+	}
+
+	var kept []*pb.TaskEvent
+	for _, event := range events {
+		if timestamp, err := time.Parse(time.RFC3339, event.GetTimestamp()); err == nil && timestamp.After(savedAt) {
+			break
+		}
+		kept = append(kept, event)
+	}
+	return kept
+}
+
+// addUsage adds usage to total
+func addUsage(total, usage *pb.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.CacheReadTokens += usage.CacheReadTokens
+	total.CacheWriteTokens += usage.CacheWriteTokens
+	total.TotalCost += usage.TotalCost
+}
@@ -0,0 +1,100 @@
+package taskstore
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func TestRecorderAndLoadHistory(t *testing.T) {
+	store := NewStoreInDir(t.TempDir(), "task-3")
+	recorder := NewRecorder(store)
+
+	steps := []func() error{
+		func() error {
+			return recorder.RecordUserMessage("add a test", pb.UserMessageType_USER_MESSAGE_TYPE_ASK)
+		},
+		func() error {
+			return recorder.RecordCheckpoint(&pb.CheckpointEvent{
+				OperationType: pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_SAVE,
+				CheckpointId:  "cp-1",
+			})
+		},
+		func() error {
+			return recorder.RecordAIResponse(&pb.AIResponse{Content: "done", Usage: &pb.TokenUsage{InputTokens: 10, OutputTokens: 5, TotalCost: 0.25}})
+		},
+		func() error {
+			return recorder.RecordToolCall(&pb.ToolCallEvent{ToolName: "write_to_file", Success: true})
+		},
+		func() error {
+			return recorder.RecordAIResponse(&pb.AIResponse{Content: "again", Usage: &pb.TokenUsage{InputTokens: 20, OutputTokens: 1, TotalCost: 0.5}})
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Failed to record event: %v", err)
+		}
+	}
+
+	history, report, err := store.LoadHistory()
+	if err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Unexpected problems: %s", report)
+	}
+	if history.TaskId != "task-3" || len(history.Events) != len(steps) {
+		t.Fatalf("Unexpected history: task %s with %d events", history.TaskId, len(history.Events))
+	}
+
+	// Events are written with IDs, timestamps and the checkpoint current at the time
+	if history.Events[0].CheckpointId != "" || history.Events[2].CheckpointId != "cp-1" {
+		t.Errorf("Unexpected checkpoint references: %q, %q", history.Events[0].CheckpointId, history.Events[2].CheckpointId)
+	}
+	for _, event := range history.Events {
+		if event.Id == "" || event.Timestamp == "" {
+			t.Errorf("Event without ID or timestamp: %v", event)
+		}
+	}
+
+	usage := history.TotalUsage
+	if usage.InputTokens != 30 || usage.OutputTokens != 6 || usage.TotalCost != 0.75 {
+		t.Errorf("Unexpected total usage: %v", usage)
+	}
+	if len(history.CheckpointIds) != 1 || history.CheckpointIds[0] != "cp-1" {
+		t.Errorf("Unexpected checkpoints: %v", history.CheckpointIds)
+	}
+}
+
+func TestEventsBefore(t *testing.T) {
+	at := func(minute int) string {
+		return time.Date(2025, 1, 1, 10, minute, 0, 0, time.UTC).Format(time.RFC3339)
+	}
+	events := []*pb.TaskEvent{
+		{Id: "1", Timestamp: at(0), Event: &pb.TaskEvent_UserMessage{UserMessage: &pb.UserMessage{Content: "add a test"}}},
+		{Id: "2", Timestamp: at(1), Event: &pb.TaskEvent_AiResponse{AiResponse: &pb.AIResponse{Content: "writing it"}}},
+		{Id: "3", Timestamp: at(2), Event: &pb.TaskEvent_Checkpoint{Checkpoint: &pb.CheckpointEvent{
+			OperationType: pb.CheckpointOperationType_CHECKPOINT_OPERATION_TYPE_SAVE,
+			CheckpointId:  "cp-1",
+		}}},
+		{Id: "4", Timestamp: at(2), CheckpointId: "cp-1", Event: &pb.TaskEvent_FileModification{FileModification: &pb.FileModificationEvent{FilePath: "a_test.go"}}},
+		{Id: "5", Timestamp: at(5), CheckpointId: "cp-1", Event: &pb.TaskEvent_AiResponse{AiResponse: &pb.AIResponse{Content: "done"}}},
+	}
+
+	ids := func(events []*pb.TaskEvent) []string {
+		var ids []string
+		for _, event := range events {
+			ids = append(ids, event.Id)
+		}
+		return ids
+	}
+	// The recorded checkpoint wins over the time
+	if got := ids(EventsBefore(events, "cp-1", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))); len(got) != 2 || got[1] != "2" {
+		t.Errorf("EventsBefore(cp-1) = %v, want [1 2]", got)
+	}
+	// A checkpoint missing from the history cuts the events at its time
+	if got := ids(EventsBefore(events, "cp-2", time.Date(2025, 1, 1, 10, 3, 0, 0, time.UTC))); len(got) != 4 || got[3] != "4" {
+		t.Errorf("EventsBefore(cp-2) = %v, want [1 2 3 4]", got)
+	}
+}
@@ -0,0 +1,447 @@
+// Package taskstore persists task metadata and conversation history with integrity checks.
+//
+// Every record is written in a checksummed frame. The task metadata is stored in
+// [taskID].pb and the history in append-only segments [taskID]/NNNNN.pb, each starting
+// with a TaskEventBatch header followed by one frame per TaskEvent. A damaged or
+// truncated frame only loses that record: loading recovers everything else and reports
+// what could not be read.
+//
+// A Recorder appends the conversation to the history as it happens, and LoadHistory
+// assembles it into a TaskHistory with the total usage and the checkpoints saved.
+package taskstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kazz187/goline/internal/core/tasklock"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// segmentMaxSize is the size after which a new history segment is started
+const segmentMaxSize = 4 << 20
+
+// segmentPattern matches the file names of history segments
+var segmentPattern = regexp.MustCompile(`^(\d{5,})\.pb$`)
+
+// Problem is a part of the task data that could not be read
+type Problem struct {
+	// File is the path of the damaged file
+	File string
+	// Offset is the byte offset of the damaged record
+	Offset int64
+	// Err describes the damage
+	Err error
+}
+
+// Report summarizes the integrity of the task data
+type Report struct {
+	// Files is the number of files checked
+	Files int
+	// Events is the number of history events that could be read
+	Events int
+	// Problems lists the damaged records
+	Problems []Problem
+}
+
+// OK reports whether no damage was found
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// String formats the report
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %d file(s), recovered %d event(s)\n", r.Files, r.Events)
+	if r.OK() {
+		b.WriteString("No corruption found\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d problem(s) found:\n", len(r.Problems))
+	for _, problem := range r.Problems {
+		fmt.Fprintf(&b, "  %s at offset %d: %v\n", problem.File, problem.Offset, problem.Err)
+	}
+	return b.String()
+}
+
+// Store persists the data of a task
+type Store struct {
+	mu       sync.Mutex
+	tasksDir string
+	taskID   string
+	lock     *tasklock.Lock
+}
+
+// NewStore creates a store for a task in ~/.goline/tasks
+func NewStore(taskID string) (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return NewStoreInDir(filepath.Join(homeDir, ".goline", "tasks"), taskID), nil
+}
+
+// NewStoreInDir creates a store for a task in a tasks directory
+func NewStoreInDir(tasksDir, taskID string) *Store {
+	return &Store{
+		tasksDir: tasksDir,
+		taskID:   taskID,
+	}
+}
+
+// ListTaskIDs returns the IDs of the tasks whose metadata is stored in a tasks directory, sorted.
+// A missing tasks directory has no tasks.
+func ListTaskIDs(tasksDir string) ([]string, error) {
+	entries, err := os.ReadDir(tasksDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read tasks directory: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if taskID, ok := strings.CutSuffix(entry.Name(), ".pb"); ok && !entry.IsDir() {
+			ids = append(ids, taskID)
+		}
+	}
+	return ids, nil
+}
+
+// SetLock sets the task lock checked before every write.
+// Without a lock, writes are not checked.
+func (s *Store) SetLock(lock *tasklock.Lock) {
+	s.lock = lock
+}
+
+// SaveTask writes the task metadata
+func (s *Store) SaveTask(task *pb.Task) error {
+	if err := s.lock.Validate(); err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+	if err := writeFileSync(s.taskPath(), appendFrame(nil, data)); err != nil {
+		return fmt.Errorf("failed to write task: %w", err)
+	}
+	return nil
+}
+
+// LoadTask reads the task metadata.
+// An error wrapping ErrCorrupt is returned if the metadata is damaged.
+func (s *Store) LoadTask() (*pb.Task, error) {
+	data, err := os.ReadFile(s.taskPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task: %w", err)
+	}
+
+	payload, err := readFrame(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task %s: %w", s.taskID, asCorrupt(err))
+	}
+	task := &pb.Task{}
+	if err := proto.Unmarshal(payload, task); err != nil {
+		return nil, fmt.Errorf("failed to decode task %s: %w", s.taskID, ErrCorrupt)
+	}
+	return task, nil
+}
+
+// AppendEvent appends an event to the task history and syncs it to disk
+func (s *Store) AppendEvent(event *pb.TaskEvent) error {
+	if err := s.lock.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	// Find the segment to append to
+	sequences, err := s.segments()
+	if err != nil {
+		return err
+	}
+	var sequence uint32 = 1
+	if len(sequences) > 0 {
+		sequence = sequences[len(sequences)-1]
+		if info, err := os.Stat(s.segmentPath(sequence)); err == nil && info.Size() >= segmentMaxSize {
+			sequence++
+		}
+	}
+
+	path := s.segmentPath(sequence)
+	var buf []byte
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		header, err := proto.Marshal(&pb.TaskEventBatch{TaskId: s.taskID, Sequence: sequence})
+		if err != nil {
+			return fmt.Errorf("failed to encode segment header: %w", err)
+		}
+		buf = appendFrame(buf, header)
+	}
+	buf = appendFrame(buf, data)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create task directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history segment: %w", err)
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+	return f.Close()
+}
+
+// LoadEvents reads the task history.
+// Damaged events are skipped and listed in the report, the error is only set when the
+// history cannot be read at all.
+func (s *Store) LoadEvents() ([]*pb.TaskEvent, *Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{}
+	events, err := s.loadEvents(report, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, report, nil
+}
+
+// Verify checks the task metadata and history and reports the damage found
+func (s *Store) Verify() (*Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{}
+	s.verifyTask(report)
+	if _, err := s.loadEvents(report, nil); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Repair rewrites damaged history segments with the events that can still be read.
+// The damaged files are kept next to the repaired ones with a .corrupt suffix.
+// The report lists the damage found before repairing.
+func (s *Store) Repair() (*Report, error) {
+	if err := s.lock.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{}
+	s.verifyTask(report)
+
+	recovered := make(map[uint32][]*pb.TaskEvent)
+	if _, err := s.loadEvents(report, recovered); err != nil {
+		return nil, err
+	}
+
+	damaged := make(map[string]bool)
+	for _, problem := range report.Problems {
+		damaged[problem.File] = true
+	}
+	for sequence, events := range recovered {
+		path := s.segmentPath(sequence)
+		if !damaged[path] {
+			continue
+		}
+
+		header, err := proto.Marshal(&pb.TaskEventBatch{TaskId: s.taskID, Sequence: sequence})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode segment header: %w", err)
+		}
+		buf := appendFrame(nil, header)
+		for _, event := range events {
+			data, err := proto.Marshal(event)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode event: %w", err)
+			}
+			buf = appendFrame(buf, data)
+		}
+
+		if err := copyFile(path, path+".corrupt"); err != nil {
+			return nil, fmt.Errorf("failed to back up damaged segment: %w", err)
+		}
+		if err := writeFileSync(path, buf); err != nil {
+			return nil, fmt.Errorf("failed to write repaired segment: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// verifyTask checks the task metadata
+func (s *Store) verifyTask(report *Report) {
+	if _, err := os.Stat(s.taskPath()); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	report.Files++
+	if _, err := s.LoadTask(); err != nil {
+		report.Problems = append(report.Problems, Problem{File: s.taskPath(), Err: err})
+	}
+}
+
+// loadEvents reads all history segments in order, recording damage in the report.
+// If bySegment is not nil, the recovered events of every segment are stored in it.
+func (s *Store) loadEvents(report *Report, bySegment map[uint32][]*pb.TaskEvent) ([]*pb.TaskEvent, error) {
+	sequences, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*pb.TaskEvent
+	for _, sequence := range sequences {
+		path := s.segmentPath(sequence)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history segment: %w", err)
+		}
+		report.Files++
+
+		payloads, problems := readFrames(data)
+		for _, problem := range problems {
+			report.Problems = append(report.Problems, Problem{File: path, Offset: problem.offset, Err: asCorrupt(problem.err)})
+		}
+
+		var segmentEvents []*pb.TaskEvent
+		for i, payload := range payloads {
+			if i == 0 {
+				// The header only identifies the segment
+				header := &pb.TaskEventBatch{}
+				if err := proto.Unmarshal(payload, header); err == nil && header.TaskId == s.taskID && header.Sequence == sequence {
+					continue
+				}
+			}
+			event := &pb.TaskEvent{}
+			if err := proto.Unmarshal(payload, event); err != nil || event.Id == "" {
+				report.Problems = append(report.Problems, Problem{File: path, Offset: -1, Err: fmt.Errorf("undecodable event: %w", ErrCorrupt)})
+				continue
+			}
+			segmentEvents = append(segmentEvents, event)
+		}
+
+		events = append(events, segmentEvents...)
+		if bySegment != nil {
+			bySegment[sequence] = segmentEvents
+		}
+	}
+
+	report.Events = len(events)
+	return events, nil
+}
+
+// segments returns the sequence numbers of the history segments in order
+func (s *Store) segments() ([]uint32, error) {
+	entries, err := os.ReadDir(s.taskDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read task directory: %w", err)
+	}
+
+	var sequences []uint32
+	for _, entry := range entries {
+		match := segmentPattern.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		sequence, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		sequences = append(sequences, uint32(sequence))
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+	return sequences, nil
+}
+
+// taskPath returns the path of the task metadata file
+func (s *Store) taskPath() string {
+	return filepath.Join(s.tasksDir, s.taskID+".pb")
+}
+
+// TraceDir returns the directory the provider requests of the task are recorded in with --trace-llm
+func (s *Store) TraceDir() string {
+	return filepath.Join(s.taskDir(), "trace")
+}
+
+// taskDir returns the task directory
+func (s *Store) taskDir() string {
+	return filepath.Join(s.tasksDir, s.taskID)
+}
+
+// segmentPath returns the path of a history segment
+func (s *Store) segmentPath(sequence uint32) string {
+	return filepath.Join(s.taskDir(), fmt.Sprintf("%05d.pb", sequence))
+}
+
+// asCorrupt makes a truncation error match ErrCorrupt
+func asCorrupt(err error) error {
+	if errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	return fmt.Errorf("%w (%w)", ErrCorrupt, err)
+}
+
+// writeFileSync writes a file through a temporary file and syncs it to disk
+func writeFileSync(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// copyFile copies a file
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
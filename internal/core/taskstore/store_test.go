@@ -0,0 +1,129 @@
+package taskstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func newEvent(i int) *pb.TaskEvent {
+	return &pb.TaskEvent{
+		Id:        fmt.Sprintf("event-%d", i),
+		Timestamp: "2025-01-01T00:00:00Z",
+		Event: &pb.TaskEvent_UserMessage{
+			UserMessage: &pb.UserMessage{Content: fmt.Sprintf("message %d", i)},
+		},
+	}
+}
+
+func TestTaskRoundTripAndCorruption(t *testing.T) {
+	store := NewStoreInDir(t.TempDir(), "task-1")
+
+	if err := store.SaveTask(&pb.Task{Id: "task-1", InitialPrompt: "hello", CheckpointIds: []string{"abc"}}); err != nil {
+		t.Fatalf("Failed to save task: %v", err)
+	}
+	task, err := store.LoadTask()
+	if err != nil || task.InitialPrompt != "hello" || len(task.CheckpointIds) != 1 {
+		t.Fatalf("Unexpected task %v (%v)", task, err)
+	}
+
+	// Flip a byte of the payload
+	data, err := os.ReadFile(store.taskPath())
+	if err != nil {
+		t.Fatalf("Failed to read task: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(store.taskPath(), data, 0644); err != nil {
+		t.Fatalf("Failed to write task: %v", err)
+	}
+	if _, err := store.LoadTask(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestListTaskIDs(t *testing.T) {
+	dir := t.TempDir()
+	if ids, err := ListTaskIDs(filepath.Join(dir, "missing")); err != nil || len(ids) != 0 {
+		t.Errorf("ListTaskIDs() = %v, %v for a missing directory", ids, err)
+	}
+
+	for _, id := range []string{"task-2", "task-1"} {
+		if err := NewStoreInDir(dir, id).SaveTask(&pb.Task{Id: id}); err != nil {
+			t.Fatalf("Failed to save task: %v", err)
+		}
+	}
+	// The history segments of a task are in a directory of its name
+	if err := os.Mkdir(filepath.Join(dir, "task-1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := ListTaskIDs(dir)
+	if err != nil || !slices.Equal(ids, []string{"task-1", "task-2"}) {
+		t.Errorf("ListTaskIDs() = %v, %v", ids, err)
+	}
+}
+
+func TestEventsRecoverAfterDamage(t *testing.T) {
+	store := NewStoreInDir(t.TempDir(), "task-2")
+	for i := 1; i <= 3; i++ {
+		if err := store.AppendEvent(newEvent(i)); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+
+	// Damage the second event and leave a half-written event at the end, as after a crash
+	path := store.segmentPath(1)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+	payloads, _ := readFrames(data)
+	secondEventOffset := 0
+	for i := 0; i < 2; i++ {
+		secondEventOffset += frameHeaderSize + len(payloads[i])
+	}
+	data[secondEventOffset+frameHeaderSize] ^= 0xff
+	data = append(data, appendFrame(nil, []byte("partial event"))[:frameHeaderSize+3]...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write segment: %v", err)
+	}
+
+	events, report, err := store.LoadEvents()
+	if err != nil {
+		t.Fatalf("Failed to load events: %v", err)
+	}
+	if len(events) != 2 || events[0].Id != "event-1" || events[1].Id != "event-3" {
+		t.Fatalf("Expected events 1 and 3 to be recovered, got %v", events)
+	}
+	if len(report.Problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %s", report)
+	}
+
+	// Repair keeps the readable events and a backup of the damaged segment
+	if _, err := store.Repair(); err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("Expected backup of damaged segment: %v", err)
+	}
+	report, err = store.Verify()
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if !report.OK() || report.Events != 2 {
+		t.Errorf("Expected repaired history to verify, got %s", report)
+	}
+
+	// Appending continues after the repair
+	if err := store.AppendEvent(newEvent(4)); err != nil {
+		t.Fatalf("Failed to append event: %v", err)
+	}
+	events, _, err = store.LoadEvents()
+	if err != nil || len(events) != 3 {
+		t.Errorf("Expected 3 events after append, got %d (%v)", len(events), err)
+	}
+}
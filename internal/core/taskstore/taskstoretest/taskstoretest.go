@@ -0,0 +1,25 @@
+// Package taskstoretest provides the task fixtures of the tests of the packages reading the
+// tasks directory.
+package taskstoretest
+
+import (
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/taskstore"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// SaveTask stores a task with its messages in a tasks directory
+func SaveTask(t testing.TB, tasksDir, id, updatedAt string, messages ...string) {
+	t.Helper()
+	store := taskstore.NewStoreInDir(tasksDir, id)
+	if err := store.SaveTask(&pb.Task{Id: id, UpdatedAt: updatedAt}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := taskstore.NewRecorder(store)
+	for _, message := range messages {
+		if err := recorder.RecordUserMessage(message, pb.UserMessageType_USER_MESSAGE_TYPE_ASK); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package taskstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkpointsDirName is the directory of a task holding the shadow repositories of its checkpoints
+const checkpointsDirName = "checkpoints"
+
+// Usage is the disk space used by a task
+type Usage struct {
+	// TaskID is the ID of the task
+	TaskID string
+	// Checkpoints is the size of the shadow repositories and snapshots of the checkpoints
+	Checkpoints int64
+	// Transcript is the size of the task metadata and the history segments
+	Transcript int64
+	// Other is the size of the other files, e.g. the apply journal and the task lock
+	Other int64
+	// LastModified is when a file of the task was last written
+	LastModified time.Time
+}
+
+// Total returns the disk space used by the task
+func (u Usage) Total() int64 {
+	return u.Checkpoints + u.Transcript + u.Other
+}
+
+// ScanUsage measures the disk space used by every task in a tasks directory, largest first.
+// A missing tasks directory has no tasks.
+func ScanUsage(tasksDir string) ([]Usage, error) {
+	entries, err := os.ReadDir(tasksDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read tasks directory: %w", err)
+	}
+
+	byTask := make(map[string]*Usage)
+	usage := func(taskID string) *Usage {
+		if byTask[taskID] == nil {
+			byTask[taskID] = &Usage{TaskID: taskID}
+		}
+		return byTask[taskID]
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			if err := scanTaskDir(filepath.Join(tasksDir, name), usage(name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		taskID, ok := strings.CutSuffix(name, ".pb")
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		u := usage(taskID)
+		u.Transcript += info.Size()
+		u.LastModified = latest(u.LastModified, info.ModTime())
+	}
+
+	usages := make([]Usage, 0, len(byTask))
+	for _, u := range byTask {
+		usages = append(usages, *u)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Total() != usages[j].Total() {
+			return usages[i].Total() > usages[j].Total()
+		}
+		return usages[i].TaskID < usages[j].TaskID
+	})
+	return usages, nil
+}
+
+// scanTaskDir adds the files of a task directory to its usage
+func scanTaskDir(dir string, u *Usage) error {
+	checkpointsDir := filepath.Join(dir, checkpointsDirName)
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed while scanning is not counted
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("failed to scan task directory: %w", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		switch {
+		case strings.HasPrefix(path, checkpointsDir+string(filepath.Separator)):
+			u.Checkpoints += info.Size()
+		case filepath.Dir(path) == dir && segmentPattern.MatchString(d.Name()):
+			u.Transcript += info.Size()
+		default:
+			u.Other += info.Size()
+		}
+		u.LastModified = latest(u.LastModified, info.ModTime())
+		return nil
+	})
+}
+
+// SuggestPrune returns the tasks to delete, least recently used first, to bring the total
+// usage under the quota. Tasks in keep are never suggested.
+func SuggestPrune(usages []Usage, quota int64, keep map[string]bool) []Usage {
+	var total int64
+	for _, u := range usages {
+		total += u.Total()
+	}
+	if total <= quota {
+		return nil
+	}
+
+	candidates := make([]Usage, 0, len(usages))
+	for _, u := range usages {
+		if !keep[u.TaskID] {
+			candidates = append(candidates, u)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastModified.Before(candidates[j].LastModified)
+	})
+
+	var suggested []Usage
+	for _, u := range candidates {
+		if total <= quota {
+			break
+		}
+		suggested = append(suggested, u)
+		total -= u.Total()
+	}
+	return suggested
+}
+
+// Remove deletes the metadata, the history and the checkpoints of the task
+func (s *Store) Remove() error {
+	if err := os.RemoveAll(s.taskDir()); err != nil {
+		return fmt.Errorf("failed to remove task directory: %w", err)
+	}
+	if err := os.Remove(s.taskPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove task metadata: %w", err)
+	}
+	return nil
+}
+
+// latest returns the later of two times
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
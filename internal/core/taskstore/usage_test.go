@@ -0,0 +1,89 @@
+package taskstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSized writes a file of a size with a modification time
+func writeSized(t *testing.T, path string, size int, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanUsage(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	recent := old.Add(24 * time.Hour)
+	writeSized(t, filepath.Join(dir, "task-a.pb"), 10, old)
+	writeSized(t, filepath.Join(dir, "task-a", "00001.pb"), 100, old)
+	writeSized(t, filepath.Join(dir, "task-a", "checkpoints", "0123", ".git", "objects", "ab"), 1000, recent)
+	writeSized(t, filepath.Join(dir, "task-a", "apply.journal"), 5, old)
+	writeSized(t, filepath.Join(dir, "task-b.pb"), 20, old)
+
+	usages, err := ScanUsage(dir)
+	if err != nil {
+		t.Fatalf("ScanUsage() error = %v", err)
+	}
+	if len(usages) != 2 {
+		t.Fatalf("usages = %+v, want 2 tasks", usages)
+	}
+	a := usages[0]
+	if a.TaskID != "task-a" || a.Checkpoints != 1000 || a.Transcript != 110 || a.Other != 5 || a.Total() != 1115 || !a.LastModified.Equal(recent) {
+		t.Errorf("task-a usage = %+v", a)
+	}
+	if b := usages[1]; b.TaskID != "task-b" || b.Transcript != 20 || b.Total() != 20 {
+		t.Errorf("task-b usage = %+v", b)
+	}
+
+	if usages, err := ScanUsage(filepath.Join(dir, "missing")); err != nil || usages != nil {
+		t.Errorf("ScanUsage() of a missing directory = %v, %v", usages, err)
+	}
+}
+
+func TestSuggestPrune(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	usages := []Usage{
+		{TaskID: "big-recent", Checkpoints: 500, LastModified: day(5)},
+		{TaskID: "old", Checkpoints: 100, LastModified: day(1)},
+		{TaskID: "kept", Checkpoints: 300, LastModified: day(2)},
+		{TaskID: "middle", Checkpoints: 200, LastModified: day(3)},
+	}
+
+	if got := SuggestPrune(usages, 1100, nil); got != nil {
+		t.Errorf("SuggestPrune() under the quota = %+v, want nil", got)
+	}
+
+	got := SuggestPrune(usages, 800, map[string]bool{"kept": true})
+	var ids []string
+	for _, u := range got {
+		ids = append(ids, u.TaskID)
+	}
+	if len(ids) != 2 || ids[0] != "old" || ids[1] != "middle" {
+		t.Errorf("SuggestPrune() = %v, want the least recently used tasks that are not kept", ids)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStoreInDir(dir, "task-1")
+	if err := store.AppendEvent(newEvent(1)); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+	if err := store.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if usages, _ := ScanUsage(dir); len(usages) != 0 {
+		t.Errorf("usages after Remove() = %+v", usages)
+	}
+}
@@ -0,0 +1,217 @@
+// Package templates defines the task templates: recurring workflows such as "write tests for
+// X" bundling the first message of a task with the model, the tools and the auto-approvals it
+// runs with, and the files mentioned as its context.
+//
+// Templates are the YAML files of .goline/templates in the repository and of
+// ~/.goline/templates, one file per template named after it, those of the repository hiding
+// the global ones of the same name:
+//
+//	description: Write the missing tests of a package
+//	prompt: Write table-driven tests for {{args}}, then run them and fix the failures.
+//	model: anthropic/claude-3-5-haiku-20241022
+//	tools: [read_file, list_files, search_files, write_to_file, execute_command]
+//	auto_approve:
+//	  read_files: true
+//	mentions: ["@/docs/testing.md"]
+//
+// {{args}} is replaced by the prompt given with the template, which is otherwise added after
+// the prompt of the template.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kazz187/goline/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// fileExts are the extensions of the template files, in the order they are looked up
+var fileExts = []string{".yaml", ".yml"}
+
+// argsPlaceholder is replaced by the prompt given with the template
+const argsPlaceholder = "{{args}}"
+
+// Sources of the templates
+const (
+	SourceRepo   = "repo"
+	SourceGlobal = "global"
+)
+
+// ErrNotFound is returned for a template that is not defined
+var ErrNotFound = errors.New("task template not found")
+
+// namePattern matches the valid template names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Template is a recurring workflow started as a new task
+type Template struct {
+	// Name is the name of the template, that of its file without the extension
+	Name string `yaml:"-"`
+	// Description is shown in the list of the templates
+	Description string `yaml:"description,omitempty"`
+	// Prompt is the first message of the task, with {{args}} replaced by the given prompt
+	Prompt string `yaml:"prompt"`
+	// Model is the model of the task, of another provider if prefixed with it, the configured one if empty
+	Model string `yaml:"model,omitempty"`
+	// Tools restricts the tools of the task to these, all tools if empty
+	Tools []string `yaml:"tools,omitempty"`
+	// AutoApprove lists the actions run without asking, in addition to those of the profile
+	AutoApprove config.AutoApprove `yaml:"auto_approve,omitempty"`
+	// Mentions are the mentions of the files and folders added to the first message as context, e.g. @/docs/testing.md
+	Mentions []string `yaml:"mentions,omitempty"`
+	// Source is where the template is defined, see the Source constants
+	Source string `yaml:"-"`
+}
+
+// FirstMessage returns the first message of a task started with the template and a prompt,
+// with the mentions of the template
+func (t Template) FirstMessage(prompt string) string {
+	message := strings.TrimSpace(t.Prompt)
+	prompt = strings.TrimSpace(prompt)
+	if strings.Contains(message, argsPlaceholder) {
+		message = strings.ReplaceAll(message, argsPlaceholder, prompt)
+	} else if prompt != "" {
+		message = strings.TrimSpace(message + "\n\n" + prompt)
+	}
+
+	if len(t.Mentions) > 0 {
+		mentions := make([]string, len(t.Mentions))
+		for i, mention := range t.Mentions {
+			if !strings.HasPrefix(mention, "@") {
+				mention = "@" + mention
+			}
+			mentions[i] = mention
+		}
+		message += "\n\nContext: " + strings.Join(mentions, " ")
+	}
+	return message
+}
+
+// Store reads the templates of the repository and global directories. The directories are
+// read at each lookup, so new and edited files are picked up without restarting.
+type Store struct {
+	globalDir string
+	repoDir   string
+}
+
+// NewStore creates a store of the templates in the given directories. An empty directory is not read.
+func NewStore(globalDir, repoDir string) *Store {
+	return &Store{globalDir: globalDir, repoDir: repoDir}
+}
+
+// OpenDefault creates a store of the templates in ~/.goline/templates and in
+// .goline/templates of the repository at cwd
+func OpenDefault(cwd string) *Store {
+	globalDir := ""
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		globalDir = filepath.Join(homeDir, ".goline", "templates")
+	}
+	return NewStore(globalDir, filepath.Join(cwd, ".goline", "templates"))
+}
+
+// ValidateName checks that a name can name a template file
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid task template name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// dirs returns the directories of the templates, from the highest precedence
+func (s *Store) dirs() []struct{ path, source string } {
+	return []struct{ path, source string }{{s.repoDir, SourceRepo}, {s.globalDir, SourceGlobal}}
+}
+
+// Get returns the template of a name, that of the repository if both directories have one
+func (s *Store) Get(name string) (Template, error) {
+	if err := ValidateName(name); err != nil {
+		return Template{}, err
+	}
+	for _, dir := range s.dirs() {
+		if dir.path == "" {
+			continue
+		}
+		for _, ext := range fileExts {
+			template, err := readFile(filepath.Join(dir.path, name+ext), dir.source)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return template, err
+		}
+	}
+	return Template{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// List returns the templates sorted by name, those of the repository hiding the global ones of
+// the same name. Invalid files are skipped.
+func (s *Store) List() ([]Template, error) {
+	byName := make(map[string]Template)
+	for _, dir := range s.dirs() {
+		if dir.path == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read task templates: %w", err)
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			name := strings.TrimSuffix(entry.Name(), ext)
+			if entry.IsDir() || !isTemplateExt(ext) || ValidateName(name) != nil {
+				continue
+			}
+			if _, ok := byName[name]; ok {
+				continue
+			}
+			template, err := readFile(filepath.Join(dir.path, entry.Name()), dir.source)
+			if err != nil {
+				continue
+			}
+			byName[name] = template
+		}
+	}
+
+	list := make([]Template, 0, len(byName))
+	for _, template := range byName {
+		list = append(list, template)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// isTemplateExt reports whether a file extension is that of template files
+func isTemplateExt(ext string) bool {
+	for _, fileExt := range fileExts {
+		if ext == fileExt {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile reads a template file
+func readFile(path, source string) (Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, err
+	}
+	var template Template
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		return Template{}, fmt.Errorf("invalid task template %s: %w", path, err)
+	}
+	if strings.TrimSpace(template.Prompt) == "" {
+		return Template{}, fmt.Errorf("invalid task template %s: the prompt is empty", path)
+	}
+	template.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	template.Source = source
+	return template, nil
+}
@@ -0,0 +1,98 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	globalDir, repoDir := t.TempDir(), t.TempDir()
+	writeTemplate(t, globalDir, "tests.yaml", "description: Write tests\nprompt: Write tests for {{args}}\n")
+	writeTemplate(t, globalDir, "refactor.yml", "prompt: Refactor globally\n")
+	writeTemplate(t, repoDir, "refactor.yaml", `prompt: Refactor {{args}}
+model: anthropic/claude-3-5-haiku-20241022
+tools: [read_file, replace_in_file]
+auto_approve:
+  read_files: true
+mentions: ["@/docs/style.md"]
+`)
+	writeTemplate(t, repoDir, "empty.yaml", "description: No prompt\n")
+	writeTemplate(t, repoDir, "notes.txt", "prompt: Not a template\n")
+	store := NewStore(globalDir, repoDir)
+
+	// The repository template wins over the global one
+	template, err := store.Get("refactor")
+	if err != nil {
+		t.Fatalf("Get(refactor) error = %v", err)
+	}
+	if template.Source != SourceRepo || template.Model != "anthropic/claude-3-5-haiku-20241022" ||
+		len(template.Tools) != 2 || !template.AutoApprove.ReadFiles || template.AutoApprove.EditFiles ||
+		len(template.Mentions) != 1 {
+		t.Errorf("Get(refactor) = %+v", template)
+	}
+	if template, err := store.Get("tests"); err != nil || template.Source != SourceGlobal || template.Description != "Write tests" {
+		t.Errorf("Get(tests) = %+v, %v", template, err)
+	}
+	if _, err := store.Get("empty"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(empty) error = %v, want an invalid template", err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Get("../escape"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(../escape) error = %v, want an invalid name", err)
+	}
+
+	list, err := store.List()
+	if err != nil || len(list) != 2 || list[0].Name != "refactor" || list[0].Source != SourceRepo || list[1].Name != "tests" {
+		t.Errorf("List() = %+v, %v", list, err)
+	}
+}
+
+func TestFirstMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		prompt   string
+		want     string
+	}{
+		{
+			name:     "placeholder",
+			template: Template{Prompt: "Write tests for {{args}}."},
+			prompt:   "the parser",
+			want:     "Write tests for the parser.",
+		},
+		{
+			name:     "appended prompt",
+			template: Template{Prompt: "Refactor the package."},
+			prompt:   "Keep the API.",
+			want:     "Refactor the package.\n\nKeep the API.",
+		},
+		{
+			name:     "no prompt",
+			template: Template{Prompt: "Refactor the package.\n"},
+			want:     "Refactor the package.",
+		},
+		{
+			name:     "mentions",
+			template: Template{Prompt: "Follow the guide.", Mentions: []string{"@/docs/style.md", "/README.md"}},
+			want:     "Follow the guide.\n\nContext: @/docs/style.md @/README.md",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.template.FirstMessage(tt.prompt); got != tt.want {
+				t.Errorf("FirstMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/fswatch"
+	"github.com/kazz187/goline/internal/core/ignore"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/core/shell"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxCommandOutput limits the command output sent to the AI.
+// The end of the output is kept, as that is where failures are usually summarized.
+const maxCommandOutput = 20000
+
+// Options configures watch mode
+type Options struct {
+	// Prompt is the standing instruction re-run on every change
+	Prompt string
+	// Command is an optional shell command run before the prompt, its output is sent to the AI
+	Command string
+	// Debounce is how long the workspace must be quiet before the prompt is re-run
+	Debounce time.Duration
+}
+
+// Runner re-runs a read-only prompt whenever files in the workspace change
+type Runner struct {
+	provider   provider.Provider
+	workingDir string
+	opts       Options
+	out        io.Writer
+	service    *fswatch.Service
+	watcher    *Watcher
+}
+
+// NewRunner creates a new watch mode runner writing results to out
+func NewRunner(p provider.Provider, workingDir string, opts Options, out io.Writer) (*Runner, error) {
+	ignoreController := ignore.NewController(workingDir)
+	if err := ignoreController.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize ignore controller: %w", err)
+	}
+
+	service, err := fswatch.New(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	ignore.NewWatcher(ignoreController, service).Start()
+
+	return &Runner{
+		provider:   p,
+		workingDir: workingDir,
+		opts:       opts,
+		out:        out,
+		service:    service,
+		watcher:    NewWatcher(service, ignoreController, opts.Debounce),
+	}, nil
+}
+
+// Close stops watching the workspace
+func (r *Runner) Close() error {
+	return r.service.Close()
+}
+
+// Run watches the workspace until the context is cancelled
+func (r *Runner) Run(ctx context.Context) error {
+	fmt.Fprintf(r.out, "Watching %s for changes (press Ctrl+C to stop)...\n", r.workingDir)
+
+	for {
+		changed, err := r.watcher.Next(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+
+		if err := r.runOnce(ctx, changed); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			// A failed run must not stop watching
+			fmt.Fprintf(r.out, "Error: %v\n", err)
+		}
+
+		// Changes made by the command itself (coverage files, caches, ...) must not trigger another run
+		r.watcher.Reset()
+	}
+}
+
+// runOnce runs the command and the prompt for a batch of changed files
+func (r *Runner) runOnce(ctx context.Context, changed []string) (err error) {
+	ctx, span := tracing.Start(ctx, "watch.run", attribute.Int("goline.watch.changed_files", len(changed)))
+	defer func() { tracing.End(span, err) }()
+
+	fmt.Fprintf(r.out, "\n[%s] %d file(s) changed: %s\n", time.Now().Format("15:04:05"), len(changed), strings.Join(changed, ", "))
+
+	// Run the watch command
+	var output string
+	var commandErr error
+	if r.opts.Command != "" {
+		fmt.Fprintf(r.out, "Running %s...\n", r.opts.Command)
+		output, commandErr = r.runCommand(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	// Ask the AI
+	request := prompts.FormatWatchRequest(r.opts.Prompt, changed, r.opts.Command, output, commandErr)
+	events, err := r.provider.CreateMessage(ctx, prompts.GetWatchSystemPrompt(r.workingDir), []provider.Message{
+		{Role: "user", Content: request},
+	}, provider.GenerationOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to send prompt: %w", err)
+	}
+
+	// Stream the result
+	for event := range events {
+		switch event.Type {
+		case "text":
+			fmt.Fprint(r.out, event.Text)
+		case "error":
+			fmt.Fprintf(r.out, "\nError: %s", event.Text)
+		}
+	}
+	fmt.Fprintln(r.out)
+
+	return ctx.Err()
+}
+
+// runCommand runs the watch command in the working directory and returns its combined output
+func (r *Runner) runCommand(ctx context.Context) (_ string, err error) {
+	_, span := tracing.Start(ctx, "tool.execute", tracing.AttrTool.String("execute_command"), attribute.String("goline.command", r.opts.Command))
+	defer func() { tracing.End(span, err) }()
+
+	cmd := shell.System().Command(ctx, r.opts.Command)
+	cmd.Dir = r.workingDir
+	output, err := cmd.CombinedOutput()
+
+	result := strings.ReplaceAll(string(output), "\r\n", "\n")
+	if len(result) > maxCommandOutput {
+		result = "[output truncated]\n" + result[len(result)-maxCommandOutput:]
+	}
+	return result, err
+}
@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/fswatch"
+	"github.com/kazz187/goline/internal/core/ignore"
+)
+
+// Watcher reports the files changed in a workspace in debounced batches, leaving out the
+// files ignored by .golineignore
+type Watcher struct {
+	unsubscribe func()
+	// changes is signaled when changed is not empty
+	changes chan struct{}
+
+	mu      sync.Mutex
+	changed map[string]bool
+}
+
+// NewWatcher creates a new watcher of the workspace watched by service.
+// Changes are reported once no further change was seen for the debounce duration.
+func NewWatcher(service *fswatch.Service, ignoreController *ignore.Controller, debounce time.Duration) *Watcher {
+	w := &Watcher{
+		changes: make(chan struct{}, 1),
+		changed: make(map[string]bool),
+	}
+	w.unsubscribe = service.Subscribe(ignoreController.ValidateAccess, debounce, w.add)
+	return w
+}
+
+// add records a batch of changed paths
+func (w *Watcher) add(paths []string) {
+	w.mu.Lock()
+	for _, path := range paths {
+		w.changed[path] = true
+	}
+	w.mu.Unlock()
+	select {
+	case w.changes <- struct{}{}:
+	default:
+	}
+}
+
+// Reset forgets the changes that were not reported yet
+func (w *Watcher) Reset() {
+	w.mu.Lock()
+	w.changed = make(map[string]bool)
+	w.mu.Unlock()
+}
+
+// Next blocks until files change and returns the changed paths, relative to the working directory
+func (w *Watcher) Next(ctx context.Context) ([]string, error) {
+	for {
+		w.mu.Lock()
+		if len(w.changed) > 0 {
+			result := make([]string, 0, len(w.changed))
+			for path := range w.changed {
+				result = append(result, path)
+			}
+			w.changed = make(map[string]bool)
+			w.mu.Unlock()
+			sort.Strings(result)
+			return result, nil
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.changes:
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() {
+	w.unsubscribe()
+}
@@ -0,0 +1,57 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/fswatch"
+	"github.com/kazz187/goline/internal/core/ignore"
+)
+
+func TestWatcherNext(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Ignore secrets
+	if err := os.WriteFile(filepath.Join(tempDir, ".golineignore"), []byte("*.secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .golineignore file: %v", err)
+	}
+	controller := ignore.NewController(tempDir)
+	if err := controller.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize controller: %v", err)
+	}
+
+	service, err := fswatch.New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to watch the workspace: %v", err)
+	}
+	defer service.Close()
+	watcher := NewWatcher(service, controller, 50*time.Millisecond)
+	defer watcher.Close()
+
+	// Change files in several steps within the debounce window
+	go func() {
+		os.WriteFile(filepath.Join(tempDir, "a.go"), []byte("package a"), 0644)
+		time.Sleep(20 * time.Millisecond)
+		os.MkdirAll(filepath.Join(tempDir, "sub"), 0755)
+		os.WriteFile(filepath.Join(tempDir, "sub", "b.go"), []byte("package b"), 0644)
+		os.WriteFile(filepath.Join(tempDir, "key.secret"), []byte("secret"), 0644)
+		os.MkdirAll(filepath.Join(tempDir, ".git"), 0755)
+		os.WriteFile(filepath.Join(tempDir, ".git", "index"), []byte("index"), 0644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changed, err := watcher.Next(ctx)
+	if err != nil {
+		t.Fatalf("Failed to wait for changes: %v", err)
+	}
+
+	expected := []string{"a.go", "sub/b.go"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changed)
+	}
+}
@@ -0,0 +1,99 @@
+// Package workspace identifies the repository a task works on, so that the tasks of a
+// repository can be listed and a task is not resumed against another directory.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// originRemote is the remote whose URL identifies the repository
+const originRemote = "origin"
+
+// Workspace is the repository a task works on
+type Workspace struct {
+	// Root is the top-level directory of the git repository, or the working directory outside
+	// repositories
+	Root string
+	// RepositoryURL is the URL of the origin remote of the repository, empty if it has none
+	RepositoryURL string
+}
+
+// Detect returns the workspace of a working directory. A directory outside git repositories
+// is its own workspace.
+func Detect(dir string) (Workspace, error) {
+	dir, err := canonical(dir)
+	if err != nil {
+		return Workspace{}, err
+	}
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return Workspace{Root: dir}, nil
+	}
+	if err != nil {
+		return Workspace{}, fmt.Errorf("failed to open the repository of %s: %w", dir, err)
+	}
+	w := Workspace{Root: dir}
+	if worktree, err := repo.Worktree(); err == nil {
+		if w.Root, err = canonical(worktree.Filesystem.Root()); err != nil {
+			return Workspace{}, err
+		}
+	}
+	if remote, err := repo.Remote(originRemote); err == nil && len(remote.Config().URLs) > 0 {
+		w.RepositoryURL = remote.Config().URLs[0]
+	}
+	return w, nil
+}
+
+// Of returns the workspace recorded in a task. Tasks created before workspaces were recorded
+// have their working directory as workspace.
+func Of(task *pb.Task) Workspace {
+	w := Workspace{Root: task.GetWorkspaceRoot(), RepositoryURL: task.GetRepositoryUrl()}
+	if w.Root == "" {
+		w.Root = task.GetWorkingDirectory()
+	}
+	return w
+}
+
+// Record records the workspace in a task
+func (w Workspace) Record(task *pb.Task) {
+	task.WorkspaceRoot = w.Root
+	task.RepositoryUrl = w.RepositoryURL
+}
+
+// Contains reports whether the workspace of a task is this workspace. A task without a
+// recorded workspace belongs to no workspace.
+func (w Workspace) Contains(task *pb.Task) bool {
+	root := Of(task).Root
+	if root == "" {
+		return false
+	}
+	if root == w.Root {
+		return true
+	}
+	// The recorded root may be a path through symbolic links, e.g. written by an older version
+	resolved, err := canonical(root)
+	return err == nil && resolved == w.Root
+}
+
+// canonical returns the absolute path of a directory with its symbolic links resolved, so
+// that the paths of a workspace compare equal however it was reached
+func canonical(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		return abs, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
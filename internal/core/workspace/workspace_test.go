@@ -0,0 +1,67 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+func TestDetect(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@github.com:kazz187/goline.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "internal", "core")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := Detect(sub)
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if w.Root != root || w.RepositoryURL != "git@github.com:kazz187/goline.git" {
+		t.Errorf("Detect() = %+v, want the repository root and its origin", w)
+	}
+
+	task := &pb.Task{WorkingDirectory: sub}
+	w.Record(task)
+	if !w.Contains(task) {
+		t.Error("Contains() = false for a task recorded in the workspace")
+	}
+	if other := (Workspace{Root: t.TempDir()}); other.Contains(task) {
+		t.Error("Contains() = true for a task of another workspace")
+	}
+	// Older tasks only have their working directory
+	if !(Workspace{Root: root}).Contains(&pb.Task{WorkingDirectory: root}) {
+		t.Error("Contains() = false for an older task in the workspace root")
+	}
+	if (Workspace{Root: root}).Contains(&pb.Task{}) {
+		t.Error("Contains() = true for a task without directory")
+	}
+}
+
+func TestDetectOutsideRepository(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := Detect(dir)
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if w.Root != dir || w.RepositoryURL != "" {
+		t.Errorf("Detect() = %+v, want the directory as workspace", w)
+	}
+}
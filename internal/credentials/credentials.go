@@ -0,0 +1,77 @@
+// Package credentials stores secrets such as API keys outside of the configuration file.
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Service is the service name secrets are stored under
+const Service = "goline"
+
+// Backend names
+const (
+	// BackendAuto uses the OS keychain when it is available and works, and the encrypted file
+	// otherwise
+	BackendAuto = "auto"
+	// BackendKeychain uses the OS keychain (macOS Keychain, Linux Secret Service, Windows Credential Manager)
+	BackendKeychain = "keychain"
+	// BackendFile uses an encrypted file in the goline directory
+	BackendFile = "file"
+)
+
+var (
+	// ErrNotFound is returned when no secret is stored for an account
+	ErrNotFound = errors.New("credential not found")
+	// ErrUnavailable is returned when a backend cannot be used on this system
+	ErrUnavailable = errors.New("credential backend is not available")
+)
+
+// Store stores secrets by account name
+type Store interface {
+	// Name returns the backend name
+	Name() string
+	// Get returns the secret of an account
+	Get(account string) (string, error)
+	// Set stores the secret of an account
+	Set(account, secret string) error
+	// Delete removes the secret of an account
+	Delete(account string) error
+}
+
+// probeAccount is the account looked up to check that the keychain works, never stored
+const probeAccount = "goline-probe"
+
+// Open opens a credential store by backend name
+func Open(backend string) (Store, error) {
+	switch backend {
+	case "", BackendAuto:
+		if store, err := newKeychain(); err == nil && keychainWorks(store) {
+			return store, nil
+		}
+		return NewFileStore("")
+	case BackendKeychain:
+		store, err := newKeychain()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open keychain: %w", err)
+		}
+		return store, nil
+	case BackendFile:
+		return NewFileStore("")
+	default:
+		return nil, fmt.Errorf("unknown credential backend: %s", backend)
+	}
+}
+
+// keychainWorks reports whether the keychain can be read, by looking up an account that is
+// never stored. The keychain tools can be installed without working, e.g. secret-tool without
+// a running Secret Service on a headless machine.
+func keychainWorks(store Store) bool {
+	_, err := store.Get(probeAccount)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		slog.Warn("The OS keychain is not working, using the encrypted file", "error", err)
+		return false
+	}
+	return true
+}
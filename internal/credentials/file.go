@@ -0,0 +1,255 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase of the encrypted file store.
+// Without a passphrase, a random key is kept in a key file readable only by the user.
+const PassphraseEnv = "GOLINE_CREDENTIALS_PASSPHRASE"
+
+// Key derivation
+const (
+	keySize      = 32
+	saltSize     = 16
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	kdfScrypt    = "scrypt"
+	kdfKeyFile   = "keyfile"
+	fileVersion1 = 1
+)
+
+// encryptedFile is the format of the encrypted credentials file
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileStore stores secrets in a file encrypted with AES-256-GCM
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	keyPath string
+}
+
+// NewFileStore creates a file store at path, or at ~/.goline/credentials.enc if path is empty
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, ".goline", "credentials.enc")
+	}
+
+	return &FileStore{
+		path:    path,
+		keyPath: filepath.Join(filepath.Dir(path), "credentials.key"),
+	}, nil
+}
+
+// Name returns the backend name
+func (s *FileStore) Name() string {
+	return BackendFile
+}
+
+// Get returns the secret of an account
+func (s *FileStore) Get(account string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores the secret of an account
+func (s *FileStore) Set(account, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[account] = secret
+	return s.save(secrets)
+}
+
+// Delete removes the secret of an account
+func (s *FileStore) Delete(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[account]; !ok {
+		return ErrNotFound
+	}
+	delete(secrets, account)
+	return s.save(secrets)
+}
+
+// load decrypts the stored secrets
+func (s *FileStore) load() (map[string]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string]string), nil
+		}
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+	if file.Version != fileVersion1 {
+		return nil, fmt.Errorf("unsupported credentials file version: %d", file.Version)
+	}
+
+	key, err := s.key(file.KDF, file.Salt, false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt credentials file, the passphrase or key file is wrong")
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	return secrets, nil
+}
+
+// save encrypts and writes the secrets
+func (s *FileStore) save(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	file := encryptedFile{
+		Version: fileVersion1,
+		KDF:     kdfKeyFile,
+	}
+	if os.Getenv(PassphraseEnv) != "" {
+		file.KDF = kdfScrypt
+		file.Salt = make([]byte, saltSize)
+		if _, err := rand.Read(file.Salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+
+	key, err := s.key(file.KDF, file.Salt, true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+
+	// Write through a temporary file so a failed write never loses the stored secrets
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	return nil
+}
+
+// key returns the encryption key for a key derivation method.
+// The key file is created when create is true and it does not exist yet.
+func (s *FileStore) key(kdf string, salt []byte, create bool) ([]byte, error) {
+	switch kdf {
+	case kdfScrypt:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("credentials file is protected by a passphrase, set %s", PassphraseEnv)
+		}
+		key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return key, nil
+	case kdfKeyFile:
+		key, err := os.ReadFile(s.keyPath)
+		if err == nil {
+			if len(key) != keySize {
+				return nil, fmt.Errorf("invalid key file: %s", s.keyPath)
+			}
+			return key, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || !create {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(s.keyPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create credentials directory: %w", err)
+		}
+		if err := os.WriteFile(s.keyPath, key, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write key file: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown key derivation: %s", kdf)
+	}
+}
+
+// newGCM creates an AES-GCM cipher
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
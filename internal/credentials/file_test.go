@@ -0,0 +1,69 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	if _, err := store.Get("anthropic"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Set("anthropic", "sk-secret-key"); err != nil {
+		t.Fatalf("Failed to set secret: %v", err)
+	}
+	secret, err := store.Get("anthropic")
+	if err != nil || secret != "sk-secret-key" {
+		t.Fatalf("Expected stored secret, got %q (%v)", secret, err)
+	}
+
+	// The secret is never written in plain text
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read credentials file: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret-key") {
+		t.Error("Credentials file contains the plain text secret")
+	}
+
+	if err := store.Delete("anthropic"); err != nil {
+		t.Fatalf("Failed to delete secret: %v", err)
+	}
+	if _, err := store.Get("anthropic"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestFileStorePassphrase(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	if err := store.Set("deepseek", "secret"); err != nil {
+		t.Fatalf("Failed to set secret: %v", err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := store.Get("deepseek"); err == nil {
+		t.Error("Expected an error with a wrong passphrase")
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	if secret, err := store.Get("deepseek"); err != nil || secret != "secret" {
+		t.Errorf("Expected stored secret, got %q (%v)", secret, err)
+	}
+}
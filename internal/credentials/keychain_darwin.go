@@ -0,0 +1,68 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityNotFound is the exit code of the security command when an item does not exist
+const securityNotFound = 44
+
+// keychain stores secrets in the macOS Keychain using the security command
+type keychain struct{}
+
+// newKeychain returns the macOS Keychain store
+func newKeychain() (Store, error) {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, ErrUnavailable
+	}
+	return keychain{}, nil
+}
+
+// Name returns the backend name
+func (keychain) Name() string {
+	return BackendKeychain
+}
+
+// Get returns the secret of an account
+func (keychain) Get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set stores the secret of an account.
+// The secret is passed through stdin in interactive mode so it never appears in the process list.
+func (keychain) Set(account, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", Service, account, hex.EncodeToString([]byte(secret))))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store credential in keychain: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Delete removes the secret of an account
+func (keychain) Delete(account string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", Service, "-a", account).Run(); err != nil {
+		return securityError(err)
+	}
+	return nil
+}
+
+// securityError converts an error of the security command
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("keychain access failed: %w", err)
+}
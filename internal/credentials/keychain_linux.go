@@ -0,0 +1,64 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychain stores secrets with the Secret Service (GNOME Keyring, KWallet) using secret-tool
+type keychain struct{}
+
+// newKeychain returns the Secret Service store
+func newKeychain() (Store, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, ErrUnavailable
+	}
+	return keychain{}, nil
+}
+
+// Name returns the backend name
+func (keychain) Name() string {
+	return BackendKeychain
+}
+
+// Get returns the secret of an account
+func (keychain) Get(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() == 0 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("secret service access failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Set stores the secret of an account, the secret is passed through stdin
+func (keychain) Set(account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%s: %s", Service, account), "service", Service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store credential in secret service: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Delete removes the secret of an account
+func (keychain) Delete(account string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to delete credential from secret service: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
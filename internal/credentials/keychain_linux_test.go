@@ -0,0 +1,36 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAutoFallsBackWhenSecretServiceFails(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// secret-tool is installed, but no Secret Service is running
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho 'Cannot autolaunch D-Bus without X11 $DISPLAY' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	store, err := Open(BackendAuto)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if store.Name() != BackendFile {
+		t.Errorf("Open(auto) = %s, want the encrypted file", store.Name())
+	}
+
+	// A working Secret Service without the account is used
+	script = "#!/bin/sh\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if store, err := Open(BackendAuto); err != nil || store.Name() != BackendKeychain {
+		t.Errorf("Open(auto) = %v (%v), want the keychain", store, err)
+	}
+}
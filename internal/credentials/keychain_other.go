@@ -0,0 +1,8 @@
+//go:build !darwin && !linux && !windows
+
+package credentials
+
+// newKeychain reports that no OS keychain is supported on this platform
+func newKeychain() (Store, error) {
+	return nil, ErrUnavailable
+}
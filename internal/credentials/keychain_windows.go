@@ -0,0 +1,132 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Windows Credential Manager constants
+const (
+	credTypeGeneric          = 1
+	credPersistLocalMachine  = 2
+	errorNotFound            = syscall.Errno(1168)
+	credentialMaxBlobSize    = 5 * 512
+	credentialTargetTemplate = "%s:%s"
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential mirrors the CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keychain stores secrets in the Windows Credential Manager
+type keychain struct{}
+
+// newKeychain returns the Windows Credential Manager store
+func newKeychain() (Store, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, ErrUnavailable
+	}
+	return keychain{}, nil
+}
+
+// Name returns the backend name
+func (keychain) Name() string {
+	return BackendKeychain
+}
+
+// Get returns the secret of an account
+func (keychain) Get(account string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(fmt.Sprintf(credentialTargetTemplate, Service, account))
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		return "", credentialError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// Set stores the secret of an account
+func (keychain) Set(account, secret string) error {
+	if len(secret) > credentialMaxBlobSize {
+		return fmt.Errorf("credential is too large for the credential manager: %d bytes", len(secret))
+	}
+	target, err := syscall.UTF16PtrFromString(fmt.Sprintf(credentialTargetTemplate, Service, account))
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		UserName:           userName,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+
+	ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return fmt.Errorf("failed to store credential in credential manager: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the secret of an account
+func (keychain) Delete(account string) error {
+	target, err := syscall.UTF16PtrFromString(fmt.Sprintf(credentialTargetTemplate, Service, account))
+	if err != nil {
+		return err
+	}
+
+	ret, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 {
+		return credentialError(err)
+	}
+	return nil
+}
+
+// credentialError converts an error of the credential manager
+func credentialError(err error) error {
+	if errors.Is(err, errorNotFound) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("credential manager access failed: %w", err)
+}
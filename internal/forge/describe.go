@@ -0,0 +1,58 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// maxTranscriptSize limits the transcript sent to the AI to describe a pull request. The start
+// of longer transcripts, with the task, and their end, with the result, are kept.
+const maxTranscriptSize = 60000
+
+// descriptionSchema is the structured response asked to the AI for a pull request description
+var descriptionSchema = provider.Schema{
+	Name:        "pull_request",
+	Description: "Write the title and the description of a pull request for the changes made by an AI coding assistant during a task, from the transcript of the task and the summary of the changes. The title summarizes the changes in at most 72 characters. The body is Markdown: a short summary of what changed and why, a list of the notable changes, and how the changes were verified if the transcript shows it. Do not mention the assistant or the transcript.",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "title": {"type": "string"},
+    "body": {"type": "string"}
+  },
+  "required": ["title", "body"]
+}`),
+}
+
+// Description is the title and body of a pull request
+type Description struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Describe asks the AI for the description of the pull request of a task, from the transcript
+// of the task and the summary of its changes, such as the commits and the files changed
+func Describe(ctx context.Context, p provider.Provider, transcript, changes string) (Description, provider.Usage, error) {
+	if len(transcript) > maxTranscriptSize {
+		head := maxTranscriptSize / 3
+		transcript = transcript[:head] + "\n\n[transcript truncated]\n\n" + transcript[len(transcript)-(maxTranscriptSize-head):]
+	}
+
+	var description Description
+	usage, err := provider.CreateStructured(ctx, p, descriptionSchema, []provider.Message{
+		{Role: "user", Content: fmt.Sprintf("<transcript>\n%s\n</transcript>\n\n<changes>\n%s\n</changes>", transcript, changes)},
+	}, &description)
+	if err != nil {
+		return Description{}, usage, fmt.Errorf("failed to generate the pull request description: %w", err)
+	}
+	description.Title = strings.TrimSpace(description.Title)
+	description.Body = strings.TrimSpace(description.Body)
+	if description.Title == "" {
+		return Description{}, usage, errors.New("failed to generate the pull request description: the title is empty")
+	}
+	return description, usage, nil
+}
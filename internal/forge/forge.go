@@ -0,0 +1,273 @@
+// Package forge talks to the code hosts repositories are pushed to, GitHub and GitLab, to
+// open pull requests and read issues.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Forge types
+const (
+	// TypeGitHub is GitHub or GitHub Enterprise
+	TypeGitHub = "github"
+	// TypeGitLab is GitLab, hosted or self-managed
+	TypeGitLab = "gitlab"
+)
+
+// Types returns the names of the forge types
+func Types() []string {
+	return []string{TypeGitHub, TypeGitLab}
+}
+
+// DetectType guesses the type of the forge of a host from its name, GitHub unless the name
+// mentions GitLab
+func DetectType(host string) string {
+	if strings.Contains(strings.ToLower(host), "gitlab") {
+		return TypeGitLab
+	}
+	return TypeGitHub
+}
+
+// PullRequest is a pull request to open, a merge request on GitLab
+type PullRequest struct {
+	// Title is the title of the pull request
+	Title string
+	// Body is the description of the pull request, in Markdown
+	Body string
+	// Head is the branch with the changes
+	Head string
+	// Base is the branch the changes are merged into
+	Base string
+	// Draft opens the pull request as a draft
+	Draft bool
+}
+
+// Forge is the API of a code host
+type Forge interface {
+	// Type returns the type of the forge
+	Type() string
+	// CreatePullRequest opens a pull request on a repository and returns its URL
+	CreatePullRequest(ctx context.Context, repo Repository, pr PullRequest) (string, error)
+	// GetIssue returns an issue of a repository with its comments
+	GetIssue(ctx context.Context, repo Repository, number int) (Issue, error)
+}
+
+// maxComments limits the comments of an issue fetched
+const maxComments = 100
+
+// New creates the client of a forge of a host. The API URL is derived from the host if empty.
+func New(forgeType, host, apiURL, token string) (Forge, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch forgeType {
+	case TypeGitHub:
+		if apiURL == "" {
+			apiURL = "https://" + host + "/api/v3"
+			if host == "github.com" {
+				apiURL = "https://api.github.com"
+			}
+		}
+		return &GitHub{HTTPClient: client, BaseURL: strings.TrimSuffix(apiURL, "/"), Token: token}, nil
+	case TypeGitLab:
+		if apiURL == "" {
+			apiURL = "https://" + host + "/api/v4"
+		}
+		return &GitLab{HTTPClient: client, BaseURL: strings.TrimSuffix(apiURL, "/"), Token: token}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge type %q, expected one of %s", forgeType, strings.Join(Types(), ", "))
+	}
+}
+
+// GitHub is the client of the GitHub REST API
+type GitHub struct {
+	// HTTPClient sends the requests
+	HTTPClient *http.Client
+	// BaseURL is the URL of the API, e.g. https://api.github.com
+	BaseURL string
+	// Token is the personal access token authenticating the requests
+	Token string
+}
+
+// Type implements Forge
+func (g *GitHub) Type() string {
+	return TypeGitHub
+}
+
+// CreatePullRequest implements Forge
+func (g *GitHub) CreatePullRequest(ctx context.Context, repo Repository, pr PullRequest) (string, error) {
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := send(ctx, g.HTTPClient, g.header, http.MethodPost, fmt.Sprintf("%s/repos/%s/pulls", g.BaseURL, repo.Path), map[string]any{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"draft": pr.Draft,
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+	return created.HTMLURL, nil
+}
+
+// GetIssue implements Forge
+func (g *GitHub) GetIssue(ctx context.Context, repo Repository, number int) (Issue, error) {
+	type user struct {
+		Login string `json:"login"`
+	}
+	var issue struct {
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+		User    user   `json:"user"`
+	}
+	issueURL := fmt.Sprintf("%s/repos/%s/issues/%d", g.BaseURL, repo.Path, number)
+	if err := send(ctx, g.HTTPClient, g.header, http.MethodGet, issueURL, nil, &issue); err != nil {
+		return Issue{}, fmt.Errorf("failed to get issue %s#%d: %w", repo.Path, number, err)
+	}
+	var comments []struct {
+		Body string `json:"body"`
+		User user   `json:"user"`
+	}
+	if err := send(ctx, g.HTTPClient, g.header, http.MethodGet, fmt.Sprintf("%s/comments?per_page=%d", issueURL, maxComments), nil, &comments); err != nil {
+		return Issue{}, fmt.Errorf("failed to get the comments of issue %s#%d: %w", repo.Path, number, err)
+	}
+
+	result := Issue{Number: number, Title: issue.Title, Body: issue.Body, URL: issue.HTMLURL, Author: issue.User.Login}
+	for _, comment := range comments {
+		result.Comments = append(result.Comments, Comment{Author: comment.User.Login, Body: comment.Body})
+	}
+	return result, nil
+}
+
+// header sets the headers of a GitHub API request
+func (g *GitHub) header(h http.Header) {
+	h.Set("Accept", "application/vnd.github+json")
+	h.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		h.Set("Authorization", "Bearer "+g.Token)
+	}
+}
+
+// GitLab is the client of the GitLab REST API
+type GitLab struct {
+	// HTTPClient sends the requests
+	HTTPClient *http.Client
+	// BaseURL is the URL of the API, e.g. https://gitlab.com/api/v4
+	BaseURL string
+	// Token is the personal access token authenticating the requests
+	Token string
+}
+
+// Type implements Forge
+func (g *GitLab) Type() string {
+	return TypeGitLab
+}
+
+// CreatePullRequest implements Forge, opening a merge request
+func (g *GitLab) CreatePullRequest(ctx context.Context, repo Repository, pr PullRequest) (string, error) {
+	title := pr.Title
+	if pr.Draft {
+		title = "Draft: " + title
+	}
+	var created struct {
+		WebURL string `json:"web_url"`
+	}
+	err := send(ctx, g.HTTPClient, g.header, http.MethodPost, fmt.Sprintf("%s/projects/%s/merge_requests", g.BaseURL, url.PathEscape(repo.Path)), map[string]any{
+		"title":         title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create merge request: %w", err)
+	}
+	return created.WebURL, nil
+}
+
+// GetIssue implements Forge
+func (g *GitLab) GetIssue(ctx context.Context, repo Repository, number int) (Issue, error) {
+	type user struct {
+		Username string `json:"username"`
+	}
+	var issue struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		WebURL      string `json:"web_url"`
+		Author      user   `json:"author"`
+	}
+	issueURL := fmt.Sprintf("%s/projects/%s/issues/%d", g.BaseURL, url.PathEscape(repo.Path), number)
+	if err := send(ctx, g.HTTPClient, g.header, http.MethodGet, issueURL, nil, &issue); err != nil {
+		return Issue{}, fmt.Errorf("failed to get issue %s#%d: %w", repo.Path, number, err)
+	}
+	var notes []struct {
+		Body   string `json:"body"`
+		System bool   `json:"system"`
+		Author user   `json:"author"`
+	}
+	if err := send(ctx, g.HTTPClient, g.header, http.MethodGet, fmt.Sprintf("%s/notes?sort=asc&per_page=%d", issueURL, maxComments), nil, &notes); err != nil {
+		return Issue{}, fmt.Errorf("failed to get the comments of issue %s#%d: %w", repo.Path, number, err)
+	}
+
+	result := Issue{Number: number, Title: issue.Title, Body: issue.Description, URL: issue.WebURL, Author: issue.Author.Username}
+	for _, note := range notes {
+		// System notes record events such as label changes
+		if note.System {
+			continue
+		}
+		result.Comments = append(result.Comments, Comment{Author: note.Author.Username, Body: note.Body})
+	}
+	return result, nil
+}
+
+// header sets the headers of a GitLab API request
+func (g *GitLab) header(h http.Header) {
+	if g.Token != "" {
+		h.Set("PRIVATE-TOKEN", g.Token)
+	}
+}
+
+// maxErrorBody limits the part of an error response reported
+const maxErrorBody = 1000
+
+// send sends a JSON API request and decodes its JSON response into out
+func send(ctx context.Context, client *http.Client, header func(http.Header), method, url string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	header(req.Header)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response: %w", err)
+	}
+	return nil
+}
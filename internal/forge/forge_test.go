@@ -0,0 +1,146 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   Repository
+	}{
+		{"https://github.com/kazz187/goline.git", Repository{Host: "github.com", Path: "kazz187/goline"}},
+		{"https://github.com/kazz187/goline", Repository{Host: "github.com", Path: "kazz187/goline"}},
+		{"git@github.com:kazz187/goline.git", Repository{Host: "github.com", Path: "kazz187/goline"}},
+		{"ssh://git@gitlab.example.com:2222/group/sub/project.git", Repository{Host: "gitlab.example.com", Path: "group/sub/project"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRemote(tt.remote)
+		if err != nil {
+			t.Errorf("ParseRemote(%q) failed: %v", tt.remote, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRemote(%q) = %+v, want %+v", tt.remote, got, tt.want)
+		}
+	}
+
+	for _, remote := range []string{"/srv/git/goline.git", "../goline", "https://github.com/"} {
+		if _, err := ParseRemote(remote); err == nil {
+			t.Errorf("ParseRemote(%q) succeeded, want an error", remote)
+		}
+	}
+}
+
+func TestGitHubCreatePullRequest(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/kazz187/goline/pulls" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/kazz187/goline/pull/1"}`))
+	}))
+	defer server.Close()
+
+	client, err := New(TypeGitHub, "github.com", server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := client.CreatePullRequest(context.Background(), Repository{Host: "github.com", Path: "kazz187/goline"}, PullRequest{
+		Title: "Add export", Body: "Details", Head: "goline/1", Base: "main", Draft: true,
+	})
+	if err != nil {
+		t.Fatalf("CreatePullRequest failed: %v", err)
+	}
+	if url != "https://github.com/kazz187/goline/pull/1" {
+		t.Errorf("url = %q", url)
+	}
+	if got["title"] != "Add export" || got["head"] != "goline/1" || got["base"] != "main" || got["draft"] != true {
+		t.Errorf("unexpected request body %v", got)
+	}
+}
+
+func TestGitLabCreatePullRequest(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/projects/group%2Fproject/merge_requests" {
+			t.Errorf("unexpected path %s", r.URL.EscapedPath())
+		}
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "secret" {
+			t.Errorf("PRIVATE-TOKEN = %q", token)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"web_url": "https://gitlab.com/group/project/-/merge_requests/1"}`))
+	}))
+	defer server.Close()
+
+	client, err := New(TypeGitLab, "gitlab.com", server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := client.CreatePullRequest(context.Background(), Repository{Host: "gitlab.com", Path: "group/project"}, PullRequest{
+		Title: "Add export", Head: "goline/1", Base: "main", Draft: true,
+	})
+	if err != nil {
+		t.Fatalf("CreatePullRequest failed: %v", err)
+	}
+	if url != "https://gitlab.com/group/project/-/merge_requests/1" {
+		t.Errorf("url = %q", url)
+	}
+	if got["title"] != "Draft: Add export" || got["source_branch"] != "goline/1" || got["target_branch"] != "main" {
+		t.Errorf("unexpected request body %v", got)
+	}
+}
+
+func TestCreatePullRequestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Validation Failed"}`, http.StatusUnprocessableEntity)
+	}))
+	defer server.Close()
+
+	client, err := New(TypeGitHub, "github.com", server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CreatePullRequest(context.Background(), Repository{Host: "github.com", Path: "kazz187/goline"}, PullRequest{Title: "x"})
+	if err == nil || !strings.Contains(err.Error(), "Validation Failed") {
+		t.Errorf("err = %v, want the message of the response", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	p := mock.New(&mock.Fixture{Responses: []mock.Response{{Text: `{"title": " Add the export command ", "body": "Exports transcripts."}`}}})
+	transcript := "start" + strings.Repeat("x", maxTranscriptSize) + "end"
+	description, _, err := Describe(context.Background(), p, transcript, "Commits:\n- feat: add export\n")
+	if err != nil {
+		t.Fatalf("Describe failed: %v", err)
+	}
+	if description.Title != "Add the export command" || description.Body != "Exports transcripts." {
+		t.Errorf("unexpected description %+v", description)
+	}
+
+	messages := p.Requests()[0].Messages
+	sent := messages[len(messages)-1].Content
+	if !strings.Contains(sent, "start") || !strings.Contains(sent, "end") || !strings.Contains(sent, "[transcript truncated]") {
+		t.Error("the transcript should be truncated in the middle")
+	}
+	if !strings.Contains(sent, "feat: add export") {
+		t.Error("the changes should be sent")
+	}
+}
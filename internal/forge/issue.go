@@ -0,0 +1,130 @@
+package forge
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Issue is an issue of a repository with its discussion
+type Issue struct {
+	// Number is the number of the issue in its repository
+	Number int
+	// Title is the title of the issue
+	Title string
+	// Body is the description of the issue, in Markdown
+	Body string
+	// URL is the web page of the issue
+	URL string
+	// Author is the user name of the author of the issue
+	Author string
+	// Comments are the comments of the issue, oldest first
+	Comments []Comment
+}
+
+// Comment is a comment of an issue
+type Comment struct {
+	// Author is the user name of the author of the comment
+	Author string
+	// Body is the text of the comment, in Markdown
+	Body string
+}
+
+// shortIssueRegex matches the owner/repo#123 form of issue references
+var shortIssueRegex = regexp.MustCompile(`^([\w.-]+(?:/[\w.-]+)+)#(\d+)$`)
+
+// ParseIssue parses a reference to an issue, either its URL, e.g.
+// https://github.com/owner/repo/issues/123 or https://gitlab.com/group/project/-/issues/123,
+// or the owner/repo#123 form, in which case the host of the repository is empty
+func ParseIssue(ref string) (Repository, int, error) {
+	ref = strings.TrimSpace(ref)
+	if m := shortIssueRegex.FindStringSubmatch(ref); m != nil {
+		number, err := strconv.Atoi(m[2])
+		if err != nil {
+			return Repository{}, 0, fmt.Errorf("invalid issue number in %q: %w", ref, err)
+		}
+		return Repository{Path: m[1]}, number, nil
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return Repository{}, 0, fmt.Errorf("invalid issue %q, expected the URL of an issue or owner/repo#123", ref)
+	}
+	path, number, ok := strings.Cut(strings.Trim(u.Path, "/"), "/issues/")
+	path = strings.TrimSuffix(path, "/-")
+	n, err := strconv.Atoi(strings.TrimSuffix(number, "/"))
+	if !ok || err != nil || !strings.Contains(path, "/") {
+		return Repository{}, 0, fmt.Errorf("invalid issue URL %q, expected e.g. https://github.com/owner/repo/issues/123", ref)
+	}
+	return Repository{Host: u.Hostname(), Path: path}, n, nil
+}
+
+// pathRegex matches text that looks like the path of a file, e.g. internal/tui/repl.go
+var pathRegex = regexp.MustCompile(`[\w.-]+(?:/[\w.-]+)*\.\w+`)
+
+// blobRegex matches links to files of a repository, e.g.
+// https://github.com/owner/repo/blob/main/internal/tui/repl.go#L10, capturing the path
+var blobRegex = regexp.MustCompile(`/blob/[^/\s]+/([^\s#?)\]>"']+)`)
+
+// FileMentions returns the mentions of the files of the working directory that the issue refers
+// to, by their path or by a link to them
+func (i Issue) FileMentions(workingDir string) []string {
+	text := i.Title + "\n" + i.Body
+	for _, comment := range i.Comments {
+		text += "\n" + comment.Body
+	}
+
+	var candidates []string
+	for _, m := range blobRegex.FindAllStringSubmatch(text, -1) {
+		candidates = append(candidates, m[1])
+	}
+	candidates = append(candidates, pathRegex.FindAllString(text, -1)...)
+
+	var mentions []string
+	for _, candidate := range candidates {
+		path := filepath.Clean(strings.TrimPrefix(candidate, "/"))
+		if !filepath.IsLocal(path) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(workingDir, path))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		mention := "@/" + filepath.ToSlash(path)
+		if !slices.Contains(mentions, mention) {
+			mentions = append(mentions, mention)
+		}
+	}
+	return mentions
+}
+
+// Prompt returns the first message of a task working on the issue, with the issue, its
+// comments and the files it refers to. Instructions from the user come first if any.
+func (i Issue) Prompt(instructions, workingDir string) string {
+	var sb strings.Builder
+	if instructions == "" {
+		instructions = "Resolve the following issue."
+	}
+	sb.WriteString(instructions)
+	fmt.Fprintf(&sb, "\n\n<issue url=%q>\n# %s\n", i.URL, i.Title)
+	if i.Author != "" {
+		fmt.Fprintf(&sb, "\nOpened by %s\n", i.Author)
+	}
+	if body := strings.TrimSpace(i.Body); body != "" {
+		fmt.Fprintf(&sb, "\n%s\n", body)
+	}
+	for _, comment := range i.Comments {
+		fmt.Fprintf(&sb, "\n## Comment by %s\n\n%s\n", comment.Author, strings.TrimSpace(comment.Body))
+	}
+	sb.WriteString("</issue>")
+
+	if mentions := i.FileMentions(workingDir); len(mentions) > 0 {
+		sb.WriteString("\n\nFiles referred to by the issue: " + strings.Join(mentions, " "))
+	}
+	return sb.String()
+}
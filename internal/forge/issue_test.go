@@ -0,0 +1,133 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseIssue(t *testing.T) {
+	tests := []struct {
+		ref    string
+		repo   Repository
+		number int
+	}{
+		{"kazz187/goline#12", Repository{Path: "kazz187/goline"}, 12},
+		{"https://github.com/kazz187/goline/issues/12", Repository{Host: "github.com", Path: "kazz187/goline"}, 12},
+		{"https://gitlab.com/group/sub/project/-/issues/7", Repository{Host: "gitlab.com", Path: "group/sub/project"}, 7},
+	}
+	for _, tt := range tests {
+		repo, number, err := ParseIssue(tt.ref)
+		if err != nil {
+			t.Errorf("ParseIssue(%q) failed: %v", tt.ref, err)
+			continue
+		}
+		if repo != tt.repo || number != tt.number {
+			t.Errorf("ParseIssue(%q) = %+v, %d, want %+v, %d", tt.ref, repo, number, tt.repo, tt.number)
+		}
+	}
+
+	for _, ref := range []string{"#12", "goline#12", "https://github.com/kazz187/goline/pull/12", "https://github.com/kazz187/goline/issues/abc"} {
+		if _, _, err := ParseIssue(ref); err == nil {
+			t.Errorf("ParseIssue(%q) succeeded, want an error", ref)
+		}
+	}
+}
+
+func TestGitHubGetIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/kazz187/goline/issues/12":
+			w.Write([]byte(`{"title": "Crash on resume", "body": "It panics.", "html_url": "https://github.com/kazz187/goline/issues/12", "user": {"login": "alice"}}`))
+		case "/repos/kazz187/goline/issues/12/comments":
+			w.Write([]byte(`[{"body": "Same here.", "user": {"login": "bob"}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(TypeGitHub, "github.com", server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue, err := client.GetIssue(context.Background(), Repository{Host: "github.com", Path: "kazz187/goline"}, 12)
+	if err != nil {
+		t.Fatalf("GetIssue failed: %v", err)
+	}
+	if issue.Title != "Crash on resume" || issue.Body != "It panics." || issue.Author != "alice" {
+		t.Errorf("unexpected issue %+v", issue)
+	}
+	if len(issue.Comments) != 1 || issue.Comments[0] != (Comment{Author: "bob", Body: "Same here."}) {
+		t.Errorf("unexpected comments %+v", issue.Comments)
+	}
+}
+
+func TestGitLabGetIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/projects/group%2Fproject/issues/7":
+			w.Write([]byte(`{"title": "Crash on resume", "description": "It panics.", "web_url": "https://gitlab.com/group/project/-/issues/7", "author": {"username": "alice"}}`))
+		case "/projects/group%2Fproject/issues/7/notes":
+			w.Write([]byte(`[{"body": "added ~bug label", "system": true, "author": {"username": "bob"}}, {"body": "Same here.", "author": {"username": "bob"}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(TypeGitLab, "gitlab.com", server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue, err := client.GetIssue(context.Background(), Repository{Host: "gitlab.com", Path: "group/project"}, 7)
+	if err != nil {
+		t.Fatalf("GetIssue failed: %v", err)
+	}
+	if issue.Body != "It panics." || issue.URL != "https://gitlab.com/group/project/-/issues/7" {
+		t.Errorf("unexpected issue %+v", issue)
+	}
+	if len(issue.Comments) != 1 || issue.Comments[0].Body != "Same here." {
+		t.Errorf("system notes should be skipped, got %+v", issue.Comments)
+	}
+}
+
+func TestIssuePrompt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "internal", "tui"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"internal/tui/repl.go", "main.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("package main\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issue := Issue{
+		Title: "Crash in main.go",
+		Body:  "See https://github.com/kazz187/goline/blob/main/internal/tui/repl.go#L10 and missing.go.",
+		URL:   "https://github.com/kazz187/goline/issues/12",
+		Comments: []Comment{
+			{Author: "bob", Body: "Also ../outside.go"},
+		},
+	}
+	prompt := issue.Prompt("", dir)
+	for _, want := range []string{"Resolve the following issue.", "# Crash in main.go", "## Comment by bob", "@/internal/tui/repl.go", "@/main.go"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, prompt)
+		}
+	}
+	for _, unwanted := range []string{"@/missing.go", "@/../outside.go"} {
+		if strings.Contains(prompt, unwanted) {
+			t.Errorf("prompt contains %q:\n%s", unwanted, prompt)
+		}
+	}
+
+	if prompt := issue.Prompt("Fix it with a test.", dir); !strings.HasPrefix(prompt, "Fix it with a test.") {
+		t.Errorf("instructions should come first:\n%s", prompt)
+	}
+}
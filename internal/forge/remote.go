@@ -0,0 +1,102 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/kazz187/goline/internal/gitexec"
+)
+
+// Repository is a repository of a forge
+type Repository struct {
+	// Host is the host name of the forge, e.g. github.com
+	Host string
+	// Path is the path of the repository on the forge, e.g. owner/name, or group/subgroup/name on GitLab
+	Path string
+}
+
+// String returns the host and path of the repository
+func (r Repository) String() string {
+	return r.Host + "/" + r.Path
+}
+
+// ParseRemote parses the URL of a git remote, in the forms https://host/owner/name.git,
+// ssh://git@host:22/owner/name.git and git@host:owner/name.git
+func ParseRemote(remote string) (Repository, error) {
+	remote = strings.TrimSpace(remote)
+	var host, path string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid remote URL %q: %w", remote, err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(remote, "@"); ok && !strings.Contains(at, "/") {
+		// scp-like syntax of ssh remotes
+		host, path, _ = strings.Cut(rest, ":")
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return Repository{}, fmt.Errorf("remote URL %q is not the URL of a repository on a forge", remote)
+	}
+	return Repository{Host: host, Path: path}, nil
+}
+
+// RemoteRepository returns the repository a remote of the repository in the working directory points to
+func RemoteRepository(workingDir, remote string) (Repository, error) {
+	remoteURL, err := gitexec.Run(context.Background(), workingDir, "remote", "get-url", remote)
+	if err != nil {
+		return Repository{}, err
+	}
+	return ParseRemote(remoteURL)
+}
+
+// DefaultBranch returns the default branch of a remote, as last fetched, main if unknown
+func DefaultBranch(workingDir, remote string) string {
+	ref, err := gitexec.Run(context.Background(), workingDir, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		return "main"
+	}
+	return strings.TrimPrefix(strings.TrimSpace(ref), remote+"/")
+}
+
+// Changes summarizes the changes of HEAD since it diverged from a base ref: the subjects of the
+// commits and the files changed
+func Changes(workingDir, base string) (string, error) {
+	commits, err := gitexec.Run(context.Background(), workingDir, "log", "--format=- %s", base+"..HEAD")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(commits) == "" {
+		return "", fmt.Errorf("HEAD has no commits that are not in %s", base)
+	}
+	stat, err := gitexec.Run(context.Background(), workingDir, "diff", "--stat", base+"...HEAD")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Commits:\n%s\nFiles changed:\n%s", commits, stat), nil
+}
+
+// Uncommitted returns the status lines of the files among paths with changes that are not
+// committed, of the whole working tree if paths is empty
+func Uncommitted(workingDir string, paths []string) ([]string, error) {
+	out, err := gitexec.Run(context.Background(), workingDir, append([]string{"status", "--porcelain", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// Push pushes HEAD of the repository in the working directory to a branch of a remote
+func Push(workingDir, remote, branch string) error {
+	_, err := gitexec.Run(context.Background(), workingDir, "push", "--quiet", remote, "HEAD:refs/heads/"+branch)
+	return err
+}
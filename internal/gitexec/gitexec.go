@@ -0,0 +1,31 @@
+// Package gitexec runs the git command of the system in a working directory.
+package gitexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Run runs a git command in the working directory and returns its output
+func Run(ctx context.Context, workingDir string, args ...string) (string, error) {
+	return RunInput(ctx, workingDir, nil, args...)
+}
+
+// RunInput runs a git command in the working directory with input as its standard input and
+// returns its output
+func RunInput(ctx context.Context, workingDir string, input io.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = workingDir
+	cmd.Stdin = input
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
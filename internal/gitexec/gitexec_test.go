@@ -0,0 +1,28 @@
+package gitexec
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+
+	if _, err := Run(context.Background(), dir, "init", "--quiet"); err != nil {
+		t.Fatalf("Run(init) error = %v", err)
+	}
+	out, err := RunInput(context.Background(), dir, strings.NewReader("hello\n"), "hash-object", "--stdin")
+	if err != nil || strings.TrimSpace(out) != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Errorf("RunInput(hash-object) = %q, %v", out, err)
+	}
+
+	_, err = Run(context.Background(), dir, "rev-parse", "--verify", "missing")
+	if err == nil || !strings.Contains(err.Error(), "git rev-parse --verify missing failed") || !strings.Contains(err.Error(), "fatal:") {
+		t.Errorf("Run() error = %v, want the command and its standard error", err)
+	}
+}
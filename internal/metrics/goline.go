@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// Default is the registry of the Goline metrics
+var Default = NewRegistry()
+
+// Goline metrics
+var (
+	// ProviderRequests counts the requests sent to each provider
+	ProviderRequests = Default.NewCounterVec("goline_provider_requests_total", "Requests sent to AI providers.", "provider", "model")
+	// ProviderErrors counts the requests that failed, before or while streaming
+	ProviderErrors = Default.NewCounterVec("goline_provider_errors_total", "Requests to AI providers that failed.", "provider", "model")
+	// Tokens counts the tokens used, by type: input, output, cache_read or cache_write
+	Tokens = Default.NewCounterVec("goline_tokens_total", "Tokens used by AI requests.", "provider", "model", "type")
+	// Cost sums the estimated cost of the requests in USD
+	Cost = Default.NewCounterVec("goline_cost_usd_total", "Estimated cost of AI requests in USD.", "provider", "model")
+	// ActiveTasks is the number of tasks running in this process
+	ActiveTasks = Default.NewGaugeVec("goline_active_tasks", "Tasks currently running.")
+	// FirstTokenLatency is the time from sending a request to receiving the first streamed event
+	FirstTokenLatency = Default.NewHistogramVec("goline_stream_first_token_seconds", "Time from sending a request to the first streamed event.", DefaultBuckets, "provider", "model")
+	// StreamDuration is the time from sending a request to the end of its stream
+	StreamDuration = Default.NewHistogramVec("goline_stream_duration_seconds", "Time from sending a request to the end of its stream.", DefaultBuckets, "provider", "model")
+)
+
+// TaskStarted records that a task started running
+func TaskStarted() {
+	ActiveTasks.Add(1)
+}
+
+// TaskFinished records that a task stopped running
+func TaskFinished() {
+	ActiveTasks.Add(-1)
+}
+
+// instrumentedProvider records metrics about the requests of a provider
+type instrumentedProvider struct {
+	provider.Provider
+}
+
+// InstrumentProvider wraps a provider to record metrics about its requests
+func InstrumentProvider(p provider.Provider) provider.Provider {
+	return &instrumentedProvider{Provider: p}
+}
+
+// CreateMessage implements provider.Provider
+func (p *instrumentedProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	name, model := p.Name(), p.GetModel().Name
+	ProviderRequests.Inc(name, model)
+
+	start := time.Now()
+	events, err := p.Provider.CreateMessage(ctx, systemPrompt, messages, opts)
+	if err != nil {
+		ProviderErrors.Inc(name, model)
+		return nil, err
+	}
+
+	out := make(chan provider.StreamEvent)
+	go func() {
+		defer close(out)
+		first := true
+		for event := range events {
+			if first {
+				FirstTokenLatency.Observe(time.Since(start).Seconds(), name, model)
+				first = false
+			}
+			switch event.Type {
+			case "usage":
+				recordUsage(name, model, event.Usage)
+			case "error":
+				ProviderErrors.Inc(name, model)
+			}
+			out <- event
+		}
+		StreamDuration.Observe(time.Since(start).Seconds(), name, model)
+	}()
+	return out, nil
+}
+
+// recordUsage adds the token usage and cost of a request
+func recordUsage(name, model string, usage *provider.Usage) {
+	if usage == nil {
+		return
+	}
+	Tokens.Add(float64(usage.InputTokens), name, model, "input")
+	Tokens.Add(float64(usage.OutputTokens), name, model, "output")
+	Tokens.Add(float64(usage.CacheReadTokens), name, model, "cache_read")
+	Tokens.Add(float64(usage.CacheWriteTokens), name, model, "cache_write")
+	Cost.Add(usage.TotalCost, name, model)
+}
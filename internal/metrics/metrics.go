@@ -0,0 +1,313 @@
+// Package metrics collects usage metrics and exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets in seconds used for latencies
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// collector is a metric family that can be written in the text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metric families
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a metric family, panicking on duplicate names as they are programming errors
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic(fmt.Sprintf("metric %s registered twice", c.name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// family holds the labeled series of a metric
+type family[V any] struct {
+	mu     sync.Mutex
+	metric string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*V
+	values map[string][]string
+	newV   func() *V
+}
+
+// newFamily creates a metric family
+func newFamily[V any](name, help, kind string, labels []string, newV func() *V) *family[V] {
+	return &family[V]{
+		metric: name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*V),
+		values: make(map[string][]string),
+		newV:   newV,
+	}
+}
+
+func (f *family[V]) name() string {
+	return f.metric
+}
+
+// with returns the series for the label values, creating it on first use.
+// The caller must hold f.mu.
+func (f *family[V]) with(labelValues []string) *V {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.metric, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v, ok := f.series[key]
+	if !ok {
+		v = f.newV()
+		f.series[key] = v
+		f.values[key] = append([]string(nil), labelValues...)
+	}
+	return v
+}
+
+// each calls fn for every series in a stable order, holding f.mu
+func (f *family[V]) each(fn func(labels string, v *V)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(formatLabels(f.labels, f.values[key]), f.series[key])
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of the family
+func (f *family[V]) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metric, escapeHelp(f.help), f.metric, f.kind)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*family[float64]
+}
+
+// NewCounterVec creates and registers a counter
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, "counter", labels, func() *float64 { return new(float64) })}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter of the label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.with(labelValues) += value
+}
+
+// Value returns the counter of the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *c.with(labelValues)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.each(func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metric, labels, formatValue(*v))
+	})
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*family[float64]
+}
+
+// NewGaugeVec creates and registers a gauge
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, "gauge", labels, func() *float64 { return new(float64) })}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.with(labelValues) = value
+}
+
+// Add adds a value, possibly negative, to the gauge of the label values
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.with(labelValues) += value
+}
+
+// Value returns the gauge of the label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return *g.with(labelValues)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.each(func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metric, labels, formatValue(*v))
+	})
+}
+
+// histogram is the state of a histogram series
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*family[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bucket bounds
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		family: newFamily(name, help, "histogram", labels, func() *histogram {
+			return &histogram{counts: make([]uint64, len(buckets))}
+		}),
+		buckets: buckets,
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series := h.with(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// Count returns the number of values observed in the histogram of the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.with(labelValues).count
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.each(func(labels string, v *histogram) {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, withLabel(labels, "le", formatValue(bound)), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, withLabel(labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, labels, formatValue(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, labels, v.count)
+	})
+}
+
+// formatLabels formats label pairs as {name="value",...}, or an empty string without labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds a label pair to formatted labels
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, escapeLabel(value))
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// escapeHelp escapes a help text
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
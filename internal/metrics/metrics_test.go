@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "provider")
+	active := r.NewGaugeVec("test_active", "Active things.")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.5}, "provider")
+
+	requests.Inc("anthropic")
+	requests.Add(2, `dee"p`)
+	active.Set(3)
+	latency.Observe(0.2, "anthropic")
+	latency.Observe(0.7, "anthropic")
+	latency.Observe(5, "anthropic")
+
+	var b strings.Builder
+	r.WriteText(&b)
+	want := `# HELP test_active Active things.
+# TYPE test_active gauge
+test_active 3
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{provider="anthropic",le="0.5"} 1
+test_latency_seconds_bucket{provider="anthropic",le="1"} 2
+test_latency_seconds_bucket{provider="anthropic",le="+Inf"} 3
+test_latency_seconds_sum{provider="anthropic"} 5.9
+test_latency_seconds_count{provider="anthropic"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{provider="anthropic"} 1
+test_requests_total{provider="dee\"p"} 2
+`
+	if b.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestInstrumentProvider(t *testing.T) {
+	p := InstrumentProvider(mock.New(&mock.Fixture{Model: "model", Responses: []mock.Response{{Events: []mock.Event{
+		{Type: "text", Text: "hello"},
+		{Type: "usage", Usage: &mock.Usage{InputTokens: 10, OutputTokens: 3, TotalCost: 0.5}},
+	}}}}))
+
+	events, err := p.CreateMessage(context.Background(), "", nil, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+	for range events {
+	}
+
+	if got := ProviderRequests.Value("mock", "model"); got != 1 {
+		t.Errorf("requests = %v, want 1", got)
+	}
+	if got := Tokens.Value("mock", "model", "input"); got != 10 {
+		t.Errorf("input tokens = %v, want 10", got)
+	}
+	if got := Cost.Value("mock", "model"); got != 0.5 {
+		t.Errorf("cost = %v, want 0.5", got)
+	}
+	if got := StreamDuration.Count("mock", "model"); got != 1 {
+		t.Errorf("stream duration observations = %v, want 1", got)
+	}
+
+	failing := InstrumentProvider(mock.New(&mock.Fixture{Model: "model", Responses: []mock.Response{{Error: "boom"}}}))
+	if _, err := failing.CreateMessage(context.Background(), "", nil, provider.GenerationOptions{}); err == nil {
+		t.Fatal("CreateMessage() error = nil, want error")
+	}
+	if got := ProviderErrors.Value("mock", "model"); got != 1 {
+		t.Errorf("errors = %v, want 1", got)
+	}
+}
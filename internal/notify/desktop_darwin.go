@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// notificationScript shows a notification with the title and message read from the
+// environment, so they need no quoting
+const notificationScript = `display notification (system attribute "GOLINE_NOTIFY_MESSAGE") with title (system attribute "GOLINE_NOTIFY_TITLE")`
+
+// Desktop shows notifications in the Notification Center with osascript
+type Desktop struct{}
+
+// Notify implements Notifier
+func (Desktop) Notify(ctx context.Context, n Notification) error {
+	cmd := exec.CommandContext(ctx, "osascript", "-e", notificationScript)
+	cmd.Env = append(os.Environ(), "GOLINE_NOTIFY_TITLE="+n.Title(), "GOLINE_NOTIFY_MESSAGE="+desktopMessage(n))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("osascript failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Desktop shows notifications with notify-send, through the notification daemon of the desktop
+type Desktop struct{}
+
+// Notify implements Notifier
+func (Desktop) Notify(ctx context.Context, n Notification) error {
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return fmt.Errorf("%w: notify-send not found", ErrUnavailable)
+	}
+	cmd := exec.CommandContext(ctx, "notify-send", "--app-name", "goline", "--", n.Title(), desktopMessage(n))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify-send failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
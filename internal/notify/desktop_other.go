@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !windows
+
+package notify
+
+import "context"
+
+// Desktop is not available on this system
+type Desktop struct{}
+
+// Notify implements Notifier
+func (Desktop) Notify(ctx context.Context, n Notification) error {
+	return ErrUnavailable
+}
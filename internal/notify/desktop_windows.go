@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// toastScript shows a toast with the title and message read from the environment, so they
+// need no quoting
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$texts = $template.GetElementsByTagName('text')
+$texts.Item(0).AppendChild($template.CreateTextNode($env:GOLINE_NOTIFY_TITLE)) | Out-Null
+$texts.Item(1).AppendChild($template.CreateTextNode($env:GOLINE_NOTIFY_MESSAGE)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('goline').Show($toast)`
+
+// Desktop shows notifications as toasts with PowerShell
+type Desktop struct{}
+
+// Notify implements Notifier
+func (Desktop) Notify(ctx context.Context, n Notification) error {
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "GOLINE_NOTIFY_TITLE="+n.Title(), "GOLINE_NOTIFY_MESSAGE="+desktopMessage(n))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("powershell failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package notify pings the user when a long agent run needs their attention: when a tool use
+// waits for approval, the AI asks a question, a run fails or completes.
+//
+// Notifications are sent as desktop notifications (osascript on macOS, notify-send on Linux,
+// a toast on Windows), as a terminal bell, and posted to webhooks as Slack-compatible JSON.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+// Event is what a notification is sent on
+type Event string
+
+const (
+	// EventApprovalNeeded is sent when a tool use waits for the approval of the user
+	EventApprovalNeeded Event = "approval_needed"
+	// EventInputNeeded is sent when the AI asks the user a question
+	EventInputNeeded Event = "input_needed"
+	// EventError is sent when a run of a task fails or stops before completing
+	EventError Event = "error"
+	// EventCompleted is sent when a run of a task completes
+	EventCompleted Event = "completed"
+)
+
+// Events are all the events notifications can be sent on
+var Events = []Event{EventApprovalNeeded, EventInputNeeded, EventError, EventCompleted}
+
+// DefaultTimeout is the maximum duration of sending a notification to one notifier
+const DefaultTimeout = 5 * time.Second
+
+// ErrUnavailable is returned by notifiers that cannot notify on this system
+var ErrUnavailable = errors.New("notifications are not available on this system")
+
+// Notification is a ping sent to the user
+type Notification struct {
+	// Event is what the notification is sent on
+	Event Event
+	// TaskID is the ID of the task
+	TaskID string
+	// Message describes what happened, e.g. the result of the task or the question of the AI
+	Message string
+}
+
+// Title returns the title of the notification
+func (n Notification) Title() string {
+	switch n.Event {
+	case EventApprovalNeeded:
+		return "goline: approval needed"
+	case EventInputNeeded:
+		return "goline: input needed"
+	case EventError:
+		return "goline: task stopped"
+	case EventCompleted:
+		return "goline: task completed"
+	}
+	return "goline"
+}
+
+// Text returns the title and the message of the notification on one line
+func (n Notification) Text() string {
+	text := n.Title()
+	if n.TaskID != "" {
+		text += fmt.Sprintf(" (task %s)", n.TaskID)
+	}
+	if n.Message != "" {
+		text += ": " + n.Message
+	}
+	return text
+}
+
+// Notifier sends notifications one way
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Bell rings the terminal bell
+type Bell struct {
+	Out io.Writer
+}
+
+// Notify implements Notifier
+func (b Bell) Notify(ctx context.Context, n Notification) error {
+	_, err := io.WriteString(b.Out, "\a")
+	return err
+}
+
+// Dispatcher sends the notifications of the enabled events to all its notifiers
+type Dispatcher struct {
+	notifiers []Notifier
+	events    []Event
+	timeout   time.Duration
+}
+
+// NewDispatcher creates a dispatcher sending the notifications of events to notifiers, those
+// of all the events if events is empty
+func NewDispatcher(notifiers []Notifier, events []Event) *Dispatcher {
+	if len(events) == 0 {
+		events = Events
+	}
+	return &Dispatcher{notifiers: notifiers, events: events, timeout: DefaultTimeout}
+}
+
+// New creates a dispatcher for the configured notifications, nil if none is configured.
+// Unknown events are skipped with a warning.
+func New(cfg config.Notifications) *Dispatcher {
+	var notifiers []Notifier
+	if cfg.Desktop {
+		notifiers = append(notifiers, Desktop{})
+	}
+	if cfg.Bell {
+		notifiers = append(notifiers, Bell{Out: os.Stderr})
+	}
+	for _, url := range cfg.Webhooks {
+		notifiers = append(notifiers, &Webhook{URL: url})
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	var events []Event
+	for _, name := range cfg.Events {
+		event := Event(name)
+		if !slices.Contains(Events, event) {
+			slog.Warn("Skipping unknown notification event", "event", name)
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(cfg.Events) > 0 && len(events) == 0 {
+		return nil
+	}
+	return NewDispatcher(notifiers, events)
+}
+
+// Enabled reports whether notifications are sent on an event. A nil dispatcher sends none.
+func (d *Dispatcher) Enabled(event Event) bool {
+	return d != nil && slices.Contains(d.events, event)
+}
+
+// Notify sends a notification to all the notifiers if its event is enabled, each within the
+// timeout. Failures are only logged, a notification never stops a task. A nil dispatcher sends nothing.
+func (d *Dispatcher) Notify(ctx context.Context, n Notification) {
+	if !d.Enabled(n.Event) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, notifier := range d.notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, d.timeout)
+		if err := notifier.Notify(notifyCtx, n); err != nil {
+			slog.Warn("Failed to send notification", "event", n.Event, "error", err)
+		}
+		cancel()
+	}
+}
+
+// maxDesktopMessage limits the length of the message of desktop notifications
+const maxDesktopMessage = 200
+
+// desktopMessage returns the body of a desktop notification: the task and the beginning of
+// the message
+func desktopMessage(n Notification) string {
+	message := n.Message
+	if runes := []rune(message); len(runes) > maxDesktopMessage {
+		message = string(runes[:maxDesktopMessage-3]) + "..."
+	}
+	if n.TaskID == "" {
+		return message
+	}
+	if message == "" {
+		return "Task " + n.TaskID
+	}
+	return fmt.Sprintf("Task %s: %s", n.TaskID, message)
+}
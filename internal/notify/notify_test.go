@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+// recordingNotifier records the notifications it is sent
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	recorder := &recordingNotifier{}
+	d := NewDispatcher([]Notifier{recorder}, []Event{EventApprovalNeeded, EventError})
+
+	d.Notify(context.Background(), Notification{Event: EventApprovalNeeded, TaskID: "task-1"})
+	d.Notify(context.Background(), Notification{Event: EventCompleted, TaskID: "task-1"})
+	d.Notify(context.Background(), Notification{Event: EventError, TaskID: "task-1", Message: "boom"})
+	if len(recorder.sent) != 2 || recorder.sent[0].Event != EventApprovalNeeded || recorder.sent[1].Event != EventError {
+		t.Errorf("sent = %+v, want the enabled events only", recorder.sent)
+	}
+
+	// All the events are enabled by default, and a nil dispatcher sends nothing
+	if !NewDispatcher(nil, nil).Enabled(EventCompleted) {
+		t.Error("Enabled(completed) = false without events, want all the events enabled")
+	}
+	var nilDispatcher *Dispatcher
+	nilDispatcher.Notify(context.Background(), Notification{Event: EventCompleted})
+}
+
+func TestNew(t *testing.T) {
+	if d := New(config.Notifications{Events: []string{"completed"}}); d != nil {
+		t.Errorf("New() without notifiers = %+v, want nil", d)
+	}
+	d := New(config.Notifications{Bell: true, Events: []string{"completed", "unknown"}})
+	if d == nil || !d.Enabled(EventCompleted) || d.Enabled(EventError) {
+		t.Errorf("New() = %+v, want only completed enabled", d)
+	}
+}
+
+func TestBell(t *testing.T) {
+	var out bytes.Buffer
+	if err := (Bell{Out: &out}).Notify(context.Background(), Notification{Event: EventCompleted}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "\a" {
+		t.Errorf("bell wrote %q", out.String())
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if got.Event == EventError {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL}
+	err := webhook.Notify(context.Background(), Notification{Event: EventInputNeeded, TaskID: "task-1", Message: "Which color?"})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got.Text != "goline: input needed (task task-1): Which color?" || got.Event != EventInputNeeded || got.TaskID != "task-1" {
+		t.Errorf("payload = %+v", got)
+	}
+
+	err = webhook.Notify(context.Background(), Notification{Event: EventError})
+	if err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("Notify() error = %v, want the response of the webhook", err)
+	}
+}
+
+func TestDesktopMessage(t *testing.T) {
+	long := strings.Repeat("a", maxDesktopMessage+10)
+	if got := desktopMessage(Notification{TaskID: "task-1", Message: long}); len(got) != len("Task task-1: ")+maxDesktopMessage || !strings.HasSuffix(got, "...") {
+		t.Errorf("desktopMessage() = %q, want the message shortened", got)
+	}
+	if got := desktopMessage(Notification{TaskID: "task-1"}); got != "Task task-1" {
+		t.Errorf("desktopMessage() = %q", got)
+	}
+}
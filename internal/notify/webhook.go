@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxResponse limits the response body of a webhook reported in errors
+const maxResponse = 500
+
+// Webhook posts notifications to a URL as Slack-compatible JSON: the text of the notification
+// in "text", with its event and task ID for other receivers
+type Webhook struct {
+	URL string
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// webhookPayload is the JSON body posted to webhooks
+type webhookPayload struct {
+	Text    string `json:"text"`
+	Event   Event  `json:"event"`
+	TaskID  string `json:"task_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(webhookPayload{Text: n.Text(), Event: n.Event, TaskID: n.TaskID, Message: n.Message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+		return fmt.Errorf("webhook responded %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
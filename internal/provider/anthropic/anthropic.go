@@ -3,14 +3,15 @@ package anthropic
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/kazz187/goline/internal/provider"
 )
@@ -18,6 +19,15 @@ import (
 // DefaultEndpoint is the default Anthropic API endpoint
 const DefaultEndpoint = "https://api.anthropic.com/v1"
 
+// DefaultThinkingBudget is the number of tokens the models think with when no budget is configured
+const DefaultThinkingBudget = 10000
+
+// minThinkingBudget is the smallest thinking budget the API accepts
+const minThinkingBudget = 1024
+
+// redactedThinking is the reasoning shown for a thinking block redacted by the safety systems
+const redactedThinking = "[Some of the reasoning was redacted for safety reasons]"
+
 // Provider implements the provider.Provider interface for Anthropic
 type Provider struct {
 	client    *http.Client
@@ -25,10 +35,16 @@ type Provider struct {
 	endpoint  string
 	modelID   ModelID
 	modelInfo provider.ModelInfo
+	// caching marks the system prompt and the cache hints of the messages as cache breakpoints
+	caching bool
+	// thinkingBudget is the number of tokens the model thinks with, zero when thinking is off
+	thinkingBudget int
+	// generation are the sampling settings of the requests that do not set them
+	generation provider.GenerationOptions
 }
 
 // NewProvider creates a new Anthropic provider
-func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error) {
+func NewProvider(apiKey, endpoint, modelName string, opts provider.Options) (provider.Provider, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("Anthropic API key is required")
 	}
@@ -37,11 +53,15 @@ func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error)
 		endpoint = DefaultEndpoint
 	}
 
-	// Create HTTP client with reasonable timeout
-	client := &http.Client{
-		Timeout: 120 * time.Second,
+	// The Messages API only streams server-sent events
+	if opts.StreamFormat != "" && opts.StreamFormat != provider.StreamFormatSSE {
+		return nil, fmt.Errorf("Anthropic provider does not support the %s stream format", opts.StreamFormat)
 	}
 
+	// Create HTTP client with the configured timeouts.
+	// Long thinking generations stream for minutes, so only stalled connections fail early.
+	client := opts.HTTPClient()
+
 	// Determine model ID
 	modelID := getModelID(modelName)
 	modelInfo, ok := Models[modelID]
@@ -49,12 +69,25 @@ func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error)
 		return nil, fmt.Errorf("unknown Anthropic model: %s", modelID)
 	}
 
+	// The budget must leave room for the response in the output tokens
+	thinkingBudget := 0
+	if isThinkingSupported(modelID) && !opts.Thinking.Disabled {
+		maxOutputTokens := cmp.Or(opts.Generation.MaxOutputTokens, modelInfo.MaxOutputTokens)
+		thinkingBudget = cmp.Or(opts.Thinking.BudgetTokens, DefaultThinkingBudget)
+		if thinkingBudget < minThinkingBudget || thinkingBudget >= maxOutputTokens {
+			return nil, fmt.Errorf("thinking budget must be between %d and %d tokens, got %d", minThinkingBudget, maxOutputTokens-1, thinkingBudget)
+		}
+	}
+
 	return &Provider{
-		client:    client,
-		apiKey:    apiKey,
-		endpoint:  endpoint,
-		modelID:   modelID,
-		modelInfo: modelInfo,
+		client:         client,
+		apiKey:         apiKey,
+		endpoint:       endpoint,
+		modelID:        modelID,
+		modelInfo:      modelInfo,
+		caching:        isCachingSupported(modelID) && !opts.DisablePromptCaching,
+		thinkingBudget: thinkingBudget,
+		generation:     opts.Generation,
 	}, nil
 }
 
@@ -77,19 +110,50 @@ func getModelID(modelName string) ModelID {
 
 // Message represents an Anthropic message
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
 }
 
+// TextBlock represents a text block of the system prompt
+type TextBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks the end of a prefix of the request to cache
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// ephemeralCache is the cache control of the cache breakpoints, cached for a few minutes
+var ephemeralCache = &CacheControl{Type: "ephemeral"}
+
 // MessageRequest represents an Anthropic message request
 type MessageRequest struct {
-	Model       string    `json:"model"`
-	MaxTokens   int       `json:"max_tokens"`
-	System      string    `json:"system"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	Temperature *float64  `json:"temperature,omitempty"`
-	Thinking    *Thinking `json:"thinking,omitempty"`
+	Model       string      `json:"model"`
+	MaxTokens   int         `json:"max_tokens"`
+	System      []TextBlock `json:"system,omitempty"`
+	Messages    []Message   `json:"messages"`
+	Stream      bool        `json:"stream"`
+	Temperature *float64    `json:"temperature,omitempty"`
+	TopP        *float64    `json:"top_p,omitempty"`
+	Thinking    *Thinking   `json:"thinking,omitempty"`
+	Tools       []Tool      `json:"tools,omitempty"`
+	ToolChoice  *ToolChoice `json:"tool_choice,omitempty"`
+}
+
+// Tool represents a tool the model can call, with the JSON schema of its input
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice tells the model which tool to call
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // Thinking represents the thinking configuration for Anthropic models
@@ -121,18 +185,44 @@ type MessageEvent struct {
 	Usage *Usage `json:"usage,omitempty"`
 }
 
-// ContentBlock represents a content block
+// ContentBlock represents a content block of a message, or of a response as it starts streaming:
+// text, image, thinking, redacted_thinking, tool_use or tool_result
 type ContentBlock struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	Thinking string `json:"thinking,omitempty"`
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Thinking and Signature are the reasoning of a thinking block and its signature, and
+	// Data the encrypted reasoning of a redacted_thinking block
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+	// ID, Name and Input describe a tool_use block
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// ToolUseID, Content and IsError describe a tool_result block
+	ToolUseID    string        `json:"tool_use_id,omitempty"`
+	Content      string        `json:"content,omitempty"`
+	IsError      bool          `json:"is_error,omitempty"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+	// Source is the image of an image block
+	Source *ImageSource `json:"source,omitempty"`
+}
+
+// ImageSource is an image sent in an image block, encoded in base64
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 // DeltaEvent represents a delta event
 type DeltaEvent struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	Thinking string `json:"thinking,omitempty"`
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
 }
 
 // UsageEvent represents a usage event
@@ -141,33 +231,34 @@ type UsageEvent struct {
 }
 
 // CreateMessage sends a message to the Anthropic API and returns a stream of events
-func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message) (chan provider.StreamEvent, error) {
+func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
 	eventCh := make(chan provider.StreamEvent)
 
 	// Convert messages to Anthropic format
-	anthropicMessages := make([]Message, 0, len(messages))
-	for _, msg := range messages {
-		role := "user"
-		if msg.Role == "assistant" {
-			role = "assistant"
+	anthropicMessages := p.convertMessages(messages)
+
+	// The system prompt is the same for every request of a task, it is always worth caching
+	var system []TextBlock
+	if systemPrompt != "" {
+		block := TextBlock{Type: "text", Text: systemPrompt}
+		if p.caching {
+			block.CacheControl = ephemeralCache
 		}
-
-		anthropicMessages = append(anthropicMessages, Message{
-			Role:    role,
-			Content: msg.Content,
-		})
+		system = []TextBlock{block}
 	}
 
-	// Check if we're using a model that supports thinking
-	supportsThinking := strings.Contains(string(p.modelID), "3-7")
-	var thinkingBudget int
-	if supportsThinking {
-		thinkingBudget = 10000 // Default thinking budget
+	// The output is limited to the output tokens of the model unless a lower limit is set, the
+	// thinking budget being part of it
+	opts = opts.WithDefaults(p.generation)
+	maxTokens := cmp.Or(opts.MaxOutputTokens, p.modelInfo.MaxOutputTokens)
+	if p.thinkingBudget > 0 && maxTokens <= p.thinkingBudget {
+		return nil, fmt.Errorf("the output token limit %d must be greater than the thinking budget %d", maxTokens, p.thinkingBudget)
 	}
 
-	// Set temperature to 0 for deterministic responses
-	var temperature *float64
-	if !supportsThinking {
+	// Set temperature to 0 for deterministic responses unless another one is set, thinking
+	// requires the default temperature
+	temperature := opts.Temperature
+	if temperature == nil && p.thinkingBudget == 0 {
 		temp := 0.0
 		temperature = &temp
 	}
@@ -175,41 +266,25 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 	// Create message request
 	req := &MessageRequest{
 		Model:       string(p.modelID),
-		MaxTokens:   p.modelInfo.MaxTokens,
-		System:      systemPrompt,
+		MaxTokens:   maxTokens,
+		System:      system,
 		Messages:    anthropicMessages,
 		Stream:      true,
 		Temperature: temperature,
+		TopP:        opts.TopP,
 	}
 
 	// Enable thinking for models that support it
-	if supportsThinking && thinkingBudget > 0 {
+	if p.thinkingBudget > 0 {
 		req.Thinking = &Thinking{
 			Type:         "enabled",
-			BudgetTokens: thinkingBudget,
+			BudgetTokens: p.thinkingBudget,
 		}
 	}
 
-	// Marshal request to JSON
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/messages", bytes.NewBuffer(reqBody))
+	httpReq, err := p.newRequest(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-API-Key", p.apiKey)
-	httpReq.Header.Set("Anthropic-Version", "2023-06-01")
-
-	// Enable prompt caching for supported models
-	if isCachingSupported(p.modelID) {
-		httpReq.Header.Set("Anthropic-Beta", "prompt-caching-2024-07-31")
+		return nil, err
 	}
 
 	// Start streaming in a goroutine
@@ -223,6 +298,7 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 			eventCh <- provider.StreamEvent{
 				Type: "error",
 				Text: fmt.Sprintf("Error: %v", err),
+				Err:  err,
 			}
 			return
 		}
@@ -239,8 +315,9 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 			return
 		}
 
-		// Process the stream
+		// Process the stream. Thinking and tool_use blocks are sent once they are complete.
 		reader := bufio.NewReader(resp.Body)
+		blocks := make(map[int]*streamedBlock)
 		for {
 			// Read line from stream
 			line, err := reader.ReadString('\n')
@@ -253,6 +330,7 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 				eventCh <- provider.StreamEvent{
 					Type: "error",
 					Text: fmt.Sprintf("Stream error: %v", err),
+					Err:  err,
 				}
 				return
 			}
@@ -305,11 +383,24 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 						},
 					}
 				}
+				if event.Delta != nil && event.Delta.StopReason != "" {
+					eventCh <- provider.StreamEvent{
+						Type:       "stop",
+						StopReason: event.Delta.StopReason,
+					}
+				}
 
 			case "content_block_start":
 				// Handle content block start
 				if event.ContentBlock != nil {
+					blocks[event.Index] = &streamedBlock{ContentBlock: *event.ContentBlock}
 					switch event.ContentBlock.Type {
+					case "redacted_thinking":
+						// The reasoning of a redacted block is encrypted, only its presence is shown
+						eventCh <- provider.StreamEvent{
+							Type:      "reasoning",
+							Reasoning: redactedThinking,
+						}
 					case "thinking":
 						// Handle thinking block
 						if event.ContentBlock.Thinking != "" {
@@ -339,6 +430,10 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 			case "content_block_delta":
 				// Handle content block delta
 				if event.Delta != nil {
+					block := blocks[event.Index]
+					if block != nil {
+						block.add(event.Delta)
+					}
 					switch event.Delta.Type {
 					case "thinking_delta":
 						// Handle thinking delta
@@ -358,6 +453,17 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 						}
 					}
 				}
+
+			case "content_block_stop":
+				// Send the thinking and tool_use blocks as a whole
+				block := blocks[event.Index]
+				delete(blocks, event.Index)
+				if block == nil {
+					continue
+				}
+				if streamEvent, ok := block.event(); ok {
+					eventCh <- streamEvent
+				}
 			}
 		}
 	}()
@@ -365,6 +471,140 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 	return eventCh, nil
 }
 
+// streamedBlock is a content block of a response being streamed, with the JSON of the input of
+// a tool_use block received so far
+type streamedBlock struct {
+	ContentBlock
+	input strings.Builder
+}
+
+// add adds a delta to the block
+func (b *streamedBlock) add(delta *DeltaEvent) {
+	switch delta.Type {
+	case "thinking_delta":
+		b.Thinking += delta.Thinking
+	case "signature_delta":
+		b.Signature += delta.Signature
+	case "input_json_delta":
+		b.input.WriteString(delta.PartialJSON)
+	}
+}
+
+// event returns the event of a complete thinking, redacted_thinking or tool_use block, and
+// false for the blocks already streamed as they came
+func (b *streamedBlock) event() (provider.StreamEvent, bool) {
+	switch b.Type {
+	case "thinking", "redacted_thinking":
+		return provider.StreamEvent{
+			Type: "thinking_block",
+			ThinkingBlock: &provider.ThinkingBlock{
+				Thinking:  b.Thinking,
+				Signature: b.Signature,
+				Data:      b.Data,
+			},
+		}, true
+	case "tool_use":
+		// The input of a call without arguments is streamed as no delta at all
+		input := json.RawMessage(b.input.String())
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return provider.StreamEvent{
+			Type:     "tool_use",
+			ToolCall: &provider.ToolCall{ID: b.ID, Name: b.Name, Input: input},
+		}, true
+	}
+	return provider.StreamEvent{}, false
+}
+
+// convertMessages converts messages to the Anthropic format. The blocks of a message are in
+// the order the API expects: the thinking blocks and the tool results first, then the images
+// and the text, then the tool calls.
+func (p *Provider) convertMessages(messages []provider.Message) []Message {
+	anthropicMessages := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "assistant"
+		}
+
+		var blocks []ContentBlock
+		for _, thinking := range msg.Thinking {
+			if thinking.Redacted() {
+				blocks = append(blocks, ContentBlock{Type: "redacted_thinking", Data: thinking.Data})
+			} else {
+				blocks = append(blocks, ContentBlock{Type: "thinking", Thinking: thinking.Thinking, Signature: thinking.Signature})
+			}
+		}
+		for _, result := range msg.ToolResults {
+			blocks = append(blocks, ContentBlock{Type: "tool_result", ToolUseID: result.ToolCallID, Content: result.Content, IsError: result.IsError})
+		}
+		for _, image := range msg.Images {
+			blocks = append(blocks, ContentBlock{Type: "image", Source: &ImageSource{
+				Type:      "base64",
+				MediaType: image.MediaType,
+				Data:      base64.StdEncoding.EncodeToString(image.Data),
+			}})
+		}
+		// A message is never empty, and text blocks cannot be
+		if msg.Content != "" || len(blocks)+len(msg.ToolCalls) == 0 {
+			blocks = append(blocks, ContentBlock{Type: "text", Text: msg.Content})
+		}
+		for _, call := range msg.ToolCalls {
+			input := call.Input
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, ContentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+		}
+
+		if p.caching && msg.CacheHint {
+			blocks[len(blocks)-1].CacheControl = ephemeralCache
+		}
+		anthropicMessages = append(anthropicMessages, Message{
+			Role:    role,
+			Content: blocks,
+		})
+	}
+	return anthropicMessages
+}
+
+// newRequest creates the HTTP request of a message request
+func (p *Provider) newRequest(ctx context.Context, req *MessageRequest) (*http.Request, error) {
+	// Marshal request to JSON
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/messages", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", p.apiKey)
+	httpReq.Header.Set("Anthropic-Version", "2023-06-01")
+
+	// Enable prompt caching for supported models
+	if p.caching {
+		httpReq.Header.Set("Anthropic-Beta", "prompt-caching-2024-07-31")
+	}
+	return httpReq, nil
+}
+
+// isThinkingSupported returns true if the model supports extended thinking
+func isThinkingSupported(modelID ModelID) bool {
+	return modelID == Claude37Sonnet
+}
+
+// isVisionSupported returns true if the model can read images
+func isVisionSupported(modelID ModelID) bool {
+	return modelID != Claude35Haiku
+}
+
 // isCachingSupported returns true if the model supports prompt caching
 func isCachingSupported(modelID ModelID) bool {
 	switch modelID {
@@ -395,6 +635,18 @@ func (p *Provider) Name() string {
 	return "anthropic"
 }
 
+// Capabilities returns the capabilities of the model, reasoning when thinking is enabled and
+// caching unless prompt caching is disabled
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Tools:           true,
+		Vision:          isVisionSupported(p.modelID),
+		Reasoning:       p.thinkingBudget > 0,
+		Caching:         p.caching,
+		MaxOutputTokens: p.modelInfo.MaxOutputTokens,
+	}
+}
+
 // init registers the Anthropic provider factory
 func init() {
 	provider.Register("anthropic", NewProvider)
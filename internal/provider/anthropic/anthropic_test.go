@@ -1,6 +1,12 @@
 package anthropic
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/kazz187/goline/internal/provider"
@@ -8,7 +14,7 @@ import (
 
 func TestProviderRegistration(t *testing.T) {
 	// Create a provider with valid parameters
-	p, err := NewProvider("test-api-key", "", "")
+	p, err := NewProvider("test-api-key", "", "", provider.Options{})
 	if err != nil {
 		t.Fatalf("Failed to create provider: %v", err)
 	}
@@ -54,7 +60,7 @@ func TestProviderFactory(t *testing.T) {
 	}
 
 	// Create a provider using the factory
-	p, err := factory("test-api-key", "", "")
+	p, err := factory("test-api-key", "", "", provider.Options{})
 	if err != nil {
 		t.Fatalf("Failed to create provider using factory: %v", err)
 	}
@@ -64,3 +70,252 @@ func TestProviderFactory(t *testing.T) {
 		t.Errorf("Expected provider name to be 'anthropic', got '%s'", p.Name())
 	}
 }
+
+// captureRequest sends a request to a test server and returns the request body it received
+func captureRequest(t *testing.T, opts provider.Options, messages []provider.Message) MessageRequest {
+	t.Helper()
+	return captureGeneration(t, opts, provider.GenerationOptions{}, messages)
+}
+
+// captureGeneration sends a request with sampling settings to a test server and returns the
+// request body it received
+func captureGeneration(t *testing.T, opts provider.Options, generation provider.GenerationOptions, messages []provider.Message) MessageRequest {
+	t.Helper()
+	var req MessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer server.Close()
+
+	p, err := NewProvider("test-api-key", server.URL, string(Claude37Sonnet), opts)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	events, err := p.CreateMessage(context.Background(), "system prompt", messages, generation)
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+	for range events {
+	}
+	return req
+}
+
+func TestCacheBreakpoints(t *testing.T) {
+	messages := []provider.Message{
+		{Role: "user", Content: "task"},
+		{Role: "assistant", Content: "answer"},
+		{Role: "user", Content: "result", CacheHint: true},
+	}
+
+	req := captureRequest(t, provider.Options{}, messages)
+	if len(req.System) != 1 || req.System[0].CacheControl == nil || req.System[0].CacheControl.Type != "ephemeral" {
+		t.Errorf("system = %+v, want a cache breakpoint", req.System)
+	}
+	for i, message := range req.Messages {
+		cached := message.Content[0].CacheControl != nil
+		if cached != messages[i].CacheHint {
+			t.Errorf("message %d cached = %t, want %t", i, cached, messages[i].CacheHint)
+		}
+	}
+
+	req = captureRequest(t, provider.Options{DisablePromptCaching: true}, messages)
+	if req.System[0].CacheControl != nil || req.Messages[2].Content[0].CacheControl != nil {
+		t.Errorf("request = %+v, want no cache breakpoints when prompt caching is disabled", req)
+	}
+}
+
+func TestCreateStructuredMessage(t *testing.T) {
+	var req MessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		io.WriteString(w, `{"content":[{"type":"tool_use","name":"plan","input":{"steps":["read","edit"]}}],"usage":{"input_tokens":20,"output_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	p, err := NewProvider("test-api-key", server.URL, string(Claude37Sonnet), provider.Options{})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	schema := provider.Schema{Name: "plan", Parameters: json.RawMessage(`{"type":"object"}`)}
+	resp, err := p.(provider.StructuredProvider).CreateStructuredMessage(context.Background(), schema, []provider.Message{{Role: "user", Content: "plan it"}})
+	if err != nil {
+		t.Fatalf("CreateStructuredMessage() error = %v", err)
+	}
+	if string(resp.Content) != `{"steps":["read","edit"]}` || resp.Usage.InputTokens != 20 {
+		t.Errorf("response = %s, %+v", resp.Content, resp.Usage)
+	}
+	if req.Stream || req.Thinking != nil || req.ToolChoice == nil || req.ToolChoice.Name != "plan" || len(req.Tools) != 1 {
+		t.Errorf("request = %+v, want the plan tool forced without thinking", req)
+	}
+}
+
+func TestThinkingOptions(t *testing.T) {
+	req := captureRequest(t, provider.Options{}, []provider.Message{{Role: "user", Content: "task"}})
+	if req.Thinking == nil || req.Thinking.BudgetTokens != DefaultThinkingBudget || req.Temperature != nil {
+		t.Errorf("thinking = %+v, want the default budget", req.Thinking)
+	}
+
+	req = captureRequest(t, provider.Options{Thinking: provider.Thinking{BudgetTokens: 2048}}, []provider.Message{{Role: "user", Content: "task"}})
+	if req.Thinking == nil || req.Thinking.BudgetTokens != 2048 {
+		t.Errorf("thinking = %+v, want a budget of 2048 tokens", req.Thinking)
+	}
+
+	req = captureRequest(t, provider.Options{Thinking: provider.Thinking{Disabled: true}}, []provider.Message{{Role: "user", Content: "task"}})
+	if req.Thinking != nil || req.Temperature == nil || *req.Temperature != 0 {
+		t.Errorf("request = %+v, want no thinking and a temperature of 0", req)
+	}
+
+	if _, err := NewProvider("test-api-key", "", string(Claude37Sonnet), provider.Options{Thinking: provider.Thinking{BudgetTokens: 100}}); err == nil {
+		t.Error("NewProvider() accepted a thinking budget under the minimum")
+	}
+	// Models without thinking ignore the budget
+	if _, err := NewProvider("test-api-key", "", string(Claude35Sonnet), provider.Options{Thinking: provider.Thinking{BudgetTokens: 100}}); err != nil {
+		t.Errorf("NewProvider() error = %v for a model without thinking", err)
+	}
+}
+
+func TestGenerationOptions(t *testing.T) {
+	messages := []provider.Message{{Role: "user", Content: "task"}}
+	req := captureRequest(t, provider.Options{}, messages)
+	if req.MaxTokens != Models[Claude37Sonnet].MaxOutputTokens || req.TopP != nil {
+		t.Errorf("max_tokens = %d, top_p = %v, want the output limit of the model", req.MaxTokens, req.TopP)
+	}
+
+	// The settings of the request take precedence over those of the provider
+	temperature, topP := 0.7, 0.9
+	opts := provider.Options{
+		Thinking:   provider.Thinking{Disabled: true},
+		Generation: provider.GenerationOptions{TopP: &topP, MaxOutputTokens: 4096},
+	}
+	req = captureGeneration(t, opts, provider.GenerationOptions{Temperature: &temperature, MaxOutputTokens: 2048}, messages)
+	if req.MaxTokens != 2048 || req.Temperature == nil || *req.Temperature != 0.7 || req.TopP == nil || *req.TopP != 0.9 {
+		t.Errorf("request = %+v, want the settings of the request and the provider", req)
+	}
+
+	p, _ := NewProvider("test-api-key", "", string(Claude37Sonnet), provider.Options{})
+	if _, err := p.CreateMessage(context.Background(), "", messages, provider.GenerationOptions{MaxOutputTokens: DefaultThinkingBudget}); err == nil {
+		t.Error("CreateMessage() accepted an output limit leaving no room after the thinking budget")
+	}
+	if _, err := NewProvider("test-api-key", "", string(Claude37Sonnet), provider.Options{Generation: provider.GenerationOptions{MaxOutputTokens: 4096}}); err == nil {
+		t.Error("NewProvider() accepted an output limit under the thinking budget")
+	}
+}
+
+func TestToolBlocks(t *testing.T) {
+	messages := []provider.Message{
+		{Role: "user", Content: "list the files"},
+		{
+			Role:      "assistant",
+			Content:   "Listing them.",
+			Thinking:  []provider.ThinkingBlock{{Thinking: "use ls", Signature: "sig"}, {Data: "encrypted"}},
+			ToolCalls: []provider.ToolCall{{ID: "toolu_1", Name: "list_files"}},
+		},
+		{Role: "user", ToolResults: []provider.ToolResult{{ToolCallID: "toolu_1", Content: "main.go"}}, CacheHint: true},
+	}
+
+	req := captureRequest(t, provider.Options{}, messages)
+	var types []string
+	for _, block := range req.Messages[1].Content {
+		types = append(types, block.Type)
+	}
+	if got := strings.Join(types, ","); got != "thinking,redacted_thinking,text,tool_use" {
+		t.Errorf("assistant blocks = %s", got)
+	}
+	call := req.Messages[1].Content[3]
+	if call.ID != "toolu_1" || call.Name != "list_files" || string(call.Input) != "{}" {
+		t.Errorf("tool_use block = %+v", call)
+	}
+	if req.Messages[1].Content[0].Signature != "sig" || req.Messages[1].Content[1].Data != "encrypted" {
+		t.Errorf("thinking blocks = %+v, want them sent back unchanged", req.Messages[1].Content[:2])
+	}
+	result := req.Messages[2].Content
+	if len(result) != 1 || result[0].Type != "tool_result" || result[0].ToolUseID != "toolu_1" || result[0].Content != "main.go" || result[0].CacheControl == nil {
+		t.Errorf("user blocks = %+v, want only the cached tool result", result)
+	}
+}
+
+func TestImageBlocks(t *testing.T) {
+	messages := []provider.Message{
+		{Role: "user", Content: "what is wrong here?", Images: []provider.Image{{MediaType: "image/png", Data: []byte("png")}}},
+	}
+
+	req := captureRequest(t, provider.Options{}, messages)
+	blocks := req.Messages[0].Content
+	if len(blocks) != 2 || blocks[0].Type != "image" || blocks[1].Type != "text" {
+		t.Fatalf("user blocks = %+v, want the image then the text", blocks)
+	}
+	if source := blocks[0].Source; source == nil || source.Type != "base64" || source.MediaType != "image/png" || source.Data != "cG5n" {
+		t.Errorf("image source = %+v", source)
+	}
+
+	p, err := NewProvider("test-api-key", "", string(Claude35Haiku), provider.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Capabilities().Vision {
+		t.Errorf("%s reads images", Claude35Haiku)
+	}
+}
+
+func TestStreamBlocks(t *testing.T) {
+	stream := []string{
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"read the file"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"encrypted"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"main.go\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range stream {
+			io.WriteString(w, "data: "+data+"\n\n")
+		}
+	}))
+	defer server.Close()
+
+	p, err := NewProvider("test-api-key", server.URL, string(Claude37Sonnet), provider.Options{})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	events, err := p.CreateMessage(context.Background(), "", []provider.Message{{Role: "user", Content: "read main.go"}}, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+	var reasoning string
+	var thinking []provider.ThinkingBlock
+	var calls []provider.ToolCall
+	for event := range events {
+		switch event.Type {
+		case "reasoning":
+			reasoning += event.Reasoning
+		case "thinking_block":
+			thinking = append(thinking, *event.ThinkingBlock)
+		case "tool_use":
+			calls = append(calls, *event.ToolCall)
+		}
+	}
+
+	if !strings.HasPrefix(reasoning, "read the file") || !strings.Contains(reasoning, redactedThinking) {
+		t.Errorf("reasoning = %q, want the thinking and the redacted block", reasoning)
+	}
+	if len(thinking) != 2 || thinking[0].Thinking != "read the file" || thinking[0].Signature != "sig" || !thinking[1].Redacted() || thinking[1].Data != "encrypted" {
+		t.Errorf("thinking blocks = %+v", thinking)
+	}
+	if len(calls) != 1 || calls[0].ID != "toolu_1" || calls[0].Name != "read_file" || string(calls[0].Input) != `{"path":"main.go"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+}
@@ -19,7 +19,7 @@ func main() {
 	}
 
 	// Create an Anthropic provider
-	p, err := provider.Create("anthropic", apiKey, "", "")
+	p, err := provider.Create("anthropic", apiKey, "", "", provider.Options{Timeouts: provider.DefaultTimeouts()})
 	if err != nil {
 		log.Fatalf("Failed to create Anthropic provider: %v", err)
 	}
@@ -44,7 +44,7 @@ func main() {
 
 	// Send a message to the Anthropic API
 	fmt.Println("\nSending message to Anthropic API...")
-	eventCh, err := p.CreateMessage(ctx, systemPrompt, messages)
+	eventCh, err := p.CreateMessage(ctx, systemPrompt, messages, provider.GenerationOptions{})
 	if err != nil {
 		log.Fatalf("Failed to create message: %v", err)
 	}
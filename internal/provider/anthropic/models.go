@@ -24,6 +24,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	Claude3Opus: {
 		Name:                string(Claude3Opus),
 		MaxTokens:           200000,
+		MaxOutputTokens:     4096,
 		InputCostPer1K:      0.015,
 		OutputCostPer1K:     0.075,
 		CacheWriteCostPer1K: 0.01875,
@@ -32,6 +33,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	Claude3Haiku: {
 		Name:                string(Claude3Haiku),
 		MaxTokens:           200000,
+		MaxOutputTokens:     4096,
 		InputCostPer1K:      0.00025,
 		OutputCostPer1K:     0.00125,
 		CacheWriteCostPer1K: 0.0003,
@@ -40,6 +42,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	Claude35Sonnet: {
 		Name:                string(Claude35Sonnet),
 		MaxTokens:           200000,
+		MaxOutputTokens:     8192,
 		InputCostPer1K:      0.003,
 		OutputCostPer1K:     0.015,
 		CacheWriteCostPer1K: 0.00375,
@@ -48,6 +51,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	Claude35Haiku: {
 		Name:                string(Claude35Haiku),
 		MaxTokens:           200000,
+		MaxOutputTokens:     8192,
 		InputCostPer1K:      0.0008,
 		OutputCostPer1K:     0.004,
 		CacheWriteCostPer1K: 0.001,
@@ -56,6 +60,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	Claude37Sonnet: {
 		Name:                string(Claude37Sonnet),
 		MaxTokens:           200000,
+		MaxOutputTokens:     64000,
 		InputCostPer1K:      0.003,
 		OutputCostPer1K:     0.015,
 		CacheWriteCostPer1K: 0.00375,
@@ -0,0 +1,89 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// structuredMaxTokens limits the length of structured responses, which are short objects
+const structuredMaxTokens = 4096
+
+// MessageResponse represents a response to a message request that is not streamed
+type MessageResponse struct {
+	Content []ResponseBlock `json:"content"`
+	Usage   Usage           `json:"usage"`
+}
+
+// ResponseBlock represents a content block of a response that is not streamed
+type ResponseBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// CreateStructuredMessage forces the model to call a tool whose input schema is the schema
+// of the response, and returns the input of the call
+func (p *Provider) CreateStructuredMessage(ctx context.Context, schema provider.Schema, messages []provider.Message) (*provider.StructuredResponse, error) {
+	// Thinking cannot be enabled when the tool choice is forced, and the temperature is 0 for
+	// deterministic responses
+	temperature := 0.0
+	maxTokens := min(p.modelInfo.MaxOutputTokens, structuredMaxTokens)
+	req := &MessageRequest{
+		Model:       string(p.modelID),
+		MaxTokens:   maxTokens,
+		Messages:    p.convertMessages(messages),
+		Temperature: &temperature,
+		Tools: []Tool{{
+			Name:        schema.Name,
+			Description: schema.Description,
+			InputSchema: schema.Parameters,
+		}},
+		ToolChoice: &ToolChoice{Type: "tool", Name: schema.Name},
+	}
+
+	httpReq, err := p.newRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	}
+
+	var message MessageResponse
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	usage := message.Usage
+	structured := &provider.StructuredResponse{
+		Usage: provider.Usage{
+			InputTokens:      usage.InputTokens,
+			OutputTokens:     usage.OutputTokens,
+			CacheReadTokens:  usage.CacheReadInputTokens,
+			CacheWriteTokens: usage.CacheCreationInputTokens,
+			TotalCost:        calculateCost(p.modelInfo, usage.InputTokens, usage.OutputTokens, usage.CacheCreationInputTokens, usage.CacheReadInputTokens),
+		},
+	}
+	for _, block := range message.Content {
+		if block.Type == "tool_use" && block.Name == schema.Name {
+			structured.Content = block.Input
+			return structured, nil
+		}
+	}
+	return structured, fmt.Errorf("response does not call the %s tool", schema.Name)
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// connectivityErrnos are the system errors of a network or a server that cannot be reached
+var connectivityErrnos = []syscall.Errno{
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.ENETDOWN,
+	syscall.ENETUNREACH,
+	syscall.EHOSTUNREACH,
+	syscall.EPIPE,
+}
+
+// IsConnectivityError reports whether a request failed because the provider could not be
+// reached or the connection was lost, as opposed to an error reported by the API. Such a
+// request can be sent again as is once the connection is back. An unknown host or a
+// certificate that cannot be verified is a configuration error, which waiting does not fix.
+func IsConnectivityError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isPermanentNetworkError(err) {
+		return false
+	}
+	if errors.Is(err, ErrReadTimeout) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range connectivityErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isPermanentNetworkError reports whether a network error fails every attempt until the
+// configuration changes: the host of the endpoint does not exist, or TLS cannot be set up with
+// it, e.g. its certificate is not trusted
+func isPermanentNetworkError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return true
+	}
+	var verificationErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	return errors.As(err, &verificationErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthorityErr) || errors.As(err, &invalidErr) || errors.As(err, &hostnameErr)
+}
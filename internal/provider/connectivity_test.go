@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsConnectivityError(t *testing.T) {
+	// A server that stopped listening refuses the connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	_, refused := NewHTTPClient(Timeouts{Connect: time.Second}).Get(url)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"refused connection", refused, true},
+		{"DNS failure", &net.DNSError{Err: "no such host", Name: "api.example.com"}, true},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "api.example.com", IsNotFound: true}, false},
+		{"untrusted certificate", fmt.Errorf("failed to send request: %w", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), false},
+		{"TLS alert", &net.OpError{Op: "remote error", Net: "tcp", Err: tls.AlertError(42)}, false},
+		{"stalled stream", fmt.Errorf("stream error: %w", ErrReadTimeout), true},
+		{"stream event", StreamEvent{Type: "error", Text: "Error: offline", Err: refused}.AsError(), true},
+		{"API error", StreamEvent{Type: "error", Text: "API error: 400 Bad Request"}.AsError(), false},
+		{"other error", errors.New("invalid request"), false},
+		{"no error", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsConnectivityError(tt.err); got != tt.want {
+			t.Errorf("%s: IsConnectivityError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
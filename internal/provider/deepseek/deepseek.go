@@ -1,9 +1,15 @@
 package deepseek
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"strings"
 
 	"github.com/kazz187/goline/internal/provider"
@@ -13,15 +19,21 @@ import (
 // DefaultEndpoint is the default DeepSeek API endpoint
 const DefaultEndpoint = "https://api.deepseek.com/v1"
 
-// Provider implements the provider.Provider interface for DeepSeek
+// Provider implements the provider.Provider interface for DeepSeek.
+// It speaks the OpenAI chat completions API, so it also works with OpenAI-compatible gateways.
 type Provider struct {
-	client    *openai.Client
-	modelID   ModelID
-	modelInfo provider.ModelInfo
+	client       *http.Client
+	apiKey       string
+	endpoint     string
+	streamFormat provider.StreamFormat
+	modelID      ModelID
+	modelInfo    provider.ModelInfo
+	// generation are the sampling settings of the requests that do not set them
+	generation provider.GenerationOptions
 }
 
 // NewProvider creates a new DeepSeek provider
-func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error) {
+func NewProvider(apiKey, endpoint, modelName string, opts provider.Options) (provider.Provider, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("DeepSeek API key is required")
 	}
@@ -30,10 +42,14 @@ func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error)
 		endpoint = DefaultEndpoint
 	}
 
-	// Create OpenAI client with DeepSeek endpoint
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = endpoint
-	client := openai.NewClientWithConfig(config)
+	// Check the stream format early, so a typo in the configuration fails before the first request
+	streamFormat := opts.StreamFormat
+	if streamFormat == "" {
+		streamFormat = provider.DefaultStreamFormat
+	}
+	if err := provider.CheckStreamFormat(streamFormat); err != nil {
+		return nil, err
+	}
 
 	// Determine model ID
 	modelID := getModelID(modelName)
@@ -43,9 +59,13 @@ func NewProvider(apiKey, endpoint, modelName string) (provider.Provider, error)
 	}
 
 	return &Provider{
-		client:    client,
-		modelID:   modelID,
-		modelInfo: modelInfo,
+		client:       opts.HTTPClient(),
+		apiKey:       apiKey,
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		streamFormat: streamFormat,
+		modelID:      modelID,
+		modelInfo:    modelInfo,
+		generation:   opts.Generation,
 	}, nil
 }
 
@@ -67,65 +87,63 @@ func getModelID(modelName string) ModelID {
 }
 
 // CreateMessage sends a message to the DeepSeek API and returns a stream of events
-func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message) (chan provider.StreamEvent, error) {
+func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
 	eventCh := make(chan provider.StreamEvent)
 
 	// Convert messages to OpenAI format
-	openAIMessages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemPrompt,
-		},
-	}
-
-	// Add user and assistant messages
-	for _, msg := range messages {
-		role := openai.ChatMessageRoleUser
-		if msg.Role == "assistant" {
-			role = openai.ChatMessageRoleAssistant
-		}
-
-		openAIMessages = append(openAIMessages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
-	}
+	openAIMessages := convertMessages(systemPrompt, messages)
 
 	// Check if we're using the reasoner model
-	isReasoner := strings.Contains(string(p.modelID), "reasoner")
+	isReasoner := p.Capabilities().Reasoning
 
-	// Create request
+	// Create request, with the output limited to the output tokens of the model unless a
+	// lower limit is set
+	opts = opts.WithDefaults(p.generation)
 	req := openai.ChatCompletionRequest{
 		Model:     string(p.modelID),
 		Messages:  openAIMessages,
 		Stream:    true,
-		MaxTokens: p.modelInfo.MaxTokens,
+		MaxTokens: cmp.Or(opts.MaxOutputTokens, p.modelInfo.MaxOutputTokens),
 	}
 
-	// Only set temperature for non-reasoner models
+	// Only set the sampling for non-reasoner models, which ignore it. The temperature is 0 for
+	// deterministic responses unless another one is set.
 	if !isReasoner {
-		req.Temperature = 0
+		temperature := 0.0
+		req.Temperature = provider.OpenAISetting(cmp.Or(opts.Temperature, &temperature))
+		req.TopP = provider.OpenAISetting(opts.TopP)
 	}
 
 	// Start streaming in a goroutine
 	go func() {
 		defer close(eventCh)
 
-		stream, err := p.client.CreateChatCompletionStream(ctx, req)
+		body, err := p.openStream(ctx, req)
 		if err != nil {
 			slog.Error("Failed to create chat completion stream", "error", err)
 			eventCh <- provider.StreamEvent{
 				Type: "error",
 				Text: fmt.Sprintf("Error: %v", err),
+				Err:  err,
+			}
+			return
+		}
+		defer body.Close()
+
+		decoder, err := provider.NewStreamDecoder(p.streamFormat, body)
+		if err != nil {
+			eventCh <- provider.StreamEvent{
+				Type: "error",
+				Text: fmt.Sprintf("Error: %v", err),
+				Err:  err,
 			}
 			return
 		}
-		defer stream.Close()
 
 		for {
-			response, err := stream.Recv()
+			chunk, err := decoder.Next()
 			if err != nil {
-				if strings.Contains(err.Error(), "stream closed") {
+				if errors.Is(err, io.EOF) {
 					// Stream closed normally
 					return
 				}
@@ -133,10 +151,26 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 				eventCh <- provider.StreamEvent{
 					Type: "error",
 					Text: fmt.Sprintf("Stream error: %v", err),
+					Err:  err,
+				}
+				return
+			}
+
+			// Gateways report failures in the middle of a stream as an error object
+			if apiErr := parseError(chunk); apiErr != nil {
+				eventCh <- provider.StreamEvent{
+					Type: "error",
+					Text: fmt.Sprintf("Stream error: %v", apiErr),
 				}
 				return
 			}
 
+			var response openai.ChatCompletionStreamResponse
+			if err := json.Unmarshal(chunk, &response); err != nil {
+				slog.Error("Failed to parse stream chunk", "error", err, "data", string(chunk))
+				continue
+			}
+
 			// Process the response
 			if len(response.Choices) > 0 {
 				delta := response.Choices[0].Delta
@@ -152,6 +186,17 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 				// Note: The go-openai library doesn't directly expose reasoning_content
 				// For DeepSeek reasoner models, we would need to extend the library
 				// or use a custom implementation to access this field
+
+				if reason := response.Choices[0].FinishReason; reason != "" {
+					stopReason := string(reason)
+					if reason == openai.FinishReasonLength {
+						stopReason = provider.StopReasonMaxTokens
+					}
+					eventCh <- provider.StreamEvent{
+						Type:       "stop",
+						StopReason: stopReason,
+					}
+				}
 			}
 
 			// Handle usage information
@@ -186,6 +231,79 @@ func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messa
 	return eventCh, nil
 }
 
+// convertMessages converts the system prompt and the messages to the OpenAI format
+func convertMessages(systemPrompt string, messages []provider.Message) []openai.ChatCompletionMessage {
+	openAIMessages := []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+		},
+	}
+
+	// Add user and assistant messages
+	for _, msg := range messages {
+		role := openai.ChatMessageRoleUser
+		if msg.Role == "assistant" {
+			role = openai.ChatMessageRoleAssistant
+		}
+
+		openAIMessages = append(openAIMessages, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: msg.Content,
+		})
+	}
+	return openAIMessages
+}
+
+// openStream sends a streaming chat completion request and returns the response body
+func (p *Provider) openStream(ctx context.Context, req openai.ChatCompletionRequest) (io.ReadCloser, error) {
+	accept := "application/x-ndjson, application/json"
+	if p.streamFormat == provider.StreamFormatSSE {
+		accept = "text/event-stream"
+	}
+	return p.post(ctx, req, accept)
+}
+
+// post sends a chat completion request and returns the response body
+func (p *Provider) post(ctx context.Context, req openai.ChatCompletionRequest, accept string) (io.ReadCloser, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set("Accept", accept)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if apiErr := parseError(body); apiErr != nil {
+			return nil, fmt.Errorf("API error: %s - %w", resp.Status, apiErr)
+		}
+		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// parseError returns the error object of an API response, or nil if there is none
+func parseError(data []byte) *openai.APIError {
+	var errResp openai.ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error == nil || errResp.Error.Message == "" {
+		return nil
+	}
+	return errResp.Error
+}
+
 // calculateCost calculates the cost of an API call
 func calculateCost(info provider.ModelInfo, inputTokens, outputTokens, cacheWriteTokens, cacheReadTokens int) float64 {
 	inputCost := float64(inputTokens) * info.InputCostPer1K / 1000
@@ -201,6 +319,16 @@ func (p *Provider) GetModel() provider.ModelInfo {
 	return p.modelInfo
 }
 
+// Capabilities returns the capabilities of the model. The API caches the prefixes of the
+// requests on its own.
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Reasoning:       p.modelID == DeepSeekReasoner,
+		Caching:         true,
+		MaxOutputTokens: p.modelInfo.MaxOutputTokens,
+	}
+}
+
 // Name returns the name of the provider
 func (p *Provider) Name() string {
 	return "deepseek"
@@ -1,14 +1,19 @@
 package deepseek
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/kazz187/goline/internal/provider"
+	"github.com/sashabaranov/go-openai"
 )
 
 func TestProviderRegistration(t *testing.T) {
 	// Create a provider with valid parameters
-	p, err := NewProvider("test-api-key", "", "")
+	p, err := NewProvider("test-api-key", "", "", provider.Options{})
 	if err != nil {
 		t.Fatalf("Failed to create provider: %v", err)
 	}
@@ -54,7 +59,7 @@ func TestProviderFactory(t *testing.T) {
 	}
 
 	// Create a provider using the factory
-	p, err := factory("test-api-key", "", "")
+	p, err := factory("test-api-key", "", "", provider.Options{})
 	if err != nil {
 		t.Fatalf("Failed to create provider using factory: %v", err)
 	}
@@ -64,3 +69,138 @@ func TestProviderFactory(t *testing.T) {
 		t.Errorf("Expected provider name to be 'deepseek', got '%s'", p.Name())
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	for model, reasoning := range map[ModelID]bool{DeepSeekChat: false, DeepSeekReasoner: true} {
+		p, err := NewProvider("test-api-key", "", string(model), provider.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		capabilities := p.Capabilities()
+		if capabilities.Reasoning != reasoning || capabilities.Vision || capabilities.MaxOutputTokens != Models[model].MaxOutputTokens {
+			t.Errorf("Capabilities() of %s = %+v", model, capabilities)
+		}
+	}
+}
+
+func TestStreamFormats(t *testing.T) {
+	bodies := map[provider.StreamFormat]string{
+		provider.StreamFormatSSE: "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\" world\"},\"finish_reason\":\"length\"}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2}}\n\n" +
+			"data: [DONE]\n\n",
+		provider.StreamFormatNDJSON: "{\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n" +
+			"{\"choices\":[{\"delta\":{\"content\":\" world\"},\"finish_reason\":\"length\"}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2}}\n",
+	}
+
+	for format, body := range bodies {
+		t.Run(string(format), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer test-api-key" {
+					t.Errorf("Unexpected request: %s %v", r.URL.Path, r.Header)
+				}
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			p, err := NewProvider("test-api-key", server.URL, "", provider.Options{StreamFormat: format})
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+			events, err := p.CreateMessage(context.Background(), "system", []provider.Message{{Role: "user", Content: "hi"}}, provider.GenerationOptions{})
+			if err != nil {
+				t.Fatalf("Failed to create message: %v", err)
+			}
+
+			var text, stopReason string
+			var usage *provider.Usage
+			for event := range events {
+				switch event.Type {
+				case "text":
+					text += event.Text
+				case "usage":
+					usage = event.Usage
+				case "stop":
+					stopReason = event.StopReason
+				case "error":
+					t.Errorf("Unexpected error event: %s", event.Text)
+				}
+			}
+			if text != "Hello world" {
+				t.Errorf("Expected streamed text, got %q", text)
+			}
+			if usage == nil || usage.InputTokens != 10 || usage.OutputTokens != 2 {
+				t.Errorf("Unexpected usage: %+v", usage)
+			}
+			if stopReason != provider.StopReasonMaxTokens {
+				t.Errorf("Expected the length finish reason as %q, got %q", provider.StopReasonMaxTokens, stopReason)
+			}
+		})
+	}
+}
+
+func TestUnknownStreamFormat(t *testing.T) {
+	if _, err := NewProvider("test-api-key", "", "", provider.Options{StreamFormat: "xml"}); err == nil {
+		t.Error("Expected an error for an unknown stream format")
+	}
+}
+
+func TestCreateStructuredMessage(t *testing.T) {
+	var req openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"subject\":\"Fix\"}"}}],"usage":{"prompt_tokens":12,"completion_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	p, err := NewProvider("test-api-key", server.URL, "", provider.Options{})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	schema := provider.Schema{Name: "commit_message", Parameters: json.RawMessage(`{"type":"object"}`)}
+	resp, err := p.(provider.StructuredProvider).CreateStructuredMessage(context.Background(), schema, []provider.Message{{Role: "user", Content: "diff"}})
+	if err != nil {
+		t.Fatalf("CreateStructuredMessage() error = %v", err)
+	}
+	if string(resp.Content) != `{"subject":"Fix"}` || resp.Usage.InputTokens != 12 {
+		t.Errorf("response = %s, %+v", resp.Content, resp.Usage)
+	}
+	if req.Stream || req.ResponseFormat == nil || req.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeJSONObject {
+		t.Errorf("request = %+v, want the JSON mode without streaming", req)
+	}
+}
+
+func TestGenerationOptions(t *testing.T) {
+	var req openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	send := func(p provider.Provider, opts provider.GenerationOptions) {
+		t.Helper()
+		events, err := p.CreateMessage(context.Background(), "system", []provider.Message{{Role: "user", Content: "hi"}}, opts)
+		if err != nil {
+			t.Fatalf("CreateMessage() error = %v", err)
+		}
+		for range events {
+		}
+	}
+
+	p, _ := NewProvider("test-api-key", server.URL, "", provider.Options{})
+	send(p, provider.GenerationOptions{})
+	if req.MaxTokens != Models[DeepSeekChat].MaxOutputTokens || req.Temperature == 0 || req.Temperature > 1e-6 || req.TopP != 0 {
+		t.Errorf("request = %+v, want the output limit of the model and a temperature of 0", req)
+	}
+
+	temperature, topP := 0.7, 0.9
+	p, _ = NewProvider("test-api-key", server.URL, "", provider.Options{Generation: provider.GenerationOptions{TopP: &topP}})
+	send(p, provider.GenerationOptions{Temperature: &temperature, MaxOutputTokens: 1024})
+	if req.MaxTokens != 1024 || req.Temperature != 0.7 || req.TopP != 0.9 {
+		t.Errorf("request = %+v, want the settings of the request and the provider", req)
+	}
+}
@@ -19,7 +19,7 @@ func main() {
 	}
 
 	// Create a DeepSeek provider
-	p, err := provider.Create("deepseek", apiKey, "", "")
+	p, err := provider.Create("deepseek", apiKey, "", "", provider.Options{Timeouts: provider.DefaultTimeouts()})
 	if err != nil {
 		log.Fatalf("Failed to create DeepSeek provider: %v", err)
 	}
@@ -44,7 +44,7 @@ func main() {
 
 	// Send a message to the DeepSeek API
 	fmt.Println("\nSending message to DeepSeek API...")
-	eventCh, err := p.CreateMessage(ctx, systemPrompt, messages)
+	eventCh, err := p.CreateMessage(ctx, systemPrompt, messages, provider.GenerationOptions{})
 	if err != nil {
 		log.Fatalf("Failed to create message: %v", err)
 	}
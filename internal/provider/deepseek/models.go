@@ -21,6 +21,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	DeepSeekChat: {
 		Name:                string(DeepSeekChat),
 		MaxTokens:           64000,
+		MaxOutputTokens:     8192,
 		InputCostPer1K:      0.00027,
 		OutputCostPer1K:     0.0011,
 		CacheWriteCostPer1K: 0.00027,
@@ -29,6 +30,7 @@ var Models = map[ModelID]provider.ModelInfo{
 	DeepSeekReasoner: {
 		Name:                string(DeepSeekReasoner),
 		MaxTokens:           64000,
+		MaxOutputTokens:     8192,
 		InputCostPer1K:      0.00055,
 		OutputCostPer1K:     0.00219,
 		CacheWriteCostPer1K: 0.00055,
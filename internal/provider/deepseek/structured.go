@@ -0,0 +1,56 @@
+package deepseek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/sashabaranov/go-openai"
+)
+
+// structuredMaxTokens limits the length of structured responses, which are short objects
+const structuredMaxTokens = 4096
+
+// CreateStructuredMessage sends the messages in JSON mode and returns the JSON object answered.
+// The JSON mode does not take a schema, so the schema is given in the system prompt.
+func (p *Provider) CreateStructuredMessage(ctx context.Context, schema provider.Schema, messages []provider.Message) (*provider.StructuredResponse, error) {
+	req := openai.ChatCompletionRequest{
+		Model:     string(p.modelID),
+		Messages:  convertMessages(provider.StructuredSystemPrompt(schema), messages),
+		MaxTokens: min(p.modelInfo.MaxOutputTokens, structuredMaxTokens),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	}
+
+	body, err := p.post(ctx, req, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp openai.ChatCompletionResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	structured := &provider.StructuredResponse{
+		Usage: provider.Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			TotalCost:    calculateCost(p.modelInfo, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, 0, 0),
+		},
+	}
+	if len(resp.Choices) == 0 {
+		return structured, errors.New("response has no choices")
+	}
+
+	// The JSON mode may answer an empty content when the response is cut by the token limit
+	content, err := provider.ExtractJSONObject(resp.Choices[0].Message.Content)
+	if err != nil {
+		return structured, err
+	}
+	structured.Content = content
+	return structured, nil
+}
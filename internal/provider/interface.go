@@ -2,7 +2,14 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"io"
+	"maps"
+	"math"
+	"slices"
+	"time"
 )
 
 // Message represents a message in a conversation
@@ -13,6 +20,70 @@ type Message struct {
 	Content string
 	// Optional reasoning content for models that support it
 	ReasoningContent string
+	// CacheHint marks the message as the end of a prefix of the conversation that is sent
+	// again with the next requests. Providers with prompt caching cache the prefix up to it,
+	// others ignore it.
+	CacheHint bool
+	// Thinking are the reasoning blocks of an assistant message as the provider streamed them,
+	// sent back unchanged before its tool calls
+	Thinking []ThinkingBlock
+	// ToolCalls are the tools an assistant message called natively
+	ToolCalls []ToolCall
+	// ToolResults are the results of the tool calls of the previous assistant message, sent in
+	// a user message
+	ToolResults []ToolResult
+	// Images are attached to a user message, for models with Capabilities.Vision
+	Images []Image
+}
+
+// Image is an image attached to a message
+type Image struct {
+	// MediaType is the MIME type of the image, e.g. image/png
+	MediaType string
+	// Data is the encoded image
+	Data []byte
+}
+
+// DataURL returns the image as a base64 data URL, as some APIs take images
+func (i Image) DataURL() string {
+	return "data:" + i.MediaType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// ToolCall is a call of a tool the model made in a block of its response of its own, rather
+// than in its text
+type ToolCall struct {
+	// ID identifies the call, for its result to refer to it
+	ID string
+	// Name is the name of the tool
+	Name string
+	// Input is the JSON object of the arguments of the call
+	Input json.RawMessage
+}
+
+// ToolResult is the result of a ToolCall
+type ToolResult struct {
+	// ToolCallID is the ID of the call
+	ToolCallID string
+	// Content is the output of the tool
+	Content string
+	// IsError tells that the tool failed, Content being its error
+	IsError bool
+}
+
+// ThinkingBlock is a whole block of reasoning, with the signature the provider checks when it
+// is sent back. A redacted block only has its encrypted Data.
+type ThinkingBlock struct {
+	// Thinking is the text of the reasoning
+	Thinking string
+	// Signature verifies that the reasoning was produced by the model
+	Signature string
+	// Data is the encrypted reasoning of a block redacted by the safety systems of the provider
+	Data string
+}
+
+// Redacted reports whether the reasoning of the block is redacted
+func (b ThinkingBlock) Redacted() bool {
+	return b.Data != ""
 }
 
 // Usage represents token usage information
@@ -29,9 +100,14 @@ type Usage struct {
 	TotalCost float64
 }
 
+// StopReasonMaxTokens is the stop reason of a response cut off at the output token limit.
+// Providers report it in place of their own name for it, e.g. "length".
+const StopReasonMaxTokens = "max_tokens"
+
 // StreamEvent represents an event in the response stream
 type StreamEvent struct {
-	// Type of event ("text", "reasoning", "usage")
+	// Type of event ("text", "reasoning", "thinking_block", "tool_use", "usage", "stop", "error",
+	// "throttled")
 	Type string
 	// Text content (for "text" events)
 	Text string
@@ -39,14 +115,91 @@ type StreamEvent struct {
 	Reasoning string
 	// Usage information (for "usage" events)
 	Usage *Usage
+	// StopReason tells why the model stopped generating (for "stop" events), e.g. StopReasonMaxTokens
+	StopReason string
+	// Throttle is how long the request waits for the rate limits of the provider (for "throttled"
+	// events), zero when it waits for other requests to end
+	Throttle time.Duration
+	// ThinkingBlock is a whole block of reasoning once it is streamed (for "thinking_block"
+	// events), its text having been streamed by "reasoning" events
+	ThinkingBlock *ThinkingBlock
+	// ToolCall is a tool called natively by the model (for "tool_use" events)
+	ToolCall *ToolCall
+	// Err is the cause of the failure (for "error" events) when it is an error of the client,
+	// e.g. a lost connection, nil for the errors reported by the API
+	Err error
+}
+
+// AsError returns the failure of an "error" event, its text wrapping Err when it is set
+func (e StreamEvent) AsError() error {
+	if e.Err == nil {
+		return errors.New(e.Text)
+	}
+	return &streamError{text: e.Text, err: e.Err}
+}
+
+// streamError is the failure of an "error" event with its cause
+type streamError struct {
+	text string
+	err  error
+}
+
+// Error implements error
+func (e *streamError) Error() string {
+	return e.text
+}
+
+// Unwrap returns the cause of the failure
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// GenerationOptions are the sampling settings of a request. Unset values fall back to the
+// settings the provider was created with, then to the defaults of the provider.
+type GenerationOptions struct {
+	// Temperature controls the randomness of the response, nil if unset
+	Temperature *float64
+	// TopP samples from the tokens making up this probability mass, nil if unset
+	TopP *float64
+	// MaxOutputTokens is the maximum number of tokens of the response, zero if unset
+	MaxOutputTokens int
+}
+
+// WithDefaults returns the options with their unset values taken from defaults
+func (o GenerationOptions) WithDefaults(defaults GenerationOptions) GenerationOptions {
+	if o.Temperature == nil {
+		o.Temperature = defaults.Temperature
+	}
+	if o.TopP == nil {
+		o.TopP = defaults.TopP
+	}
+	if o.MaxOutputTokens == 0 {
+		o.MaxOutputTokens = defaults.MaxOutputTokens
+	}
+	return o
+}
+
+// OpenAISetting converts a temperature or top_p setting to the float32 fields of the OpenAI API
+// client, which omits them when zero: unset is zero, and an explicit zero is the smallest
+// positive float32
+func OpenAISetting(value *float64) float32 {
+	if value == nil {
+		return 0
+	}
+	if *value == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(*value)
 }
 
 // ModelInfo represents information about a model
 type ModelInfo struct {
 	// Name of the model
 	Name string
-	// Maximum number of tokens the model can process
+	// Maximum number of tokens the model can process, the prompt and the response together
 	MaxTokens int
+	// MaxOutputTokens is the maximum number of tokens of a response
+	MaxOutputTokens int
 	// Cost per 1K input tokens
 	InputCostPer1K float64
 	// Cost per 1K output tokens
@@ -57,20 +210,86 @@ type ModelInfo struct {
 	CacheReadCostPer1K float64
 }
 
+// Capabilities tells which features a model supports beyond streaming text, for the agent
+// loop, the system prompt and the TUI to adapt to the model
+type Capabilities struct {
+	// Tools tells that the model can call tools natively
+	Tools bool
+	// Vision tells that the model can read images
+	Vision bool
+	// Reasoning tells that the model streams its reasoning apart from its response
+	Reasoning bool
+	// Caching tells that the provider caches the prefixes of the conversations sent again,
+	// e.g. up to the cache hints of the messages
+	Caching bool
+	// MaxOutputTokens is the maximum number of tokens of a response, zero if unknown
+	MaxOutputTokens int
+}
+
 // Provider defines the interface for AI providers
 type Provider interface {
 	// CreateMessage sends a message to the AI provider and returns a stream of events
-	CreateMessage(ctx context.Context, systemPrompt string, messages []Message) (chan StreamEvent, error)
+	CreateMessage(ctx context.Context, systemPrompt string, messages []Message, opts GenerationOptions) (chan StreamEvent, error)
 
 	// GetModel returns information about the current model
 	GetModel() ModelInfo
 
+	// Capabilities returns the features the current model supports
+	Capabilities() Capabilities
+
 	// Name returns the name of the provider
 	Name() string
 }
 
+// Options holds the optional settings of a provider
+type Options struct {
+	// Timeouts are the network timeouts, zero values fall back to the defaults
+	Timeouts Timeouts
+	// StreamFormat is the wire format of streamed responses, for providers that support several.
+	// Empty selects the provider's native format.
+	StreamFormat StreamFormat
+	// DisablePromptCaching ignores the cache hints of the messages and does not cache the system prompt
+	DisablePromptCaching bool
+	// Trace records the requests and their raw responses, nil to not record them
+	Trace *TraceRecorder
+	// Thinking configures the extended thinking of the models that support it
+	Thinking Thinking
+	// Model describes the model, for providers whose models are not built in. Its name is the
+	// model name the provider is created with.
+	Model ModelInfo
+	// Capabilities are the features of the model, for providers whose models are not built in
+	Capabilities Capabilities
+	// Generation are the sampling settings of the requests that do not set them
+	Generation GenerationOptions
+}
+
+// Thinking holds the extended thinking settings of a provider
+type Thinking struct {
+	// Disabled turns extended thinking off, it is on by default for the models that support it
+	Disabled bool
+	// BudgetTokens is the maximum number of tokens the model thinks with, zero for the
+	// default of the provider
+	BudgetTokens int
+}
+
+// cacheHintedUserMessages is the number of latest user messages marked by MarkCacheHints
+const cacheHintedUserMessages = 2
+
+// MarkCacheHints marks the last two user messages with a cache hint: the last one is the
+// prefix the next request reuses, and the one before it is the prefix cached by the previous
+// request, read back from the cache by this one
+func MarkCacheHints(messages []Message) {
+	marked := 0
+	for i := len(messages) - 1; i >= 0 && marked < cacheHintedUserMessages; i-- {
+		if messages[i].Role == "user" {
+			messages[i].CacheHint = true
+			marked++
+		}
+	}
+}
+
 // Factory creates a provider instance from configuration
-type Factory func(apiKey, endpoint, modelName string) (Provider, error)
+type Factory func(apiKey, endpoint, modelName string, opts Options) (Provider, error)
 
 // registry of provider factories
 var providerFactories = make(map[string]Factory)
@@ -81,12 +300,17 @@ func Register(name string, factory Factory) {
 }
 
 // Create creates a provider instance
-func Create(name, apiKey, endpoint, modelName string) (Provider, error) {
+func Create(name, apiKey, endpoint, modelName string, opts Options) (Provider, error) {
 	factory, ok := providerFactories[name]
 	if !ok {
 		return nil, ErrProviderNotFound
 	}
-	return factory(apiKey, endpoint, modelName)
+	return factory(apiKey, endpoint, modelName, opts)
+}
+
+// Names returns the names of the registered providers, sorted
+func Names() []string {
+	return slices.Sorted(maps.Keys(providerFactories))
 }
 
 // GetFactory returns a provider factory by name
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMarkCacheHints(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "task"},
+		{Role: "assistant", Content: "answer 1"},
+		{Role: "user", Content: "result 1"},
+		{Role: "assistant", Content: "answer 2"},
+		{Role: "user", Content: "result 2"},
+	}
+	MarkCacheHints(messages)
+
+	for i, want := range []bool{false, false, true, false, true} {
+		if messages[i].CacheHint != want {
+			t.Errorf("message %d CacheHint = %t, want %t", i, messages[i].CacheHint, want)
+		}
+	}
+}
+
+func TestGenerationOptionsWithDefaults(t *testing.T) {
+	temperature, topP, defaultTemperature := 0.0, 0.5, 0.7
+	opts := GenerationOptions{Temperature: &temperature}.WithDefaults(GenerationOptions{
+		Temperature:     &defaultTemperature,
+		TopP:            &topP,
+		MaxOutputTokens: 4096,
+	})
+	if *opts.Temperature != 0 || *opts.TopP != 0.5 || opts.MaxOutputTokens != 4096 {
+		t.Errorf("WithDefaults() = %+v, want the set temperature and the other defaults", opts)
+	}
+
+	if got := OpenAISetting(nil); got != 0 {
+		t.Errorf("OpenAISetting(nil) = %g, want 0 to omit it", got)
+	}
+	if got := OpenAISetting(&temperature); got != math.SmallestNonzeroFloat32 {
+		t.Errorf("OpenAISetting(0) = %g, want a value that is sent", got)
+	}
+	if got := OpenAISetting(&topP); got != 0.5 {
+		t.Errorf("OpenAISetting(0.5) = %g", got)
+	}
+}
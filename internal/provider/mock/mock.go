@@ -0,0 +1,253 @@
+// Package mock implements a provider replaying canned responses from a fixture, for
+// deterministic end-to-end tests of the agent loop and for demos, without API keys.
+//
+// A fixture is a YAML or JSON file listing the responses, replayed one per request:
+//
+//	delay: 20ms            # default delay before each event
+//	responses:
+//	  - text: "<attempt_completion><result>Done</result></attempt_completion>"
+//	  - events:            # the exact events of the stream
+//	      - {type: reasoning, reasoning: "Thinking..."}
+//	      - {type: text, text: "Hello", delay: 1s}
+//	      - {type: usage, usage: {input_tokens: 120, output_tokens: 8}}
+//	      - {type: stop, stop_reason: end_turn}
+//	  - error: "429 Too Many Requests"   # the request fails
+//
+// The provider is registered as "mock" with the path of the fixture as its endpoint.
+package mock
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+	"gopkg.in/yaml.v3"
+)
+
+// Name is the name the provider is registered as
+const Name = "mock"
+
+// DefaultMaxTokens is the context window of the mock model when the fixture does not set one
+const DefaultMaxTokens = 200000
+
+// ErrNoResponse is returned by requests made after all the responses of the fixture were replayed
+var ErrNoResponse = errors.New("no more responses in the mock fixture")
+
+// Fixture is the canned responses replayed by the provider
+type Fixture struct {
+	// Model is the name of the model reported by the provider, "mock" if empty
+	Model string `yaml:"model"`
+	// MaxTokens is the context window of the model, DefaultMaxTokens if zero
+	MaxTokens int `yaml:"max_tokens"`
+	// Delay is the default delay before each event of the responses
+	Delay time.Duration `yaml:"delay"`
+	// Loop replays the responses from the first one after the last one, instead of failing
+	Loop bool `yaml:"loop"`
+	// Vision makes the model report that it reads images, e.g. to test image attachments
+	Vision bool `yaml:"vision"`
+	// Responses are replayed in order, one per request
+	Responses []Response `yaml:"responses"`
+}
+
+// Response is the response to one request
+type Response struct {
+	// Text is streamed as one text event followed by an end_turn stop, when Events is empty
+	Text string `yaml:"text"`
+	// Events are streamed as is
+	Events []Event `yaml:"events"`
+	// Error fails the request with this message before anything is streamed
+	Error string `yaml:"error"`
+	// Delay is the delay before each event of the response, the default one of the fixture if zero
+	Delay time.Duration `yaml:"delay"`
+}
+
+// Event is an event of a streamed response, see provider.StreamEvent. An error event makes the
+// stream fail with its text.
+type Event struct {
+	Type       string `yaml:"type"`
+	Text       string `yaml:"text"`
+	Reasoning  string `yaml:"reasoning"`
+	StopReason string `yaml:"stop_reason"`
+	Usage      *Usage `yaml:"usage"`
+	// Throttle is the wait reported by a throttled event
+	Throttle time.Duration `yaml:"throttle"`
+	// Delay is the delay before the event, that of the response if zero
+	Delay time.Duration `yaml:"delay"`
+}
+
+// Usage is the token usage reported by a usage event
+type Usage struct {
+	InputTokens      int     `yaml:"input_tokens"`
+	OutputTokens     int     `yaml:"output_tokens"`
+	CacheReadTokens  int     `yaml:"cache_read_tokens"`
+	CacheWriteTokens int     `yaml:"cache_write_tokens"`
+	TotalCost        float64 `yaml:"total_cost"`
+}
+
+// Request is a request received by the provider
+type Request struct {
+	SystemPrompt string
+	Messages     []provider.Message
+	Generation   provider.GenerationOptions
+}
+
+// Parse parses a YAML or JSON fixture
+func Parse(data []byte) (*Fixture, error) {
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid mock fixture: %w", err)
+	}
+	for i, response := range fixture.Responses {
+		if response.Text != "" && len(response.Events) > 0 {
+			return nil, fmt.Errorf("invalid mock fixture: response %d sets both text and events", i+1)
+		}
+	}
+	return &fixture, nil
+}
+
+// Load reads a fixture file
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock fixture: %w", err)
+	}
+	return Parse(data)
+}
+
+// Provider replays the responses of a fixture and records the requests it receives
+type Provider struct {
+	fixture  *Fixture
+	mu       sync.Mutex
+	next     int
+	requests []Request
+}
+
+// New creates a provider replaying a fixture
+func New(fixture *Fixture) *Provider {
+	return &Provider{fixture: fixture}
+}
+
+// NewProvider creates a provider replaying the fixture at endpoint. The API key is ignored and
+// modelName overrides the model of the fixture.
+func NewProvider(apiKey, endpoint, modelName string, opts provider.Options) (provider.Provider, error) {
+	if endpoint == "" {
+		return nil, errors.New("the mock provider needs the path of a fixture as its endpoint")
+	}
+	fixture, err := Load(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if modelName != "" {
+		fixture.Model = modelName
+	}
+	return New(fixture), nil
+}
+
+// Requests returns the requests received so far
+func (p *Provider) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Request(nil), p.requests...)
+}
+
+// CreateMessage implements provider.Provider, streaming the next response of the fixture
+func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, Request{SystemPrompt: systemPrompt, Messages: append([]provider.Message(nil), messages...), Generation: opts})
+	if p.next == len(p.fixture.Responses) && p.fixture.Loop {
+		p.next = 0
+	}
+	if p.next >= len(p.fixture.Responses) {
+		p.mu.Unlock()
+		return nil, ErrNoResponse
+	}
+	response := p.fixture.Responses[p.next]
+	p.next++
+	p.mu.Unlock()
+
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	events := response.Events
+	if len(events) == 0 {
+		events = []Event{{Type: "text", Text: response.Text}, {Type: "stop", StopReason: "end_turn"}}
+	}
+	delay := cmp.Or(response.Delay, p.fixture.Delay)
+
+	eventCh := make(chan provider.StreamEvent)
+	go func() {
+		defer close(eventCh)
+		for _, event := range events {
+			if !sleep(ctx, cmp.Or(event.Delay, delay)) {
+				return
+			}
+			select {
+			case eventCh <- event.streamEvent():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return eventCh, nil
+}
+
+// GetModel implements provider.Provider
+func (p *Provider) GetModel() provider.ModelInfo {
+	model := provider.ModelInfo{Name: p.fixture.Model, MaxTokens: p.fixture.MaxTokens}
+	if model.Name == "" {
+		model.Name = Name
+	}
+	if model.MaxTokens == 0 {
+		model.MaxTokens = DefaultMaxTokens
+	}
+	return model
+}
+
+// Capabilities implements provider.Provider
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Vision: p.fixture.Vision}
+}
+
+// Name implements provider.Provider
+func (p *Provider) Name() string {
+	return Name
+}
+
+// streamEvent converts the event to the event of the stream
+func (e Event) streamEvent() provider.StreamEvent {
+	event := provider.StreamEvent{Type: e.Type, Text: e.Text, Reasoning: e.Reasoning, StopReason: e.StopReason, Throttle: e.Throttle}
+	if e.Usage != nil {
+		event.Usage = &provider.Usage{
+			InputTokens:      e.Usage.InputTokens,
+			OutputTokens:     e.Usage.OutputTokens,
+			CacheReadTokens:  e.Usage.CacheReadTokens,
+			CacheWriteTokens: e.Usage.CacheWriteTokens,
+			TotalCost:        e.Usage.TotalCost,
+		}
+	}
+	return event
+}
+
+// sleep waits for d, and reports false if the context was cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func init() {
+	provider.Register(Name, NewProvider)
+}
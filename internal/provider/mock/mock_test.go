@@ -0,0 +1,108 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// collect reads the events of a stream
+func collect(events chan provider.StreamEvent) []provider.StreamEvent {
+	var collected []provider.StreamEvent
+	for event := range events {
+		collected = append(collected, event)
+	}
+	return collected
+}
+
+func TestProviderReplaysFixture(t *testing.T) {
+	p, err := NewProvider("", "testdata/completion.yaml", "", provider.Options{})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	if model := p.GetModel(); model.Name != Name || model.MaxTokens != DefaultMaxTokens {
+		t.Errorf("GetModel() = %+v", model)
+	}
+
+	events, err := p.CreateMessage(context.Background(), "system", []provider.Message{{Role: "user", Content: "Create hello.txt"}}, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := collect(events)
+	if len(first) != 2 || first[0].Type != "text" || !strings.Contains(first[0].Text, "<write_to_file>") || first[1].StopReason != "end_turn" {
+		t.Errorf("first response = %+v, want the text and an end_turn stop", first)
+	}
+
+	events, err = p.CreateMessage(context.Background(), "system", nil, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := collect(events)
+	if len(second) != 4 || second[2].Usage == nil || second[2].Usage.InputTokens != 120 {
+		t.Errorf("second response = %+v, want the events of the fixture", second)
+	}
+
+	if _, err := p.CreateMessage(context.Background(), "system", nil, provider.GenerationOptions{}); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("CreateMessage() error = %v, want ErrNoResponse", err)
+	}
+	if requests := p.(*Provider).Requests(); len(requests) != 3 || requests[0].Messages[0].Content != "Create hello.txt" {
+		t.Errorf("Requests() = %+v", requests)
+	}
+}
+
+func TestProviderInjectsErrorsAndDelays(t *testing.T) {
+	fixture, err := Parse([]byte(`{
+		"loop": true,
+		"delay": "1ms",
+		"responses": [
+			{"error": "429 Too Many Requests"},
+			{"events": [{"type": "text", "text": "partial"}, {"type": "error", "text": "connection reset"}]},
+			{"text": "slow", "delay": "1h"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	p := New(fixture)
+
+	if _, err := p.CreateMessage(context.Background(), "", nil, provider.GenerationOptions{}); err == nil || err.Error() != "429 Too Many Requests" {
+		t.Errorf("CreateMessage() error = %v, want the injected error", err)
+	}
+	events, err := p.CreateMessage(context.Background(), "", nil, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(events); len(got) != 2 || got[1].Type != "error" || got[1].Text != "connection reset" {
+		t.Errorf("events = %+v, want the stream to fail", got)
+	}
+
+	// The delays are cut short by the cancellation of the request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events, err = p.CreateMessage(ctx, "", nil, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(events); len(got) != 0 {
+		t.Errorf("events = %+v, want none before the cancellation", got)
+	}
+
+	// The responses are replayed again from the first one
+	if _, err := p.CreateMessage(context.Background(), "", nil, provider.GenerationOptions{}); err == nil {
+		t.Error("CreateMessage() error = nil, want the first response replayed")
+	}
+}
+
+func TestParseRejectsTextAndEvents(t *testing.T) {
+	_, err := Parse([]byte("responses:\n  - text: hi\n    events: [{type: text, text: hi}]\n"))
+	if err == nil {
+		t.Error("Parse() error = nil, want an error")
+	}
+	if _, err := NewProvider("", "", "", provider.Options{}); err == nil {
+		t.Error("NewProvider() without a fixture error = nil")
+	}
+}
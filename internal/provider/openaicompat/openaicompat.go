@@ -0,0 +1,403 @@
+// Package openaicompat implements a provider for any server speaking the OpenAI chat
+// completions API, such as LM Studio, vLLM, Ollama, Together or Groq. Nothing about the model
+// is built in: its context window, pricing and capabilities come from the configuration.
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Name is the name the provider is registered with
+const Name = "openai-compatible"
+
+// DefaultContextWindow is the context window of a model when the configuration does not give it,
+// small enough for most local models
+const DefaultContextWindow = 8192
+
+// Provider implements the provider.Provider interface for OpenAI-compatible servers
+type Provider struct {
+	client       *http.Client
+	apiKey       string
+	endpoint     string
+	streamFormat provider.StreamFormat
+	modelInfo    provider.ModelInfo
+	capabilities provider.Capabilities
+	// generation are the sampling settings of the requests that do not set them
+	generation provider.GenerationOptions
+}
+
+// NewProvider creates a new OpenAI-compatible provider. The endpoint and the model name are
+// required, the API key is optional as local servers do not check it.
+func NewProvider(apiKey, endpoint, modelName string, opts provider.Options) (provider.Provider, error) {
+	if endpoint == "" {
+		return nil, errors.New("the endpoint of an OpenAI-compatible provider is required, e.g. http://localhost:1234/v1")
+	}
+	if modelName == "" {
+		return nil, errors.New("the model name of an OpenAI-compatible provider is required")
+	}
+
+	// Check the stream format early, so a typo in the configuration fails before the first request
+	streamFormat := opts.StreamFormat
+	if streamFormat == "" {
+		streamFormat = provider.DefaultStreamFormat
+	}
+	if err := provider.CheckStreamFormat(streamFormat); err != nil {
+		return nil, err
+	}
+
+	modelInfo := opts.Model
+	modelInfo.Name = modelName
+	if modelInfo.MaxTokens <= 0 {
+		modelInfo.MaxTokens = DefaultContextWindow
+	}
+
+	return &Provider{
+		client:       opts.HTTPClient(),
+		apiKey:       apiKey,
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		streamFormat: streamFormat,
+		modelInfo:    modelInfo,
+		capabilities: opts.Capabilities,
+		generation:   opts.Generation,
+	}, nil
+}
+
+// streamChunk is a chunk of a streamed chat completion. The go-openai types do not have the
+// reasoning fields servers add to the deltas.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			// ReasoningContent is the reasoning of DeepSeek and vLLM, Reasoning the one of
+			// Ollama, OpenRouter and Groq
+			ReasoningContent string            `json:"reasoning_content"`
+			Reasoning        string            `json:"reasoning"`
+			ToolCalls        []openai.ToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openai.Usage `json:"usage"`
+}
+
+// CreateMessage sends a message to the server and returns a stream of events
+func (p *Provider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	eventCh := make(chan provider.StreamEvent)
+
+	// The settings that are not set are left to the defaults of the server, including the
+	// output limit, the context window of a local model being shared by the prompt and the response
+	opts = opts.WithDefaults(p.generation)
+	req := openai.ChatCompletionRequest{
+		Model:         p.modelInfo.Name,
+		Messages:      p.convertMessages(systemPrompt, messages),
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		MaxTokens:     opts.MaxOutputTokens,
+		Temperature:   provider.OpenAISetting(opts.Temperature),
+		TopP:          provider.OpenAISetting(opts.TopP),
+	}
+
+	go func() {
+		defer close(eventCh)
+
+		body, err := p.openStream(ctx, req)
+		if err != nil {
+			slog.Error("Failed to create chat completion stream", "error", err)
+			eventCh <- provider.StreamEvent{
+				Type: "error",
+				Text: fmt.Sprintf("Error: %v", err),
+				Err:  err,
+			}
+			return
+		}
+		defer body.Close()
+
+		decoder, err := provider.NewStreamDecoder(p.streamFormat, body)
+		if err != nil {
+			eventCh <- provider.StreamEvent{
+				Type: "error",
+				Text: fmt.Sprintf("Error: %v", err),
+				Err:  err,
+			}
+			return
+		}
+
+		// The tool calls are streamed by pieces, and sent once the response is finished
+		calls := make(map[int]*provider.ToolCall)
+		for {
+			data, err := decoder.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					// Stream closed normally
+					return
+				}
+				slog.Error("Error receiving from stream", "error", err)
+				eventCh <- provider.StreamEvent{
+					Type: "error",
+					Text: fmt.Sprintf("Stream error: %v", err),
+					Err:  err,
+				}
+				return
+			}
+
+			// Servers report failures in the middle of a stream as an error object
+			if apiErr := parseError(data); apiErr != nil {
+				eventCh <- provider.StreamEvent{
+					Type: "error",
+					Text: fmt.Sprintf("Stream error: %v", apiErr),
+				}
+				return
+			}
+
+			var chunk streamChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				slog.Error("Failed to parse stream chunk", "error", err, "data", string(data))
+				continue
+			}
+
+			if len(chunk.Choices) > 0 {
+				choice := chunk.Choices[0]
+				if reasoning := choice.Delta.ReasoningContent + choice.Delta.Reasoning; reasoning != "" {
+					eventCh <- provider.StreamEvent{
+						Type:      "reasoning",
+						Reasoning: reasoning,
+					}
+				}
+				if choice.Delta.Content != "" {
+					eventCh <- provider.StreamEvent{
+						Type: "text",
+						Text: choice.Delta.Content,
+					}
+				}
+				for _, call := range choice.Delta.ToolCalls {
+					addToolCall(calls, call)
+				}
+
+				if reason := choice.FinishReason; reason != "" {
+					for _, call := range sortedToolCalls(calls) {
+						eventCh <- provider.StreamEvent{Type: "tool_use", ToolCall: call}
+					}
+					calls = make(map[int]*provider.ToolCall)
+
+					stopReason := reason
+					if reason == string(openai.FinishReasonLength) {
+						stopReason = provider.StopReasonMaxTokens
+					}
+					eventCh <- provider.StreamEvent{
+						Type:       "stop",
+						StopReason: stopReason,
+					}
+				}
+			}
+
+			if chunk.Usage != nil {
+				inputTokens := chunk.Usage.PromptTokens
+				outputTokens := chunk.Usage.CompletionTokens
+				eventCh <- provider.StreamEvent{
+					Type: "usage",
+					Usage: &provider.Usage{
+						InputTokens:  inputTokens,
+						OutputTokens: outputTokens,
+						TotalCost:    calculateCost(p.modelInfo, inputTokens, outputTokens),
+					},
+				}
+			}
+		}
+	}()
+
+	return eventCh, nil
+}
+
+// addToolCall adds a piece of a streamed tool call to the calls by their index
+func addToolCall(calls map[int]*provider.ToolCall, piece openai.ToolCall) {
+	index := 0
+	if piece.Index != nil {
+		index = *piece.Index
+	}
+	call, ok := calls[index]
+	if !ok {
+		call = &provider.ToolCall{}
+		calls[index] = call
+	}
+	if piece.ID != "" {
+		call.ID = piece.ID
+	}
+	if piece.Function.Name != "" {
+		call.Name = piece.Function.Name
+	}
+	call.Input = append(call.Input, piece.Function.Arguments...)
+}
+
+// sortedToolCalls returns the tool calls in the order of their index. A call without arguments
+// has an empty object as its input.
+func sortedToolCalls(calls map[int]*provider.ToolCall) []*provider.ToolCall {
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	sorted := make([]*provider.ToolCall, 0, len(calls))
+	for _, index := range indexes {
+		call := calls[index]
+		if len(call.Input) == 0 {
+			call.Input = json.RawMessage("{}")
+		}
+		sorted = append(sorted, call)
+	}
+	return sorted
+}
+
+// convertMessages converts the system prompt and the messages to the OpenAI format. The native
+// tool calls and results are only sent to models supporting tools, others never make them.
+func (p *Provider) convertMessages(systemPrompt string, messages []provider.Message) []openai.ChatCompletionMessage {
+	var openAIMessages []openai.ChatCompletionMessage
+	if systemPrompt != "" {
+		openAIMessages = append(openAIMessages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+		})
+	}
+
+	for _, msg := range messages {
+		if msg.Role == "assistant" {
+			message := openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: msg.Content,
+			}
+			if p.capabilities.Tools {
+				for _, call := range msg.ToolCalls {
+					message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+						ID:       call.ID,
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: call.Name, Arguments: string(call.Input)},
+					})
+				}
+			}
+			openAIMessages = append(openAIMessages, message)
+			continue
+		}
+
+		// The results of the tool calls are messages of their own, before the text of the user
+		if p.capabilities.Tools {
+			for _, result := range msg.ToolResults {
+				openAIMessages = append(openAIMessages, openai.ChatCompletionMessage{
+					Role:       openai.ChatMessageRoleTool,
+					Content:    result.Content,
+					ToolCallID: result.ToolCallID,
+				})
+			}
+		}
+		if msg.Content != "" || len(msg.ToolResults) == 0 || !p.capabilities.Tools {
+			openAIMessages = append(openAIMessages, p.userMessage(msg))
+		}
+	}
+	return openAIMessages
+}
+
+// userMessage converts the text of a user message and, for models with vision, its images,
+// sent as data URLs after the text
+func (p *Provider) userMessage(msg provider.Message) openai.ChatCompletionMessage {
+	if len(msg.Images) == 0 || !p.capabilities.Vision {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: msg.Content}
+	}
+	parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: msg.Content}}
+	for _, image := range msg.Images {
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: image.DataURL()},
+		})
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: parts}
+}
+
+// openStream sends a streaming chat completion request and returns the response body
+func (p *Provider) openStream(ctx context.Context, req openai.ChatCompletionRequest) (io.ReadCloser, error) {
+	accept := "application/x-ndjson, application/json"
+	if p.streamFormat == provider.StreamFormatSSE {
+		accept = "text/event-stream"
+	}
+	return p.post(ctx, req, accept)
+}
+
+// post sends a chat completion request and returns the response body
+func (p *Provider) post(ctx context.Context, req openai.ChatCompletionRequest, accept string) (io.ReadCloser, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", accept)
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if apiErr := parseError(body); apiErr != nil {
+			return nil, fmt.Errorf("API error: %s - %w", resp.Status, apiErr)
+		}
+		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// parseError returns the error object of an API response, or nil if there is none
+func parseError(data []byte) *openai.APIError {
+	var errResp openai.ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error == nil || errResp.Error.Message == "" {
+		return nil
+	}
+	return errResp.Error
+}
+
+// calculateCost calculates the cost of an API call with the configured pricing, zero for the
+// free local models
+func calculateCost(info provider.ModelInfo, inputTokens, outputTokens int) float64 {
+	inputCost := float64(inputTokens) * info.InputCostPer1K / 1000
+	outputCost := float64(outputTokens) * info.OutputCostPer1K / 1000
+	return inputCost + outputCost
+}
+
+// GetModel returns information about the current model
+func (p *Provider) GetModel() provider.ModelInfo {
+	return p.modelInfo
+}
+
+// Capabilities returns the capabilities of the model set in the configuration
+func (p *Provider) Capabilities() provider.Capabilities {
+	capabilities := p.capabilities
+	capabilities.MaxOutputTokens = p.modelInfo.MaxOutputTokens
+	return capabilities
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return Name
+}
+
+// init registers the OpenAI-compatible provider factory
+func init() {
+	provider.Register(Name, NewProvider)
+}
@@ -0,0 +1,173 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider("", "", "llama3", provider.Options{}); err == nil {
+		t.Error("NewProvider() without an endpoint succeeded")
+	}
+	if _, err := NewProvider("", "http://localhost:1234/v1", "", provider.Options{}); err == nil {
+		t.Error("NewProvider() without a model name succeeded")
+	}
+
+	p, err := provider.Create(Name, "", "http://localhost:1234/v1/", "qwen2.5-coder", provider.Options{
+		Model:        provider.ModelInfo{MaxTokens: 32768, InputCostPer1K: 0.001},
+		Capabilities: provider.Capabilities{Tools: true},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	model := p.GetModel()
+	if model.Name != "qwen2.5-coder" || model.MaxTokens != 32768 || model.InputCostPer1K != 0.001 {
+		t.Errorf("model = %+v, want the configured one", model)
+	}
+	if !p.(*Provider).Capabilities().Tools {
+		t.Error("the configured capabilities are lost")
+	}
+
+	p, _ = NewProvider("", "http://localhost:1234/v1", "llama3", provider.Options{})
+	if p.GetModel().MaxTokens != DefaultContextWindow {
+		t.Errorf("context window = %d, want the default", p.GetModel().MaxTokens)
+	}
+}
+
+func TestCreateMessage(t *testing.T) {
+	var req openai.ChatCompletionRequest
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range []string{
+			`{"choices":[{"delta":{"reasoning_content":"think"}}]}`,
+			`{"choices":[{"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"main.go\"}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"length"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":500}}`,
+		} {
+			io.WriteString(w, "data: "+data+"\n\n")
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p, err := NewProvider("", server.URL, "llama3", provider.Options{
+		Model:        provider.ModelInfo{InputCostPer1K: 0.002, OutputCostPer1K: 0.004},
+		Capabilities: provider.Capabilities{Tools: true},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	events, err := p.CreateMessage(context.Background(), "system", []provider.Message{
+		{Role: "user", Content: "read it"},
+		{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "call_0", Name: "list_files", Input: json.RawMessage(`{}`)}}},
+		{Role: "user", ToolResults: []provider.ToolResult{{ToolCallID: "call_0", Content: "main.go"}}},
+	}, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+
+	var reasoning, text, stopReason string
+	var calls []provider.ToolCall
+	var usage provider.Usage
+	for event := range events {
+		switch event.Type {
+		case "reasoning":
+			reasoning += event.Reasoning
+		case "text":
+			text += event.Text
+		case "tool_use":
+			calls = append(calls, *event.ToolCall)
+		case "stop":
+			stopReason = event.StopReason
+		case "usage":
+			usage = *event.Usage
+		case "error":
+			t.Fatalf("error event: %s", event.Text)
+		}
+	}
+
+	if reasoning != "think" || text != "Hello" || stopReason != provider.StopReasonMaxTokens {
+		t.Errorf("reasoning = %q, text = %q, stop reason = %q", reasoning, text, stopReason)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Name != "read_file" || string(calls[0].Input) != `{"path":"main.go"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if usage.InputTokens != 1000 || usage.TotalCost != 0.004 {
+		t.Errorf("usage = %+v, want the cost of the configured pricing", usage)
+	}
+	if authorization != "" {
+		t.Errorf("Authorization = %q, want none without an API key", authorization)
+	}
+	if req.Model != "llama3" || req.MaxTokens != 0 || req.Temperature != 0 || req.StreamOptions == nil {
+		t.Errorf("request = %+v, want the model without an output limit or a temperature", req)
+	}
+	var roles []string
+	for _, message := range req.Messages {
+		roles = append(roles, message.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool" {
+		t.Errorf("roles = %s", got)
+	}
+}
+
+func TestUserMessageImages(t *testing.T) {
+	msg := provider.Message{Role: "user", Content: "what is it?", Images: []provider.Image{{MediaType: "image/png", Data: []byte("png")}}}
+
+	p := &Provider{capabilities: provider.Capabilities{Vision: true}}
+	parts := p.userMessage(msg).MultiContent
+	if len(parts) != 2 || parts[0].Text != "what is it?" || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,cG5n" {
+		t.Errorf("parts = %+v, want the text then the image as a data URL", parts)
+	}
+
+	p = &Provider{}
+	if message := p.userMessage(msg); message.MultiContent != nil || message.Content != "what is it?" {
+		t.Errorf("message = %+v, want only the text without vision", message)
+	}
+}
+
+func TestCreateStructuredMessage(t *testing.T) {
+	var req openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"plan","arguments":"{\"steps\":[\"read\"]}"}}]}}],"usage":{"prompt_tokens":20,"completion_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	schema := provider.Schema{Name: "plan", Parameters: json.RawMessage(`{"type":"object"}`)}
+	messages := []provider.Message{{Role: "user", Content: "plan it"}}
+
+	p, _ := NewProvider("", server.URL, "llama3", provider.Options{})
+	if _, err := p.(provider.StructuredProvider).CreateStructuredMessage(context.Background(), schema, messages); !errors.Is(err, provider.ErrStructuredUnsupported) {
+		t.Errorf("CreateStructuredMessage() error = %v without tools, want ErrStructuredUnsupported", err)
+	}
+
+	p, _ = NewProvider("", server.URL, "llama3", provider.Options{Capabilities: provider.Capabilities{Tools: true}})
+	resp, err := p.(provider.StructuredProvider).CreateStructuredMessage(context.Background(), schema, messages)
+	if err != nil {
+		t.Fatalf("CreateStructuredMessage() error = %v", err)
+	}
+	if string(resp.Content) != `{"steps":["read"]}` || resp.Usage.InputTokens != 20 {
+		t.Errorf("response = %s, %+v", resp.Content, resp.Usage)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Function.Name != "plan" {
+		t.Errorf("tools = %+v, want the plan function", req.Tools)
+	}
+}
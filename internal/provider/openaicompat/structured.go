@@ -0,0 +1,74 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/sashabaranov/go-openai"
+)
+
+// structuredMaxTokens limits the length of structured responses, which are short objects
+const structuredMaxTokens = 4096
+
+// CreateStructuredMessage forces a model supporting tools to call a function whose parameters
+// are the schema of the response, and returns the arguments of the call. The JSON mode is not
+// used, as servers implement it unevenly: models without tools return
+// provider.ErrStructuredUnsupported, to be asked for the object in the text instead.
+func (p *Provider) CreateStructuredMessage(ctx context.Context, schema provider.Schema, messages []provider.Message) (*provider.StructuredResponse, error) {
+	if !p.capabilities.Tools {
+		return nil, provider.ErrStructuredUnsupported
+	}
+
+	req := openai.ChatCompletionRequest{
+		Model:     p.modelInfo.Name,
+		Messages:  p.convertMessages("", messages),
+		MaxTokens: min(p.modelInfo.MaxTokens, structuredMaxTokens),
+		Tools: []openai.Tool{{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        schema.Name,
+				Description: schema.Description,
+				Parameters:  schema.Parameters,
+			},
+		}},
+		ToolChoice: openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: schema.Name},
+		},
+	}
+
+	body, err := p.post(ctx, req, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var resp openai.ChatCompletionResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	structured := &provider.StructuredResponse{
+		Usage: provider.Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			TotalCost:    calculateCost(p.modelInfo, resp.Usage.PromptTokens, resp.Usage.CompletionTokens),
+		},
+	}
+	if len(resp.Choices) == 0 {
+		return structured, errors.New("response has no choices")
+	}
+	for _, call := range resp.Choices[0].Message.ToolCalls {
+		if call.Function.Name == schema.Name {
+			// Some servers answer arguments that are not valid JSON when the response is cut
+			if !json.Valid([]byte(call.Function.Arguments)) {
+				return structured, provider.ErrNoJSONObject
+			}
+			structured.Content = json.RawMessage(call.Function.Arguments)
+			return structured, nil
+		}
+	}
+	return structured, fmt.Errorf("response does not call the %s function", schema.Name)
+}
@@ -0,0 +1,311 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateWindow is the period the rate limits apply to
+const rateWindow = time.Minute
+
+// charsPerToken is the average length of a token, used to estimate the tokens of a request
+// before it is sent
+const charsPerToken = 4
+
+// RateLimits are the limits of the requests sent to a provider. Zero values are not limited.
+type RateLimits struct {
+	// RequestsPerMinute is the maximum number of requests sent in any minute
+	RequestsPerMinute int
+	// TokensPerMinute is the maximum number of tokens used in any minute, estimated from the
+	// length of the requests until their usage is reported
+	TokensPerMinute int
+	// MaxConcurrent is the maximum number of requests streaming at the same time
+	MaxConcurrent int
+}
+
+// IsZero reports whether nothing is limited
+func (l RateLimits) IsZero() bool {
+	return l.RequestsPerMinute <= 0 && l.TokensPerMinute <= 0 && l.MaxConcurrent <= 0
+}
+
+// RateLimiter keeps the requests of the tasks sharing a provider under its rate limits. The
+// requests over the limits wait in a queue and are sent in order once the limits allow it.
+type RateLimiter struct {
+	// queue is held by the request waiting for the limits, the others wait for it in order
+	queue chan struct{}
+	// finished is signaled when a request ends, for those waiting for a concurrent request
+	finished chan struct{}
+	mu       sync.Mutex
+	limits   RateLimits
+	// window are the requests sent within the last minute
+	window   []*rateUse
+	inflight int
+	now      func() time.Time
+}
+
+// rateUse is a request counted by the limits
+type rateUse struct {
+	at     time.Time
+	tokens int
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		queue:    make(chan struct{}, 1),
+		finished: make(chan struct{}, 1),
+		limits:   limits,
+		now:      time.Now,
+	}
+}
+
+// sharedLimiters are the rate limiters of the providers, shared by all the tasks of the process
+var (
+	sharedLimitersMu sync.Mutex
+	sharedLimiters   = make(map[string]*RateLimiter)
+)
+
+// SharedRateLimiter returns the rate limiter shared by the tasks using a provider, updated to
+// the limits. It returns nil if nothing is limited.
+func SharedRateLimiter(name string, limits RateLimits) *RateLimiter {
+	sharedLimitersMu.Lock()
+	defer sharedLimitersMu.Unlock()
+	limiter, ok := sharedLimiters[name]
+	if limits.IsZero() {
+		if ok {
+			limiter.setLimits(limits)
+		}
+		return nil
+	}
+	if !ok {
+		limiter = NewRateLimiter(limits)
+		sharedLimiters[name] = limiter
+	}
+	limiter.setLimits(limits)
+	return limiter
+}
+
+// setLimits changes the limits
+func (l *RateLimiter) setLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// Reservation is a request admitted by a rate limiter, until it is done
+type Reservation struct {
+	limiter *RateLimiter
+	use     *rateUse
+	once    sync.Once
+}
+
+// Done ends the request, counting the tokens of its usage in place of the estimated ones if
+// it was reported
+func (r *Reservation) Done(usage *Usage) {
+	r.once.Do(func() {
+		l := r.limiter
+		l.mu.Lock()
+		l.inflight--
+		if usage != nil {
+			r.use.tokens = usage.InputTokens + usage.OutputTokens + usage.CacheReadTokens + usage.CacheWriteTokens
+		}
+		l.mu.Unlock()
+		select {
+		case l.finished <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// TryReserve admits a request of an estimated number of tokens if no request waits and the
+// limits allow it now
+func (l *RateLimiter) TryReserve(tokens int) (*Reservation, bool) {
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return nil, false
+	}
+	defer func() { <-l.queue }()
+	r, _, _ := l.reserve(tokens)
+	return r, r != nil
+}
+
+// Wait waits until a request of an estimated number of tokens is allowed by the limits, after
+// the requests waiting before it. throttled is called each time the request has to wait, with
+// how long, or zero if it waits for other requests to end.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int, throttled func(wait time.Duration)) (*Reservation, error) {
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		throttled(0)
+		select {
+		case l.queue <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() { <-l.queue }()
+
+	reported := time.Duration(-1)
+	for {
+		r, wait, concurrent := l.reserve(tokens)
+		if r != nil {
+			return r, nil
+		}
+		if wait != reported {
+			throttled(wait)
+			reported = wait
+		}
+
+		if err := l.sleep(ctx, wait, concurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep waits for the duration if it is not zero, and for a request to end if concurrent is set
+func (l *RateLimiter) sleep(ctx context.Context, wait time.Duration, concurrent bool) error {
+	var timer <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timer = t.C
+	}
+	var finished <-chan struct{}
+	if concurrent {
+		finished = l.finished
+	}
+	select {
+	case <-timer:
+	case <-finished:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// reserve admits a request if the limits allow it now. Otherwise it returns how long to wait
+// for the rate limits, and whether the request waits for concurrent requests to end.
+func (l *RateLimiter) reserve(tokens int) (*Reservation, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for len(l.window) > 0 && now.Sub(l.window[0].at) >= rateWindow {
+		l.window = l.window[1:]
+	}
+
+	var wait time.Duration
+	if limit := l.limits.RequestsPerMinute; limit > 0 && len(l.window) >= limit {
+		wait = max(wait, l.window[len(l.window)-limit].at.Add(rateWindow).Sub(now))
+	}
+	if limit := l.limits.TokensPerMinute; limit > 0 {
+		used := 0
+		for _, use := range l.window {
+			used += use.tokens
+		}
+		// A request over the limit on its own is sent once the window is empty
+		for i := 0; i < len(l.window) && used+tokens > limit; i++ {
+			used -= l.window[i].tokens
+			wait = max(wait, l.window[i].at.Add(rateWindow).Sub(now))
+		}
+	}
+	concurrent := l.limits.MaxConcurrent > 0 && l.inflight >= l.limits.MaxConcurrent
+	if wait > 0 || concurrent {
+		return nil, wait, concurrent
+	}
+
+	use := &rateUse{at: now, tokens: tokens}
+	l.window = append(l.window, use)
+	l.inflight++
+	return &Reservation{limiter: l, use: use}, 0, false
+}
+
+// limitedProvider keeps the requests of a provider under the limits of a rate limiter
+type limitedProvider struct {
+	Provider
+	limiter *RateLimiter
+}
+
+// LimitProvider wraps a provider to keep its requests under the limits of limiter. A request
+// that has to wait streams "throttled" events telling how long before it is sent.
+// A nil limiter limits nothing.
+func LimitProvider(p Provider, limiter *RateLimiter) Provider {
+	if limiter == nil {
+		return p
+	}
+	return &limitedProvider{Provider: p, limiter: limiter}
+}
+
+// CreateMessage implements Provider
+func (p *limitedProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []Message, opts GenerationOptions) (chan StreamEvent, error) {
+	tokens := estimateTokens(systemPrompt, messages)
+	if r, ok := p.limiter.TryReserve(tokens); ok {
+		events, err := p.Provider.CreateMessage(ctx, systemPrompt, messages, opts)
+		if err != nil {
+			r.Done(nil)
+			return nil, err
+		}
+		out := make(chan StreamEvent)
+		go func() {
+			defer close(out)
+			p.forward(ctx, events, out, r)
+		}()
+		return out, nil
+	}
+
+	out := make(chan StreamEvent)
+	go func() {
+		defer close(out)
+		r, err := p.limiter.Wait(ctx, tokens, func(wait time.Duration) {
+			send(ctx, out, StreamEvent{Type: "throttled", Throttle: wait})
+		})
+		if err != nil {
+			return
+		}
+		events, err := p.Provider.CreateMessage(ctx, systemPrompt, messages, opts)
+		if err != nil {
+			r.Done(nil)
+			send(ctx, out, StreamEvent{Type: "error", Text: err.Error(), Err: err})
+			return
+		}
+		p.forward(ctx, events, out, r)
+	}()
+	return out, nil
+}
+
+// forward forwards the events of a stream, then ends the request with its usage
+func (p *limitedProvider) forward(ctx context.Context, events chan StreamEvent, out chan StreamEvent, r *Reservation) {
+	var usage *Usage
+	for event := range events {
+		if event.Type == "usage" && event.Usage != nil {
+			if usage == nil {
+				usage = &Usage{}
+			}
+			usage.InputTokens += event.Usage.InputTokens
+			usage.OutputTokens += event.Usage.OutputTokens
+			usage.CacheReadTokens += event.Usage.CacheReadTokens
+			usage.CacheWriteTokens += event.Usage.CacheWriteTokens
+		}
+		out <- event
+	}
+	r.Done(usage)
+}
+
+// send sends an event unless the request is cancelled
+func send(ctx context.Context, out chan StreamEvent, event StreamEvent) {
+	select {
+	case out <- event:
+	case <-ctx.Done():
+	}
+}
+
+// estimateTokens estimates the number of tokens of a request from its length
+func estimateTokens(systemPrompt string, messages []Message) int {
+	chars := len(systemPrompt)
+	for _, message := range messages {
+		chars += len(message.Content)
+	}
+	return chars / charsPerToken
+}
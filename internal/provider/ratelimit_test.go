@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// streamProvider streams the events sent to its channel, for the tests to control when a stream ends
+type streamProvider struct {
+	events chan StreamEvent
+}
+
+func (p *streamProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []Message, opts GenerationOptions) (chan StreamEvent, error) {
+	return p.events, nil
+}
+
+func (p *streamProvider) GetModel() ModelInfo        { return ModelInfo{Name: "stream"} }
+func (p *streamProvider) Capabilities() Capabilities { return Capabilities{} }
+func (p *streamProvider) Name() string               { return "stream" }
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(RateLimits{RequestsPerMinute: 2, TokensPerMinute: 1000})
+	l.now = func() time.Time { return now }
+
+	first, _, _ := l.reserve(600)
+	if first == nil {
+		t.Fatal("reserve() refused the first request")
+	}
+	now = now.Add(10 * time.Second)
+	if r, wait, _ := l.reserve(600); r != nil || wait != 50*time.Second {
+		t.Errorf("reserve() over the token limit = %v, %s, want to wait 50s", r, wait)
+	}
+	// The usage reported replaces the estimate
+	first.Done(&Usage{InputTokens: 200, OutputTokens: 100})
+	if r, _, _ := l.reserve(600); r == nil {
+		t.Error("reserve() refused a request within the token limit once the usage was reported")
+	}
+	now = now.Add(5 * time.Second)
+	if r, wait, _ := l.reserve(10); r != nil || wait != 45*time.Second {
+		t.Errorf("reserve() over the request limit = %v, %s, want to wait 45s", r, wait)
+	}
+	now = now.Add(45 * time.Second)
+	if r, _, _ := l.reserve(10); r == nil {
+		t.Error("reserve() refused a request once the first one left the window")
+	}
+}
+
+func TestLimitProviderThrottles(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{MaxConcurrent: 1})
+	first := &streamProvider{events: make(chan StreamEvent)}
+	second := &streamProvider{events: make(chan StreamEvent, 1)}
+	second.events <- StreamEvent{Type: "text", Text: "second"}
+	close(second.events)
+
+	firstEvents, err := LimitProvider(first, limiter).CreateMessage(context.Background(), "", nil, GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondEvents, err := LimitProvider(second, limiter).CreateMessage(context.Background(), "", nil, GenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event := <-secondEvents; event.Type != "throttled" || event.Throttle != 0 {
+		t.Errorf("event = %+v, want a throttled event waiting for the first request", event)
+	}
+	close(first.events)
+	for range firstEvents {
+	}
+	select {
+	case event := <-secondEvents:
+		if event.Type != "text" || event.Text != "second" {
+			t.Errorf("event = %+v, want the stream of the second request", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second request was not sent once the first one ended")
+	}
+
+	if SharedRateLimiter("stream", RateLimits{}) != nil {
+		t.Error("SharedRateLimiter() without limits is not nil")
+	}
+	if a, b := SharedRateLimiter("stream", RateLimits{MaxConcurrent: 1}), SharedRateLimiter("stream", RateLimits{MaxConcurrent: 2}); a != b {
+		t.Error("SharedRateLimiter() returned different limiters for one provider")
+	}
+}
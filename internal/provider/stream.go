@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StreamFormat is the wire format of a streamed response
+type StreamFormat string
+
+// Stream formats
+const (
+	// StreamFormatSSE is server-sent events with one JSON chunk per data field, ended by [DONE]
+	StreamFormatSSE StreamFormat = "sse"
+	// StreamFormatJSONL is one JSON chunk per line
+	StreamFormatJSONL StreamFormat = "jsonl"
+	// StreamFormatNDJSON is newline-delimited JSON, the same as JSONL
+	StreamFormatNDJSON StreamFormat = "ndjson"
+)
+
+// DefaultStreamFormat is the stream format used when a provider does not configure one
+const DefaultStreamFormat = StreamFormatSSE
+
+// StreamDecoder splits a streamed response body into its JSON chunks
+type StreamDecoder interface {
+	// Next returns the next JSON chunk, or io.EOF at the end of the stream
+	Next() ([]byte, error)
+}
+
+// StreamDecoderFactory creates a stream decoder reading from r
+type StreamDecoderFactory func(r io.Reader) StreamDecoder
+
+// registry of stream decoder factories
+var streamDecoders = map[StreamFormat]StreamDecoderFactory{
+	StreamFormatSSE:    newSSEDecoder,
+	StreamFormatJSONL:  newJSONStreamDecoder,
+	StreamFormatNDJSON: newJSONStreamDecoder,
+}
+
+// RegisterStreamDecoder registers a stream decoder factory for a format
+func RegisterStreamDecoder(format StreamFormat, factory StreamDecoderFactory) {
+	streamDecoders[format] = factory
+}
+
+// StreamFormats returns the names of all registered stream formats
+func StreamFormats() []string {
+	formats := make([]string, 0, len(streamDecoders))
+	for format := range streamDecoders {
+		formats = append(formats, string(format))
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// CheckStreamFormat returns an error if no decoder is registered for a stream format
+func CheckStreamFormat(format StreamFormat) error {
+	if _, ok := streamDecoders[format]; !ok {
+		return fmt.Errorf("unknown stream format %q, expected one of %s", format, strings.Join(StreamFormats(), ", "))
+	}
+	return nil
+}
+
+// NewStreamDecoder creates a decoder for a stream format.
+// An empty format selects the default format.
+func NewStreamDecoder(format StreamFormat, r io.Reader) (StreamDecoder, error) {
+	if format == "" {
+		format = DefaultStreamFormat
+	}
+	if err := CheckStreamFormat(format); err != nil {
+		return nil, err
+	}
+	return streamDecoders[format](r), nil
+}
+
+// sseDecoder decodes server-sent events
+type sseDecoder struct {
+	reader *bufio.Reader
+}
+
+// newSSEDecoder creates a decoder for server-sent events
+func newSSEDecoder(r io.Reader) StreamDecoder {
+	return &sseDecoder{reader: bufio.NewReader(r)}
+}
+
+// Next implements StreamDecoder.
+// The data fields of an event are joined, other fields and comments are ignored.
+func (d *sseDecoder) Next() ([]byte, error) {
+	var data [][]byte
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+
+			// A blank line ends the event
+			if len(line) == 0 && len(data) > 0 {
+				return d.event(data)
+			}
+			if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+			}
+		}
+
+		if err != nil {
+			// The last event may not be followed by a blank line
+			if err == io.EOF && len(data) > 0 {
+				return d.event(data)
+			}
+			return nil, err
+		}
+	}
+}
+
+// event returns the JSON chunk of an event, or io.EOF for the [DONE] marker
+func (d *sseDecoder) event(data [][]byte) ([]byte, error) {
+	chunk := bytes.Join(data, []byte("\n"))
+	if string(bytes.TrimSpace(chunk)) == "[DONE]" {
+		return nil, io.EOF
+	}
+	return chunk, nil
+}
+
+// jsonStreamDecoder decodes a stream of JSON values.
+// Values may be separated by newlines or any other whitespace, and a stream sent as
+// a single JSON array is decoded element by element.
+type jsonStreamDecoder struct {
+	reader  *bufio.Reader
+	decoder *json.Decoder
+	started bool
+	inArray bool
+}
+
+// newJSONStreamDecoder creates a decoder for JSON lines
+func newJSONStreamDecoder(r io.Reader) StreamDecoder {
+	reader := bufio.NewReader(r)
+	return &jsonStreamDecoder{
+		reader:  reader,
+		decoder: json.NewDecoder(reader),
+	}
+}
+
+// Next implements StreamDecoder
+func (d *jsonStreamDecoder) Next() ([]byte, error) {
+	if !d.started {
+		d.started = true
+		if err := d.detectArray(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.inArray && !d.decoder.More() {
+		return nil, io.EOF
+	}
+
+	var chunk json.RawMessage
+	if err := d.decoder.Decode(&chunk); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to decode JSON stream: %w", err)
+	}
+	return chunk, nil
+}
+
+// detectArray consumes the opening bracket of a stream sent as a JSON array.
+// It runs before the JSON decoder reads anything, so leading whitespace can be skipped directly.
+func (d *jsonStreamDecoder) detectArray() error {
+	for {
+		next, err := d.reader.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !isJSONSpace(next[0]) {
+			break
+		}
+		d.reader.ReadByte()
+	}
+
+	next, _ := d.reader.Peek(1)
+	if next[0] != '[' {
+		return nil
+	}
+	d.inArray = true
+	if _, err := d.decoder.Token(); err != nil {
+		return fmt.Errorf("failed to decode JSON stream: %w", err)
+	}
+	return nil
+}
+
+// isJSONSpace reports whether c is JSON whitespace
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readChunks reads all chunks of a stream
+func readChunks(t *testing.T, format StreamFormat, body string) []string {
+	t.Helper()
+	decoder, err := NewStreamDecoder(format, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	var chunks []string
+	for {
+		chunk, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Failed to read chunk: %v", err)
+		}
+		chunks = append(chunks, string(chunk))
+	}
+}
+
+func TestStreamDecoders(t *testing.T) {
+	tests := []struct {
+		name   string
+		format StreamFormat
+		body   string
+		want   []string
+	}{
+		{
+			name:   "sse",
+			format: StreamFormatSSE,
+			body:   ": keep-alive\n\nevent: chunk\ndata: {\"a\":1}\r\n\r\ndata: {\"b\":\ndata: 2}\n\ndata: [DONE]\n\ndata: {\"ignored\":true}\n\n",
+			want:   []string{`{"a":1}`, "{\"b\":\n2}"},
+		},
+		{
+			name:   "sse without final blank line",
+			format: "",
+			body:   "data: {\"a\":1}\n\ndata: {\"b\":2}",
+			want:   []string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			name:   "jsonl",
+			format: StreamFormatJSONL,
+			body:   "{\"a\":1}\n{\"b\":2}\n\n",
+			want:   []string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			name:   "ndjson concatenated",
+			format: StreamFormatNDJSON,
+			body:   `{"a":1}{"b":2}`,
+			want:   []string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			name:   "json array",
+			format: StreamFormatJSONL,
+			body:   "\n [{\"a\":1},\n{\"b\":2}]\n",
+			want:   []string{`{"a":1}`, `{"b":2}`},
+		},
+		{
+			name:   "empty",
+			format: StreamFormatJSONL,
+			body:   "",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readChunks(t, tt.format, tt.body)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("Expected chunks %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUnknownStreamFormat(t *testing.T) {
+	if _, err := NewStreamDecoder("xml", strings.NewReader("")); err == nil {
+		t.Error("Expected an error for an unknown stream format")
+	}
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Schema describes the JSON object a structured response must be
+type Schema struct {
+	// Name of the object, e.g. "commit_message". Providers forcing a tool use it as the tool name.
+	Name string
+	// Description tells the model what to put in the object
+	Description string
+	// Parameters is the JSON schema of the object
+	Parameters json.RawMessage
+}
+
+// StructuredResponse is the response to a structured message
+type StructuredResponse struct {
+	// Content is the JSON object answered by the model
+	Content json.RawMessage
+	// Usage is the token usage of the request
+	Usage Usage
+}
+
+// StructuredProvider is implemented by providers that can constrain a response to a JSON
+// schema, with a JSON mode or by forcing the model to call a tool
+type StructuredProvider interface {
+	// CreateStructuredMessage sends the messages and returns the JSON object answered by the model
+	CreateStructuredMessage(ctx context.Context, schema Schema, messages []Message) (*StructuredResponse, error)
+}
+
+// ErrNoJSONObject is returned when a response does not contain a JSON object
+var ErrNoJSONObject = errors.New("response does not contain a JSON object")
+
+// ErrStructuredUnsupported is returned by CreateStructuredMessage when the model of the
+// provider cannot constrain its responses, e.g. a configured model without tools
+var ErrStructuredUnsupported = errors.New("the model does not support structured responses")
+
+// CreateStructured asks p for a JSON object matching schema and decodes it into v.
+// Providers or models without structured responses are asked to answer with the object only,
+// which is then cut out of the text of the response.
+func CreateStructured(ctx context.Context, p Provider, schema Schema, messages []Message, v any) (Usage, error) {
+	var content json.RawMessage
+	var usage Usage
+	resp, err := createStructuredMessage(ctx, p, schema, messages)
+	switch {
+	case err == nil:
+		content, usage = resp.Content, resp.Usage
+	case errors.Is(err, ErrStructuredUnsupported):
+		text, u, err := collectText(ctx, p, StructuredSystemPrompt(schema), messages)
+		if err != nil {
+			return u, err
+		}
+		usage = u
+		if content, err = ExtractJSONObject(text); err != nil {
+			return usage, err
+		}
+	default:
+		return Usage{}, err
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		return usage, fmt.Errorf("failed to decode %s: %w", schema.Name, err)
+	}
+	return usage, nil
+}
+
+// createStructuredMessage asks p for a structured response, or returns ErrStructuredUnsupported
+// if it is not a StructuredProvider
+func createStructuredMessage(ctx context.Context, p Provider, schema Schema, messages []Message) (*StructuredResponse, error) {
+	sp, ok := p.(StructuredProvider)
+	if !ok {
+		return nil, ErrStructuredUnsupported
+	}
+	return sp.CreateStructuredMessage(ctx, schema, messages)
+}
+
+// StructuredSystemPrompt returns the instructions asking for a JSON object matching schema,
+// for providers whose JSON mode does not take a schema
+func StructuredSystemPrompt(schema Schema) string {
+	var b strings.Builder
+	if schema.Description != "" {
+		b.WriteString(schema.Description)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "Answer only with a JSON object named %s matching this JSON schema, without any other text:\n%s", schema.Name, schema.Parameters)
+	return b.String()
+}
+
+// ExtractJSONObject returns the JSON object in text, which may be surrounded by prose or a code fence
+func ExtractJSONObject(text string) (json.RawMessage, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, ErrNoJSONObject
+	}
+	object := json.RawMessage(text[start : end+1])
+	if !json.Valid(object) {
+		return nil, ErrNoJSONObject
+	}
+	return object, nil
+}
+
+// collectText sends the messages and returns the whole text of the response
+func collectText(ctx context.Context, p Provider, systemPrompt string, messages []Message) (string, Usage, error) {
+	events, err := p.CreateMessage(ctx, systemPrompt, messages, GenerationOptions{})
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	var text strings.Builder
+	var usage Usage
+	for event := range events {
+		switch event.Type {
+		case "text":
+			text.WriteString(event.Text)
+		case "usage":
+			if event.Usage != nil {
+				usage.InputTokens += event.Usage.InputTokens
+				usage.OutputTokens += event.Usage.OutputTokens
+				usage.CacheReadTokens += event.Usage.CacheReadTokens
+				usage.CacheWriteTokens += event.Usage.CacheWriteTokens
+				usage.TotalCost += event.Usage.TotalCost
+			}
+		case "error":
+			return "", usage, errors.New(event.Text)
+		}
+	}
+	return text.String(), usage, ctx.Err()
+}
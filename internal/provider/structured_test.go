@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// textProvider answers every message with a fixed text, without structured responses
+type textProvider struct {
+	text         string
+	systemPrompt string
+}
+
+func (p *textProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []Message, opts GenerationOptions) (chan StreamEvent, error) {
+	p.systemPrompt = systemPrompt
+	events := make(chan StreamEvent, 2)
+	events <- StreamEvent{Type: "text", Text: p.text}
+	events <- StreamEvent{Type: "usage", Usage: &Usage{InputTokens: 10, OutputTokens: 5}}
+	close(events)
+	return events, nil
+}
+
+func (p *textProvider) GetModel() ModelInfo        { return ModelInfo{Name: "text"} }
+func (p *textProvider) Capabilities() Capabilities { return Capabilities{} }
+
+func (p *textProvider) Name() string { return "text" }
+
+var commitSchema = Schema{
+	Name:        "commit_message",
+	Description: "Write the commit message of the changes.",
+	Parameters:  json.RawMessage(`{"type":"object","properties":{"subject":{"type":"string"}},"required":["subject"]}`),
+}
+
+func TestCreateStructuredFallback(t *testing.T) {
+	p := &textProvider{text: "Here it is:\n```json\n{\"subject\": \"Fix the parser\"}\n```"}
+	var commit struct {
+		Subject string `json:"subject"`
+	}
+	usage, err := CreateStructured(context.Background(), p, commitSchema, []Message{{Role: "user", Content: "diff"}}, &commit)
+	if err != nil {
+		t.Fatalf("CreateStructured() error = %v", err)
+	}
+	if commit.Subject != "Fix the parser" {
+		t.Errorf("subject = %q", commit.Subject)
+	}
+	if usage.InputTokens != 10 || usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if !strings.Contains(p.systemPrompt, string(commitSchema.Parameters)) {
+		t.Errorf("system prompt %q does not give the schema", p.systemPrompt)
+	}
+
+	p.text = "I cannot answer that."
+	if _, err := CreateStructured(context.Background(), p, commitSchema, nil, &commit); err == nil {
+		t.Error("CreateStructured() without a JSON object succeeded")
+	}
+}
+
+// unsupportedProvider is a structured provider whose model cannot constrain its responses
+type unsupportedProvider struct {
+	textProvider
+}
+
+func (p *unsupportedProvider) CreateStructuredMessage(ctx context.Context, schema Schema, messages []Message) (*StructuredResponse, error) {
+	return nil, ErrStructuredUnsupported
+}
+
+func TestCreateStructuredUnsupportedModel(t *testing.T) {
+	p := &unsupportedProvider{textProvider{text: `{"subject": "Add the provider"}`}}
+	var commit struct {
+		Subject string `json:"subject"`
+	}
+	if _, err := CreateStructured(context.Background(), p, commitSchema, nil, &commit); err != nil {
+		t.Fatalf("CreateStructured() error = %v", err)
+	}
+	if commit.Subject != "Add the provider" {
+		t.Errorf("subject = %q, want the object of the text", commit.Subject)
+	}
+}
+
+func TestExtractJSONObject(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"Sure!\n{\"a\": {\"b\": 2}}\nDone.", `{"a": {"b": 2}}`},
+		{"```json\n{\"a\": \"}\"}\n```", `{"a": "}"}`},
+		{"no object", ""},
+		{"{broken", ""},
+	}
+	for _, tt := range tests {
+		got, err := ExtractJSONObject(tt.text)
+		if string(got) != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("ExtractJSONObject(%q) = %s, %v, want %s", tt.text, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Default timeouts used when a provider does not configure its own
+const (
+	// DefaultConnectTimeout is the default time allowed to establish a connection
+	DefaultConnectTimeout = 30 * time.Second
+	// DefaultReadTimeout is the default time allowed to wait for the first byte
+	// and between two chunks of a streamed response
+	DefaultReadTimeout = 5 * time.Minute
+	// DefaultTotalTimeout is the default time allowed for a whole request, the stream of a
+	// streamed response excepted
+	DefaultTotalTimeout = 30 * time.Minute
+	// DefaultIdleTimeout is the default time an idle connection is kept open for the next requests
+	DefaultIdleTimeout = 90 * time.Second
+	// DefaultKeepAlive is the default interval of the TCP keep-alive probes of the connections
+	DefaultKeepAlive = 30 * time.Second
+)
+
+// streamingMediaTypes are the media types of the streamed responses, whose bodies are only
+// bounded by the read timeout
+var streamingMediaTypes = map[string]bool{
+	"text/event-stream":      true,
+	"application/x-ndjson":   true,
+	"application/ndjson":     true,
+	"application/jsonl":      true,
+	"application/x-jsonl":    true,
+	"application/jsonlines":  true,
+	"application/json-seq":   true,
+	"application/x-json-seq": true,
+}
+
+// ErrReadTimeout is returned when no data was received within the read timeout
+var ErrReadTimeout = errors.New("no data received within read timeout")
+
+// Timeouts configures the network timeouts of a provider.
+// Zero values are replaced with the defaults.
+type Timeouts struct {
+	// Connect is the maximum time to establish a connection, including the TLS handshake
+	Connect time.Duration
+	// Read is the maximum time to wait for the first byte of the response
+	// and between two chunks of a streamed response
+	Read time.Duration
+	// Total is the maximum duration of a whole request. A streamed response is only bounded
+	// by Read once it started, so that long generations are not cut off.
+	Total time.Duration
+	// Idle is the maximum time an idle connection is kept open for the next requests
+	Idle time.Duration
+	// KeepAlive is the interval of the TCP keep-alive probes of the connections
+	KeepAlive time.Duration
+}
+
+// DefaultTimeouts returns the default timeouts
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Connect:   DefaultConnectTimeout,
+		Read:      DefaultReadTimeout,
+		Total:     DefaultTotalTimeout,
+		Idle:      DefaultIdleTimeout,
+		KeepAlive: DefaultKeepAlive,
+	}
+}
+
+// WithDefaults returns the timeouts with zero values replaced by the defaults
+func (t Timeouts) WithDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.Connect <= 0 {
+		t.Connect = defaults.Connect
+	}
+	if t.Read <= 0 {
+		t.Read = defaults.Read
+	}
+	if t.Total <= 0 {
+		t.Total = defaults.Total
+	}
+	if t.Idle <= 0 {
+		t.Idle = defaults.Idle
+	}
+	if t.KeepAlive <= 0 {
+		t.KeepAlive = defaults.KeepAlive
+	}
+	return t
+}
+
+// NewHTTPClient creates an HTTP client that enforces the given timeouts.
+// Unlike http.Client.Timeout, the total timeout stops applying once a streamed response
+// started: a slow but steady stream goes on for as long as the generation lasts, while a
+// stalled connection fails after the read timeout.
+func NewHTTPClient(timeouts Timeouts) *http.Client {
+	timeouts = timeouts.WithDefaults()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: timeouts.KeepAlive,
+	}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.Connect
+	transport.ResponseHeaderTimeout = timeouts.Read
+	transport.IdleConnTimeout = timeouts.Idle
+
+	return &http.Client{
+		Transport: &readTimeoutTransport{
+			base:    transport,
+			timeout: timeouts.Read,
+			total:   timeouts.Total,
+		},
+	}
+}
+
+// HTTPClient creates the HTTP client of a provider enforcing the timeouts of the options, and
+// recording the requests when a trace recorder is set
+func (o Options) HTTPClient() *http.Client {
+	client := NewHTTPClient(o.Timeouts)
+	if o.Trace != nil {
+		client.Transport = o.Trace.Transport(client.Transport)
+	}
+	return client
+}
+
+// readTimeoutTransport applies the read timeout to response bodies, and the total timeout to
+// the requests until their response, and to the bodies of the responses that are not streamed
+type readTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+	total   time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *readTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	deadline := time.AfterFunc(t.total, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		expired := !deadline.Stop()
+		cancel()
+		if expired && req.Context().Err() == nil {
+			return nil, fmt.Errorf("request exceeded the total timeout of %s: %w", t.total, err)
+		}
+		return nil, err
+	}
+
+	if isStreaming(resp) {
+		deadline.Stop()
+	}
+	resp.Body = &cancelBody{ReadCloser: newReadTimeoutBody(resp.Body, t.timeout), cancel: func() {
+		deadline.Stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// isStreaming reports whether a response is streamed, from its media type
+func isStreaming(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && streamingMediaTypes[mediaType]
+}
+
+// cancelBody releases the context of its request when it is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// readTimeoutBody closes the underlying body when no data arrives within the timeout
+type readTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// newReadTimeoutBody wraps body with a read timeout
+func newReadTimeoutBody(body io.ReadCloser, timeout time.Duration) *readTimeoutBody {
+	b := &readTimeoutBody{
+		body:    body,
+		timeout: timeout,
+	}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.expired.Store(true)
+		body.Close()
+	})
+	return b
+}
+
+// Read implements io.Reader
+func (b *readTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.expired.Load() {
+		return n, ErrReadTimeout
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *readTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
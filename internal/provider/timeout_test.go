@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Send the first chunk, then stall
+		w.Write([]byte("data: first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewHTTPClient(Timeouts{Read: 100 * time.Millisecond})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Errorf("Expected read timeout error, got %v", err)
+	}
+}
+
+func TestTimeoutsWithDefaults(t *testing.T) {
+	timeouts := Timeouts{Read: time.Hour}.WithDefaults()
+	if timeouts.Connect != DefaultConnectTimeout {
+		t.Errorf("Expected connect timeout %s, got %s", DefaultConnectTimeout, timeouts.Connect)
+	}
+	if timeouts.Read != time.Hour {
+		t.Errorf("Expected read timeout %s, got %s", time.Hour, timeouts.Read)
+	}
+	if timeouts.Total != DefaultTotalTimeout {
+		t.Errorf("Expected total timeout %s, got %s", DefaultTotalTimeout, timeouts.Total)
+	}
+	if timeouts.Idle != DefaultIdleTimeout || timeouts.KeepAlive != DefaultKeepAlive {
+		t.Errorf("Expected idle timeout %s and keep-alive %s, got %s and %s", DefaultIdleTimeout, DefaultKeepAlive, timeouts.Idle, timeouts.KeepAlive)
+	}
+}
+
+func TestHTTPClientTotalTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		// Send chunks for longer than the total timeout, within the read timeout of each other
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("data: chunk\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(Timeouts{Read: time.Second, Total: 100 * time.Millisecond})
+
+	// A streamed response is only bounded by the read timeout once it started
+	resp, err := client.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(data) != 4*len("data: chunk\n") {
+		t.Errorf("Read %d bytes of the stream, error %v", len(data), err)
+	}
+
+	// The body of other responses is bounded by the total timeout
+	resp, err = client.Get(server.URL + "/json")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the total timeout to cancel the body, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces the credentials in traces
+const redacted = "[REDACTED]"
+
+// traceFileExt is the extension of the files of the recorded requests
+const traceFileExt = ".json"
+
+// sensitiveNames are the parts of the names of the headers and query parameters carrying credentials
+var sensitiveNames = []string{"auth", "key", "token", "secret", "cookie", "signature"}
+
+// TraceEntry is a request sent to a provider and its raw response, with the credentials redacted
+type TraceEntry struct {
+	// Sequence is the number of the request in the trace, from 1
+	Sequence int `json:"sequence"`
+	// Time is when the request was sent
+	Time time.Time `json:"time"`
+	// Duration is the time from sending the request to the end of its response
+	Duration time.Duration `json:"duration"`
+	Method   string        `json:"method"`
+	URL      string        `json:"url"`
+	// RequestHeaders and RequestBody are the request as sent
+	RequestHeaders http.Header `json:"request_headers,omitempty"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	// Status is the status code of the response, zero if none was received
+	Status int `json:"status,omitempty"`
+	// ResponseHeaders and ResponseBody are the response as received, e.g. the raw SSE stream
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+	// Error is why the request or the reading of its response failed
+	Error string `json:"error,omitempty"`
+}
+
+// TraceRecorder records the requests sent to the providers and their raw responses in a
+// directory, one JSON file per request, to diagnose prompt bugs and provider quirks. The
+// credentials are redacted: the headers and query parameters carrying them, and the secrets
+// registered with Redact wherever they appear.
+type TraceRecorder struct {
+	dir     string
+	mu      sync.Mutex
+	next    int
+	secrets []string
+}
+
+// NewTraceRecorder creates a recorder writing to dir, after the requests already recorded there
+func NewTraceRecorder(dir string) *TraceRecorder {
+	r := &TraceRecorder{dir: dir, next: 1}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if n, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), traceFileExt)); err == nil && n >= r.next {
+			r.next = n + 1
+		}
+	}
+	return r
+}
+
+// Dir returns the directory the requests are recorded in
+func (r *TraceRecorder) Dir() string {
+	return r.dir
+}
+
+// Redact registers a secret, e.g. an API key, replaced wherever it appears in the traces
+func (r *TraceRecorder) Redact(secret string) {
+	if secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = append(r.secrets, secret)
+}
+
+// Transport wraps a transport to record the requests sent through it
+func (r *TraceRecorder) Transport(base http.RoundTripper) http.RoundTripper {
+	return &traceTransport{base: base, recorder: r}
+}
+
+// redact replaces the registered secrets in s
+func (r *TraceRecorder) redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactHeaders returns the headers with the values of those carrying credentials redacted
+func (r *TraceRecorder) redactHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redactedHeader := make(http.Header, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			if isSensitive(name) {
+				value = redacted
+			}
+			redactedHeader.Add(name, r.redact(value))
+		}
+	}
+	return redactedHeader
+}
+
+// redactURL returns the URL with the values of the query parameters carrying credentials redacted
+func (r *TraceRecorder) redactURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	query := clean.Query()
+	for name := range query {
+		if isSensitive(name) {
+			query.Set(name, redacted)
+		}
+	}
+	clean.RawQuery = query.Encode()
+	return r.redact(clean.String())
+}
+
+// sequence returns the number of a new request
+func (r *TraceRecorder) sequence() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	r.next++
+	return n
+}
+
+// write writes a recorded request to its file. Failures are only logged, tracing never fails a request.
+func (r *TraceRecorder) write(entry *TraceEntry) {
+	entry.RequestBody = r.redact(entry.RequestBody)
+	entry.ResponseBody = r.redact(entry.ResponseBody)
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(r.dir, 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(r.dir, fmt.Sprintf("%04d%s", entry.Sequence, traceFileExt)), data, 0o600)
+	}
+	if err != nil {
+		slog.Warn("Failed to record provider request", "error", err)
+	}
+}
+
+// isSensitive reports whether a header or query parameter may carry credentials
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadTrace reads the requests recorded in a directory, in the order they were sent
+func ReadTrace(dir string) ([]TraceEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+	var entries []TraceEntry
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != traceFileExt {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trace: %w", err)
+		}
+		var entry TraceEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("invalid trace file %s: %w", file.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Sequence < entries[j].Sequence })
+	return entries, nil
+}
+
+// traceTransport records the requests sent through a transport
+type traceTransport struct {
+	base     http.RoundTripper
+	recorder *TraceRecorder
+}
+
+// RoundTrip implements http.RoundTripper. The response is recorded as it is read, and written
+// once it is read to the end or closed.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &TraceEntry{
+		Sequence:       t.recorder.sequence(),
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            t.recorder.redactURL(req.URL),
+		RequestHeaders: t.recorder.redactHeaders(req.Header),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		entry.RequestBody = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Duration = time.Since(entry.Time)
+		entry.Error = err.Error()
+		t.recorder.write(entry)
+		return nil, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeaders = t.recorder.redactHeaders(resp.Header)
+	resp.Body = &traceBody{body: resp.Body, entry: entry, recorder: t.recorder}
+	return resp, nil
+}
+
+// traceBody records a response body as it is read
+type traceBody struct {
+	body     io.ReadCloser
+	entry    *TraceEntry
+	recorder *TraceRecorder
+	buf      bytes.Buffer
+	once     sync.Once
+}
+
+// Read implements io.Reader
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *traceBody) Close() error {
+	b.finish(nil)
+	return b.body.Close()
+}
+
+// finish writes the recorded request once its response is read or closed
+func (b *traceBody) finish(err error) {
+	b.once.Do(func() {
+		b.entry.Duration = time.Since(b.entry.Time)
+		b.entry.ResponseBody = b.buf.String()
+		if err != nil && !errors.Is(err, io.EOF) {
+			b.entry.Error = err.Error()
+		}
+		b.recorder.write(b.entry)
+	})
+}
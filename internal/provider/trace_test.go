@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"model":"m"}` {
+			t.Errorf("the server got the body %q", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_start\ndata: {}\n\n"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder := NewTraceRecorder(dir)
+	recorder.Redact("sk-secret")
+	client := Options{Trace: recorder}.HTTPClient()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/messages?key=sk-secret&beta=true", strings.NewReader(`{"model":"m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Api-Key", "sk-secret")
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	req.Header.Set("Anthropic-Version", "2023-06-01")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	entries, err := ReadTrace(dir)
+	if err != nil {
+		t.Fatalf("ReadTrace() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ReadTrace() = %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Sequence != 1 || entry.Status != http.StatusOK || entry.RequestBody != `{"model":"m"}` {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.ResponseBody != "event: message_start\ndata: {}\n\n" {
+		t.Errorf("response body = %q, want the raw stream", entry.ResponseBody)
+	}
+	if entry.RequestHeaders.Get("X-Api-Key") != redacted || entry.RequestHeaders.Get("Authorization") != redacted ||
+		entry.RequestHeaders.Get("Anthropic-Version") != "2023-06-01" {
+		t.Errorf("request headers = %v, want the credentials redacted", entry.RequestHeaders)
+	}
+	if strings.Contains(entry.URL, "sk-secret") || !strings.Contains(entry.URL, "beta=true") {
+		t.Errorf("URL = %q, want the key redacted", entry.URL)
+	}
+
+	// A recorder opened on the same directory appends to the trace
+	if next := NewTraceRecorder(dir).sequence(); next != 2 {
+		t.Errorf("sequence() = %d after one recorded request, want 2", next)
+	}
+}
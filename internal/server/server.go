@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kazz187/goline/internal/metrics"
+	"github.com/kazz187/goline/proto/gen/go/goline/v1/golinev1connect"
+)
+
+// shutdownTimeout is how long in-flight requests are given to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// NewHandler returns an HTTP handler serving all Goline APIs.
+// The APIs speak the Connect, gRPC and gRPC-Web protocols.
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(golinev1connect.NewToolServiceHandler(NewToolServer()))
+	return mux
+}
+
+// Serve serves the Goline APIs on the listener until the context is cancelled.
+// HTTP/2 is served without TLS so gRPC clients can connect directly.
+func Serve(ctx context.Context, listener net.Listener) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	return serve(ctx, listener, &http.Server{
+		Handler:           NewHandler(),
+		Protocols:         protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	})
+}
+
+// NewMetricsHandler returns an HTTP handler serving the Goline metrics on /metrics
+func NewMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default.Handler())
+	return mux
+}
+
+// ServeMetrics serves the Goline metrics in the Prometheus text format on the listener
+// until the context is cancelled
+func ServeMetrics(ctx context.Context, listener net.Listener) error {
+	return serve(ctx, listener, &http.Server{
+		Handler:           NewMetricsHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	})
+}
+
+// serve runs the server on the listener until the context is cancelled, then shuts it down gracefully
+func serve(ctx context.Context, listener net.Listener, srv *http.Server) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Failed to shut down the server gracefully", "error", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
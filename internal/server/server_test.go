@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"github.com/kazz187/goline/proto/gen/go/goline/v1/golinev1connect"
+)
+
+func TestListTools(t *testing.T) {
+	srv := httptest.NewServer(NewHandler())
+	defer srv.Close()
+
+	for _, opt := range []connect.ClientOption{connect.WithGRPCWeb(), connect.WithProtoJSON()} {
+		client := golinev1connect.NewToolServiceClient(http.DefaultClient, srv.URL, opt)
+		resp, err := client.ListTools(context.Background(), connect.NewRequest(&pb.ListToolsRequest{}))
+		if err != nil {
+			t.Fatalf("Failed to list tools: %v", err)
+		}
+
+		tools := resp.Msg.GetTools()
+		if len(tools) != len(assistantmessage.ToolSchemas()) {
+			t.Fatalf("Expected %d tools, got %d", len(assistantmessage.ToolSchemas()), len(tools))
+		}
+
+		var found bool
+		for _, tool := range tools {
+			if tool.GetName() != string(assistantmessage.ExecuteCommandToolName) {
+				continue
+			}
+			found = true
+			params := tool.GetParameters()
+			if len(params) != 2 || params[1].GetName() != "requires_approval" || !params[1].GetRequired() || params[1].GetType() != pb.ToolParameterType_TOOL_PARAMETER_TYPE_BOOLEAN {
+				t.Errorf("Unexpected execute_command parameters: %v", params)
+			}
+		}
+		if !found {
+			t.Error("execute_command is missing")
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	srv := httptest.NewServer(NewMetricsHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("Unexpected response: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "# TYPE goline_provider_requests_total counter") {
+		t.Errorf("Metrics do not describe the provider requests:\n%s", body)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	"github.com/kazz187/goline/proto/gen/go/goline/v1/golinev1connect"
+)
+
+// ToolServer implements the ToolService API from the tool registry
+type ToolServer struct {
+	golinev1connect.UnimplementedToolServiceHandler
+}
+
+// NewToolServer creates a new tool server
+func NewToolServer() *ToolServer {
+	return &ToolServer{}
+}
+
+// ListTools returns the schema of every tool
+func (s *ToolServer) ListTools(ctx context.Context, req *connect.Request[pb.ListToolsRequest]) (*connect.Response[pb.ListToolsResponse], error) {
+	resp := &pb.ListToolsResponse{}
+	for _, schema := range assistantmessage.ToolSchemas() {
+		resp.Tools = append(resp.Tools, ToolSchemaToProto(schema))
+	}
+	return connect.NewResponse(resp), nil
+}
+
+// ToolSchemaToProto converts a tool schema to its protobuf representation
+func ToolSchemaToProto(schema assistantmessage.ToolSchema) *pb.ToolSchema {
+	tool := &pb.ToolSchema{
+		Name:        string(schema.Name),
+		Description: schema.Description,
+	}
+	for _, param := range schema.Parameters {
+		tool.Parameters = append(tool.Parameters, &pb.ToolParameter{
+			Name:        string(param.Name),
+			Description: param.Description,
+			Required:    param.Required,
+			Type:        toolParamTypeToProto(param.Type),
+		})
+	}
+	return tool
+}
+
+// toolParamTypeToProto converts a tool parameter type to its protobuf representation
+func toolParamTypeToProto(t assistantmessage.ToolParamType) pb.ToolParameterType {
+	switch t {
+	case assistantmessage.StringParamType:
+		return pb.ToolParameterType_TOOL_PARAMETER_TYPE_STRING
+	case assistantmessage.BooleanParamType:
+		return pb.ToolParameterType_TOOL_PARAMETER_TYPE_BOOLEAN
+	case assistantmessage.JSONParamType:
+		return pb.ToolParameterType_TOOL_PARAMETER_TYPE_JSON
+	default:
+		return pb.ToolParameterType_TOOL_PARAMETER_TYPE_UNSPECIFIED
+	}
+}
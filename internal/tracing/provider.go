@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kazz187/goline/internal/provider"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedProvider records a span around each request of a provider
+type tracedProvider struct {
+	provider.Provider
+}
+
+// TraceProvider wraps a provider to record a span for each request, from sending it to
+// the end of its stream. The first streamed event and the token usage are recorded on the span.
+func TraceProvider(p provider.Provider) provider.Provider {
+	return &tracedProvider{Provider: p}
+}
+
+// CreateMessage implements provider.Provider
+func (p *tracedProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	ctx, span := Start(ctx, "provider.request",
+		AttrProvider.String(p.Name()),
+		AttrModel.String(p.GetModel().Name),
+		attribute.Int("goline.messages", len(messages)),
+	)
+
+	events, err := p.Provider.CreateMessage(ctx, systemPrompt, messages, opts)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+
+	out := make(chan provider.StreamEvent)
+	go func() {
+		defer close(out)
+		var streamErr error
+		first := true
+		for event := range events {
+			if first {
+				span.AddEvent("first_event")
+				first = false
+			}
+			switch event.Type {
+			case "usage":
+				recordUsage(span, event.Usage)
+			case "stop":
+				span.SetAttributes(attribute.String("goline.stop_reason", event.StopReason))
+			case "error":
+				streamErr = errors.New(event.Text)
+			}
+			out <- event
+		}
+		End(span, streamErr)
+	}()
+	return out, nil
+}
+
+// recordUsage sets the token usage and cost of a request on its span
+func recordUsage(span trace.Span, usage *provider.Usage) {
+	if usage == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("goline.tokens.input", usage.InputTokens),
+		attribute.Int("goline.tokens.output", usage.OutputTokens),
+		attribute.Int("goline.tokens.cache_read", usage.CacheReadTokens),
+		attribute.Int("goline.tokens.cache_write", usage.CacheWriteTokens),
+		attribute.Float64("goline.cost_usd", usage.TotalCost),
+	)
+}
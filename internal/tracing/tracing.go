@@ -0,0 +1,94 @@
+// Package tracing records OpenTelemetry spans around the agent pipeline: provider requests,
+// tool executions, checkpoint operations and parser runs. Spans are exported over OTLP/HTTP
+// when an endpoint is configured, and are no-ops otherwise.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kazz187/goline/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer creating the Goline spans
+const instrumentationName = "github.com/kazz187/goline"
+
+// Span attribute keys
+const (
+	AttrTaskID       = attribute.Key("goline.task.id")
+	AttrProvider     = attribute.Key("goline.provider")
+	AttrModel        = attribute.Key("goline.model")
+	AttrTool         = attribute.Key("goline.tool")
+	AttrCheckpointID = attribute.Key("goline.checkpoint.id")
+)
+
+// Enabled reports whether traces should be exported for the configuration
+func Enabled(cfg config.Tracing) bool {
+	return cfg.Endpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a tracer provider exporting spans over OTLP/HTTP.
+// When tracing is not configured, nothing is installed and spans are no-ops.
+// The returned function flushes the pending spans and must be called before exiting.
+func Setup(ctx context.Context, cfg config.Tracing, version string) (func(context.Context) error, error) {
+	if !Enabled(cfg) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "goline"),
+		attribute.String("service.version", version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
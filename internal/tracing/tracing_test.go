@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/provider"
+	"github.com/kazz187/goline/internal/provider/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider recording the ended spans for the test
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTraceProvider(t *testing.T) {
+	exporter := recordSpans(t)
+
+	ctx, parent := Start(context.Background(), "turn")
+	p := TraceProvider(mock.New(&mock.Fixture{Responses: []mock.Response{{Events: []mock.Event{
+		{Type: "text", Text: "hello"},
+		{Type: "usage", Usage: &mock.Usage{InputTokens: 10, OutputTokens: 3}},
+		{Type: "error", Text: "stream broken"},
+	}}}}))
+	events, err := p.CreateMessage(ctx, "", nil, provider.GenerationOptions{})
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+	for range events {
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	request := spans[0]
+	if request.Name != "provider.request" {
+		t.Fatalf("first ended span = %q, want provider.request", request.Name)
+	}
+	if request.Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Error("provider.request is not a child of the span in the context")
+	}
+	if request.Status.Code != codes.Error || request.Status.Description != "stream broken" {
+		t.Errorf("status = %+v, want the stream error", request.Status)
+	}
+	if len(request.Events) == 0 || request.Events[0].Name != "first_event" {
+		t.Errorf("events = %+v, want first_event", request.Events)
+	}
+	attrs := map[string]any{}
+	for _, attr := range request.Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	if attrs["goline.provider"] != "mock" || attrs["goline.tokens.input"] != int64(10) {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter := recordSpans(t)
+
+	_, span := Start(context.Background(), "checkpoint.save")
+	End(span, errors.New("disk full"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 {
+		t.Errorf("spans = %+v, want one failed span with the error recorded", spans)
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	if Enabled(config.Tracing{}) {
+		t.Error("Enabled() = true without an endpoint")
+	}
+	shutdown, err := Setup(context.Background(), config.Tracing{}, "test")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// multiLineTerminator ends multi-line input in the accessible REPL
+const multiLineTerminator = "."
+
+// AccessibleREPL is a linear, plain-text REPL intended for screen readers.
+// It never draws boxes or relies on color: every message is written on its own
+// lines and starts with an explicit announcement of who produced it.
+type AccessibleREPL struct {
+	in             io.Reader
+	out            io.Writer
+	mu             sync.Mutex
+	processor      *CommandProcessor
+	initialMessage string
+	taskID         string
+	// summary is the first line of the first message, shown in the terminal title
+	summary string
+	// language is the language the AI answers in, that of the user if empty
+	language string
+	title    *terminalTitle
+	// runner runs the messages with the AI agent, one at a time
+	runner TaskRunner
+	// retrier regenerates the last answer, nil if it cannot be regenerated
+	retrier TaskRetrier
+	// scanner reads the input, also the answers to the questions of the AI while a message runs
+	scanner *bufio.Scanner
+}
+
+// NewAccessibleREPL creates a new accessible REPL reading commands from in and writing to out
+func NewAccessibleREPL(in io.Reader, out io.Writer) *AccessibleREPL {
+	r := &AccessibleREPL{
+		in:     in,
+		out:    out,
+		runner: noAgent,
+	}
+	r.processor = NewCommandProcessor(r)
+	return r
+}
+
+// AddUserInput announces user input
+func (r *AccessibleREPL) AddUserInput(input string) {
+	r.announce("User", input)
+}
+
+// AddAgentOutput announces agent output
+func (r *AccessibleREPL) AddAgentOutput(output string) {
+	r.announce("Agent", output)
+}
+
+// AddSystemMessage announces a system message
+func (r *AccessibleREPL) AddSystemMessage(message string) {
+	r.announce("System", message)
+}
+
+// announce writes a message prefixed with its role.
+// Multi-line messages are closed with an explicit end marker so that
+// screen reader users know where the message stops.
+func (r *AccessibleREPL) announce(role, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content = strings.TrimRight(content, "\n")
+	if !strings.Contains(content, "\n") {
+		fmt.Fprintf(r.out, "%s: %s\n", role, content)
+		return
+	}
+
+	fmt.Fprintf(r.out, "%s message:\n%s\nEnd of %s message.\n", role, content, strings.ToLower(role))
+}
+
+// prompt writes the input prompt
+func (r *AccessibleREPL) prompt(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprint(r.out, text)
+}
+
+// Run runs the REPL until the user exits or the input is closed
+func (r *AccessibleREPL) Run() error {
+	scanner := bufio.NewScanner(r.in)
+	r.scanner = scanner
+
+	r.AddSystemMessage("Task started")
+	r.AddSystemMessage("Accessibility mode is on. Type 'help' to see available commands")
+	if r.initialMessage != "" {
+		r.ask(r.initialMessage)
+	}
+
+	for {
+		r.updateTitle(taskStatusActive)
+		r.prompt("goline> ")
+		if !scanner.Scan() {
+			r.AddSystemMessage("EOF received, exiting...")
+			return scanner.Err()
+		}
+
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+
+		r.updateTitle(taskStatusRunning)
+		switch r.processor.Process(command) {
+		case CommandExit:
+			r.AddSystemMessage("Exiting Goline...")
+			return nil
+		case CommandNeedsMultiLine:
+			cmdName := strings.Fields(command)[0]
+			input, err := r.readMultiLine(scanner, cmdName)
+			if err != nil {
+				return err
+			}
+			if cmdName == "ask" {
+				r.ask(input)
+				continue
+			}
+			r.processor.SubmitMultiLine(cmdName, input)
+		}
+	}
+}
+
+// ask asks a question to the AI agent, the first question names the task in the terminal title
+func (r *AccessibleREPL) ask(question string) {
+	if r.summary == "" {
+		r.summary = summarizeTask(question)
+	}
+	r.updateTitle(taskStatusRunning)
+	r.processor.SubmitMultiLine("ask", question)
+}
+
+// Submit runs a message with the AI agent and waits for it to end
+func (r *AccessibleREPL) Submit(message string) error {
+	r.updateTitle(taskStatusRunning)
+	return r.runner(context.Background(), r.taskID, message, r)
+}
+
+// RetryResponse regenerates the last answer of the AI with a model and waits for the task to
+// go on from it
+func (r *AccessibleREPL) RetryResponse(model ModelChoice) error {
+	if r.retrier == nil {
+		return ErrNoAgent
+	}
+	r.updateTitle(taskStatusRunning)
+	return r.retrier(context.Background(), r.taskID, model, r)
+}
+
+// AskQuestion announces a question of the AI with the suggested answers, and reads the answer
+// of the user, the number of an option picking it
+func (r *AccessibleREPL) AskQuestion(ctx context.Context, question string, options []string) (string, error) {
+	r.updateTitle(taskStatusWaitingForAnswer)
+	defer r.updateTitle(taskStatusRunning)
+	r.announce("Question", formatQuestion(question, options))
+	r.prompt("answer> ")
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+	answer := strings.TrimSpace(r.scanner.Text())
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+		answer = options[n-1]
+	}
+	return answer, nil
+}
+
+// Model returns no model, the task keeps the configured one
+func (r *AccessibleREPL) Model() ModelChoice {
+	return ModelChoice{}
+}
+
+// Generation returns no sampling settings, the task uses those of the provider
+func (r *AccessibleREPL) Generation() provider.GenerationOptions {
+	return provider.GenerationOptions{}
+}
+
+// updateTitle shows the task and its status in the terminal title
+func (r *AccessibleREPL) updateTitle(status string) {
+	r.title.set(formatTitle(TaskInfo{ID: r.taskID, Summary: r.summary, Status: status}))
+}
+
+// readMultiLine reads lines until a line containing only the terminator or the end of input
+func (r *AccessibleREPL) readMultiLine(scanner *bufio.Scanner, cmdName string) (string, error) {
+	r.AddSystemMessage(fmt.Sprintf("Enter multi-line input for '%s'. Finish with a line containing only a period.", cmdName))
+
+	var lines []string
+	for {
+		r.prompt(fmt.Sprintf("%s> ", cmdName))
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.TrimSpace(line) == multiLineTerminator {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), scanner.Err()
+}
+
+// SetInitialMessage sets a message asked to the AI agent when the REPL starts
+func (r *AccessibleREPL) SetInitialMessage(message string) {
+	r.initialMessage = message
+}
+
+// SetRunner sets the runner of the messages, nil to fail them with ErrNoAgent
+func (r *AccessibleREPL) SetRunner(runner TaskRunner) {
+	if runner == nil {
+		runner = noAgent
+	}
+	r.runner = runner
+}
+
+// SetRetrier sets the regeneration of the last answer, nil if it cannot be regenerated
+func (r *AccessibleREPL) SetRetrier(retrier TaskRetrier) {
+	r.retrier = retrier
+}
+
+// SetTaskID sets the ID of the task the commands apply to
+func (r *AccessibleREPL) SetTaskID(taskID string) {
+	r.taskID = taskID
+}
+
+// SetResponseLanguage sets the language the AI answers in
+func (r *AccessibleREPL) SetResponseLanguage(language string) {
+	r.language = language
+}
+
+// ResponseLanguage returns the language the AI answers in
+func (r *AccessibleREPL) ResponseLanguage() string {
+	return r.language
+}
+
+// CurrentTaskID returns the ID of the task the commands apply to
+func (r *AccessibleREPL) CurrentTaskID() string {
+	return r.taskID
+}
+
+// StartAccessibleREPL starts the accessible REPL reading commands from in and writing to the standard output.
+// The accessible REPL runs a single task.
+func StartAccessibleREPL(in io.Reader, opts REPLOptions) error {
+	r := NewAccessibleREPL(in, os.Stdout)
+	r.title = newTerminalTitle(os.Stdout)
+	defer r.title.restore()
+	r.SetTaskID(opts.TaskID)
+	r.SetResponseLanguage(opts.ResponseLanguage)
+	r.SetInitialMessage(opts.InitialMessage)
+	r.SetRunner(opts.Runner)
+	r.SetRetrier(opts.Retrier)
+	r.processor.SetCommitter(opts.Committer)
+	r.processor.SetReviewer(opts.Reviewer)
+	r.processor.SetSlashCommands(opts.SlashCommands)
+	r.processor.SetTaskLock(opts.TaskID, opts.Lock)
+	return r.Run()
+}
@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAccessibleREPLAnnounces(t *testing.T) {
+	var out bytes.Buffer
+	r := NewAccessibleREPL(strings.NewReader(""), &out)
+
+	r.AddUserInput("hello")
+	r.AddAgentOutput("first line\nsecond line\n")
+	r.AddSystemMessage("done")
+
+	want := "User: hello\n" +
+		"Agent message:\nfirst line\nsecond line\nEnd of agent message.\n" +
+		"System: done\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestAccessibleREPLRunsMessages(t *testing.T) {
+	var out bytes.Buffer
+	in := strings.NewReader("ask hello\nask\nfirst line\n.\nsecond line\nask color\n2\n")
+	r := NewAccessibleREPL(in, &out)
+	r.SetRunner(echoRunner)
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"Agent: hello",
+		"Enter multi-line input for 'ask'. Finish with a line containing only a period.",
+		"ask> ",
+		// The line after the period is a command again
+		"Agent: first line\n",
+		"Question message:\nWhich color?",
+		"answer> ",
+		"Agent: You chose blue",
+		"System: EOF received, exiting...",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Agent: second line") || strings.Contains(got, "first line\nsecond line") {
+		t.Errorf("the multi-line input did not stop at the period:\n%s", got)
+	}
+}
+
+func TestAccessibleREPLExits(t *testing.T) {
+	var out bytes.Buffer
+	r := NewAccessibleREPL(strings.NewReader("exit\nask never sent\n"), &out)
+	var messages []string
+	r.SetRunner(func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		messages = append(messages, message)
+		return nil
+	})
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := out.String()
+	if !strings.Contains(got, "System: Exiting Goline...") || strings.Contains(got, "EOF received") {
+		t.Errorf("output = %q, want the exit announced", got)
+	}
+	if len(messages) != 0 {
+		t.Errorf("messages run after exit = %q", messages)
+	}
+}
@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/images"
+)
+
+// ImageAttacher is implemented by front ends whose tasks can send images with their messages
+type ImageAttacher interface {
+	// AttachImage attaches an image to the next message of the shown task
+	AttachImage(attachment images.Attachment) error
+	// DetachImages drops the images attached to the next message of the shown task and
+	// returns them
+	DetachImages() []images.Attachment
+}
+
+// processAttach attaches images to the next message, or drops them with attach clear
+func (p *CommandProcessor) processAttach(command string) {
+	attacher, ok := p.out.(ImageAttacher)
+	if !ok {
+		p.out.AddSystemMessage("Images cannot be attached in this REPL")
+		return
+	}
+	args := fieldsAfter(command, 1)
+	if args == "clear" {
+		detached := attacher.DetachImages()
+		p.out.AddSystemMessage(fmt.Sprintf("Dropped %d attached image(s)", len(detached)))
+		return
+	}
+	paths := splitPaths(args)
+	if len(paths) == 0 {
+		p.out.AddSystemMessage("Error: the path of an image is required, e.g. attach screenshot.png")
+		return
+	}
+	p.attachImages(attacher, paths)
+}
+
+// attachImages loads image files and attaches them to the next message
+func (p *CommandProcessor) attachImages(attacher ImageAttacher, paths []string) {
+	for _, path := range paths {
+		attachment, err := images.Load(expandHome(path))
+		if err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: failed to attach %s: %v", path, err))
+			continue
+		}
+		if err := attacher.AttachImage(attachment); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		note := ""
+		if attachment.Resized {
+			note = ", scaled down"
+		}
+		p.out.AddSystemMessage(fmt.Sprintf("Attached %s%s, it is sent with the next message (attach clear drops it)", attachment.Name, note))
+	}
+}
+
+// droppedImagePaths returns the paths of the image files dropped on the terminal, which types
+// them as absolute paths, quoted or with escaped spaces, or as file URLs. It returns nil unless
+// the whole line is made of paths of existing images.
+func droppedImagePaths(line string) []string {
+	paths := splitPaths(line)
+	for i, path := range paths {
+		if u, err := url.Parse(path); err == nil && u.Scheme == "file" {
+			path = u.Path
+		}
+		path = expandHome(path)
+		if !filepath.IsAbs(path) || !images.IsImagePath(path) {
+			return nil
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return nil
+		}
+		paths[i] = path
+	}
+	return paths
+}
+
+// splitPaths splits a line into paths separated by spaces, which may be quoted with single or
+// double quotes or, except on Windows where it separates directories, escaped with a backslash
+func splitPaths(line string) []string {
+	var paths []string
+	var b strings.Builder
+	var quote rune
+	inPath, escaped := false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\\' && filepath.Separator != '\\':
+			escaped, inPath = true, true
+		case r == '"' || r == '\'':
+			quote, inPath = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inPath {
+				paths = append(paths, b.String())
+				b.Reset()
+				inPath = false
+			}
+		default:
+			b.WriteRune(r)
+			inPath = true
+		}
+	}
+	if inPath {
+		paths = append(paths, b.String())
+	}
+	return paths
+}
+
+// expandHome replaces the ~ starting a path with the home directory of the user
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
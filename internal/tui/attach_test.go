@@ -0,0 +1,156 @@
+package tui
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/images"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// attachingWriter records the history entries and the attached images
+type attachingWriter struct {
+	recordingWriter
+	attached []images.Attachment
+}
+
+func (w *attachingWriter) AttachImage(attachment images.Attachment) error {
+	w.attached = append(w.attached, attachment)
+	return nil
+}
+
+func (w *attachingWriter) DetachImages() []images.Attachment {
+	detached := w.attached
+	w.attached = nil
+	return detached
+}
+
+// writePNG writes a small PNG image and returns its path
+func writePNG(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAttachCommand(t *testing.T) {
+	dir := t.TempDir()
+	shot := writePNG(t, dir, "shot.png")
+	spaced := writePNG(t, dir, "Screen Shot.png")
+	out := &attachingWriter{}
+	p := NewCommandProcessor(out)
+
+	p.Process("attach " + shot)
+	if len(out.attached) != 1 || out.attached[0].Placeholder() != "[image: shot.png 4x3]" {
+		t.Fatalf("attached = %+v", out.attached)
+	}
+
+	// A dropped path is attached rather than taken as a slash command
+	p.Process("'" + spaced + "'")
+	if len(out.attached) != 2 || out.attached[1].Name != "Screen Shot.png" {
+		t.Errorf("attached = %+v, want the dropped image", out.attached)
+	}
+
+	p.Process("attach " + filepath.Join(dir, "missing.png"))
+	if last := out.messages[len(out.messages)-1]; !strings.Contains(last, "failed to attach") {
+		t.Errorf("attach of a missing file = %q", last)
+	}
+
+	p.Process("attach clear")
+	if len(out.attached) != 0 || out.messages[len(out.messages)-1] != "Dropped 2 attached image(s)" {
+		t.Errorf("attach clear left %d images, message %q", len(out.attached), out.messages[len(out.messages)-1])
+	}
+}
+
+func TestDroppedImagePaths(t *testing.T) {
+	dir := t.TempDir()
+	shot := writePNG(t, dir, "shot.png")
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := droppedImagePaths(shot + " file://" + shot); !reflect.DeepEqual(got, []string{shot, shot}) {
+		t.Errorf("droppedImagePaths() = %v, want the path and the file URL", got)
+	}
+	for _, line := range []string{"ask what is " + shot, filepath.Join(dir, "notes.txt"), "shot.png", filepath.Join(dir, "missing.png")} {
+		if got := droppedImagePaths(line); got != nil {
+			t.Errorf("droppedImagePaths(%q) = %v, want nil", line, got)
+		}
+	}
+}
+
+func TestSplitPaths(t *testing.T) {
+	tests := map[string][]string{
+		`/a.png "/b c.png"  '/d e.png'`: {"/a.png", "/b c.png", "/d e.png"},
+		"":                              nil,
+	}
+	if filepath.Separator != '\\' {
+		tests[`/Screen\ Shot.png`] = []string{"/Screen Shot.png"}
+	}
+	for line, want := range tests {
+		if got := splitPaths(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitPaths(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestTaskManagerSendsAttachedImages(t *testing.T) {
+	type run struct {
+		message string
+		images  []provider.Image
+	}
+	runs := make(chan run, 2)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		runs <- run{message, out.(TaskAttachments).Images()}
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+	s := m.open(TaskInfo{ID: "task"})
+
+	attachment, err := images.Load(writePNG(t, t.TempDir(), "shot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.attach(attachment); err != nil {
+		t.Fatalf("attach() error = %v", err)
+	}
+	if entries := s.history.Entries(); entries[len(entries)-1].Content != "[image: shot.png 4x3]" {
+		t.Errorf("last history entry = %+v, want the placeholder of the image", entries[len(entries)-1])
+	}
+	for _, message := range []string{"what is this?", "thanks"} {
+		if err := m.submit(message); err != nil {
+			t.Fatalf("submit() error = %v", err)
+		}
+	}
+
+	var got []run
+	for range 2 {
+		select {
+		case r := <-runs:
+			got = append(got, r)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the agent loop did not run the messages")
+		}
+	}
+	if got[0].message != "what is this?\n[image: shot.png 4x3]" || len(got[0].images) != 1 || got[0].images[0].MediaType != "image/png" {
+		t.Errorf("first run = %q with %d image(s), want the image and its placeholder", got[0].message, len(got[0].images))
+	}
+	if got[1].message != "thanks" || len(got[1].images) != 0 {
+		t.Errorf("second run = %q with %d image(s), want the images sent once", got[1].message, len(got[1].images))
+	}
+}
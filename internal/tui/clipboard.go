@@ -0,0 +1,124 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kazz187/goline/internal/clipboard"
+)
+
+// Clipboard reads and writes the clipboard of the copy command and of Ctrl+V
+type Clipboard interface {
+	Read(ctx context.Context) (string, error)
+	Write(ctx context.Context, text string) error
+}
+
+// systemClipboard is the clipboard of the system
+type systemClipboard struct{}
+
+// Read implements Clipboard
+func (systemClipboard) Read(ctx context.Context) (string, error) {
+	return clipboard.Read(ctx)
+}
+
+// Write implements Clipboard
+func (systemClipboard) Write(ctx context.Context, text string) error {
+	return clipboard.Write(ctx, text)
+}
+
+// AgentOutputReader is implemented by front ends that give the last output of the agent of
+// the shown task, e.g. for the copy command
+type AgentOutputReader interface {
+	// LastAgentOutput returns the last output of the agent, empty if there is none
+	LastAgentOutput() string
+}
+
+// SetClipboard replaces the clipboard of the copy command and of Ctrl+V, the system one by default
+func (p *CommandProcessor) SetClipboard(c Clipboard) {
+	p.clipboard = c
+}
+
+// processCopy copies the last output of the agent, or one of its code blocks, to the clipboard
+func (p *CommandProcessor) processCopy(args []string) {
+	reader, ok := p.out.(AgentOutputReader)
+	if !ok {
+		p.out.AddSystemMessage("The output of the AI agent cannot be copied in this REPL")
+		return
+	}
+	output := reader.LastAgentOutput()
+	if output == "" {
+		p.out.AddSystemMessage("Error: the AI agent has not answered yet")
+		return
+	}
+
+	text, what := strings.TrimSpace(output), "the last message of the AI agent"
+	if len(args) > 0 {
+		if args[0] != "code" {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: unknown copy argument: %s, expected code [n]", args[0]))
+			return
+		}
+		blocks := codeBlocks(output)
+		if len(blocks) == 0 {
+			p.out.AddSystemMessage("Error: the last message of the AI agent has no code block")
+			return
+		}
+		n := len(blocks)
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 || n > len(blocks) {
+				p.out.AddSystemMessage(fmt.Sprintf("Error: invalid code block number: %s, the last message has %d code block(s)", args[1], len(blocks)))
+				return
+			}
+		}
+		text, what = blocks[n-1], fmt.Sprintf("code block %d of %d", n, len(blocks))
+	}
+
+	if err := p.clipboard.Write(context.Background(), text); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: failed to copy to the clipboard: %v", err))
+		return
+	}
+	p.out.AddSystemMessage(fmt.Sprintf("Copied %s to the clipboard (%d characters)", what, len([]rune(text))))
+}
+
+// codeBlocks returns the content of the fenced code blocks of a message, without their fences.
+// A block that is not closed runs to the end of the message.
+func codeBlocks(message string) []string {
+	var blocks []string
+	var block []string
+	fence := ""
+	for _, line := range strings.Split(message, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			// The fence is the whole run of backticks or tildes, so that longer fences can
+			// wrap blocks with fences
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+			block = nil
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "":
+			blocks = append(blocks, strings.Join(block, "\n"))
+			fence = ""
+		case fence != "":
+			block = append(block, line)
+		}
+	}
+	if fence != "" {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+	return blocks
+}
+
+// lastAgentOutput returns the last output of the agent in the history of a session
+func lastAgentOutput(s *taskSession) string {
+	if s == nil {
+		return ""
+	}
+	entries := s.history.Entries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Type == "agent" {
+			return entries[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package tui
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// memoryClipboard is a clipboard kept in memory
+type memoryClipboard struct {
+	text string
+}
+
+func (c *memoryClipboard) Read(ctx context.Context) (string, error) { return c.text, nil }
+func (c *memoryClipboard) Write(ctx context.Context, text string) error {
+	c.text = text
+	return nil
+}
+
+// answeredWriter records the history entries and gives the last output of the agent
+type answeredWriter struct {
+	recordingWriter
+	output string
+}
+
+func (w *answeredWriter) LastAgentOutput() string { return w.output }
+
+func TestCopyCommand(t *testing.T) {
+	out := &answeredWriter{}
+	p := NewCommandProcessor(out)
+	clipboard := &memoryClipboard{}
+	p.SetClipboard(clipboard)
+
+	p.Process("copy")
+	if last := out.messages[len(out.messages)-1]; !strings.Contains(last, "has not answered yet") {
+		t.Errorf("copy without an answer = %q", last)
+	}
+
+	out.output = "Run this:\n```sh\ngo test ./...\n```\nthen this:\n```go\nfunc main() {}\n```\n"
+	p.Process("copy")
+	if clipboard.text != strings.TrimSpace(out.output) {
+		t.Errorf("copy copied %q", clipboard.text)
+	}
+	p.Process("copy code")
+	if clipboard.text != "func main() {}" {
+		t.Errorf("copy code copied %q, want the last code block", clipboard.text)
+	}
+	p.Process("copy code 1")
+	if clipboard.text != "go test ./..." {
+		t.Errorf("copy code 1 copied %q", clipboard.text)
+	}
+	if last := out.messages[len(out.messages)-1]; last != "Copied code block 1 of 2 to the clipboard (13 characters)" {
+		t.Errorf("copy code 1 message = %q", last)
+	}
+	p.Process("copy code 3")
+	if last := out.messages[len(out.messages)-1]; !strings.Contains(last, "invalid code block number: 3") {
+		t.Errorf("copy code 3 message = %q", last)
+	}
+}
+
+func TestCodeBlocks(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"no code", nil},
+		{"```\na\nb\n```", []string{"a\nb"}},
+		{"  ```go\n  x := 1\n  ```\n~~~\ny\n~~~", []string{"  x := 1", "y"}},
+		{"````md\n```\nnested\n```\n````", []string{"```\nnested\n```"}},
+		{"```\nnot closed", []string{"not closed"}},
+	}
+	for _, tt := range tests {
+		if got := codeBlocks(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("codeBlocks(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
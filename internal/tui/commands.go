@@ -0,0 +1,503 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/gitcommit"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/core/regions"
+	"github.com/kazz187/goline/internal/core/review"
+	"github.com/kazz187/goline/internal/core/slashcommands"
+	"github.com/kazz187/goline/internal/core/snippets"
+)
+
+// HistoryWriter receives the entries produced while processing REPL commands
+type HistoryWriter interface {
+	AddUserInput(input string)
+	AddAgentOutput(output string)
+	AddSystemMessage(message string)
+}
+
+// HistoryPager is implemented by front ends that collapse long history entries into pages
+type HistoryPager interface {
+	ExpandHistoryEntry(n int, all bool) error
+	CollapseHistoryEntry(n int) error
+}
+
+// InputInserter is implemented by front ends that can put text in the input for the user to
+// edit before sending it, e.g. an inserted snippet
+type InputInserter interface {
+	InsertInput(text string)
+}
+
+// CommandResult tells the front end what to do after a command was processed
+type CommandResult int
+
+const (
+	// CommandDone means the command was fully handled
+	CommandDone CommandResult = iota
+	// CommandNeedsMultiLine means the command expects multi-line input to follow
+	CommandNeedsMultiLine
+	// CommandExit means the REPL should exit
+	CommandExit
+)
+
+// CommandProcessor processes REPL commands independently of the front end,
+// so the grid TUI and the linear accessible REPL share the same behaviour
+type CommandProcessor struct {
+	out HistoryWriter
+	// snippets stores the snippets of the snippet command
+	snippets *snippets.Store
+	// pendingSnippet is the snippet saved once its multi-line content is submitted
+	pendingSnippet snippets.Snippet
+	// committer commits the changes of the commit command, nil if commits are not available
+	committer *gitcommit.Committer
+	// reviewer reviews the changes of the review command, nil if reviews are not available
+	reviewer *review.Reviewer
+	// slash looks up the slash commands
+	slash *slashcommands.Registry
+	// resolveModel resolves the argument of the model command, nil to take it as a model of the
+	// provider of the task
+	resolveModel ModelResolver
+	// clipboard is written by the copy command and read by Ctrl+V
+	clipboard Clipboard
+	// lock is checked before the undo command writes to a task
+	lock taskLock
+	// frontEndHelp lists the commands the front end handles itself in the help
+	frontEndHelp []string
+}
+
+// NewCommandProcessor creates a new command processor writing to out
+func NewCommandProcessor(out HistoryWriter) *CommandProcessor {
+	cwd, _ := os.Getwd()
+	return &CommandProcessor{
+		out:       out,
+		snippets:  snippets.OpenDefault(cwd),
+		slash:     slashcommands.OpenDefault(cwd),
+		clipboard: systemClipboard{},
+	}
+}
+
+// SetFrontEndHelp sets the help lines of the commands the front end handles before the
+// processor, listed with the other commands
+func (p *CommandProcessor) SetFrontEndHelp(lines ...string) {
+	p.frontEndHelp = lines
+}
+
+// Process processes a single command line
+func (p *CommandProcessor) Process(command string) CommandResult {
+	// Split the command into parts
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return CommandDone
+	}
+
+	// Image files dropped on the terminal are attached, their absolute paths are not slash commands
+	if attacher, ok := p.out.(ImageAttacher); ok {
+		if paths := droppedImagePaths(command); paths != nil {
+			p.attachImages(attacher, paths)
+			return CommandDone
+		}
+	}
+
+	// Get the command name
+	cmdName := parts[0]
+	if name, ok := strings.CutPrefix(cmdName, "/"); ok {
+		p.processSlash(name, fieldsAfter(command, 1))
+		return CommandDone
+	}
+
+	switch cmdName {
+	case "exit":
+		return CommandExit
+	case "help":
+		p.out.AddSystemMessage("Available commands:")
+		p.out.AddSystemMessage("  help - Display help for REPL commands")
+		p.out.AddSystemMessage("  exit - Exit the REPL")
+		p.out.AddSystemMessage("  ask [question] - Ask the AI agent a question")
+		p.out.AddSystemMessage("  attach <path>...|clear - Attach PNG, JPEG or GIF images to the next message for models that read images, or drop them. Image files dropped on the terminal are attached too")
+		p.out.AddSystemMessage("  retry [--provider name] [--model name] - Discard the AI agent's last answer and regenerate it, keeping the discarded answer as an alternative")
+		p.out.AddSystemMessage("  apply - Apply the AI agent's suggestion")
+		p.out.AddSystemMessage("  cancel - Cancel the AI agent's suggestion")
+		p.out.AddSystemMessage("  checkpoint save - Save the current task state as a checkpoint")
+		p.out.AddSystemMessage("  checkpoint restore [checkpointID] [--path file]... - Restore a previously saved checkpoint, or only the given files")
+		p.out.AddSystemMessage("  undo [--yes] - Revert the last edits of the AI agent to the checkpoint saved before them, --yes also reverts the other files changed since")
+		p.out.AddSystemMessage("  diff [fromID] [toID] [--export file.patch] - Show the difference between two checkpoints, or a checkpoint and the current state")
+		p.out.AddSystemMessage("  review [--staged] [--ref ref] [instructions] - Ask the AI agent to review the working tree, the staged changes, or a ref without editing files")
+		p.out.AddSystemMessage("  changes [open n] [--sidecar] - List the regions edited by the AI agent in this task, open one in the editor, or write them to a review sidecar file")
+		p.out.AddSystemMessage("  expand [n] [all] - Show the next page, or all pages, of a long history entry")
+		p.out.AddSystemMessage("  collapse [n] - Show only the first page of a long history entry")
+		p.out.AddSystemMessage("  task new|switch <id>|list - Open a new task, show another task (Ctrl+T shows the next one), or list the open tasks")
+		p.out.AddSystemMessage("  continue - Ask the AI agent for the rest of a truncated response (Ctrl+O)")
+		p.out.AddSystemMessage("  language [code|default] - Show or set the language the AI agent answers in for this task, e.g. ja or en")
+		p.out.AddSystemMessage("  model [[provider/]name] - Show the model of this task, or switch it to another model, of another provider if prefixed with it, for the next messages")
+		p.out.AddSystemMessage("  set [temperature|top_p|max_output_tokens <value|default>] - Show the generation parameters of this task, or set one of them for the next messages, e.g. set temperature 0.7")
+		p.out.AddSystemMessage("  snippet list|show <name>|save <name> [--repo] [text]|insert <name> [var=value]...|delete <name> [--repo] - Manage reusable prompt snippets, Tab completes their names")
+		p.out.AddSystemMessage("  commit [--all] [--yes] - Stage the files edited by the AI agent in this task, or all the changes, and commit them with a generated conventional commit message you can edit")
+		p.out.AddSystemMessage("  copy [code [n]] - Copy the last message of the AI agent, or its nth code block (the last one by default), to the clipboard (Ctrl+Y)")
+		for _, line := range p.frontEndHelp {
+			p.out.AddSystemMessage(line)
+		}
+		p.listSlashCommands()
+		p.out.AddSystemMessage("Ctrl+B shows the file tree of the workspace: Up and Down select a file, Right and Left open and close directories, Enter inserts a mention of the file and Esc goes back to the input")
+		p.out.AddSystemMessage("Ctrl+V pastes the clipboard into the input, text of several lines starting a multi-line question sent with Ctrl+D")
+	case "ask":
+		question := strings.TrimSpace(strings.TrimPrefix(command, "ask"))
+		if question == "" {
+			return CommandNeedsMultiLine
+		}
+		if submitter, ok := p.out.(MessageSubmitter); ok {
+			p.submit(submitter, question)
+			return CommandDone
+		}
+		p.out.AddSystemMessage("Sending question to AI agent...")
+		p.out.AddSystemMessage("TODO: Implement ask logic")
+	case "attach":
+		p.processAttach(command)
+	case "retry":
+		p.processRetry(parts[1:])
+	case "apply":
+		p.out.AddSystemMessage("Applying AI agent's suggestion...")
+		p.out.AddSystemMessage("TODO: Implement apply logic")
+	case "cancel":
+		p.out.AddSystemMessage("Cancelling AI agent's suggestion...")
+		p.out.AddSystemMessage("TODO: Implement cancel logic")
+	case "checkpoint":
+		if len(parts) < 2 {
+			p.out.AddSystemMessage("Error: checkpoint subcommand is required")
+			return CommandDone
+		}
+		switch parts[1] {
+		case "save":
+			p.out.AddSystemMessage("Saving checkpoint...")
+			p.out.AddSystemMessage("TODO: Implement checkpoint save logic")
+			p.out.AddSystemMessage("Checkpoint ID: checkpoint-123")
+		case "restore":
+			if len(parts) < 3 {
+				p.out.AddSystemMessage("Error: checkpoint ID is required")
+				return CommandDone
+			}
+			checkpointID := parts[2]
+			p.out.AddSystemMessage(fmt.Sprintf("Restoring checkpoint %s...", checkpointID))
+			p.out.AddSystemMessage("TODO: Implement checkpoint restore logic")
+		default:
+			p.out.AddSystemMessage(fmt.Sprintf("Error: unknown checkpoint subcommand: %s", parts[1]))
+		}
+	case "undo":
+		p.processUndo(parts[1:])
+	case "diff":
+		if len(parts) < 2 {
+			p.out.AddSystemMessage("Error: checkpoint ID is required")
+			return CommandDone
+		}
+		if len(parts) > 2 && parts[2] != "--export" {
+			p.out.AddSystemMessage(fmt.Sprintf("Showing diff from checkpoint %s to %s...", parts[1], parts[2]))
+		} else {
+			p.out.AddSystemMessage(fmt.Sprintf("Showing diff for checkpoint %s...", parts[1]))
+		}
+		p.out.AddSystemMessage("TODO: Implement diff logic")
+	case "review":
+		p.processReview(parts[1:])
+	case "changes":
+		p.processChanges(parts[1:])
+	case "expand", "collapse":
+		p.processPaging(cmdName, parts[1:])
+	case "task":
+		p.processTask(parts[1:])
+	case "continue":
+		p.processContinue()
+	case "language":
+		p.processLanguage(parts[1:])
+	case "model":
+		p.processModel(fieldsAfter(command, 1))
+	case "set":
+		p.processSet(parts[1:])
+	case "copy":
+		p.processCopy(parts[1:])
+	case "snippet":
+		return p.processSnippet(command, parts[1:])
+	case "commit":
+		return p.processCommit(parts[1:])
+	default:
+		p.out.AddSystemMessage(fmt.Sprintf("Error: unknown command: %s", cmdName))
+	}
+
+	return CommandDone
+}
+
+// submit sends a question to the agent loop of the shown task
+func (p *CommandProcessor) submit(submitter MessageSubmitter, question string) {
+	if err := submitter.Submit(question); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// processTask opens a new task, shows another task or lists the open tasks
+func (p *CommandProcessor) processTask(args []string) {
+	switcher, ok := p.out.(TaskSwitcher)
+	if !ok {
+		p.out.AddSystemMessage("Only one task can run in this REPL")
+		return
+	}
+	if len(args) == 0 {
+		p.out.AddSystemMessage("Error: task subcommand is required")
+		return
+	}
+
+	switch args[0] {
+	case "new":
+		id, err := switcher.NewTask()
+		if err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: Failed to open a new task: %v", err))
+			return
+		}
+		p.out.AddSystemMessage(fmt.Sprintf("Switched to new task %s", id))
+	case "switch":
+		if len(args) < 2 {
+			p.out.AddSystemMessage("Error: task ID is required")
+			return
+		}
+		if err := switcher.SwitchTask(args[1]); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		}
+	case "list":
+		for _, summary := range switcher.Tasks() {
+			p.out.AddSystemMessage(formatTaskSummary(summary))
+		}
+	default:
+		p.out.AddSystemMessage(fmt.Sprintf("Error: unknown task subcommand: %s", args[0]))
+	}
+}
+
+// processContinue asks the agent of the shown task for the rest of its truncated response
+func (p *CommandProcessor) processContinue() {
+	continuer, ok := p.out.(ResponseContinuer)
+	if !ok {
+		p.out.AddSystemMessage("Truncated responses cannot be continued in this REPL")
+		return
+	}
+	if err := continuer.ContinueResponse(); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// processRetry asks the agent of the shown task to regenerate its last answer, with another
+// provider or model if given
+func (p *CommandProcessor) processRetry(args []string) {
+	retrier, ok := p.out.(ResponseRetrier)
+	if !ok {
+		p.out.AddSystemMessage("Answers cannot be regenerated in this REPL")
+		return
+	}
+	providerName, modelName, err := parseRetryArgs(args)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	var choice ModelChoice
+	if providerName != "" || modelName != "" {
+		current := ModelChoice{Provider: providerName}
+		if switcher, ok := p.out.(ModelSwitcher); ok && providerName == "" {
+			current = switcher.Model()
+		}
+		choice = ModelChoice{Provider: current.Provider, Model: modelName}
+		if p.resolveModel != nil {
+			if choice, err = p.resolveModel(current, modelName); err != nil {
+				p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+				return
+			}
+		}
+	}
+	p.out.AddSystemMessage(retryMessage(providerName, modelName))
+	if err := retrier.RetryResponse(choice); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// parseRetryArgs parses the arguments of the retry command.
+// Empty names keep the provider and model of the task.
+func parseRetryArgs(args []string) (providerName, modelName string, err error) {
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--provider", "--model":
+			if i+1 >= len(args) {
+				return "", "", fmt.Errorf("%s requires a value", args[i])
+			}
+			if args[i] == "--provider" {
+				providerName = args[i+1]
+			} else {
+				modelName = args[i+1]
+			}
+			i++
+		default:
+			return "", "", fmt.Errorf("unknown retry argument: %s", args[i])
+		}
+	}
+	return providerName, modelName, nil
+}
+
+// retryMessage describes the regeneration requested by the retry command
+func retryMessage(providerName, modelName string) string {
+	var with []string
+	if providerName != "" {
+		with = append(with, "provider "+providerName)
+	}
+	if modelName != "" {
+		with = append(with, "model "+modelName)
+	}
+	if len(with) == 0 {
+		return "Regenerating the last answer..."
+	}
+	return fmt.Sprintf("Regenerating the last answer with %s...", strings.Join(with, " and "))
+}
+
+// processLanguage shows or sets the response language of the shown task
+func (p *CommandProcessor) processLanguage(args []string) {
+	switcher, ok := p.out.(LanguageSwitcher)
+	if !ok {
+		p.out.AddSystemMessage("The response language cannot be changed in this REPL")
+		return
+	}
+	if len(args) == 0 {
+		p.out.AddSystemMessage(describeLanguage(switcher.ResponseLanguage()))
+		return
+	}
+
+	language := strings.Join(args, " ")
+	if language == "default" {
+		language = ""
+	}
+	switcher.SetResponseLanguage(language)
+	p.out.AddSystemMessage(describeLanguage(language))
+}
+
+// describeLanguage describes the response language of a task
+func describeLanguage(language string) string {
+	if language == "" {
+		return "The AI agent answers in the language of your messages"
+	}
+	return fmt.Sprintf("The AI agent answers in %s", prompts.LanguageName(language))
+}
+
+// processPaging expands or collapses a long history entry
+func (p *CommandProcessor) processPaging(cmdName string, args []string) {
+	pager, ok := p.out.(HistoryPager)
+	if !ok {
+		p.out.AddSystemMessage("History entries are never collapsed in this REPL")
+		return
+	}
+	if len(args) == 0 {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %s requires the number of a history entry", cmdName))
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: invalid history entry number: %s", args[0]))
+		return
+	}
+
+	if cmdName == "collapse" {
+		err = pager.CollapseHistoryEntry(n)
+	} else {
+		err = pager.ExpandHistoryEntry(n, len(args) > 1 && args[1] == "all")
+	}
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// processChanges lists the regions edited by the AI agent in the current task
+func (p *CommandProcessor) processChanges(args []string) {
+	var taskID string
+	if tasks, ok := p.out.(TaskContext); ok {
+		taskID = tasks.CurrentTaskID()
+	}
+	if taskID == "" {
+		p.out.AddSystemMessage("Error: No active task")
+		return
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: Failed to get working directory: %v", err))
+		return
+	}
+
+	tracker, err := regions.NewTracker(taskID)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: Failed to load edited regions: %v", err))
+		return
+	}
+	edited := tracker.Regions()
+	if len(edited) == 0 {
+		p.out.AddSystemMessage("No regions edited by the AI agent in this task")
+		return
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "open":
+		// The editor cannot take over the terminal while the TUI is drawn, so show the command to run
+		region, err := selectRegion(edited, args[1:])
+		if err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		cmd := regions.EditorCommand(filepath.Join(workingDir, region.Path), region.StartLine)
+		p.out.AddSystemMessage(fmt.Sprintf("Open it with: %s", strings.Join(cmd.Args, " ")))
+	case len(args) > 0 && args[0] == "--sidecar":
+		path, err := regions.WriteSidecar(workingDir, taskID, edited)
+		if err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		p.out.AddSystemMessage(fmt.Sprintf("Wrote %d annotation(s) to %s", len(edited), path))
+	default:
+		p.out.AddSystemMessage("Regions edited by the AI agent:")
+		for _, line := range formatRegions(edited) {
+			p.out.AddSystemMessage(line)
+		}
+		p.out.AddSystemMessage("Use `changes open <n>` to open a region in your editor")
+	}
+}
+
+// SubmitMultiLine handles the multi-line input collected for a command
+func (p *CommandProcessor) SubmitMultiLine(cmdName, input string) {
+	if cmdName == "snippet" {
+		p.saveSnippet(p.pendingSnippet.Name, input, p.pendingSnippet.Scope)
+		p.pendingSnippet = snippets.Snippet{}
+		return
+	}
+	if cmdName == "commit" {
+		p.commit(input)
+		return
+	}
+	if cmdName == "ask" {
+		if input == "" {
+			p.out.AddSystemMessage("Error: question is required")
+		} else {
+			// For the ask command, just add the user's question directly as a user message
+			// without any system messages
+			p.out.AddUserInput(fmt.Sprintf("ask\n%s", input))
+			if submitter, ok := p.out.(MessageSubmitter); ok {
+				p.submit(submitter, input)
+			}
+		}
+		return
+	}
+
+	// For other commands, display the multi-line input completed message and the input content
+	p.out.AddSystemMessage("Multi-line input completed")
+
+	// Display the input content as system messages
+	if input != "" {
+		p.out.AddSystemMessage("Input content:")
+		lines := strings.Split(input, "\n")
+		for _, line := range lines {
+			p.out.AddSystemMessage(line)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/gitcommit"
+)
+
+// InputPrefiller is implemented by front ends that can fill the multi-line input of a command
+// with text for the user to edit before sending it, e.g. a generated commit message
+type InputPrefiller interface {
+	PrefillInput(text string)
+}
+
+// SetCommitter sets the committer of the commit command, which is unavailable without one
+func (p *CommandProcessor) SetCommitter(committer *gitcommit.Committer) {
+	p.committer = committer
+}
+
+// processCommit stages the files edited by the AI agent in the current task, or all the
+// changes with --all, and generates their commit message. The message is committed once the
+// user edited and sent it, or right away with --yes.
+func (p *CommandProcessor) processCommit(args []string) CommandResult {
+	if p.committer == nil {
+		p.out.AddSystemMessage("Commits are not available without a configured provider")
+		return CommandDone
+	}
+	var all, yes bool
+	for _, arg := range args {
+		switch arg {
+		case "--all":
+			all = true
+		case "--yes":
+			yes = true
+		default:
+			p.out.AddSystemMessage(fmt.Sprintf("Error: unknown commit argument: %s", arg))
+			return CommandDone
+		}
+	}
+
+	var paths []string
+	if !all {
+		var taskID string
+		if tasks, ok := p.out.(TaskContext); ok {
+			taskID = tasks.CurrentTaskID()
+		}
+		if taskID == "" {
+			p.out.AddSystemMessage("Error: No active task")
+			return CommandDone
+		}
+		var err error
+		if paths, err = gitcommit.TaskPaths(taskID); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: Failed to load the files edited in this task: %v", err))
+			return CommandDone
+		}
+		if len(paths) == 0 {
+			p.out.AddSystemMessage("No files edited by the AI agent in this task, use `commit --all` to commit all the changes")
+			return CommandDone
+		}
+	}
+	if err := p.committer.Stage(paths); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return CommandDone
+	}
+
+	p.out.AddSystemMessage("Generating the commit message...")
+	message, _, err := p.committer.GenerateMessage(context.Background())
+	if errors.Is(err, gitcommit.ErrNothingToCommit) {
+		p.out.AddSystemMessage("No changes to commit")
+		return CommandDone
+	}
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return CommandDone
+	}
+
+	if yes {
+		p.commit(message.String())
+		return CommandDone
+	}
+	if prefiller, ok := p.out.(InputPrefiller); ok {
+		prefiller.PrefillInput(message.String())
+		p.out.AddSystemMessage("Edit the commit message and send it to commit the staged changes, or send it empty to cancel")
+	} else {
+		p.out.AddSystemMessage("Commit message:\n" + message.String())
+		p.out.AddSystemMessage("Enter the commit message to use, or nothing to cancel, `commit --yes` commits the generated message as is")
+	}
+	return CommandNeedsMultiLine
+}
+
+// commit commits the staged changes with the message edited by the user
+func (p *CommandProcessor) commit(message string) {
+	if strings.TrimSpace(message) == "" {
+		p.out.AddSystemMessage("Commit cancelled, the changes are left staged")
+		return
+	}
+	hash, err := p.committer.Commit(message)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	p.out.AddSystemMessage(fmt.Sprintf("Committed %s %s", hash, subject))
+}
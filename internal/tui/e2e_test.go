@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/agent"
+	"github.com/kazz187/goline/internal/core/gitcommit"
+)
+
+func TestSessionEditsFilesWithCheckpoints(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{EditFiles: true},
+		"I will create the file.\n<write_to_file>\n<path>hello.txt</path>\n<content>hello\n</content>\n</write_to_file>",
+		"<replace_in_file>\n<path>hello.txt</path>\n<diff>\n<<<<<<< SEARCH\nhello\n=======\nhello, world\n>>>>>>> REPLACE\n</diff>\n</replace_in_file>",
+		"<attempt_completion>\n<result>Created hello.txt</result>\n</attempt_completion>",
+	)
+
+	s.enter("ask Create hello.txt")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	if got := s.readFile("hello.txt"); got != "hello, world\n" {
+		t.Errorf("hello.txt = %q", got)
+	}
+	if n := s.checkpointCount("task-1"); n < 2 {
+		t.Errorf("%d checkpoint(s) saved, want one before each edit", n)
+	}
+	if got := s.provider.message(0); !strings.Contains(got, "Create hello.txt") {
+		t.Errorf("first message = %q, want the question", got)
+	}
+	s.requireHistory("user", "ask Create hello.txt")
+	s.requireHistory("agent", "I will create the file.")
+	s.requireHistory("tool", "write_to_file hello.txt (1 line)")
+	s.requireHistory("tool", "replace_in_file hello.txt")
+	s.requireHistory("system", "Task completed: Created hello.txt")
+
+	s.enter("changes")
+	s.requireHistory("system", "hello.txt")
+}
+
+func TestSessionSendsMultiLineQuestion(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{},
+		"<attempt_completion>\n<result>Done</result>\n</attempt_completion>",
+	)
+
+	s.enter("ask")
+	s.typeText("Fix the tests\nthen run them")
+	s.press("<C-d>")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	if got := s.provider.message(0); !strings.Contains(got, "Fix the tests\nthen run them") {
+		t.Errorf("first message = %q, want the multi-line question", got)
+	}
+	s.requireHistory("user", "ask\nFix the tests\nthen run them")
+}
+
+func TestSessionAnswersQuestion(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{},
+		"<ask_followup_question>\n<question>Which file?</question>\n<options>[\"a.go\", \"b.go\", \"c.go\"]</options>\n</ask_followup_question>",
+		"<attempt_completion>\n<result>Fixed b.go</result>\n</attempt_completion>",
+	)
+
+	s.enter("ask Fix it")
+	s.waitStatus(taskStatusWaitingForAnswer)
+	s.requireHistory("question", "Which file?\n  1. a.go\n  2. b.go\n  3. c.go")
+
+	s.press("<Down>", "<Down>", "<Enter>")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+	if got := s.provider.message(1); !strings.Contains(got, "<answer>\nb.go\n</answer>") {
+		t.Errorf("answer message = %q", got)
+	}
+	s.requireHistory("user", "b.go")
+	s.requireHistory("system", "Task completed: Fixed b.go")
+}
+
+func TestSessionInsertsSnippet(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{},
+		"<attempt_completion>\n<result>Fixed</result>\n</attempt_completion>",
+	)
+
+	s.enter("snippet save fix --repo Fix the bug in {{file}}")
+	s.typeText("snippet ins")
+	s.press("<Tab>")
+	s.enter("fix file=main.go")
+	s.press("<C-d>")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	if got := s.provider.message(0); !strings.Contains(got, "Fix the bug in main.go") {
+		t.Errorf("first message = %q, want the rendered snippet", got)
+	}
+	if got := s.readFile(".goline/snippets/fix.md"); got != "Fix the bug in {{file}}" {
+		t.Errorf("saved snippet = %q", got)
+	}
+}
+
+func TestSessionRunsTasksSideBySide(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{},
+		"<attempt_completion>\n<result>First done</result>\n</attempt_completion>",
+		"<ask_followup_question>\n<question>Which file?</question>\n</ask_followup_question>",
+	)
+
+	s.enter("ask First task")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+	s.enter("task new")
+	s.enter("ask Second task")
+	s.waitStatus(taskStatusWaitingForAnswer)
+	s.enter("main.go")
+	// The provider has no response left after the answer
+	if err := s.waitRun(); err == nil || errors.Is(err, agent.ErrNeedsInput) {
+		t.Fatalf("run error = %v, want the provider error", err)
+	}
+	s.requireHistory("user", "main.go")
+	s.requireHistory("system", "Error: ")
+
+	if tasks := s.repl.Tasks(); len(tasks) != 2 || tasks[0].Current || !tasks[1].Current {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	s.press("<C-t>")
+	s.requireHistory("system", "Task completed: First done")
+
+	s.enter("exit")
+	if !s.exited {
+		t.Error("exit did not end the session")
+	}
+}
+
+func TestSessionCommitsChanges(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{EditFiles: true},
+		"<write_to_file>\n<path>hello.txt</path>\n<content>hello\n</content>\n</write_to_file>",
+		"<attempt_completion>\n<result>Created hello.txt</result>\n</attempt_completion>",
+		`{"type": "feat", "subject": "add the greeting"}`,
+	)
+	git := initRepository(t, s.workspace)
+	s.repl.inputHandler.processor.SetCommitter(gitcommit.NewCommitter(s.provider, s.workspace))
+
+	s.enter("ask Create hello.txt")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	// The generated message is put in the input to edit before it is committed
+	s.enter("commit")
+	if got := s.repl.inputHandler.currentInput; got != "feat: add the greeting" {
+		t.Fatalf("input = %q, want the generated message", got)
+	}
+	if got := s.provider.message(2); !strings.Contains(got, "+hello") {
+		t.Errorf("commit message request = %q, want the staged diff", got)
+	}
+	s.typeText("\n\nSay hello.")
+	s.press("<C-d>")
+
+	s.requireHistory("system", "Committed ")
+	if got := git("log", "-1", "--format=%B"); got != "feat: add the greeting\n\nSay hello.\n\n" {
+		t.Errorf("commit message = %q", got)
+	}
+	if got := git("status", "--porcelain"); got != "" {
+		t.Errorf("status = %q, want the changes committed", got)
+	}
+}
+
+func TestSessionHelpListsDebug(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{})
+
+	s.enter("help")
+	// The debug command is listed with the other commands, before the key bindings
+	debug, keys := -1, -1
+	for i, entry := range s.history() {
+		switch {
+		case strings.HasPrefix(entry.Content, "  debug - "):
+			debug = i
+		case strings.HasPrefix(entry.Content, "Ctrl+B") && keys < 0:
+			keys = i
+		}
+	}
+	if debug < 0 || keys < 0 || debug > keys {
+		t.Errorf("help lists debug at %d and the key bindings at %d:\n%s", debug, keys, s.dumpHistory())
+	}
+
+	// Only the TUI has an input buffer for the debug command to inspect
+	out := &recordingWriter{}
+	NewCommandProcessor(out).Process("help")
+	for _, message := range out.messages {
+		if strings.Contains(message, "debug") {
+			t.Errorf("help outside the TUI lists the debug command: %q", message)
+		}
+	}
+}
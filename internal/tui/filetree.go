@@ -0,0 +1,256 @@
+package tui
+
+import (
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/ignore"
+)
+
+// fileMark is what the agent of a task did with a file
+type fileMark int
+
+const (
+	fileUnmarked fileMark = iota
+	// fileRead marks the files the agent read
+	fileRead
+	// fileEdited marks the files the agent wrote or edited, whether it read them or not
+	fileEdited
+)
+
+// fileMarkOf returns what a complete tool use does with the file of its path parameter
+func fileMarkOf(toolUse assistantmessage.ToolUse) fileMark {
+	switch toolUse.Name {
+	case assistantmessage.ReadFileToolName, assistantmessage.ListCodeDefinitionNamesToolName:
+		return fileRead
+	case assistantmessage.WriteToFileToolName, assistantmessage.ReplaceInFileToolName:
+		return fileEdited
+	default:
+		return fileUnmarked
+	}
+}
+
+// fileTreeRow is a file or directory shown in the file tree
+type fileTreeRow struct {
+	// path is the path of the file relative to the workspace, with slashes
+	path  string
+	depth int
+	dir   bool
+}
+
+// fileTree is the file tree of the workspace shown in the left-hand pane. The files ignored by
+// .golineignore are left out, and the files the agent of the shown task read or edited are marked.
+type fileTree struct {
+	mu     sync.Mutex
+	root   string
+	ignore *ignore.Controller
+	// expanded are the directories whose content is shown
+	expanded map[string]bool
+	rows     []fileTreeRow
+	selected int
+	marks    map[string]fileMark
+	// visible reports whether the pane is shown, focused whether it gets the keys
+	visible bool
+	focused bool
+}
+
+// newFileTree creates the file tree of a workspace. It is only read once shown.
+func newFileTree(root string) *fileTree {
+	controller := ignore.NewController(root)
+	if err := controller.Initialize(); err != nil {
+		slog.Warn("Failed to load the ignore files for the file tree", "error", err)
+	}
+	return &fileTree{
+		root:     root,
+		ignore:   controller,
+		expanded: make(map[string]bool),
+	}
+}
+
+// Toggle shows the pane focused, focuses it if it is shown but not focused, and hides it
+// otherwise. It reports whether the pane is shown.
+func (t *fileTree) Toggle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case !t.visible:
+		t.visible, t.focused = true, true
+		t.load()
+	case !t.focused:
+		t.focused = true
+	default:
+		t.visible, t.focused = false, false
+	}
+	return t.visible
+}
+
+// Visible reports whether the pane is shown
+func (t *fileTree) Visible() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.visible
+}
+
+// Focused reports whether the pane gets the keys
+func (t *fileTree) Focused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.focused
+}
+
+// Blur gives the keys back to the input, leaving the pane shown
+func (t *fileTree) Blur() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.focused = false
+}
+
+// SetMarks replaces the marks of the files, those of the shown task, by the paths given to
+// the tools
+func (t *fileTree) SetMarks(marks map[string]fileMark) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.marks = make(map[string]fileMark, len(marks))
+	for path, mark := range marks {
+		t.marks[relativePath(t.root, path)] = mark
+	}
+}
+
+// Move moves the selection by delta rows
+func (t *fileTree) Move(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.selected = max(0, min(len(t.rows)-1, t.selected+delta))
+}
+
+// Expand shows the content of the selected directory if expand is true, and hides it
+// otherwise. Collapsing a file selects its directory.
+func (t *fileTree) Expand(expand bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.selected >= len(t.rows) {
+		return
+	}
+	row := t.rows[t.selected]
+	if !row.dir {
+		if !expand {
+			t.selectPath(filepath.ToSlash(filepath.Dir(row.path)))
+		}
+		return
+	}
+	if t.expanded[row.path] == expand {
+		return
+	}
+	t.expanded[row.path] = expand
+	t.load()
+	t.selectPath(row.path)
+}
+
+// Select opens or closes the selected directory, or returns the path of the selected file
+// with ok set
+func (t *fileTree) Select() (path string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.selected >= len(t.rows) {
+		return "", false
+	}
+	row := t.rows[t.selected]
+	if !row.dir {
+		return row.path, true
+	}
+	t.expanded[row.path] = !t.expanded[row.path]
+	t.load()
+	t.selectPath(row.path)
+	return "", false
+}
+
+// Rows formats the rows of the tree. Directories are shown with an arrow telling whether
+// they are expanded, edited files with E and read files with R.
+func (t *fileTree) Rows() ([]string, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rows := make([]string, len(t.rows))
+	for i, row := range t.rows {
+		indent := strings.Repeat("  ", row.depth)
+		name := filepath.Base(filepath.FromSlash(row.path))
+		switch {
+		case row.dir && t.expanded[row.path]:
+			rows[i] = "  " + indent + "▾ " + name + "/"
+		case row.dir:
+			rows[i] = "  " + indent + "▸ " + name + "/"
+		default:
+			marker := "  "
+			switch t.marks[row.path] {
+			case fileRead:
+				marker = "R "
+			case fileEdited:
+				marker = "E "
+			}
+			rows[i] = marker + indent + "  " + name
+		}
+	}
+	return rows, t.selected
+}
+
+// load reads the tree again, the content of the expanded directories only
+func (t *fileTree) load() {
+	t.rows = nil
+	err := t.ignore.WalkAllowed(t.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are left out
+			if d != nil && d.IsDir() && path != t.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == t.root {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(t.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		t.rows = append(t.rows, fileTreeRow{path: rel, depth: strings.Count(rel, "/"), dir: d.IsDir()})
+		if d.IsDir() && !t.expanded[rel] {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Failed to read the file tree", "error", err)
+	}
+	t.selected = max(0, min(len(t.rows)-1, t.selected))
+}
+
+// selectPath selects the row of a path if it is shown
+func (t *fileTree) selectPath(path string) {
+	for i, row := range t.rows {
+		if row.path == path {
+			t.selected = i
+			return
+		}
+	}
+}
+
+// relativePath returns a path given to a tool relative to the workspace with slashes, as the
+// rows of the tree
+func relativePath(root, path string) string {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
@@ -0,0 +1,108 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/config"
+)
+
+// writeWorkspace creates files in a workspace, with their directories
+func writeWorkspace(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileTree(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	writeWorkspace(t, dir, "main.go", "internal/tui/ui.go", "secret.txt", ".git/HEAD")
+	if err := os.WriteFile(filepath.Join(dir, ".golineignore"), []byte("secret.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tree := newFileTree(dir)
+	if !tree.Toggle() {
+		t.Fatal("the first toggle should show the tree")
+	}
+	rows, _ := tree.Rows()
+	if got := strings.Join(rows, "\n"); got != "  ▸ internal/\n    main.go" {
+		t.Fatalf("unexpected rows:\n%s", got)
+	}
+
+	// Open internal/ and internal/tui/
+	tree.Expand(true)
+	tree.Move(1)
+	if _, ok := tree.Select(); ok {
+		t.Fatal("selecting a directory should open it")
+	}
+	tree.SetMarks(map[string]fileMark{"internal/tui/ui.go": fileEdited, filepath.Join(dir, "main.go"): fileRead})
+	rows, selected := tree.Rows()
+	want := "  ▾ internal/\n    ▾ tui/\nE       ui.go\nR   main.go"
+	if got := strings.Join(rows, "\n"); got != want {
+		t.Fatalf("unexpected rows:\n%s\nwant:\n%s", got, want)
+	}
+	if selected != 1 {
+		t.Errorf("selected = %d, want the opened directory", selected)
+	}
+
+	tree.Move(1)
+	if path, ok := tree.Select(); !ok || path != "internal/tui/ui.go" {
+		t.Errorf("Select() = %q, %v, want the selected file", path, ok)
+	}
+
+	// Left on a file selects its directory, and on a directory closes it
+	tree.Expand(false)
+	tree.Expand(false)
+	if rows, _ := tree.Rows(); len(rows) != 3 {
+		t.Errorf("closing tui/ should hide its files:\n%s", strings.Join(rows, "\n"))
+	}
+}
+
+func TestSessionFileTree(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{ReadFiles: true},
+		"<read_file>\n<path>notes.txt</path>\n</read_file>",
+		"<attempt_completion>\n<result>Read.</result>\n</attempt_completion>",
+	)
+	writeWorkspace(t, s.workspace, "notes.txt", "main.go")
+
+	s.enter("ask Read the notes")
+	if err := s.waitRun(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	s.press("<C-b>")
+	tree := s.repl.ui.FileTree()
+	if !tree.Visible() || !tree.Focused() {
+		t.Fatal("Ctrl+B should show and focus the file tree")
+	}
+	rows, _ := tree.Rows()
+	if got := strings.Join(rows, "\n"); got != "    main.go\nR   notes.txt" {
+		t.Fatalf("unexpected rows:\n%s", got)
+	}
+
+	// Keys go to the tree until a file is picked
+	s.typeText("see")
+	s.press("<Space>", "<Down>", "<Enter>")
+	if s.repl.inputHandler.currentInput != "see @/notes.txt " {
+		t.Errorf("input = %q, want a mention of the selected file", s.repl.inputHandler.currentInput)
+	}
+	if tree.Focused() || !tree.Visible() {
+		t.Error("picking a file should give the keys back to the input and keep the tree shown")
+	}
+
+	s.press("<C-b>", "<C-b>")
+	if tree.Visible() {
+		t.Error("Ctrl+B should hide the focused file tree")
+	}
+}
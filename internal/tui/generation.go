@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// Generation parameters of the set command
+const (
+	paramTemperature     = "temperature"
+	paramTopP            = "top_p"
+	paramMaxOutputTokens = "max_output_tokens"
+)
+
+// GenerationSwitcher is implemented by front ends whose tasks can change the sampling settings
+// of their requests
+type GenerationSwitcher interface {
+	// SetGeneration sets the sampling settings of the shown task for its next messages
+	SetGeneration(opts provider.GenerationOptions)
+	// Generation returns the sampling settings of the shown task, unset values being those of
+	// the provider
+	Generation() provider.GenerationOptions
+}
+
+// processSet shows the sampling settings of the shown task, or sets one of them, e.g.
+// set temperature 0.7. The value default goes back to the setting of the provider.
+func (p *CommandProcessor) processSet(args []string) {
+	switcher, ok := p.out.(GenerationSwitcher)
+	if !ok {
+		p.out.AddSystemMessage("The generation parameters cannot be changed in this REPL")
+		return
+	}
+	opts := switcher.Generation()
+	if len(args) == 0 {
+		p.out.AddSystemMessage(describeGeneration(opts))
+		return
+	}
+	if len(args) != 2 {
+		p.out.AddSystemMessage("Error: usage: set temperature|top_p|max_output_tokens <value|default>")
+		return
+	}
+
+	if err := setGenerationParam(&opts, args[0], args[1]); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	switcher.SetGeneration(opts)
+	p.out.AddSystemMessage(describeGeneration(opts))
+}
+
+// setGenerationParam sets a parameter of the sampling settings, unsetting it for default
+func setGenerationParam(opts *provider.GenerationOptions, name, value string) error {
+	switch name {
+	case paramTemperature, paramTopP:
+		target := &opts.Temperature
+		limit := 2.0
+		if name == paramTopP {
+			target, limit = &opts.TopP, 1
+		}
+		if value == "default" {
+			*target = nil
+			return nil
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || number < 0 || number > limit {
+			return fmt.Errorf("%s must be a number between 0 and %g", name, limit)
+		}
+		*target = &number
+	case paramMaxOutputTokens:
+		if value == "default" {
+			opts.MaxOutputTokens = 0
+			return nil
+		}
+		tokens, err := strconv.Atoi(value)
+		if err != nil || tokens <= 0 {
+			return fmt.Errorf("%s must be a positive number of tokens", name)
+		}
+		opts.MaxOutputTokens = tokens
+	default:
+		return fmt.Errorf("unknown parameter: %s, expected %s, %s or %s", name, paramTemperature, paramTopP, paramMaxOutputTokens)
+	}
+	return nil
+}
+
+// describeGeneration describes the sampling settings of a task
+func describeGeneration(opts provider.GenerationOptions) string {
+	temperature, topP, maxOutputTokens := "(provider default)", "(provider default)", "(model limit)"
+	if opts.Temperature != nil {
+		temperature = strconv.FormatFloat(*opts.Temperature, 'g', -1, 64)
+	}
+	if opts.TopP != nil {
+		topP = strconv.FormatFloat(*opts.TopP, 'g', -1, 64)
+	}
+	if opts.MaxOutputTokens > 0 {
+		maxOutputTokens = strconv.Itoa(opts.MaxOutputTokens)
+	}
+	return fmt.Sprintf("Generation parameters of this task: %s %s, %s %s, %s %s",
+		paramTemperature, temperature, paramTopP, topP, paramMaxOutputTokens, maxOutputTokens)
+}
@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// historyPageLines is the number of lines of an entry shown per page.
+// Longer entries are collapsed to their first page until expanded.
+const historyPageLines = 100
+
+// historyRecord is an entry of the history view with its rendered rows
+type historyRecord struct {
+	entry HistoryEntry
+	// lines are the lines of the content, split once when the entry is added
+	lines []string
+	// pages is the number of pages shown, zero for all of them
+	pages int
+	// rows are the rendered rows, cached for width
+	rows  []string
+	width int
+}
+
+// historyView holds the history entries and renders only the rows in the visible window.
+// Rows of an entry are built the first time the entry is visible and cached until the width
+// changes or the entry is expanded, so long histories do not slow down every render.
+type historyView struct {
+	mu      sync.Mutex
+	records []*historyRecord
+	// scroll is the number of rows scrolled up from the bottom
+	scroll int
+}
+
+// newHistoryView creates an empty history view
+func newHistoryView() *historyView {
+	return &historyView{}
+}
+
+// Add appends an entry
+func (v *historyView) Add(entry HistoryEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.records = append(v.records, &historyRecord{
+		entry: entry,
+		lines: strings.Split(strings.TrimRight(entry.Content, "\n"), "\n"),
+		pages: 1,
+	})
+}
+
+// Stitch replaces the content of the last entry of a type with stitch applied to it, and
+// reports whether there was one
+func (v *historyView) Stitch(entryType string, stitch func(content string) string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := len(v.records) - 1; i >= 0; i-- {
+		record := v.records[i]
+		if record.entry.Type != entryType {
+			continue
+		}
+		record.entry.Content = stitch(record.entry.Content)
+		record.lines = strings.Split(strings.TrimRight(record.entry.Content, "\n"), "\n")
+		record.rows = nil
+		return true
+	}
+	return false
+}
+
+// Len returns the number of entries
+func (v *historyView) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.records)
+}
+
+// Entries returns a copy of the entries
+func (v *historyView) Entries() []HistoryEntry {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entries := make([]HistoryEntry, len(v.records))
+	for i, record := range v.records {
+		entries[i] = record.entry
+	}
+	return entries
+}
+
+// Expand shows the next page of the nth entry (1-based), or all of its pages
+func (v *historyView) Expand(n int, all bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	record, err := v.record(n)
+	if err != nil {
+		return err
+	}
+	if record.pages == 0 || record.pages*historyPageLines >= len(record.lines) {
+		return fmt.Errorf("entry %d is already fully expanded", n)
+	}
+	if all {
+		record.pages = 0
+	} else {
+		record.pages++
+	}
+	record.rows = nil
+	return nil
+}
+
+// Collapse shows only the first page of the nth entry (1-based)
+func (v *historyView) Collapse(n int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	record, err := v.record(n)
+	if err != nil {
+		return err
+	}
+	record.pages = 1
+	record.rows = nil
+	return nil
+}
+
+// record returns the nth entry (1-based)
+func (v *historyView) record(n int) (*historyRecord, error) {
+	if n < 1 || n > len(v.records) {
+		return nil, fmt.Errorf("no history entry %d", n)
+	}
+	return v.records[n-1], nil
+}
+
+// Scroll scrolls the view up by delta rows, or down for a negative delta
+func (v *historyView) Scroll(delta int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.scroll = max(0, v.scroll+delta)
+}
+
+// Rows returns the rows visible in a window of the given size.
+// Only the entries in the window are rendered, starting from the newest.
+func (v *historyView) Rows(width, height int) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if height <= 0 {
+		return nil
+	}
+
+	// Collect rows from the bottom until the window scrolled up is filled
+	needed := v.scroll + height
+	var collected [][]string
+	total := 0
+	for i := len(v.records) - 1; i >= 0 && total < needed; i-- {
+		rows := v.records[i].render(i+1, width)
+		collected = append(collected, rows)
+		total += len(rows)
+	}
+
+	// Scrolling stops at the first entry
+	if total < needed {
+		v.scroll = max(0, total-height)
+	}
+
+	var rows []string
+	for i := len(collected) - 1; i >= 0; i-- {
+		rows = append(rows, collected[i]...)
+	}
+	end := len(rows) - v.scroll
+	start := max(0, end-height)
+	return rows[start:end]
+}
+
+// render returns the rows of the nth entry wrapped to width, using the cache if possible
+func (r *historyRecord) render(n, width int) []string {
+	if r.rows != nil && r.width == width {
+		return r.rows
+	}
+
+	lines := r.lines
+	hidden := 0
+	if r.pages > 0 && len(lines) > r.pages*historyPageLines {
+		hidden = len(lines) - r.pages*historyPageLines
+		lines = lines[:r.pages*historyPageLines]
+	}
+
+	prefix := fmt.Sprintf("[%s] %s ", r.entry.Timestamp.Format("15:04:05"), historyPrefix(r.entry.Type))
+	var rows []string
+	for i, line := range lines {
+		if i == 0 {
+			line = prefix + line
+		}
+		rows = append(rows, wrapRow(line, width)...)
+	}
+	if hidden > 0 {
+		footer := fmt.Sprintf("  ... %d more lines hidden (expand %d for the next %d lines, expand %d all for everything)",
+			hidden, n, min(hidden, historyPageLines), n)
+		rows = append(rows, wrapRow(footer, width)...)
+	}
+
+	r.rows = rows
+	r.width = width
+	return rows
+}
+
+// historyPrefix returns the label of an entry type
+func historyPrefix(entryType string) string {
+	switch entryType {
+	case "user":
+		return "[User]"
+	case "agent":
+		return "[Agent]"
+	case "system":
+		return "[System]"
+	case "tool":
+		return "[Tool]"
+	case "question":
+		return "[Question]"
+	default:
+		return ""
+	}
+}
+
+// wrapRow splits a line into rows no wider than width cells
+func wrapRow(line string, width int) []string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	if width <= 0 || runewidth.StringWidth(line) <= width {
+		return []string{line}
+	}
+
+	var rows []string
+	var row strings.Builder
+	rowWidth := 0
+	for _, char := range line {
+		charWidth := runewidth.RuneWidth(char)
+		if rowWidth+charWidth > width && rowWidth > 0 {
+			rows = append(rows, row.String())
+			row.Reset()
+			rowWidth = 0
+		}
+		row.WriteRune(char)
+		rowWidth += charWidth
+	}
+	return append(rows, row.String())
+}
@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addLines adds an agent entry with n numbered lines
+func addLines(v *historyView, n int) {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	v.Add(HistoryEntry{Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Type: "agent", Content: strings.Join(lines, "\n")})
+}
+
+func TestHistoryViewRowsWindow(t *testing.T) {
+	v := newHistoryView()
+	addLines(v, 3)
+	addLines(v, 3)
+
+	rows := v.Rows(80, 4)
+	want := []string{"line 3", "[12:00:00] [Agent] line 1", "line 2", "line 3"}
+	if strings.Join(rows, "|") != strings.Join(want, "|") {
+		t.Errorf("Rows() = %q, want %q", rows, want)
+	}
+
+	v.Scroll(1)
+	rows = v.Rows(80, 4)
+	want = []string{"line 2", "line 3", "[12:00:00] [Agent] line 1", "line 2"}
+	if strings.Join(rows, "|") != strings.Join(want, "|") {
+		t.Errorf("Rows() after scrolling = %q, want %q", rows, want)
+	}
+
+	// Scrolling stops at the first entry
+	v.Scroll(100)
+	rows = v.Rows(80, 4)
+	if rows[0] != "[12:00:00] [Agent] line 1" || v.scroll != 2 {
+		t.Errorf("Rows() scrolled past the top = %q, scroll = %d", rows, v.scroll)
+	}
+}
+
+func TestHistoryViewRendersVisibleEntriesOnly(t *testing.T) {
+	v := newHistoryView()
+	for range 3 {
+		addLines(v, 3)
+	}
+
+	v.Rows(80, 3)
+	if v.records[0].rows != nil || v.records[1].rows != nil {
+		t.Error("entry outside the window was rendered")
+	}
+	if v.records[2].rows == nil {
+		t.Error("visible entry was not rendered")
+	}
+}
+
+func TestHistoryViewPaging(t *testing.T) {
+	v := newHistoryView()
+	addLines(v, historyPageLines*2+50)
+
+	rows := v.Rows(200, 1000)
+	if len(rows) != historyPageLines+1 {
+		t.Fatalf("collapsed entry has %d rows, want %d", len(rows), historyPageLines+1)
+	}
+	if footer := rows[len(rows)-1]; !strings.Contains(footer, "150 more lines hidden") || !strings.Contains(footer, "expand 1") {
+		t.Errorf("footer = %q", footer)
+	}
+
+	if err := v.Expand(1, false); err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	if rows := v.Rows(200, 1000); len(rows) != historyPageLines*2+1 {
+		t.Errorf("expanded entry has %d rows, want %d", len(rows), historyPageLines*2+1)
+	}
+
+	if err := v.Expand(1, true); err != nil {
+		t.Fatalf("Expand(all) error = %v", err)
+	}
+	if rows := v.Rows(200, 1000); len(rows) != historyPageLines*2+50 {
+		t.Errorf("fully expanded entry has %d rows, want %d", len(rows), historyPageLines*2+50)
+	}
+	if err := v.Expand(1, false); err == nil {
+		t.Error("Expand() of a fully expanded entry succeeded")
+	}
+
+	if err := v.Collapse(1); err != nil {
+		t.Fatalf("Collapse() error = %v", err)
+	}
+	if rows := v.Rows(200, 1000); len(rows) != historyPageLines+1 {
+		t.Errorf("collapsed entry has %d rows, want %d", len(rows), historyPageLines+1)
+	}
+
+	if err := v.Expand(2, false); err == nil {
+		t.Error("Expand() of a missing entry succeeded")
+	}
+}
+
+func TestWrapRow(t *testing.T) {
+	if rows := wrapRow("abcdefg", 3); strings.Join(rows, "|") != "abc|def|g" {
+		t.Errorf("wrapRow() = %q", rows)
+	}
+	// Wide characters take two cells
+	if rows := wrapRow("あいう", 4); strings.Join(rows, "|") != "あい|う" {
+		t.Errorf("wrapRow() with wide characters = %q", rows)
+	}
+}
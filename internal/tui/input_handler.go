@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"github.com/abiosoft/ishell/v2"
 	"io"
@@ -8,6 +9,8 @@ import (
 	"strings"
 
 	ui "github.com/gizak/termui/v3"
+
+	"github.com/kazz187/goline/internal/core/mentions"
 )
 
 // InputHandler handles input for the TUI
@@ -19,6 +22,11 @@ type InputHandler struct {
 	historyIndex  int
 	inputHistory  []string
 	commandActive bool
+	// multiLineCommand is the command collecting multi-line input
+	multiLineCommand string
+	// insertedInput replaces the input once the command being processed is done, see insertInput
+	insertedInput string
+	processor     *CommandProcessor
 	shell         *ishell.Shell
 	shellInput    io.Writer
 }
@@ -30,6 +38,9 @@ func (h *InputHandler) GetCursorPosition() int {
 
 // NewInputHandler creates a new input handler
 func NewInputHandler(ui *UI, integration *REPLIntegration, shell *ishell.Shell, shellInput io.Writer) *InputHandler {
+	processor := NewCommandProcessor(integration)
+	// The debug command is only listed in the TUI, the other front ends do not have it
+	processor.SetFrontEndHelp("  debug - Show debug information about the current input")
 	return &InputHandler{
 		ui:           ui,
 		integration:  integration,
@@ -37,6 +48,7 @@ func NewInputHandler(ui *UI, integration *REPLIntegration, shell *ishell.Shell,
 		cursorPos:    0,
 		historyIndex: -1,
 		inputHistory: []string{},
+		processor:    processor,
 		shell:        shell,
 		shellInput:   shellInput,
 	}
@@ -44,6 +56,13 @@ func NewInputHandler(ui *UI, integration *REPLIntegration, shell *ishell.Shell,
 
 // HandleKeyEvent handles a key event
 func (h *InputHandler) HandleKeyEvent(e ui.Event) bool {
+	// The file tree gets the keys moving in it while it is focused
+	if h.ui.FileTree().Focused() && h.handleFileTreeKey(e.ID) {
+		h.ui.FileTreeChanged()
+		h.ui.UpdateREPLInput(h.currentInput)
+		return false
+	}
+
 	switch e.ID {
 	case "<C-c>":
 		// Ctrl+C to exit
@@ -75,6 +94,12 @@ func (h *InputHandler) HandleKeyEvent(e ui.Event) bool {
 	case "<Down>":
 		// Down arrow to navigate history
 		h.handleDown()
+	case "<PageUp>":
+		// Page Up to scroll the history up
+		h.ui.ScrollHistory(h.ui.HistoryPageSize())
+	case "<PageDown>":
+		// Page Down to scroll the history down
+		h.ui.ScrollHistory(-h.ui.HistoryPageSize())
 	case "<C-a>":
 		// Ctrl+A to move cursor to beginning
 		h.handleHome()
@@ -87,6 +112,24 @@ func (h *InputHandler) HandleKeyEvent(e ui.Event) bool {
 	case "<C-u>":
 		// Ctrl+U to delete to beginning
 		h.handleDeleteToBeginning()
+	case "<C-t>":
+		// Ctrl+T to show the next task
+		h.integration.NextTask()
+	case "<C-b>":
+		// Ctrl+B to show, focus or hide the file tree
+		h.ui.FileTree().Toggle()
+		h.ui.FileTreeChanged()
+	case "<C-o>":
+		// Ctrl+O to continue a truncated response
+		if err := h.integration.ContinueResponse(); err != nil {
+			h.integration.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		}
+	case "<C-v>":
+		// Ctrl+V to paste the clipboard
+		h.handlePaste()
+	case "<C-y>":
+		// Ctrl+Y to copy the last message of the agent
+		h.processor.processCopy(nil)
 	case "<Tab>":
 		// Tab for auto-completion (not implemented yet)
 		h.handleTab()
@@ -98,33 +141,8 @@ func (h *InputHandler) HandleKeyEvent(e ui.Event) bool {
 		if h.commandActive {
 			// If we're in a multi-line input mode, submit the current input
 			h.commandActive = false
-
-			rootCmd := h.shell.RootCmd()
-			// Get the command from the prompt
-			cmdName := strings.TrimSuffix(rootCmd.Name, "> ")
-
-			// Process the multi-line input based on the command
-			if cmdName == "ask" {
-				if h.currentInput == "" {
-					h.integration.AddSystemMessage("Error: question is required")
-				} else {
-					// For the ask command, just add the user's question directly as a user message
-					// without any system messages
-					h.integration.AddUserInput(fmt.Sprintf("ask\n%s", h.currentInput))
-				}
-			} else {
-				// For other commands, display the multi-line input completed message and the input content
-				h.integration.AddSystemMessage("Multi-line input completed")
-
-				// Display the input content as system messages
-				if h.currentInput != "" {
-					h.integration.AddSystemMessage("Input content:")
-					lines := strings.Split(h.currentInput, "\n")
-					for _, line := range lines {
-						h.integration.AddSystemMessage(line)
-					}
-				}
-			}
+			h.processor.SubmitMultiLine(h.multiLineCommand, h.currentInput)
+			h.multiLineCommand = ""
 
 			// Clear the input
 			h.currentInput = ""
@@ -159,6 +177,46 @@ func (h *InputHandler) HandleKeyEvent(e ui.Event) bool {
 	return false
 }
 
+// handleFileTreeKey moves in the focused file tree, Enter inserting a mention of the selected
+// file. It reports whether the key was handled.
+func (h *InputHandler) handleFileTreeKey(key string) bool {
+	tree := h.ui.FileTree()
+	switch key {
+	case "<Up>":
+		tree.Move(-1)
+	case "<Down>":
+		tree.Move(1)
+	case "<PageUp>":
+		tree.Move(-h.ui.HistoryPageSize())
+	case "<PageDown>":
+		tree.Move(h.ui.HistoryPageSize())
+	case "<Right>":
+		tree.Expand(true)
+	case "<Left>":
+		tree.Expand(false)
+	case "<Enter>":
+		if path, ok := tree.Select(); ok {
+			h.insertMention(path)
+			tree.Blur()
+		}
+	case "<Escape>":
+		tree.Blur()
+	default:
+		return false
+	}
+	return true
+}
+
+// insertMention inserts the mention of a file of the workspace at the cursor
+func (h *InputHandler) insertMention(path string) {
+	mention := mentions.FormatPath(path) + " "
+	if h.cursorPos > 0 && h.currentInput[h.cursorPos-1] != ' ' && h.currentInput[h.cursorPos-1] != '\n' {
+		mention = " " + mention
+	}
+	h.currentInput = h.currentInput[:h.cursorPos] + mention + h.currentInput[h.cursorPos:]
+	h.cursorPos += len(mention)
+}
+
 // handleEnter handles the Enter key
 func (h *InputHandler) handleEnter() bool {
 	if h.currentInput == "" {
@@ -191,21 +249,53 @@ func (h *InputHandler) handleEnter() bool {
 		return true
 	}
 
-	// Process the command
-	h.processCommand(command)
+	// A line entered while the task waits for an answer answers its question
+	if !h.integration.AnswerQuestion(command) {
+		h.processCommand(command)
+	}
 
-	// Clear the input
-	h.currentInput = ""
-	h.cursorPos = 0
+	// Clear the input, or fill it with the text inserted by the command
+	h.currentInput, h.insertedInput = h.insertedInput, ""
+	h.cursorPos = len(h.currentInput)
 	h.ui.UpdateREPLInput(h.currentInput)
 
-	// Reset the prompt if it was changed
-	rootCmd := h.shell.RootCmd()
-	h.ui.UpdateREPLPrompt(rootCmd.Name + "> ")
+	// Reset the prompt if it was changed, unless the command collects multi-line input
+	if !h.commandActive {
+		rootCmd := h.shell.RootCmd()
+		h.ui.UpdateREPLPrompt(rootCmd.Name + "> ")
+	}
 
 	return false
 }
 
+// handlePaste inserts the text of the clipboard at the cursor. Text of several lines starts a
+// multi-line question, unless multi-line input is already being collected.
+func (h *InputHandler) handlePaste() {
+	text, err := h.processor.clipboard.Read(context.Background())
+	if err != nil {
+		h.integration.AddSystemMessage(fmt.Sprintf("Error: failed to paste the clipboard: %v", err))
+		return
+	}
+	if text == "" {
+		return
+	}
+	if strings.Contains(strings.TrimRight(text, "\n"), "\n") && !h.commandActive {
+		h.startMultiLineInput("ask")
+	} else if !h.commandActive {
+		// A single line is pasted in the line being typed
+		text = strings.TrimRight(text, "\n")
+	}
+	h.currentInput = h.currentInput[:h.cursorPos] + text + h.currentInput[h.cursorPos:]
+	h.cursorPos += len(text)
+}
+
+// insertInput puts text in the input of a multi-line question, for the user to edit it and
+// send it with Ctrl+D
+func (h *InputHandler) insertInput(text string) {
+	h.insertedInput = text
+	h.startMultiLineInput("ask")
+}
+
 // processCommand processes a command
 func (h *InputHandler) processCommand(command string) {
 	// Split the command into parts
@@ -214,106 +304,55 @@ func (h *InputHandler) processCommand(command string) {
 		return
 	}
 
-	// Get the command name
-	cmdName := parts[0]
-
-	// Process built-in commands
-	switch cmdName {
-	case "help":
-		h.integration.AddSystemMessage("Available commands:")
-		h.integration.AddSystemMessage("  help - Display help for REPL commands")
-		h.integration.AddSystemMessage("  exit - Exit the REPL")
-		h.integration.AddSystemMessage("  ask [question] - Ask the AI agent a question")
-		h.integration.AddSystemMessage("  apply - Apply the AI agent's suggestion")
-		h.integration.AddSystemMessage("  cancel - Cancel the AI agent's suggestion")
-		h.integration.AddSystemMessage("  checkpoint save - Save the current task state as a checkpoint")
-		h.integration.AddSystemMessage("  checkpoint restore [checkpointID] - Restore a previously saved checkpoint")
-		h.integration.AddSystemMessage("  diff [checkpointID] - Show the difference between the current state and a checkpoint")
-		h.integration.AddSystemMessage("  debug - Show debug information about the current input")
-	case "debug":
-		// Display debug information about the current input
-		h.integration.AddSystemMessage("Debug information:")
-		h.integration.AddSystemMessage(fmt.Sprintf("Input length: %d", len(h.currentInput)))
-		h.integration.AddSystemMessage(fmt.Sprintf("Cursor position: %d", h.cursorPos))
-
-		// Display the input with line numbers and cursor position
-		lines := strings.Split(h.currentInput, "\n")
-		for i, line := range lines {
-			h.integration.AddSystemMessage(fmt.Sprintf("Line %d (%d chars): %s", i+1, len(line), line))
-		}
+	// The debug command inspects the input buffer, which only exists in the TUI
+	if parts[0] == "debug" {
+		h.showDebugInfo()
+		return
+	}
 
-		// Find which line the cursor is on
-		pos := 0
-		cursorLine := 0
-		cursorCol := 0
-		for i, line := range lines {
-			lineLength := len(line)
-			if pos+lineLength >= h.cursorPos {
-				cursorLine = i
-				cursorCol = h.cursorPos - pos
-				break
-			}
-			pos += lineLength + 1 // +1 for the newline character
-		}
-		h.integration.AddSystemMessage(fmt.Sprintf("Cursor at line %d, column %d", cursorLine+1, cursorCol+1))
-
-		// Display the input as a hex dump for debugging
-		h.integration.AddSystemMessage("Input as hex:")
-		hexDump := ""
-		for i, c := range h.currentInput {
-			if i == h.cursorPos {
-				hexDump += "[CURSOR]"
-			}
-			hexDump += fmt.Sprintf("%02x ", c)
-		}
-		h.integration.AddSystemMessage(hexDump)
-	case "ask":
-		question := strings.TrimSpace(strings.TrimPrefix(command, "ask"))
-		if question == "" {
-			// Start multi-line input mode
-			h.startMultiLineInput("ask")
-			return
-		}
-		h.integration.AddSystemMessage("Sending question to AI agent...")
-		h.integration.AddSystemMessage("TODO: Implement ask logic")
-	case "apply":
-		h.integration.AddSystemMessage("Applying AI agent's suggestion...")
-		h.integration.AddSystemMessage("TODO: Implement apply logic")
-	case "cancel":
-		h.integration.AddSystemMessage("Cancelling AI agent's suggestion...")
-		h.integration.AddSystemMessage("TODO: Implement cancel logic")
-	case "checkpoint":
-		if len(parts) < 2 {
-			h.integration.AddSystemMessage("Error: checkpoint subcommand is required")
-			return
-		}
-		switch parts[1] {
-		case "save":
-			h.integration.AddSystemMessage("Saving checkpoint...")
-			h.integration.AddSystemMessage("TODO: Implement checkpoint save logic")
-			h.integration.AddSystemMessage("Checkpoint ID: checkpoint-123")
-		case "restore":
-			if len(parts) < 3 {
-				h.integration.AddSystemMessage("Error: checkpoint ID is required")
-				return
-			}
-			checkpointID := parts[2]
-			h.integration.AddSystemMessage(fmt.Sprintf("Restoring checkpoint %s...", checkpointID))
-			h.integration.AddSystemMessage("TODO: Implement checkpoint restore logic")
-		default:
-			h.integration.AddSystemMessage(fmt.Sprintf("Error: unknown checkpoint subcommand: %s", parts[1]))
+	if h.processor.Process(command) == CommandNeedsMultiLine {
+		// Start multi-line input mode
+		h.startMultiLineInput(parts[0])
+	}
+}
+
+// showDebugInfo displays debug information about the current input
+func (h *InputHandler) showDebugInfo() {
+	h.integration.AddSystemMessage("Debug information:")
+	h.integration.AddSystemMessage(fmt.Sprintf("Input length: %d", len(h.currentInput)))
+	h.integration.AddSystemMessage(fmt.Sprintf("Cursor position: %d", h.cursorPos))
+
+	// Display the input with line numbers and cursor position
+	lines := strings.Split(h.currentInput, "\n")
+	for i, line := range lines {
+		h.integration.AddSystemMessage(fmt.Sprintf("Line %d (%d chars): %s", i+1, len(line), line))
+	}
+
+	// Find which line the cursor is on
+	pos := 0
+	cursorLine := 0
+	cursorCol := 0
+	for i, line := range lines {
+		lineLength := len(line)
+		if pos+lineLength >= h.cursorPos {
+			cursorLine = i
+			cursorCol = h.cursorPos - pos
+			break
 		}
-	case "diff":
-		if len(parts) < 2 {
-			h.integration.AddSystemMessage("Error: checkpoint ID is required")
-			return
+		pos += lineLength + 1 // +1 for the newline character
+	}
+	h.integration.AddSystemMessage(fmt.Sprintf("Cursor at line %d, column %d", cursorLine+1, cursorCol+1))
+
+	// Display the input as a hex dump for debugging
+	h.integration.AddSystemMessage("Input as hex:")
+	hexDump := ""
+	for i, c := range h.currentInput {
+		if i == h.cursorPos {
+			hexDump += "[CURSOR]"
 		}
-		checkpointID := parts[1]
-		h.integration.AddSystemMessage(fmt.Sprintf("Showing diff for checkpoint %s...", checkpointID))
-		h.integration.AddSystemMessage("TODO: Implement diff logic")
-	default:
-		h.integration.AddSystemMessage(fmt.Sprintf("Error: unknown command: %s", cmdName))
+		hexDump += fmt.Sprintf("%02x ", c)
 	}
+	h.integration.AddSystemMessage(hexDump)
 }
 
 // handleBackspace handles the Backspace key
@@ -357,6 +396,15 @@ func (h *InputHandler) handleEnd() {
 
 // handleUp handles the Up arrow key
 func (h *InputHandler) handleUp() {
+	// While the task waits for an answer, Up selects the options of its question
+	if !h.commandActive {
+		if option, ok := h.integration.SelectQuestionOption(-1); ok {
+			h.currentInput = option
+			h.cursorPos = len(h.currentInput)
+			return
+		}
+	}
+
 	// In multi-line input mode, move cursor up one line
 	if h.commandActive && strings.Contains(h.currentInput, "\n") {
 		// Get all lines
@@ -429,6 +477,15 @@ func (h *InputHandler) handleUp() {
 
 // handleDown handles the Down arrow key
 func (h *InputHandler) handleDown() {
+	// While the task waits for an answer, Down selects the options of its question
+	if !h.commandActive {
+		if option, ok := h.integration.SelectQuestionOption(1); ok {
+			h.currentInput = option
+			h.cursorPos = len(h.currentInput)
+			return
+		}
+	}
+
 	// In multi-line input mode, move cursor down one line
 	if h.commandActive && strings.Contains(h.currentInput, "\n") {
 		// Get all lines
@@ -515,10 +572,17 @@ func (h *InputHandler) handleDeleteToBeginning() {
 	}
 }
 
-// handleTab handles the Tab key
+// handleTab completes the command or snippet name before the cursor
 func (h *InputHandler) handleTab() {
-	// TODO: Implement auto-completion
-	slog.Info("Tab pressed, auto-completion not implemented yet")
+	if h.commandActive {
+		return
+	}
+	completed, candidates := h.processor.Complete(h.currentInput[:h.cursorPos])
+	h.currentInput = completed + h.currentInput[h.cursorPos:]
+	h.cursorPos = len(completed)
+	if len(candidates) > 0 {
+		h.integration.AddSystemMessage(strings.Join(candidates, "  "))
+	}
 }
 
 // handleCharInput handles character input
@@ -530,6 +594,7 @@ func (h *InputHandler) handleCharInput(char string) {
 // startMultiLineInput starts multi-line input mode for a command
 func (h *InputHandler) startMultiLineInput(command string) {
 	h.commandActive = true
+	h.multiLineCommand = command
 
 	// Only show the instruction message for commands other than "ask"
 	if command != "ask" {
@@ -0,0 +1,33 @@
+package tui
+
+import (
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/tasklock"
+)
+
+// taskLock is the lock of the task the REPL was started on, checked before the commands write
+// to its checkpoints or undo its edits. The other tasks opened in the REPL are not locked.
+type taskLock struct {
+	taskID string
+	lock   *tasklock.Lock
+}
+
+// of returns the lock of a task, nil if it is not locked
+func (l taskLock) of(taskID string) *tasklock.Lock {
+	if taskID == "" || taskID != l.taskID {
+		return nil
+	}
+	return l.lock
+}
+
+// newCheckpointService creates a checkpoint service checking the lock of a task before writing
+func newCheckpointService(taskID string, lock *tasklock.Lock) *checkpoint.Service {
+	service := checkpoint.NewService()
+	service.SetLock(taskID, lock)
+	return service
+}
+
+// SetTaskLock sets the lock of a task, checked before the undo command writes to it
+func (p *CommandProcessor) SetTaskLock(taskID string, lock *tasklock.Lock) {
+	p.lock = taskLock{taskID: taskID, lock: lock}
+}
@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// ModelChoice is the provider and model a task generates its responses with
+type ModelChoice struct {
+	Provider string
+	Model    string
+	// ContextWindow is the number of tokens the model can process, zero if unknown
+	ContextWindow int
+	// Capabilities are the features of the model, shown when the task switches to it
+	Capabilities provider.Capabilities
+}
+
+// ModelResolver resolves the argument of the model command, a model of the provider of the
+// task or a model prefixed with its provider, e.g. anthropic/claude-3-5-haiku-20241022. It
+// fails for a provider that is not configured.
+type ModelResolver func(current ModelChoice, spec string) (ModelChoice, error)
+
+// ModelSwitcher is implemented by front ends whose tasks can switch to another model
+type ModelSwitcher interface {
+	// SwitchModel switches the shown task to a model for its next messages
+	SwitchModel(choice ModelChoice)
+	// Model returns the model of the shown task
+	Model() ModelChoice
+}
+
+// SetModelResolver sets the resolver of the model command, nil to take its argument as a
+// model of the provider of the task
+func (p *CommandProcessor) SetModelResolver(resolve ModelResolver) {
+	p.resolveModel = resolve
+}
+
+// processModel shows the model of the shown task, or switches it to the model of the argument
+func (p *CommandProcessor) processModel(spec string) {
+	switcher, ok := p.out.(ModelSwitcher)
+	if !ok {
+		p.out.AddSystemMessage("The model cannot be changed in this REPL")
+		return
+	}
+	current := switcher.Model()
+	if spec == "" {
+		p.out.AddSystemMessage(fmt.Sprintf("This task uses model %s of provider %s", describeModel(current.Model), current.Provider))
+		return
+	}
+
+	choice := ModelChoice{Provider: current.Provider, Model: spec}
+	if p.resolveModel != nil {
+		var err error
+		if choice, err = p.resolveModel(current, spec); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+	}
+	switcher.SwitchModel(choice)
+
+	message := fmt.Sprintf("Switched to model %s of provider %s for the next messages", describeModel(choice.Model), choice.Provider)
+	if choice.ContextWindow > 0 {
+		message += fmt.Sprintf(", with a context window of %d tokens", choice.ContextWindow)
+	}
+	if features := describeCapabilities(choice.Capabilities); features != "" {
+		message += ", supporting " + features
+	}
+	p.out.AddSystemMessage(message)
+}
+
+// describeCapabilities lists the features of a model, e.g. "tools, images and up to 8192
+// output tokens", empty if none is known
+func describeCapabilities(c provider.Capabilities) string {
+	var features []string
+	for _, feature := range []struct {
+		name      string
+		supported bool
+	}{{"tools", c.Tools}, {"images", c.Vision}, {"reasoning", c.Reasoning}, {"prompt caching", c.Caching}} {
+		if feature.supported {
+			features = append(features, feature.name)
+		}
+	}
+	if c.MaxOutputTokens > 0 {
+		features = append(features, fmt.Sprintf("up to %d output tokens", c.MaxOutputTokens))
+	}
+	if len(features) < 2 {
+		return strings.Join(features, "")
+	}
+	return strings.Join(features[:len(features)-1], ", ") + " and " + features[len(features)-1]
+}
+
+// describeModel names a model, the default one of its provider if empty
+func describeModel(model string) string {
+	if model == "" {
+		return "(default)"
+	}
+	return model
+}
@@ -0,0 +1,399 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kazz187/goline/internal/core/images"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// ErrNoTerminal is returned when the TUI cannot be drawn, e.g. when stdout is not a terminal
+var ErrNoTerminal = errors.New("the TUI cannot be drawn on this terminal")
+
+// CanDrawTUI reports whether the TUI can be drawn on f: it must be a terminal, and not a dumb one
+func CanDrawTUI(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// PlainREPL is a line-based REPL for the terminals the TUI cannot be drawn on, such as pipes,
+// dumb terminals and CI logs. It runs the tasks with the same agent loops and commands as the
+// TUI, and prints the entries of the history of the shown task once they are complete.
+type PlainREPL struct {
+	in        io.Reader
+	out       io.Writer
+	mu        sync.Mutex
+	opts      REPLOptions
+	tasks     *taskManager
+	processor *CommandProcessor
+	// printed are the contents of the entries of the history of each task printed so far
+	printed map[*taskSession][]string
+	// updated is signaled each time a task changes, to wait for the agent loops at the end of input
+	updated chan struct{}
+	// prefill is the text the multi-line input of the command being processed starts with, and
+	// insertCommand the command collecting the text inserted by the command, if any
+	prefill       string
+	insertCommand string
+}
+
+// NewPlainREPL creates a plain REPL reading commands from in and writing to out
+func NewPlainREPL(in io.Reader, out io.Writer, opts REPLOptions) *PlainREPL {
+	r := &PlainREPL{
+		in:      in,
+		out:     out,
+		opts:    opts,
+		printed: make(map[*taskSession][]string),
+		updated: make(chan struct{}, 1),
+	}
+	r.tasks = newTaskManager(opts.Runner, r.taskUpdated)
+	r.tasks.retrier = opts.Retrier
+	r.tasks.notifier = opts.Notifier
+	r.processor = NewCommandProcessor(r)
+	r.processor.SetCommitter(opts.Committer)
+	r.processor.SetReviewer(opts.Reviewer)
+	r.processor.SetSlashCommands(opts.SlashCommands)
+	r.processor.SetModelResolver(opts.ResolveModel)
+	r.processor.SetTaskLock(opts.TaskID, opts.Lock)
+	return r
+}
+
+// taskInfo returns the information of a new task
+func (r *PlainREPL) taskInfo(id string) TaskInfo {
+	return TaskInfo{
+		ID:        id,
+		StartTime: time.Now(),
+		Provider:  r.opts.Provider,
+		Engine:    r.opts.Model,
+		Language:  r.opts.ResponseLanguage,
+		ReadOnly:  r.opts.ReadOnly,
+	}
+}
+
+// taskUpdated prints the entries of the shown task completed since the last update
+func (r *PlainREPL) taskUpdated(s *taskSession) {
+	if r.tasks.isShown(s) {
+		r.print(s)
+	}
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+}
+
+// print prints the entries of the history of a session not printed yet. The last entry is
+// only printed once the agent loop is done with it, as it may still be streamed. Text stitched
+// to an entry already printed, e.g. a continued response, is printed on its own.
+func (r *PlainREPL) print(s *taskSession) {
+	entries := s.history.Entries()
+	complete := len(entries)
+	if r.tasks.info(s).Status == taskStatusRunning {
+		complete--
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	printed := r.printed[s]
+	for i, content := range printed {
+		if i >= len(entries) || entries[i].Content == content {
+			continue
+		}
+		entry := entries[i]
+		if rest, ok := strings.CutPrefix(entry.Content, content); ok {
+			entry.Content = rest
+		}
+		r.printEntry(entry)
+		printed[i] = entries[i].Content
+	}
+	for i := len(printed); i < complete; i++ {
+		// The user typed their input, it is not echoed
+		if entries[i].Type != "user" {
+			r.printEntry(entries[i])
+		}
+		printed = append(printed, entries[i].Content)
+	}
+	r.printed[s] = printed
+}
+
+// printEntry writes an entry as the history pane of the TUI shows it, without colors
+func (r *PlainREPL) printEntry(entry HistoryEntry) {
+	content := strings.TrimRight(entry.Content, "\n")
+	fmt.Fprintf(r.out, "[%s] %s %s\n", entry.Timestamp.Format("15:04:05"), historyPrefix(entry.Type), content)
+}
+
+// prompt writes the input prompt
+func (r *PlainREPL) prompt(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprint(r.out, text)
+}
+
+// shownWriter returns the writer of the history of the shown task
+func (r *PlainREPL) shownWriter() HistoryWriter {
+	return &sessionWriter{manager: r.tasks, session: r.tasks.shown()}
+}
+
+// Run runs the REPL until the user exits or the input is closed. At the end of input, it
+// waits for the agent loops to run the messages sent to them, so piped commands get answered.
+func (r *PlainREPL) Run() error {
+	defer r.tasks.close()
+	scanner := bufio.NewScanner(r.in)
+
+	r.tasks.open(r.taskInfo(r.opts.TaskID))
+	r.AddSystemMessage("The TUI is off, the history is printed line by line. Type 'help' to see available commands")
+	if r.opts.InitialMessage != "" {
+		r.processor.SubmitMultiLine("ask", r.opts.InitialMessage)
+	}
+
+	for {
+		r.prompt("goline> ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			r.wait()
+			r.AddSystemMessage("EOF received, exiting...")
+			return nil
+		}
+
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+		r.AddUserInput(command)
+		if command == "exit" {
+			r.AddSystemMessage("Exiting Goline...")
+			return nil
+		}
+		// A line entered while the task waits for an answer answers its question
+		if r.AnswerQuestion(command) {
+			continue
+		}
+
+		cmdName := ""
+		if r.processor.Process(command) == CommandNeedsMultiLine {
+			cmdName = strings.Fields(command)[0]
+		}
+		if r.insertCommand != "" {
+			cmdName = r.insertCommand
+		}
+		if cmdName == "" {
+			continue
+		}
+		input, err := r.readMultiLine(scanner, cmdName)
+		if err != nil {
+			return err
+		}
+		r.processor.SubmitMultiLine(cmdName, input)
+	}
+}
+
+// wait waits until the agent loops have run the messages sent to them, but for those waiting
+// for the user to answer a question
+func (r *PlainREPL) wait() {
+	for r.tasks.busy() {
+		<-r.updated
+	}
+}
+
+// readMultiLine reads lines until a line containing only the terminator or the end of input.
+// Text prefilled by the command is kept when no line is entered.
+func (r *PlainREPL) readMultiLine(scanner *bufio.Scanner, cmdName string) (string, error) {
+	prefill := r.prefill
+	r.prefill, r.insertCommand = "", ""
+	if prefill != "" {
+		r.AddSystemMessage(fmt.Sprintf("Enter multi-line input for '%s' to replace the following text, or only a period to keep it:\n%s", cmdName, prefill))
+	} else {
+		r.AddSystemMessage(fmt.Sprintf("Enter multi-line input for '%s'. Finish with a line containing only a period.", cmdName))
+	}
+
+	var lines []string
+	for {
+		r.prompt(fmt.Sprintf("%s> ", cmdName))
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.TrimSpace(line) == multiLineTerminator {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	input := strings.TrimSpace(strings.Join(lines, "\n"))
+	if input == "" {
+		input = prefill
+	}
+	return input, scanner.Err()
+}
+
+// AddUserInput adds user input to the history of the shown task
+func (r *PlainREPL) AddUserInput(input string) {
+	r.shownWriter().AddUserInput(input)
+}
+
+// AddAgentOutput adds agent output to the history of the shown task
+func (r *PlainREPL) AddAgentOutput(output string) {
+	r.shownWriter().AddAgentOutput(output)
+}
+
+// AddSystemMessage adds a system message to the history of the shown task
+func (r *PlainREPL) AddSystemMessage(message string) {
+	r.shownWriter().AddSystemMessage(message)
+}
+
+// AttachImage attaches an image to the next message of the shown task
+func (r *PlainREPL) AttachImage(attachment images.Attachment) error {
+	return r.tasks.attach(attachment)
+}
+
+// DetachImages drops the images attached to the next message of the shown task
+func (r *PlainREPL) DetachImages() []images.Attachment {
+	return r.tasks.detach()
+}
+
+// LastAgentOutput returns the last output of the agent of the shown task
+func (r *PlainREPL) LastAgentOutput() string {
+	return lastAgentOutput(r.tasks.shown())
+}
+
+// CurrentTaskID returns the ID of the shown task
+func (r *PlainREPL) CurrentTaskID() string {
+	s := r.tasks.shown()
+	if s == nil {
+		return ""
+	}
+	return r.tasks.info(s).ID
+}
+
+// NewTask opens a new task and shows it
+func (r *PlainREPL) NewTask() (string, error) {
+	id, err := taskstore.NewTaskID()
+	if err != nil {
+		return "", err
+	}
+	r.tasks.open(r.taskInfo(id))
+	return id, r.SwitchTask(id)
+}
+
+// SwitchTask shows the task with the ID, or the only task whose ID starts with it, and prints
+// the entries of its history not printed yet
+func (r *PlainREPL) SwitchTask(id string) error {
+	s, err := r.tasks.switchTo(id)
+	if err != nil {
+		return err
+	}
+	r.print(s)
+	return nil
+}
+
+// NextTask shows the task opened after the shown one
+func (r *PlainREPL) NextTask() {
+	if s := r.tasks.next(); s != nil {
+		r.print(s)
+	}
+}
+
+// SwitchModel switches the shown task to a model for its next messages
+func (r *PlainREPL) SwitchModel(choice ModelChoice) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setModel(s, choice)
+	}
+}
+
+// Model returns the model of the shown task
+func (r *PlainREPL) Model() ModelChoice {
+	s := r.tasks.shown()
+	if s == nil {
+		return ModelChoice{Provider: r.opts.Provider, Model: r.opts.Model}
+	}
+	info := r.tasks.info(s)
+	return ModelChoice{Provider: info.Provider, Model: info.Engine}
+}
+
+// SetGeneration sets the sampling settings of the shown task for its next messages
+func (r *PlainREPL) SetGeneration(opts provider.GenerationOptions) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setGeneration(s, opts)
+	}
+}
+
+// Generation returns the sampling settings of the shown task
+func (r *PlainREPL) Generation() provider.GenerationOptions {
+	s := r.tasks.shown()
+	if s == nil {
+		return provider.GenerationOptions{}
+	}
+	return r.tasks.info(s).Generation
+}
+
+// SetResponseLanguage sets the response language of the shown task
+func (r *PlainREPL) SetResponseLanguage(language string) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setLanguage(s, language)
+	}
+}
+
+// ResponseLanguage returns the response language of the shown task
+func (r *PlainREPL) ResponseLanguage() string {
+	s := r.tasks.shown()
+	if s == nil {
+		return ""
+	}
+	return r.tasks.info(s).Language
+}
+
+// Tasks describes the open tasks
+func (r *PlainREPL) Tasks() []TaskSummary {
+	return r.tasks.summaries()
+}
+
+// Submit sends a message to the agent loop of the shown task
+func (r *PlainREPL) Submit(message string) error {
+	return r.tasks.submit(message)
+}
+
+// ContinueResponse asks the agent of the shown task to continue its truncated response
+func (r *PlainREPL) ContinueResponse() error {
+	return r.tasks.continueResponse()
+}
+
+// RetryResponse asks the agent of the shown task to regenerate its last answer
+func (r *PlainREPL) RetryResponse(model ModelChoice) error {
+	return r.tasks.retryResponse(model)
+}
+
+// AnswerQuestion answers the question the shown task waits for, if any, and reports whether there was one
+func (r *PlainREPL) AnswerQuestion(input string) bool {
+	return r.tasks.answerQuestion(input)
+}
+
+// InsertInput starts a multi-line question with text, for the user to send it or replace it
+func (r *PlainREPL) InsertInput(text string) {
+	r.prefill, r.insertCommand = text, "ask"
+}
+
+// PrefillInput sets the text the multi-line input of the command being processed starts with
+func (r *PlainREPL) PrefillInput(text string) {
+	r.prefill = text
+}
+
+// StartPlainREPL starts the plain REPL reading commands from in and writing to the standard output
+func StartPlainREPL(in io.Reader, opts REPLOptions) error {
+	return NewPlainREPL(in, os.Stdout, opts).Run()
+}
@@ -0,0 +1,214 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// lockedBuffer is a buffer written by the agent loops and read by the test
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// echoRunner answers each message with its text, and asks which color to use when the message
+// is "color"
+func echoRunner(ctx context.Context, taskID, message string, out HistoryWriter) error {
+	if message == "color" {
+		answer, err := out.(QuestionAsker).AskQuestion(ctx, "Which color?", []string{"red", "blue"})
+		if err != nil {
+			return err
+		}
+		out.AddAgentOutput("You chose " + answer)
+		return nil
+	}
+	out.AddAgentOutput(message)
+	return nil
+}
+
+func TestPlainREPL(t *testing.T) {
+	var out lockedBuffer
+	in := strings.NewReader("ask hello\nask\nfirst line\nsecond line\n.\nunknown\n")
+	r := NewPlainREPL(in, &out, REPLOptions{TaskID: "task-1", Runner: echoRunner, InitialMessage: "start"})
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(sessionTimeout):
+		t.Fatalf("Run() did not return, output:\n%s", out.String())
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"[System] The TUI is off",
+		"[Agent] start",
+		"[Agent] hello",
+		"[Agent] first line\nsecond line",
+		"Enter multi-line input for 'ask'",
+		"ask> ",
+		"[System] EOF received, exiting...",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "[User]") {
+		t.Errorf("output echoes the user input:\n%s", got)
+	}
+	if strings.Index(got, "[Agent] hello") > strings.Index(got, "[Agent] first line") {
+		t.Errorf("answers are printed out of order:\n%s", got)
+	}
+}
+
+func TestPlainREPLAnswersQuestions(t *testing.T) {
+	var out lockedBuffer
+	in, w := io.Pipe()
+	r := NewPlainREPL(in, &out, REPLOptions{TaskID: "task-1", Runner: echoRunner})
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run() }()
+	fmt.Fprintln(w, "ask color")
+
+	deadline := time.Now().Add(sessionTimeout)
+	for !strings.Contains(out.String(), "[Question] Which color?") {
+		if time.Now().After(deadline) {
+			t.Fatalf("the question was not printed:\n%s", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Fprintln(w, "blue")
+	w.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(sessionTimeout):
+		t.Fatalf("Run() did not return, output:\n%s", out.String())
+	}
+	if got := out.String(); !strings.Contains(got, "[Agent] You chose blue") {
+		t.Errorf("output does not contain the answer:\n%s", got)
+	}
+}
+
+func TestPlainREPLSwitchesModel(t *testing.T) {
+	var out lockedBuffer
+	in := strings.NewReader("model\nmodel anthropic/claude-3-5-haiku\nmodel unknown/model\nask hello\n")
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		model := out.(TaskSettings).Model()
+		out.AddAgentOutput(fmt.Sprintf("%s answered by %s/%s", message, model.Provider, model.Model))
+		return nil
+	}
+	resolve := func(current ModelChoice, spec string) (ModelChoice, error) {
+		providerName, modelName, _ := strings.Cut(spec, "/")
+		if providerName != "anthropic" {
+			return ModelChoice{}, fmt.Errorf("provider %s not found", providerName)
+		}
+		return ModelChoice{Provider: providerName, Model: modelName, ContextWindow: 200000, Capabilities: provider.Capabilities{Tools: true, Caching: true, MaxOutputTokens: 8192}}, nil
+	}
+	r := NewPlainREPL(in, &out, REPLOptions{TaskID: "task-1", Provider: "deepseek", Model: "deepseek-chat", Runner: runner, ResolveModel: resolve})
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"[System] This task uses model deepseek-chat of provider deepseek",
+		"[System] Switched to model claude-3-5-haiku of provider anthropic for the next messages, with a context window of 200000 tokens, supporting tools, prompt caching and up to 8192 output tokens",
+		"[System] Error: provider unknown not found",
+		"[Agent] hello answered by anthropic/claude-3-5-haiku",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPlainREPLSetsGeneration(t *testing.T) {
+	var out lockedBuffer
+	in := strings.NewReader("set temperature 0.7\nset max_output_tokens 2048\nset top_p 3\nset seed 1\nset max_output_tokens default\nset\nask hello\n")
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		generation := out.(TaskSettings).Generation()
+		out.AddAgentOutput(fmt.Sprintf("%s at temperature %g, up to %d tokens", message, *generation.Temperature, generation.MaxOutputTokens))
+		return nil
+	}
+	r := NewPlainREPL(in, &out, REPLOptions{TaskID: "task-1", Runner: runner})
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"[System] Generation parameters of this task: temperature 0.7, top_p (provider default), max_output_tokens (model limit)",
+		"[System] Error: top_p must be a number between 0 and 1",
+		"[System] Error: unknown parameter: seed",
+		"[System] Generation parameters of this task: temperature 0.7, top_p (provider default), max_output_tokens 2048",
+		"[Agent] hello at temperature 0.7, up to 0 tokens",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPlainREPLRetries(t *testing.T) {
+	var out lockedBuffer
+	in := strings.NewReader("retry --model\nask hello\nretry\nretry --model claude-3-5-haiku\n")
+	retrier := func(ctx context.Context, taskID string, model ModelChoice, out HistoryWriter) error {
+		out.AddAgentOutput(fmt.Sprintf("regenerated by %s/%s", model.Provider, model.Model))
+		return nil
+	}
+	r := NewPlainREPL(in, &out, REPLOptions{TaskID: "task-1", Provider: "anthropic", Model: "claude-3-5-sonnet", Runner: echoRunner, Retrier: retrier})
+
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"[System] Error: --model requires a value",
+		"[Agent] hello",
+		"[System] Regenerating the last answer...",
+		"[Agent] regenerated by /",
+		"[System] Regenerating the last answer with model claude-3-5-haiku...",
+		"[Agent] regenerated by anthropic/claude-3-5-haiku",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	// Without a retrier, the answers cannot be regenerated
+	out = lockedBuffer{}
+	r = NewPlainREPL(strings.NewReader("retry\n"), &out, REPLOptions{TaskID: "task-1", Runner: echoRunner})
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "[System] Error: "+ErrNoAgent.Error()) {
+		t.Errorf("output does not contain the error:\n%s", got)
+	}
+}
@@ -2,15 +2,19 @@ package tui
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/abiosoft/ishell/v2"
 	"github.com/abiosoft/readline"
-	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/apply"
+	"github.com/kazz187/goline/internal/core/regions"
 )
 
 // REPLCommands defines the available commands in the REPL
@@ -34,6 +38,16 @@ var REPLCommands = []struct {
 		Description: "Ask the AI agent a question",
 		Usage:       "ask [question]",
 	},
+	{
+		Name:        "attach",
+		Description: "Attach images to the next message for models that read images, or drop them",
+		Usage:       "attach <path>...|clear",
+	},
+	{
+		Name:        "retry",
+		Description: "Discard the AI agent's last answer and regenerate it, keeping the discarded answer as an alternative",
+		Usage:       "retry [--provider name] [--model name]",
+	},
 	{
 		Name:        "apply",
 		Description: "Apply the AI agent's suggestion",
@@ -52,17 +66,74 @@ var REPLCommands = []struct {
 	{
 		Name:        "checkpoint restore",
 		Description: "Restore a previously saved checkpoint",
-		Usage:       "checkpoint restore [checkpointID]",
+		Usage:       "checkpoint restore [checkpointID] [--path file]...",
+	},
+	{
+		Name:        "undo",
+		Description: "Revert the last edits of the AI agent to the checkpoint saved before them, --yes also reverts the other files changed since",
+		Usage:       "undo [--yes]",
 	},
 	{
 		Name:        "diff",
-		Description: "Show the difference between the current state and a checkpoint",
-		Usage:       "diff [checkpointID]",
+		Description: "Show the difference between two checkpoints, or a checkpoint and the current state",
+		Usage:       "diff [fromID] [toID] [--export file.patch]",
+	},
+	{
+		Name:        "review",
+		Description: "Ask the AI agent to review the working tree, the staged changes, or a ref without editing files",
+		Usage:       "review [--staged] [--ref ref] [instructions]",
+	},
+	{
+		Name:        "changes",
+		Description: "List the regions edited by the AI agent in this task, open one in the editor, or write them to a review sidecar file",
+		Usage:       "changes [open n] [--sidecar]",
+	},
+	{
+		Name:        "expand",
+		Description: "Show the next page, or all pages, of a long history entry",
+		Usage:       "expand [n] [all]",
+	},
+	{
+		Name:        "collapse",
+		Description: "Show only the first page of a long history entry",
+		Usage:       "collapse [n]",
+	},
+	{
+		Name:        "task",
+		Description: "Open a new task, show another task, or list the open tasks",
+		Usage:       "task new|switch <id>|list",
+	},
+	{
+		Name:        "continue",
+		Description: "Ask the AI agent for the rest of a truncated response (Ctrl+O)",
+		Usage:       "continue",
+	},
+	{
+		Name:        "language",
+		Description: "Show or set the language the AI agent answers in for this task",
+		Usage:       "language [code|default]",
+	},
+	{
+		Name:        "snippet",
+		Description: "List, show, save, insert or delete the reusable prompt snippets, saved globally or with --repo for the repository",
+		Usage:       "snippet list|show <name>|save <name> [--repo] [text]|insert <name> [var=value]...|delete <name> [--repo]",
+	},
+	{
+		Name:        "commit",
+		Description: "Stage the files edited by the AI agent in this task, or all the changes, and commit them with a generated conventional commit message you can edit",
+		Usage:       "commit [--all] [--yes]",
+	},
+	{
+		Name:        "copy",
+		Description: "Copy the last message of the AI agent, or one of its code blocks, to the clipboard",
+		Usage:       "copy [code [n]]",
 	},
 }
 
-// initREPL initializes the REPL shell
-func initREPL(stdin, stdout, stderr *bytes.Buffer) *ishell.Shell {
+// initREPL initializes the REPL shell.
+// currentTaskID returns the ID of the task the commands apply to.
+// lock is checked before the commands write to the task it locks.
+func initREPL(stdin, stdout, stderr *bytes.Buffer, currentTaskID func() string, lock taskLock) *ishell.Shell {
 	shell := ishell.NewWithConfig(&readline.Config{
 		Prompt:      "goline> ",
 		Stdin:       io.NopCloser(stdin),
@@ -77,8 +148,10 @@ func initREPL(stdin, stdout, stderr *bytes.Buffer) *ishell.Shell {
 	registerAskCommand(shell)
 	registerApplyCommand(shell)
 	registerCancelCommand(shell)
-	registerCheckpointCommands(shell)
-	registerDiffCommand(shell)
+	registerCheckpointCommands(shell, currentTaskID, lock)
+	registerUndoCommand(shell, currentTaskID, lock)
+	registerDiffCommand(shell, currentTaskID, lock)
+	registerChangesCommand(shell, currentTaskID)
 
 	return shell
 }
@@ -172,7 +245,7 @@ func registerCancelCommand(shell *ishell.Shell) {
 }
 
 // registerCheckpointCommands registers the checkpoint commands
-func registerCheckpointCommands(shell *ishell.Shell) {
+func registerCheckpointCommands(shell *ishell.Shell, currentTaskID func() string, lock taskLock) {
 	checkpointCmd := &ishell.Cmd{
 		Name: "checkpoint",
 		Help: "Manage task checkpoints",
@@ -183,11 +256,19 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 		Help: "Save the current task state as a checkpoint",
 		Func: func(c *ishell.Context) {
 			// Get task context
-			taskID := getCurrentTaskID()
+			taskID := currentTaskID()
 			if taskID == "" {
 				c.Println("Error: No active task")
 				return
 			}
+			if err := lock.of(taskID).Validate(); err != nil {
+				c.Printf("Error: %v\n", err)
+				return
+			}
+			if err := lock.of(taskID).Validate(); err != nil {
+				c.Printf("Error: %v\n", err)
+				return
+			}
 			workingDir, err := os.Getwd()
 			if err != nil {
 				c.Printf("Error: Failed to get working directory: %v\n", err)
@@ -207,7 +288,7 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 			}
 
 			// Create checkpoint service
-			service := checkpoint.NewService()
+			service := newCheckpointService(taskID, lock.of(taskID))
 
 			// Save checkpoint
 			c.Println("Saving checkpoint...")
@@ -229,7 +310,7 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 		Help: "Restore a previously saved checkpoint",
 		Func: func(c *ishell.Context) {
 			// Get task context
-			taskID := getCurrentTaskID()
+			taskID := currentTaskID()
 			if taskID == "" {
 				c.Println("Error: No active task")
 				return
@@ -241,7 +322,7 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 			}
 
 			// Create checkpoint service
-			service := checkpoint.NewService()
+			service := newCheckpointService(taskID, lock.of(taskID))
 
 			// Get checkpoints
 			checkpoints, err := service.GetCheckpoints(taskID, workingDir)
@@ -254,10 +335,25 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 				return
 			}
 
+			// Parse arguments
+			var args, paths []string
+			for i := 0; i < len(c.Args); i++ {
+				if c.Args[i] == "--path" {
+					if i+1 >= len(c.Args) {
+						c.Println("Error: --path requires a file path")
+						return
+					}
+					paths = append(paths, c.Args[i+1])
+					i++
+					continue
+				}
+				args = append(args, c.Args[i])
+			}
+
 			// Get checkpoint ID
 			var checkpointID string
-			if len(c.Args) > 0 {
-				checkpointID = c.Args[0]
+			if len(args) > 0 {
+				checkpointID = args[0]
 			} else {
 				// Display checkpoints
 				c.Println(service.FormatCheckpointList(checkpoints))
@@ -272,7 +368,11 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 			}
 
 			// Confirm restore
-			c.Printf("Are you sure you want to restore checkpoint %s? This will overwrite your current workspace. (y/n): ", checkpointID)
+			if len(paths) > 0 {
+				c.Printf("Are you sure you want to restore %s from checkpoint %s? Other files are left untouched. (y/n): ", strings.Join(paths, ", "), checkpointID)
+			} else {
+				c.Printf("Are you sure you want to restore checkpoint %s? This will overwrite your current workspace. (y/n): ", checkpointID)
+			}
 			confirm := c.ReadLine()
 			if !strings.EqualFold(confirm, "y") && !strings.EqualFold(confirm, "yes") {
 				c.Println("Restore cancelled")
@@ -280,8 +380,13 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 			}
 
 			// Restore checkpoint
-			c.Printf("Restoring checkpoint %s...\n", checkpointID)
-			_, err = service.RestoreCheckpoint(taskID, workingDir, checkpointID)
+			if len(paths) > 0 {
+				c.Printf("Restoring %s from checkpoint %s...\n", strings.Join(paths, ", "), checkpointID)
+				_, err = service.RestoreFiles(taskID, workingDir, checkpointID, paths)
+			} else {
+				c.Printf("Restoring checkpoint %s...\n", checkpointID)
+				_, err = service.RestoreCheckpoint(taskID, workingDir, checkpointID)
+			}
 			if err != nil {
 				c.Printf("Error: Failed to restore checkpoint: %v\n", err)
 				return
@@ -298,7 +403,7 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 		Help: "List all checkpoints for the current task",
 		Func: func(c *ishell.Context) {
 			// Get task context
-			taskID := getCurrentTaskID()
+			taskID := currentTaskID()
 			if taskID == "" {
 				c.Println("Error: No active task")
 				return
@@ -310,7 +415,7 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 			}
 
 			// Create checkpoint service
-			service := checkpoint.NewService()
+			service := newCheckpointService(taskID, lock.of(taskID))
 
 			// Get checkpoints
 			checkpoints, err := service.GetCheckpoints(taskID, workingDir)
@@ -327,14 +432,70 @@ func registerCheckpointCommands(shell *ishell.Shell) {
 	shell.AddCmd(checkpointCmd)
 }
 
+// registerUndoCommand registers the undo command
+func registerUndoCommand(shell *ishell.Shell, currentTaskID func() string, lock taskLock) {
+	shell.AddCmd(&ishell.Cmd{
+		Name: "undo",
+		Help: "Revert the last edits of the AI agent to the checkpoint saved before them",
+		Func: func(c *ishell.Context) {
+			// Get task context
+			taskID := currentTaskID()
+			if taskID == "" {
+				c.Println("Error: No active task")
+				return
+			}
+
+			force := len(c.Args) > 0 && c.Args[0] == "--yes"
+			lines, err := undo(taskID, lock.of(taskID), force)
+			var others *apply.OtherChangesError
+			if errors.As(err, &others) {
+				c.Printf("%s. Undo anyway? (y/n): ", otherChangesMessage(others))
+				confirm := c.ReadLine()
+				if !strings.EqualFold(confirm, "y") && !strings.EqualFold(confirm, "yes") {
+					c.Println("Undo cancelled")
+					return
+				}
+				lines, err = undo(taskID, lock.of(taskID), true)
+			}
+			if err != nil {
+				c.Printf("Error: %v\n", err)
+				return
+			}
+			for _, line := range lines {
+				c.Println(line)
+			}
+		},
+	})
+}
+
 // registerDiffCommand registers the diff command
-func registerDiffCommand(shell *ishell.Shell) {
+func registerDiffCommand(shell *ishell.Shell, currentTaskID func() string, lock taskLock) {
 	shell.AddCmd(&ishell.Cmd{
 		Name: "diff",
-		Help: "Show the difference between the current state and a checkpoint",
+		Help: "Show the difference between two checkpoints, or a checkpoint and the current state",
 		Func: func(c *ishell.Context) {
+			// Parse arguments
+			var ids []string
+			var exportPath string
+			for i := 0; i < len(c.Args); i++ {
+				if c.Args[i] == "--export" {
+					if i+1 >= len(c.Args) {
+						c.Println("Error: --export requires a file path")
+						return
+					}
+					exportPath = c.Args[i+1]
+					i++
+					continue
+				}
+				ids = append(ids, c.Args[i])
+			}
+			if len(ids) > 2 {
+				c.Println("Error: at most two checkpoint IDs can be compared")
+				return
+			}
+
 			// Get task context
-			taskID := getCurrentTaskID()
+			taskID := currentTaskID()
 			if taskID == "" {
 				c.Println("Error: No active task")
 				return
@@ -346,7 +507,7 @@ func registerDiffCommand(shell *ishell.Shell) {
 			}
 
 			// Create checkpoint service
-			service := checkpoint.NewService()
+			service := newCheckpointService(taskID, lock.of(taskID))
 
 			// Get checkpoints
 			checkpoints, err := service.GetCheckpoints(taskID, workingDir)
@@ -359,10 +520,13 @@ func registerDiffCommand(shell *ishell.Shell) {
 				return
 			}
 
-			// Get checkpoint ID
-			var fromCheckpointID string
-			if len(c.Args) > 0 {
-				fromCheckpointID = c.Args[0]
+			// Get checkpoint IDs, an empty toCheckpointID compares to the working directory
+			var fromCheckpointID, toCheckpointID string
+			if len(ids) > 0 {
+				fromCheckpointID = ids[0]
+				if len(ids) > 1 {
+					toCheckpointID = ids[1]
+				}
 			} else {
 				// Display checkpoints
 				c.Println(service.FormatCheckpointList(checkpoints))
@@ -377,22 +541,123 @@ func registerDiffCommand(shell *ishell.Shell) {
 			}
 
 			// Get diff
-			c.Printf("Showing diff for checkpoint %s...\n", fromCheckpointID)
-			diffs, err := service.GetDiff(taskID, workingDir, fromCheckpointID, "")
+			if toCheckpointID == "" {
+				c.Printf("Showing diff for checkpoint %s...\n", fromCheckpointID)
+			} else {
+				c.Printf("Showing diff from checkpoint %s to %s...\n", fromCheckpointID, toCheckpointID)
+			}
+			diffs, err := service.GetDiff(taskID, workingDir, fromCheckpointID, toCheckpointID)
 			if err != nil {
 				c.Printf("Error: Failed to get diff: %v\n", err)
 				return
 			}
 
+			// Export diff
+			if exportPath != "" {
+				if err := service.ExportPatch(diffs, exportPath); err != nil {
+					c.Printf("Error: %v\n", err)
+					return
+				}
+				c.Printf("Patch written to %s (apply it with `git apply %s`)\n", exportPath, exportPath)
+				return
+			}
+
 			// Display diff
-			c.Println(service.FormatDiff(diffs))
+			patch, err := service.FormatUnifiedDiff(diffs)
+			if err != nil {
+				c.Printf("Error: Failed to format diff: %v\n", err)
+				return
+			}
+			c.Println(patch)
 		},
 	})
 }
 
-// getCurrentTaskID returns the ID of the current task
-// TODO: Implement this function to get the actual task ID
-func getCurrentTaskID() string {
-	// For now, return a dummy task ID
-	return "task-123"
+// registerChangesCommand registers the changes command
+func registerChangesCommand(shell *ishell.Shell, currentTaskID func() string) {
+	shell.AddCmd(&ishell.Cmd{
+		Name: "changes",
+		Help: "List the regions edited by the AI agent in this task",
+		Func: func(c *ishell.Context) {
+			// Get task context
+			taskID := currentTaskID()
+			if taskID == "" {
+				c.Println("Error: No active task")
+				return
+			}
+			workingDir, err := os.Getwd()
+			if err != nil {
+				c.Printf("Error: Failed to get working directory: %v\n", err)
+				return
+			}
+
+			// Load edited regions
+			tracker, err := regions.NewTracker(taskID)
+			if err != nil {
+				c.Printf("Error: Failed to load edited regions: %v\n", err)
+				return
+			}
+			edited := tracker.Regions()
+			if len(edited) == 0 {
+				c.Println("No regions edited by the AI agent in this task")
+				return
+			}
+
+			switch {
+			case len(c.Args) > 0 && c.Args[0] == "open":
+				// Open a region in the editor
+				region, err := selectRegion(edited, c.Args[1:])
+				if err != nil {
+					c.Printf("Error: %v\n", err)
+					return
+				}
+				cmd := regions.EditorCommand(filepath.Join(workingDir, region.Path), region.StartLine)
+				cmd.Stdin = os.Stdin
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				if err := cmd.Run(); err != nil {
+					c.Printf("Error: Failed to open editor: %v\n", err)
+				}
+			case len(c.Args) > 0 && c.Args[0] == "--sidecar":
+				// Write the review sidecar file
+				path, err := regions.WriteSidecar(workingDir, taskID, edited)
+				if err != nil {
+					c.Printf("Error: %v\n", err)
+					return
+				}
+				c.Printf("Wrote %d annotation(s) to %s\n", len(edited), path)
+			default:
+				// List regions
+				for _, line := range formatRegions(edited) {
+					c.Println(line)
+				}
+				c.Println("Use `changes open <n>` to open a region in your editor")
+			}
+		},
+	})
+}
+
+// formatRegions formats edited regions as a numbered list
+func formatRegions(edited []regions.Region) []string {
+	lines := make([]string, 0, len(edited))
+	for i, region := range edited {
+		location := fmt.Sprintf("%s:%d", region.Path, region.StartLine)
+		if region.EndLine > region.StartLine {
+			location = fmt.Sprintf("%s:%d-%d", region.Path, region.StartLine, region.EndLine)
+		}
+		lines = append(lines, fmt.Sprintf("%3d. %s (edited %s)", i+1, location, region.EditedAt.Format("2006-01-02 15:04:05")))
+	}
+	return lines
+}
+
+// selectRegion returns the region selected by its 1-based number in the changes list
+func selectRegion(edited []regions.Region, args []string) (regions.Region, error) {
+	if len(args) == 0 {
+		return regions.Region{}, fmt.Errorf("region number is required")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(edited) {
+		return regions.Region{}, fmt.Errorf("invalid region number: %s", args[0])
+	}
+	return edited[n-1], nil
 }
@@ -2,16 +2,74 @@ package tui
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/abiosoft/ishell/v2"
+	"github.com/kazz187/goline/internal/core/gitcommit"
+	"github.com/kazz187/goline/internal/core/images"
+	"github.com/kazz187/goline/internal/core/review"
+	"github.com/kazz187/goline/internal/core/slashcommands"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	"github.com/kazz187/goline/internal/core/taskstore"
+	"github.com/kazz187/goline/internal/notify"
+	"github.com/kazz187/goline/internal/provider"
 )
 
+// REPLOptions are the settings of a REPL session
+type REPLOptions struct {
+	// TaskID is the ID of the first task
+	TaskID string
+	// Provider is the provider shown in the task information
+	Provider string
+	// Model is the model shown in the task information. The tasks can switch to another model
+	// with the model command.
+	Model string
+	// ResolveModel resolves the argument of the model command, nil to take it as a model of the
+	// provider of the task
+	ResolveModel ModelResolver
+	// ResponseLanguage is the language the AI answers in, that of the user if empty.
+	// It can be changed for each task with the language command.
+	ResponseLanguage string
+	// InitialMessage is asked to the AI agent when the REPL starts, if not empty
+	InitialMessage string
+	// ReadOnly tells that Runner restricts the agents of the tasks to reading the workspace,
+	// shown in the task information, see agent.Options.ReadOnly
+	ReadOnly bool
+	// Lock is the lock of the task TaskID, checked before the checkpoint and undo commands write
+	// to it, nil to not check. They are refused when it is read-only.
+	Lock *tasklock.Lock
+	// Runner runs the messages sent to the tasks with the AI agent, nil to fail them with ErrNoAgent
+	Runner TaskRunner
+	// Retrier regenerates the last answers of the tasks with the retry command, nil if they
+	// cannot be regenerated
+	Retrier TaskRetrier
+	// Committer commits the changes with the commit command, nil if commits are not available
+	Committer *gitcommit.Committer
+	// Reviewer reviews the changes with the review command, nil if reviews are not available
+	Reviewer *review.Reviewer
+	// Theme is the preset of the colors of the TUI, dark if empty
+	Theme string
+	// ThemeFile is a YAML file overriding the colors of the preset, loaded again when it changes
+	ThemeFile string
+	// Layout sets the proportions of the panes
+	Layout Layout
+	// SlashCommands are the slash commands defined in the configuration
+	SlashCommands []slashcommands.Command
+	// Notifier pings the user when a task waits for approval or an answer, fails or completes,
+	// nil to not notify
+	Notifier *notify.Dispatcher
+}
+
 // REPLIntegration represents the integration between the TUI and the REPL
 type REPLIntegration struct {
 	ui     *UI
@@ -19,53 +77,112 @@ type REPLIntegration struct {
 	mu     sync.Mutex
 	input  *bytes.Buffer
 	output *bytes.Buffer
+	opts   REPLOptions
+	// tasks are the tasks open in the TUI, each with its own history and agent loop
+	tasks *taskManager
+	// title shows the shown task and its status in the terminal title
+	title *terminalTitle
+	// inputHandler edits the input line, set once the REPL is started
+	inputHandler *InputHandler
+	// stopThemeWatcher stops watching the theme file, nil if it is not watched
+	stopThemeWatcher func()
 }
 
 // NewREPLIntegration creates a new REPL integration
-func NewREPLIntegration() (*REPLIntegration, error) {
-	input := bytes.NewBufferString("")
-	output := bytes.NewBufferString("")
-	repl := initREPL(input, output, output)
-	ui, err := NewUI(repl, input)
+func NewREPLIntegration(opts REPLOptions) (*REPLIntegration, error) {
+	r := newREPLIntegration(opts)
+	ui, err := NewUI(r.shell, r.input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create UI: %w", err)
 	}
+	r.ui = ui
+	r.title = newTerminalTitle(os.Stdout)
 
-	return &REPLIntegration{
-		ui:     ui,
-		shell:  repl,
-		mu:     sync.Mutex{},
-		input:  input,
-		output: output,
-	}, nil
+	ui.SetLayout(opts.Layout)
+	theme, err := LoadTheme(opts.Theme, opts.ThemeFile)
+	if err != nil {
+		slog.Warn("Failed to load the theme, using the default one", "error", err)
+		theme = themePresets[ThemeDark]
+	}
+	ui.SetTheme(theme)
+	return r, nil
 }
 
-// Start starts the REPL integration
-func (r *REPLIntegration) Start() error {
+// newREPLIntegration creates a REPL integration without its UI
+func newREPLIntegration(opts REPLOptions) *REPLIntegration {
+	r := &REPLIntegration{
+		input:  bytes.NewBufferString(""),
+		output: bytes.NewBufferString(""),
+		opts:   opts,
+	}
+	r.tasks = newTaskManager(opts.Runner, r.taskUpdated)
+	r.tasks.retrier = opts.Retrier
+	r.tasks.notifier = opts.Notifier
+	r.shell = initREPL(r.input, r.output, r.output, r.CurrentTaskID, taskLock{taskID: opts.TaskID, lock: opts.Lock})
+	return r
+}
+
+// open sets up the input handler, opens the first task and sends the initial message
+func (r *REPLIntegration) open() {
 	// Note: ishell doesn't provide direct methods to set input/output
 	// We'll use a different approach to capture input/output
 
 	// Create and set the input handler
 	inputHandler := NewInputHandler(r.ui, r, r.shell, r.input)
 	r.ui.SetInputHandler(inputHandler)
+	r.inputHandler = inputHandler
+	inputHandler.processor.SetCommitter(r.opts.Committer)
+	inputHandler.processor.SetReviewer(r.opts.Reviewer)
+	inputHandler.processor.SetSlashCommands(r.opts.SlashCommands)
+	inputHandler.processor.SetModelResolver(r.opts.ResolveModel)
+	inputHandler.processor.SetTaskLock(r.opts.TaskID, r.opts.Lock)
 
-	// Add system history entry
-	r.ui.AddHistoryEntry(HistoryEntry{
-		Timestamp: time.Now(),
-		Type:      "system",
-		Content:   "Task started",
-	})
+	// Open the first task
+	r.showTask(r.tasks.open(r.taskInfo(r.opts.TaskID)))
 
 	// Set up command processing
 	r.setupCommandProcessing()
+	if r.opts.InitialMessage != "" {
+		inputHandler.processor.SubmitMultiLine("ask", r.opts.InitialMessage)
+	}
+}
+
+// Start starts the REPL integration
+func (r *REPLIntegration) Start() error {
+	r.open()
+	if r.opts.ThemeFile != "" {
+		r.watchTheme()
+	}
+
+	// Exit like Ctrl+C when the process is asked to terminate, so that Close cancels the
+	// tasks and restores the terminal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-signals:
+			r.ui.Quit()
+		case <-stopped:
+		}
+	}()
 
 	// Start the UI in a goroutine
 	errCh := make(chan error, 1)
 	go func() {
+		defer close(errCh)
+		// A panic is returned as an error so that Close still restores the terminal
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("UI panicked", "panic", v, "stack", string(debug.Stack()))
+				errCh <- fmt.Errorf("the UI crashed: %v", v)
+			}
+		}()
 		if err := r.ui.Run(); err != nil {
 			errCh <- err
 		}
-		close(errCh)
 	}()
 
 	// Wait for the UI to exit
@@ -78,6 +195,22 @@ func (r *REPLIntegration) Start() error {
 	return nil
 }
 
+// watchTheme applies the theme file again each time it is saved
+func (r *REPLIntegration) watchTheme() {
+	stop, err := watchTheme(r.opts.Theme, r.opts.ThemeFile, func(theme Theme, err error) {
+		if err != nil {
+			r.AddSystemMessage(fmt.Sprintf("Failed to reload the theme: %v", err))
+			return
+		}
+		r.ui.SetTheme(theme)
+	})
+	if err != nil {
+		slog.Warn("The theme file is not reloaded when it changes", "error", err)
+		return
+	}
+	r.stopThemeWatcher = stop
+}
+
 // setupCommandProcessing sets up command processing
 func (r *REPLIntegration) setupCommandProcessing() {
 	// Since we can't directly access the shell's commands,
@@ -91,45 +224,251 @@ func (r *REPLIntegration) setupCommandProcessing() {
 	r.AddSystemMessage("Type 'help' to see available commands")
 }
 
-// Close closes the REPL integration
+// Close stops the agent loops of the tasks, closes the UI and restores the terminal title
 func (r *REPLIntegration) Close() {
+	if r.stopThemeWatcher != nil {
+		r.stopThemeWatcher()
+	}
+	r.tasks.close()
 	r.ui.Close()
+	r.title.restore()
 }
 
-// AddUserInput adds user input to the history
-func (r *REPLIntegration) AddUserInput(input string) {
+// taskInfo returns the information of a new task
+func (r *REPLIntegration) taskInfo(id string) TaskInfo {
+	return TaskInfo{
+		ID:        id,
+		StartTime: time.Now(),
+		Provider:  r.opts.Provider,
+		Engine:    r.opts.Model,
+		Language:  r.opts.ResponseLanguage,
+		ReadOnly:  r.opts.ReadOnly,
+	}
+}
+
+// showTask shows the history and information of a task
+func (r *REPLIntegration) showTask(s *taskSession) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.ui.AddHistoryEntry(HistoryEntry{
-		Timestamp: time.Now(),
-		Type:      "user",
-		Content:   input,
-	})
+	info := r.tasks.info(s)
+	r.ui.ShowHistory(s.history)
+	r.ui.UpdateTaskInfo(&info)
+	r.ui.UpdateTasks(r.tasks.summaries())
+	r.ui.UpdateFileMarks(r.tasks.fileMarks(s))
+	r.title.set(formatTitle(info))
 }
 
-// AddAgentOutput adds agent output to the history
-func (r *REPLIntegration) AddAgentOutput(output string) {
+// taskUpdated renders the changes of a task, its history only if it is shown
+func (r *REPLIntegration) taskUpdated(s *taskSession) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.ui.AddHistoryEntry(HistoryEntry{
-		Timestamp: time.Now(),
-		Type:      "agent",
-		Content:   output,
-	})
+	if r.tasks.isShown(s) {
+		info := r.tasks.info(s)
+		r.ui.HistoryChanged()
+		r.ui.UpdateTaskInfo(&info)
+		r.ui.UpdateFileMarks(r.tasks.fileMarks(s))
+		r.title.set(formatTitle(info))
+	}
+	r.ui.UpdateTasks(r.tasks.summaries())
+}
+
+// shownWriter returns the writer of the history of the shown task
+func (r *REPLIntegration) shownWriter() HistoryWriter {
+	return &sessionWriter{manager: r.tasks, session: r.tasks.shown()}
+}
+
+// AddUserInput adds user input to the history of the shown task
+func (r *REPLIntegration) AddUserInput(input string) {
+	r.shownWriter().AddUserInput(input)
+}
+
+// AddAgentOutput adds agent output to the history of the shown task
+func (r *REPLIntegration) AddAgentOutput(output string) {
+	r.shownWriter().AddAgentOutput(output)
 }
 
-// AddSystemMessage adds a system message to the history
+// AddSystemMessage adds a system message to the history of the shown task
 func (r *REPLIntegration) AddSystemMessage(message string) {
+	r.shownWriter().AddSystemMessage(message)
+}
+
+// CurrentTaskID returns the ID of the shown task
+func (r *REPLIntegration) CurrentTaskID() string {
+	s := r.tasks.shown()
+	if s == nil {
+		return ""
+	}
+	return r.tasks.info(s).ID
+}
+
+// NewTask opens a new task and shows it
+func (r *REPLIntegration) NewTask() (string, error) {
+	id, err := taskstore.NewTaskID()
+	if err != nil {
+		return "", err
+	}
+	r.tasks.open(r.taskInfo(id))
+	return id, r.SwitchTask(id)
+}
+
+// SwitchTask shows the task with the ID, or the only task whose ID starts with it
+func (r *REPLIntegration) SwitchTask(id string) error {
+	s, err := r.tasks.switchTo(id)
+	if err != nil {
+		return err
+	}
+	r.showTask(s)
+	return nil
+}
+
+// NextTask shows the task opened after the shown one
+func (r *REPLIntegration) NextTask() {
+	if s := r.tasks.next(); s != nil {
+		r.showTask(s)
+	}
+}
+
+// SwitchModel switches the shown task to a model for its next messages
+func (r *REPLIntegration) SwitchModel(choice ModelChoice) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setModel(s, choice)
+	}
+}
+
+// Model returns the model of the shown task
+func (r *REPLIntegration) Model() ModelChoice {
+	s := r.tasks.shown()
+	if s == nil {
+		return ModelChoice{Provider: r.opts.Provider, Model: r.opts.Model}
+	}
+	info := r.tasks.info(s)
+	return ModelChoice{Provider: info.Provider, Model: info.Engine}
+}
+
+// SetGeneration sets the sampling settings of the shown task for its next messages
+func (r *REPLIntegration) SetGeneration(opts provider.GenerationOptions) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setGeneration(s, opts)
+	}
+}
+
+// Generation returns the sampling settings of the shown task
+func (r *REPLIntegration) Generation() provider.GenerationOptions {
+	s := r.tasks.shown()
+	if s == nil {
+		return provider.GenerationOptions{}
+	}
+	return r.tasks.info(s).Generation
+}
+
+// SetResponseLanguage sets the response language of the shown task
+func (r *REPLIntegration) SetResponseLanguage(language string) {
+	if s := r.tasks.shown(); s != nil {
+		r.tasks.setLanguage(s, language)
+	}
+}
+
+// ResponseLanguage returns the response language of the shown task
+func (r *REPLIntegration) ResponseLanguage() string {
+	s := r.tasks.shown()
+	if s == nil {
+		return ""
+	}
+	return r.tasks.info(s).Language
+}
+
+// Tasks describes the open tasks
+func (r *REPLIntegration) Tasks() []TaskSummary {
+	return r.tasks.summaries()
+}
+
+// Submit sends a message to the agent loop of the shown task
+func (r *REPLIntegration) Submit(message string) error {
+	return r.tasks.submit(message)
+}
+
+// ContinueResponse asks the agent of the shown task to continue its truncated response
+func (r *REPLIntegration) ContinueResponse() error {
+	return r.tasks.continueResponse()
+}
+
+// RetryResponse asks the agent of the shown task to regenerate its last answer
+func (r *REPLIntegration) RetryResponse(model ModelChoice) error {
+	return r.tasks.retryResponse(model)
+}
+
+// AnswerQuestion answers the question the shown task waits for, if any, and reports whether there was one
+func (r *REPLIntegration) AnswerQuestion(input string) bool {
+	return r.tasks.answerQuestion(input)
+}
+
+// SelectQuestionOption selects the next option, or the previous one if delta is negative, of
+// the question the shown task waits for. It reports false if there is no option to select.
+func (r *REPLIntegration) SelectQuestionOption(delta int) (string, bool) {
+	return r.tasks.selectOption(delta)
+}
+
+// AttachImage attaches an image to the next message of the shown task
+func (r *REPLIntegration) AttachImage(attachment images.Attachment) error {
+	return r.tasks.attach(attachment)
+}
+
+// DetachImages drops the images attached to the next message of the shown task
+func (r *REPLIntegration) DetachImages() []images.Attachment {
+	return r.tasks.detach()
+}
+
+// LastAgentOutput returns the last output of the agent of the shown task
+func (r *REPLIntegration) LastAgentOutput() string {
+	return lastAgentOutput(r.tasks.shown())
+}
+
+// InsertInput puts text in the input for the user to edit and send it as a question
+func (r *REPLIntegration) InsertInput(text string) {
+	if r.inputHandler != nil {
+		r.inputHandler.insertInput(text)
+	}
+}
+
+// PrefillInput fills the multi-line input of the command being processed with text for the user to edit
+func (r *REPLIntegration) PrefillInput(text string) {
+	if r.inputHandler != nil {
+		r.inputHandler.insertedInput = text
+	}
+}
+
+// Choose opens a dialog asking the user to pick one of options, e.g. to approve a tool use,
+// and waits for the answer. It returns the index of the option picked, or -1 if the dialog
+// was dismissed.
+func (r *REPLIntegration) Choose(ctx context.Context, title, message string, options []string) (int, error) {
+	chosen := make(chan int, 1)
+	dialog := NewDialog(title, message, options, func(option int) { chosen <- option })
+	r.ui.OpenOverlay(dialog)
+	select {
+	case option := <-chosen:
+		return option, nil
+	case <-ctx.Done():
+		r.ui.CloseOverlay(dialog)
+		return -1, ctx.Err()
+	}
+}
+
+// ExpandHistoryEntry shows the next page, or all pages, of a collapsed history entry
+func (r *REPLIntegration) ExpandHistoryEntry(n int, all bool) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.ui.AddHistoryEntry(HistoryEntry{
-		Timestamp: time.Now(),
-		Type:      "system",
-		Content:   message,
-	})
+	return r.ui.ExpandHistoryEntry(n, all)
+}
+
+// CollapseHistoryEntry shows only the first page of a history entry
+func (r *REPLIntegration) CollapseHistoryEntry(n int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ui.CollapseHistoryEntry(n)
 }
 
 // UpdateREPLInput updates the REPL input
@@ -175,8 +514,8 @@ func (w *REPLWriter) Write(p []byte) (n int, err error) {
 }
 
 // StartREPLWithTUI starts the REPL with the TUI
-func StartREPLWithTUI() error {
-	integration, err := NewREPLIntegration()
+func StartREPLWithTUI(opts REPLOptions) error {
+	integration, err := NewREPLIntegration(opts)
 	if err != nil {
 		return fmt.Errorf("failed to create REPL integration: %w", err)
 	}
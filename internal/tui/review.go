@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/review"
+)
+
+// SetReviewer sets the reviewer of the review command, which is unavailable without one
+func (p *CommandProcessor) SetReviewer(reviewer *review.Reviewer) {
+	p.reviewer = reviewer
+}
+
+// processReview asks the AI to review the working tree, the staged changes with --staged or
+// a ref with --ref, without editing files, and shows its findings. The other arguments are
+// instructions for the review.
+func (p *CommandProcessor) processReview(args []string) {
+	if p.reviewer == nil {
+		p.out.AddSystemMessage("Reviews are not available without a configured provider")
+		return
+	}
+	var source review.Source
+	var instructions []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--staged":
+			source.Staged = true
+		case "--ref":
+			if i+1 >= len(args) {
+				p.out.AddSystemMessage("Error: --ref requires a ref")
+				return
+			}
+			source.Ref = args[i+1]
+			i++
+		default:
+			instructions = append(instructions, args[i])
+		}
+	}
+
+	p.out.AddSystemMessage(fmt.Sprintf("Reviewing the %s...", source))
+	result, err := p.reviewer.Review(context.Background(), source, strings.Join(instructions, " "))
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	p.out.AddSystemMessage(strings.TrimRight(review.Format(result), "\n"))
+}
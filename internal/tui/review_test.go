@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/review"
+	"github.com/kazz187/goline/internal/provider/mock"
+)
+
+func TestReviewCommand(t *testing.T) {
+	workingDir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = workingDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "--quiet")
+	if err := os.WriteFile(filepath.Join(workingDir, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "a.go")
+	git("commit", "--quiet", "-m", "init")
+	if err := os.WriteFile(filepath.Join(workingDir, "a.go"), []byte("package a\n\nvar unused int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &recordingWriter{}
+	p := NewCommandProcessor(out)
+	p.Process("review")
+	if len(out.messages) != 1 || !strings.Contains(out.messages[0], "not available") {
+		t.Errorf("review without a reviewer = %q", out.messages)
+	}
+
+	out.messages = nil
+	p.SetReviewer(review.NewReviewer(mock.New(&mock.Fixture{Responses: []mock.Response{
+		{Text: `{"summary": "One problem", "findings": [{"file": "a.go", "line": 3, "severity": "warning", "message": "unused is never used"}]}`},
+	}}), workingDir))
+	p.Process("review focus on dead code")
+	got := strings.Join(out.messages, "\n")
+	if !strings.Contains(got, "Review of working tree") || !strings.Contains(got, "unused is never used") {
+		t.Errorf("review messages = %q", out.messages)
+	}
+}
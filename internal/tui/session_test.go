@@ -0,0 +1,334 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/kazz187/goline/internal/config"
+	"github.com/kazz187/goline/internal/core/agent"
+	"github.com/kazz187/goline/internal/core/apply"
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// sessionTimeout bounds the wait for the agent loop of a test session
+const sessionTimeout = 10 * time.Second
+
+// streamChunkSize is the size of the text events the mock provider streams its responses in
+const streamChunkSize = 16
+
+// mockProvider answers with scripted responses in order and keeps the last message of each request
+type mockProvider struct {
+	mu        sync.Mutex
+	responses []string
+	messages  []string
+}
+
+func (p *mockProvider) CreateMessage(ctx context.Context, systemPrompt string, messages []provider.Message, opts provider.GenerationOptions) (chan provider.StreamEvent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, messages[len(messages)-1].Content)
+	if len(p.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+
+	ch := make(chan provider.StreamEvent, len(response)/streamChunkSize+2)
+	for i := 0; i < len(response); i += streamChunkSize {
+		ch <- provider.StreamEvent{Type: "text", Text: response[i:min(i+streamChunkSize, len(response))]}
+	}
+	ch <- provider.StreamEvent{Type: "usage", Usage: &provider.Usage{InputTokens: 10, OutputTokens: 5}}
+	close(ch)
+	return ch, nil
+}
+
+func (p *mockProvider) GetModel() provider.ModelInfo {
+	return provider.ModelInfo{Name: "mock"}
+}
+
+func (p *mockProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{}
+}
+
+func (p *mockProvider) Name() string {
+	return "mock"
+}
+
+// message returns the last message of the nth request
+func (p *mockProvider) message(n int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n >= len(p.messages) {
+		return ""
+	}
+	return p.messages[n]
+}
+
+// testSession drives a REPL session headlessly. Key events go through the input handler as
+// they do in the terminal, without drawing the UI, and the messages sent to the tasks are run
+// by agents answering with a mock provider in a temporary workspace.
+type testSession struct {
+	t           *testing.T
+	repl        *REPLIntegration
+	provider    *mockProvider
+	workspace   string
+	checkpoints *checkpoint.Service
+	// done receives the error of each run of the agent loop
+	done chan error
+	// exited reports whether a key event ended the session
+	exited bool
+}
+
+// newTestSession starts a session in a temporary workspace, which is the working directory,
+// with an agent auto-approving autoApprove and answering with responses
+func newTestSession(t *testing.T, autoApprove config.AutoApprove, responses ...string) *testSession {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	workspace := t.TempDir()
+	t.Chdir(workspace)
+
+	s := &testSession{
+		t:           t,
+		provider:    &mockProvider{responses: responses},
+		workspace:   workspace,
+		checkpoints: checkpoint.NewService(),
+		done:        make(chan error, taskInboxSize),
+	}
+	agents := make(map[string]*sessionAgent)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		err := s.run(ctx, agents, autoApprove, taskID, message, out)
+		s.done <- err
+		return err
+	}
+
+	s.repl = newREPLIntegration(REPLOptions{TaskID: "task-1", Provider: "mock", Model: "mock", Runner: runner})
+	s.repl.ui = newUI(s.repl.shell, s.repl.input)
+	s.repl.open()
+	t.Cleanup(s.repl.tasks.close)
+	return s
+}
+
+// sessionAgent is the agent of a task of a test session with the output of its current run
+type sessionAgent struct {
+	agent  *agent.Agent
+	output *sessionOutput
+}
+
+// sessionOutput collects the output of a run of an agent, and previews its tool uses in the
+// history like the REPL does
+type sessionOutput struct {
+	strings.Builder
+	out HistoryWriter
+}
+
+// sessionApprover approves the tool uses allowed by the policy of a test session and puts the
+// questions of the AI to the user like the REPL does
+type sessionApprover struct {
+	agent.PolicyApprover
+	output *sessionOutput
+}
+
+// AnswerQuestion implements agent.QuestionAnswerer
+func (a sessionApprover) AnswerQuestion(ctx context.Context, question string, options []string) (string, error) {
+	asker, ok := a.output.out.(QuestionAsker)
+	if !ok {
+		return "", agent.ErrNeedsInput
+	}
+	return asker.AskQuestion(ctx, question, options)
+}
+
+// StreamToolUse implements agent.ToolUseStreamer
+func (o *sessionOutput) StreamToolUse(toolUse assistantmessage.ToolUse) {
+	if previewer, ok := o.out.(ToolUsePreviewer); ok {
+		previewer.PreviewToolUse(toolUse)
+	}
+}
+
+// run runs a message with the agent of a task, created on its first message
+func (s *testSession) run(ctx context.Context, agents map[string]*sessionAgent, autoApprove config.AutoApprove, taskID, message string, out HistoryWriter) error {
+	a, ok := agents[taskID]
+	if !ok {
+		applier, err := apply.NewApplier(taskID, s.workspace, s.checkpoints)
+		if err != nil {
+			return err
+		}
+		a = &sessionAgent{output: &sessionOutput{}}
+		a.agent = agent.New(agent.Options{
+			TaskID:     taskID,
+			WorkingDir: s.workspace,
+			Provider:   s.provider,
+			Approver:   sessionApprover{PolicyApprover: agent.PolicyApprover{AutoApprove: autoApprove}, output: a.output},
+			Applier:    applier,
+			Output:     a.output,
+		})
+		agents[taskID] = a
+	}
+
+	a.output.Reset()
+	a.output.out = out
+	result, err := a.agent.Run(ctx, message)
+	if a.output.Len() > 0 {
+		out.AddAgentOutput(a.output.String())
+	}
+	if err != nil {
+		return err
+	}
+	out.AddSystemMessage("Task completed: " + result.Completion)
+	return nil
+}
+
+// press sends key events, such as "<Enter>" or "<C-d>", to the input handler
+func (s *testSession) press(keys ...string) {
+	for _, key := range keys {
+		if s.repl.inputHandler.HandleKeyEvent(ui.Event{Type: ui.KeyboardEvent, ID: key}) {
+			s.exited = true
+		}
+	}
+}
+
+// typeText types ASCII text key by key, a newline pressing Enter
+func (s *testSession) typeText(text string) {
+	for _, r := range text {
+		switch r {
+		case ' ':
+			s.press("<Space>")
+		case '\n':
+			s.press("<Enter>")
+		default:
+			s.press(string(r))
+		}
+	}
+}
+
+// enter types a line and presses Enter
+func (s *testSession) enter(line string) {
+	s.typeText(line)
+	s.press("<Enter>")
+}
+
+// waitRun waits for the agent loop to finish running a message and returns the error of the run
+func (s *testSession) waitRun() error {
+	s.t.Helper()
+	var err error
+	select {
+	case err = <-s.done:
+	case <-time.After(sessionTimeout):
+		s.t.Fatal("the agent loop did not run the message")
+	}
+	// The loop sets the status back once the runner returned
+	deadline := time.Now().Add(sessionTimeout)
+	for s.running() {
+		if time.Now().After(deadline) {
+			s.t.Fatal("the agent loop did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return err
+}
+
+// waitStatus waits for the shown task to have a status
+func (s *testSession) waitStatus(status string) {
+	s.t.Helper()
+	deadline := time.Now().Add(sessionTimeout)
+	for s.repl.tasks.info(s.repl.tasks.shown()).Status != status {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("the task did not reach the status %q", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// running reports whether a task is running a message
+func (s *testSession) running() bool {
+	for _, task := range s.repl.Tasks() {
+		if task.Status == taskStatusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// history returns the history of the shown task
+func (s *testSession) history() []HistoryEntry {
+	return s.repl.tasks.shown().history.Entries()
+}
+
+// requireHistory fails the test unless the history of the shown task has an entry of the type
+// containing text
+func (s *testSession) requireHistory(entryType, text string) {
+	s.t.Helper()
+	for _, entry := range s.history() {
+		if entry.Type == entryType && strings.Contains(entry.Content, text) {
+			return
+		}
+	}
+	s.t.Fatalf("no %s entry contains %q in the history:\n%s", entryType, text, s.dumpHistory())
+}
+
+// dumpHistory formats the history of the shown task for failure messages
+func (s *testSession) dumpHistory() string {
+	var b strings.Builder
+	for _, entry := range s.history() {
+		fmt.Fprintf(&b, "%s: %s\n", entry.Type, entry.Content)
+	}
+	return b.String()
+}
+
+// initRepository creates a git repository with an empty commit in dir and returns a function
+// running git in it
+func initRepository(t *testing.T, dir string) func(args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "test")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	return git
+}
+
+// readFile returns the content of a file of the workspace
+func (s *testSession) readFile(path string) string {
+	s.t.Helper()
+	data, err := os.ReadFile(filepath.Join(s.workspace, path))
+	if err != nil {
+		s.t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// checkpointCount returns the number of checkpoints saved for a task
+func (s *testSession) checkpointCount(taskID string) int {
+	s.t.Helper()
+	checkpoints, err := s.checkpoints.GetCheckpoints(taskID, s.workspace)
+	if err != nil {
+		s.t.Fatalf("GetCheckpoints() error = %v", err)
+	}
+	return len(checkpoints)
+}
@@ -0,0 +1,51 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/kazz187/goline/internal/core/slashcommands"
+)
+
+// SetSlashCommands sets the slash commands defined in the configuration, besides those of the
+// command files and the built-in ones
+func (p *CommandProcessor) SetSlashCommands(configured []slashcommands.Command) {
+	p.slash.SetConfigured(configured)
+}
+
+// processSlash fills in the prompt of a slash command with its arguments and sends it to the AI agent
+func (p *CommandProcessor) processSlash(name, args string) {
+	command, err := p.slash.Get(name)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v, list the commands with `help`", err))
+		return
+	}
+	prompt, err := command.Render(args)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if prompt == "" {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: the prompt of /%s is empty", command.Name))
+		return
+	}
+
+	if submitter, ok := p.out.(MessageSubmitter); ok {
+		p.submit(submitter, prompt)
+		return
+	}
+	p.out.AddSystemMessage("Sending question to AI agent...")
+	p.out.AddSystemMessage("TODO: Implement ask logic")
+}
+
+// listSlashCommands lists the slash commands with their description and where they are defined
+func (p *CommandProcessor) listSlashCommands() {
+	list, err := p.slash.List()
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	p.out.AddSystemMessage("Slash commands, defined in .goline/commands/<name>.md, ~/.goline/commands or the slash_commands of the configuration:")
+	for _, command := range list {
+		p.out.AddSystemMessage(fmt.Sprintf("  /%s [args] - %s (%s)", command.Name, command.Description, command.Source))
+	}
+}
@@ -0,0 +1,65 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/slashcommands"
+)
+
+// submittingWriter records the messages sent to the agent loop
+type submittingWriter struct {
+	recordingWriter
+	submitted []string
+}
+
+func (w *submittingWriter) NewTask() (string, error)   { return "", nil }
+func (w *submittingWriter) SwitchTask(id string) error { return nil }
+func (w *submittingWriter) Tasks() []TaskSummary       { return nil }
+func (w *submittingWriter) Submit(message string) error {
+	w.submitted = append(w.submitted, message)
+	return nil
+}
+
+func TestSlashCommand(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repoDir, "fix.md"), []byte("---\ndescription: Fix a file\n---\nFix {{arg1}}. {{args}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := &submittingWriter{}
+	p := NewCommandProcessor(out)
+	p.slash = slashcommands.NewRegistry("", repoDir, nil)
+	p.SetSlashCommands([]slashcommands.Command{{Name: "deploy", Template: "Deploy {{args}} to staging"}})
+
+	p.Process("/fix main.go  quickly")
+	p.Process("/deploy api")
+	want := []string{"Fix main.go. main.go  quickly", "Deploy api to staging"}
+	if !reflect.DeepEqual(out.submitted, want) {
+		t.Errorf("submitted = %q, want %q", out.submitted, want)
+	}
+
+	for command, message := range map[string]string{
+		"/fix":     "/fix expects 1 argument(s), got 0",
+		"/unknown": "slash command not found: /unknown",
+	} {
+		p.Process(command)
+		if last := out.messages[len(out.messages)-1]; !strings.Contains(last, message) {
+			t.Errorf("message of %s = %q, want %q", command, last, message)
+		}
+	}
+
+	p.Process("help")
+	if help := strings.Join(out.messages, "\n"); !strings.Contains(help, "/fix [args] - Fix a file (repo)") || !strings.Contains(help, "/review [args]") {
+		t.Errorf("help does not list the slash commands:\n%s", help)
+	}
+
+	if completed, candidates := p.Complete("/de"); completed != "/deploy " || candidates != nil {
+		t.Errorf("Complete(/de) = %q, %v", completed, candidates)
+	}
+	if completed, candidates := p.Complete("/"); completed != "/" || len(candidates) != 5 {
+		t.Errorf("Complete(/) = %q, %v, want the 5 commands", completed, candidates)
+	}
+}
@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/snippets"
+)
+
+// snippetSubcommands are the subcommands of the snippet command
+var snippetSubcommands = []string{"delete", "insert", "list", "save", "show"}
+
+// processSnippet lists, shows, saves, inserts or deletes snippets
+func (p *CommandProcessor) processSnippet(command string, args []string) CommandResult {
+	if len(args) == 0 {
+		p.out.AddSystemMessage("Error: snippet subcommand is required")
+		return CommandDone
+	}
+	if args[0] == "list" {
+		p.listSnippets()
+		return CommandDone
+	}
+	if len(args) < 2 {
+		p.out.AddSystemMessage("Error: snippet name is required")
+		return CommandDone
+	}
+	name, rest := args[1], args[2:]
+	scope := snippets.ScopeGlobal
+	if len(rest) > 0 && rest[0] == "--repo" {
+		scope = snippets.ScopeRepo
+		rest = rest[1:]
+	}
+
+	switch args[0] {
+	case "show":
+		snippet, err := p.snippets.Get(name)
+		if err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return CommandDone
+		}
+		p.out.AddSystemMessage(fmt.Sprintf("Snippet %s (%s):\n%s", snippet.Name, snippet.Scope, snippet.Content))
+	case "save":
+		if err := snippets.ValidateName(name); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return CommandDone
+		}
+		if len(rest) == 0 {
+			p.pendingSnippet = snippets.Snippet{Name: name, Scope: scope}
+			return CommandNeedsMultiLine
+		}
+		p.saveSnippet(name, fieldsAfter(command, len(args)-len(rest)+1), scope)
+	case "insert":
+		p.insertSnippet(name, rest)
+	case "delete":
+		if err := p.snippets.Delete(name, scope); err != nil {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+			return CommandDone
+		}
+		p.out.AddSystemMessage(fmt.Sprintf("Deleted %s snippet %s", scope, name))
+	default:
+		p.out.AddSystemMessage(fmt.Sprintf("Error: unknown snippet subcommand: %s", args[0]))
+	}
+	return CommandDone
+}
+
+// listSnippets lists the saved snippets with the first line of their content
+func (p *CommandProcessor) listSnippets() {
+	list, err := p.snippets.List()
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if len(list) == 0 {
+		p.out.AddSystemMessage("No snippets saved, save one with `snippet save <name>`")
+		return
+	}
+	p.out.AddSystemMessage("Snippets:")
+	for _, snippet := range list {
+		line, _, _ := strings.Cut(strings.TrimSpace(snippet.Content), "\n")
+		p.out.AddSystemMessage(fmt.Sprintf("  %s (%s) - %s", snippet.Name, snippet.Scope, line))
+	}
+}
+
+// saveSnippet saves the content of a snippet
+func (p *CommandProcessor) saveSnippet(name, content string, scope snippets.Scope) {
+	if strings.TrimSpace(content) == "" {
+		p.out.AddSystemMessage("Error: snippet content is required")
+		return
+	}
+	if err := p.snippets.Save(name, content, scope); err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	message := fmt.Sprintf("Saved %s snippet %s", scope, name)
+	if vars := snippets.Variables(content); len(vars) > 0 {
+		message += fmt.Sprintf(" with variables %s", strings.Join(vars, ", "))
+	}
+	p.out.AddSystemMessage(message)
+}
+
+// insertSnippet renders a snippet with the name=value arguments and puts it in the input, or
+// sends it to the AI agent if the front end cannot edit input
+func (p *CommandProcessor) insertSnippet(name string, args []string) {
+	snippet, err := p.snippets.Get(name)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	vars := make(map[string]string)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: invalid variable %q, expected name=value", arg))
+			return
+		}
+		vars[key] = value
+	}
+	content, err := snippets.Render(snippet.Content, vars)
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	if inserter, ok := p.out.(InputInserter); ok {
+		inserter.InsertInput(content)
+		return
+	}
+	p.SubmitMultiLine("ask", content)
+}
+
+// fieldsAfter returns the text of a command after its first n fields, with its spacing kept
+func fieldsAfter(command string, n int) string {
+	rest := strings.TrimSpace(command)
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			rest = rest[end:]
+		} else {
+			rest = ""
+		}
+	}
+	return strings.TrimSpace(rest)
+}
+
+// Complete completes the last word of an input line: the name of a command or a slash
+// command, a snippet subcommand, or a snippet name. It returns the completed input and, when the word is
+// ambiguous, the candidates.
+func (p *CommandProcessor) Complete(input string) (string, []string) {
+	parts := strings.Fields(input)
+	if len(parts) == 0 || strings.HasSuffix(input, " ") {
+		parts = append(parts, "")
+	}
+	word := parts[len(parts)-1]
+
+	var candidates []string
+	switch {
+	case len(parts) == 1 && strings.HasPrefix(word, "/"):
+		candidates = p.slash.Names("")
+	case len(parts) == 1:
+		candidates = commandNames()
+	case len(parts) == 2 && parts[0] == "snippet":
+		candidates = snippetSubcommands
+	case len(parts) == 3 && parts[0] == "snippet" && parts[1] != "list":
+		candidates = p.snippets.Names("")
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return input, nil
+	}
+
+	prefix := input[:len(input)-len(word)]
+	if len(matches) == 1 {
+		return prefix + matches[0] + " ", nil
+	}
+	return prefix + commonPrefix(matches), matches
+}
+
+// commandNames returns the first words of the REPL commands, sorted
+func commandNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, cmd := range REPLCommands {
+		name, _, _ := strings.Cut(cmd.Name, " ")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commonPrefix returns the longest prefix shared by words
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
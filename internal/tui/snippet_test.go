@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/snippets"
+)
+
+// recordingWriter records the history entries and the inserted input
+type recordingWriter struct {
+	messages []string
+	inserted string
+}
+
+func (w *recordingWriter) AddUserInput(input string)       {}
+func (w *recordingWriter) AddAgentOutput(output string)    {}
+func (w *recordingWriter) AddSystemMessage(message string) { w.messages = append(w.messages, message) }
+func (w *recordingWriter) InsertInput(text string)         { w.inserted = text }
+
+func TestSnippetCommand(t *testing.T) {
+	out := &recordingWriter{}
+	p := NewCommandProcessor(out)
+	p.snippets = snippets.NewStore(t.TempDir(), t.TempDir())
+
+	p.Process("snippet save deploy Deploy {{service}}  to staging")
+	if result := p.Process("snippet save style --repo"); result != CommandNeedsMultiLine {
+		t.Fatalf("snippet save without text = %v, want multi-line input", result)
+	}
+	p.SubmitMultiLine("snippet", "Use tabs\nWrap at 100 columns")
+
+	if snippet, err := p.snippets.Get("deploy"); err != nil || snippet.Content != "Deploy {{service}}  to staging" {
+		t.Errorf("deploy snippet = %+v, %v", snippet, err)
+	}
+	if snippet, err := p.snippets.Get("style"); err != nil || snippet.Scope != snippets.ScopeRepo {
+		t.Errorf("style snippet = %+v, %v", snippet, err)
+	}
+
+	p.Process("snippet insert deploy service=api")
+	if out.inserted != "Deploy api  to staging" {
+		t.Errorf("inserted input = %q", out.inserted)
+	}
+	p.Process("snippet insert deploy")
+	if last := out.messages[len(out.messages)-1]; !strings.Contains(last, "missing values for service") {
+		t.Errorf("message without the variable = %q", last)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	p := NewCommandProcessor(&recordingWriter{})
+	p.snippets = snippets.NewStore(t.TempDir(), "")
+	for _, name := range []string{"deploy", "design"} {
+		if err := p.snippets.Save(name, "x", snippets.ScopeGlobal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input      string
+		completed  string
+		candidates []string
+	}{
+		{"snip", "snippet ", nil},
+		{"snippet ins", "snippet insert ", nil},
+		{"snippet insert d", "snippet insert de", []string{"deploy", "design"}},
+		{"snippet insert dep", "snippet insert deploy ", nil},
+		{"unknown", "unknown", nil},
+	}
+	for _, tt := range tests {
+		completed, candidates := p.Complete(tt.input)
+		if completed != tt.completed || !reflect.DeepEqual(candidates, tt.candidates) {
+			t.Errorf("Complete(%q) = %q, %v, want %q, %v", tt.input, completed, candidates, tt.completed, tt.candidates)
+		}
+	}
+}
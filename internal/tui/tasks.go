@@ -0,0 +1,865 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/core/images"
+	"github.com/kazz187/goline/internal/notify"
+	"github.com/kazz187/goline/internal/provider"
+)
+
+// taskInboxSize is the number of messages that can wait for the agent loop of a task
+const taskInboxSize = 16
+
+// toolPreviewLines is the number of last lines shown of the content of a tool use being streamed
+const toolPreviewLines = 10
+
+// Task statuses shown in the task information and the tasks overview
+const (
+	taskStatusActive  = "Active"
+	taskStatusRunning = "Running"
+	// TaskStatusWaitingForApproval is reported by runners while a tool use waits for the user
+	TaskStatusWaitingForApproval = "Waiting for approval"
+	// taskStatusWaitingForAnswer is shown while a question of the AI waits for the user
+	taskStatusWaitingForAnswer = "Waiting for answer"
+	// taskStatusThrottled is shown while a request waits for the rate limits of the provider
+	taskStatusThrottled = "Throttled"
+	// taskStatusOffline is shown while a request waits for the provider to be reachable again
+	taskStatusOffline = "Waiting for connectivity"
+)
+
+// TaskRunner runs a message of a task with the AI agent, writing what happens to out.
+// Each task runs its messages one after the other, and tasks run concurrently.
+type TaskRunner func(ctx context.Context, taskID, message string, out HistoryWriter) error
+
+// TaskRetrier discards the last answer of the AI in a task and regenerates it with a model, that
+// of the task if its provider is empty, keeping the discarded answer as an alternative. The task
+// then goes on from the new answer, writing what happens to out as a TaskRunner.
+type TaskRetrier func(ctx context.Context, taskID string, model ModelChoice, out HistoryWriter) error
+
+// TaskSummary describes a task open in the REPL for the tasks overview
+type TaskSummary struct {
+	ID     string
+	Status string
+	// Unread is the number of history entries added since the task was last shown
+	Unread int
+	// Current reports whether the task is the one shown
+	Current bool
+}
+
+// MessageSubmitter is implemented by front ends that run the messages with the AI agent
+type MessageSubmitter interface {
+	// Submit sends a message to the agent loop of the shown task
+	Submit(message string) error
+}
+
+// TaskSwitcher is implemented by front ends that run several tasks side by side
+type TaskSwitcher interface {
+	MessageSubmitter
+	// NewTask opens a new task and shows it
+	NewTask() (string, error)
+	// SwitchTask shows the task with the ID, or the only task whose ID starts with it
+	SwitchTask(id string) error
+	// Tasks describes the open tasks
+	Tasks() []TaskSummary
+}
+
+// StatusReporter is implemented by the history writers given to task runners, to show what a
+// running task waits for, e.g. TaskStatusWaitingForApproval
+type StatusReporter interface {
+	SetStatus(status string)
+}
+
+// TaskSettings is implemented by the history writers given to task runners, to read the
+// settings of the task changed with REPL commands
+type TaskSettings interface {
+	// ResponseLanguage is the language the AI answers in, that of the user if empty
+	ResponseLanguage() string
+	// Model is the model the AI answers with, switched with the model command
+	Model() ModelChoice
+	// Generation are the sampling settings of the requests, changed with the set command
+	Generation() provider.GenerationOptions
+}
+
+// LanguageSwitcher is implemented by front ends whose tasks can answer in another language than the configured one
+type LanguageSwitcher interface {
+	// SetResponseLanguage sets the response language of the shown task, that of the user if empty
+	SetResponseLanguage(language string)
+	// ResponseLanguage returns the response language of the shown task
+	ResponseLanguage() string
+}
+
+// TruncationReporter is implemented by the history writers given to task runners, to report
+// an agent output that looks cut off, e.g. by the output token limit. The user can then ask
+// for the rest of it, and the outputs of the runner sent ContinuationPrompt are stitched to it.
+type TruncationReporter interface {
+	// ReportTruncation reports why the last agent output looks truncated
+	ReportTruncation(reasons []string)
+}
+
+// ThrottleReporter is implemented by the history writers given to task runners, to show that
+// a request of the task waits for the rate limits of the provider
+type ThrottleReporter interface {
+	// ReportThrottle shows that the request waits, with how long or zero if it waits for
+	// other requests to end
+	ReportThrottle(wait time.Duration)
+	// ReportThrottleEnd shows that the request was sent
+	ReportThrottleEnd()
+}
+
+// ConnectivityReporter is implemented by the history writers given to task runners, to show
+// that a request of the task is queued until the provider can be reached again
+type ConnectivityReporter interface {
+	// ReportOffline shows that the request could not reach the provider and waits
+	ReportOffline(err error)
+	// ReportOnline shows that the request was sent or given up
+	ReportOnline()
+}
+
+// TaskAttachments is implemented by the history writers given to task runners, to read the
+// images attached to the message being run
+type TaskAttachments interface {
+	// Images returns the images attached to the message, for models that read images
+	Images() []provider.Image
+}
+
+// ToolUsePreviewer is implemented by the history writers given to task runners, to show the
+// tool uses of the AI while they are streamed, e.g. the content of a file as it is written
+type ToolUsePreviewer interface {
+	// PreviewToolUse shows a tool use as streamed so far. The preview is updated until the
+	// tool use is complete.
+	PreviewToolUse(toolUse assistantmessage.ToolUse)
+}
+
+// QuestionAsker is implemented by the history writers given to task runners, to put a question
+// of the AI to the user. The next line the user enters in the task answers it.
+type QuestionAsker interface {
+	// AskQuestion shows a question with the answers suggested by the AI, possibly none, and
+	// waits for the answer of the user
+	AskQuestion(ctx context.Context, question string, options []string) (string, error)
+}
+
+// Chooser is implemented by front ends that can ask the user to pick an option in a dialog
+// drawn over the panes, e.g. to approve a tool use
+type Chooser interface {
+	// Choose waits for the user to pick one of options, and returns its index, or -1 if the
+	// user dismissed the dialog
+	Choose(ctx context.Context, title, message string, options []string) (int, error)
+}
+
+// ResponseContinuer is implemented by front ends that can resume a truncated response
+type ResponseContinuer interface {
+	// ContinueResponse asks the agent of the shown task to continue its truncated response
+	ContinueResponse() error
+}
+
+// ResponseRetrier is implemented by front ends that can regenerate the last answer of the AI
+type ResponseRetrier interface {
+	// RetryResponse asks the agent of the shown task to regenerate its last answer with a
+	// model, that of the task if its provider is empty
+	RetryResponse(model ModelChoice) error
+}
+
+// TaskContext is implemented by front ends to tell which task the commands apply to
+type TaskContext interface {
+	CurrentTaskID() string
+}
+
+// taskSession is a task open in the REPL, with its own history and agent loop
+type taskSession struct {
+	info    TaskInfo
+	history *historyView
+	inbox   chan queuedMessage
+	unread  int
+	// pending is the number of messages sent to the agent loop and not run yet or running
+	pending int
+	// truncated reports whether the last agent output was reported truncated
+	truncated bool
+	// continuing reports whether the running message continues a truncated output, whose
+	// agent outputs are stitched to it
+	continuing bool
+	// previewing reports whether the last tool entry previews a tool use still being streamed
+	previewing bool
+	// question is the question of the AI waiting for the answer of the user, nil if there is none
+	question *pendingQuestion
+	// files are the files the agent read or edited, by the paths given to the tools
+	files map[string]fileMark
+	// attachments are the images attached to the next message
+	attachments []images.Attachment
+}
+
+// queuedMessage is a message sent to the agent loop of a task, with the images attached to it
+type queuedMessage struct {
+	text   string
+	images []provider.Image
+	// retry regenerates the last answer with the model instead of running text, if not nil
+	retry *ModelChoice
+}
+
+// pendingQuestion is a question of the AI waiting for the answer of the user
+type pendingQuestion struct {
+	options []string
+	answer  chan string
+	// selected is the index of the option selected with Up and Down, -1 if none is
+	selected int
+}
+
+// taskManager runs the agent loops of the open tasks and keeps track of the shown one
+type taskManager struct {
+	mu       sync.Mutex
+	sessions []*taskSession
+	current  *taskSession
+	runner   TaskRunner
+	// retrier regenerates the last answers, nil if they cannot be regenerated
+	retrier TaskRetrier
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	// onUpdate is called after the history or the status of a session changed
+	onUpdate func(s *taskSession)
+	// notifier pings the user when a task needs attention, nil to not notify
+	notifier *notify.Dispatcher
+	// notifying tracks the notifications being sent, sent in the background not to block the agent loops
+	notifying sync.WaitGroup
+}
+
+// newTaskManager creates a task manager running messages with runner.
+// Without a runner, messages fail with ErrNoAgent.
+func newTaskManager(runner TaskRunner, onUpdate func(s *taskSession)) *taskManager {
+	if runner == nil {
+		runner = noAgent
+	}
+	if onUpdate == nil {
+		onUpdate = func(*taskSession) {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskManager{
+		runner:   runner,
+		ctx:      ctx,
+		cancel:   cancel,
+		onUpdate: onUpdate,
+	}
+}
+
+// ErrNoAgent fails the messages of a REPL started without the AI agent, e.g. because the
+// configuration could not be loaded
+var ErrNoAgent = errors.New("the AI agent is not available, check the configuration")
+
+// noAgent is the runner of a REPL started without the AI agent
+func noAgent(ctx context.Context, taskID, message string, out HistoryWriter) error {
+	return ErrNoAgent
+}
+
+// open opens a task and starts its agent loop. The first task opened is shown.
+func (m *taskManager) open(info TaskInfo) *taskSession {
+	s := &taskSession{
+		info:    info,
+		history: newHistoryView(),
+		inbox:   make(chan queuedMessage, taskInboxSize),
+	}
+	if s.info.Status == "" {
+		s.info.Status = taskStatusActive
+	}
+
+	m.mu.Lock()
+	m.sessions = append(m.sessions, s)
+	if m.current == nil {
+		m.current = s
+	}
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.loop(s)
+	m.add(s, HistoryEntry{Timestamp: time.Now(), Type: "system", Content: "Task started"})
+	return s
+}
+
+// loop runs the messages sent to a task until the manager is closed
+func (m *taskManager) loop(s *taskSession) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case message := <-s.inbox:
+			m.setStatus(s, taskStatusRunning)
+			out := &sessionWriter{manager: m, session: s, images: message.images}
+			err := m.run(s, message, out)
+			switch {
+			case m.ctx.Err() != nil:
+			case err != nil:
+				out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+				m.notify(s, notify.EventError, err.Error())
+			default:
+				m.notify(s, notify.EventCompleted, "")
+			}
+			m.mu.Lock()
+			s.continuing = false
+			s.previewing = false
+			s.pending--
+			m.mu.Unlock()
+			m.setStatus(s, taskStatusActive)
+		}
+	}
+}
+
+// run runs a message of a task, turning a panic of its agent loop into an error so that it
+// fails the message rather than the REPL, which must still restore the terminal
+func (m *taskManager) run(s *taskSession, message queuedMessage, out HistoryWriter) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Error("Task panicked", "task", s.info.ID, "panic", v, "stack", string(debug.Stack()))
+			err = fmt.Errorf("the task crashed: %v", v)
+		}
+	}()
+	if message.retry != nil {
+		return m.retrier(m.ctx, s.info.ID, *message.retry, out)
+	}
+	return m.runner(m.ctx, s.info.ID, message.text, out)
+}
+
+// submit sends a message to the agent loop of the shown task, with the images attached to it.
+// The placeholders of the images are appended to the message, for the AI to refer to them.
+func (m *taskManager) submit(message string) error {
+	s := m.shown()
+	if s == nil {
+		return errors.New("no active task")
+	}
+	// The first message names the task
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.info.Summary == "" {
+		s.info.Summary = summarizeTask(message)
+	}
+
+	queued := queuedMessage{text: message}
+	for _, attachment := range s.attachments {
+		queued.text += "\n" + attachment.Placeholder()
+		queued.images = append(queued.images, attachment.Image)
+	}
+	select {
+	case s.inbox <- queued:
+		s.pending++
+		s.attachments = nil
+		return nil
+	default:
+		return fmt.Errorf("task %s has too many pending messages", s.info.ID)
+	}
+}
+
+// continueResponse asks the agent loop of the shown task to continue its truncated output
+func (m *taskManager) continueResponse() error {
+	s := m.shown()
+	if s == nil {
+		return errors.New("no active task")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !s.truncated {
+		return fmt.Errorf("the last response of task %s was not truncated", s.info.ID)
+	}
+	select {
+	case s.inbox <- queuedMessage{text: assistantmessage.ContinuationPrompt}:
+		s.truncated = false
+		s.continuing = true
+		s.pending++
+		return nil
+	default:
+		return fmt.Errorf("task %s has too many pending messages", s.info.ID)
+	}
+}
+
+// retryResponse asks the agent loop of the shown task to regenerate its last answer with a
+// model, that of the task if its provider is empty
+func (m *taskManager) retryResponse(model ModelChoice) error {
+	if m.retrier == nil {
+		return ErrNoAgent
+	}
+	s := m.shown()
+	if s == nil {
+		return errors.New("no active task")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case s.inbox <- queuedMessage{retry: &model}:
+		s.truncated = false
+		s.pending++
+		return nil
+	default:
+		return fmt.Errorf("task %s has too many pending messages", s.info.ID)
+	}
+}
+
+// reportTruncation marks the last agent output of a session as truncated and tells how to continue it
+func (m *taskManager) reportTruncation(s *taskSession, reasons []string) {
+	m.mu.Lock()
+	s.truncated = true
+	m.mu.Unlock()
+	m.add(s, HistoryEntry{
+		Timestamp: time.Now(),
+		Type:      "system",
+		Content:   fmt.Sprintf("The response looks truncated: %s. Press Ctrl+O or use `continue` to get the rest of it.", strings.Join(reasons, ", ")),
+	})
+}
+
+// addAgentOutput adds an agent output to the history of a session, stitched to the
+// truncated output being continued if any
+func (m *taskManager) addAgentOutput(s *taskSession, output string) {
+	m.mu.Lock()
+	continuing := s.continuing
+	m.mu.Unlock()
+	stitched := continuing && s.history.Stitch("agent", func(content string) string {
+		return assistantmessage.StitchContinuation(content, output)
+	})
+	if !stitched {
+		m.add(s, HistoryEntry{Timestamp: time.Now(), Type: "agent", Content: output})
+		return
+	}
+	m.onUpdate(s)
+}
+
+// previewToolUse adds the preview of a tool use being streamed to the history of a session,
+// or updates it if the tool use was already previewed
+func (m *taskManager) previewToolUse(s *taskSession, toolUse assistantmessage.ToolUse) {
+	content := formatToolPreview(toolUse)
+	m.mu.Lock()
+	previewing := s.previewing
+	s.previewing = toolUse.Partial
+	if path := toolUse.Params[assistantmessage.PathParam]; path != "" && !toolUse.Partial {
+		if mark := fileMarkOf(toolUse); mark > s.files[path] {
+			if s.files == nil {
+				s.files = make(map[string]fileMark)
+			}
+			s.files[path] = mark
+		}
+	}
+	m.mu.Unlock()
+	if previewing && s.history.Stitch("tool", func(string) string { return content }) {
+		m.onUpdate(s)
+		return
+	}
+	m.add(s, HistoryEntry{Timestamp: time.Now(), Type: "tool", Content: content})
+}
+
+// fileMarks returns a copy of the marks of the files the agent of a session read or edited
+func (m *taskManager) fileMarks(s *taskSession) map[string]fileMark {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(s.files)
+}
+
+// askQuestion shows a question of the AI in the history of a session and waits for the user to answer it
+func (m *taskManager) askQuestion(ctx context.Context, s *taskSession, question string, options []string) (string, error) {
+	q := &pendingQuestion{options: options, answer: make(chan string, 1), selected: -1}
+	m.mu.Lock()
+	s.question = q
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if s.question == q {
+			s.question = nil
+		}
+		m.mu.Unlock()
+	}()
+
+	m.add(s, HistoryEntry{Timestamp: time.Now(), Type: "question", Content: formatQuestion(question, options)})
+	m.setStatus(s, taskStatusWaitingForAnswer)
+	defer m.setStatus(s, taskStatusRunning)
+	m.notify(s, notify.EventInputNeeded, question)
+	select {
+	case answer := <-q.answer:
+		return answer, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// answerQuestion answers the question the shown task waits for with input, the number of an
+// option picking it. It reports whether there was a question to answer.
+func (m *taskManager) answerQuestion(input string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == nil || m.current.question == nil {
+		return false
+	}
+	q := m.current.question
+	m.current.question = nil
+	if n, err := strconv.Atoi(strings.TrimSpace(input)); err == nil && n >= 1 && n <= len(q.options) {
+		input = q.options[n-1]
+	}
+	q.answer <- input
+	return true
+}
+
+// selectOption selects the next option, or the previous one if delta is negative, of the
+// question the shown task waits for and returns it. It reports false if there is no option.
+func (m *taskManager) selectOption(delta int) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == nil || m.current.question == nil || len(m.current.question.options) == 0 {
+		return "", false
+	}
+	q := m.current.question
+	n := len(q.options)
+	switch {
+	case q.selected < 0 && delta < 0:
+		q.selected = n - 1
+	case q.selected < 0:
+		q.selected = 0
+	case delta < 0:
+		q.selected = (q.selected + n - 1) % n
+	default:
+		q.selected = (q.selected + 1) % n
+	}
+	return q.options[q.selected], true
+}
+
+// add adds an entry to the history of a session
+func (m *taskManager) add(s *taskSession, entry HistoryEntry) {
+	m.mu.Lock()
+	s.history.Add(entry)
+	if s != m.current {
+		s.unread++
+	}
+	m.mu.Unlock()
+	m.onUpdate(s)
+}
+
+// attach attaches an image to the next message of the shown task, showing its placeholder in
+// the history
+func (m *taskManager) attach(attachment images.Attachment) error {
+	s := m.shown()
+	if s == nil {
+		return errors.New("no active task")
+	}
+	m.mu.Lock()
+	s.attachments = append(s.attachments, attachment)
+	m.mu.Unlock()
+	m.add(s, HistoryEntry{Timestamp: time.Now(), Type: "user", Content: attachment.Placeholder()})
+	return nil
+}
+
+// detach drops the images attached to the next message of the shown task and returns them
+func (m *taskManager) detach() []images.Attachment {
+	s := m.shown()
+	if s == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attachments := s.attachments
+	s.attachments = nil
+	return attachments
+}
+
+// setModel sets the provider and the model of a session
+func (m *taskManager) setModel(s *taskSession, choice ModelChoice) {
+	m.mu.Lock()
+	s.info.Provider = choice.Provider
+	s.info.Engine = choice.Model
+	m.mu.Unlock()
+	m.onUpdate(s)
+}
+
+// setLanguage sets the response language of a session
+func (m *taskManager) setLanguage(s *taskSession, language string) {
+	m.mu.Lock()
+	s.info.Language = language
+	m.mu.Unlock()
+	m.onUpdate(s)
+}
+
+// setGeneration sets the sampling settings of a session
+func (m *taskManager) setGeneration(s *taskSession, opts provider.GenerationOptions) {
+	m.mu.Lock()
+	s.info.Generation = opts
+	m.mu.Unlock()
+	m.onUpdate(s)
+}
+
+// setStatus sets the status of a session, and notifies the user when a tool use starts
+// waiting for their approval
+func (m *taskManager) setStatus(s *taskSession, status string) {
+	m.mu.Lock()
+	previous := s.info.Status
+	s.info.Status = status
+	m.mu.Unlock()
+	m.onUpdate(s)
+	if status == TaskStatusWaitingForApproval && previous != status {
+		m.notify(s, notify.EventApprovalNeeded, "")
+	}
+}
+
+// notify sends a notification about a session in the background
+func (m *taskManager) notify(s *taskSession, event notify.Event, message string) {
+	if !m.notifier.Enabled(event) {
+		return
+	}
+	n := notify.Notification{Event: event, TaskID: m.info(s).ID, Message: message}
+	m.notifying.Add(1)
+	go func() {
+		defer m.notifying.Done()
+		m.notifier.Notify(context.Background(), n)
+	}()
+}
+
+// shown returns the shown session
+func (m *taskManager) shown() *taskSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// isShown reports whether a session is the shown one
+func (m *taskManager) isShown(s *taskSession) bool {
+	return m.shown() == s
+}
+
+// info returns a copy of the information of a session
+func (m *taskManager) info(s *taskSession) TaskInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return s.info
+}
+
+// switchTo shows the task with the ID, or the only task whose ID starts with it
+func (m *taskManager) switchTo(id string) (*taskSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []*taskSession
+	for _, s := range m.sessions {
+		if s.info.ID == id {
+			matches = []*taskSession{s}
+			break
+		}
+		if strings.HasPrefix(s.info.ID, id) {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no open task %s", id)
+	case 1:
+		m.current = matches[0]
+		m.current.unread = 0
+		return m.current, nil
+	default:
+		return nil, fmt.Errorf("%d open tasks start with %s, give more of the ID", len(matches), id)
+	}
+}
+
+// next shows the task after the shown one, wrapping around
+func (m *taskManager) next() *taskSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s == m.current {
+			m.current = m.sessions[(i+1)%len(m.sessions)]
+			break
+		}
+	}
+	if m.current != nil {
+		m.current.unread = 0
+	}
+	return m.current
+}
+
+// summaries describes the open tasks in the order they were opened
+func (m *taskManager) summaries() []TaskSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summaries := make([]TaskSummary, len(m.sessions))
+	for i, s := range m.sessions {
+		summaries[i] = TaskSummary{ID: s.info.ID, Status: s.info.Status, Unread: s.unread, Current: s == m.current}
+	}
+	return summaries
+}
+
+// busy reports whether an agent loop has messages to run, other than one waiting for the
+// answer of the user
+func (m *taskManager) busy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.pending > 0 && s.question == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// close stops the agent loops and waits for them to return and for the notifications to be sent
+func (m *taskManager) close() {
+	m.cancel()
+	m.wg.Wait()
+	m.notifying.Wait()
+}
+
+// sessionWriter writes the history of a session, whether it is shown or not
+type sessionWriter struct {
+	manager *taskManager
+	session *taskSession
+	// images are attached to the message being run
+	images []provider.Image
+}
+
+func (w *sessionWriter) AddUserInput(input string) {
+	w.manager.add(w.session, HistoryEntry{Timestamp: time.Now(), Type: "user", Content: input})
+}
+
+func (w *sessionWriter) AddAgentOutput(output string) {
+	w.manager.addAgentOutput(w.session, output)
+}
+
+func (w *sessionWriter) AddSystemMessage(message string) {
+	w.manager.add(w.session, HistoryEntry{Timestamp: time.Now(), Type: "system", Content: message})
+}
+
+// ResponseLanguage returns the response language of the session
+func (w *sessionWriter) ResponseLanguage() string {
+	return w.manager.info(w.session).Language
+}
+
+// Model returns the model of the session
+func (w *sessionWriter) Model() ModelChoice {
+	info := w.manager.info(w.session)
+	return ModelChoice{Provider: info.Provider, Model: info.Engine}
+}
+
+// Images returns the images attached to the message being run
+func (w *sessionWriter) Images() []provider.Image {
+	return w.images
+}
+
+// Generation returns the sampling settings of the session
+func (w *sessionWriter) Generation() provider.GenerationOptions {
+	return w.manager.info(w.session).Generation
+}
+
+// ReportTruncation reports that the last agent output of the session looks truncated
+func (w *sessionWriter) ReportTruncation(reasons []string) {
+	w.manager.reportTruncation(w.session, reasons)
+}
+
+// AskQuestion puts a question of the AI to the user and waits for the answer
+func (w *sessionWriter) AskQuestion(ctx context.Context, question string, options []string) (string, error) {
+	return w.manager.askQuestion(ctx, w.session, question, options)
+}
+
+// PreviewToolUse shows a tool use of the session while it is streamed
+func (w *sessionWriter) PreviewToolUse(toolUse assistantmessage.ToolUse) {
+	w.manager.previewToolUse(w.session, toolUse)
+}
+
+// SetStatus sets the status of the session until the runner returns
+func (w *sessionWriter) SetStatus(status string) {
+	w.manager.setStatus(w.session, status)
+}
+
+// ReportThrottle shows that a request of the session waits for the rate limits of the provider
+func (w *sessionWriter) ReportThrottle(wait time.Duration) {
+	if wait > 0 {
+		w.AddSystemMessage(fmt.Sprintf("Rate limit of the provider reached, waiting %s", wait.Round(time.Second)))
+	} else {
+		w.AddSystemMessage("Waiting for other requests to the provider to end")
+	}
+	w.manager.setStatus(w.session, taskStatusThrottled)
+}
+
+// ReportThrottleEnd shows that the throttled request of the session was sent
+func (w *sessionWriter) ReportThrottleEnd() {
+	w.manager.setStatus(w.session, taskStatusRunning)
+}
+
+// ReportOffline shows that a request of the session is queued until the provider can be reached
+func (w *sessionWriter) ReportOffline(err error) {
+	w.AddSystemMessage(fmt.Sprintf("Connection to the provider lost (%v), the request is sent again once it is back", err))
+	w.manager.setStatus(w.session, taskStatusOffline)
+}
+
+// ReportOnline shows that the queued request of the session was sent
+func (w *sessionWriter) ReportOnline() {
+	w.manager.setStatus(w.session, taskStatusRunning)
+}
+
+// formatTaskSummary formats a task as a row of the tasks overview
+func formatTaskSummary(summary TaskSummary) string {
+	marker := "  "
+	if summary.Current {
+		marker = "> "
+	}
+	row := fmt.Sprintf("%s%s [%s]", marker, summary.ID, summary.Status)
+	if summary.Unread > 0 {
+		row += fmt.Sprintf(" (%d new)", summary.Unread)
+	}
+	return row
+}
+
+// formatQuestion formats a question of the AI as a history entry, with its numbered options
+func formatQuestion(question string, options []string) string {
+	var b strings.Builder
+	b.WriteString(question)
+	for i, option := range options {
+		fmt.Fprintf(&b, "\n  %d. %s", i+1, option)
+	}
+	if len(options) > 0 {
+		b.WriteString("\nEnter the number of an option, select one with Up and Down, or type your own answer.")
+	} else {
+		b.WriteString("\nType your answer.")
+	}
+	return b.String()
+}
+
+// formatToolPreview formats a tool use as a history entry: its name and path, then its content,
+// diff or command. Only the last lines of the content are shown while it is streamed.
+func formatToolPreview(toolUse assistantmessage.ToolUse) string {
+	var b strings.Builder
+	b.WriteString(string(toolUse.Name))
+	if path := toolUse.Params[assistantmessage.PathParam]; path != "" {
+		b.WriteString(" " + path)
+	}
+	for _, param := range []assistantmessage.ToolParamName{assistantmessage.ContentParam, assistantmessage.DiffParam, assistantmessage.CommandParam} {
+		value, ok := toolUse.Params[param]
+		if !ok {
+			continue
+		}
+		lines := strings.Split(value, "\n")
+		switch {
+		case toolUse.Partial:
+			b.WriteString(" (streaming...)")
+			if len(lines) > toolPreviewLines {
+				fmt.Fprintf(&b, "\n... %d lines above", len(lines)-toolPreviewLines)
+				lines = lines[len(lines)-toolPreviewLines:]
+			}
+			b.WriteString("\n" + strings.Join(lines, "\n"))
+		case param == assistantmessage.CommandParam:
+			b.WriteString("\n" + value)
+		default:
+			// Once complete, the content is only summarized, it is in the file
+			if len(lines) == 1 {
+				b.WriteString(" (1 line)")
+			} else {
+				fmt.Fprintf(&b, " (%d lines)", len(lines))
+			}
+		}
+		return b.String()
+	}
+	if toolUse.Partial {
+		b.WriteString(" (streaming...)")
+	}
+	return b.String()
+}
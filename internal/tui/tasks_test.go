@@ -0,0 +1,345 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	assistantmessage "github.com/kazz187/goline/internal/core/assistant-message"
+	"github.com/kazz187/goline/internal/notify"
+)
+
+func TestTaskManagerSwitch(t *testing.T) {
+	m := newTaskManager(nil, nil)
+	defer m.close()
+
+	first := m.open(TaskInfo{ID: "20250101-120000-aaaa"})
+	second := m.open(TaskInfo{ID: "20250101-130000-bbbb"})
+	if !m.isShown(first) {
+		t.Fatal("the first task opened is not shown")
+	}
+
+	// Entries added to a hidden task are counted as unread
+	(&sessionWriter{manager: m, session: second}).AddAgentOutput("done")
+	summaries := m.summaries()
+	if len(summaries) != 2 || !summaries[0].Current || summaries[1].Unread != 2 {
+		t.Errorf("summaries() = %+v", summaries)
+	}
+
+	if _, err := m.switchTo("20250101"); err == nil {
+		t.Error("switchTo() with an ambiguous prefix succeeded")
+	}
+	if _, err := m.switchTo("nope"); err == nil {
+		t.Error("switchTo() with an unknown ID succeeded")
+	}
+	s, err := m.switchTo("20250101-13")
+	if err != nil || s != second {
+		t.Fatalf("switchTo() = %v, %v", s, err)
+	}
+	if got := m.summaries()[1]; !got.Current || got.Unread != 0 {
+		t.Errorf("shown task summary = %+v", got)
+	}
+	if second.history.Len() != 2 || first.history.Len() != 1 {
+		t.Errorf("histories have %d and %d entries, want them kept apart", first.history.Len(), second.history.Len())
+	}
+
+	// next wraps around
+	if s := m.next(); s != first {
+		t.Errorf("next() = %v, want the first task", s)
+	}
+}
+
+func TestTaskManagerLoops(t *testing.T) {
+	runs := make(chan string)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		out.AddAgentOutput("answer to " + message)
+		runs <- taskID + ": " + message
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+
+	first := m.open(TaskInfo{ID: "first"})
+	second := m.open(TaskInfo{ID: "second"})
+	if err := m.submit("hello"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	if _, err := m.switchTo("second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.submit("bye"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case run := <-runs:
+			got[run] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("the agent loops did not run the messages")
+		}
+	}
+	if !got["first: hello"] || !got["second: bye"] {
+		t.Errorf("runs = %v", got)
+	}
+	if first.history.Len() != 2 || second.history.Len() != 2 {
+		t.Errorf("histories have %d and %d entries, want the answers in their own task", first.history.Len(), second.history.Len())
+	}
+}
+
+func TestTaskManagerRecoversPanics(t *testing.T) {
+	runs := make(chan string, 2)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		runs <- message
+		if message == "crash" {
+			panic("boom")
+		}
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+	s := m.open(TaskInfo{ID: "task"})
+
+	for _, message := range []string{"crash", "again"} {
+		if err := m.submit(message); err != nil {
+			t.Fatalf("submit() error = %v", err)
+		}
+	}
+	for range 2 {
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the agent loop stopped after the panic")
+		}
+	}
+	if !slices.ContainsFunc(s.history.Entries(), func(e HistoryEntry) bool { return e.Content == "Error: the task crashed: boom" }) {
+		t.Errorf("history = %+v, want the panic reported", s.history.Entries())
+	}
+}
+
+func TestTaskManagerLanguage(t *testing.T) {
+	languages := make(chan string)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		languages <- out.(TaskSettings).ResponseLanguage()
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+
+	s := m.open(TaskInfo{ID: "task", Language: "en"})
+	m.setLanguage(s, "ja")
+	if err := m.submit("hello"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	select {
+	case got := <-languages:
+		if got != "ja" {
+			t.Errorf("ResponseLanguage() = %q, want the language set for the task", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the agent loop did not run the message")
+	}
+}
+
+func TestTaskManagerContinuesTruncatedResponse(t *testing.T) {
+	runs := make(chan string)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		if message == assistantmessage.ContinuationPrompt {
+			out.AddAgentOutput("ne()\n}")
+		} else {
+			out.AddAgentOutput("func f() {\n\tdo")
+			out.(TruncationReporter).ReportTruncation([]string{"the response reached the output token limit"})
+		}
+		runs <- message
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+
+	s := m.open(TaskInfo{ID: "task"})
+	if err := m.continueResponse(); err == nil {
+		t.Error("continueResponse() succeeded before a truncated response")
+	}
+	wait := func() {
+		t.Helper()
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the agent loop did not run the message")
+		}
+	}
+	if err := m.submit("write f"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	wait()
+	if err := m.continueResponse(); err != nil {
+		t.Fatalf("continueResponse() error = %v", err)
+	}
+	wait()
+
+	// Task started, the stitched response and the truncation notice
+	if s.history.Len() != 3 {
+		t.Fatalf("history has %d entries, want the continuation stitched to the response", s.history.Len())
+	}
+	if got := s.history.records[1].entry.Content; got != "func f() {\n\tdone()\n}" {
+		t.Errorf("agent output = %q", got)
+	}
+	if err := m.continueResponse(); err == nil {
+		t.Error("continueResponse() succeeded twice for one truncated response")
+	}
+}
+
+func TestTaskManagerPreviewsToolUses(t *testing.T) {
+	done := make(chan struct{})
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		previewer := out.(ToolUsePreviewer)
+		toolUse := assistantmessage.NewToolUse(assistantmessage.WriteToFileToolName, true)
+		toolUse.Params[assistantmessage.PathParam] = "a.txt"
+		toolUse.Params[assistantmessage.ContentParam] = "one"
+		previewer.PreviewToolUse(toolUse)
+		toolUse.Params = map[assistantmessage.ToolParamName]string{assistantmessage.PathParam: "a.txt", assistantmessage.ContentParam: "one\ntwo"}
+		previewer.PreviewToolUse(toolUse)
+		toolUse.Partial = false
+		previewer.PreviewToolUse(toolUse)
+
+		// A new tool use gets its own entry
+		command := assistantmessage.NewToolUse(assistantmessage.ExecuteCommandToolName, false)
+		command.Params[assistantmessage.CommandParam] = "go test ./..."
+		previewer.PreviewToolUse(command)
+		close(done)
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+
+	s := m.open(TaskInfo{ID: "task"})
+	if err := m.submit("write a.txt"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the agent loop did not run the message")
+	}
+
+	entries := s.history.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("history = %+v, want the task start and one entry per tool use", entries)
+	}
+	if got := entries[1].Content; got != "write_to_file a.txt (2 lines)" {
+		t.Errorf("write_to_file entry = %q", got)
+	}
+	if got := entries[2].Content; got != "execute_command\ngo test ./..." {
+		t.Errorf("execute_command entry = %q", got)
+	}
+}
+
+func TestTaskManagerAnswersQuestions(t *testing.T) {
+	answers := make(chan string)
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		answer, err := out.(QuestionAsker).AskQuestion(ctx, "Which one?", []string{"red", "blue"})
+		if err != nil {
+			return err
+		}
+		answers <- answer
+		return nil
+	}
+	m := newTaskManager(runner, nil)
+	defer m.close()
+	s := m.open(TaskInfo{ID: "task"})
+
+	if m.answerQuestion("red") {
+		t.Error("answerQuestion() succeeded without a question")
+	}
+	for _, tt := range []struct{ input, want string }{{"2", "blue"}, {"green", "green"}, {"3", "3"}} {
+		if err := m.submit("pick"); err != nil {
+			t.Fatalf("submit() error = %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for m.info(s).Status != taskStatusWaitingForAnswer {
+			if time.Now().After(deadline) {
+				t.Fatal("the question was not asked")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if option, ok := m.selectOption(-1); !ok || option != "blue" {
+			t.Errorf("selectOption(-1) = %q, %v, want the last option", option, ok)
+		}
+		if !m.answerQuestion(tt.input) {
+			t.Fatalf("answerQuestion(%q) found no question", tt.input)
+		}
+		if got := <-answers; got != tt.want {
+			t.Errorf("answer to %q = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatToolPreview(t *testing.T) {
+	toolUse := assistantmessage.NewToolUse(assistantmessage.WriteToFileToolName, true)
+	toolUse.Params[assistantmessage.PathParam] = "big.txt"
+	toolUse.Params[assistantmessage.ContentParam] = strings.Repeat("line\n", 12) + "last"
+	got := formatToolPreview(toolUse)
+	if !strings.HasPrefix(got, "write_to_file big.txt (streaming...)\n... 3 lines above\nline\n") || !strings.HasSuffix(got, "\nlast") {
+		t.Errorf("formatToolPreview() = %q, want the last lines of the content", got)
+	}
+
+	if got := formatToolPreview(assistantmessage.NewToolUse(assistantmessage.ReadFileToolName, true)); got != "read_file (streaming...)" {
+		t.Errorf("formatToolPreview() = %q", got)
+	}
+}
+
+func TestFormatTaskSummary(t *testing.T) {
+	got := formatTaskSummary(TaskSummary{ID: "task-1", Status: taskStatusRunning, Unread: 3})
+	if got != "  task-1 [Running] (3 new)" {
+		t.Errorf("formatTaskSummary() = %q", got)
+	}
+	if got := formatTaskSummary(TaskSummary{ID: "task-2", Status: taskStatusActive, Current: true}); !strings.HasPrefix(got, "> task-2") {
+		t.Errorf("formatTaskSummary() = %q", got)
+	}
+}
+
+// notificationRecorder records the events of the notifications it is sent
+type notificationRecorder chan notify.Event
+
+func (r notificationRecorder) Notify(ctx context.Context, n notify.Notification) error {
+	r <- n.Event
+	return nil
+}
+
+func TestTaskManagerNotifies(t *testing.T) {
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		if message == "fail" {
+			return errors.New("boom")
+		}
+		out.(StatusReporter).SetStatus(TaskStatusWaitingForApproval)
+		return nil
+	}
+	events := make(notificationRecorder, 8)
+	m := newTaskManager(runner, nil)
+	m.notifier = notify.NewDispatcher([]notify.Notifier{events}, nil)
+	m.open(TaskInfo{ID: "task-1"})
+
+	for _, message := range []string{"hello", "fail"} {
+		if err := m.submit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []notify.Event
+	for range 3 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notifications = %v, want 3", got)
+		}
+	}
+	m.close()
+	slices.Sort(got)
+	if want := []notify.Event{notify.EventApprovalNeeded, notify.EventCompleted, notify.EventError}; !slices.Equal(got, want) {
+		t.Errorf("notifications = %v, want %v", got, want)
+	}
+}
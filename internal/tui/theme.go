@@ -0,0 +1,304 @@
+package tui
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	ui "github.com/gizak/termui/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Theme presets
+const (
+	// ThemeDark is the default theme, for terminals with a dark background
+	ThemeDark = "dark"
+	// ThemeLight is the theme for terminals with a light background
+	ThemeLight = "light"
+)
+
+// Border styles of the panes
+const (
+	BorderSingle = "single"
+	BorderBold   = "bold"
+	BorderNone   = "none"
+)
+
+// themeReloadDebounce is how long the theme file must be left unchanged before it is loaded
+// again, editors write a file in several steps
+const themeReloadDebounce = 100 * time.Millisecond
+
+// Theme is the color scheme of the TUI. Colors are names, such as cyan or default, or numbers
+// of the 256 color palette.
+type Theme struct {
+	// Preset is the theme the file overrides, dark if empty. It is only read from theme files.
+	Preset string `yaml:"preset,omitempty"`
+	// Border is how the panes are framed: single, bold or none
+	Border string `yaml:"border,omitempty"`
+	// Text is the color of the text of the panes
+	Text string `yaml:"text,omitempty"`
+	// Title is the color of the titles of the panes, that of their border if empty
+	Title string `yaml:"title,omitempty"`
+	// SelectedText and SelectedBackground are the colors of the rows selected in the file tree
+	SelectedText       string `yaml:"selected_text,omitempty"`
+	SelectedBackground string `yaml:"selected_background,omitempty"`
+	// The colors of the borders of the panes
+	TaskInfoBorder string `yaml:"task_info_border,omitempty"`
+	HistoryBorder  string `yaml:"history_border,omitempty"`
+	TasksBorder    string `yaml:"tasks_border,omitempty"`
+	FilesBorder    string `yaml:"files_border,omitempty"`
+	InputBorder    string `yaml:"input_border,omitempty"`
+}
+
+// themePresets are the built-in themes
+var themePresets = map[string]Theme{
+	ThemeDark: {
+		Border:             BorderSingle,
+		Text:               "white",
+		SelectedText:       "black",
+		SelectedBackground: "blue",
+		TaskInfoBorder:     "yellow",
+		HistoryBorder:      "cyan",
+		TasksBorder:        "magenta",
+		FilesBorder:        "blue",
+		InputBorder:        "green",
+	},
+	ThemeLight: {
+		Border:             BorderSingle,
+		Text:               "black",
+		SelectedText:       "white",
+		SelectedBackground: "blue",
+		TaskInfoBorder:     "94",
+		HistoryBorder:      "24",
+		TasksBorder:        "90",
+		FilesBorder:        "blue",
+		InputBorder:        "28",
+	},
+}
+
+// ThemePresets returns the names of the built-in themes
+func ThemePresets() []string {
+	return []string{ThemeDark, ThemeLight}
+}
+
+// LoadTheme returns a preset, dark if empty, with the colors set in the theme file if any
+func LoadTheme(preset, file string) (Theme, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return Theme{}, fmt.Errorf("failed to read theme file: %w", err)
+		}
+		var custom Theme
+		if err := yaml.Unmarshal(data, &custom); err != nil {
+			return Theme{}, fmt.Errorf("failed to parse theme file %s: %w", file, err)
+		}
+		if custom.Preset != "" {
+			preset = custom.Preset
+		}
+		theme, err := presetTheme(preset)
+		if err != nil {
+			return Theme{}, err
+		}
+		theme = theme.merge(custom)
+		if err := theme.validate(); err != nil {
+			return Theme{}, fmt.Errorf("invalid theme file %s: %w", file, err)
+		}
+		return theme, nil
+	}
+	return presetTheme(preset)
+}
+
+// presetTheme returns a built-in theme, dark if the name is empty
+func presetTheme(name string) (Theme, error) {
+	if name == "" {
+		name = ThemeDark
+	}
+	theme, ok := themePresets[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemePresets(), ", "))
+	}
+	return theme, nil
+}
+
+// merge returns the theme with the colors set in custom
+func (t Theme) merge(custom Theme) Theme {
+	for _, field := range []struct{ dst, src *string }{
+		{&t.Border, &custom.Border},
+		{&t.Text, &custom.Text},
+		{&t.Title, &custom.Title},
+		{&t.SelectedText, &custom.SelectedText},
+		{&t.SelectedBackground, &custom.SelectedBackground},
+		{&t.TaskInfoBorder, &custom.TaskInfoBorder},
+		{&t.HistoryBorder, &custom.HistoryBorder},
+		{&t.TasksBorder, &custom.TasksBorder},
+		{&t.FilesBorder, &custom.FilesBorder},
+		{&t.InputBorder, &custom.InputBorder},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	t.Preset = ""
+	return t
+}
+
+// validate checks the border style and the colors of the theme
+func (t Theme) validate() error {
+	switch t.Border {
+	case BorderSingle, BorderBold, BorderNone:
+	default:
+		return fmt.Errorf("unknown border %q, expected %s, %s or %s", t.Border, BorderSingle, BorderBold, BorderNone)
+	}
+	for _, color := range []string{t.Text, t.Title, t.SelectedText, t.SelectedBackground, t.TaskInfoBorder, t.HistoryBorder, t.TasksBorder, t.FilesBorder, t.InputBorder} {
+		if _, err := parseColor(color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colorNames are the names of the colors of the terminal
+var colorNames = map[string]ui.Color{
+	"default": ui.ColorClear,
+	"black":   ui.ColorBlack,
+	"red":     ui.ColorRed,
+	"green":   ui.ColorGreen,
+	"yellow":  ui.ColorYellow,
+	"blue":    ui.ColorBlue,
+	"magenta": ui.ColorMagenta,
+	"cyan":    ui.ColorCyan,
+	"white":   ui.ColorWhite,
+}
+
+// parseColor parses the name of a color or its number in the 256 color palette, the default
+// color if empty
+func parseColor(s string) (ui.Color, error) {
+	if s == "" {
+		return ui.ColorClear, nil
+	}
+	if color, ok := colorNames[strings.ToLower(s)]; ok {
+		return color, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return ui.ColorClear, fmt.Errorf("invalid color %q, expected a name such as cyan or a number from 0 to 255", s)
+	}
+	return ui.Color(n), nil
+}
+
+// color returns a color of a validated theme
+func color(s string) ui.Color {
+	c, _ := parseColor(s)
+	return c
+}
+
+// apply sets the colors and borders of the theme on the panes
+func (gu *ReplUI) apply(theme Theme) {
+	text := ui.NewStyle(color(theme.Text))
+	modifier := ui.ModifierClear
+	if theme.Border == BorderBold {
+		modifier = ui.ModifierBold
+	}
+	for _, pane := range []struct {
+		block  *ui.Block
+		border string
+	}{
+		{&gu.taskInfo.Widget.Block, theme.TaskInfoBorder},
+		{&gu.historyList.Widget.Block, theme.HistoryBorder},
+		{&gu.tasksList.Widget.Block, theme.TasksBorder},
+		{&gu.fileTree.Widget.Block, theme.FilesBorder},
+		{&gu.repl.Widget.Block, theme.InputBorder},
+	} {
+		pane.block.Border = theme.Border != BorderNone
+		pane.block.BorderStyle = ui.NewStyle(color(pane.border), ui.ColorClear, modifier)
+		title := pane.border
+		if theme.Title != "" {
+			title = theme.Title
+		}
+		pane.block.TitleStyle = ui.NewStyle(color(title), ui.ColorClear, modifier)
+	}
+	gu.taskInfo.Widget.TextStyle = text
+	gu.historyList.Widget.TextStyle = text
+	gu.tasksList.Widget.TextStyle = text
+	gu.tasksList.Widget.SelectedRowStyle = text
+	gu.fileTree.Widget.TextStyle = text
+	gu.repl.Widget.TextStyle = text
+	gu.selectedRowStyle = ui.NewStyle(color(theme.SelectedText), color(theme.SelectedBackground))
+}
+
+// Layout sets the proportions of the panes, the defaults for zero values
+type Layout struct {
+	// HistoryHeight is the share of the height of the terminal taken by the history, 0.7 by default
+	HistoryHeight float64
+	// TasksWidth is the share of the width taken by the tasks overview, 0.25 by default
+	TasksWidth float64
+	// FileTreeWidth is the share of the width taken by the file tree when shown, 0.2 by default
+	FileTreeWidth float64
+}
+
+// withDefaults returns the layout with the default proportions for the unset or invalid ones
+func (l Layout) withDefaults() Layout {
+	if l.HistoryHeight <= 0 || l.HistoryHeight >= 0.95 {
+		l.HistoryHeight = 0.7
+	}
+	if l.TasksWidth <= 0 || l.TasksWidth >= 0.8 {
+		l.TasksWidth = 0.25
+	}
+	if l.FileTreeWidth <= 0 || l.TasksWidth+l.FileTreeWidth >= 0.9 {
+		l.FileTreeWidth = min(0.2, 0.9-l.TasksWidth)
+	}
+	return l
+}
+
+// watchTheme calls reload with the theme loaded again each time the theme file changes, or
+// with the error loading it. The directory of the file is watched, editors often replace files.
+func watchTheme(preset, file string, reload func(Theme, error)) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch theme file: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					if timer != nil {
+						timer.Stop()
+					}
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(file) || event.Op == fsnotify.Chmod {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(themeReloadDebounce, func() {
+					reload(LoadTheme(preset, file))
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Theme file watcher error", "error", err)
+			}
+		}
+	}()
+	return func() {
+		watcher.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+func TestLoadTheme(t *testing.T) {
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatalf("LoadTheme() error = %v", err)
+	}
+	if theme != themePresets[ThemeDark] {
+		t.Errorf("the default theme should be the dark preset, got %+v", theme)
+	}
+	if _, err := LoadTheme("solarized", ""); err == nil {
+		t.Error("an unknown preset should be rejected")
+	}
+
+	file := filepath.Join(t.TempDir(), "theme.yaml")
+	if err := os.WriteFile(file, []byte("preset: light\nborder: bold\nhistory_border: 208\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	theme, err = LoadTheme(ThemeDark, file)
+	if err != nil {
+		t.Fatalf("LoadTheme() error = %v", err)
+	}
+	if theme.Border != BorderBold || theme.HistoryBorder != "208" {
+		t.Errorf("the file should override the preset, got %+v", theme)
+	}
+	if theme.Text != themePresets[ThemeLight].Text {
+		t.Errorf("the preset of the file should be used, got %+v", theme)
+	}
+
+	for _, content := range []string{"text: purple\n", "border: dotted\n", "input_border: 256\n"} {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTheme("", file); err == nil {
+			t.Errorf("LoadTheme() with %q should fail", content)
+		}
+	}
+}
+
+func TestApplyTheme(t *testing.T) {
+	gu := NewReplUI()
+	gu.apply(Theme{Border: BorderNone, Text: "black", Title: "red", HistoryBorder: "cyan", SelectedBackground: "yellow"})
+	if gu.historyList.Widget.Border {
+		t.Error("the panes should have no border")
+	}
+	if gu.historyList.Widget.BorderStyle.Fg != ui.ColorCyan || gu.historyList.Widget.TitleStyle.Fg != ui.ColorRed {
+		t.Errorf("unexpected history styles %+v %+v", gu.historyList.Widget.BorderStyle, gu.historyList.Widget.TitleStyle)
+	}
+	if gu.repl.Widget.TextStyle.Fg != ui.ColorBlack || gu.selectedRowStyle.Bg != ui.ColorYellow {
+		t.Error("the text and selection colors should be applied")
+	}
+}
+
+func TestLayoutDefaults(t *testing.T) {
+	if got := (Layout{}).withDefaults(); got != (Layout{HistoryHeight: 0.7, TasksWidth: 0.25, FileTreeWidth: 0.2}) {
+		t.Errorf("unexpected default layout %+v", got)
+	}
+	if got := (Layout{HistoryHeight: 0.5, TasksWidth: 0.3, FileTreeWidth: 0.7}).withDefaults(); got.HistoryHeight != 0.5 || got.TasksWidth != 0.3 || got.FileTreeWidth != 0.2 {
+		t.Errorf("only the invalid proportions should be replaced, got %+v", got)
+	}
+}
+
+func TestWatchTheme(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "theme.yaml")
+	if err := os.WriteFile(file, []byte("text: white\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		theme Theme
+		err   error
+	}
+	reloaded := make(chan result, 4)
+	stop, err := watchTheme("", file, func(theme Theme, err error) {
+		reloaded <- result{theme, err}
+	})
+	if err != nil {
+		t.Fatalf("watchTheme() error = %v", err)
+	}
+	defer stop()
+
+	if err := os.WriteFile(file, []byte("text: 123\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-reloaded:
+		if r.err != nil || r.theme.Text != "123" {
+			t.Errorf("reloaded theme = %+v, %v", r.theme, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the theme was not reloaded")
+	}
+
+	if err := os.WriteFile(file, []byte("text: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-reloaded:
+		if r.err == nil || !strings.Contains(r.err.Error(), "theme file") {
+			t.Errorf("a broken theme file should be reported, got %v", r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the broken theme was not reported")
+	}
+}
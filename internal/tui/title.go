@@ -0,0 +1,102 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kazz187/goline/internal/core/stdin"
+)
+
+// maxTitleSummary limits the length of the task summary in the terminal title
+const maxTitleSummary = 50
+
+// Control sequences of the terminal title, supported by xterm and most terminals.
+// The title is pushed on the terminal's title stack when a session starts and popped on exit,
+// as the current title cannot be read back.
+const (
+	titlePush = "\x1b[22;0t"
+	titlePop  = "\x1b[23;0t"
+	titleSet  = "\x1b]0;%s\a"
+)
+
+// terminalTitle shows the task and its status in the title of the terminal, so a tab waiting
+// for the user can be found among many
+type terminalTitle struct {
+	mu    sync.Mutex
+	out   io.Writer
+	title string
+}
+
+// newTerminalTitle saves the title of the terminal written to by out.
+// It returns nil, which sets nothing, when out is not a terminal.
+func newTerminalTitle(out *os.File) *terminalTitle {
+	if stdin.Piped(out) {
+		return nil
+	}
+	return startTerminalTitle(out)
+}
+
+// startTerminalTitle saves the title of the terminal and returns a title writing to out
+func startTerminalTitle(out io.Writer) *terminalTitle {
+	fmt.Fprint(out, titlePush)
+	return &terminalTitle{out: out}
+}
+
+// set sets the title of the terminal if it changed
+func (t *terminalTitle) set(title string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	title = sanitizeTitle(title)
+	if title == t.title {
+		return
+	}
+	t.title = title
+	fmt.Fprintf(t.out, titleSet, title)
+}
+
+// restore restores the title the terminal had before the session
+func (t *terminalTitle) restore() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprint(t.out, titlePop)
+}
+
+// formatTitle formats the terminal title of a task: "goline: <task summary> — <status>"
+func formatTitle(info TaskInfo) string {
+	summary := info.Summary
+	if summary == "" {
+		summary = info.ID
+	}
+	if runes := []rune(summary); len(runes) > maxTitleSummary {
+		summary = string(runes[:maxTitleSummary-3]) + "..."
+	}
+	return fmt.Sprintf("goline: %s — %s", summary, info.Status)
+}
+
+// summarizeTask returns the first line of the first message of a task, to name the task in the title
+func summarizeTask(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return strings.TrimSpace(line)
+}
+
+// sanitizeTitle removes the control characters that would end the title sequence early
+func sanitizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, title)
+}
@@ -0,0 +1,69 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFormatTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		info TaskInfo
+		want string
+	}{
+		{"summary", TaskInfo{ID: "task-1", Summary: "Fix the login bug", Status: taskStatusRunning}, "goline: Fix the login bug — Running"},
+		{"no summary yet", TaskInfo{ID: "task-1", Status: taskStatusActive}, "goline: task-1 — Active"},
+		{"long summary", TaskInfo{Summary: strings.Repeat("a", 60), Status: TaskStatusWaitingForApproval}, "goline: " + strings.Repeat("a", 47) + "... — Waiting for approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTitle(tt.info); got != tt.want {
+				t.Errorf("formatTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalTitle(t *testing.T) {
+	var out strings.Builder
+	title := startTerminalTitle(&out)
+	title.set("goline: fix\x07 it — Running")
+	title.set("goline: fix it — Running")
+	title.restore()
+
+	if got, want := out.String(), titlePush+"\x1b]0;goline: fix it — Running\a"+titlePop; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// A nil title, used when the output is not a terminal, writes nothing
+	var none *terminalTitle
+	none.set("title")
+	none.restore()
+}
+
+func TestTaskStatusReported(t *testing.T) {
+	waiting := make(chan TaskInfo)
+	release := make(chan struct{})
+	runner := func(ctx context.Context, taskID, message string, out HistoryWriter) error {
+		out.(StatusReporter).SetStatus(TaskStatusWaitingForApproval)
+		<-release
+		return nil
+	}
+	var m *taskManager
+	m = newTaskManager(runner, func(s *taskSession) {
+		if info := m.info(s); info.Status == TaskStatusWaitingForApproval {
+			waiting <- info
+		}
+	})
+	defer m.close()
+
+	m.open(TaskInfo{ID: "task-1"})
+	if err := m.submit("Fix the login bug\nin auth.go"); err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	if info := <-waiting; info.Summary != "Fix the login bug" {
+		t.Errorf("summary = %q, want the first line of the first message", info.Summary)
+	}
+	close(release)
+}
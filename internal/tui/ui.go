@@ -3,27 +3,40 @@ package tui
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/abiosoft/ishell/v2"
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
+	"github.com/kazz187/goline/internal/core/prompts"
+	"github.com/kazz187/goline/internal/provider"
 	"github.com/mattn/go-runewidth"
 )
 
 // TaskInfo represents the information about a task
 type TaskInfo struct {
-	ID        string
-	Status    string
+	ID     string
+	Status string
+	// Summary is the first line of the first message of the task
+	Summary string
+	// Language is the language the AI answers in, that of the user if empty
+	Language  string
 	StartTime time.Time
 	Provider  string
 	Engine    string
+	// Generation are the sampling settings of the task, those of the provider if unset
+	Generation provider.GenerationOptions
+	// ReadOnly tells that the AI agent cannot modify the workspace
+	ReadOnly bool
 }
 
 // HistoryEntry represents an entry in the task history
 type HistoryEntry struct {
 	Timestamp time.Time
-	Type      string // "user", "agent", "system"
+	Type      string // "user", "agent", "system", "tool", "question"
 	Content   string
 }
 
@@ -41,33 +54,63 @@ type UI struct {
 	inputHandler InputHandlerInterface
 	termWidth    int
 	termHeight   int
+	// screen collects the panes to draw again and the overlays to open
+	screen *screen
+	// laidOut are the panes laid out, to lay them out again when one is shown or hidden
+	laidOut map[Pane]bool
+	// overlays are drawn over the panes, the last one on top gets the keys
+	overlays []Overlay
+	// quit is closed by Quit to stop Run
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 type ReplUI struct {
 	taskInfo    *Block[*widgets.Paragraph, *TaskInfo]
-	historyList *Block[*widgets.List, []HistoryEntry]
+	historyList *Block[*widgets.List, *historyView]
+	tasksList   *Block[*widgets.List, []TaskSummary]
+	fileTree    *Block[*widgets.List, *fileTree]
 	repl        *Block[*widgets.Paragraph, string]
+	// layout are the proportions of the panes
+	layout Layout
+	// selectedRowStyle is the style of the row selected in the focused file tree
+	selectedRowStyle ui.Style
 }
 
+// Block is a pane drawing its data with a termui widget
 type Block[T ui.Drawable, S any] struct {
-	Widget       T
-	data         S
-	updateSignal chan struct{}
+	Widget T
+	data   S
+	// screen is notified when the data changed, nil until the block is bound to the UI
+	screen    *screen
+	prerender func()
+	visible   func() bool
 }
 
 func NewBlock[T ui.Drawable, S any](widget T, data S) *Block[T, S] {
 	return &Block[T, S]{
-		Widget:       widget,
-		data:         data,
-		updateSignal: make(chan struct{}, 1),
+		Widget: widget,
+		data:   data,
 	}
 }
 
+// bind makes the UI draw the block again when it changed, with prerender updating the widget
+// from the data first. visible tells whether the block is laid out, always if nil.
+func (b *Block[T, S]) bind(s *screen, prerender func(), visible func() bool) {
+	b.screen = s
+	b.prerender = prerender
+	b.visible = visible
+}
+
 func (b *Block[T, S]) SetData(data S) {
 	b.data = data
-	select {
-	case b.updateSignal <- struct{}{}:
-	default:
+	b.Changed()
+}
+
+// Changed signals that the data was modified in place and the block must be rendered again
+func (b *Block[T, S]) Changed() {
+	if b.screen != nil {
+		b.screen.invalidate(b)
 	}
 }
 
@@ -75,45 +118,64 @@ func (b *Block[T, S]) GetData() S {
 	return b.data
 }
 
-func (b *Block[T, S]) UpdateSignal() <-chan struct{} {
-	return b.updateSignal
+// Drawable implements Pane
+func (b *Block[T, S]) Drawable() ui.Drawable {
+	return b.Widget
+}
+
+// Prerender implements Pane
+func (b *Block[T, S]) Prerender() {
+	if b.prerender != nil {
+		b.prerender()
+	}
 }
 
-func (b *Block[T, S]) Render() {
-	ui.Render(b.Widget)
+// Visible implements Pane
+func (b *Block[T, S]) Visible() bool {
+	return b.visible == nil || b.visible()
 }
 
 func NewReplUI() *ReplUI {
 	taskInfoData := &TaskInfo{
-		ID:        "task-123",
-		Status:    "Active",
+		Status:    taskStatusActive,
 		StartTime: time.Now(),
-		Provider:  "anthropic",
-		Engine:    "claude-3-opus",
 	}
 
 	taskInfo := widgets.NewParagraph()
 	taskInfo.Title = "Task Information"
-	taskInfo.BorderStyle.Fg = ui.ColorYellow
 	taskInfo.PaddingTop = 0
 	taskInfo.PaddingBottom = 0
 
 	historyList := widgets.NewList()
 	historyList.Title = "Task History"
-	historyList.BorderStyle.Fg = ui.ColorCyan
-	historyList.TextStyle = ui.NewStyle(ui.ColorWhite)
-	historyList.WrapText = true
+	// Rows are wrapped by the history view, which knows how many rows each entry takes
+	historyList.WrapText = false
+
+	tasksList := widgets.NewList()
+	tasksList.Title = "Tasks (Ctrl+T)"
+	tasksList.WrapText = false
+
+	fileTreeList := widgets.NewList()
+	fileTreeList.Title = "Files (Ctrl+B)"
+	fileTreeList.WrapText = false
+	workspace, err := os.Getwd()
+	if err != nil {
+		workspace = "."
+	}
 
 	repl := widgets.NewParagraph()
 	repl.Title = "Command Input"
-	repl.BorderStyle.Fg = ui.ColorGreen
 	repl.Text = ""
 
 	g := &ReplUI{
 		taskInfo:    NewBlock(taskInfo, taskInfoData),
-		historyList: NewBlock(historyList, []HistoryEntry{}),
+		historyList: NewBlock(historyList, newHistoryView()),
+		tasksList:   NewBlock(tasksList, []TaskSummary(nil)),
+		fileTree:    NewBlock(fileTreeList, newFileTree(workspace)),
 		repl:        NewBlock(repl, ""),
+		layout:      Layout{}.withDefaults(),
 	}
+	g.apply(themePresets[ThemeDark])
 	return g
 }
 
@@ -122,15 +184,23 @@ func (gu *ReplUI) Render(termWidth, termHeight int) {
 	grid.SetRect(0, 0, termWidth, termHeight)
 
 	taskInfoCol := ui.NewCol(1.0, gu.taskInfo.Widget)
-	historyListCol := ui.NewCol(1.0, gu.historyList.Widget)
+	historyListCol := ui.NewCol(1-gu.layout.TasksWidth, gu.historyList.Widget)
+	tasksListCol := ui.NewCol(gu.layout.TasksWidth, gu.tasksList.Widget)
 	replCol := ui.NewCol(1.0, gu.repl.Widget)
 
 	taskInfoHeight := float64(3) / float64(termHeight)
-	historyListHeight := 0.7
+	historyListHeight := gu.layout.HistoryHeight
 	replHeight := 1.0 - taskInfoHeight - historyListHeight
 
 	taskInfoRow := ui.NewRow(taskInfoHeight, taskInfoCol)
-	historyListRow := ui.NewRow(historyListHeight, historyListCol)
+	historyListRow := ui.NewRow(historyListHeight, historyListCol, tasksListCol)
+	if gu.fileTree.Visible() {
+		historyListRow = ui.NewRow(historyListHeight,
+			ui.NewCol(gu.layout.FileTreeWidth, gu.fileTree.Widget),
+			ui.NewCol(1-gu.layout.FileTreeWidth-gu.layout.TasksWidth, gu.historyList.Widget),
+			tasksListCol,
+		)
+	}
 	replRow := ui.NewRow(replHeight, replCol)
 
 	grid.Set(
@@ -147,14 +217,57 @@ func NewUI(shell *ishell.Shell, shellInput *bytes.Buffer) (*UI, error) {
 	shell.SetPrompt("")
 
 	if err := ui.Init(); err != nil {
-		return nil, fmt.Errorf("failed to initialize termui: %w", err)
+		return nil, fmt.Errorf("%w: failed to initialize termui: %v", ErrNoTerminal, err)
 	}
 
-	return &UI{
+	return newUI(shell, shellInput), nil
+}
+
+// newUI creates a TUI without initializing the terminal. Its widgets are updated but only
+// drawn by Run, so it can be driven headlessly.
+func newUI(shell *ishell.Shell, shellInput *bytes.Buffer) *UI {
+	u := &UI{
 		shell:      shell,
 		shellInput: shellInput,
 		replUI:     NewReplUI(),
-	}, nil
+		screen:     newScreen(),
+		laidOut:    make(map[Pane]bool),
+		quit:       make(chan struct{}),
+	}
+	u.replUI.taskInfo.bind(u.screen, u.prerenderTaskInfo, nil)
+	u.replUI.historyList.bind(u.screen, u.prerenderHistory, nil)
+	u.replUI.tasksList.bind(u.screen, u.prerenderTasks, nil)
+	u.replUI.fileTree.bind(u.screen, u.prerenderFileTree, u.replUI.fileTree.GetData().Visible)
+	u.replUI.repl.bind(u.screen, u.prerenderREPL, nil)
+	return u
+}
+
+// panes returns the panes of the UI
+func (u *UI) panes() []Pane {
+	return []Pane{u.replUI.taskInfo, u.replUI.historyList, u.replUI.tasksList, u.replUI.fileTree, u.replUI.repl}
+}
+
+// OpenOverlay draws an overlay over the panes, which gets the keys until it is done. It can be
+// called on any goroutine.
+func (u *UI) OpenOverlay(o Overlay) {
+	u.screen.open(o)
+}
+
+// CloseOverlay closes an overlay before it is done. It can be called on any goroutine.
+func (u *UI) CloseOverlay(o Overlay) {
+	u.screen.update(func() {
+		u.overlays = slices.DeleteFunc(u.overlays, func(open Overlay) bool { return open == o })
+	})
+}
+
+// SetLayout sets the proportions of the panes, before the UI runs
+func (u *UI) SetLayout(layout Layout) {
+	u.replUI.layout = layout.withDefaults()
+}
+
+// SetTheme applies a theme, before the UI runs or while it runs
+func (u *UI) SetTheme(theme Theme) {
+	u.screen.update(func() { u.replUI.apply(theme) })
 }
 
 // UpdateTaskInfo updates the task info widget
@@ -162,9 +275,64 @@ func (u *UI) UpdateTaskInfo(taskInfo *TaskInfo) {
 	u.replUI.taskInfo.SetData(taskInfo)
 }
 
-// AddHistoryEntry adds an entry to the history widget
-func (u *UI) AddHistoryEntry(entry HistoryEntry) {
-	u.replUI.historyList.SetData(append(u.replUI.historyList.GetData(), entry))
+// ShowHistory replaces the history shown by the history widget, e.g. when another task is shown
+func (u *UI) ShowHistory(history *historyView) {
+	u.replUI.historyList.SetData(history)
+}
+
+// HistoryChanged renders the history widget again after entries were added to the shown history
+func (u *UI) HistoryChanged() {
+	u.replUI.historyList.Changed()
+}
+
+// UpdateTasks updates the tasks overview widget
+func (u *UI) UpdateTasks(tasks []TaskSummary) {
+	u.replUI.tasksList.SetData(tasks)
+}
+
+// ScrollHistory scrolls the history widget up by delta rows, or down for a negative delta
+func (u *UI) ScrollHistory(delta int) {
+	u.replUI.historyList.GetData().Scroll(delta)
+	u.replUI.historyList.Changed()
+}
+
+// HistoryPageSize returns the number of rows scrolled by a page of the history widget
+func (u *UI) HistoryPageSize() int {
+	return max(1, u.replUI.historyList.Widget.Inner.Dy()-1)
+}
+
+// ExpandHistoryEntry shows the next page, or all pages, of a collapsed history entry
+func (u *UI) ExpandHistoryEntry(n int, all bool) error {
+	if err := u.replUI.historyList.GetData().Expand(n, all); err != nil {
+		return err
+	}
+	u.replUI.historyList.Changed()
+	return nil
+}
+
+// CollapseHistoryEntry shows only the first page of a history entry
+func (u *UI) CollapseHistoryEntry(n int) error {
+	if err := u.replUI.historyList.GetData().Collapse(n); err != nil {
+		return err
+	}
+	u.replUI.historyList.Changed()
+	return nil
+}
+
+// FileTree returns the file tree pane, updated with FileTreeChanged
+func (u *UI) FileTree() *fileTree {
+	return u.replUI.fileTree.GetData()
+}
+
+// FileTreeChanged renders the file tree pane again, and the layout if it was shown or hidden
+func (u *UI) FileTreeChanged() {
+	u.replUI.fileTree.Changed()
+}
+
+// UpdateFileMarks marks the files the agent of the shown task read or edited in the file tree
+func (u *UI) UpdateFileMarks(marks map[string]fileMark) {
+	u.replUI.fileTree.GetData().SetMarks(marks)
+	u.replUI.fileTree.Changed()
 }
 
 // UpdateREPLInput updates the REPL input widget
@@ -188,6 +356,12 @@ func (u *UI) prerenderTaskInfo() {
 		taskInfo.Provider,
 		taskInfo.Engine,
 	)
+	if taskInfo.Language != "" {
+		text += " | Language: " + prompts.LanguageName(taskInfo.Language)
+	}
+	if taskInfo.ReadOnly {
+		text += " | Read-only"
+	}
 	availableWidth := u.replUI.taskInfo.Widget.Inner.Dx()
 	if runewidth.StringWidth(text) > availableWidth {
 		// 短縮表示
@@ -207,26 +381,33 @@ func (u *UI) prerenderTaskInfo() {
 }
 
 // renderHistory updates the history widget content.
+// Only the rows in the visible window are built.
 func (u *UI) prerenderHistory() {
-	u.replUI.historyList.Widget.Rows = []string{}
-	width := u.replUI.historyList.Widget.Inner.Dx()
-	if width < 80 {
-		width = 80
+	inner := u.replUI.historyList.Widget.Inner
+	u.replUI.historyList.Widget.Rows = u.replUI.historyList.GetData().Rows(inner.Dx(), inner.Dy())
+	u.replUI.historyList.Widget.SelectedRow = 0
+}
+
+// prerenderTasks updates the tasks overview widget content
+func (u *UI) prerenderTasks() {
+	tasks := u.replUI.tasksList.GetData()
+	rows := make([]string, len(tasks))
+	for i, task := range tasks {
+		rows[i] = formatTaskSummary(task)
 	}
-	for _, entry := range u.replUI.historyList.GetData() {
-		timestamp := entry.Timestamp.Format("15:04:05")
-		prefix := ""
-		switch entry.Type {
-		case "user":
-			prefix = "[User]"
-		case "agent":
-			prefix = "[Agent]"
-		case "system":
-			prefix = "[System]"
-		}
-		line := fmt.Sprintf("[%s] %s %s", timestamp, prefix, entry.Content)
-		// termui 側で自動改行させるため、そのまま設定
-		u.replUI.historyList.Widget.Rows = append(u.replUI.historyList.Widget.Rows, line)
+	u.replUI.tasksList.Widget.Rows = rows
+	u.replUI.tasksList.Widget.SelectedRow = 0
+}
+
+// prerenderFileTree updates the file tree pane content
+func (u *UI) prerenderFileTree() {
+	rows, selected := u.replUI.fileTree.GetData().Rows()
+	u.replUI.fileTree.Widget.Rows = rows
+	u.replUI.fileTree.Widget.SelectedRow = selected
+	if u.replUI.fileTree.GetData().Focused() {
+		u.replUI.fileTree.Widget.SelectedRowStyle = u.replUI.selectedRowStyle
+	} else {
+		u.replUI.fileTree.Widget.SelectedRowStyle = u.replUI.fileTree.Widget.TextStyle
 	}
 }
 
@@ -242,22 +423,105 @@ func (u *UI) adjustGridLayout(termWidth, termHeight int) bool {
 	if u.termWidth != termWidth || u.termHeight != termHeight {
 		u.termWidth = termWidth
 		u.termHeight = termHeight
-		u.prerenderTaskInfo()
-		u.prerenderHistory()
-		u.prerenderREPL()
+		for _, pane := range u.panes() {
+			u.laidOut[pane] = pane.Visible()
+			pane.Prerender()
+		}
 		u.replUI.Render(termWidth, termHeight)
+		u.renderOverlays()
 		return true
 	}
 	return false
 }
 
+// redraw clears the terminal and draws all the panes again
+func (u *UI) redraw() {
+	ui.Clear()
+	u.termWidth, u.termHeight = 0, 0
+	termWidth, termHeight := ui.TerminalDimensions()
+	u.adjustGridLayout(termWidth, termHeight)
+}
+
+// renderOverlays draws the overlays over the panes, the last one on top
+func (u *UI) renderOverlays() {
+	for _, o := range u.overlays {
+		ui.Render(o.Layout(u.termWidth, u.termHeight)...)
+	}
+}
+
+// apply applies the changes collected by the screen: the updates of the whole screen and the
+// overlays opened. It returns the panes to draw again, and whether all the panes must be laid
+// out again.
+func (u *UI) apply() (dirty []Pane, relayout bool) {
+	dirty, opened, updates := u.screen.take()
+	for _, fn := range updates {
+		fn()
+	}
+	u.overlays = append(u.overlays, opened...)
+	return dirty, len(updates) > 0 || len(opened) > 0
+}
+
+// render draws panes again, or lays out and draws them all if relayout is set or a pane was
+// shown or hidden
+func (u *UI) render(dirty []Pane, relayout bool) {
+	for _, pane := range dirty {
+		if pane.Visible() != u.laidOut[pane] {
+			relayout = true
+		}
+	}
+	if relayout {
+		u.redraw()
+		return
+	}
+
+	rendered := false
+	for _, pane := range dirty {
+		if pane.Visible() {
+			pane.Prerender()
+			ui.Render(pane.Drawable())
+			rendered = true
+		}
+	}
+	if rendered {
+		// The panes were drawn over the overlays
+		u.renderOverlays()
+	}
+}
+
+// handleKey gives a key event to the top overlay, or to the input handler if there is none.
+// It reports whether the UI must exit, and whether an overlay was closed.
+func (u *UI) handleKey(e ui.Event) (exit, closed bool) {
+	if n := len(u.overlays); n > 0 {
+		if u.overlays[n-1].HandleKey(e.ID) {
+			u.overlays = u.overlays[:n-1]
+			return false, true
+		}
+		return false, false
+	}
+	if u.inputHandler != nil {
+		return u.inputHandler.HandleKeyEvent(e), false
+	}
+	switch e.ID {
+	case "q", "<C-c>":
+		return true, false
+	}
+	return false, false
+}
+
 // Close closes the UI.
 func (u *UI) Close() {
 	ui.Close()
 }
 
+// Quit makes Run return as if the user exited, e.g. when the process is asked to terminate
+func (u *UI) Quit() {
+	u.quitOnce.Do(func() { close(u.quit) })
+}
+
 // Run runs the UI.
 func (u *UI) Run() error {
+	// Apply the changes made before running, all the panes are drawn below
+	u.apply()
 	termWidth, termHeight := ui.TerminalDimensions()
 	u.adjustGridLayout(termWidth, termHeight)
 	uiEvents := ui.PollEvents()
@@ -266,15 +530,12 @@ func (u *UI) Run() error {
 		select {
 		case e := <-uiEvents:
 			if e.Type == ui.KeyboardEvent {
-				if u.inputHandler != nil {
-					if exit := u.inputHandler.HandleKeyEvent(e); exit {
-						return nil
-					}
-				} else {
-					switch e.ID {
-					case "q", "<C-c>":
-						return nil
-					}
+				exit, closed := u.handleKey(e)
+				if exit {
+					return nil
+				}
+				if closed {
+					u.redraw()
 				}
 			} else if e.Type == ui.ResizeEvent {
 				time.Sleep(10 * time.Millisecond)
@@ -282,15 +543,10 @@ func (u *UI) Run() error {
 				termWidth, termHeight := ui.TerminalDimensions()
 				u.adjustGridLayout(termWidth, termHeight)
 			}
-		case <-u.replUI.taskInfo.UpdateSignal():
-			u.prerenderTaskInfo()
-			u.replUI.taskInfo.Render()
-		case <-u.replUI.historyList.UpdateSignal():
-			u.prerenderHistory()
-			u.replUI.historyList.Render()
-		case <-u.replUI.repl.UpdateSignal():
-			u.prerenderREPL()
-			u.replUI.repl.Render()
+		case <-u.screen.signal:
+			u.render(u.apply())
+		case <-u.quit:
+			return nil
 		}
 	}
 }
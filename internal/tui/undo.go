@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kazz187/goline/internal/core/apply"
+	"github.com/kazz187/goline/internal/core/tasklock"
+)
+
+// undo reverts the last apply of the AI agent in a task and describes what was restored.
+// It is refused when the lock of the task is read-only or was lost, and returns an
+// apply.OtherChangesError unless force is set when files the apply did not edit would be
+// reverted too.
+func undo(taskID string, lock *tasklock.Lock, force bool) ([]string, error) {
+	if err := lock.Validate(); err != nil {
+		return nil, err
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	applier, err := apply.NewApplier(taskID, workingDir, newCheckpointService(taskID, lock))
+	if err != nil {
+		return nil, err
+	}
+	applier.SetLock(lock)
+	undone, err := applier.Undo(force)
+	if errors.Is(err, apply.ErrNothingToUndo) {
+		return []string{"No edits of the AI agent left to undo in this task"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		fmt.Sprintf("Undid the edits of %s, restored %s", undone.SuggestionID, strings.Join(undone.Paths, ", ")),
+		"Run `undo` again to go one more edit back",
+	}, nil
+}
+
+// otherChangesMessage describes the files an undo would revert without the apply having
+// edited them
+func otherChangesMessage(err *apply.OtherChangesError) string {
+	return fmt.Sprintf("%s changed since the edits of %s without being edited by the AI agent, the undo would revert them too", strings.Join(err.Paths, ", "), err.SuggestionID)
+}
+
+// processUndo reverts the last apply of the AI agent in the current task, using the checkpoint
+// saved automatically before it. The files the apply did not edit but that changed since are
+// only reverted with --yes.
+func (p *CommandProcessor) processUndo(args []string) {
+	var yes bool
+	for _, arg := range args {
+		if arg != "--yes" {
+			p.out.AddSystemMessage(fmt.Sprintf("Error: unknown undo argument: %s", arg))
+			return
+		}
+		yes = true
+	}
+	var taskID string
+	if tasks, ok := p.out.(TaskContext); ok {
+		taskID = tasks.CurrentTaskID()
+	}
+	if taskID == "" {
+		p.out.AddSystemMessage("Error: No active task")
+		return
+	}
+	lines, err := undo(taskID, p.lock.of(taskID), yes)
+	var others *apply.OtherChangesError
+	if errors.As(err, &others) {
+		p.out.AddSystemMessage(otherChangesMessage(others))
+		p.out.AddSystemMessage("Run `undo --yes` to undo the edits and revert them")
+		return
+	}
+	if err != nil {
+		p.out.AddSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	for _, line := range lines {
+		p.out.AddSystemMessage(line)
+	}
+}
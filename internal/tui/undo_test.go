@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kazz187/goline/internal/core/apply"
+	"github.com/kazz187/goline/internal/core/checkpoint"
+	"github.com/kazz187/goline/internal/core/tasklock"
+	pb "github.com/kazz187/goline/proto/gen/go/goline/v1"
+)
+
+// taskWriter records the history entries of a task
+type taskWriter struct {
+	recordingWriter
+	taskID string
+}
+
+func (w *taskWriter) CurrentTaskID() string { return w.taskID }
+
+func TestUndoCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	t.Chdir(workingDir)
+	if err := os.WriteFile(filepath.Join(workingDir, "a.txt"), []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applier, err := apply.NewApplier("task-undo", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applier.Apply("turn-1", []apply.Edit{{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_UPDATE, Content: "after"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The undo is refused while another process holds the task
+	out := &taskWriter{taskID: "task-undo"}
+	p := NewCommandProcessor(out)
+	p.SetTaskLock("task-undo", tasklock.ReadOnly(t.TempDir(), tasklock.Info{}))
+	p.Process("undo")
+	if data, _ := os.ReadFile(filepath.Join(workingDir, "a.txt")); string(data) != "after" {
+		t.Errorf("a.txt = %q, want the edit kept in a read-only task", data)
+	}
+	if len(out.messages) != 1 || !strings.Contains(out.messages[0], tasklock.ErrReadOnly.Error()) {
+		t.Errorf("read-only undo messages = %q", out.messages)
+	}
+
+	out.messages = nil
+	p.SetTaskLock("task-undo", nil)
+	p.Process("undo")
+	if data, _ := os.ReadFile(filepath.Join(workingDir, "a.txt")); string(data) != "before" {
+		t.Errorf("a.txt = %q, want the edit undone", data)
+	}
+	if len(out.messages) == 0 || out.messages[0] != "Undid the edits of turn-1, restored a.txt" {
+		t.Errorf("messages = %q", out.messages)
+	}
+
+	p.Process("undo")
+	if last := out.messages[len(out.messages)-1]; last != "No edits of the AI agent left to undo in this task" {
+		t.Errorf("second undo = %q", last)
+	}
+}
+
+func TestUndoCommandOtherChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workingDir := t.TempDir()
+	t.Chdir(workingDir)
+	if err := os.WriteFile(filepath.Join(workingDir, "notes.txt"), []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applier, err := apply.NewApplier("task-undo-others", workingDir, checkpoint.NewService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applier.Apply("turn-1", []apply.Edit{{Path: "a.txt", Type: pb.ModificationType_MODIFICATION_TYPE_CREATE, Content: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workingDir, "notes.txt"), []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &taskWriter{taskID: "task-undo-others"}
+	p := NewCommandProcessor(out)
+	p.Process("undo")
+	if data, _ := os.ReadFile(filepath.Join(workingDir, "notes.txt")); string(data) != "after" {
+		t.Errorf("notes.txt = %q, want it kept without --yes", data)
+	}
+	if len(out.messages) != 2 || !strings.HasPrefix(out.messages[0], "notes.txt changed since the edits of turn-1") {
+		t.Errorf("messages = %q", out.messages)
+	}
+
+	p.Process("undo --yes")
+	if data, _ := os.ReadFile(filepath.Join(workingDir, "notes.txt")); string(data) != "before" {
+		t.Errorf("notes.txt = %q, want it reverted with --yes", data)
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt was not removed: %v", err)
+	}
+}
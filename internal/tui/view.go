@@ -0,0 +1,183 @@
+package tui
+
+import (
+	"image"
+	"strings"
+	"sync"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+// Pane is a part of the screen laid out by the UI. Its data can change on any goroutine, and
+// its widget is only updated and drawn on the UI goroutine.
+type Pane interface {
+	// Drawable returns the widget drawing the pane
+	Drawable() ui.Drawable
+	// Prerender updates the widget from the data of the pane before it is drawn
+	Prerender()
+	// Visible reports whether the pane is part of the layout
+	Visible() bool
+}
+
+// Overlay is drawn over the panes, such as a dialog or a menu, and gets the keys while it is
+// the top one. Overlays are only used on the UI goroutine, once opened.
+type Overlay interface {
+	// Layout sets the position of the widgets of the overlay in a terminal of the size, and
+	// returns them to draw
+	Layout(width, height int) []ui.Drawable
+	// HandleKey handles a key event, and reports whether the overlay is done and is closed
+	HandleKey(key string) (done bool)
+}
+
+// screen collects the panes to draw again, the overlays to open and the changes of the whole
+// screen, from any goroutine, for the event loop of the UI
+type screen struct {
+	mu     sync.Mutex
+	dirty  []Pane
+	opened []Overlay
+	// updates change the whole screen, e.g. its theme, which is then laid out and drawn again
+	updates []func()
+	signal  chan struct{}
+}
+
+// newScreen creates an empty screen
+func newScreen() *screen {
+	return &screen{signal: make(chan struct{}, 1)}
+}
+
+// invalidate marks a pane to draw again
+func (s *screen) invalidate(p Pane) {
+	s.mu.Lock()
+	for _, dirty := range s.dirty {
+		if dirty == p {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.dirty = append(s.dirty, p)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// update runs a change of the whole screen on the UI goroutine, then lays out and draws all
+// the panes again
+func (s *screen) update(fn func()) {
+	s.mu.Lock()
+	s.updates = append(s.updates, fn)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// open asks to open an overlay on top of the others
+func (s *screen) open(o Overlay) {
+	s.mu.Lock()
+	s.opened = append(s.opened, o)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify wakes up the event loop
+func (s *screen) notify() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and forgets the changes since the last call
+func (s *screen) take() (dirty []Pane, opened []Overlay, updates []func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirty, opened, updates = s.dirty, s.opened, s.updates
+	s.dirty, s.opened, s.updates = nil, nil, nil
+	return dirty, opened, updates
+}
+
+// Dialog is an overlay asking the user to pick one of options, with Up and Down then Enter,
+// or to dismiss it with Esc
+type Dialog struct {
+	message  *widgets.Paragraph
+	options  *widgets.List
+	choose   func(option int)
+	selected int
+}
+
+// NewDialog creates a dialog with a message and options. choose is called with the index of
+// the option picked, or -1 if the dialog is dismissed.
+func NewDialog(title, message string, options []string, choose func(option int)) *Dialog {
+	p := widgets.NewParagraph()
+	p.Title = title
+	p.Text = message
+	p.Border = true
+
+	l := widgets.NewList()
+	l.Rows = make([]string, len(options))
+	for i, option := range options {
+		l.Rows[i] = " " + option
+	}
+	l.WrapText = false
+	l.SelectedRowStyle = ui.NewStyle(ui.ColorBlack, ui.ColorWhite)
+	l.Border = true
+	l.Title = "Enter to pick, Esc to dismiss"
+	return &Dialog{message: p, options: l, choose: choose}
+}
+
+// Selected returns the index of the selected option
+func (d *Dialog) Selected() int {
+	return d.selected
+}
+
+// Layout implements Overlay, centering the dialog
+func (d *Dialog) Layout(width, height int) []ui.Drawable {
+	w := max(20, min(width-4, width*3/5))
+	// The message is wrapped inside the borders
+	messageRows := 0
+	for _, line := range strings.Split(d.message.Text, "\n") {
+		messageRows += max(1, (len([]rune(line))+w-3)/max(1, w-2))
+	}
+	messageHeight := min(messageRows+2, max(3, height/2))
+	optionsHeight := min(len(d.options.Rows)+2, max(3, height-messageHeight-2))
+	x := (width - w) / 2
+	y := max(0, (height-messageHeight-optionsHeight)/2)
+
+	d.message.SetRect(x, y, x+w, y+messageHeight)
+	d.options.SetRect(x, y+messageHeight, x+w, y+messageHeight+optionsHeight)
+	d.options.SelectedRow = d.selected
+	return []ui.Drawable{clearArea{image.Rect(x, y, x+w, y+messageHeight+optionsHeight)}, d.message, d.options}
+}
+
+// HandleKey implements Overlay
+func (d *Dialog) HandleKey(key string) bool {
+	switch key {
+	case "<Up>":
+		d.selected = max(0, d.selected-1)
+	case "<Down>":
+		d.selected = max(0, min(len(d.options.Rows)-1, d.selected+1))
+	case "<Enter>":
+		if len(d.options.Rows) == 0 {
+			d.choose(-1)
+		} else {
+			d.choose(d.selected)
+		}
+		return true
+	case "<Escape>", "<C-c>":
+		d.choose(-1)
+		return true
+	}
+	return false
+}
+
+// clearArea blanks an area of the terminal, under an overlay
+type clearArea struct {
+	rect image.Rectangle
+}
+
+func (c clearArea) GetRect() image.Rectangle   { return c.rect }
+func (c clearArea) SetRect(x1, y1, x2, y2 int) {}
+func (c clearArea) Lock()                      {}
+func (c clearArea) Unlock()                    {}
+
+func (c clearArea) Draw(buf *ui.Buffer) {
+	buf.Fill(ui.NewCell(' '), c.rect)
+}
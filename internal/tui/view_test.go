@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/kazz187/goline/internal/config"
+)
+
+func TestDialog(t *testing.T) {
+	chosen := -2
+	d := NewDialog("Approve", "Run go test ./...?", []string{"Yes", "No", "Always"}, func(option int) { chosen = option })
+
+	for _, key := range []string{"<Down>", "<Down>", "<Down>", "<Up>", "x"} {
+		if d.HandleKey(key) {
+			t.Fatalf("%s should not close the dialog", key)
+		}
+	}
+	if d.Selected() != 1 {
+		t.Errorf("Selected() = %d, want 1", d.Selected())
+	}
+	if !d.HandleKey("<Enter>") || chosen != 1 {
+		t.Errorf("Enter should pick the selected option, got %d", chosen)
+	}
+
+	d = NewDialog("Approve", "Run it?", []string{"Yes"}, func(option int) { chosen = option })
+	if !d.HandleKey("<Escape>") || chosen != -1 {
+		t.Errorf("Esc should dismiss the dialog, got %d", chosen)
+	}
+
+	// The dialog is centered in the terminal
+	drawables := d.Layout(100, 40)
+	for _, drawable := range drawables {
+		rect := drawable.GetRect()
+		if rect.Min.X < 0 || rect.Max.X > 100 || rect.Min.Y < 0 || rect.Max.Y > 40 || rect.Empty() {
+			t.Errorf("widget at %v is outside of the terminal", rect)
+		}
+	}
+	if rect := drawables[0].GetRect(); rect.Min.X != 100-rect.Max.X {
+		t.Errorf("the dialog at %v is not centered", rect)
+	}
+}
+
+func TestScreen(t *testing.T) {
+	u := newUI(nil, nil)
+	u.replUI.historyList.Changed()
+	u.replUI.tasksList.Changed()
+	u.replUI.historyList.Changed()
+	dirty, relayout := u.apply()
+	if len(dirty) != 2 || relayout {
+		t.Errorf("apply() = %d panes, %v, want each changed pane once", len(dirty), relayout)
+	}
+
+	u.SetTheme(themePresets[ThemeLight])
+	if _, relayout := u.apply(); !relayout {
+		t.Error("a theme change should lay out the panes again")
+	}
+	if u.replUI.repl.Widget.TextStyle.Fg != ui.ColorBlack {
+		t.Error("the theme should be applied")
+	}
+}
+
+func TestOverlayGetsKeys(t *testing.T) {
+	s := newTestSession(t, config.AutoApprove{})
+	u := s.repl.ui
+
+	answer := make(chan int, 1)
+	go func() {
+		option, err := s.repl.Choose(context.Background(), "Approve", "Write main.go?", []string{"Yes", "No"})
+		if err != nil {
+			t.Error(err)
+		}
+		answer <- option
+	}()
+	waitOverlay(t, u)
+
+	for _, key := range []string{"<Down>", "n", "<Enter>"} {
+		if exit, _ := u.handleKey(ui.Event{Type: ui.KeyboardEvent, ID: key}); exit {
+			t.Fatal("the keys of the dialog should not exit")
+		}
+	}
+	select {
+	case option := <-answer:
+		if option != 1 {
+			t.Errorf("Choose() = %d, want the selected option", option)
+		}
+	case <-time.After(sessionTimeout):
+		t.Fatal("the dialog was not answered")
+	}
+	if len(u.overlays) != 0 {
+		t.Error("the dialog should be closed")
+	}
+	if s.repl.inputHandler.currentInput != "" {
+		t.Errorf("the input got the keys of the dialog: %q", s.repl.inputHandler.currentInput)
+	}
+
+	// Keys go to the input again
+	u.handleKey(ui.Event{Type: ui.KeyboardEvent, ID: "n"})
+	if s.repl.inputHandler.currentInput != "n" {
+		t.Errorf("input = %q, want the key typed", s.repl.inputHandler.currentInput)
+	}
+
+	// A canceled wait closes the dialog
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.repl.Choose(ctx, "Approve", "Write main.go?", []string{"Yes", "No"})
+		done <- err
+	}()
+	waitOverlay(t, u)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Choose() error = %v, want context.Canceled", err)
+	}
+	u.apply()
+	if len(u.overlays) != 0 {
+		t.Error("the dialog of a canceled wait should be closed")
+	}
+}
+
+// waitOverlay waits for an overlay to be opened on the UI, applying the changes of the screen
+// as the event loop does
+func waitOverlay(t *testing.T, u *UI) {
+	t.Helper()
+	deadline := time.Now().Add(sessionTimeout)
+	for {
+		u.apply()
+		if len(u.overlays) > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no overlay was opened")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,276 @@
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ChecksumsAsset is the name of the release asset listing the SHA-256 of every archive
+const ChecksumsAsset = "checksums.txt"
+
+// SignatureAsset is the name of the release asset holding the base64 ed25519 signature of the checksums
+const SignatureAsset = "checksums.txt.sig"
+
+// maxDownloadSize limits the size of downloaded archives
+const maxDownloadSize = 200 << 20
+
+// PublicKey is the base64 ed25519 key the checksums of the releases are signed with.
+// It is set at build time with -ldflags "-X github.com/kazz187/goline/internal/update.PublicKey=...".
+// Without it, the checksums are trusted as downloaded and self-update warns about it.
+// When it is empty, only the checksums are verified.
+var PublicKey string
+
+// ManagedError is returned when the binary is installed by a package manager, which must update it instead
+type ManagedError struct {
+	// Manager is the name of the package manager
+	Manager string
+	// Command updates the binary with the package manager
+	Command string
+}
+
+func (e *ManagedError) Error() string {
+	return fmt.Sprintf("goline was installed with %s, run `%s` to update it", e.Manager, e.Command)
+}
+
+// PackageManager returns the error describing how to update a binary installed by a package manager,
+// or nil if the binary can be replaced
+func PackageManager(executable string) *ManagedError {
+	p := filepath.ToSlash(executable)
+	lower := strings.ToLower(p)
+	switch {
+	case strings.Contains(p, "/Cellar/") || strings.Contains(p, "/homebrew/") || strings.Contains(p, "/linuxbrew/"):
+		return &ManagedError{Manager: "Homebrew", Command: "brew upgrade goline"}
+	case strings.Contains(lower, "/scoop/apps/"):
+		return &ManagedError{Manager: "Scoop", Command: "scoop update goline"}
+	default:
+		return nil
+	}
+}
+
+// ArchiveName returns the name of the release archive for a version and platform
+func ArchiveName(version, goos, goarch string) string {
+	ext := "tar.gz"
+	if goos == "windows" {
+		ext = "zip"
+	}
+	return fmt.Sprintf("goline_%s_%s_%s.%s", strings.TrimPrefix(version, "v"), goos, goarch, ext)
+}
+
+// Install downloads the archive of the release for the current platform, verifies it against
+// the signed checksums and replaces the executable with the binary it contains
+func (c *Client) Install(ctx context.Context, release *Release, executable string) error {
+	archiveName := ArchiveName(release.Tag, runtime.GOOS, runtime.GOARCH)
+	archive, ok := release.Asset(archiveName)
+	if !ok {
+		return fmt.Errorf("release %s has no archive for %s/%s", release.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	checksumsAsset, ok := release.Asset(ChecksumsAsset)
+	if !ok {
+		return fmt.Errorf("release %s has no %s, refusing to install an unverified binary", release.Tag, ChecksumsAsset)
+	}
+
+	checksums, err := c.download(ctx, checksumsAsset.URL)
+	if err != nil {
+		return err
+	}
+	if PublicKey != "" {
+		signatureAsset, ok := release.Asset(SignatureAsset)
+		if !ok {
+			return fmt.Errorf("release %s has no %s, refusing to install an unsigned binary", release.Tag, SignatureAsset)
+		}
+		signature, err := c.download(ctx, signatureAsset.URL)
+		if err != nil {
+			return err
+		}
+		if err := VerifySignature(PublicKey, checksums, signature); err != nil {
+			return err
+		}
+	}
+
+	data, err := c.download(ctx, archive.URL)
+	if err != nil {
+		return err
+	}
+	if err := VerifyChecksum(checksums, archiveName, data); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(archiveName, data)
+	if err != nil {
+		return err
+	}
+	return replaceExecutable(executable, binary)
+}
+
+// download returns the content of a release asset
+func (c *Client) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("failed to download %s: larger than %d bytes", url, maxDownloadSize)
+	}
+	return data, nil
+}
+
+// VerifyChecksum checks data against its SHA-256 in a checksums file in the sha256sum format
+func VerifyChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], actual) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], actual)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum found for %s", name)
+}
+
+// VerifySignature checks the base64 ed25519 signature of data
+func VerifySignature(publicKey string, data, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid release public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return errors.New("the signature of the checksums does not match the release key")
+	}
+	return nil
+}
+
+// extractBinary returns the goline binary of a release archive
+func extractBinary(archiveName string, data []byte) ([]byte, error) {
+	if strings.HasSuffix(archiveName, ".zip") {
+		return extractZip(data, "goline.exe")
+	}
+	return extractTarGz(data, "goline")
+}
+
+// extractTarGz returns the content of a file of a .tar.gz archive
+func extractTarGz(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// extractZip returns the content of a file of a .zip archive
+func extractZip(data []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if path.Base(f.Name) != name || f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+// replaceExecutable atomically replaces the executable with a new binary.
+// A running executable cannot be overwritten on Windows, so it is moved aside first and moved
+// back if the new binary cannot take its place.
+func replaceExecutable(executable string, binary []byte) error {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(executable)
+	tmp, err := os.CreateTemp(dir, ".goline-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to write the new binary next to %s: %w", executable, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+
+	var old string
+	if runtime.GOOS == "windows" {
+		old = executable + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			return fmt.Errorf("failed to move the current binary aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, executable); err != nil {
+		if old != "" {
+			if restoreErr := os.Rename(old, executable); restoreErr != nil {
+				return fmt.Errorf("failed to replace %s: %w (the current binary is left at %s: %v)", executable, err, old, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to replace %s: %w", executable, err)
+	}
+	return nil
+}
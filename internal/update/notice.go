@@ -0,0 +1,92 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckInterval is how often the new version notice queries the releases
+const CheckInterval = 24 * time.Hour
+
+// checkState is the result of the last release check, cached between runs
+type checkState struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Channel   string    `json:"channel"`
+	Latest    string    `json:"latest"`
+}
+
+// Checker finds out whether a newer release is available, querying GitHub at most once per CheckInterval
+type Checker struct {
+	// Client queries the releases
+	Client *Client
+	// StatePath is the file caching the last check
+	StatePath string
+	// Now returns the current time
+	Now func() time.Time
+}
+
+// NewChecker creates a checker caching its result in ~/.goline/update-check.json
+func NewChecker() (*Checker, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return &Checker{
+		Client:    NewClient(),
+		StatePath: filepath.Join(homeDir, ".goline", "update-check.json"),
+		Now:       time.Now,
+	}, nil
+}
+
+// Check returns the tag of the newest release of the channel if it is newer than current, or an empty string
+func (c *Checker) Check(ctx context.Context, current, channel string) (string, error) {
+	state, err := c.load()
+	if err != nil || state.Channel != channel || c.Now().Sub(state.CheckedAt) >= CheckInterval {
+		release, err := c.Client.Latest(ctx, channel)
+		if err != nil && !errors.Is(err, ErrNoRelease) {
+			return "", err
+		}
+		state = &checkState{CheckedAt: c.Now(), Channel: channel}
+		if release != nil {
+			state.Latest = release.Tag
+		}
+		if err := c.save(state); err != nil {
+			return "", err
+		}
+	}
+
+	if state.Latest == "" || Compare(state.Latest, current) <= 0 {
+		return "", nil
+	}
+	return state.Latest, nil
+}
+
+// load reads the cached result of the last check
+func (c *Checker) load() (*checkState, error) {
+	data, err := os.ReadFile(c.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	var state checkState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// save caches the result of a check
+func (c *Checker) save(state *checkState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.StatePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.StatePath, data, 0o644)
+}
@@ -0,0 +1,208 @@
+// Package update finds newer Goline releases on GitHub and replaces the running binary with them.
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release channels
+const (
+	// ChannelStable only considers full releases
+	ChannelStable = "stable"
+	// ChannelPrerelease also considers releases marked as prereleases
+	ChannelPrerelease = "prerelease"
+)
+
+// DefaultRepository is the GitHub repository Goline is released from
+const DefaultRepository = "kazz187/goline"
+
+// ErrNoRelease is returned when no release matches the channel
+var ErrNoRelease = errors.New("no release found")
+
+// Asset is a file attached to a release
+type Asset struct {
+	// Name is the file name
+	Name string `json:"name"`
+	// URL is the download URL
+	URL string `json:"browser_download_url"`
+}
+
+// Release is a GitHub release
+type Release struct {
+	// Tag is the tag of the release, e.g. v1.2.3
+	Tag string `json:"tag_name"`
+	// Draft reports whether the release is a draft
+	Draft bool `json:"draft"`
+	// Prerelease reports whether the release is a prerelease
+	Prerelease bool `json:"prerelease"`
+	// Assets are the files of the release
+	Assets []Asset `json:"assets"`
+}
+
+// Asset returns the asset with the given name
+func (r *Release) Asset(name string) (Asset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Client queries the releases of a GitHub repository
+type Client struct {
+	// HTTPClient sends the requests
+	HTTPClient *http.Client
+	// BaseURL is the URL of the GitHub API
+	BaseURL string
+	// Repository is the owner/name of the repository
+	Repository string
+}
+
+// NewClient creates a client for the Goline releases
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		BaseURL:    "https://api.github.com",
+		Repository: DefaultRepository,
+	}
+}
+
+// Latest returns the newest release of the channel
+func (c *Client) Latest(ctx context.Context, channel string) (*Release, error) {
+	if channel != ChannelStable && channel != ChannelPrerelease {
+		return nil, fmt.Errorf("unknown release channel %q, expected %s or %s", channel, ChannelStable, ChannelPrerelease)
+	}
+
+	var releases []Release
+	if err := c.get(ctx, fmt.Sprintf("%s/repos/%s/releases?per_page=30", c.BaseURL, c.Repository), &releases); err != nil {
+		return nil, err
+	}
+
+	var latest *Release
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft || (release.Prerelease && channel != ChannelPrerelease) {
+			continue
+		}
+		if _, err := ParseVersion(release.Tag); err != nil {
+			continue
+		}
+		if latest == nil || Compare(release.Tag, latest.Tag) > 0 {
+			latest = release
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("%w on the %s channel", ErrNoRelease, channel)
+	}
+	return latest, nil
+}
+
+// get decodes the JSON response of a GitHub API request
+func (c *Client) get(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query releases: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode releases: %w", err)
+	}
+	return nil
+}
+
+// Version is a parsed semantic version
+type Version struct {
+	Major, Minor, Patch int
+	// Prerelease is the prerelease suffix without the dash, e.g. rc.1
+	Prerelease string
+}
+
+// ParseVersion parses a version such as v1.2.3 or 1.2.3-rc.1, ignoring the build metadata
+// after a +, which may contain dashes too
+func ParseVersion(s string) (Version, error) {
+	version, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	core, prerelease, _ := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}, nil
+}
+
+// Compare compares two versions, returning a negative number if a is older than b,
+// zero if they are equal and a positive number if a is newer.
+// Versions that cannot be parsed are older than any valid version.
+func Compare(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+
+	for _, d := range []int{va.Major - vb.Major, va.Minor - vb.Minor, va.Patch - vb.Patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	return comparePrerelease(va.Prerelease, vb.Prerelease)
+}
+
+// comparePrerelease compares prerelease suffixes, a release is newer than its prereleases
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return na - nb
+		case errA == nil && errB != nil:
+			return -1
+		case errA != nil && errB == nil:
+			return 1
+		case pa[i] != pb[i]:
+			return strings.Compare(pa[i], pb[i])
+		}
+	}
+	return len(pa) - len(pb)
+}
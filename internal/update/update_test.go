@@ -0,0 +1,280 @@
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// releaseServer serves a list of releases and their assets
+type releaseServer struct {
+	*httptest.Server
+	releases []Release
+	assets   map[string][]byte
+	queries  int
+}
+
+func newReleaseServer(t *testing.T) *releaseServer {
+	t.Helper()
+	s := &releaseServer{assets: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/kazz187/goline/releases" {
+			s.queries++
+			_ = json.NewEncoder(w).Encode(s.releases)
+			return
+		}
+		data, ok := s.assets[strings.TrimPrefix(r.URL.Path, "/assets/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addRelease adds a release with the given assets
+func (s *releaseServer) addRelease(tag string, prerelease bool, assets map[string][]byte) {
+	release := Release{Tag: tag, Prerelease: prerelease}
+	for name, data := range assets {
+		s.assets[name] = data
+		release.Assets = append(release.Assets, Asset{Name: name, URL: s.URL + "/assets/" + name})
+	}
+	s.releases = append(s.releases, release)
+}
+
+func (s *releaseServer) client() *Client {
+	return &Client{HTTPClient: s.Client(), BaseURL: s.URL, Repository: DefaultRepository}
+}
+
+// archive builds a release archive for the current platform containing the binary
+func archive(t *testing.T, binary []byte) (string, []byte) {
+	t.Helper()
+	name := ArchiveName("v1.0.0", runtime.GOOS, runtime.GOARCH)
+	var buf bytes.Buffer
+	if runtime.GOOS == "windows" {
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("goline.exe")
+		_, _ = w.Write(binary)
+		_ = zw.Close()
+		return name, buf.Bytes()
+	}
+
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "README.md", Mode: 0o644, Size: 2})
+	_, _ = tw.Write([]byte("hi"))
+	_ = tw.WriteHeader(&tar.Header{Name: "goline", Mode: 0o755, Size: int64(len(binary))})
+	_, _ = tw.Write(binary)
+	_ = tw.Close()
+	_ = gz.Close()
+	return name, buf.Bytes()
+}
+
+func checksums(name string, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name))
+}
+
+func TestLatest(t *testing.T) {
+	s := newReleaseServer(t)
+	s.addRelease("v1.2.0", false, nil)
+	s.addRelease("v1.10.0", false, nil)
+	s.addRelease("v1.11.0-rc.1", true, nil)
+	s.addRelease("nightly", true, nil)
+
+	tests := []struct {
+		channel string
+		want    string
+	}{
+		{ChannelStable, "v1.10.0"},
+		{ChannelPrerelease, "v1.11.0-rc.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			release, err := s.client().Latest(context.Background(), tt.channel)
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+			if release.Tag != tt.want {
+				t.Errorf("Latest() = %s, want %s", release.Tag, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.client().Latest(context.Background(), "beta"); err == nil {
+		t.Error("Latest() accepted an unknown channel")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-beta", "v1.0.0-alpha", 1},
+		{"dev", "v0.1.0", -1},
+		{"1.2.3+build-5", "1.2.3", 0},
+		{"1.2.3-rc.1+build-5", "1.2.3-rc.1", 0},
+	}
+	for _, tt := range tests {
+		got := Compare(tt.a, tt.b)
+		if (got > 0) != (tt.want > 0) || (got < 0) != (tt.want < 0) {
+			t.Errorf("Compare(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+	t.Cleanup(func() { PublicKey = "" })
+
+	name, data := archive(t, []byte("new binary"))
+	sums := checksums(name, data)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, sums))
+
+	tests := []struct {
+		name      string
+		checksums []byte
+		signature string
+		wantErr   string
+	}{
+		{"valid", sums, signature, ""},
+		{"checksum mismatch", checksums(name, []byte("other")), base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checksums(name, []byte("other")))), "checksum mismatch"},
+		{"bad signature", sums, base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("other"))), "signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReleaseServer(t)
+			s.addRelease("v1.0.0", false, map[string][]byte{
+				name:           data,
+				ChecksumsAsset: tt.checksums,
+				SignatureAsset: []byte(tt.signature),
+			})
+
+			executable := filepath.Join(t.TempDir(), "goline")
+			if err := os.WriteFile(executable, []byte("old binary"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			err := s.client().Install(context.Background(), &s.releases[0], executable)
+
+			got, _ := os.ReadFile(executable)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Install() error = %v, want %q", err, tt.wantErr)
+				}
+				if string(got) != "old binary" {
+					t.Error("the binary was replaced despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+			if string(got) != "new binary" {
+				t.Errorf("binary = %q, want the new binary", got)
+			}
+		})
+	}
+}
+
+func TestInstallRequiresChecksums(t *testing.T) {
+	name, data := archive(t, []byte("new binary"))
+	s := newReleaseServer(t)
+	s.addRelease("v1.0.0", false, map[string][]byte{name: data})
+
+	executable := filepath.Join(t.TempDir(), "goline")
+	if err := os.WriteFile(executable, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.client().Install(context.Background(), &s.releases[0], executable); err == nil {
+		t.Error("Install() installed a release without checksums")
+	}
+}
+
+func TestPackageManager(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/opt/homebrew/bin/goline", "Homebrew"},
+		{"/usr/local/Cellar/goline/1.0.0/bin/goline", "Homebrew"},
+		{`C:\Users\me\scoop\apps\goline\current\goline.exe`, "Scoop"},
+		{"/usr/local/bin/goline", ""},
+	}
+	for _, tt := range tests {
+		managed := PackageManager(filepath.FromSlash(strings.ReplaceAll(tt.path, `\`, "/")))
+		got := ""
+		if managed != nil {
+			got = managed.Manager
+		}
+		if got != tt.want {
+			t.Errorf("PackageManager(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckerCachesResult(t *testing.T) {
+	s := newReleaseServer(t)
+	s.addRelease("v0.2.0", false, nil)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker := &Checker{
+		Client:    s.client(),
+		StatePath: filepath.Join(t.TempDir(), "update-check.json"),
+		Now:       func() time.Time { return now },
+	}
+
+	for i := 0; i < 2; i++ {
+		latest, err := checker.Check(context.Background(), "0.1.0", ChannelStable)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if latest != "v0.2.0" {
+			t.Errorf("Check() = %q, want v0.2.0", latest)
+		}
+	}
+	if s.queries != 1 {
+		t.Errorf("releases were queried %d times, want 1", s.queries)
+	}
+
+	now = now.Add(CheckInterval)
+	if latest, err := checker.Check(context.Background(), "0.2.0", ChannelStable); err != nil || latest != "" {
+		t.Errorf("Check() = %q, %v, want no newer version", latest, err)
+	}
+	if s.queries != 2 {
+		t.Errorf("releases were queried %d times, want 2 after the interval", s.queries)
+	}
+
+	s.Close()
+	now = now.Add(CheckInterval)
+	if _, err := checker.Check(context.Background(), "0.2.0", ChannelStable); err == nil || errors.Is(err, ErrNoRelease) {
+		t.Errorf("Check() error = %v, want a network error", err)
+	}
+}
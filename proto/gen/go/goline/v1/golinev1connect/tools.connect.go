@@ -0,0 +1,110 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: goline/v1/tools.proto
+
+package golinev1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/kazz187/goline/proto/gen/go/goline/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// ToolServiceName is the fully-qualified name of the ToolService service.
+	ToolServiceName = "goline.v1.ToolService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// ToolServiceListToolsProcedure is the fully-qualified name of the ToolService's ListTools RPC.
+	ToolServiceListToolsProcedure = "/goline.v1.ToolService/ListTools"
+)
+
+// ToolServiceClient is a client for the goline.v1.ToolService service.
+type ToolServiceClient interface {
+	// ListTools returns the schema of every tool
+	ListTools(context.Context, *connect.Request[v1.ListToolsRequest]) (*connect.Response[v1.ListToolsResponse], error)
+}
+
+// NewToolServiceClient constructs a client for the goline.v1.ToolService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewToolServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) ToolServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	toolServiceMethods := v1.File_goline_v1_tools_proto.Services().ByName("ToolService").Methods()
+	return &toolServiceClient{
+		listTools: connect.NewClient[v1.ListToolsRequest, v1.ListToolsResponse](
+			httpClient,
+			baseURL+ToolServiceListToolsProcedure,
+			connect.WithSchema(toolServiceMethods.ByName("ListTools")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// toolServiceClient implements ToolServiceClient.
+type toolServiceClient struct {
+	listTools *connect.Client[v1.ListToolsRequest, v1.ListToolsResponse]
+}
+
+// ListTools calls goline.v1.ToolService.ListTools.
+func (c *toolServiceClient) ListTools(ctx context.Context, req *connect.Request[v1.ListToolsRequest]) (*connect.Response[v1.ListToolsResponse], error) {
+	return c.listTools.CallUnary(ctx, req)
+}
+
+// ToolServiceHandler is an implementation of the goline.v1.ToolService service.
+type ToolServiceHandler interface {
+	// ListTools returns the schema of every tool
+	ListTools(context.Context, *connect.Request[v1.ListToolsRequest]) (*connect.Response[v1.ListToolsResponse], error)
+}
+
+// NewToolServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewToolServiceHandler(svc ToolServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	toolServiceMethods := v1.File_goline_v1_tools_proto.Services().ByName("ToolService").Methods()
+	toolServiceListToolsHandler := connect.NewUnaryHandler(
+		ToolServiceListToolsProcedure,
+		svc.ListTools,
+		connect.WithSchema(toolServiceMethods.ByName("ListTools")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/goline.v1.ToolService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ToolServiceListToolsProcedure:
+			toolServiceListToolsHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedToolServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedToolServiceHandler struct{}
+
+func (UnimplementedToolServiceHandler) ListTools(context.Context, *connect.Request[v1.ListToolsRequest]) (*connect.Response[v1.ListToolsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("goline.v1.ToolService.ListTools is not implemented"))
+}
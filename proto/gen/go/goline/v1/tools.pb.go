@@ -0,0 +1,415 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: goline/v1/tools.proto
+
+package golinev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ToolParameterType represents the type of a tool parameter value.
+// Values are always sent as text inside XML tags, the type tells how the text is interpreted.
+type ToolParameterType int32
+
+const (
+	// Default unspecified type
+	ToolParameterType_TOOL_PARAMETER_TYPE_UNSPECIFIED ToolParameterType = 0
+	// Free-form text
+	ToolParameterType_TOOL_PARAMETER_TYPE_STRING ToolParameterType = 1
+	// "true" or "false"
+	ToolParameterType_TOOL_PARAMETER_TYPE_BOOLEAN ToolParameterType = 2
+	// A JSON object
+	ToolParameterType_TOOL_PARAMETER_TYPE_JSON ToolParameterType = 3
+)
+
+// Enum value maps for ToolParameterType.
+var (
+	ToolParameterType_name = map[int32]string{
+		0: "TOOL_PARAMETER_TYPE_UNSPECIFIED",
+		1: "TOOL_PARAMETER_TYPE_STRING",
+		2: "TOOL_PARAMETER_TYPE_BOOLEAN",
+		3: "TOOL_PARAMETER_TYPE_JSON",
+	}
+	ToolParameterType_value = map[string]int32{
+		"TOOL_PARAMETER_TYPE_UNSPECIFIED": 0,
+		"TOOL_PARAMETER_TYPE_STRING":      1,
+		"TOOL_PARAMETER_TYPE_BOOLEAN":     2,
+		"TOOL_PARAMETER_TYPE_JSON":        3,
+	}
+)
+
+func (x ToolParameterType) Enum() *ToolParameterType {
+	p := new(ToolParameterType)
+	*p = x
+	return p
+}
+
+func (x ToolParameterType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ToolParameterType) Descriptor() protoreflect.EnumDescriptor {
+	return file_goline_v1_tools_proto_enumTypes[0].Descriptor()
+}
+
+func (ToolParameterType) Type() protoreflect.EnumType {
+	return &file_goline_v1_tools_proto_enumTypes[0]
+}
+
+func (x ToolParameterType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ToolParameterType.Descriptor instead.
+func (ToolParameterType) EnumDescriptor() ([]byte, []int) {
+	return file_goline_v1_tools_proto_rawDescGZIP(), []int{0}
+}
+
+// ListToolsRequest is the request of ToolService.ListTools
+type ListToolsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListToolsRequest) Reset() {
+	*x = ListToolsRequest{}
+	mi := &file_goline_v1_tools_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListToolsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListToolsRequest) ProtoMessage() {}
+
+func (x *ListToolsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_goline_v1_tools_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListToolsRequest.ProtoReflect.Descriptor instead.
+func (*ListToolsRequest) Descriptor() ([]byte, []int) {
+	return file_goline_v1_tools_proto_rawDescGZIP(), []int{0}
+}
+
+// ListToolsResponse is the response of ToolService.ListTools
+type ListToolsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Schemas of all tools, in the order they are documented to the model
+	Tools         []*ToolSchema `protobuf:"bytes,1,rep,name=tools,proto3" json:"tools,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListToolsResponse) Reset() {
+	*x = ListToolsResponse{}
+	mi := &file_goline_v1_tools_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListToolsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListToolsResponse) ProtoMessage() {}
+
+func (x *ListToolsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_goline_v1_tools_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListToolsResponse.ProtoReflect.Descriptor instead.
+func (*ListToolsResponse) Descriptor() ([]byte, []int) {
+	return file_goline_v1_tools_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListToolsResponse) GetTools() []*ToolSchema {
+	if x != nil {
+		return x.Tools
+	}
+	return nil
+}
+
+// ToolSchema describes a tool the agent can use
+type ToolSchema struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the tool (e.g., "read_file")
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Description of what the tool does
+	Description string `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	// Parameters accepted by the tool
+	Parameters    []*ToolParameter `protobuf:"bytes,3,rep,name=parameters,proto3" json:"parameters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolSchema) Reset() {
+	*x = ToolSchema{}
+	mi := &file_goline_v1_tools_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolSchema) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolSchema) ProtoMessage() {}
+
+func (x *ToolSchema) ProtoReflect() protoreflect.Message {
+	mi := &file_goline_v1_tools_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolSchema.ProtoReflect.Descriptor instead.
+func (*ToolSchema) Descriptor() ([]byte, []int) {
+	return file_goline_v1_tools_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ToolSchema) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolSchema) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *ToolSchema) GetParameters() []*ToolParameter {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+// ToolParameter describes a parameter of a tool
+type ToolParameter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the parameter (e.g., "path")
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Description of the parameter
+	Description string `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	// Whether the parameter must be given
+	Required bool `protobuf:"varint,3,opt,name=required,proto3" json:"required,omitempty"`
+	// Type of the parameter value
+	Type          ToolParameterType `protobuf:"varint,4,opt,name=type,proto3,enum=goline.v1.ToolParameterType" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolParameter) Reset() {
+	*x = ToolParameter{}
+	mi := &file_goline_v1_tools_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolParameter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolParameter) ProtoMessage() {}
+
+func (x *ToolParameter) ProtoReflect() protoreflect.Message {
+	mi := &file_goline_v1_tools_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolParameter.ProtoReflect.Descriptor instead.
+func (*ToolParameter) Descriptor() ([]byte, []int) {
+	return file_goline_v1_tools_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ToolParameter) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolParameter) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *ToolParameter) GetRequired() bool {
+	if x != nil {
+		return x.Required
+	}
+	return false
+}
+
+func (x *ToolParameter) GetType() ToolParameterType {
+	if x != nil {
+		return x.Type
+	}
+	return ToolParameterType_TOOL_PARAMETER_TYPE_UNSPECIFIED
+}
+
+var File_goline_v1_tools_proto protoreflect.FileDescriptor
+
+var file_goline_v1_tools_proto_rawDesc = string([]byte{
+	0x0a, 0x15, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2f, 0x76, 0x31, 0x2f, 0x74, 0x6f, 0x6f, 0x6c,
+	0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e,
+	0x76, 0x31, 0x22, 0x12, 0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x6f, 0x6f, 0x6c, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x40, 0x0a, 0x11, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x6f,
+	0x6f, 0x6c, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2b, 0x0a, 0x05, 0x74,
+	0x6f, 0x6f, 0x6c, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x67, 0x6f, 0x6c,
+	0x69, 0x6e, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x6f, 0x6c, 0x53, 0x63, 0x68, 0x65, 0x6d,
+	0x61, 0x52, 0x05, 0x74, 0x6f, 0x6f, 0x6c, 0x73, 0x22, 0x7c, 0x0a, 0x0a, 0x54, 0x6f, 0x6f, 0x6c,
+	0x53, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65,
+	0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x38, 0x0a, 0x0a,
+	0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x18, 0x2e, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x6f,
+	0x6c, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x52, 0x0a, 0x70, 0x61, 0x72, 0x61,
+	0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x22, 0x93, 0x01, 0x0a, 0x0d, 0x54, 0x6f, 0x6f, 0x6c, 0x50,
+	0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b,
+	0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a,
+	0x0a, 0x08, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x08, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x12, 0x30, 0x0a, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1c, 0x2e, 0x67, 0x6f, 0x6c, 0x69, 0x6e,
+	0x65, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x6f, 0x6c, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74,
+	0x65, 0x72, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x2a, 0x97, 0x01, 0x0a,
+	0x11, 0x54, 0x6f, 0x6f, 0x6c, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x23, 0x0a, 0x1f, 0x54, 0x4f, 0x4f, 0x4c, 0x5f, 0x50, 0x41, 0x52, 0x41, 0x4d,
+	0x45, 0x54, 0x45, 0x52, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43,
+	0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x1e, 0x0a, 0x1a, 0x54, 0x4f, 0x4f, 0x4c, 0x5f,
+	0x50, 0x41, 0x52, 0x41, 0x4d, 0x45, 0x54, 0x45, 0x52, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x53,
+	0x54, 0x52, 0x49, 0x4e, 0x47, 0x10, 0x01, 0x12, 0x1f, 0x0a, 0x1b, 0x54, 0x4f, 0x4f, 0x4c, 0x5f,
+	0x50, 0x41, 0x52, 0x41, 0x4d, 0x45, 0x54, 0x45, 0x52, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x42,
+	0x4f, 0x4f, 0x4c, 0x45, 0x41, 0x4e, 0x10, 0x02, 0x12, 0x1c, 0x0a, 0x18, 0x54, 0x4f, 0x4f, 0x4c,
+	0x5f, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x45, 0x54, 0x45, 0x52, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f,
+	0x4a, 0x53, 0x4f, 0x4e, 0x10, 0x03, 0x32, 0x55, 0x0a, 0x0b, 0x54, 0x6f, 0x6f, 0x6c, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x46, 0x0a, 0x09, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x6f, 0x6f,
+	0x6c, 0x73, 0x12, 0x1b, 0x2e, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c,
+	0x69, 0x73, 0x74, 0x54, 0x6f, 0x6f, 0x6c, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1c, 0x2e, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74,
+	0x54, 0x6f, 0x6f, 0x6c, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x9b, 0x01,
+	0x0a, 0x0d, 0x63, 0x6f, 0x6d, 0x2e, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e, 0x76, 0x31, 0x42,
+	0x0a, 0x54, 0x6f, 0x6f, 0x6c, 0x73, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x50, 0x01, 0x5a, 0x39, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6b, 0x61, 0x7a, 0x7a, 0x31, 0x38,
+	0x37, 0x2f, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x67,
+	0x65, 0x6e, 0x2f, 0x67, 0x6f, 0x2f, 0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2f, 0x76, 0x31, 0x3b,
+	0x67, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x76, 0x31, 0xa2, 0x02, 0x03, 0x47, 0x58, 0x58, 0xaa, 0x02,
+	0x09, 0x47, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x2e, 0x56, 0x31, 0xca, 0x02, 0x09, 0x47, 0x6f, 0x6c,
+	0x69, 0x6e, 0x65, 0x5c, 0x56, 0x31, 0xe2, 0x02, 0x15, 0x47, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x5c,
+	0x56, 0x31, 0x5c, 0x47, 0x50, 0x42, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0xea, 0x02,
+	0x0a, 0x47, 0x6f, 0x6c, 0x69, 0x6e, 0x65, 0x3a, 0x3a, 0x56, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
+})
+
+var (
+	file_goline_v1_tools_proto_rawDescOnce sync.Once
+	file_goline_v1_tools_proto_rawDescData []byte
+)
+
+func file_goline_v1_tools_proto_rawDescGZIP() []byte {
+	file_goline_v1_tools_proto_rawDescOnce.Do(func() {
+		file_goline_v1_tools_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_goline_v1_tools_proto_rawDesc), len(file_goline_v1_tools_proto_rawDesc)))
+	})
+	return file_goline_v1_tools_proto_rawDescData
+}
+
+var file_goline_v1_tools_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_goline_v1_tools_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_goline_v1_tools_proto_goTypes = []any{
+	(ToolParameterType)(0),    // 0: goline.v1.ToolParameterType
+	(*ListToolsRequest)(nil),  // 1: goline.v1.ListToolsRequest
+	(*ListToolsResponse)(nil), // 2: goline.v1.ListToolsResponse
+	(*ToolSchema)(nil),        // 3: goline.v1.ToolSchema
+	(*ToolParameter)(nil),     // 4: goline.v1.ToolParameter
+}
+var file_goline_v1_tools_proto_depIdxs = []int32{
+	3, // 0: goline.v1.ListToolsResponse.tools:type_name -> goline.v1.ToolSchema
+	4, // 1: goline.v1.ToolSchema.parameters:type_name -> goline.v1.ToolParameter
+	0, // 2: goline.v1.ToolParameter.type:type_name -> goline.v1.ToolParameterType
+	1, // 3: goline.v1.ToolService.ListTools:input_type -> goline.v1.ListToolsRequest
+	2, // 4: goline.v1.ToolService.ListTools:output_type -> goline.v1.ListToolsResponse
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_goline_v1_tools_proto_init() }
+func file_goline_v1_tools_proto_init() {
+	if File_goline_v1_tools_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_goline_v1_tools_proto_rawDesc), len(file_goline_v1_tools_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_goline_v1_tools_proto_goTypes,
+		DependencyIndexes: file_goline_v1_tools_proto_depIdxs,
+		EnumInfos:         file_goline_v1_tools_proto_enumTypes,
+		MessageInfos:      file_goline_v1_tools_proto_msgTypes,
+	}.Build()
+	File_goline_v1_tools_proto = out.File
+	file_goline_v1_tools_proto_goTypes = nil
+	file_goline_v1_tools_proto_depIdxs = nil
+}